@@ -241,6 +241,18 @@ func main() {
 				Required: true,
 				Sources:  cli.EnvVars("NEXAPI_TLS_KEY"),
 			},
+			&cli.DurationFlag{
+				Name:    "jwt-key-rotation-interval",
+				Usage:   "How often a new key is generated to sign the JWTs issued by the server, 0 disables rotation and only uses the tls-key",
+				Value:   0,
+				Sources: cli.EnvVars("NEXAPI_JWT_KEY_ROTATION_INTERVAL"),
+			},
+			&cli.DurationFlag{
+				Name:    "device-action-retention",
+				Usage:   "How long the actions devices were asked to run, and their results, are kept",
+				Value:   24 * time.Hour,
+				Sources: cli.EnvVars("NEXAPI_DEVICE_ACTION_RETENTION"),
+			},
 			&cli.StringFlag{
 				Name:     "url",
 				Usage:    "The server url",
@@ -321,6 +333,25 @@ func main() {
 					log.Fatal(err)
 				}
 
+				// Remove expired security group grants so that nexd drops their rules.
+				util.GoWithWaitGroup(wg, func() {
+					util.RunPeriodically(ctx, 30*time.Second, func() {
+						if err := api.ExpireSecurityGroupGrants(ctx); err != nil {
+							logger.Sugar().Errorf("failed to expire security group grants: %v", err)
+						}
+					})
+				})
+
+				// Remove the device actions that are past the retention window.
+				api.DeviceActionRetention = command.Duration("device-action-retention")
+				util.GoWithWaitGroup(wg, func() {
+					util.RunPeriodically(ctx, time.Minute, func() {
+						if err := api.ExpireDeviceActions(ctx); err != nil {
+							logger.Sugar().Errorf("failed to expire device actions: %v", err)
+						}
+					})
+				})
+
 				smtpServer := email.SmtpServer{
 					HostPort: command.String("smtp-host-port"),
 					User:     command.String("smtp-host-user"),
@@ -381,6 +412,16 @@ func main() {
 					log.Fatal(fmt.Errorf("invalid tls-key: %w", err))
 				}
 				api.URL = command.String("url")
+				api.SigningKeyRotationInterval = command.Duration("jwt-key-rotation-interval")
+
+				// Generate new JWT signing keys as the rotation policy requires.
+				util.GoWithWaitGroup(wg, func() {
+					util.RunPeriodically(ctx, time.Minute, func() {
+						if err := api.RotateSigningKeys(ctx); err != nil {
+							logger.Sugar().Errorf("failed to rotate the jwt signing keys: %v", err)
+						}
+					})
+				})
 
 				router, err := routers.NewAPIRouter(ctx, routers.APIRouterOptions{
 					Logger:          logger.Sugar(),
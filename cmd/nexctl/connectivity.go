@@ -26,6 +26,13 @@ func keepaliveStatusTableFields(command *cli.Command) []TableField {
 	fields = append(fields, TableField{Header: "WIREGUARD ADDRESS", Field: "WgIP"})
 	fields = append(fields, TableField{Header: "LATENCY", Field: "Latency"})
 	fields = append(fields, TableField{Header: "PEERING METHOD", Field: "Method"})
+	fields = append(fields, TableField{Header: "PEERING REASON", Formatter: func(item interface{}) string {
+		v := item.(api.KeepaliveStatus)
+		if v.PathReason != "" {
+			return v.PathReason
+		}
+		return v.RelayReason
+	}})
 	fields = append(fields, TableField{Header: "CONNECTION STATUS", Formatter: func(item interface{}) string {
 		green := color.New(color.FgGreen).SprintFunc()
 		red := color.New(color.FgRed).SprintFunc()
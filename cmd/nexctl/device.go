@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/nexodus-io/nexodus/internal/api/public"
 	"github.com/urfave/cli/v3"
 )
@@ -76,6 +77,21 @@ func createDeviceCommand() *cli.Command {
 						Name:     "hostname",
 						Required: false,
 					},
+					&cli.StringFlag{
+						Name:     "peering-group",
+						Usage:    "Devices of the same peering group peer with each other in a vpc with the groups topology",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "device-profile-id",
+						Usage:    "Device profile holding the nexd settings of the device, an empty value removes it",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "revoked",
+						Usage:    "Revoke the device, or re-enable a revoked device with --revoked=false",
+						Required: false,
+					},
 				},
 				Action: func(ctx context.Context, command *cli.Command) error {
 
@@ -96,14 +112,53 @@ func createDeviceCommand() *cli.Command {
 						}
 						update.SecurityGroupId = value
 					}
+					if command.IsSet("peering-group") {
+						update.PeeringGroup = command.String("peering-group")
+					}
+					if command.IsSet("device-profile-id") {
+						value, err := getUUID(command, "device-profile-id")
+						if err != nil {
+							return err
+						}
+						if value == "" {
+							value = uuid.Nil.String()
+						}
+						update.DeviceProfileId = value
+					}
+					if command.IsSet("revoked") {
+						value := command.Bool("revoked")
+						update.Revoked = &value
+					}
 					return updateDevice(ctx, command, devID, update)
 				},
 			},
+			{
+				Name:  "rotate-token",
+				Usage: "Replace the bearer token of a device and revoke its current one",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "device-id",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					devID, err := getUUID(command, "device-id")
+					if err != nil {
+						return err
+					}
+					return rotateDeviceToken(ctx, command, devID)
+				},
+			},
 			{
 				Name:     "metadata",
 				Usage:    "Commands relating to device metadata",
 				Commands: deviceMetadataSubcommands,
 			},
+			{
+				Name:     "action",
+				Usage:    "Commands relating to the actions devices are asked to run",
+				Commands: deviceActionSubcommands,
+			},
 		},
 	}
 }
@@ -148,12 +203,32 @@ func deviceTableFields(command *cli.Command) []TableField {
 			dev := item.(public.ModelsDevice)
 			var reflexiveIp4 []string
 			for _, endpoint := range dev.Endpoints {
-				if endpoint.Source != "local" {
+				if strings.HasPrefix(endpoint.Source, "stun:") {
 					reflexiveIp4 = append(reflexiveIp4, endpoint.Address)
 				}
 			}
 			return strings.Join(reflexiveIp4, ", ")
 		}})
+		fields = append(fields, TableField{Header: "IPv6 ENDPOINT", Formatter: func(item interface{}) string {
+			dev := item.(public.ModelsDevice)
+			var endpoints []string
+			for _, endpoint := range dev.Endpoints {
+				if endpoint.Source == "local-ipv6" || strings.HasPrefix(endpoint.Source, "stun-ipv6:") {
+					endpoints = append(endpoints, endpoint.Address)
+				}
+			}
+			return strings.Join(endpoints, ", ")
+		}})
+		fields = append(fields, TableField{Header: "MAPPED ENDPOINT", Formatter: func(item interface{}) string {
+			dev := item.(public.ModelsDevice)
+			var endpoints []string
+			for _, endpoint := range dev.Endpoints {
+				if strings.HasPrefix(endpoint.Source, "port-mapping:") {
+					endpoints = append(endpoints, endpoint.Address)
+				}
+			}
+			return strings.Join(endpoints, ", ")
+		}})
 		fields = append(fields, TableField{Header: "LOCAL IPv4", Formatter: func(item interface{}) string {
 			dev := item.(public.ModelsDevice)
 			var localIp4 []string
@@ -164,8 +239,24 @@ func deviceTableFields(command *cli.Command) []TableField {
 			}
 			return strings.Join(localIp4, ", ")
 		}})
+		fields = append(fields, TableField{Header: "NAT", Formatter: func(item interface{}) string {
+			dev := item.(public.ModelsDevice)
+			if dev.Nat.Mapping == "" {
+				return ""
+			}
+			nat := []string{"mapping: " + dev.Nat.Mapping}
+			if dev.Nat.Filtering != "" {
+				nat = append(nat, "filtering: "+dev.Nat.Filtering)
+			}
+			if dev.Nat.Hairpinning {
+				nat = append(nat, "hairpinning")
+			}
+			return strings.Join(nat, ", ")
+		}})
 		fields = append(fields, TableField{Header: "OS", Field: "Os"})
 		fields = append(fields, TableField{Header: "SECURITY GROUP ID", Field: "SecurityGroupId"})
+		fields = append(fields, TableField{Header: "PEERING GROUP", Field: "PeeringGroup"})
+		fields = append(fields, TableField{Header: "DEVICE PROFILE ID", Field: "DeviceProfileId"})
 		fields = append(fields, TableField{Header: "ONLINE", Field: "Online"})
 		fields = append(fields, TableField{Header: "ONLINE SINCE", Formatter: func(item interface{}) string {
 			d := item.(public.ModelsDevice)
@@ -211,6 +302,16 @@ func deleteDevice(ctx context.Context, command *cli.Command, devID string) error
 	return nil
 }
 
+func rotateDeviceToken(ctx context.Context, command *cli.Command, devID string) error {
+	c := createClient(ctx, command)
+	res := apiResponse(c.DevicesApi.
+		RotateDeviceToken(ctx, devID).
+		Execute())
+	show(command, deviceTableFields(command), res)
+	showSuccessfully(command, "rotated the token")
+	return nil
+}
+
 func updateDevice(ctx context.Context, command *cli.Command, devID string, update public.ModelsUpdateDevice) error {
 	c := createClient(ctx, command)
 	res := apiResponse(c.DevicesApi.
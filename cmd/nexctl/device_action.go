@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/urfave/cli/v3"
+)
+
+var deviceActionSubcommands []*cli.Command
+
+func init() {
+	deviceActionSubcommands = []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "List the actions a device was asked to run",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "device-id",
+					Required: true,
+				},
+				&cli.BoolFlag{
+					Name:    "full",
+					Aliases: []string{"f"},
+					Usage:   "display the full set of device action details",
+					Value:   false,
+				},
+			},
+			Action: func(ctx context.Context, command *cli.Command) error {
+				deviceID, err := getUUID(command, "device-id")
+				if err != nil {
+					return err
+				}
+				c := createClient(ctx, command)
+				res := apiResponse(c.DevicesApi.
+					ListDeviceActions(ctx, deviceID).
+					Execute())
+				show(command, deviceActionTableFields(command), res)
+				return nil
+			},
+		},
+		{
+			Name:  "run",
+			Usage: "Ask a device to run an action: stun, rekey, flush-peers, diagnostics or log-level",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "device-id",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "action",
+					Usage:    "The action to run: stun, rekey, flush-peers, diagnostics or log-level",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "argument",
+					Usage:    "The argument of the action, the level of the log-level action (default: debug)",
+					Required: false,
+				},
+				&cli.DurationFlag{
+					Name:  "wait",
+					Usage: "How long to wait for the device to post the result, 0 returns once the action was created",
+					Value: 0,
+				},
+			},
+			Action: func(ctx context.Context, command *cli.Command) error {
+				deviceID, err := getUUID(command, "device-id")
+				if err != nil {
+					return err
+				}
+				c := createClient(ctx, command)
+				res := apiResponse(c.DevicesApi.
+					CreateDeviceAction(ctx, deviceID).
+					DeviceAction(public.ModelsAddDeviceAction{
+						Action:   command.String("action"),
+						Argument: command.String("argument"),
+					}).
+					Execute())
+				if wait := command.Duration("wait"); wait > 0 {
+					res = waitForDeviceAction(ctx, command, deviceID, res.Id, wait)
+				}
+				showDeviceAction(command, res)
+				return nil
+			},
+		},
+		{
+			Name:  "get",
+			Usage: "Get an action a device was asked to run, with its result",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "device-id",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "action-id",
+					Required: true,
+				},
+			},
+			Action: func(ctx context.Context, command *cli.Command) error {
+				deviceID, err := getUUID(command, "device-id")
+				if err != nil {
+					return err
+				}
+				actionID, err := getUUID(command, "action-id")
+				if err != nil {
+					return err
+				}
+				c := createClient(ctx, command)
+				res := apiResponse(c.DevicesApi.
+					GetDeviceAction(ctx, deviceID, actionID).
+					Execute())
+				showDeviceAction(command, res)
+				return nil
+			},
+		},
+	}
+}
+
+func deviceActionTableFields(command *cli.Command) []TableField {
+	var fields []TableField
+	fields = append(fields, TableField{Header: "ACTION ID", Field: "Id"})
+	fields = append(fields, TableField{Header: "ACTION", Field: "Action"})
+	fields = append(fields, TableField{Header: "ARGUMENT", Field: "Argument"})
+	fields = append(fields, TableField{Header: "STATUS", Field: "Status"})
+	if command.Bool("full") {
+		fields = append(fields, TableField{Header: "DEVICE ID", Field: "DeviceId"})
+		fields = append(fields, TableField{Header: "ACKNOWLEDGED AT", Field: "AcknowledgedAt"})
+		fields = append(fields, TableField{Header: "COMPLETED AT", Field: "CompletedAt"})
+	}
+	return fields
+}
+
+// showDeviceAction shows a device action, followed by its result when the output is a table.
+func showDeviceAction(command *cli.Command, action *public.ModelsDeviceAction) {
+	show(command, deviceActionTableFields(command), action)
+	output := command.String("output")
+	if (output == encodeColumn || output == encodeNoHeader) && action.Result != "" {
+		fmt.Printf("\n%s\n", action.Result)
+	}
+}
+
+// waitForDeviceAction polls a device action until the device posted its result, or the wait is over.
+func waitForDeviceAction(ctx context.Context, command *cli.Command, deviceID, actionID string, wait time.Duration) *public.ModelsDeviceAction {
+	c := createClient(ctx, command)
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			Fatalf("the device did not post the result of action %s within %v", actionID, wait)
+		case <-ticker.C:
+		}
+		action, _, err := c.DevicesApi.GetDeviceAction(ctx, deviceID, actionID).Execute()
+		if err == nil && action.CompletedAt != "" {
+			return action
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/urfave/cli/v3"
+)
+
+func deviceProfileSettingsFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "ingress",
+			Usage: "Ingress proxy rule of the devices running in proxy mode, format: protocol:port:destination_ip:destination_port[,key=value...]",
+		},
+		&cli.StringSliceFlag{
+			Name:  "egress",
+			Usage: "Egress proxy rule of the devices running in proxy mode, format: protocol:port:destination_ip:destination_port[,key=value...]",
+		},
+		&cli.StringSliceFlag{
+			Name:  "advertise-cidr",
+			Usage: "CIDR the devices advertise to their peers",
+		},
+		&cli.BoolFlag{
+			Name:  "relay",
+			Usage: "Make the devices relay traffic for the devices of the vpc behind symmetric NATs",
+		},
+		&cli.BoolFlag{
+			Name:  "exit-node-client",
+			Usage: "Send the internet traffic of the devices through an exit node of the vpc",
+		},
+		&cli.StringFlag{
+			Name:  "log-level",
+			Usage: "Level nexd logs at",
+		},
+		&cli.IntFlag{
+			Name:  "keepalive",
+			Usage: "Persistent keepalive interval of the tunnels in seconds, 0 turns it off",
+		},
+	}
+}
+
+func createDeviceProfileCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "device-profile",
+		Usage: "Commands relating to device profiles, the nexd settings managed for the devices they are assigned to",
+		Commands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List device profiles",
+				Action: func(ctx context.Context, command *cli.Command) error {
+					return listDeviceProfiles(ctx, command)
+				},
+			},
+			{
+				Name:  "create",
+				Usage: "Create a device profile",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "vpc-id",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "description",
+						Required: false,
+					},
+				}, deviceProfileSettingsFlags()...),
+				Action: func(ctx context.Context, command *cli.Command) error {
+					vpcId, err := getUUID(command, "vpc-id")
+					if err != nil {
+						return err
+					}
+					return createDeviceProfile(ctx, command, public.ModelsAddDeviceProfile{
+						VpcId:       vpcId,
+						Description: command.String("description"),
+						Settings:    deviceProfileSettings(command, public.ModelsDeviceProfileSettings{}),
+					})
+				},
+			},
+			{
+				Name:  "update",
+				Usage: "Update a device profile, the settings that are not given are kept",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "device-profile-id",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "description",
+						Required: false,
+					},
+				}, deviceProfileSettingsFlags()...),
+				Action: func(ctx context.Context, command *cli.Command) error {
+					id, err := getUUID(command, "device-profile-id")
+					if err != nil {
+						return err
+					}
+					return updateDeviceProfile(ctx, command, id)
+				},
+			},
+			{
+				Name:  "delete",
+				Usage: "Delete a device profile",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "device-profile-id",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					id, err := getUUID(command, "device-profile-id")
+					if err != nil {
+						return err
+					}
+					return deleteDeviceProfile(ctx, command, id)
+				},
+			},
+		},
+	}
+}
+
+// deviceProfileSettings returns the settings with the ones given by flags changed.
+func deviceProfileSettings(command *cli.Command, settings public.ModelsDeviceProfileSettings) public.ModelsDeviceProfileSettings {
+	if command.IsSet("ingress") {
+		settings.Ingress = command.StringSlice("ingress")
+	}
+	if command.IsSet("egress") {
+		settings.Egress = command.StringSlice("egress")
+	}
+	if command.IsSet("advertise-cidr") {
+		settings.AdvertiseCidrs = command.StringSlice("advertise-cidr")
+	}
+	if command.IsSet("relay") {
+		relay := command.Bool("relay")
+		settings.Relay = &relay
+	}
+	if command.IsSet("exit-node-client") {
+		exitNodeClient := command.Bool("exit-node-client")
+		settings.ExitNodeClient = &exitNodeClient
+	}
+	if command.IsSet("log-level") {
+		settings.LogLevel = command.String("log-level")
+	}
+	if command.IsSet("keepalive") {
+		keepalive := int32(command.Int("keepalive"))
+		settings.Keepalive = &keepalive
+	}
+	return settings
+}
+
+func deviceProfileTableFields(command *cli.Command) []TableField {
+	var fields []TableField
+	fields = append(fields, TableField{Header: "DEVICE PROFILE ID", Field: "Id"})
+	fields = append(fields, TableField{Header: "DESCRIPTION", Field: "Description"})
+	fields = append(fields, TableField{Header: "VPC ID", Field: "VpcId"})
+	fields = append(fields, TableField{Header: "SETTINGS", Field: "Settings"})
+	return fields
+}
+
+func listDeviceProfiles(ctx context.Context, command *cli.Command) error {
+	c := createClient(ctx, command)
+	res := apiResponse(c.DeviceProfileApi.
+		ListDeviceProfiles(ctx).
+		Execute())
+	show(command, deviceProfileTableFields(command), res)
+	return nil
+}
+
+func createDeviceProfile(ctx context.Context, command *cli.Command, profile public.ModelsAddDeviceProfile) error {
+	c := createClient(ctx, command)
+	if profile.VpcId == "" {
+		profile.VpcId = getDefaultVpcId(ctx, c)
+	}
+	res := apiResponse(c.DeviceProfileApi.
+		CreateDeviceProfile(ctx).
+		DeviceProfile(profile).
+		Execute())
+	show(command, deviceProfileTableFields(command), res)
+	return nil
+}
+
+func updateDeviceProfile(ctx context.Context, command *cli.Command, id string) error {
+	c := createClient(ctx, command)
+	profile := apiResponse(c.DeviceProfileApi.
+		GetDeviceProfile(ctx, id).
+		Execute())
+	settings := deviceProfileSettings(command, profile.Settings)
+	update := public.ModelsUpdateDeviceProfile{
+		Settings: &settings,
+	}
+	if command.IsSet("description") {
+		update.Description = command.String("description")
+	}
+	res := apiResponse(c.DeviceProfileApi.
+		UpdateDeviceProfile(ctx, id).
+		Update(update).
+		Execute())
+	show(command, deviceProfileTableFields(command), res)
+	showSuccessfully(command, "updated")
+	return nil
+}
+
+func deleteDeviceProfile(ctx context.Context, command *cli.Command, id string) error {
+	c := createClient(ctx, command)
+	res := apiResponse(c.DeviceProfileApi.
+		DeleteDeviceProfile(ctx, id).
+		Execute())
+	show(command, deviceProfileTableFields(command), res)
+	showSuccessfully(command, "deleted")
+	return nil
+}
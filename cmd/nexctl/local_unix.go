@@ -38,6 +38,22 @@ func init() {
 				Usage:  "Display the nexd status",
 				Action: cmdLocalStatus,
 			},
+			{
+				Name:  "rekey",
+				Usage: "Rotate the wireguard key of this device",
+				Action: func(ctx context.Context, command *cli.Command) error {
+					if err := checkVersion(); err != nil {
+						return err
+					}
+					result, err := callNexd("Rekey", "")
+					if err != nil {
+						fmt.Printf("%s\n", err)
+						return err
+					}
+					fmt.Printf("%s\n", result)
+					return nil
+				},
+			},
 			{
 				Name:  "get",
 				Usage: "Get a value from the local nexd instance",
@@ -160,12 +176,12 @@ func init() {
 						Flags: []cli.Flag{
 							&cli.StringSliceFlag{
 								Name:     "ingress",
-								Usage:    "Forward connections from the Nexodus network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via a locally accessible network using a `value` in the form: protocol:port:destination_ip:destination_port. All fields are required.",
+								Usage:    "Forward connections from the Nexodus network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via a locally accessible network using a `value` in the form: protocol:port:destination_ip:destination_port[,key=value...]. All fields are required, the protocol is tcp, udp or http, and the options tune the load balancing and http routing of the destinations of a port.",
 								Required: false,
 							},
 							&cli.StringSliceFlag{
 								Name:     "egress",
-								Usage:    "Forward connections from a locally accessible network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via the Nexodus network using a `value` in the form: protocol:port:destination_ip:destination_port. All fields are required.",
+								Usage:    "Forward connections from a locally accessible network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via the Nexodus network using a `value` in the form: protocol:port:destination_ip:destination_port[,key=value...]. All fields are required, the options tune the load balancing of the destinations of a port.",
 								Required: false,
 							},
 						},
@@ -179,12 +195,12 @@ func init() {
 						Flags: []cli.Flag{
 							&cli.StringSliceFlag{
 								Name:     "ingress",
-								Usage:    "Forward connections from the Nexodus network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via a locally accessible network using a `value` in the form: protocol:port:destination_ip:destination_port. All fields are required.",
+								Usage:    "Forward connections from the Nexodus network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via a locally accessible network using a `value` in the form: protocol:port:destination_ip:destination_port[,key=value...]. All fields are required, the protocol is tcp, udp or http, and the options tune the load balancing and http routing of the destinations of a port.",
 								Required: false,
 							},
 							&cli.StringSliceFlag{
 								Name:     "egress",
-								Usage:    "Forward connections from a locally accessible network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via the Nexodus network using a `value` in the form: protocol:port:destination_ip:destination_port. All fields are required.",
+								Usage:    "Forward connections from a locally accessible network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via the Nexodus network using a `value` in the form: protocol:port:destination_ip:destination_port[,key=value...]. All fields are required, the options tune the load balancing of the destinations of a port.",
 								Required: false,
 							},
 						},
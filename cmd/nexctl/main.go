@@ -66,6 +66,11 @@ func main() {
 				Usage:      "Api server URL",
 				Persistent: true,
 			},
+			&cli.StringSliceFlag{
+				Name:       "api-url",
+				Usage:      "URL of an apiserver, repeat to fail over between several. By default they are discovered from the service URL",
+				Persistent: true,
+			},
 			&cli.StringFlag{
 				Name:       "username",
 				Usage:      "Username",
@@ -104,6 +109,7 @@ func main() {
 			createOrganizationCommand(),
 			createVpcCommand(),
 			createDeviceCommand(),
+			createDeviceProfileCommand(),
 			createUserSubCommand(),
 			createSecurityGroupCommand(),
 			createInvitationCommand(),
@@ -154,12 +160,21 @@ func createClient(ctx context.Context, command *cli.Command) *client.APIClient {
 		Fatalf("invalid '%s=%s' flag provided. error: 'https://' URL scheme is required", flagUsed, urlValue)
 	}
 
-	if addApiPrefix {
-		apiURL.Host = "api." + apiURL.Host
-		apiURL.Path = ""
+	apiURLs := []string{apiURL.String()}
+	if command.IsSet("api-url") {
+		apiURLs = command.StringSlice("api-url")
+	} else if addApiPrefix {
+		apiURLs = nil
+		for _, u := range client.ApiURLs(ctx, apiURL) {
+			apiURLs = append(apiURLs, u.String())
+		}
 	}
 
-	c, err := client.NewAPIClient(ctx, apiURL.String(), nil, createClientOptions(command)...)
+	options := createClientOptions(command)
+	if len(apiURLs) > 1 {
+		options = append(options, client.WithFailoverURLs(apiURLs[1:]...))
+	}
+	c, err := client.NewAPIClient(ctx, apiURLs[0], nil, options...)
 	if err != nil {
 		Fatal(err)
 	}
@@ -20,6 +20,7 @@ type WgSession struct {
 	Tx              int64
 	Rx              int64
 	Healthy         bool
+	Relay           string
 }
 
 type ListPeersResponse struct {
@@ -49,6 +50,7 @@ func peerTableFields(command *cli.Command) []TableField {
 	fields = append(fields, TableField{Header: "TRANSMITTED", Field: "Tx"})
 	fields = append(fields, TableField{Header: "RECEIVED", Field: "Rx"})
 	fields = append(fields, TableField{Header: "HEALTHY", Field: "Healthy"})
+	fields = append(fields, TableField{Header: "RELAY", Field: "Relay"})
 	return fields
 }
 
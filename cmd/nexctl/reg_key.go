@@ -40,6 +40,10 @@ func createRegKeyCommand() *cli.Command {
 						Name:     "security-group-id",
 						Required: false,
 					},
+					&cli.StringFlag{
+						Name:     "device-profile-id",
+						Required: false,
+					},
 					&cli.StringFlag{
 						Name:     "description",
 						Required: false,
@@ -74,6 +78,7 @@ func createRegKeyCommand() *cli.Command {
 						ExpiresAt:       getExpiration(command, "expiration"),
 						SingleUse:       command.Bool("single-use"),
 						SecurityGroupId: command.String("security-group-id"),
+						DeviceProfileId: command.String("device-profile-id"),
 						Settings:        settings,
 					})
 				},
@@ -90,6 +95,10 @@ func createRegKeyCommand() *cli.Command {
 						Name:     "security-group-id",
 						Required: false,
 					},
+					&cli.StringFlag{
+						Name:     "device-profile-id",
+						Required: false,
+					},
 					&cli.StringFlag{
 						Name:     "description",
 						Required: false,
@@ -118,6 +127,7 @@ func createRegKeyCommand() *cli.Command {
 						Description:     command.String("description"),
 						ExpiresAt:       getExpiration(command, "expiration"),
 						SecurityGroupId: command.String("security-group-id"),
+						DeviceProfileId: command.String("device-profile-id"),
 						Settings:        settings,
 					})
 				},
@@ -154,6 +164,7 @@ func regTokenTableFields(command *cli.Command) []TableField {
 	if command.Bool("full") {
 		fields = append(fields, TableField{Header: "VPC ID", Field: "VpcId"})
 		fields = append(fields, TableField{Header: "SECURITY GROUP ID", Field: "SecurityGroupId"})
+		fields = append(fields, TableField{Header: "DEVICE PROFILE ID", Field: "DeviceProfileId"})
 		fields = append(fields, TableField{Header: "SINGLE USE", Formatter: func(item interface{}) string {
 			if item.(public.ModelsRegKey).DeviceId == "" {
 				return "false"
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/nexodus-io/nexodus/internal/api/public"
 	"github.com/urfave/cli/v3"
+	"strings"
+	"time"
 )
 
 func createSecurityGroupCommand() *cli.Command {
@@ -144,6 +146,108 @@ func createSecurityGroupCommand() *cli.Command {
 					return updateSecurityGroup(ctx, command, id, update)
 				},
 			},
+			{
+				Name:  "grant",
+				Usage: "temporarily add a rule to a security group",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "security-group-id",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "direction",
+						Usage:    "direction of the rule: inbound or outbound",
+						Value:    "inbound",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "rule",
+						Usage:    "the security rule to grant in json format",
+						Required: true,
+					},
+					&cli.DurationFlag{
+						Name:     "duration",
+						Usage:    "how long the grant should be applied for",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "requester",
+						Usage:    "who asked for the access",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "reason",
+						Required: false,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					id, err := getUUID(command, "security-group-id")
+					if err != nil {
+						return err
+					}
+					var rule public.ModelsSecurityRule
+					if err := json.Unmarshal([]byte(command.String("rule")), &rule); err != nil {
+						return fmt.Errorf("failed to unmarshal security rule: %w", err)
+					}
+					if err := checkICMPRule(rule); err != nil {
+						return fmt.Errorf("invalid rule: %w", err)
+					}
+					duration := command.Duration("duration")
+					if duration <= 0 {
+						return fmt.Errorf("invalid value for --duration flag: must be greater than zero")
+					}
+
+					return createSecurityGroupGrant(ctx, command, id, public.ModelsAddSecurityGroupGrant{
+						Direction: command.String("direction"),
+						Rule:      rule,
+						Requester: command.String("requester"),
+						Reason:    command.String("reason"),
+						ExpiresAt: time.Now().Add(duration).Format(time.RFC3339),
+					})
+				},
+			},
+			{
+				Name:  "list-grants",
+				Usage: "list the active and expired grants of a security group",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "security-group-id",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					id, err := getUUID(command, "security-group-id")
+					if err != nil {
+						return err
+					}
+					return listSecurityGroupGrants(ctx, command, id)
+				},
+			},
+			{
+				Name:  "revoke-grant",
+				Usage: "remove a grant from a security group before it expires",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "security-group-id",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "grant-id",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					id, err := getUUID(command, "security-group-id")
+					if err != nil {
+						return err
+					}
+					grantId, err := getUUID(command, "grant-id")
+					if err != nil {
+						return err
+					}
+					return revokeSecurityGroupGrant(ctx, command, id, grantId)
+				},
+			},
 		},
 	}
 }
@@ -211,6 +315,51 @@ func deleteSecurityGroup(ctx context.Context, command *cli.Command, encodeOut, s
 	return nil
 }
 
+func securityGroupGrantTableFields(command *cli.Command) []TableField {
+	var fields []TableField
+	fields = append(fields, TableField{Header: "GRANT ID", Field: "Id"})
+	fields = append(fields, TableField{Header: "DIRECTION", Field: "Direction"})
+	fields = append(fields, TableField{Header: "RULE", Field: "Rule"})
+	fields = append(fields, TableField{Header: "REQUESTER", Field: "Requester"})
+	fields = append(fields, TableField{Header: "APPROVER ID", Field: "ApproverId"})
+	fields = append(fields, TableField{Header: "EXPIRES AT", Field: "ExpiresAt"})
+	fields = append(fields, TableField{Header: "EXPIRED AT", Field: "ExpiredAt"})
+	fields = append(fields, TableField{Header: "REASON", Field: "Reason"})
+	return fields
+}
+
+// createSecurityGroupGrant temporarily adds a rule to a security group.
+func createSecurityGroupGrant(ctx context.Context, command *cli.Command, secGroupID string, grant public.ModelsAddSecurityGroupGrant) error {
+	c := createClient(ctx, command)
+	res := apiResponse(c.SecurityGroupApi.
+		CreateSecurityGroupGrant(ctx, secGroupID).
+		Grant(grant).
+		Execute())
+	show(command, securityGroupGrantTableFields(command), res)
+	return nil
+}
+
+// listSecurityGroupGrants lists the grants of a security group.
+func listSecurityGroupGrants(ctx context.Context, command *cli.Command, secGroupID string) error {
+	c := createClient(ctx, command)
+	res := apiResponse(c.SecurityGroupApi.
+		ListSecurityGroupGrants(ctx, secGroupID).
+		Execute())
+	show(command, securityGroupGrantTableFields(command), res)
+	return nil
+}
+
+// revokeSecurityGroupGrant removes a grant from a security group before it expires.
+func revokeSecurityGroupGrant(ctx context.Context, command *cli.Command, secGroupID, grantID string) error {
+	c := createClient(ctx, command)
+	res := apiResponse(c.SecurityGroupApi.
+		RevokeSecurityGroupGrant(ctx, secGroupID, grantID).
+		Execute())
+	show(command, securityGroupGrantTableFields(command), res)
+	showSuccessfully(command, "revoked")
+	return nil
+}
+
 func jsonStringToSecurityRules(jsonString string) ([]public.ModelsSecurityRule, error) {
 	var rules []public.ModelsSecurityRule
 	err := json.Unmarshal([]byte(jsonString), &rules)
@@ -239,8 +388,8 @@ func checkICMPRules(inboundRules []public.ModelsSecurityRule, outboundRules []pu
 
 // checkICMPRule checks an ICMP rules with ports set to anything but 0.
 func checkICMPRule(rule public.ModelsSecurityRule) error {
-	if rule.IpProtocol == "icmp" && (rule.FromPort != 0 || rule.ToPort != 0) {
-		return fmt.Errorf("error: ICMP rule should have FromPort and ToPort set to 0 or left undefined")
+	if strings.HasPrefix(rule.IpProtocol, "icmp") && (rule.FromPort != 0 || rule.ToPort != 0 || len(rule.Ports) != 0) {
+		return fmt.Errorf("error: ICMP rule should have FromPort and ToPort set to 0 or left undefined and no ports, use icmp_types and icmp_codes to match ICMP messages")
 	}
 	return nil
 }
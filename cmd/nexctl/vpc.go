@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/nexodus-io/nexodus/internal/api/public"
 	"github.com/urfave/cli/v3"
@@ -39,14 +43,50 @@ func createVpcCommand() *cli.Command {
 						Name:     "ipv6-cidr",
 						Required: false,
 					},
+					&cli.DurationFlag{
+						Name:     "max-key-age",
+						Usage:    "Devices must rotate their wireguard keys before they reach this age, e.g. 2160h",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "preshared-keys",
+						Usage:    "Devices also use a wireguard preshared key with each of their peers",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "on-demand-peering",
+						Usage:    "Devices only peer with each other when their security groups call for it or once they exchange traffic",
+						Required: false,
+					},
+					&cli.DurationFlag{
+						Name:     "peer-idle-timeout",
+						Usage:    "How long an on-demand peer is kept without traffic, e.g. 30m",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "topology",
+						Usage:    "Which devices peer with each other: full-mesh, hub-and-spoke or groups",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:     "mtu",
+						Usage:    "The MTU of the tunnel interface of the devices, 0 lets them discover the path MTU",
+						Required: false,
+					},
 				},
 				Action: func(ctx context.Context, command *cli.Command) error {
 					return createVPC(ctx, command, public.ModelsAddVPC{
-						Ipv4Cidr:       command.String("ipv4-cidr"),
-						Ipv6Cidr:       command.String("ipv6-cidr"),
-						Description:    command.String("description"),
-						OrganizationId: command.String("organization-id"),
-						PrivateCidr:    !(command.String("ipv4-cidr") == "" && command.String("ipv6-cidr") == ""),
+						Ipv4Cidr:               command.String("ipv4-cidr"),
+						Ipv6Cidr:               command.String("ipv6-cidr"),
+						Description:            command.String("description"),
+						OrganizationId:         command.String("organization-id"),
+						PrivateCidr:            !(command.String("ipv4-cidr") == "" && command.String("ipv6-cidr") == ""),
+						MaxKeyAgeSeconds:       int32(command.Duration("max-key-age") / time.Second),
+						PresharedKeys:          command.Bool("preshared-keys"),
+						OnDemandPeering:        command.Bool("on-demand-peering"),
+						PeerIdleTimeoutSeconds: int32(command.Duration("peer-idle-timeout") / time.Second),
+						Topology:               command.String("topology"),
+						Mtu:                    int32(command.Int("mtu")),
 					})
 				},
 			},
@@ -62,6 +102,36 @@ func createVpcCommand() *cli.Command {
 						Name:     "description",
 						Required: false,
 					},
+					&cli.DurationFlag{
+						Name:     "max-key-age",
+						Usage:    "Devices must rotate their wireguard keys before they reach this age, e.g. 2160h",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "preshared-keys",
+						Usage:    "Devices also use a wireguard preshared key with each of their peers",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "on-demand-peering",
+						Usage:    "Devices only peer with each other when their security groups call for it or once they exchange traffic",
+						Required: false,
+					},
+					&cli.DurationFlag{
+						Name:     "peer-idle-timeout",
+						Usage:    "How long an on-demand peer is kept without traffic, e.g. 30m",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "topology",
+						Usage:    "Which devices peer with each other: full-mesh, hub-and-spoke or groups",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:     "mtu",
+						Usage:    "The MTU of the tunnel interface of the devices, 0 lets them discover the path MTU",
+						Required: false,
+					},
 				},
 				Action: func(ctx context.Context, command *cli.Command) error {
 					id, err := getUUID(command, "vpc-id")
@@ -70,7 +140,13 @@ func createVpcCommand() *cli.Command {
 					}
 
 					update := public.ModelsUpdateVPC{
-						Description: command.String("description"),
+						Description:            command.String("description"),
+						MaxKeyAgeSeconds:       int32(command.Duration("max-key-age") / time.Second),
+						PresharedKeys:          command.Bool("preshared-keys"),
+						OnDemandPeering:        command.Bool("on-demand-peering"),
+						PeerIdleTimeoutSeconds: int32(command.Duration("peer-idle-timeout") / time.Second),
+						Topology:               command.String("topology"),
+						Mtu:                    int32(command.Int("mtu")),
 					}
 					return updateVPC(ctx, command, id, update)
 				},
@@ -92,6 +168,39 @@ func createVpcCommand() *cli.Command {
 					return deleteVPC(ctx, command, vpcID)
 				},
 			},
+			{
+				Name:  "connectivity",
+				Usage: "Show whether the devices of a vpc reach each other directly, through a relay or not at all",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "vpc-id",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "device-id",
+						Usage:    "only show the pairs this device is part of",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "also show the pairs that reach each other directly",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:    "full",
+						Aliases: []string{"f"},
+						Usage:   "display what both devices of each pair reported",
+						Value:   false,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					vpcID, err := getUUID(command, "vpc-id")
+					if err != nil {
+						return err
+					}
+					return vpcConnectivity(ctx, command, vpcID)
+				},
+			},
 			{
 				Name:     "metadata",
 				Usage:    "Commands relating to device metadata across the vpc",
@@ -125,6 +234,23 @@ func vpcTableFields() []TableField {
 	fields = append(fields, TableField{Header: "IPV4 CIDR", Field: "Ipv4Cidr"})
 	fields = append(fields, TableField{Header: "IPV6 CIDR", Field: "Ipv6Cidr"})
 	fields = append(fields, TableField{Header: "DESCRIPTION", Field: "Description"})
+	fields = append(fields, TableField{Header: "MAX KEY AGE", Formatter: func(item interface{}) string {
+		vpc := item.(public.ModelsVPC)
+		if vpc.MaxKeyAgeSeconds == 0 {
+			return ""
+		}
+		return (time.Duration(vpc.MaxKeyAgeSeconds) * time.Second).String()
+	}})
+	fields = append(fields, TableField{Header: "PRESHARED KEYS", Field: "PresharedKeys"})
+	fields = append(fields, TableField{Header: "ON DEMAND PEERING", Field: "OnDemandPeering"})
+	fields = append(fields, TableField{Header: "TOPOLOGY", Field: "Topology"})
+	fields = append(fields, TableField{Header: "MTU", Formatter: func(item interface{}) string {
+		vpc := item.(public.ModelsVPC)
+		if vpc.Mtu == 0 {
+			return ""
+		}
+		return strconv.Itoa(int(vpc.Mtu))
+	}})
 	return fields
 }
 func listVPCs(ctx context.Context, command *cli.Command) error {
@@ -158,3 +284,76 @@ func deleteVPC(ctx context.Context, command *cli.Command, id string) error {
 	showSuccessfully(command, "deleted")
 	return nil
 }
+
+func vpcConnectivityTableFields(command *cli.Command) []TableField {
+	report := func(item interface{}, peer bool, value func(report *public.ModelsPeerTelemetry) string) string {
+		pair := item.(public.ModelsDevicePairConnectivity)
+		report := pair.DeviceReport
+		if peer {
+			report = pair.PeerReport
+		}
+		if report == nil {
+			return ""
+		}
+		return value(report)
+	}
+	method := func(report *public.ModelsPeerTelemetry) string {
+		return report.PeeringMethod
+	}
+	handshake := func(report *public.ModelsPeerTelemetry) string {
+		return report.LatestHandshake
+	}
+	transfer := func(report *public.ModelsPeerTelemetry) string {
+		return fmt.Sprintf("%d/%d", report.RxBytes, report.TxBytes)
+	}
+
+	var fields []TableField
+	fields = append(fields, TableField{Header: "DEVICE ID", Field: "DeviceId"})
+	fields = append(fields, TableField{Header: "PEER ID", Field: "PeerId"})
+	fields = append(fields, TableField{Header: "STATUS", Field: "Status"})
+	fields = append(fields, TableField{Header: "DEVICE METHOD", Formatter: func(item interface{}) string {
+		return report(item, false, method)
+	}})
+	fields = append(fields, TableField{Header: "PEER METHOD", Formatter: func(item interface{}) string {
+		return report(item, true, method)
+	}})
+	if command.Bool("full") {
+		fields = append(fields, TableField{Header: "DEVICE HANDSHAKE", Formatter: func(item interface{}) string {
+			return report(item, false, handshake)
+		}})
+		fields = append(fields, TableField{Header: "PEER HANDSHAKE", Formatter: func(item interface{}) string {
+			return report(item, true, handshake)
+		}})
+		fields = append(fields, TableField{Header: "DEVICE RX/TX", Formatter: func(item interface{}) string {
+			return report(item, false, transfer)
+		}})
+		fields = append(fields, TableField{Header: "PEER RX/TX", Formatter: func(item interface{}) string {
+			return report(item, true, transfer)
+		}})
+	}
+	return fields
+}
+
+func vpcConnectivity(ctx context.Context, command *cli.Command, id string) error {
+	c := createClient(ctx, command)
+	request := c.VPCApi.GetVPCConnectivity(ctx, id)
+	if command.IsSet("device-id") {
+		deviceID, err := getUUID(command, "device-id")
+		if err != nil {
+			return err
+		}
+		request = request.DeviceId(deviceID)
+	}
+	if command.Bool("all") {
+		request = request.All(true)
+	}
+	res := apiResponse(request.Execute())
+
+	output := command.String("output")
+	if output == encodeColumn || output == encodeNoHeader {
+		show(command, vpcConnectivityTableFields(command), res.Pairs)
+		return nil
+	}
+	show(command, nil, res)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/urfave/cli/v3"
+
+	"github.com/nexodus-io/nexodus/internal/nexodus"
+)
+
+var configModes = map[string]nexdMode{
+	"agent":  nexdModeAgent,
+	"router": nexdModeRouter,
+	"relay":  nexdModeRelay,
+	"proxy":  nexdModeProxy,
+}
+
+// settings resolves the value of a setting from its flag and the configuration file, a flag set on the command line
+// or through its environment variable takes precedence over the file, which takes precedence over the flag default.
+type settings struct {
+	command *cli.Command
+	config  *nexodus.Config
+}
+
+func (s settings) fromFile(name string) (any, bool) {
+	if s.config == nil || s.command.IsSet(name) {
+		return nil, false
+	}
+	return s.config.Setting(name)
+}
+
+func (s settings) IsSet(name string) bool {
+	_, ok := s.fromFile(name)
+	return ok || s.command.IsSet(name)
+}
+
+func (s settings) String(name string) string {
+	if value, ok := s.fromFile(name); ok {
+		return value.(string)
+	}
+	return s.command.String(name)
+}
+
+func (s settings) Bool(name string) bool {
+	if value, ok := s.fromFile(name); ok {
+		return value.(bool)
+	}
+	return s.command.Bool(name)
+}
+
+func (s settings) Int(name string) int {
+	if value, ok := s.fromFile(name); ok {
+		return value.(int)
+	}
+	return int(s.command.Int(name))
+}
+
+func (s settings) StringSlice(name string) []string {
+	if value, ok := s.fromFile(name); ok {
+		return value.([]string)
+	}
+	return s.command.StringSlice(name)
+}
+
+// flags returns the settings of the configuration file that flags override.
+func (s settings) flags() []string {
+	return s.command.FlagNames()
+}
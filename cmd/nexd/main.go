@@ -18,12 +18,14 @@ import (
 	"github.com/nexodus-io/nexodus/internal/state/kstore"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/nexodus-io/nexodus/internal/client"
 	"github.com/nexodus-io/nexodus/internal/nexodus"
 	"github.com/nexodus-io/nexodus/internal/stun"
 	"github.com/nexodus-io/nexodus/internal/util"
 	"github.com/urfave/cli/v3"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -50,8 +52,30 @@ var DefaultServiceURL = "https://try.nexodus.io"
 
 func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logLevel *zap.AtomicLevel, mode nexdMode) error {
 
+	var config *nexodus.Config
+	configFile := command.String("config")
+	if configFile != "" {
+		var err error
+		config, err = nexodus.LoadConfig(configFile)
+		if err != nil {
+			return err
+		}
+		if configMode, ok := configModes[config.Mode]; ok {
+			if mode == nexdModeAgent {
+				mode = configMode
+			} else if mode != configMode {
+				return fmt.Errorf("the configuration file %s sets the %s mode, which conflicts with the nexd command", configFile, config.Mode)
+			}
+		}
+		if config.LogLevel != "" {
+			level, _ := zapcore.ParseLevel(config.LogLevel)
+			logLevel.SetLevel(level)
+		}
+	}
+	s := settings{command: command, config: config}
+
 	// Fail if you try to configure the service URL both ways
-	if command.IsSet("service-url") && command.Args().Len() > 0 {
+	if s.IsSet("service-url") && command.Args().Len() > 0 {
 		return fmt.Errorf("please remove the service URL positional argument, it was configured via the --service-url flag")
 	}
 	if command.Args().Len() > 1 {
@@ -59,28 +83,28 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 	}
 
 	serviceURL := ""
-	if command.IsSet("service-url") {
+	if s.IsSet("service-url") {
 		// It was set via a flag
-		serviceURL = command.String("service-url")
+		serviceURL = s.String("service-url")
 	} else if command.Args().Len() > 0 {
 		// It was set via a positional arg
 		serviceURL = command.Args().First()
 		logger.Info("DEPRECATION WARNING: configuring the service url via the positional argument will not be supported in a future release.  Please use the --service-url flag instead.")
 	}
 
-	regKey := command.String("reg-key")
-	if command.IsSet("reg-key") {
-		if command.IsSet("security-group-id") {
+	regKey := s.String("reg-key")
+	if s.IsSet("reg-key") {
+		if s.IsSet("security-group-id") {
 			return fmt.Errorf("the --reg-key and --security-group-id flags are mutually exclusive")
 		}
-		if command.IsSet("vpc-id") {
+		if s.IsSet("vpc-id") {
 			return fmt.Errorf("the --reg-key and --vpc-id flags are mutually exclusive")
 		}
 
 		// TODO: in the future, always assume the service-url is part of the reg-key
 		if strings.Contains(regKey, "#") {
 
-			if command.IsSet("service-url") && command.IsSet("reg-key") {
+			if s.IsSet("service-url") && s.IsSet("reg-key") {
 				return fmt.Errorf("the --reg-key and --service-url flags are mutually exclusive")
 			}
 
@@ -106,18 +130,32 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 		return fmt.Errorf("no service URL provided: try using the --service-url flag")
 	}
 
-	apiURL, err := url.Parse(serviceURL)
+	parsedServiceURL, err := url.Parse(serviceURL)
 	if err != nil {
 		return fmt.Errorf("invalid '--service-url=%s' flag provided. error: %w", serviceURL, err)
 	}
 
-	if apiURL.Scheme != "https" {
+	if parsedServiceURL.Scheme != "https" {
 		return fmt.Errorf("invalid '--service-url=%s' flag provided. error: 'https://' URL scheme is required", serviceURL)
 	}
 
-	// Force controller URL be api.${DOMAIN}
-	apiURL.Host = "api." + apiURL.Host
-	apiURL.Path = ""
+	// The apiservers are api.${DOMAIN}, or the ones listed by the SRV record of the domain, unless they are configured
+	var apiURLs []*url.URL
+	if s.IsSet("api-url") {
+		for _, value := range s.StringSlice("api-url") {
+			apiURL, err := url.Parse(value)
+			if err != nil {
+				return fmt.Errorf("invalid '--api-url=%s' flag provided. error: %w", value, err)
+			}
+			if apiURL.Scheme != "https" {
+				return fmt.Errorf("invalid '--api-url=%s' flag provided. error: 'https://' URL scheme is required", value)
+			}
+			apiURL.Path = ""
+			apiURLs = append(apiURLs, apiURL)
+		}
+	} else {
+		apiURLs = client.ApiURLs(ctx, parsedServiceURL)
+	}
 
 	_, err = nexodus.CtlStatus(command)
 	if err == nil {
@@ -132,18 +170,52 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 	userspaceMode := false
 	relayNode := false
 	var advertiseCidr []string
+	// the settings of other modes can only come from the configuration file
+	if mode != nexdModeRouter {
+		for _, name := range []string{"advertise-cidr", "network-router", "disable-nat", "exit-node"} {
+			if s.IsSet(name) {
+				return fmt.Errorf("the %s setting of the configuration file only applies in router mode", name)
+			}
+		}
+	}
+	if mode != nexdModeProxy && (s.IsSet("ingress") || s.IsSet("egress")) {
+		return fmt.Errorf("the ingress and egress settings of the configuration file only apply in proxy mode")
+	}
+	if s.Bool("exit-node-client") && runtime.GOOS != nexodus.Linux.String() {
+		return fmt.Errorf("exit-node support is currently only supported for Linux operating systems")
+	}
+
 	switch mode {
 	case nexdModeAgent:
 		logger.Info("Starting node agent with wireguard driver")
 	case nexdModeRouter:
-		advertiseCidr = command.StringSlice("advertise-cidr")
+		advertiseCidr = s.StringSlice("advertise-cidr")
 		// Check if child-prefix is set and log a deprecation warning.
-		if command.IsSet("child-prefix") {
+		if s.IsSet("child-prefix") {
 			logger.Warn("DEPRECATION WARNING: The 'child-prefix' flag is deprecated. In the future, please use 'advertise-cidr' instead.")
-			advertiseCidr = append(advertiseCidr, command.StringSlice("child-prefix")...)
+			advertiseCidr = append(advertiseCidr, s.StringSlice("child-prefix")...)
+		}
+		if s.Bool("exit-node") {
+			if runtime.GOOS != nexodus.Linux.String() {
+				return fmt.Errorf("exit-node support is currently only supported for Linux operating systems")
+			}
+			if !slices.Contains(advertiseCidr, "0.0.0.0/0") {
+				advertiseCidr = append(advertiseCidr, "0.0.0.0/0")
+			}
+		}
+		if s.Bool("network-router") {
+			if runtime.GOOS != nexodus.Linux.String() {
+				return fmt.Errorf("network-router mode is only supported for Linux operating systems")
+			}
+			if len(advertiseCidr) == 0 {
+				return fmt.Errorf("--advertise-cidr is required for a device to be a network-router")
+			}
 		}
 		logger.Info("Starting node agent with wireguard driver and router function")
 	case nexdModeRelay:
+		if runtime.GOOS != nexodus.Linux.String() {
+			return fmt.Errorf("Relay node is only supported for Linux Operating System")
+		}
 		relayNode = true
 		logger.Info("Starting relay agent with wireguard driver")
 	case nexdModeProxy:
@@ -151,7 +223,7 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 		logger.Info("Starting in L4 proxy mode")
 	}
 
-	stunServers := command.StringSlice("stun-server")
+	stunServers := s.StringSlice("stun-server")
 	if len(stunServers) > 0 {
 		if len(stunServers) < 2 {
 			return fmt.Errorf("at least two stun servers are required")
@@ -164,7 +236,7 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 		log.Error(err)
 	}
 
-	stateDir := command.String("state-dir")
+	stateDir := s.String("state-dir")
 	if stateStore == nil {
 		stateStore = fstore.New(filepath.Join(stateDir, "state.json"))
 	}
@@ -173,28 +245,35 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 	options := nexodus.Options{
 		Logger:                  logger.Sugar(),
 		LogLevel:                logLevel,
-		ApiURL:                  apiURL,
+		ApiURLs:                 apiURLs,
+		Config:                  config,
+		ConfigFile:              configFile,
+		ConfigFlags:             s.flags(),
 		RegKey:                  regKey,
-		Username:                command.String("username"),
-		Password:                command.String("password"),
-		ListenPort:              int(command.Int("listen-port")),
-		RequestedIP:             command.String("request-ip"),
-		UserProvidedLocalIP:     command.String("local-endpoint-ip"),
+		Username:                s.String("username"),
+		Password:                s.String("password"),
+		ListenPort:              s.Int("listen-port"),
+		Keepalive:               s.Int("keepalive"),
+		RequestedIP:             s.String("request-ip"),
+		UserProvidedLocalIP:     s.String("local-endpoint-ip"),
 		AdvertiseCidrs:          advertiseCidr,
 		Relay:                   relayNode,
-		RelayOnly:               command.Bool("relay-only"),
-		NetworkRouter:           command.Bool("network-router"),
-		NetworkRouterDisableNAT: command.Bool("disable-nat"),
-		ExitNodeClientEnabled:   command.Bool("exit-node-client"),
-		ExitNodeOriginEnabled:   command.Bool("exit-node"),
-		InsecureSkipTlsVerify:   command.Bool("insecure-skip-tls-verify"),
+		RelayOnly:               s.Bool("relay-only"),
+		NetworkRouter:           s.Bool("network-router"),
+		NetworkRouterDisableNAT: s.Bool("disable-nat"),
+		ExitNodeClientEnabled:   s.Bool("exit-node-client"),
+		ExitNodeOriginEnabled:   s.Bool("exit-node"),
+		InsecureSkipTlsVerify:   s.Bool("insecure-skip-tls-verify"),
 		Version:                 Version,
 		UserspaceMode:           userspaceMode,
 		StateStore:              stateStore,
 		StateDir:                stateDir,
+		TCPRelay:                s.Bool("tcp-relay"),
+		HolePunch:               s.Bool("hole-punch"),
+		PortMapping:             s.Bool("port-mapping"),
 		Context:                 ctx,
-		VpcId:                   parseUUIDFlag(command, "vpc-id"),
-		SecurityGroupId:         parseUUIDFlag(command, "security-group-id"),
+		VpcId:                   parseUUIDFlag(s, "vpc-id"),
+		SecurityGroupId:         parseUUIDFlag(s, "security-group-id"),
 	}
 
 	nex, err := nexodus.New(options)
@@ -204,7 +283,7 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 
 	wg := &sync.WaitGroup{}
 
-	for _, egressRule := range command.StringSlice("egress") {
+	for _, egressRule := range s.StringSlice("egress") {
 		rule, err := nexodus.ParseProxyRule(egressRule, nexodus.ProxyTypeEgress)
 		if err != nil {
 			logger.Fatal(fmt.Sprintf("Failed to add egress proxy rule (%s): %v", egressRule, err))
@@ -214,7 +293,7 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 			logger.Fatal(fmt.Sprintf("Failed to add egress proxy rule (%s): %v", egressRule, err))
 		}
 	}
-	for _, ingressRule := range command.StringSlice("ingress") {
+	for _, ingressRule := range s.StringSlice("ingress") {
 		rule, err := nexodus.ParseProxyRule(ingressRule, nexodus.ProxyTypeIngress)
 		if err != nil {
 			logger.Fatal(fmt.Sprintf("Failed to add ingress proxy rule (%s): %v", ingressRule, err))
@@ -239,11 +318,11 @@ func nexdRun(ctx context.Context, command *cli.Command, logger *zap.Logger, logL
 	return nil
 }
 
-func parseUUIDFlag(command *cli.Command, flagName string) string {
-	if !command.IsSet(flagName) {
+func parseUUIDFlag(s settings, flagName string) string {
+	if !s.IsSet(flagName) {
 		return ""
 	}
-	uuidStr := command.String(flagName)
+	uuidStr := s.String(flagName)
 	uuid, err := uuid.Parse(uuidStr)
 	if err != nil {
 		log.Fatalf("invalid flag --%s: %s", flagName, err)
@@ -300,12 +379,12 @@ func main() {
 				Flags: []cli.Flag{
 					&cli.StringSliceFlag{
 						Name:     "ingress",
-						Usage:    "Forward connections from the Nexodus network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via a locally accessible network using a `value` in the form: protocol:port:destination_ip:destination_port. All fields are required.",
+						Usage:    "Forward connections from the Nexodus network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via a locally accessible network using a `value` in the form: protocol:port:destination_ip:destination_port[,key=value...]. All fields are required, the protocol is tcp, udp or http, and the options tune the load balancing and http routing of the destinations of a port.",
 						Required: false,
 					},
 					&cli.StringSliceFlag{
 						Name:     "egress",
-						Usage:    "Forward connections from a locally accessible network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via the Nexodus network using a `value` in the form: protocol:port:destination_ip:destination_port. All fields are required.",
+						Usage:    "Forward connections from a locally accessible network made to [port] on this proxy instance to port [destination_port] at [destination_ip] via the Nexodus network using a `value` in the form: protocol:port:destination_ip:destination_port[,key=value...]. All fields are required, the options tune the load balancing of the destinations of a port.",
 						Required: false,
 					},
 				},
@@ -314,28 +393,6 @@ func main() {
 				Name:  "router",
 				Usage: "Enable advertise-cidr function of the node agent to enable prefix forwarding.",
 				Action: func(ctx context.Context, command *cli.Command) error {
-					if command.Bool("exit-node") {
-						if runtime.GOOS != nexodus.Linux.String() {
-							return fmt.Errorf("exit-node support is currently only supported for Linux operating systems")
-						}
-						advertiseCidrs := command.StringSlice("advertise-cidr")
-						// Check if "0.0.0.0/0" already exists in advertise-cidr
-						found := false
-						for _, prefix := range advertiseCidrs {
-							if prefix == "0.0.0.0/0" {
-								found = true
-								break
-							}
-						}
-						// If not found, add it to advertise-cidr
-						if !found {
-							advertiseCidrs = append(advertiseCidrs, "0.0.0.0/0")
-							err := command.Set("advertise-cidr", strings.Join(advertiseCidrs, ","))
-							if err != nil {
-								return fmt.Errorf("failed to set advertise-cidr: %w", err)
-							}
-						}
-					}
 					return nexdRun(ctx, command, logger, logLevel, nexdModeRouter)
 				},
 
@@ -394,15 +451,19 @@ func main() {
 				Name:  "relay",
 				Usage: "Enable relay and discovery support function for the node agent.",
 				Action: func(ctx context.Context, command *cli.Command) error {
-					if runtime.GOOS != nexodus.Linux.String() {
-						return fmt.Errorf("Relay node is only supported for Linux Operating System")
-					}
-
 					return nexdRun(ctx, command, logger, logLevel, nexdModeRelay)
 				},
 			},
 		},
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:       "config",
+				Usage:      "YAML configuration `file` with settings named like the flags, changes to it are applied without a restart where possible. Flags take precedence over it",
+				Sources:    cli.EnvVars("NEXD_CONFIG"),
+				Required:   false,
+				Category:   agentOptions,
+				Persistent: true,
+			},
 			&cli.IntFlag{
 				Name:       "listen-port",
 				Value:      0,
@@ -412,6 +473,21 @@ func main() {
 				Category:   wireguardOptions,
 				Persistent: true,
 			},
+			&cli.IntFlag{
+				Name:       "keepalive",
+				Value:      20,
+				Usage:      "Persistent keepalive interval of the wireguard tunnels in `seconds`, 0 turns it off",
+				Sources:    cli.EnvVars("NEXD_KEEPALIVE"),
+				Required:   false,
+				Category:   wireguardOptions,
+				Persistent: true,
+				Action: func(ctx context.Context, command *cli.Command, seconds int64) error {
+					if seconds < 0 || seconds > 65535 {
+						return fmt.Errorf("--keepalive must be between 0 and 65535 seconds")
+					}
+					return nil
+				},
+			},
 			&cli.StringFlag{
 				Name:       "request-ip",
 				Value:      "",
@@ -458,6 +534,33 @@ func main() {
 				Category:   agentOptions,
 				Persistent: true,
 			},
+			&cli.BoolFlag{
+				Name:       "tcp-relay",
+				Usage:      "Fall back to tunneling wireguard packets over a TLS connection to the nexodus service when UDP is blocked",
+				Value:      true,
+				Sources:    cli.EnvVars("NEXD_TCP_RELAY"),
+				Required:   false,
+				Category:   agentOptions,
+				Persistent: true,
+			},
+			&cli.BoolFlag{
+				Name:       "hole-punch",
+				Usage:      "Punch holes through NATs to peers that would otherwise be relayed, coordinated through the nexodus service",
+				Value:      true,
+				Sources:    cli.EnvVars("NEXD_HOLE_PUNCH"),
+				Required:   false,
+				Category:   agentOptions,
+				Persistent: true,
+			},
+			&cli.BoolFlag{
+				Name:       "port-mapping",
+				Usage:      "Map the wireguard port on the gateway of the local network with PCP, NAT-PMP or UPnP, and advertise the mapped endpoint to peers",
+				Value:      true,
+				Sources:    cli.EnvVars("NEXD_PORT_MAPPING"),
+				Required:   false,
+				Category:   agentOptions,
+				Persistent: true,
+			},
 			&cli.StringFlag{
 				Name:       "username",
 				Value:      "",
@@ -518,6 +621,14 @@ func main() {
 				Category:   nexServiceOptions,
 				Persistent: true,
 			},
+			&cli.StringSliceFlag{
+				Name:       "api-url",
+				Usage:      "URL of an apiserver of the Nexodus service, repeat to fail over between several. By default they are discovered from the _nexodus-api._tcp SRV record of the service domain",
+				Sources:    cli.EnvVars("NEXD_API_URL"),
+				Required:   false,
+				Category:   nexServiceOptions,
+				Persistent: true,
+			},
 			&cli.BoolFlag{
 				Name:       "exit-node-client",
 				Usage:      "Enable this node to use an available exit node",
@@ -542,22 +653,6 @@ func main() {
 				Persistent: true,
 			},
 		},
-		Before: func(ctx context.Context, command *cli.Command) error {
-			if command.Bool("network-router") {
-				if runtime.GOOS != nexodus.Linux.String() {
-					return fmt.Errorf("network-router mode is only supported for Linux operating systems")
-				}
-				if len(command.StringSlice("advertise-cidr")) == 0 {
-					return fmt.Errorf("--advertise-cidr is required for a device to be a network-router")
-				}
-			}
-			if command.Bool("exit-node-client") {
-				if runtime.GOOS != nexodus.Linux.String() {
-					return fmt.Errorf("exit-node support is currently only supported for Linux operating systems")
-				}
-			}
-			return nil
-		},
 		Action: func(ctx context.Context, command *cli.Command) error {
 			return nexdRun(ctx, command, logger, logLevel, nexdModeAgent)
 		},
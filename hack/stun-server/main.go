@@ -44,7 +44,13 @@ func main() {
 		address = os.Args[1]
 	}
 
-	server, err := stun.ListenAndStart(address, logger)
+	// with an alternate address, e.g. 192.0.2.1:3478 192.0.2.2:3479, clients can discover the behavior of their NAT
+	var server *stun.ClosableServer
+	if len(os.Args) > 2 {
+		server, err = stun.ListenAndStartWithAlternate(address, os.Args[2], logger)
+	} else {
+		server, err = stun.ListenAndStart(address, logger)
+	}
 	if err != nil {
 		panic(err)
 	}
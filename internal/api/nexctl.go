@@ -12,4 +12,6 @@ type KeepaliveStatus struct {
 	Hostname    string `json:"hostname"`
 	Latency     string `json:""`
 	Method      string `json:"method"`
+	RelayReason string `json:"relay_reason,omitempty"` // why the peer is relayed, when it is
+	PathReason  string `json:"path_reason,omitempty"`  // why the peering method was chosen
 }
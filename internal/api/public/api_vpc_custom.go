@@ -346,6 +346,23 @@ func NewInformer[T any](adaptor InformerAdaptor[T], gtRevision *int32, request A
 	return &informer
 }
 
+// Resume seeds the informer with the items it had up to the revision, for example the ones saved before a restart,
+// so that the watch only receives the changes made after it. It must be called before the first Execute.
+func (informer *Informer[T]) Resume(data map[string]T, revision int32) {
+	informer.mu.Lock()
+	defer informer.mu.Unlock()
+	informer.data = make(map[string]T, len(data))
+	maps.Copy(informer.data, data)
+	informer.watch.GtRevision = revision
+}
+
+// Revision returns the revision of the last change the informer received.
+func (informer *Informer[T]) Revision() int32 {
+	informer.mu.RLock()
+	defer informer.mu.RUnlock()
+	return informer.watch.GtRevision
+}
+
 func (informer *Informer[T]) Changed() <-chan struct{} {
 	return informer.changed
 }
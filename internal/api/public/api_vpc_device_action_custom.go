@@ -0,0 +1,39 @@
+package public
+
+import (
+	"github.com/nexodus-io/nexodus/internal/util"
+)
+
+// Informer creates a *Informer[ModelsDeviceAction] which provides a simpler
+// API to list device actions but which is implemented with the Watch api.  The *Informer[ModelsDeviceAction]
+// maintains a local device action cache which gets updated with the Watch events.
+func (r ApiListDeviceActionsInVPCRequest) Informer() *Informer[ModelsDeviceAction] {
+	informer := NewInformer[ModelsDeviceAction](&DeviceActionAdaptor{}, r.gtRevision, ApiWatchEventsRequest{
+		ctx:        r.ctx,
+		ApiService: r.ApiService.client.VPCApi,
+		id:         r.id,
+	})
+	return informer
+}
+
+type DeviceActionAdaptor struct{}
+
+func (d DeviceActionAdaptor) Revision(item ModelsDeviceAction) int32 {
+	return item.Revision
+}
+
+func (d DeviceActionAdaptor) Key(item ModelsDeviceAction) string {
+	return item.Id
+}
+
+func (d DeviceActionAdaptor) Kind() string {
+	return "device-action"
+}
+
+func (d DeviceActionAdaptor) Item(value map[string]interface{}) (ModelsDeviceAction, error) {
+	item := ModelsDeviceAction{}
+	err := util.JsonUnmarshal(value, &item)
+	return item, err
+}
+
+var _ InformerAdaptor[ModelsDeviceAction] = &DeviceActionAdaptor{}
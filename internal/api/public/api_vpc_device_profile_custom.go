@@ -0,0 +1,39 @@
+package public
+
+import (
+	"github.com/nexodus-io/nexodus/internal/util"
+)
+
+// Informer creates a *Informer[ModelsDeviceProfile] which provides a simpler
+// API to list device profiles but which is implemented with the Watch api.  The *Informer[ModelsDeviceProfile]
+// maintains a local device profile cache which gets updated with the Watch events.
+func (r ApiListDeviceProfilesInVPCRequest) Informer() *Informer[ModelsDeviceProfile] {
+	informer := NewInformer[ModelsDeviceProfile](&DeviceProfileAdaptor{}, r.gtRevision, ApiWatchEventsRequest{
+		ctx:        r.ctx,
+		ApiService: r.ApiService.client.VPCApi,
+		id:         r.id,
+	})
+	return informer
+}
+
+type DeviceProfileAdaptor struct{}
+
+func (d DeviceProfileAdaptor) Revision(item ModelsDeviceProfile) int32 {
+	return item.Revision
+}
+
+func (d DeviceProfileAdaptor) Key(item ModelsDeviceProfile) string {
+	return item.Id
+}
+
+func (d DeviceProfileAdaptor) Kind() string {
+	return "device-profile"
+}
+
+func (d DeviceProfileAdaptor) Item(value map[string]interface{}) (ModelsDeviceProfile, error) {
+	item := ModelsDeviceProfile{}
+	err := util.JsonUnmarshal(value, &item)
+	return item, err
+}
+
+var _ InformerAdaptor[ModelsDeviceProfile] = &DeviceProfileAdaptor{}
@@ -0,0 +1,39 @@
+package public
+
+import (
+	"github.com/nexodus-io/nexodus/internal/util"
+)
+
+// Informer creates a *Informer[ModelsHolePunch] which provides a simpler
+// API to list hole punches but which is implemented with the Watch api.  The *Informer[ModelsHolePunch]
+// maintains a local hole punch cache which gets updated with the Watch events.
+func (r ApiListHolePunchesInVPCRequest) Informer() *Informer[ModelsHolePunch] {
+	informer := NewInformer[ModelsHolePunch](&HolePunchAdaptor{}, r.gtRevision, ApiWatchEventsRequest{
+		ctx:        r.ctx,
+		ApiService: r.ApiService.client.VPCApi,
+		id:         r.id,
+	})
+	return informer
+}
+
+type HolePunchAdaptor struct{}
+
+func (d HolePunchAdaptor) Revision(item ModelsHolePunch) int32 {
+	return item.Revision
+}
+
+func (d HolePunchAdaptor) Key(item ModelsHolePunch) string {
+	return item.Id
+}
+
+func (d HolePunchAdaptor) Kind() string {
+	return "hole-punch"
+}
+
+func (d HolePunchAdaptor) Item(value map[string]interface{}) (ModelsHolePunch, error) {
+	item := ModelsHolePunch{}
+	err := util.JsonUnmarshal(value, &item)
+	return item, err
+}
+
+var _ InformerAdaptor[ModelsHolePunch] = &HolePunchAdaptor{}
@@ -52,6 +52,8 @@ type APIClient struct {
 
 	AuthApi *AuthApiService
 
+	DeviceProfileApi *DeviceProfileApiService
+
 	DevicesApi *DevicesApiService
 
 	FFlagApi *FFlagApiService
@@ -86,6 +88,7 @@ func NewAPIClient(cfg *Configuration) *APIClient {
 
 	// API Services
 	c.AuthApi = (*AuthApiService)(&c.common)
+	c.DeviceProfileApi = (*DeviceProfileApiService)(&c.common)
 	c.DevicesApi = (*DevicesApiService)(&c.common)
 	c.FFlagApi = (*FFlagApiService)(&c.common)
 	c.InvitationApi = (*InvitationApiService)(&c.common)
@@ -0,0 +1,17 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsAddDeviceAction struct for ModelsAddDeviceAction
+type ModelsAddDeviceAction struct {
+	Action   string `json:"action,omitempty"`
+	Argument string `json:"argument,omitempty"`
+}
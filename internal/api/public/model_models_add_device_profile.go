@@ -0,0 +1,18 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsAddDeviceProfile struct for ModelsAddDeviceProfile
+type ModelsAddDeviceProfile struct {
+	Description string                      `json:"description,omitempty"`
+	Settings    ModelsDeviceProfileSettings `json:"settings,omitempty"`
+	VpcId       string                      `json:"vpc_id,omitempty"`
+}
@@ -0,0 +1,17 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsAddHolePunch struct for ModelsAddHolePunch
+type ModelsAddHolePunch struct {
+	Candidates []string `json:"candidates,omitempty"`
+	PeerId     string   `json:"peer_id,omitempty"`
+}
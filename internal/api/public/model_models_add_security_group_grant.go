@@ -0,0 +1,20 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsAddSecurityGroupGrant struct for ModelsAddSecurityGroupGrant
+type ModelsAddSecurityGroupGrant struct {
+	Direction string             `json:"direction,omitempty"`
+	ExpiresAt string             `json:"expires_at,omitempty"`
+	Reason    string             `json:"reason,omitempty"`
+	Requester string             `json:"requester,omitempty"`
+	Rule      ModelsSecurityRule `json:"rule,omitempty"`
+}
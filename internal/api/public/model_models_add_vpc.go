@@ -12,9 +12,15 @@ package public
 
 // ModelsAddVPC struct for ModelsAddVPC
 type ModelsAddVPC struct {
-	Description    string `json:"description,omitempty"`
-	Ipv4Cidr       string `json:"ipv4_cidr,omitempty"`
-	Ipv6Cidr       string `json:"ipv6_cidr,omitempty"`
-	OrganizationId string `json:"organization_id,omitempty"`
-	PrivateCidr    bool   `json:"private_cidr,omitempty"`
+	Description            string `json:"description,omitempty"`
+	Ipv4Cidr               string `json:"ipv4_cidr,omitempty"`
+	Ipv6Cidr               string `json:"ipv6_cidr,omitempty"`
+	MaxKeyAgeSeconds       int32  `json:"max_key_age_seconds,omitempty"`
+	Mtu                    int32  `json:"mtu,omitempty"`
+	OnDemandPeering        bool   `json:"on_demand_peering,omitempty"`
+	OrganizationId         string `json:"organization_id,omitempty"`
+	PeerIdleTimeoutSeconds int32  `json:"peer_idle_timeout_seconds,omitempty"`
+	PresharedKeys          bool   `json:"preshared_keys,omitempty"`
+	PrivateCidr            bool   `json:"private_cidr,omitempty"`
+	Topology               string `json:"topology,omitempty"`
 }
@@ -0,0 +1,16 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsAnswerHolePunch struct for ModelsAnswerHolePunch
+type ModelsAnswerHolePunch struct {
+	Candidates []string `json:"candidates,omitempty"`
+}
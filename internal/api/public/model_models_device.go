@@ -15,20 +15,38 @@ type ModelsDevice struct {
 	AdvertiseCidrs []string `json:"advertise_cidrs,omitempty"`
 	AllowedIps     []string `json:"allowed_ips,omitempty"`
 	// the token nexd should use to reconcile device state.
-	BearerToken     string           `json:"bearer_token,omitempty"`
+	BearerToken string `json:"bearer_token,omitempty"`
+	// the device profile holding the nexd settings of the device.
+	DeviceProfileId string           `json:"device_profile_id,omitempty"`
 	Endpoints       []ModelsEndpoint `json:"endpoints,omitempty"`
 	Hostname        string           `json:"hostname,omitempty"`
 	Id              string           `json:"id,omitempty"`
 	Ipv4TunnelIps   []ModelsTunnelIP `json:"ipv4_tunnel_ips,omitempty"`
 	Ipv6TunnelIps   []ModelsTunnelIP `json:"ipv6_tunnel_ips,omitempty"`
-	Online          bool             `json:"online,omitempty"`
-	OnlineAt        string           `json:"online_at,omitempty"`
-	Os              string           `json:"os,omitempty"`
-	OwnerId         string           `json:"owner_id,omitempty"`
-	PublicKey       string           `json:"public_key,omitempty"`
-	Relay           bool             `json:"relay,omitempty"`
-	Revision        int32            `json:"revision,omitempty"`
-	SecurityGroupId string           `json:"security_group_id,omitempty"`
-	SymmetricNat    bool             `json:"symmetric_nat,omitempty"`
-	VpcId           string           `json:"vpc_id,omitempty"`
+	// how the NAT in front of the device behaves, when the device discovered it.
+	Nat      ModelsNatBehavior `json:"nat,omitempty"`
+	Online   bool              `json:"online,omitempty"`
+	OnlineAt string            `json:"online_at,omitempty"`
+	Os       string            `json:"os,omitempty"`
+	OwnerId  string            `json:"owner_id,omitempty"`
+	// in a VPC with the groups topology, devices of the same group peer with each other.
+	PeeringGroup string `json:"peering_group,omitempty"`
+	// the public key replaced by the last key rotation.
+	PreviousPublicKey string `json:"previous_public_key,omitempty"`
+	// when the previous public key stops being accepted by the apiserver.
+	PreviousPublicKeyExpiresAt string `json:"previous_public_key_expires_at,omitempty"`
+	PublicKey                  string `json:"public_key,omitempty"`
+	// when the current public key was registered, used to enforce the VPC max key age.
+	PublicKeyCreatedAt string `json:"public_key_created_at,omitempty"`
+	Relay              bool   `json:"relay,omitempty"`
+	// the latency in ms the device measured to each relay it reaches, by relay id.
+	RelayLatencies map[string]int32 `json:"relay_latencies,omitempty"`
+	// for relay devices, how many KB/s of traffic they relay, so that devices spread across the relays.
+	RelayLoad int32 `json:"relay_load,omitempty"`
+	Revision  int32 `json:"revision,omitempty"`
+	// an admin revoked the device, it is not issued a device token until it is re-enabled.
+	Revoked         bool   `json:"revoked,omitempty"`
+	SecurityGroupId string `json:"security_group_id,omitempty"`
+	SymmetricNat    bool   `json:"symmetric_nat,omitempty"`
+	VpcId           string `json:"vpc_id,omitempty"`
 }
@@ -0,0 +1,26 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsDeviceAction struct for ModelsDeviceAction
+type ModelsDeviceAction struct {
+	AcknowledgedAt string `json:"acknowledged_at,omitempty"`
+	Action         string `json:"action,omitempty"`
+	Argument       string `json:"argument,omitempty"`
+	CompletedAt    string `json:"completed_at,omitempty"`
+	DeviceId       string `json:"device_id,omitempty"`
+	Id             string `json:"id,omitempty"`
+	// Result is the output of the action, or why it failed. It is left out of the vpc events.
+	Result   string `json:"result,omitempty"`
+	Revision int32  `json:"revision,omitempty"`
+	Status   string `json:"status,omitempty"`
+	VpcId    string `json:"vpc_id,omitempty"`
+}
@@ -0,0 +1,23 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsDevicePairConnectivity struct for ModelsDevicePairConnectivity
+type ModelsDevicePairConnectivity struct {
+	DeviceId string `json:"device_id,omitempty"`
+	// DeviceReport is what the device reported about the peer, nil when it did not report recently.
+	DeviceReport *ModelsPeerTelemetry `json:"device_report,omitempty"`
+	PeerId       string               `json:"peer_id,omitempty"`
+	// PeerReport is what the peer reported about the device, nil when it did not report recently.
+	PeerReport *ModelsPeerTelemetry `json:"peer_report,omitempty"`
+	// Status is one of direct, relayed, failing, idle or unknown.
+	Status string `json:"status,omitempty"`
+}
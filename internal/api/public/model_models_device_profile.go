@@ -0,0 +1,20 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsDeviceProfile struct for ModelsDeviceProfile
+type ModelsDeviceProfile struct {
+	Description string                      `json:"description,omitempty"`
+	Id          string                      `json:"id,omitempty"`
+	Revision    int32                       `json:"revision,omitempty"`
+	Settings    ModelsDeviceProfileSettings `json:"settings,omitempty"`
+	VpcId       string                      `json:"vpc_id,omitempty"`
+}
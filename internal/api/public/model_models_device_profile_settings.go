@@ -0,0 +1,29 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsDeviceProfileSettings struct for ModelsDeviceProfileSettings
+type ModelsDeviceProfileSettings struct {
+	// AdvertiseCidrs are the CIDRs the devices advertise to their peers.
+	AdvertiseCidrs []string `json:"advertise_cidrs,omitempty"`
+	// Egress are the egress proxy rules of devices running in proxy mode.
+	Egress []string `json:"egress,omitempty"`
+	// ExitNodeClient sends the internet traffic of the devices through an exit node of the VPC.
+	ExitNodeClient *bool `json:"exit_node_client,omitempty"`
+	// Ingress are the ingress proxy rules of devices running in proxy mode.
+	Ingress []string `json:"ingress,omitempty"`
+	// Keepalive is the persistent keepalive interval of the tunnels in seconds, 0 turns it off.
+	Keepalive *int32 `json:"keepalive,omitempty"`
+	// LogLevel is the level nexd logs at.
+	LogLevel string `json:"log_level,omitempty"`
+	// Relay makes the devices relay traffic for the devices of the VPC behind symmetric NATs.
+	Relay *bool `json:"relay,omitempty"`
+}
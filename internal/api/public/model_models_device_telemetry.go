@@ -0,0 +1,19 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsDeviceTelemetry struct for ModelsDeviceTelemetry
+type ModelsDeviceTelemetry struct {
+	DeviceId   string                `json:"device_id,omitempty"`
+	Peers      []ModelsPeerTelemetry `json:"peers,omitempty"`
+	ReportedAt string                `json:"reported_at,omitempty"`
+	VpcId      string                `json:"vpc_id,omitempty"`
+}
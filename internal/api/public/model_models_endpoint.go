@@ -12,8 +12,8 @@ package public
 
 // ModelsEndpoint struct for ModelsEndpoint
 type ModelsEndpoint struct {
-	// IP address and port of the endpoint.
+	// IP address and port of the endpoint, IPv6 addresses are in brackets.
 	Address string `json:"address,omitempty"`
-	// How the endpoint was discovered
+	// How the endpoint was discovered: local or stun:<server> for IPv4, local-ipv6 or stun-ipv6:<server> for IPv6, port-mapping:<protocol> for the port mapped on the gateway
 	Source string `json:"source,omitempty"`
 }
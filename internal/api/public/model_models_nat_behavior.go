@@ -0,0 +1,21 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsNatBehavior struct for ModelsNatBehavior
+type ModelsNatBehavior struct {
+	// Filtering is which traffic the NAT lets in to a reflexive address, one of endpoint-independent, address-dependent or address-and-port-dependent. Empty when the device could not discover it.
+	Filtering string `json:"filtering,omitempty"`
+	// Hairpinning is whether the NAT forwards traffic sent to one of its reflexive addresses from behind it.
+	Hairpinning bool `json:"hairpinning,omitempty"`
+	// Mapping is whether the NAT maps the device to the same reflexive address for every destination, one of endpoint-independent, address-dependent or address-and-port-dependent.
+	Mapping string `json:"mapping,omitempty"`
+}
@@ -0,0 +1,20 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsPeerPresharedKey struct for ModelsPeerPresharedKey
+type ModelsPeerPresharedKey struct {
+	ExpiresAt string `json:"expires_at,omitempty"`
+	PeerId    string `json:"peer_id,omitempty"`
+	// the preshared key sealed to the public key of the requesting device.
+	SealedKey string `json:"sealed_key,omitempty"`
+	StartsAt  string `json:"starts_at,omitempty"`
+}
@@ -0,0 +1,22 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsPeerTelemetry struct for ModelsPeerTelemetry
+type ModelsPeerTelemetry struct {
+	LatestHandshake string `json:"latest_handshake,omitempty"`
+	PeerId          string `json:"peer_id,omitempty"`
+	PeeringMethod   string `json:"peering_method,omitempty"`
+	RxBytes         int64  `json:"rx_bytes,omitempty"`
+	// Status is one of direct, relayed, failing or idle.
+	Status  string `json:"status,omitempty"`
+	TxBytes int64  `json:"tx_bytes,omitempty"`
+}
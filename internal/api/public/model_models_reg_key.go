@@ -18,6 +18,8 @@ type ModelsRegKey struct {
 	Description string `json:"description,omitempty"`
 	// DeviceId is set if the RegKey was created for single use
 	DeviceId string `json:"device_id,omitempty"`
+	// DeviceProfileId is the ID of the device profile to assign to the device.
+	DeviceProfileId string `json:"device_profile_id,omitempty"`
 	// ExpiresAt is optional, if set the registration key is only valid until the ExpiresAt time.
 	ExpiresAt string `json:"expires_at,omitempty"`
 	Id        string `json:"id,omitempty"`
@@ -12,10 +12,12 @@ package public
 
 // ModelsSecurityGroup struct for ModelsSecurityGroup
 type ModelsSecurityGroup struct {
-	Description   string               `json:"description,omitempty"`
-	Id            string               `json:"id,omitempty"`
-	InboundRules  []ModelsSecurityRule `json:"inbound_rules,omitempty"`
-	OutboundRules []ModelsSecurityRule `json:"outbound_rules,omitempty"`
-	Revision      int32                `json:"revision,omitempty"`
-	VpcId         string               `json:"vpc_id,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Grants holds the active time-bound grants for the group, their rules apply in addition to the inbound and outbound rules.
+	Grants        []ModelsSecurityGroupGrant `json:"grants,omitempty"`
+	Id            string                     `json:"id,omitempty"`
+	InboundRules  []ModelsSecurityRule       `json:"inbound_rules,omitempty"`
+	OutboundRules []ModelsSecurityRule       `json:"outbound_rules,omitempty"`
+	Revision      int32                      `json:"revision,omitempty"`
+	VpcId         string                     `json:"vpc_id,omitempty"`
 }
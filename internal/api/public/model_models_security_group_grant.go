@@ -0,0 +1,31 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsSecurityGroupGrant struct for ModelsSecurityGroupGrant
+type ModelsSecurityGroupGrant struct {
+	// ApproverID is the ID of the user that created the grant.
+	ApproverId string `json:"approver_id,omitempty"`
+	// Direction is either inbound or outbound.
+	Direction string `json:"direction,omitempty"`
+	// ExpiredAt is set once the grant has been removed from the security group.
+	ExpiredAt string `json:"expired_at,omitempty"`
+	// ExpiresAt is when the grant stops being applied.
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Id        string `json:"id,omitempty"`
+	// Reason is a free form justification for the grant.
+	Reason string `json:"reason,omitempty"`
+	// Requester identifies who asked for the access.
+	Requester       string             `json:"requester,omitempty"`
+	Rule            ModelsSecurityRule `json:"rule,omitempty"`
+	SecurityGroupId string             `json:"security_group_id,omitempty"`
+	VpcId           string             `json:"vpc_id,omitempty"`
+}
@@ -12,8 +12,15 @@ package public
 
 // ModelsSecurityRule struct for ModelsSecurityRule
 type ModelsSecurityRule struct {
-	FromPort   int32    `json:"from_port,omitempty"`
+	FromPort int32 `json:"from_port,omitempty"`
+	// IcmpCodes limits an icmpv4 or icmpv6 rule to the listed ICMP codes of its icmp_types
+	IcmpCodes []int32 `json:"icmp_codes,omitempty"`
+	// IcmpTypes limits an icmpv4 or icmpv6 rule to the listed ICMP types
+	IcmpTypes []int32 `json:"icmp_types,omitempty"`
+	// IpProtocol is a protocol name or an IP protocol number between 0 and 255
 	IpProtocol string   `json:"ip_protocol,omitempty"`
 	IpRanges   []string `json:"ip_ranges,omitempty"`
-	ToPort     int32    `json:"to_port,omitempty"`
+	// Ports is a list of destination ports, it can be used instead of the from_port/to_port range
+	Ports  []int32 `json:"ports,omitempty"`
+	ToPort int32   `json:"to_port,omitempty"`
 }
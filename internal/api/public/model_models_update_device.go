@@ -12,11 +12,28 @@ package public
 
 // ModelsUpdateDevice struct for ModelsUpdateDevice
 type ModelsUpdateDevice struct {
-	AdvertiseCidrs  []string         `json:"advertise_cidrs,omitempty"`
+	AdvertiseCidrs []string `json:"advertise_cidrs,omitempty"`
+	// assigns a device profile to the device, the nil uuid removes it.
+	DeviceProfileId string           `json:"device_profile_id,omitempty"`
 	Endpoints       []ModelsEndpoint `json:"endpoints,omitempty"`
 	Hostname        string           `json:"hostname,omitempty"`
-	Revision        int32            `json:"revision,omitempty"`
-	SecurityGroupId string           `json:"security_group_id,omitempty"`
-	SymmetricNat    bool             `json:"symmetric_nat,omitempty"`
-	VpcId           string           `json:"vpc_id,omitempty"`
+	// how long the previous public key is still accepted after a rotation.
+	KeyOverlapSeconds int32 `json:"key_overlap_seconds,omitempty"`
+	// ignored without a mapping, the device did not discover the behavior of its NAT.
+	Nat          ModelsNatBehavior `json:"nat,omitempty"`
+	PeeringGroup string            `json:"peering_group,omitempty"`
+	// rotates the device to a new public key.
+	PublicKey string `json:"public_key,omitempty"`
+	// makes the device a relay, or stops it being one unless its device profile makes it one. Only users can change it.
+	Relay *bool `json:"relay,omitempty"`
+	// reported by devices, the latency in ms to each relay they reach, by relay id.
+	RelayLatencies map[string]int32 `json:"relay_latencies,omitempty"`
+	// reported by relay devices, how many KB/s of traffic they relay.
+	RelayLoad int32 `json:"relay_load,omitempty"`
+	Revision  int32 `json:"revision,omitempty"`
+	// revokes the device or re-enables it, only users can change it.
+	Revoked         *bool  `json:"revoked,omitempty"`
+	SecurityGroupId string `json:"security_group_id,omitempty"`
+	SymmetricNat    bool   `json:"symmetric_nat,omitempty"`
+	VpcId           string `json:"vpc_id,omitempty"`
 }
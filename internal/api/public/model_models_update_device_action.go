@@ -0,0 +1,17 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsUpdateDeviceAction struct for ModelsUpdateDeviceAction
+type ModelsUpdateDeviceAction struct {
+	Result string `json:"result,omitempty"`
+	Status string `json:"status,omitempty"`
+}
@@ -0,0 +1,18 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsUpdateDeviceProfile struct for ModelsUpdateDeviceProfile
+type ModelsUpdateDeviceProfile struct {
+	Description string `json:"description,omitempty"`
+	// Settings replace the settings of the profile.
+	Settings *ModelsDeviceProfileSettings `json:"settings,omitempty"`
+}
@@ -14,6 +14,8 @@ package public
 type ModelsUpdateRegKey struct {
 	// Description of the registration key.
 	Description string `json:"description,omitempty"`
+	// DeviceProfileId is the ID of the device profile to assign to the device.
+	DeviceProfileId string `json:"device_profile_id,omitempty"`
 	// ExpiresAt is optional, if set the registration key is only valid until the ExpiresAt time.
 	ExpiresAt string `json:"expires_at,omitempty"`
 	// SecurityGroupId is the ID of the security group to assign to the device.
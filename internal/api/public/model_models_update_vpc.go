@@ -12,5 +12,11 @@ package public
 
 // ModelsUpdateVPC struct for ModelsUpdateVPC
 type ModelsUpdateVPC struct {
-	Description string `json:"description,omitempty"`
+	Description            string `json:"description,omitempty"`
+	MaxKeyAgeSeconds       int32  `json:"max_key_age_seconds,omitempty"`
+	Mtu                    int32  `json:"mtu,omitempty"`
+	OnDemandPeering        bool   `json:"on_demand_peering,omitempty"`
+	PeerIdleTimeoutSeconds int32  `json:"peer_idle_timeout_seconds,omitempty"`
+	PresharedKeys          bool   `json:"preshared_keys,omitempty"`
+	Topology               string `json:"topology,omitempty"`
 }
@@ -12,10 +12,22 @@ package public
 
 // ModelsVPC struct for ModelsVPC
 type ModelsVPC struct {
-	Description    string `json:"description,omitempty"`
-	Id             string `json:"id,omitempty"`
-	Ipv4Cidr       string `json:"ipv4_cidr,omitempty"`
-	Ipv6Cidr       string `json:"ipv6_cidr,omitempty"`
-	OrganizationId string `json:"organization_id,omitempty"`
-	PrivateCidr    bool   `json:"private_cidr,omitempty"`
+	Description string `json:"description,omitempty"`
+	Id          string `json:"id,omitempty"`
+	Ipv4Cidr    string `json:"ipv4_cidr,omitempty"`
+	Ipv6Cidr    string `json:"ipv6_cidr,omitempty"`
+	// the maximum age of a device's WireGuard key before it must be rotated, 0 disables the limit.
+	MaxKeyAgeSeconds int32 `json:"max_key_age_seconds,omitempty"`
+	// the MTU of the tunnel interface of the devices, 0 lets nexd use its default and the path MTU it discovers.
+	Mtu int32 `json:"mtu,omitempty"`
+	// when enabled devices only peer with each other when their security groups call for it or once they exchange traffic.
+	OnDemandPeering bool   `json:"on_demand_peering,omitempty"`
+	OrganizationId  string `json:"organization_id,omitempty"`
+	// how long an on-demand peer is kept without traffic, 0 uses the default of 10 minutes.
+	PeerIdleTimeoutSeconds int32 `json:"peer_idle_timeout_seconds,omitempty"`
+	// when enabled every pair of devices also uses a WireGuard preshared key.
+	PresharedKeys bool `json:"preshared_keys,omitempty"`
+	PrivateCidr   bool `json:"private_cidr,omitempty"`
+	// which devices peer with each other: full-mesh, hub-and-spoke or groups.
+	Topology string `json:"topology,omitempty"`
 }
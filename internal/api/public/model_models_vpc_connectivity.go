@@ -0,0 +1,17 @@
+/*
+Nexodus API
+
+This is the Nexodus API Server.
+
+API version: 1.0
+*/
+
+// Code generated by OpenAPI Generator (https://openapi-generator.tech); DO NOT EDIT.
+
+package public
+
+// ModelsVPCConnectivity struct for ModelsVPCConnectivity
+type ModelsVPCConnectivity struct {
+	Pairs []ModelsDevicePairConnectivity `json:"pairs,omitempty"`
+	VpcId string                         `json:"vpc_id,omitempty"`
+}
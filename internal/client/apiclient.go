@@ -46,6 +46,12 @@ func NewAPIClient(ctx context.Context, addr string, authcb func(string), options
 			TLSClientConfig:       opts.tlsConfig,
 		},
 	}
+	if len(opts.failoverURLs) > 0 {
+		clientConfig.HTTPClient.Transport = &failoverTransport{
+			next: clientConfig.HTTPClient.Transport,
+			urls: append([]*url.URL{baseURL}, opts.failoverURLs...),
+		}
+	}
 	clientConfig.Host = baseURL.Host
 	clientConfig.Scheme = baseURL.Scheme
 	if opts.userAgent != "" {
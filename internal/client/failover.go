@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the SRV record of a service domain that lists its apiservers: _nexodus-api._tcp.<domain>
+const (
+	apiSRVService = "nexodus-api"
+	apiSRVProto   = "tcp"
+)
+
+// lookupSRV is replaced by tests
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+// ApiURLs returns the URLs of the apiservers of the Nexodus service at serviceURL. When the service domain has a
+// _nexodus-api._tcp SRV record, its targets are used in the order of their priority and weight, followed by
+// api.<domain> which is the apiserver of services without the record.
+func ApiURLs(ctx context.Context, serviceURL *url.URL) []*url.URL {
+	apiURL := &url.URL{Scheme: serviceURL.Scheme, Host: "api." + serviceURL.Host}
+	_, records, err := lookupSRV(ctx, apiSRVService, apiSRVProto, serviceURL.Hostname())
+	if err != nil {
+		return []*url.URL{apiURL}
+	}
+	var result []*url.URL
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		if record.Port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(int(record.Port)))
+		}
+		if host != apiURL.Host {
+			result = append(result, &url.URL{Scheme: serviceURL.Scheme, Host: host})
+		}
+	}
+	return append(result, apiURL)
+}
+
+// failoverTransport sends the requests for the apiserver to the first of its URLs that answers, and keeps using it
+// until it fails. Requests for other hosts, such as the ones for the OAuth issuer, are sent as they are.
+type failoverTransport struct {
+	next http.RoundTripper
+	urls []*url.URL
+
+	mu      sync.Mutex
+	current int
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.urls[0].Host {
+		return t.next.RoundTrip(req)
+	}
+	t.mu.Lock()
+	start := t.current
+	t.mu.Unlock()
+
+	var lastErr error
+	for i := range t.urls {
+		index := (start + i) % len(t.urls)
+		attempt := req.Clone(req.Context())
+		attempt.URL.Scheme = t.urls[index].Scheme
+		attempt.URL.Host = t.urls[index].Host
+		attempt.Host = ""
+		if i > 0 && req.Body != nil && req.Body != http.NoBody {
+			// the body of the previous attempt was consumed
+			if req.GetBody == nil {
+				return nil, lastErr
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(attempt)
+		last := i == len(t.urls)-1
+		switch {
+		case err != nil:
+			if last || req.Context().Err() != nil || !retryable(req, err) {
+				return nil, err
+			}
+			lastErr = fmt.Errorf("%s: %w", t.urls[index].Host, err)
+		case unavailable(resp.StatusCode) && idempotent(req) && !last:
+			_ = resp.Body.Close()
+			lastErr = fmt.Errorf("%s: %s", t.urls[index].Host, resp.Status)
+		default:
+			if index != start {
+				t.mu.Lock()
+				t.current = index
+				t.mu.Unlock()
+			}
+			return resp, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// retryable determines if a request that failed with err can be sent to another apiserver. Requests that did not
+// reach the apiserver can, others only when sending them twice does no harm.
+func retryable(req *http.Request, err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return idempotent(req)
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// unavailable determines if the status is the one of a proxy in front of an apiserver that is down
+func unavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverTransport(t *testing.T) {
+	require := require.New(t)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	var bodies []string
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer up.Close()
+
+	parse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		require.NoError(err)
+		return u
+	}
+	transport := &failoverTransport{
+		next: http.DefaultTransport,
+		urls: []*url.URL{parse(down.URL), parse(unavailable.URL), parse(up.URL)},
+	}
+	httpClient := &http.Client{Transport: transport}
+
+	// requests to the apiserver fail over to the one that is up, and stay with it
+	resp, err := httpClient.Get(down.URL + "/api/devices")
+	require.NoError(err)
+	require.Equal(http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+	require.Equal(2, transport.current)
+
+	resp, err = httpClient.Post(down.URL+"/api/devices", "application/json", strings.NewReader("{}"))
+	require.NoError(err)
+	require.Equal(http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+	require.Equal([]string{"", "{}"}, bodies)
+
+	// requests that may have been processed are not sent twice
+	transport.current = 1
+	resp, err = httpClient.Post(down.URL+"/api/devices", "application/json", strings.NewReader("{}"))
+	require.NoError(err)
+	require.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	_ = resp.Body.Close()
+
+	// requests to other hosts are sent as they are
+	_, err = httpClient.Get(down.URL[:strings.LastIndex(down.URL, ":")] + ":1/.well-known/openid-configuration")
+	require.Error(err)
+	require.Len(bodies, 2)
+}
+
+func TestApiURLs(t *testing.T) {
+	require := require.New(t)
+	defer func(lookup func(context.Context, string, string, string) (string, []*net.SRV, error)) {
+		lookupSRV = lookup
+	}(lookupSRV)
+	serviceURL := &url.URL{Scheme: "https", Host: "try.nexodus.io"}
+
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		require.Equal("_nexodus-api._tcp.try.nexodus.io", "_"+service+"._"+proto+"."+name)
+		return "", []*net.SRV{
+			{Target: "api-east.nexodus.io.", Port: 443},
+			{Target: "api-west.nexodus.io.", Port: 8443},
+		}, nil
+	}
+	urls := ApiURLs(context.Background(), serviceURL)
+	require.Len(urls, 3)
+	require.Equal("https://api-east.nexodus.io", urls[0].String())
+	require.Equal("https://api-west.nexodus.io:8443", urls[1].String())
+	require.Equal("https://api.try.nexodus.io", urls[2].String())
+
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	urls = ApiURLs(context.Background(), serviceURL)
+	require.Len(urls, 1)
+	require.Equal("https://api.try.nexodus.io", urls[0].String())
+}
@@ -2,6 +2,8 @@ package client
 
 import (
 	"crypto/tls"
+	"net/url"
+
 	"golang.org/x/oauth2"
 )
 
@@ -14,6 +16,7 @@ type options struct {
 	tlsConfig    *tls.Config
 	bearerToken  string
 	userAgent    string
+	failoverURLs []*url.URL
 }
 
 type TokenStore interface {
@@ -86,3 +89,20 @@ func WithTokenStore(
 		return nil
 	}
 }
+
+// WithFailoverURLs sets the URLs of other apiservers of the service, requests are sent to them when the apiserver at
+// the address of the client is unreachable.
+func WithFailoverURLs(
+	urls ...string,
+) Option {
+	return func(o *options) error {
+		for _, u := range urls {
+			failoverURL, err := url.Parse(u)
+			if err != nil {
+				return err
+			}
+			o.failoverURLs = append(o.failoverURLs, failoverURL)
+		}
+		return nil
+	}
+}
@@ -13,6 +13,23 @@ import (
 	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231120_0000"
 	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231130_0000"
 	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231206_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231212_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231213_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231214_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231215_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231216_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231217_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231218_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231219_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231220_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231221_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231222_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231223_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231224_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231225_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231226_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231227_0000"
+	_ "github.com/nexodus-io/nexodus/internal/database/migration_20231228_0000"
 	"sort"
 
 	"github.com/cenkalti/backoff/v4"
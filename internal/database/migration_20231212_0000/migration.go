@@ -0,0 +1,36 @@
+package migration_20231212_0000
+
+import (
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/database/migration_20231031_0000"
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+	"time"
+)
+
+type SecurityRule struct {
+	IpProtocol string
+	FromPort   int64
+	ToPort     int64
+	IpRanges   []string
+}
+
+type SecurityGroupGrant struct {
+	migration_20231031_0000.Base
+	SecurityGroupId uuid.UUID `gorm:"type:uuid;index"`
+	VpcId           uuid.UUID
+	OrganizationID  uuid.UUID    `gorm:"index"`
+	Direction       string       `gorm:"index"`
+	Rule            SecurityRule `gorm:"type:JSONB; serializer:json"`
+	Requester       string
+	ApproverID      uuid.UUID
+	Reason          string
+	ExpiresAt       time.Time `gorm:"index"`
+	ExpiredAt       *time.Time
+}
+
+func init() {
+	migrationId := "20231212-0000"
+	CreateMigrationFromActions(migrationId,
+		CreateTableAction(&SecurityGroupGrant{}),
+	)
+}
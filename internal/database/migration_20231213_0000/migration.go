@@ -0,0 +1,27 @@
+package migration_20231213_0000
+
+import (
+	"time"
+
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type Device struct {
+	PublicKeyCreatedAt         *time.Time
+	PreviousPublicKey          string
+	PreviousPublicKeyExpiresAt *time.Time
+}
+
+type VPC struct {
+	MaxKeyAgeSeconds int64
+}
+
+func init() {
+	migrationId := "20231213-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&Device{}),
+		// existing keys are considered to be as old as the device that registered them
+		ExecAction(`UPDATE devices SET public_key_created_at = created_at`, ""),
+		AddTableColumnsAction(&VPC{}),
+	)
+}
@@ -0,0 +1,29 @@
+package migration_20231214_0000
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type DevicePeerKey struct {
+	DeviceID  uuid.UUID `gorm:"type:uuid;primary_key"`
+	PeerID    uuid.UUID `gorm:"type:uuid;primary_key"`
+	Epoch     int64     `gorm:"primary_key"`
+	VpcID     uuid.UUID `gorm:"type:uuid;index"`
+	Key       string
+	CreatedAt time.Time
+}
+
+type VPC struct {
+	PresharedKeys bool `gorm:"default:false"`
+}
+
+func init() {
+	migrationId := "20231214-0000"
+	CreateMigrationFromActions(migrationId,
+		CreateTableAction(&DevicePeerKey{}),
+		AddTableColumnsAction(&VPC{}),
+	)
+}
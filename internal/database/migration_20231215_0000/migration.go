@@ -0,0 +1,21 @@
+package migration_20231215_0000
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type RevokedDeviceToken struct {
+	BearerToken string    `gorm:"primary_key"`
+	DeviceID    uuid.UUID `gorm:"type:uuid;index"`
+	RevokedAt   time.Time
+}
+
+func init() {
+	migrationId := "20231215-0000"
+	CreateMigrationFromActions(migrationId,
+		CreateTableAction(&RevokedDeviceToken{}),
+	)
+}
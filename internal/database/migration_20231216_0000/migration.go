@@ -0,0 +1,22 @@
+package migration_20231216_0000
+
+import (
+	"time"
+
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type SigningKey struct {
+	ID          string `gorm:"primary_key"`
+	PrivateKey  string
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	ExpiresAt   *time.Time
+}
+
+func init() {
+	migrationId := "20231216-0000"
+	CreateMigrationFromActions(migrationId,
+		CreateTableAction(&SigningKey{}),
+	)
+}
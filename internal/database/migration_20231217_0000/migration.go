@@ -0,0 +1,17 @@
+package migration_20231217_0000
+
+import (
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type VPC struct {
+	OnDemandPeering        bool `gorm:"default:false"`
+	PeerIdleTimeoutSeconds int64
+}
+
+func init() {
+	migrationId := "20231217-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&VPC{}),
+	)
+}
@@ -0,0 +1,22 @@
+package migration_20231218_0000
+
+import (
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type VPC struct {
+	Topology string
+}
+
+type Device struct {
+	PeeringGroup string
+}
+
+func init() {
+	migrationId := "20231218-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&VPC{}),
+		ExecAction(`UPDATE vpcs SET topology = 'full-mesh'`, ""),
+		AddTableColumnsAction(&Device{}),
+	)
+}
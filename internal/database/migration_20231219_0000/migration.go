@@ -0,0 +1,42 @@
+package migration_20231219_0000
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/database/migration_20231031_0000"
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type HolePunch struct {
+	migration_20231031_0000.Base
+	VpcID          uuid.UUID `gorm:"type:uuid;index"`
+	DeviceID       uuid.UUID `gorm:"type:uuid"`
+	PeerID         uuid.UUID `gorm:"type:uuid"`
+	Candidates     []string  `gorm:"type:JSONB; serializer:json"`
+	PeerCandidates []string  `gorm:"type:JSONB; serializer:json"`
+	PunchAt        *time.Time
+	Revision       uint64 `gorm:"type:bigserial;index:"`
+}
+
+func init() {
+	migrationId := "20231219-0000"
+	CreateMigrationFromActions(migrationId,
+		CreateTableAction(&HolePunch{}),
+		ExecActionIf(`
+			CREATE OR REPLACE FUNCTION hole_punches_revision_trigger() RETURNS TRIGGER LANGUAGE plpgsql AS '
+			BEGIN
+			NEW.revision := nextval(''hole_punches_revision_seq'');
+			RETURN NEW;
+			END;'
+		`, `
+			DROP FUNCTION IF EXISTS hole_punches_revision_trigger
+		`, NotOnSqlLite),
+		ExecActionIf(`
+			CREATE OR REPLACE TRIGGER hole_punches_revision_trigger BEFORE INSERT OR UPDATE ON hole_punches
+			FOR EACH ROW EXECUTE PROCEDURE hole_punches_revision_trigger();
+		`, `
+			DROP TRIGGER IF EXISTS hole_punches_revision_trigger ON hole_punches
+		`, NotOnSqlLite),
+	)
+}
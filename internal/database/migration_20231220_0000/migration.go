@@ -0,0 +1,22 @@
+package migration_20231220_0000
+
+import (
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type NatBehavior struct {
+	Mapping     string
+	Filtering   string
+	Hairpinning bool
+}
+
+type Device struct {
+	Nat *NatBehavior `gorm:"type:JSONB; serializer:json"`
+}
+
+func init() {
+	migrationId := "20231220-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&Device{}),
+	)
+}
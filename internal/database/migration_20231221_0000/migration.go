@@ -0,0 +1,16 @@
+package migration_20231221_0000
+
+import (
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type Device struct {
+	RelayLoad int
+}
+
+func init() {
+	migrationId := "20231221-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&Device{}),
+	)
+}
@@ -0,0 +1,16 @@
+package migration_20231222_0000
+
+import (
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type VPC struct {
+	Mtu int
+}
+
+func init() {
+	migrationId := "20231222-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&VPC{}),
+	)
+}
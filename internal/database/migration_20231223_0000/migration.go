@@ -0,0 +1,48 @@
+package migration_20231223_0000
+
+import (
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/database/migration_20231031_0000"
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type DeviceProfile struct {
+	migration_20231031_0000.Base
+	VpcID          uuid.UUID `gorm:"type:uuid;index"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;index"`
+	Description    string
+	Settings       map[string]interface{} `gorm:"type:JSONB; serializer:json"`
+	Revision       uint64                 `gorm:"type:bigserial;index:"`
+}
+
+type Device struct {
+	DeviceProfileID *uuid.UUID `gorm:"type:uuid"`
+}
+
+type RegKey struct {
+	DeviceProfileID *uuid.UUID `gorm:"type:uuid"`
+}
+
+func init() {
+	migrationId := "20231223-0000"
+	CreateMigrationFromActions(migrationId,
+		CreateTableAction(&DeviceProfile{}),
+		ExecActionIf(`
+			CREATE OR REPLACE FUNCTION device_profiles_revision_trigger() RETURNS TRIGGER LANGUAGE plpgsql AS '
+			BEGIN
+			NEW.revision := nextval(''device_profiles_revision_seq'');
+			RETURN NEW;
+			END;'
+		`, `
+			DROP FUNCTION IF EXISTS device_profiles_revision_trigger
+		`, NotOnSqlLite),
+		ExecActionIf(`
+			CREATE OR REPLACE TRIGGER device_profiles_revision_trigger BEFORE INSERT OR UPDATE ON device_profiles
+			FOR EACH ROW EXECUTE PROCEDURE device_profiles_revision_trigger();
+		`, `
+			DROP TRIGGER IF EXISTS device_profiles_revision_trigger ON device_profiles
+		`, NotOnSqlLite),
+		AddTableColumnsAction(&Device{}),
+		AddTableColumnsAction(&RegKey{}),
+	)
+}
@@ -0,0 +1,44 @@
+package migration_20231224_0000
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/database/migration_20231031_0000"
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type DeviceAction struct {
+	migration_20231031_0000.Base
+	VpcID          uuid.UUID `gorm:"type:uuid;index"`
+	DeviceID       uuid.UUID `gorm:"type:uuid;index"`
+	Action         string
+	Argument       string
+	Status         string
+	Result         string
+	AcknowledgedAt *time.Time
+	CompletedAt    *time.Time
+	Revision       uint64 `gorm:"type:bigserial;index:"`
+}
+
+func init() {
+	migrationId := "20231224-0000"
+	CreateMigrationFromActions(migrationId,
+		CreateTableAction(&DeviceAction{}),
+		ExecActionIf(`
+			CREATE OR REPLACE FUNCTION device_actions_revision_trigger() RETURNS TRIGGER LANGUAGE plpgsql AS '
+			BEGIN
+			NEW.revision := nextval(''device_actions_revision_seq'');
+			RETURN NEW;
+			END;'
+		`, `
+			DROP FUNCTION IF EXISTS device_actions_revision_trigger
+		`, NotOnSqlLite),
+		ExecActionIf(`
+			CREATE OR REPLACE TRIGGER device_actions_revision_trigger BEFORE INSERT OR UPDATE ON device_actions
+			FOR EACH ROW EXECUTE PROCEDURE device_actions_revision_trigger();
+		`, `
+			DROP TRIGGER IF EXISTS device_actions_revision_trigger ON device_actions
+		`, NotOnSqlLite),
+	)
+}
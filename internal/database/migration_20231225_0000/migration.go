@@ -0,0 +1,31 @@
+package migration_20231225_0000
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type PeerTelemetry struct {
+	PeerID          uuid.UUID
+	PeeringMethod   string
+	Status          string
+	LatestHandshake *time.Time
+	RxBytes         int64
+	TxBytes         int64
+}
+
+type DeviceTelemetry struct {
+	DeviceID   uuid.UUID       `gorm:"type:uuid;primary_key"`
+	VpcID      uuid.UUID       `gorm:"type:uuid;index"`
+	Peers      []PeerTelemetry `gorm:"type:JSONB; serializer:json"`
+	ReportedAt time.Time
+}
+
+func init() {
+	migrationId := "20231225-0000"
+	CreateMigrationFromActions(migrationId,
+		CreateTableAction(&DeviceTelemetry{}),
+	)
+}
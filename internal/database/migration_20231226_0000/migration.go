@@ -0,0 +1,16 @@
+package migration_20231226_0000
+
+import (
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type Device struct {
+	Revoked bool
+}
+
+func init() {
+	migrationId := "20231226-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&Device{}),
+	)
+}
@@ -0,0 +1,16 @@
+package migration_20231227_0000
+
+import (
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type Device struct {
+	RelayLatencies map[string]int `gorm:"type:JSONB; serializer:json"`
+}
+
+func init() {
+	migrationId := "20231227-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&Device{}),
+	)
+}
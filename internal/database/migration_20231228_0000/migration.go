@@ -0,0 +1,17 @@
+package migration_20231228_0000
+
+import (
+	. "github.com/nexodus-io/nexodus/internal/database/migrations"
+)
+
+type Device struct {
+	RelayMode bool
+}
+
+func init() {
+	migrationId := "20231228-0000"
+	CreateMigrationFromActions(migrationId,
+		AddTableColumnsAction(&Device{}),
+		ExecAction(`UPDATE devices SET relay_mode = relay`, ""),
+	)
+}
@@ -22,27 +22,32 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/devices": {
+        "/api/device-profiles": {
             "get": {
-                "description": "Lists all devices",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Lists all device profiles",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Devices"
+                    "DeviceProfile"
+                ],
+                "summary": "List Device Profiles",
+                "operationId": "ListDeviceProfiles",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "greater than revision",
+                        "name": "gt_revision",
+                        "in": "query"
+                    }
                 ],
-                "summary": "List Devices",
-                "operationId": "ListDevices",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Device"
+                                "$ref": "#/definitions/models.DeviceProfile"
                             }
                         }
                     },
@@ -67,26 +72,23 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Adds a new device",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Adds a new device profile, the settings of a profile are applied by the nexd of the devices it\nis assigned to while they run.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Devices"
+                    "DeviceProfile"
                 ],
-                "summary": "Add Devices",
-                "operationId": "CreateDevice",
+                "summary": "Add Device Profile",
+                "operationId": "CreateDeviceProfile",
                 "parameters": [
                     {
-                        "description": "Add Device",
-                        "name": "Device",
+                        "description": "Add Device Profile",
+                        "name": "DeviceProfile",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.AddDevice"
+                            "$ref": "#/definitions/models.AddDeviceProfile"
                         }
                     }
                 ],
@@ -94,7 +96,7 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/models.Device"
+                            "$ref": "#/definitions/models.DeviceProfile"
                         }
                     },
                     "400": {
@@ -109,10 +111,16 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.BaseError"
                         }
                     },
-                    "409": {
-                        "description": "Conflict",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/models.ConflictsError"
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
                         }
                     },
                     "429": {
@@ -130,24 +138,21 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/devices/{id}": {
+        "/api/device-profiles/{id}": {
             "get": {
-                "description": "Gets a device by ID",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Gets a device profile by ID",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Devices"
+                    "DeviceProfile"
                 ],
-                "summary": "Get Devices",
-                "operationId": "GetDevice",
+                "summary": "Get Device Profile",
+                "operationId": "GetDeviceProfile",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Device ID",
+                        "description": "Device Profile ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -157,7 +162,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Device"
+                            "$ref": "#/definitions/models.DeviceProfile"
                         }
                     },
                     "400": {
@@ -193,32 +198,29 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Deletes an existing device and associated IPAM lease",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Deletes a device profile, the devices and registration keys it was assigned to are left without one",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Devices"
+                    "DeviceProfile"
                 ],
-                "summary": "Delete Device",
-                "operationId": "DeleteDevice",
+                "summary": "Delete Device Profile",
+                "operationId": "DeleteDeviceProfile",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Device ID",
+                        "description": "Device Profile ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Device"
+                            "$ref": "#/definitions/models.DeviceProfile"
                         }
                     },
                     "400": {
@@ -227,6 +229,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.BaseError"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
                     "429": {
                         "description": "Too Many Requests",
                         "schema": {
@@ -242,33 +250,30 @@ const docTemplate = `{
                 }
             },
             "patch": {
-                "description": "Updates a device by ID",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Updates a device profile by ID, the devices it is assigned to apply the change while they run",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Devices"
+                    "DeviceProfile"
                 ],
-                "summary": "Update Devices",
-                "operationId": "UpdateDevice",
+                "summary": "Update Device Profile",
+                "operationId": "UpdateDeviceProfile",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Device ID",
+                        "description": "Device Profile ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Device Update",
+                        "description": "Device Profile Update",
                         "name": "update",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.UpdateDevice"
+                            "$ref": "#/definitions/models.UpdateDeviceProfile"
                         }
                     }
                 ],
@@ -276,7 +281,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Device"
+                            "$ref": "#/definitions/models.DeviceProfile"
                         }
                     },
                     "400": {
@@ -297,6 +302,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.BaseError"
                         }
                     },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
+                        }
+                    },
                     "429": {
                         "description": "Too Many Requests",
                         "schema": {
@@ -312,9 +323,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/devices/{id}/metadata": {
+        "/api/devices": {
             "get": {
-                "description": "Lists metadata for a device",
+                "description": "Lists all devices",
                 "consumes": [
                     "application/json"
                 ],
@@ -324,33 +335,30 @@ const docTemplate = `{
                 "tags": [
                     "Devices"
                 ],
-                "summary": "List Device Metadata",
-                "operationId": "ListDeviceMetadata",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Device ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "greater than revision",
-                        "name": "gt_revision",
-                        "in": "query"
-                    }
-                ],
+                "summary": "List Devices",
+                "operationId": "ListDevices",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.DeviceMetadata"
+                                "$ref": "#/definitions/models.Device"
                             }
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -359,25 +367,60 @@ const docTemplate = `{
                     }
                 }
             },
-            "delete": {
-                "description": "Delete all metadata for a device",
+            "post": {
+                "description": "Adds a new device",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
                     "Devices"
                 ],
-                "summary": "Delete all Device metadata",
-                "operationId": "DeleteDeviceMetadata",
+                "summary": "Add Devices",
+                "operationId": "CreateDevice",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Device ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Add Device",
+                        "name": "Device",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.AddDevice"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Device"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ConflictsError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
                     },
                     "500": {
                         "description": "Internal Server Error",
@@ -388,9 +431,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/devices/{id}/metadata/{key}": {
+        "/api/devices/{id}": {
             "get": {
-                "description": "Get metadata for a device",
+                "description": "Gets a device by ID",
                 "consumes": [
                     "application/json"
                 ],
@@ -400,8 +443,8 @@ const docTemplate = `{
                 "tags": [
                     "Devices"
                 ],
-                "summary": "Get Device Metadata",
-                "operationId": "GetDeviceMetadataKey",
+                "summary": "Get Devices",
+                "operationId": "GetDevice",
                 "parameters": [
                     {
                         "type": "string",
@@ -409,20 +452,37 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Metadata Key",
-                        "name": "key",
-                        "in": "path",
-                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.DeviceMetadata"
+                            "$ref": "#/definitions/models.Device"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
                         }
                     },
                     "500": {
@@ -433,8 +493,8 @@ const docTemplate = `{
                     }
                 }
             },
-            "put": {
-                "description": "Set metadata key for a device",
+            "delete": {
+                "description": "Deletes an existing device and associated IPAM lease",
                 "consumes": [
                     "application/json"
                 ],
@@ -444,8 +504,8 @@ const docTemplate = `{
                 "tags": [
                     "Devices"
                 ],
-                "summary": "Set Device Metadata by key",
-                "operationId": "UpdateDeviceMetadataKey",
+                "summary": "Delete Device",
+                "operationId": "DeleteDevice",
                 "parameters": [
                     {
                         "type": "string",
@@ -453,28 +513,986 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Metadata Key",
-                        "name": "key",
-                        "in": "path"
-                    },
-                    {
-                        "description": "Metadata Value",
-                        "name": "value",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "object"
-                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "204": {
+                        "description": "No Content",
                         "schema": {
-                            "$ref": "#/definitions/models.DeviceMetadata"
+                            "$ref": "#/definitions/models.Device"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Updates a device by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Update Devices",
+                "operationId": "UpdateDevice",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Device Update",
+                        "name": "update",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UpdateDevice"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Device"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/actions": {
+            "get": {
+                "description": "Lists the actions a device was asked to run within the retention window, with their results",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "List Device Actions",
+                "operationId": "ListDeviceActions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.DeviceAction"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Asks a device to run an action: stun, rekey, flush-peers, diagnostics or log-level. The device\nlearns of the action through the vpc events, acknowledges it and posts back its result.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Create Device Action",
+                "operationId": "CreateDeviceAction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Add Device Action",
+                        "name": "DeviceAction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.AddDeviceAction"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.DeviceAction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/actions/{action_id}": {
+            "get": {
+                "description": "Gets an action a device was asked to run, with its result once the device posted it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Get Device Action",
+                "operationId": "GetDeviceAction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Device Action ID",
+                        "name": "action_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.DeviceAction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Used by the device to acknowledge an action, and to post back its result once it ran",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Update Device Action",
+                "operationId": "UpdateDeviceAction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Device Action ID",
+                        "name": "action_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Update Device Action",
+                        "name": "DeviceAction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UpdateDeviceAction"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.DeviceAction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/hole-punches": {
+            "post": {
+                "description": "Offers the candidate endpoints of a device to a peer, to punch holes through the NATs of both\ndevices. The peer learns of the hole punch through the vpc events and answers it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Start Hole Punch",
+                "operationId": "CreateHolePunch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Add Hole Punch",
+                        "name": "HolePunch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.AddHolePunch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.HolePunch"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/hole-punches/{hole_punch_id}": {
+            "patch": {
+                "description": "Answers a hole punch with the candidate endpoints of the device. The api-server then sets the\nmoment both devices send packets to the candidates of the other.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Answer Hole Punch",
+                "operationId": "AnswerHolePunch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Hole Punch ID",
+                        "name": "hole_punch_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Answer Hole Punch",
+                        "name": "HolePunch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.AnswerHolePunch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.HolePunch"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/metadata": {
+            "get": {
+                "description": "Lists metadata for a device",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "List Device Metadata",
+                "operationId": "ListDeviceMetadata",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "greater than revision",
+                        "name": "gt_revision",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.DeviceMetadata"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete all metadata for a device",
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Delete all Device metadata",
+                "operationId": "DeleteDeviceMetadata",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/metadata/{key}": {
+            "get": {
+                "description": "Get metadata for a device",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Get Device Metadata",
+                "operationId": "GetDeviceMetadataKey",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Metadata Key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.DeviceMetadata"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Set metadata key for a device",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Set Device Metadata by key",
+                "operationId": "UpdateDeviceMetadataKey",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Metadata Key",
+                        "name": "key",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Metadata Value",
+                        "name": "value",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.DeviceMetadata"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a metadata key for a device",
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Delete a Device metadata key",
+                "operationId": "DeleteDeviceMetadataKey",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Metadata Key",
+                        "name": "key",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/preshared-keys": {
+            "get": {
+                "description": "Lists the WireGuard preshared keys a device should use with each of its peers, for the current\nand the next rotation period. The keys are sealed to the public key of the device.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "List Device Preshared Keys",
+                "operationId": "ListDevicePresharedKeys",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PeerPresharedKey"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/rotate-token": {
+            "post": {
+                "description": "Issues a new bearer token for a device and revokes the current one. The device stays enabled,\nrevoke it with the revoked field of UpdateDevice.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Rotate Device Token",
+                "operationId": "RotateDeviceToken",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Device"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/devices/{id}/tcp-relay": {
+            "get": {
+                "description": "Upgrades the connection to a websocket that carries the WireGuard packets of a device to and from\nits peers, for networks that block UDP. Each binary message holds the 16 byte id of the peer\nfollowed by the packet.",
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Relay WireGuard Packets",
+                "operationId": "TCPRelay",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
                         }
                     },
                     "500": {
@@ -484,14 +1502,22 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete a metadata key for a device",
+            }
+        },
+        "/api/devices/{id}/telemetry": {
+            "post": {
+                "description": "Used by the device to report the status of its tunnels to its peers, it replaces the previous report",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
                     "Devices"
                 ],
-                "summary": "Delete a Device metadata key",
-                "operationId": "DeleteDeviceMetadataKey",
+                "summary": "Report Device Telemetry",
+                "operationId": "ReportDeviceTelemetry",
                 "parameters": [
                     {
                         "type": "string",
@@ -501,15 +1527,57 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Metadata Key",
-                        "name": "key",
-                        "in": "path"
+                        "description": "Device Telemetry",
+                        "name": "Telemetry",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ReportDeviceTelemetry"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.DeviceTelemetry"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
                     },
                     "500": {
                         "description": "Internal Server Error",
@@ -1658,20 +2726,229 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Security Group Update",
-                        "name": "update",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.UpdateSecurityGroup"
-                        }
+                        "description": "Security Group Update",
+                        "name": "update",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UpdateSecurityGroup"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SecurityGroup"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/security-groups/{id}/grants": {
+            "get": {
+                "description": "Lists the active and expired grants of a Security Group",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "SecurityGroup"
+                ],
+                "summary": "List Security Group Grants",
+                "operationId": "ListSecurityGroupGrants",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Security Group ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.SecurityGroupGrant"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Temporarily adds a rule to a Security Group until the grant expires",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "SecurityGroup"
+                ],
+                "summary": "Add Security Group Grant",
+                "operationId": "CreateSecurityGroupGrant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Security Group ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Add Security Group Grant",
+                        "name": "Grant",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.AddSecurityGroupGrant"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.SecurityGroupGrant"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/security-groups/{id}/grants/{grant}": {
+            "delete": {
+                "description": "Ends a Security Group Grant before it expires, the grant is kept for review",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "SecurityGroup"
+                ],
+                "summary": "Revoke Security Group Grant",
+                "operationId": "RevokeSecurityGroupGrant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Security Group ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Grant ID",
+                        "name": "grant",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.SecurityGroup"
+                            "$ref": "#/definitions/models.SecurityGroupGrant"
                         }
                     },
                     "400": {
@@ -1692,12 +2969,6 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.BaseError"
                         }
                     },
-                    "422": {
-                        "description": "Unprocessable Entity",
-                        "schema": {
-                            "$ref": "#/definitions/models.ValidationError"
-                        }
-                    },
                     "429": {
                         "description": "Too Many Requests",
                         "schema": {
@@ -2172,21 +3443,280 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes an existing vpc and associated IPAM prefix",
-                "consumes": [
-                    "application/json"
-                ],
+            },
+            "delete": {
+                "description": "Deletes an existing vpc and associated IPAM prefix",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "VPC"
+                ],
+                "summary": "Delete VPC",
+                "operationId": "DeleteVPC",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "VPC ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "$ref": "#/definitions/models.VPC"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Updates a vpc by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "VPC"
+                ],
+                "summary": "Update VPCs",
+                "operationId": "UpdateVPC",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "VPC ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "VPC Update",
+                        "name": "update",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UpdateVPC"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.VPC"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/vpcs/{id}/connectivity": {
+            "get": {
+                "description": "Gets the status of the tunnel between the pairs of devices in a VPC, from what the devices reported.\nOnly the pairs that are not direct are returned, unless all is set.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "VPC"
+                ],
+                "summary": "Get VPC Connectivity",
+                "operationId": "GetVPCConnectivity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "VPC ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "only the pairs this device is part of",
+                        "name": "device_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "also the pairs that reach each other directly",
+                        "name": "all",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.VPCConnectivity"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/vpcs/{id}/device-actions": {
+            "get": {
+                "description": "Lists the actions the devices in a VPC were asked to run, without their results",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "VPC"
+                ],
+                "summary": "List Device Actions in a VPC",
+                "operationId": "ListDeviceActionsInVPC",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "greater than revision",
+                        "name": "gt_revision",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "VPC ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.DeviceAction"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.BaseError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.InternalServerError"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/vpcs/{id}/device-profiles": {
+            "get": {
+                "description": "Lists the device profiles in a VPC",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "VPC"
                 ],
-                "summary": "Delete VPC",
-                "operationId": "DeleteVPC",
+                "summary": "List Device Profiles in a VPC",
+                "operationId": "ListDeviceProfilesInVPC",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "greater than revision",
+                        "name": "gt_revision",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "description": "VPC ID",
@@ -2196,20 +3726,17 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content",
-                        "schema": {
-                            "$ref": "#/definitions/models.VPC"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.BaseError"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.DeviceProfile"
+                            }
                         }
                     },
-                    "405": {
-                        "description": "Method Not Allowed",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/models.BaseError"
                         }
@@ -2227,9 +3754,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "patch": {
-                "description": "Updates a vpc by ID",
+            }
+        },
+        "/api/vpcs/{id}/devices": {
+            "get": {
+                "description": "Lists all devices for this VPC",
                 "consumes": [
                     "application/json"
                 ],
@@ -2239,31 +3768,31 @@ const docTemplate = `{
                 "tags": [
                     "VPC"
                 ],
-                "summary": "Update VPCs",
-                "operationId": "UpdateVPC",
+                "summary": "List Devices",
+                "operationId": "ListDevicesInVPC",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "greater than revision",
+                        "name": "gt_revision",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "description": "VPC ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "VPC Update",
-                        "name": "update",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.UpdateVPC"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.VPC"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Device"
+                            }
                         }
                     },
                     "400": {
@@ -2278,12 +3807,6 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.BaseError"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "$ref": "#/definitions/models.BaseError"
-                        }
-                    },
                     "429": {
                         "description": "Too Many Requests",
                         "schema": {
@@ -2299,20 +3822,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/vpcs/{id}/devices": {
+        "/api/vpcs/{id}/hole-punches": {
             "get": {
-                "description": "Lists all devices for this VPC",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Lists the hole punches of the devices in a VPC",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "VPC"
                 ],
-                "summary": "List Devices",
-                "operationId": "ListDevicesInVPC",
+                "summary": "List Hole Punches in a VPC",
+                "operationId": "ListHolePunchesInVPC",
                 "parameters": [
                     {
                         "type": "integer",
@@ -2334,16 +3854,10 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Device"
+                                "$ref": "#/definitions/models.HolePunch"
                             }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/models.BaseError"
-                        }
-                    },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {
@@ -2753,6 +4267,9 @@ const docTemplate = `{
                         "$ref": "#/definitions/models.TunnelIP"
                     }
                 },
+                "nat": {
+                    "$ref": "#/definitions/models.NatBehavior"
+                },
                 "os": {
                     "type": "string"
                 },
@@ -2774,6 +4291,52 @@ const docTemplate = `{
                 }
             }
         },
+        "models.AddDeviceAction": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "log-level"
+                },
+                "argument": {
+                    "type": "string",
+                    "example": "debug"
+                }
+            }
+        },
+        "models.AddDeviceProfile": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string",
+                    "example": "edge boxes"
+                },
+                "settings": {
+                    "$ref": "#/definitions/models.DeviceProfileSettings"
+                },
+                "vpc_id": {
+                    "type": "string",
+                    "example": "694aa002-5d19-495e-980b-3d8fd508ea10"
+                }
+            }
+        },
+        "models.AddHolePunch": {
+            "type": "object",
+            "properties": {
+                "candidates": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "203.0.113.10:51820"
+                    ]
+                },
+                "peer_id": {
+                    "type": "string"
+                }
+            }
+        },
         "models.AddInvitation": {
             "type": "object",
             "properties": {
@@ -2810,6 +4373,10 @@ const docTemplate = `{
                     "description": "Description of the registration key.",
                     "type": "string"
                 },
+                "device_profile_id": {
+                    "description": "DeviceProfileId is the ID of the device profile to assign to the device.",
+                    "type": "string"
+                },
                 "expires_at": {
                     "description": "ExpiresAt is optional, if set the registration key is only valid until the ExpiresAt time.",
                     "type": "string"
@@ -2857,6 +4424,29 @@ const docTemplate = `{
                 }
             }
         },
+        "models.AddSecurityGroupGrant": {
+            "type": "object",
+            "properties": {
+                "direction": {
+                    "type": "string",
+                    "example": "inbound"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "debug replication lag"
+                },
+                "requester": {
+                    "type": "string",
+                    "example": "alice"
+                },
+                "rule": {
+                    "$ref": "#/definitions/models.SecurityRule"
+                }
+            }
+        },
         "models.AddVPC": {
             "type": "object",
             "properties": {
@@ -2872,11 +4462,47 @@ const docTemplate = `{
                     "type": "string",
                     "example": "0200::/8"
                 },
+                "max_key_age_seconds": {
+                    "type": "integer",
+                    "example": 7776000
+                },
+                "mtu": {
+                    "type": "integer",
+                    "example": 1380
+                },
+                "on_demand_peering": {
+                    "type": "boolean"
+                },
                 "organization_id": {
                     "type": "string"
                 },
+                "peer_idle_timeout_seconds": {
+                    "type": "integer",
+                    "example": 600
+                },
+                "preshared_keys": {
+                    "type": "boolean"
+                },
                 "private_cidr": {
                     "type": "boolean"
+                },
+                "topology": {
+                    "type": "string",
+                    "example": "full-mesh"
+                }
+            }
+        },
+        "models.AnswerHolePunch": {
+            "type": "object",
+            "properties": {
+                "candidates": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "198.51.100.7:51820"
+                    ]
                 }
             }
         },
@@ -2921,6 +4547,10 @@ const docTemplate = `{
                     "description": "the token nexd should use to reconcile device state.",
                     "type": "string"
                 },
+                "device_profile_id": {
+                    "description": "the device profile holding the nexd settings of the device.",
+                    "type": "string"
+                },
                 "endpoints": {
                     "type": "array",
                     "items": {
@@ -2946,6 +4576,14 @@ const docTemplate = `{
                         "$ref": "#/definitions/models.TunnelIP"
                     }
                 },
+                "nat": {
+                    "description": "how the NAT in front of the device behaves, when the device discovered it.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.NatBehavior"
+                        }
+                    ]
+                },
                 "online": {
                     "type": "boolean"
                 },
@@ -2958,40 +4596,222 @@ const docTemplate = `{
                 "owner_id": {
                     "type": "string"
                 },
+                "peering_group": {
+                    "description": "in a VPC with the groups topology, devices of the same group peer with each other.",
+                    "type": "string"
+                },
+                "previous_public_key": {
+                    "description": "the public key replaced by the last key rotation.",
+                    "type": "string"
+                },
+                "previous_public_key_expires_at": {
+                    "description": "when the apiserver stops accepting the previous public key.",
+                    "type": "string"
+                },
                 "public_key": {
                     "type": "string"
                 },
+                "public_key_created_at": {
+                    "description": "when the current public key was registered, used to enforce the VPC max key age.",
+                    "type": "string"
+                },
                 "relay": {
                     "type": "boolean"
                 },
+                "relay_latencies": {
+                    "description": "the latency in ms the device measured to each relay it reaches, by relay id.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "relay_load": {
+                    "description": "for relay devices, how many KB/s of traffic they relay, so that devices spread across the relays.",
+                    "type": "integer"
+                },
                 "revision": {
                     "type": "integer"
                 },
+                "revoked": {
+                    "description": "an admin revoked the device, it is not issued a device token until it is re-enabled.",
+                    "type": "boolean"
+                },
                 "security_group_id": {
                     "type": "string"
                 },
-                "symmetric_nat": {
-                    "type": "boolean"
+                "symmetric_nat": {
+                    "type": "boolean"
+                },
+                "vpc_id": {
+                    "type": "string",
+                    "example": "694aa002-5d19-495e-980b-3d8fd508ea10"
+                }
+            }
+        },
+        "models.DeviceAction": {
+            "type": "object",
+            "properties": {
+                "acknowledged_at": {
+                    "type": "string"
+                },
+                "action": {
+                    "type": "string",
+                    "example": "rekey"
+                },
+                "argument": {
+                    "type": "string",
+                    "example": "debug"
+                },
+                "completed_at": {
+                    "type": "string"
+                },
+                "device_id": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "aa22666c-0f57-45cb-a449-16efecc04f2e"
+                },
+                "result": {
+                    "description": "Result is the output of the action, or why it failed. It is left out of the vpc events.",
+                    "type": "string"
+                },
+                "revision": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "pending"
+                },
+                "vpc_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DeviceMetadata": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "revision": {
+                    "type": "integer"
+                },
+                "value": {}
+            }
+        },
+        "models.DevicePairConnectivity": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string"
+                },
+                "device_report": {
+                    "description": "DeviceReport is what the device reported about the peer, nil when it did not report recently.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.PeerTelemetry"
+                        }
+                    ],
+                    "x-nullable": true
+                },
+                "peer_id": {
+                    "type": "string"
+                },
+                "peer_report": {
+                    "description": "PeerReport is what the peer reported about the device, nil when it did not report recently.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.PeerTelemetry"
+                        }
+                    ],
+                    "x-nullable": true
+                },
+                "status": {
+                    "description": "Status is one of direct, relayed, failing, idle or unknown.",
+                    "type": "string",
+                    "example": "relayed"
+                }
+            }
+        },
+        "models.DeviceProfile": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "aa22666c-0f57-45cb-a449-16efecc04f2e"
+                },
+                "revision": {
+                    "type": "integer"
+                },
+                "settings": {
+                    "$ref": "#/definitions/models.DeviceProfileSettings"
                 },
                 "vpc_id": {
-                    "type": "string",
-                    "example": "694aa002-5d19-495e-980b-3d8fd508ea10"
+                    "type": "string"
                 }
             }
         },
-        "models.DeviceMetadata": {
+        "models.DeviceProfileSettings": {
             "type": "object",
             "properties": {
-                "device_id": {
-                    "type": "string"
+                "advertise_cidrs": {
+                    "description": "AdvertiseCidrs are the CIDRs the devices advertise to their peers.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "172.16.42.0/24"
+                    ]
                 },
-                "key": {
-                    "type": "string"
+                "egress": {
+                    "description": "Egress are the egress proxy rules of devices running in proxy mode.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "tcp:8080:10.10.0.5:80"
+                    ]
                 },
-                "revision": {
-                    "type": "integer"
+                "exit_node_client": {
+                    "description": "ExitNodeClient sends the internet traffic of the devices through an exit node of the VPC.",
+                    "type": "boolean",
+                    "x-nullable": true
                 },
-                "value": {}
+                "ingress": {
+                    "description": "Ingress are the ingress proxy rules of devices running in proxy mode.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "tcp:443:10.10.0.5:8443"
+                    ]
+                },
+                "keepalive": {
+                    "description": "Keepalive is the persistent keepalive interval of the tunnels in seconds, 0 turns it off.",
+                    "type": "integer",
+                    "x-nullable": true,
+                    "example": 20
+                },
+                "log_level": {
+                    "description": "LogLevel is the level nexd logs at.",
+                    "type": "string",
+                    "example": "debug"
+                },
+                "relay": {
+                    "description": "Relay makes the devices relay traffic for the devices of the VPC behind symmetric NATs.",
+                    "type": "boolean",
+                    "x-nullable": true
+                }
             }
         },
         "models.DeviceStartResponse": {
@@ -3014,16 +4834,81 @@ const docTemplate = `{
                 }
             }
         },
+        "models.DeviceTelemetry": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string"
+                },
+                "peers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PeerTelemetry"
+                    }
+                },
+                "reported_at": {
+                    "type": "string"
+                },
+                "vpc_id": {
+                    "type": "string"
+                }
+            }
+        },
         "models.Endpoint": {
             "type": "object",
             "properties": {
                 "address": {
-                    "description": "IP address and port of the endpoint.",
+                    "description": "IP address and port of the endpoint, IPv6 addresses are in brackets.",
                     "type": "string",
                     "example": "10.1.1.1:51820"
                 },
                 "source": {
-                    "description": "How the endpoint was discovered",
+                    "description": "How the endpoint was discovered: local or stun:\u003cserver\u003e for IPv4, local-ipv6 or stun-ipv6:\u003cserver\u003e for IPv6, port-mapping:\u003cprotocol\u003e for the port mapped on the gateway",
+                    "type": "string"
+                }
+            }
+        },
+        "models.HolePunch": {
+            "type": "object",
+            "properties": {
+                "candidates": {
+                    "description": "Candidates are the endpoints the device may be reached at, the most likely one first.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "device_id": {
+                    "description": "DeviceID is the device that started the hole punch.",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "aa22666c-0f57-45cb-a449-16efecc04f2e"
+                },
+                "peer_candidates": {
+                    "description": "PeerCandidates are the endpoints the peer may be reached at, set once the peer answered.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "peer_id": {
+                    "description": "PeerID is the device asked to answer the hole punch.",
+                    "type": "string"
+                },
+                "punch_at": {
+                    "description": "PunchAt is when both devices send packets to the candidates of the other, set once the peer answered.",
+                    "type": "string"
+                },
+                "punch_in_ms": {
+                    "description": "PunchInMs is how many milliseconds after receiving the hole punch the devices punch, computed whenever it is sent so that devices don't depend on their clock agreeing with the one of the api-server.",
+                    "type": "integer"
+                },
+                "revision": {
+                    "type": "integer"
+                },
+                "vpc_id": {
                     "type": "string"
                 }
             }
@@ -3109,6 +4994,25 @@ const docTemplate = `{
                 }
             }
         },
+        "models.NatBehavior": {
+            "type": "object",
+            "properties": {
+                "filtering": {
+                    "description": "Filtering is which traffic the NAT lets in to a reflexive address, one of endpoint-independent,\naddress-dependent or address-and-port-dependent. Empty when the device could not discover it.",
+                    "type": "string",
+                    "example": "address-and-port-dependent"
+                },
+                "hairpinning": {
+                    "description": "Hairpinning is whether the NAT forwards traffic sent to one of its reflexive addresses from behind it.",
+                    "type": "boolean"
+                },
+                "mapping": {
+                    "description": "Mapping is whether the NAT maps the device to the same reflexive address for every destination,\none of endpoint-independent, address-dependent or address-and-port-dependent.",
+                    "type": "string",
+                    "example": "endpoint-independent"
+                }
+            }
+        },
         "models.NotAllowedError": {
             "type": "object",
             "properties": {
@@ -3142,6 +5046,52 @@ const docTemplate = `{
                 }
             }
         },
+        "models.PeerPresharedKey": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "peer_id": {
+                    "type": "string"
+                },
+                "sealed_key": {
+                    "description": "the preshared key sealed to the public key of the requesting device.",
+                    "type": "string"
+                },
+                "starts_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PeerTelemetry": {
+            "type": "object",
+            "properties": {
+                "latest_handshake": {
+                    "type": "string"
+                },
+                "peer_id": {
+                    "type": "string"
+                },
+                "peering_method": {
+                    "type": "string",
+                    "example": "reflexive"
+                },
+                "rx_bytes": {
+                    "type": "integer",
+                    "format": "int64"
+                },
+                "status": {
+                    "description": "Status is one of direct, relayed, failing or idle.",
+                    "type": "string",
+                    "example": "direct"
+                },
+                "tx_bytes": {
+                    "type": "integer",
+                    "format": "int64"
+                }
+            }
+        },
         "models.RefreshTokenRequest": {
             "type": "object",
             "properties": {
@@ -3176,6 +5126,10 @@ const docTemplate = `{
                     "description": "DeviceId is set if the RegKey was created for single use",
                     "type": "string"
                 },
+                "device_profile_id": {
+                    "description": "DeviceProfileId is the ID of the device profile to assign to the device.",
+                    "type": "string"
+                },
                 "expires_at": {
                     "description": "ExpiresAt is optional, if set the registration key is only valid until the ExpiresAt time.",
                     "type": "string"
@@ -3203,12 +5157,30 @@ const docTemplate = `{
                 }
             }
         },
+        "models.ReportDeviceTelemetry": {
+            "type": "object",
+            "properties": {
+                "peers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PeerTelemetry"
+                    }
+                }
+            }
+        },
         "models.SecurityGroup": {
             "type": "object",
             "properties": {
                 "description": {
                     "type": "string"
                 },
+                "grants": {
+                    "description": "Grants holds the active time-bound grants for the group, their rules apply in addition to the inbound and outbound rules.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.SecurityGroupGrant"
+                    }
+                },
                 "id": {
                     "type": "string",
                     "example": "aa22666c-0f57-45cb-a449-16efecc04f2e"
@@ -3233,14 +5205,75 @@ const docTemplate = `{
                 }
             }
         },
+        "models.SecurityGroupGrant": {
+            "type": "object",
+            "properties": {
+                "approver_id": {
+                    "description": "ApproverID is the ID of the user that created the grant.",
+                    "type": "string"
+                },
+                "direction": {
+                    "description": "Direction is either inbound or outbound.",
+                    "type": "string",
+                    "example": "inbound"
+                },
+                "expired_at": {
+                    "description": "ExpiredAt is set once the grant has been removed from the security group.",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "ExpiresAt is when the grant stops being applied.",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "aa22666c-0f57-45cb-a449-16efecc04f2e"
+                },
+                "reason": {
+                    "description": "Reason is a free form justification for the grant.",
+                    "type": "string",
+                    "example": "debug replication lag"
+                },
+                "requester": {
+                    "description": "Requester identifies who asked for the access.",
+                    "type": "string",
+                    "example": "alice"
+                },
+                "rule": {
+                    "$ref": "#/definitions/models.SecurityRule"
+                },
+                "security_group_id": {
+                    "type": "string"
+                },
+                "vpc_id": {
+                    "type": "string"
+                }
+            }
+        },
         "models.SecurityRule": {
             "type": "object",
             "properties": {
                 "from_port": {
                     "type": "integer"
                 },
+                "icmp_codes": {
+                    "description": "IcmpCodes limits an icmpv4 or icmpv6 rule to the listed ICMP codes of its icmp_types",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "icmp_types": {
+                    "description": "IcmpTypes limits an icmpv4 or icmpv6 rule to the listed ICMP types",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
                 "ip_protocol": {
-                    "type": "string"
+                    "description": "IpProtocol is a protocol name or an IP protocol number between 0 and 255",
+                    "type": "string",
+                    "example": "tcp"
                 },
                 "ip_ranges": {
                     "type": "array",
@@ -3248,6 +5281,13 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "ports": {
+                    "description": "Ports is a list of destination ports, it can be used instead of the from_port/to_port range",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
                 "to_port": {
                     "type": "integer"
                 }
@@ -3280,6 +5320,10 @@ const docTemplate = `{
                         "172.16.42.0/24"
                     ]
                 },
+                "device_profile_id": {
+                    "description": "assigns a device profile to the device, the nil uuid removes it.",
+                    "type": "string"
+                },
                 "endpoints": {
                     "type": "array",
                     "items": {
@@ -3290,9 +5334,52 @@ const docTemplate = `{
                     "type": "string",
                     "example": "myhost"
                 },
+                "key_overlap_seconds": {
+                    "description": "how long the previous public key is still accepted after a rotation.",
+                    "type": "integer",
+                    "example": 300
+                },
+                "nat": {
+                    "description": "ignored without a mapping, the device did not discover the behavior of its NAT.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.NatBehavior"
+                        }
+                    ]
+                },
+                "peering_group": {
+                    "type": "string",
+                    "example": "branch-east"
+                },
+                "public_key": {
+                    "description": "rotates the device to a new public key.",
+                    "type": "string"
+                },
+                "relay": {
+                    "description": "makes the device a relay, or stops it being one unless its device profile makes it one. Only users can change it.",
+                    "type": "boolean",
+                    "x-nullable": true
+                },
+                "relay_latencies": {
+                    "description": "reported by devices, the latency in ms to each relay they reach, by relay id.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "relay_load": {
+                    "description": "reported by relay devices, how many KB/s of traffic they relay.",
+                    "type": "integer",
+                    "example": 512
+                },
                 "revision": {
                     "type": "integer"
                 },
+                "revoked": {
+                    "description": "revokes the device or re-enables it, only users can change it.",
+                    "type": "boolean",
+                    "x-nullable": true
+                },
                 "security_group_id": {
                     "type": "string"
                 },
@@ -3305,6 +5392,35 @@ const docTemplate = `{
                 }
             }
         },
+        "models.UpdateDeviceAction": {
+            "type": "object",
+            "properties": {
+                "result": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "succeeded"
+                }
+            }
+        },
+        "models.UpdateDeviceProfile": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "settings": {
+                    "description": "Settings replace the settings of the profile.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.DeviceProfileSettings"
+                        }
+                    ],
+                    "x-nullable": true
+                }
+            }
+        },
         "models.UpdateRegKey": {
             "type": "object",
             "properties": {
@@ -3312,6 +5428,10 @@ const docTemplate = `{
                     "description": "Description of the registration key.",
                     "type": "string"
                 },
+                "device_profile_id": {
+                    "description": "DeviceProfileId is the ID of the device profile to assign to the device.",
+                    "type": "string"
+                },
                 "expires_at": {
                     "description": "ExpiresAt is optional, if set the registration key is only valid until the ExpiresAt time.",
                     "type": "string"
@@ -3353,6 +5473,28 @@ const docTemplate = `{
                 "description": {
                     "type": "string",
                     "example": "The Red Zone"
+                },
+                "max_key_age_seconds": {
+                    "type": "integer",
+                    "example": 7776000
+                },
+                "mtu": {
+                    "type": "integer",
+                    "example": 1380
+                },
+                "on_demand_peering": {
+                    "type": "boolean"
+                },
+                "peer_idle_timeout_seconds": {
+                    "type": "integer",
+                    "example": 600
+                },
+                "preshared_keys": {
+                    "type": "boolean"
+                },
+                "topology": {
+                    "type": "string",
+                    "example": "hub-and-spoke"
                 }
             }
         },
@@ -3419,11 +5561,49 @@ const docTemplate = `{
                 "ipv6_cidr": {
                     "type": "string"
                 },
+                "max_key_age_seconds": {
+                    "description": "the maximum age of a device's WireGuard key before it must be rotated, 0 disables the limit.",
+                    "type": "integer"
+                },
+                "mtu": {
+                    "description": "the MTU of the tunnel interface of the devices, 0 lets nexd use its default and the path MTU it discovers.",
+                    "type": "integer"
+                },
+                "on_demand_peering": {
+                    "description": "when enabled devices only peer with each other when their security groups call for it or once they exchange traffic.",
+                    "type": "boolean"
+                },
                 "organization_id": {
                     "type": "string"
                 },
+                "peer_idle_timeout_seconds": {
+                    "description": "how long an on-demand peer is kept without traffic, 0 uses the default of 10 minutes.",
+                    "type": "integer"
+                },
+                "preshared_keys": {
+                    "description": "when enabled every pair of devices also uses a WireGuard preshared key.",
+                    "type": "boolean"
+                },
                 "private_cidr": {
                     "type": "boolean"
+                },
+                "topology": {
+                    "description": "which devices peer with each other: full-mesh, hub-and-spoke or groups.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.VPCConnectivity": {
+            "type": "object",
+            "properties": {
+                "pairs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.DevicePairConnectivity"
+                    }
+                },
+                "vpc_id": {
+                    "type": "string"
                 }
             }
         },
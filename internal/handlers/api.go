@@ -15,11 +15,13 @@ import (
 	"github.com/redis/go-redis/v9"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/nexodus-io/nexodus/internal/database"
 	"github.com/open-policy-agent/opa/storage"
 
 	"github.com/nexodus-io/nexodus/internal/util"
+	"github.com/nexodus-io/nexodus/internal/util/cache"
 
 	"github.com/google/uuid"
 	"github.com/nexodus-io/nexodus/internal/fflags"
@@ -53,8 +55,14 @@ type API struct {
 	URL            string
 	PrivateKey     *rsa.PrivateKey
 	Certificates   []*x509.Certificate
-	SmtpServer     email.SmtpServer
-	SmtpFrom       string
+	// SigningKeyRotationInterval is how often a new key is generated to sign JWTs, 0 only uses the PrivateKey.
+	SigningKeyRotationInterval time.Duration
+	signingKeysCache           *cache.MemoizeCache[string, []signingKey]
+	tcpRelay                   *tcpRelay
+	SmtpServer                 email.SmtpServer
+	SmtpFrom                   string
+	// DeviceActionRetention is how long device actions and their results are kept.
+	DeviceActionRetention time.Duration
 }
 
 func NewAPI(
@@ -101,7 +109,11 @@ func NewAPI(
 		sessionManager: sessionManager,
 		fetchManager:   fetchManager,
 		onlineTracker:  onlineTracker,
+
+		DeviceActionRetention: defaultDeviceActionRetention,
 	}
+	api.signingKeysCache = newSigningKeysCache()
+	api.tcpRelay = newTCPRelay(logger, redis)
 
 	if err := api.populateStore(ctx); err != nil {
 		return nil, err
@@ -28,10 +28,21 @@ var (
 	errRegKeyExhausted       = errors.New("single use reg key exhausted")
 )
 
+const (
+	// defaultKeyOverlap is how long the previous public key of a device is accepted after a key rotation
+	defaultKeyOverlap = 5 * time.Minute
+	// maxKeyOverlap is the longest overlap window a device can request when rotating its key
+	maxKeyOverlap = 24 * time.Hour
+)
+
 type deviceList []*models.Device
 
 func (d deviceList) Item(i int) (any, uint64, gorm.DeletedAt) {
 	item := d[i]
+	// a revoked device is sent to watchers as deleted so its peers drop it until it is re-enabled
+	if item.Revoked && !item.DeletedAt.Valid {
+		return item, item.Revision, gorm.DeletedAt{Time: item.UpdatedAt, Valid: true}
+	}
 	return item, item.Revision, item.DeletedAt
 }
 
@@ -92,7 +103,7 @@ func encryptDeviceBearerToken(token string, publicKey string) string {
 }
 
 func hideDeviceBearerToken(device *models.Device, claims *models.NexodusClaims) {
-	if claims == nil {
+	if claims == nil || device.Revoked {
 		device.BearerToken = ""
 		return
 	}
@@ -111,6 +122,45 @@ func hideDeviceBearerToken(device *models.Device, claims *models.NexodusClaims)
 	device.BearerToken = ""
 }
 
+// deviceKeyExpired returns true if the device public key is older than the max key age of the vpc.
+func deviceKeyExpired(device models.Device, vpc models.VPC, now time.Time) bool {
+	if vpc.MaxKeyAgeSeconds <= 0 || device.PublicKeyCreatedAt == nil {
+		return false
+	}
+	return now.Sub(*device.PublicKeyCreatedAt) > time.Duration(vpc.MaxKeyAgeSeconds)*time.Second
+}
+
+// rotateDeviceKey replaces the public key of the device, the previous key is
+// kept so that it is still accepted until the overlap window expires.
+func rotateDeviceKey(tx *gorm.DB, device *models.Device, publicKey string, overlapSeconds int64, now time.Time) error {
+	if _, err := wgtypes.ParseKey(publicKey); err != nil {
+		return NewApiResponseError(http.StatusBadRequest, models.NewFieldValidationError("public_key", "must be a base64 encoded wireguard public key"))
+	}
+	overlap := defaultKeyOverlap
+	if overlapSeconds < 0 || time.Duration(overlapSeconds)*time.Second > maxKeyOverlap {
+		return NewApiResponseError(http.StatusBadRequest, models.NewFieldValidationError("key_overlap_seconds", fmt.Sprintf("must be between 0 and %d", int64(maxKeyOverlap/time.Second))))
+	} else if overlapSeconds > 0 {
+		overlap = time.Duration(overlapSeconds) * time.Second
+	}
+
+	// keys can not be reused, not even the one this device is rotating away from.
+	var existing models.Device
+	res := tx.Where("public_key = ? OR previous_public_key = ?", publicKey, publicKey).First(&existing)
+	if res.Error == nil {
+		return NewApiResponseError(http.StatusConflict, models.NewConflictsError(existing.ID.String()))
+	}
+	if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return res.Error
+	}
+
+	expiresAt := now.Add(overlap)
+	device.PreviousPublicKey = device.PublicKey
+	device.PreviousPublicKeyExpiresAt = &expiresAt
+	device.PublicKey = publicKey
+	device.PublicKeyCreatedAt = &now
+	return nil
+}
+
 func (api *API) DeviceIsOwnedByCurrentUser(c *gin.Context, db *gorm.DB) *gorm.DB {
 	userId := api.GetCurrentUserID(c)
 	return db.Where("owner_id = ?", userId)
@@ -156,6 +206,10 @@ func (api *API) GetDevice(c *gin.Context) {
 		c.JSON(err2.Status, err2.Body)
 		return
 	}
+	if err2 := deviceRevokedError(device, tokenClaims); err2 != nil {
+		c.JSON(err2.Status, err2.Body)
+		return
+	}
 
 	// only show the device token when using the reg token that created the device.
 	hideDeviceBearerToken(&device, tokenClaims)
@@ -226,6 +280,9 @@ func (api *API) UpdateDevice(c *gin.Context) {
 				}
 			}
 		}
+		if err := deviceRevokedError(device, tokenClaims); err != nil {
+			return err
+		}
 
 		var vpc models.VPC
 		if result = tx.First(&vpc, "id = ?", device.VpcID); result.Error != nil {
@@ -237,6 +294,15 @@ func (api *API) UpdateDevice(c *gin.Context) {
 			originalIpamNamespace = vpc.ID
 		}
 
+		now := time.Now()
+		if request.PublicKey != "" && request.PublicKey != device.PublicKey {
+			if err := rotateDeviceKey(tx, &device, request.PublicKey, request.KeyOverlapSeconds, now); err != nil {
+				return err
+			}
+		} else if deviceKeyExpired(device, vpc, now) {
+			return NewApiResponseError(http.StatusBadRequest, models.NewFieldValidationError("public_key", "the device key is older than the vpc max_key_age_seconds and must be rotated"))
+		}
+
 		if request.Hostname != "" {
 			device.Hostname = request.Hostname
 		}
@@ -315,6 +381,33 @@ func (api *API) UpdateDevice(c *gin.Context) {
 		if request.SymmetricNat != nil {
 			device.SymmetricNat = *request.SymmetricNat
 		}
+		if request.Nat != nil && request.Nat.Mapping != "" {
+			device.Nat = request.Nat
+		}
+		if request.PeeringGroup != nil && *request.PeeringGroup != device.PeeringGroup {
+			if isDeviceScope(tokenClaims) {
+				// the peering group decides which devices a device peers with, the device does not pick it itself
+				return NewApiResponseError(http.StatusForbidden, models.NewApiError(errors.New("only users can change the peering group of a device")))
+			}
+			device.PeeringGroup = *request.PeeringGroup
+		}
+		if request.RelayLoad != nil {
+			if !device.Relay {
+				return NewApiResponseError(http.StatusUnprocessableEntity, models.NewFieldValidationError("relay_load", "only relay devices report a load"))
+			}
+			if *request.RelayLoad < 0 {
+				return NewApiResponseError(http.StatusUnprocessableEntity, models.NewFieldValidationError("relay_load", "must not be negative"))
+			}
+			device.RelayLoad = *request.RelayLoad
+		}
+		if request.RelayLatencies != nil {
+			for _, latency := range request.RelayLatencies {
+				if latency < 0 {
+					return NewApiResponseError(http.StatusUnprocessableEntity, models.NewFieldValidationError("relay_latencies", "must not be negative"))
+				}
+			}
+			device.RelayLatencies = request.RelayLatencies
+		}
 
 		if request.SecurityGroupId != nil {
 			var sg models.SecurityGroup
@@ -324,6 +417,41 @@ func (api *API) UpdateDevice(c *gin.Context) {
 			}
 			device.SecurityGroupId = *request.SecurityGroupId
 		}
+		if request.DeviceProfileId != nil && !deviceProfileIdEquals(device.DeviceProfileId, *request.DeviceProfileId) {
+			if isDeviceScope(tokenClaims) {
+				// the device profile holds settings managed centrally, the device does not pick it itself
+				return NewApiResponseError(http.StatusForbidden, models.NewApiError(errors.New("only users can change the device profile of a device")))
+			}
+			if *request.DeviceProfileId == uuid.Nil {
+				device.DeviceProfileId = nil
+			} else {
+				var profile models.DeviceProfile
+				if result := tx.First(&profile, "id = ? AND vpc_id = ?", *request.DeviceProfileId, device.VpcID); result.Error != nil {
+					return NewApiResponseError(http.StatusNotFound, models.NewNotFoundError("device_profile_id"))
+				}
+				device.DeviceProfileId = request.DeviceProfileId
+			}
+		}
+		if request.Revoked != nil && *request.Revoked != device.Revoked {
+			if isDeviceScope(tokenClaims) {
+				return NewApiResponseError(http.StatusForbidden, models.NewApiError(errors.New("only users can revoke or re-enable a device")))
+			}
+			device.Revoked = *request.Revoked
+			if device.Revoked {
+				if err := replaceDeviceBearerToken(tx, &device, now); err != nil {
+					return err
+				}
+			}
+		}
+		if request.Relay != nil && *request.Relay != device.RelayMode {
+			if isDeviceScope(tokenClaims) {
+				return NewApiResponseError(http.StatusForbidden, models.NewApiError(errors.New("only users can change the relay role of a device")))
+			}
+			device.RelayMode = *request.Relay
+		}
+		if err := applyRelayRole(tx, &device); err != nil {
+			return err
+		}
 
 		// check if the updated device advertised CIDRs match the existing device advertised CIDRs
 		if request.AdvertiseCidrs != nil && !advertiseCidrEquals(device.AdvertiseCidrs, request.AdvertiseCidrs) {
@@ -383,6 +511,39 @@ func (api *API) UpdateDevice(c *gin.Context) {
 	c.JSON(http.StatusOK, device)
 }
 
+// applyRelayRole sets whether a device relays traffic for its vpc: when it registered as a relay, a user made it one,
+// or the device profile assigned to it has the relay role. Only linux devices take on the relay role of a profile, the
+// only ones nexd can relay on.
+func applyRelayRole(tx *gorm.DB, device *models.Device) error {
+	relay := device.RelayMode
+	if !relay && device.DeviceProfileId != nil && device.Os == "linux" {
+		var profile models.DeviceProfile
+		if result := tx.Select("settings").First(&profile, "id = ?", *device.DeviceProfileId); result.Error != nil {
+			return result.Error
+		}
+		relay = profile.Settings.Relay != nil && *profile.Settings.Relay
+	}
+	if relay == device.Relay {
+		return nil
+	}
+	device.Relay = relay
+	if !relay {
+		device.RelayLoad = 0
+	}
+	var err error
+	device.AllowedIPs, err = getAllowedIPs(device.IPv4TunnelIPs[0].Address, device.IPv6TunnelIPs[0].Address, device.Relay)
+	return err
+}
+
+// deviceProfileIdEquals returns true when the device profile id of an update, where the nil uuid is none, is the one
+// of the device.
+func deviceProfileIdEquals(current *uuid.UUID, requested uuid.UUID) bool {
+	if current == nil {
+		return requested == uuid.Nil
+	}
+	return *current == requested
+}
+
 func getAllowedIPs(ip string, ip6 string, relay bool) ([]string, error) {
 	var err error
 
@@ -458,7 +619,8 @@ func (api *API) CreateDevice(c *gin.Context) {
 			return NewApiResponseError(http.StatusNotFound, models.NewNotFoundError("vpc"))
 		}
 
-		res := tx.Where("public_key = ?", request.PublicKey).First(&device)
+		// devices that recently rotated their key are still found by their previous key.
+		res := tx.Where("public_key = ? OR (previous_public_key = ? AND previous_public_key_expires_at > ?)", request.PublicKey, request.PublicKey, time.Now()).First(&device)
 		if res.Error == nil {
 			return NewApiResponseError(http.StatusConflict, models.NewConflictsError(device.ID.String()))
 		}
@@ -477,6 +639,7 @@ func (api *API) CreateDevice(c *gin.Context) {
 
 		deviceId := uuid.Nil
 		regKeyID := uuid.Nil
+		var deviceProfileId *uuid.UUID
 		var err error
 		if tokenClaims != nil {
 			regKeyID, err = uuid.Parse(tokenClaims.ID)
@@ -484,6 +647,13 @@ func (api *API) CreateDevice(c *gin.Context) {
 				return NewApiResponseError(http.StatusBadRequest, fmt.Errorf("invalid reg key id"))
 			}
 
+			// devices registered with the reg key start with its device profile
+			var regKey models.RegKey
+			if err := tx.Select("device_profile_id").First(&regKey, "id = ?", regKeyID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			deviceProfileId = regKey.DeviceProfileId
+
 			// is the user token restricted to operating on a single device?
 			if tokenClaims.DeviceID != uuid.Nil {
 				err = tx.Where("id = ?", tokenClaims.DeviceID).First(&device).Error
@@ -558,22 +728,23 @@ func (api *API) CreateDevice(c *gin.Context) {
 			return err
 		}
 
-		// lets use a wg private key as the token, since it should be hard to guess.
-		deviceToken, err := wgtypes.GeneratePrivateKey()
+		deviceToken, err := newDeviceBearerToken()
 		if err != nil {
 			return err
 		}
 
+		now := time.Now()
 		device = models.Device{
 			Base: models.Base{
 				ID: deviceId,
 			},
-			OwnerID:        userId,
-			VpcID:          vpc.ID,
-			OrganizationID: vpc.OrganizationID,
-			PublicKey:      request.PublicKey,
-			Endpoints:      request.Endpoints,
-			AllowedIPs:     allowedIPs,
+			OwnerID:            userId,
+			VpcID:              vpc.ID,
+			OrganizationID:     vpc.OrganizationID,
+			PublicKey:          request.PublicKey,
+			PublicKeyCreatedAt: &now,
+			Endpoints:          request.Endpoints,
+			AllowedIPs:         allowedIPs,
 			IPv4TunnelIPs: []models.TunnelIP{
 				{
 					Address: ipamIP,
@@ -588,12 +759,21 @@ func (api *API) CreateDevice(c *gin.Context) {
 			},
 			AdvertiseCidrs:  request.AdvertiseCidrs,
 			Relay:           request.Relay,
+			RelayMode:       request.Relay,
 			SymmetricNat:    request.SymmetricNat,
 			Hostname:        request.Hostname,
 			Os:              request.Os,
 			SecurityGroupId: vpc.ID,
 			RegKeyID:        regKeyID,
-			BearerToken:     "DT:" + deviceToken.String(),
+			BearerToken:     deviceToken,
+			DeviceProfileId: deviceProfileId,
+		}
+		// clients that did not discover the behavior of their NAT send an empty one
+		if request.Nat != nil && request.Nat.Mapping != "" {
+			device.Nat = request.Nat
+		}
+		if err := applyRelayRole(tx, &device); err != nil {
+			return err
 		}
 
 		if res := tx.
@@ -680,14 +860,36 @@ func (api *API) DeleteDevice(c *gin.Context) {
 		Clauses(clause.Returning{Columns: []clause.Column{{Name: "revision"}}}).
 		Where("id = ?", device.Base.ID).
 		Updates(map[string]interface{}{
-			"bearer_token": nil,
-			"public_key":   nil,
-			"deleted_at":   gorm.DeletedAt{Time: time.Now(), Valid: true},
+			"bearer_token":        nil,
+			"public_key":          nil,
+			"previous_public_key": nil,
+			"deleted_at":          gorm.DeletedAt{Time: time.Now(), Valid: true},
 		}); res.Error != nil {
 		api.SendInternalServerError(c, res.Error)
 		return
 	}
 
+	if res := api.db.WithContext(ctx).
+		Where("device_id = ? OR peer_id = ?", device.ID, device.ID).
+		Delete(&models.DevicePeerKey{}); res.Error != nil {
+		api.SendInternalServerError(c, res.Error)
+		return
+	}
+
+	if res := api.db.WithContext(ctx).
+		Where("device_id = ?", device.ID).
+		Delete(&models.RevokedDeviceToken{}); res.Error != nil {
+		api.SendInternalServerError(c, res.Error)
+		return
+	}
+
+	if res := api.db.WithContext(ctx).
+		Where("device_id = ?", device.ID).
+		Delete(&models.DeviceTelemetry{}); res.Error != nil {
+		api.SendInternalServerError(c, res.Error)
+		return
+	}
+
 	api.signalBus.Notify(fmt.Sprintf("/devices/vpc=%s", device.VpcID.String()))
 
 	if ipamAddress != "" && orgPrefix != "" {
@@ -789,7 +991,8 @@ func (api *API) ListDevicesInVPC(c *gin.Context) {
 	}
 
 	api.sendList(c, ctx, func(db *gorm.DB) (fetchmgr.ResourceList, error) {
-		db = db.Where("vpc_id = ?", vpcId.String())
+		// revoked devices are left out so peers don't keep them configured
+		db = db.Where("vpc_id = ? AND revoked = ?", vpcId.String(), false)
 		db = FilterAndPaginateWithQuery(db, &models.Device{}, c, query, "hostname")
 
 		var items deviceList
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/handlers/fetchmgr"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+)
+
+const (
+	// how long device actions and their results are kept, unless the apiserver is configured otherwise
+	defaultDeviceActionRetention = 24 * time.Hour
+	// the largest result a device may post, a diagnostics bundle included
+	deviceActionMaxResult = 1024 * 1024
+)
+
+var errDeviceActionNotFound = errors.New("device action not found")
+
+var deviceActions = []string{
+	models.DeviceActionStun,
+	models.DeviceActionRekey,
+	models.DeviceActionFlushPeers,
+	models.DeviceActionDiagnostics,
+	models.DeviceActionLogLevel,
+}
+
+type deviceActionList []*models.DeviceAction
+
+func (d deviceActionList) Item(i int) (any, uint64, gorm.DeletedAt) {
+	item := d[i]
+	return item, item.Revision, item.DeletedAt
+}
+
+func (d deviceActionList) Len() int {
+	return len(d)
+}
+
+// CreateDeviceAction asks a device to run an action
+// @Summary      Create Device Action
+// @Id  		 CreateDeviceAction
+// @Tags         Devices
+// @Description  Asks a device to run an action: stun, rekey, flush-peers, diagnostics or log-level. The device
+// @Description  learns of the action through the vpc events, acknowledges it and posts back its result.
+// @Param        id            path      string                  true "Device ID"
+// @Param        DeviceAction  body      models.AddDeviceAction  true "Add Device Action"
+// @Accept	     json
+// @Produce      json
+// @Success      201  {object}  models.DeviceAction
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      403  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      422  {object}  models.ValidationError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/actions [post]
+func (api *API) CreateDeviceAction(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "CreateDeviceAction", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var request models.AddDeviceAction
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPayloadError(err))
+		return
+	}
+	if err := validateDeviceAction(&request); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	var action models.DeviceAction
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		tokenClaims, err := NxodusClaims(c, tx)
+		if err != nil {
+			return err
+		}
+		if tokenClaims != nil && (tokenClaims.Scope == "reg-token" || tokenClaims.Scope == "device-token") {
+			return NewApiResponseError(http.StatusForbidden, models.NewApiError(errors.New("devices can not ask for device actions")))
+		}
+
+		var device models.Device
+		result := api.DeviceIsOwnedByCurrentUser(c, tx).First(&device, "id = ?", deviceId)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return errDeviceNotFound
+		} else if result.Error != nil {
+			return result.Error
+		}
+
+		action = models.DeviceAction{
+			VpcID:    device.VpcID,
+			DeviceID: device.ID,
+			Action:   request.Action,
+			Argument: request.Argument,
+			Status:   models.DeviceActionStatusPending,
+		}
+		return tx.Create(&action).Error
+	})
+	if err != nil {
+		api.sendDeviceActionError(c, err)
+		return
+	}
+
+	api.signalBus.Notify(fmt.Sprintf("/device-actions/vpc=%s", action.VpcID.String()))
+	c.JSON(http.StatusCreated, action)
+}
+
+// ListDeviceActions lists the actions of a device
+// @Summary      List Device Actions
+// @Id  		 ListDeviceActions
+// @Tags         Devices
+// @Description  Lists the actions a device was asked to run within the retention window, with their results
+// @Param        id   path      string  true "Device ID"
+// @Accept	     json
+// @Produce      json
+// @Success      200  {object}  []models.DeviceAction
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/actions [get]
+func (api *API) ListDeviceActions(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "ListDeviceActions", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var device models.Device
+	db := api.db.WithContext(ctx)
+	result := api.DeviceIsOwnedByCurrentUser(c, db).First(&device, "id = ?", deviceId)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device"))
+		return
+	} else if result.Error != nil {
+		api.SendInternalServerError(c, result.Error)
+		return
+	}
+
+	var query Query
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err))
+		return
+	}
+
+	api.sendList(c, ctx, func(db *gorm.DB) (fetchmgr.ResourceList, error) {
+		var items deviceActionList
+		db = db.Where("device_id = ?", device.ID)
+		db = FilterAndPaginateWithQuery(db, &models.DeviceAction{}, c, query, "created_at")
+		result := db.Find(&items)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, result.Error
+		}
+		return items, nil
+	})
+}
+
+// GetDeviceAction gets an action of a device
+// @Summary      Get Device Action
+// @Id  		 GetDeviceAction
+// @Tags         Devices
+// @Description  Gets an action a device was asked to run, with its result once the device posted it
+// @Param        id         path      string  true "Device ID"
+// @Param        action_id  path      string  true "Device Action ID"
+// @Accept	     json
+// @Produce      json
+// @Success      200  {object}  models.DeviceAction
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/actions/{action_id} [get]
+func (api *API) GetDeviceAction(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "GetDeviceAction", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+		attribute.String("action_id", c.Param("action_id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+	actionId, err := uuid.Parse(c.Param("action_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("action_id"))
+		return
+	}
+
+	var device models.Device
+	db := api.db.WithContext(ctx)
+	result := api.DeviceIsOwnedByCurrentUser(c, db).First(&device, "id = ?", deviceId)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device"))
+		return
+	} else if result.Error != nil {
+		api.SendInternalServerError(c, result.Error)
+		return
+	}
+
+	var action models.DeviceAction
+	result = db.First(&action, "id = ? AND device_id = ?", actionId, device.ID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device_action"))
+		return
+	} else if result.Error != nil {
+		api.SendInternalServerError(c, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, action)
+}
+
+// UpdateDeviceAction reports the progress of a device on an action
+// @Summary      Update Device Action
+// @Id  		 UpdateDeviceAction
+// @Tags         Devices
+// @Description  Used by the device to acknowledge an action, and to post back its result once it ran
+// @Param        id            path      string                     true "Device ID"
+// @Param        action_id     path      string                     true "Device Action ID"
+// @Param        DeviceAction  body      models.UpdateDeviceAction  true "Update Device Action"
+// @Accept	     json
+// @Produce      json
+// @Success      200  {object}  models.DeviceAction
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      403  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      422  {object}  models.ValidationError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/actions/{action_id} [patch]
+func (api *API) UpdateDeviceAction(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "UpdateDeviceAction", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+		attribute.String("action_id", c.Param("action_id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+	actionId, err := uuid.Parse(c.Param("action_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("action_id"))
+		return
+	}
+
+	var request models.UpdateDeviceAction
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPayloadError(err))
+		return
+	}
+	switch request.Status {
+	case models.DeviceActionStatusAcknowledged, models.DeviceActionStatusSucceeded, models.DeviceActionStatusFailed:
+	default:
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("status", "must be one of acknowledged, succeeded or failed"))
+		return
+	}
+	if len(request.Result) > deviceActionMaxResult {
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("result", fmt.Sprintf("must be at most %d bytes", deviceActionMaxResult)))
+		return
+	}
+
+	var action models.DeviceAction
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		device, err := api.actingDevice(c, tx, deviceId)
+		if err != nil {
+			return err
+		}
+
+		result := tx.First(&action, "id = ? AND device_id = ?", actionId, device.ID)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return errDeviceActionNotFound
+		} else if result.Error != nil {
+			return result.Error
+		}
+		if action.CompletedAt != nil {
+			return NewApiResponseError(http.StatusBadRequest, models.NewApiError(errors.New("the device action already completed")))
+		}
+
+		now := time.Now()
+		if action.AcknowledgedAt == nil {
+			action.AcknowledgedAt = &now
+		}
+		if request.Status != models.DeviceActionStatusAcknowledged {
+			action.CompletedAt = &now
+			action.Result = request.Result
+		}
+		action.Status = request.Status
+		return tx.Save(&action).Error
+	})
+	if err != nil {
+		api.sendDeviceActionError(c, err)
+		return
+	}
+
+	api.signalBus.Notify(fmt.Sprintf("/device-actions/vpc=%s", action.VpcID.String()))
+	c.JSON(http.StatusOK, action)
+}
+
+// ListDeviceActionsInVPC lists the device actions in a VPC
+// @Summary      List Device Actions in a VPC
+// @Description  Lists the actions the devices in a VPC were asked to run, without their results
+// @Id  		 ListDeviceActionsInVPC
+// @Tags         VPC
+// @Accepts		 json
+// @Produce      json
+// @Param		 gt_revision       query     uint64 false "greater than revision"
+// @Param        id                path      string  true "VPC ID"
+// @Success      200  {object}  []models.DeviceAction
+// @Failure		 401  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/vpcs/{id}/device-actions [get]
+func (api *API) ListDeviceActionsInVPC(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "ListDeviceActionsInVPC",
+		trace.WithAttributes(
+			attribute.String("vpc_id", c.Param("id")),
+		))
+	defer span.End()
+
+	vpcId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+	var vpc models.VPC
+	db := api.db.WithContext(ctx)
+	result := api.VPCIsReadableByCurrentUser(c, db).
+		First(&vpc, "id = ?", vpcId.String())
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("vpc"))
+		} else {
+			api.SendInternalServerError(c, result.Error)
+		}
+		return
+	}
+
+	var query Query
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err))
+		return
+	}
+
+	api.sendList(c, ctx, func(db *gorm.DB) (fetchmgr.ResourceList, error) {
+		var items deviceActionList
+		db = db.Where("vpc_id = ?", vpcId.String())
+		db = FilterAndPaginateWithQuery(db, &models.DeviceAction{}, c, query, "id")
+		result := db.Find(&items)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, result.Error
+		}
+		hideDeviceActionResults(items)
+		return items, nil
+	})
+}
+
+// ExpireDeviceActions deletes the device actions that are older than the retention window.
+func (api *API) ExpireDeviceActions(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "ExpireDeviceActions")
+	defer span.End()
+
+	retention := api.DeviceActionRetention
+	if retention <= 0 {
+		retention = defaultDeviceActionRetention
+	}
+	cutoff := time.Now().Add(-retention)
+	db := api.db.WithContext(ctx)
+
+	var vpcIds []uuid.UUID
+	result := db.Model(&models.DeviceAction{}).Where("created_at < ?", cutoff).Distinct().Pluck("vpc_id", &vpcIds)
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(vpcIds) == 0 {
+		return nil
+	}
+	if result := db.Where("created_at < ?", cutoff).Delete(&models.DeviceAction{}); result.Error != nil {
+		return result.Error
+	}
+	for _, vpcId := range vpcIds {
+		api.signalBus.Notify(fmt.Sprintf("/device-actions/vpc=%s", vpcId.String()))
+	}
+	return nil
+}
+
+// hideDeviceActionResults leaves the results out of the actions that every device of the vpc can list, only the
+// owner of a device retrieves them.
+func hideDeviceActionResults(items deviceActionList) {
+	for _, item := range items {
+		item.Result = ""
+	}
+}
+
+func (api *API) sendDeviceActionError(c *gin.Context, err error) {
+	var apiResponseError *ApiResponseError
+	if errors.Is(err, errDeviceNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device"))
+	} else if errors.Is(err, errDeviceActionNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device_action"))
+	} else if errors.As(err, &apiResponseError) {
+		c.JSON(apiResponseError.Status, apiResponseError.Body)
+	} else {
+		api.SendInternalServerError(c, err)
+	}
+}
+
+// validateDeviceAction returns a validation error unless the action is known and its argument fits it, the log
+// level defaults to debug.
+func validateDeviceAction(request *models.AddDeviceAction) *models.ValidationError {
+	if !slices.Contains(deviceActions, request.Action) {
+		validationErr := models.NewFieldValidationError("action", fmt.Sprintf("must be one of %v", deviceActions))
+		return &validationErr
+	}
+	if request.Action != models.DeviceActionLogLevel {
+		if request.Argument != "" {
+			validationErr := models.NewFieldValidationError("argument", fmt.Sprintf("the %s action takes no argument", request.Action))
+			return &validationErr
+		}
+		return nil
+	}
+	if request.Argument == "" {
+		request.Argument = zapcore.DebugLevel.String()
+	}
+	if _, err := zapcore.ParseLevel(request.Argument); err != nil {
+		validationErr := models.NewFieldValidationError("argument", fmt.Sprintf("%s is not a log level", request.Argument))
+		return &validationErr
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func (suite *HandlerTestSuite) TestDeviceAction() {
+	require := suite.Require()
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(err)
+	reqBody, err := json.Marshal(models.AddDevice{
+		VpcID:     suite.testUserID,
+		PublicKey: key.PublicKey().String(),
+	})
+	require.NoError(err)
+	_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var device models.Device
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+
+	create := func(request models.AddDeviceAction) (int, []byte) {
+		reqBody, err := json.Marshal(request)
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/:id/actions", fmt.Sprintf("/%s/actions", device.ID), suite.api.CreateDeviceAction, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		return res.Code, res.Body.Bytes()
+	}
+	update := func(action models.DeviceAction, request models.UpdateDeviceAction) (int, []byte) {
+		reqBody, err := json.Marshal(request)
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPatch, "/:id/actions/:action_id", fmt.Sprintf("/%s/actions/%s", device.ID, action.ID), suite.api.UpdateDeviceAction, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		return res.Code, res.Body.Bytes()
+	}
+
+	code, body := create(models.AddDeviceAction{Action: "reboot"})
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.Contains(string(body), `"field":"action"`)
+
+	code, body = create(models.AddDeviceAction{Action: models.DeviceActionLogLevel, Argument: "loud"})
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.JSONEq(`{"error":"loud is not a log level","field":"argument"}`, string(body))
+
+	// the log level defaults to debug
+	code, body = create(models.AddDeviceAction{Action: models.DeviceActionLogLevel})
+	require.Equal(http.StatusCreated, code, "HTTP error: %s", string(body))
+	var action models.DeviceAction
+	require.NoError(json.Unmarshal(body, &action))
+	require.Equal(device.ID, action.DeviceID)
+	require.Equal(device.VpcID, action.VpcID)
+	require.Equal("debug", action.Argument)
+	require.Equal(models.DeviceActionStatusPending, action.Status)
+
+	code, body = update(action, models.UpdateDeviceAction{Status: models.DeviceActionStatusPending})
+	require.Equal(http.StatusUnprocessableEntity, code, "HTTP error: %s", string(body))
+
+	code, body = update(action, models.UpdateDeviceAction{Status: models.DeviceActionStatusAcknowledged})
+	require.Equal(http.StatusOK, code, "HTTP error: %s", string(body))
+	var acknowledged models.DeviceAction
+	require.NoError(json.Unmarshal(body, &acknowledged))
+	require.NotNil(acknowledged.AcknowledgedAt)
+	require.Nil(acknowledged.CompletedAt)
+
+	code, body = update(action, models.UpdateDeviceAction{Status: models.DeviceActionStatusSucceeded, Result: "log level set to debug"})
+	require.Equal(http.StatusOK, code, "HTTP error: %s", string(body))
+	var completed models.DeviceAction
+	require.NoError(json.Unmarshal(body, &completed))
+	require.NotNil(completed.CompletedAt)
+
+	// a completed action keeps its result
+	code, _ = update(action, models.UpdateDeviceAction{Status: models.DeviceActionStatusFailed})
+	require.Equal(http.StatusBadRequest, code)
+
+	_, res, err = suite.ServeRequest(http.MethodGet, "/:id/actions/:action_id", fmt.Sprintf("/%s/actions/%s", device.ID, action.ID), suite.api.GetDeviceAction, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	var fetched models.DeviceAction
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &fetched))
+	require.Equal(models.DeviceActionStatusSucceeded, fetched.Status)
+	require.Equal("log level set to debug", fetched.Result)
+
+	// the results are left out of the actions listed for the vpc
+	_, res, err = suite.ServeRequest(http.MethodGet, "/:id/device-actions", fmt.Sprintf("/%s/device-actions", device.VpcID), suite.api.ListDeviceActionsInVPC, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	var listed []models.DeviceAction
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &listed))
+	require.Len(listed, 1)
+	require.Empty(listed[0].Result)
+
+	// actions past the retention window are deleted
+	require.NoError(suite.api.db.Model(&models.DeviceAction{}).Where("id = ?", action.ID).
+		Update("created_at", time.Now().Add(-defaultDeviceActionRetention-time.Minute)).Error)
+	require.NoError(suite.api.ExpireDeviceActions(context.Background()))
+	_, res, err = suite.ServeRequest(http.MethodGet, "/:id/actions", fmt.Sprintf("/%s/actions", device.ID), suite.api.ListDeviceActions, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.JSONEq(`[]`, res.Body.String())
+}
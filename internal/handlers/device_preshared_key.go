@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"github.com/nexodus-io/nexodus/internal/wgcrypto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// presharedKeyRotationInterval is how long a preshared key is used by a pair of devices before it is replaced.
+const presharedKeyRotationInterval = 24 * time.Hour
+
+// devicePeerKeyPair orders the ids of a pair of devices the way they are stored in a DevicePeerKey
+func devicePeerKeyPair(a, b uuid.UUID) (uuid.UUID, uuid.UUID) {
+	if a.String() < b.String() {
+		return a, b
+	}
+	return b, a
+}
+
+// ListDevicePresharedKeys lists the preshared keys a device should use with its peers
+// @Summary      List Device Preshared Keys
+// @Id  		 ListDevicePresharedKeys
+// @Tags         Devices
+// @Description  Lists the WireGuard preshared keys a device should use with each of its peers, for the current
+// @Description  and the next rotation period. The keys are sealed to the public key of the device.
+// @Param        id   path      string  true "Device ID"
+// @Accept	     json
+// @Produce      json
+// @Success      200  {object}  []models.PeerPresharedKey
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      403  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/preshared-keys [get]
+func (api *API) ListDevicePresharedKeys(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "ListDevicePresharedKeys", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	results := []models.PeerPresharedKey{}
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		device, err := api.actingDevice(c, tx, deviceId)
+		if err != nil {
+			return err
+		}
+
+		var vpc models.VPC
+		if result := tx.First(&vpc, "id = ?", device.VpcID); result.Error != nil {
+			return result.Error
+		}
+		if !vpc.PresharedKeys {
+			return nil
+		}
+
+		publicKey, err := wgtypes.ParseKey(device.PublicKey)
+		if err != nil {
+			return NewApiResponseError(http.StatusBadRequest, models.NewFieldValidationError("public_key", "the device public key can not be used to seal keys"))
+		}
+
+		var peerIds []uuid.UUID
+		if result := tx.Model(&models.Device{}).
+			Where("vpc_id = ? AND id <> ?", device.VpcID, device.ID).
+			Pluck("id", &peerIds); result.Error != nil {
+			return result.Error
+		}
+
+		interval := int64(presharedKeyRotationInterval / time.Second)
+		epoch := time.Now().Unix() / interval
+		epochs := []int64{epoch, epoch + 1}
+
+		// drop the keys of previous epochs, they are not used anymore
+		if result := tx.
+			Where("(device_id = ? OR peer_id = ?) AND epoch < ?", device.ID, device.ID, epoch).
+			Delete(&models.DevicePeerKey{}); result.Error != nil {
+			return result.Error
+		}
+
+		findKeys := func() ([]models.DevicePeerKey, error) {
+			var keys []models.DevicePeerKey
+			result := tx.
+				Where("(device_id = ? OR peer_id = ?) AND epoch IN ?", device.ID, device.ID, epochs).
+				Order("epoch").
+				Find(&keys)
+			return keys, result.Error
+		}
+		keys, err := findKeys()
+		if err != nil {
+			return err
+		}
+
+		// generate the keys that don't exist yet, a peer fetching its keys concurrently may win the race to create them.
+		existing := map[string]struct{}{}
+		for _, k := range keys {
+			existing[fmt.Sprintf("%s/%s/%d", k.DeviceID, k.PeerID, k.Epoch)] = struct{}{}
+		}
+		var newKeys []models.DevicePeerKey
+		for _, peerId := range peerIds {
+			first, second := devicePeerKeyPair(device.ID, peerId)
+			for _, e := range epochs {
+				if _, ok := existing[fmt.Sprintf("%s/%s/%d", first, second, e)]; ok {
+					continue
+				}
+				key, err := wgtypes.GenerateKey()
+				if err != nil {
+					return err
+				}
+				newKeys = append(newKeys, models.DevicePeerKey{
+					DeviceID: first,
+					PeerID:   second,
+					Epoch:    e,
+					VpcID:    device.VpcID,
+					Key:      key.String(),
+				})
+			}
+		}
+		if len(newKeys) > 0 {
+			if result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newKeys); result.Error != nil {
+				return result.Error
+			}
+			if keys, err = findKeys(); err != nil {
+				return err
+			}
+		}
+
+		for _, k := range keys {
+			peerId := k.PeerID
+			if peerId == device.ID {
+				peerId = k.DeviceID
+			}
+			key, err := wgtypes.ParseKey(k.Key)
+			if err != nil {
+				return err
+			}
+			sealed, err := wgcrypto.SealV1(publicKey[:], key[:])
+			if err != nil {
+				return fmt.Errorf("failed to seal the preshared key: %w", err)
+			}
+			results = append(results, models.PeerPresharedKey{
+				PeerID:    peerId,
+				SealedKey: sealed.String(),
+				StartsAt:  time.Unix(k.Epoch*interval, 0).UTC(),
+				ExpiresAt: time.Unix((k.Epoch+1)*interval, 0).UTC(),
+			})
+		}
+		return nil
+	})
+
+	if err != nil {
+		var apiResponseError *ApiResponseError
+		if errors.Is(err, errDeviceNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("device"))
+		} else if errors.As(err, &apiResponseError) {
+			c.JSON(apiResponseError.Status, apiResponseError.Body)
+		} else {
+			api.SendInternalServerError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
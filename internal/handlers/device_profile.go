@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/handlers/fetchmgr"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"github.com/nexodus-io/nexodus/internal/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errDeviceProfileNotFound = errors.New("device profile not found")
+
+type deviceProfileList []*models.DeviceProfile
+
+func (d deviceProfileList) Item(i int) (any, uint64, gorm.DeletedAt) {
+	item := d[i]
+	return item, item.Revision, item.DeletedAt
+}
+
+func (d deviceProfileList) Len() int {
+	return len(d)
+}
+
+// DeviceProfileIsReadableByCurrentUser limits a query to the device profiles of the organizations of the user, like
+// the vpcs of the profiles.
+func (api *API) DeviceProfileIsReadableByCurrentUser(c *gin.Context, db *gorm.DB) *gorm.DB {
+	return api.VPCIsReadableByCurrentUser(c, db)
+}
+
+// DeviceProfileIsWriteableByCurrentUser limits a query to the device profiles of the organizations the user owns.
+func (api *API) DeviceProfileIsWriteableByCurrentUser(c *gin.Context, db *gorm.DB) *gorm.DB {
+	return api.VPCIsOwnedByCurrentUser(c, db)
+}
+
+// ListDeviceProfiles lists all device profiles
+// @Summary      List Device Profiles
+// @Description  Lists all device profiles
+// @Id  		 ListDeviceProfiles
+// @Tags         DeviceProfile
+// @Accepts		 json
+// @Produce      json
+// @Param		 gt_revision       query     uint64 false "greater than revision"
+// @Success      200  {object}  []models.DeviceProfile
+// @Failure		 401  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/device-profiles [get]
+func (api *API) ListDeviceProfiles(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "ListDeviceProfiles")
+	defer span.End()
+
+	var query Query
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err))
+		return
+	}
+
+	api.sendList(c, ctx, func(db *gorm.DB) (fetchmgr.ResourceList, error) {
+		var items deviceProfileList
+		db = api.DeviceProfileIsReadableByCurrentUser(c, db)
+		db = FilterAndPaginateWithQuery(db, &models.DeviceProfile{}, c, query, "description")
+		result := db.Find(&items)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, result.Error
+		}
+		return items, nil
+	})
+}
+
+// ListDeviceProfilesInVPC lists the device profiles in a VPC
+// @Summary      List Device Profiles in a VPC
+// @Description  Lists the device profiles in a VPC
+// @Id  		 ListDeviceProfilesInVPC
+// @Tags         VPC
+// @Accepts		 json
+// @Produce      json
+// @Param		 gt_revision       query     uint64 false "greater than revision"
+// @Param        id                path      string  true "VPC ID"
+// @Success      200  {object}  []models.DeviceProfile
+// @Failure		 401  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/vpcs/{id}/device-profiles [get]
+func (api *API) ListDeviceProfilesInVPC(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "ListDeviceProfilesInVPC",
+		trace.WithAttributes(
+			attribute.String("vpc_id", c.Param("id")),
+		))
+	defer span.End()
+
+	vpcId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+	var vpc models.VPC
+	db := api.db.WithContext(ctx)
+	result := api.VPCIsReadableByCurrentUser(c, db).
+		First(&vpc, "id = ?", vpcId.String())
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("vpc"))
+		} else {
+			api.SendInternalServerError(c, result.Error)
+		}
+		return
+	}
+
+	var query Query
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err))
+		return
+	}
+
+	api.sendList(c, ctx, func(db *gorm.DB) (fetchmgr.ResourceList, error) {
+		var items deviceProfileList
+		db = db.Where("vpc_id = ?", vpcId.String())
+		db = FilterAndPaginateWithQuery(db, &models.DeviceProfile{}, c, query, "id")
+		result := db.Find(&items)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, result.Error
+		}
+		return items, nil
+	})
+}
+
+// GetDeviceProfile gets a device profile by ID
+// @Summary      Get Device Profile
+// @Description  Gets a device profile by ID
+// @Id  		 GetDeviceProfile
+// @Tags         DeviceProfile
+// @Accepts		 json
+// @Produce      json
+// @Param        id   path      string  true "Device Profile ID"
+// @Success      200  {object}  models.DeviceProfile
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/device-profiles/{id} [get]
+func (api *API) GetDeviceProfile(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "GetDeviceProfile", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+	k, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var profile models.DeviceProfile
+	result := api.DeviceProfileIsReadableByCurrentUser(c, api.db.WithContext(ctx)).
+		First(&profile, "id = ?", k)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device_profile"))
+		return
+	} else if result.Error != nil {
+		api.SendInternalServerError(c, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// CreateDeviceProfile handles adding a new device profile
+// @Summary      Add Device Profile
+// @Id  		 CreateDeviceProfile
+// @Tags         DeviceProfile
+// @Description  Adds a new device profile, the settings of a profile are applied by the nexd of the devices it
+// @Description  is assigned to while they run.
+// @Accepts		 json
+// @Produce      json
+// @Param        DeviceProfile   body   models.AddDeviceProfile  true "Add Device Profile"
+// @Success      201  {object}  models.DeviceProfile
+// @Failure      400  {object}  models.BaseError
+// @Failure      401  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      422  {object}  models.ValidationError
+// @Failure      429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/device-profiles [post]
+func (api *API) CreateDeviceProfile(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "CreateDeviceProfile")
+	defer span.End()
+
+	var request models.AddDeviceProfile
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPayloadError(err))
+		return
+	}
+	if request.VpcID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, models.NewFieldNotPresentError("vpc_id"))
+		return
+	}
+	if err := validateDeviceProfileSettings(request.Settings); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	var profile models.DeviceProfile
+	err := api.transaction(ctx, func(tx *gorm.DB) error {
+		var vpc models.VPC
+		if res := api.VPCIsOwnedByCurrentUser(c, tx).
+			First(&vpc, "id = ?", request.VpcID); res.Error != nil {
+			return NewApiResponseError(http.StatusNotFound, models.NewNotFoundError("vpc"))
+		}
+
+		profile = models.DeviceProfile{
+			VpcID:          vpc.ID,
+			OrganizationID: vpc.OrganizationID,
+			Description:    request.Description,
+			Settings:       request.Settings,
+		}
+		if res := tx.
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "revision"}}}).
+			Create(&profile); res.Error != nil {
+			return res.Error
+		}
+		span.SetAttributes(attribute.String("id", profile.ID.String()))
+		return nil
+	})
+	if err != nil {
+		api.sendDeviceProfileError(c, err)
+		return
+	}
+
+	api.signalBus.Notify(fmt.Sprintf("/device-profiles/vpc=%s", profile.VpcID.String()))
+	c.JSON(http.StatusCreated, profile)
+}
+
+// UpdateDeviceProfile updates a device profile
+// @Summary      Update Device Profile
+// @Description  Updates a device profile by ID, the devices it is assigned to apply the change while they run
+// @Id           UpdateDeviceProfile
+// @Tags         DeviceProfile
+// @Accepts      json
+// @Produce      json
+// @Param        id path      string  true "Device Profile ID"
+// @Param        update body       models.UpdateDeviceProfile true "Device Profile Update"
+// @Success      200  {object}     models.DeviceProfile
+// @Failure      400  {object}     models.BaseError
+// @Failure      401  {object}     models.BaseError
+// @Failure      404  {object}     models.BaseError
+// @Failure      422  {object}     models.ValidationError
+// @Failure      429  {object}     models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/device-profiles/{id} [patch]
+func (api *API) UpdateDeviceProfile(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "UpdateDeviceProfile", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+
+	k, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var request models.UpdateDeviceProfile
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPayloadError(err))
+		return
+	}
+	if request.Settings != nil {
+		if err := validateDeviceProfileSettings(*request.Settings); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	var profile models.DeviceProfile
+	devicesChanged := false
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		result := api.DeviceProfileIsWriteableByCurrentUser(c, tx).
+			First(&profile, "id = ?", k)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return errDeviceProfileNotFound
+		} else if result.Error != nil {
+			return result.Error
+		}
+
+		if request.Description != nil {
+			profile.Description = *request.Description
+		}
+		if request.Settings != nil {
+			profile.Settings = *request.Settings
+		}
+
+		if res := tx.
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "revision"}}}).
+			Save(&profile); res.Error != nil {
+			return res.Error
+		}
+		changed, err := updateDeviceProfileDevices(tx, profile, false)
+		devicesChanged = changed
+		return err
+	})
+	if err != nil {
+		api.sendDeviceProfileError(c, err)
+		return
+	}
+
+	if devicesChanged {
+		api.signalBus.Notify(fmt.Sprintf("/devices/vpc=%s", profile.VpcID.String()))
+	}
+	api.signalBus.Notify(fmt.Sprintf("/device-profiles/vpc=%s", profile.VpcID.String()))
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteDeviceProfile handles deleting a device profile
+// @Summary      Delete Device Profile
+// @Description  Deletes a device profile, the devices and registration keys it was assigned to are left without one
+// @Id 			 DeleteDeviceProfile
+// @Tags         DeviceProfile
+// @Accepts		 json
+// @Produce      json
+// @Param        id   path      string  true "Device Profile ID"
+// @Success      200  {object}  models.DeviceProfile
+// @Failure      400  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/device-profiles/{id} [delete]
+func (api *API) DeleteDeviceProfile(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "DeleteDeviceProfile", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+
+	k, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var profile models.DeviceProfile
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		result := api.DeviceProfileIsWriteableByCurrentUser(c, tx).
+			First(&profile, "id = ?", k)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return errDeviceProfileNotFound
+		} else if result.Error != nil {
+			return result.Error
+		}
+
+		if _, err := updateDeviceProfileDevices(tx, profile, true); err != nil {
+			return err
+		}
+		if res := tx.Model(&models.RegKey{}).
+			Where("device_profile_id = ?", profile.ID).
+			Update("device_profile_id", nil); res.Error != nil {
+			return res.Error
+		}
+		return tx.Delete(&profile).Error
+	})
+	if err != nil {
+		api.sendDeviceProfileError(c, err)
+		return
+	}
+
+	api.signalBus.Notify(fmt.Sprintf("/devices/vpc=%s", profile.VpcID.String()))
+	api.signalBus.Notify(fmt.Sprintf("/device-profiles/vpc=%s", profile.VpcID.String()))
+	c.JSON(http.StatusOK, profile)
+}
+
+// updateDeviceProfileDevices applies the relay role of a profile to the devices it is assigned to, or removes it from
+// them when unassign is set. It returns true when a device changed.
+func updateDeviceProfileDevices(tx *gorm.DB, profile models.DeviceProfile, unassign bool) (bool, error) {
+	var devices []models.Device
+	if res := tx.Where("vpc_id = ? AND device_profile_id = ?", profile.VpcID, profile.ID).Find(&devices); res.Error != nil {
+		return false, res.Error
+	}
+	changed := false
+	for i := range devices {
+		device := &devices[i]
+		relay := device.Relay
+		if unassign {
+			device.DeviceProfileId = nil
+		}
+		if err := applyRelayRole(tx, device); err != nil {
+			return false, err
+		}
+		if !unassign && device.Relay == relay {
+			continue
+		}
+		if res := tx.Save(device); res.Error != nil {
+			return false, res.Error
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+func (api *API) sendDeviceProfileError(c *gin.Context, err error) {
+	var apiResponseError *ApiResponseError
+	if errors.Is(err, errDeviceProfileNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device_profile"))
+	} else if errors.As(err, &apiResponseError) {
+		c.JSON(apiResponseError.Status, apiResponseError.Body)
+	} else {
+		api.SendInternalServerError(c, err)
+	}
+}
+
+// validateDeviceProfileSettings returns a validation error for the first setting nexd would not be able to apply.
+func validateDeviceProfileSettings(settings models.DeviceProfileSettings) *models.ValidationError {
+	invalid := func(field, message string) *models.ValidationError {
+		validationErr := models.NewFieldValidationError(field, message)
+		return &validationErr
+	}
+	for _, rule := range settings.Ingress {
+		if err := validateProxyRule(rule, ingressProxyProtocols); err != nil {
+			return invalid("ingress", fmt.Sprintf("invalid proxy rule %s: %v", rule, err))
+		}
+	}
+	for _, rule := range settings.Egress {
+		if err := validateProxyRule(rule, egressProxyProtocols); err != nil {
+			return invalid("egress", fmt.Sprintf("invalid proxy rule %s: %v", rule, err))
+		}
+	}
+	for _, cidr := range settings.AdvertiseCidrs {
+		if !util.IsValidPrefix(cidr) {
+			return invalid("advertise_cidrs", fmt.Sprintf("%s is not a valid CIDR", cidr))
+		}
+	}
+	if settings.LogLevel != "" {
+		if _, err := zapcore.ParseLevel(settings.LogLevel); err != nil {
+			return invalid("log_level", err.Error())
+		}
+	}
+	if settings.Keepalive != nil && (*settings.Keepalive < 0 || *settings.Keepalive > 65535) {
+		return invalid("keepalive", "must be between 0 and 65535 seconds")
+	}
+	return nil
+}
+
+// the options that may follow the destination of a proxy rule, nexd checks their values
+var proxyRuleOptions = []string{"weight", "strategy", "check", "check-path", "check-interval", "max-fails", "fail-timeout", "send-proxy", "accept-proxy", "host", "path", "set-header"}
+
+// the protocols of the proxy rules, the http reverse proxy only serves ingress rules
+var (
+	ingressProxyProtocols = []string{"tcp", "udp", "http"}
+	egressProxyProtocols  = []string{"tcp", "udp"}
+)
+
+// validateProxyRule checks a protocol:port:destination_ip:destination_port[,key=value...] proxy rule like nexd parses it.
+func validateProxyRule(rule string, protocols []string) error {
+	options := strings.Split(rule, ",")
+	rule = options[0]
+	for _, option := range options[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		if !slices.Contains(proxyRuleOptions, key) || value == "" {
+			return fmt.Errorf("invalid option %s, must be key=value with a key of %v", option, proxyRuleOptions)
+		}
+	}
+	protocol, rest, _ := strings.Cut(rule, ":")
+	port, destination, _ := strings.Cut(rest, ":")
+	if !slices.Contains(protocols, strings.ToLower(protocol)) {
+		return fmt.Errorf("the protocol must be one of %s", strings.Join(protocols, ", "))
+	}
+	host, destinationPort, err := net.SplitHostPort(destination)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("the destination host cannot be empty")
+	}
+	for _, p := range []string{port, destinationPort} {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %s", p)
+		}
+	}
+	return nil
+}
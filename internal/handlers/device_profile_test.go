@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func (suite *HandlerTestSuite) TestDeviceProfile() {
+	require := suite.Require()
+
+	create := func(request models.AddDeviceProfile) (int, []byte) {
+		reqBody, err := json.Marshal(request)
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDeviceProfile, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		return res.Code, res.Body.Bytes()
+	}
+
+	code, body := create(models.AddDeviceProfile{
+		VpcID:    suite.testUserID,
+		Settings: models.DeviceProfileSettings{Ingress: []string{"tcp:443:10.10.0.5"}},
+	})
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.Contains(string(body), `"field":"ingress"`)
+
+	code, body = create(models.AddDeviceProfile{
+		VpcID:    suite.testUserID,
+		Settings: models.DeviceProfileSettings{Ingress: []string{"tcp:443:10.10.0.5:8443,retries=3"}},
+	})
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.Contains(string(body), `"field":"ingress"`)
+
+	// the http reverse proxy only serves ingress rules
+	code, body = create(models.AddDeviceProfile{
+		VpcID:    suite.testUserID,
+		Settings: models.DeviceProfileSettings{Egress: []string{"http:80:10.10.0.5:8080"}},
+	})
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.Contains(string(body), `"field":"egress"`)
+
+	keepalive := 25
+	code, body = create(models.AddDeviceProfile{
+		VpcID:       suite.testUserID,
+		Description: "edge boxes",
+		Settings: models.DeviceProfileSettings{
+			Ingress:   []string{"tcp:443:10.10.0.5:8443", "tcp:443:10.10.0.6:8443,weight=2,check=tcp,send-proxy=v2", "http:80:10.10.0.7:8080,host=wiki.example.com,path=/api"},
+			LogLevel:  "debug",
+			Keepalive: &keepalive,
+		},
+	})
+	require.Equal(http.StatusCreated, code, "HTTP error: %s", string(body))
+	var profile models.DeviceProfile
+	require.NoError(json.Unmarshal(body, &profile))
+	require.Equal(suite.testUserID, profile.VpcID)
+	require.Equal(25, *profile.Settings.Keepalive)
+
+	// the devices registered with a reg key start with its profile
+	reqBody, err := json.Marshal(models.AddRegKey{VpcID: suite.testUserID, DeviceProfileId: &profile.ID})
+	require.NoError(err)
+	_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateRegKey, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var regKey models.RegKey
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &regKey))
+	require.Equal(profile.ID, *regKey.DeviceProfileId)
+
+	// a profile is assigned to a device, and removed from it with the nil uuid
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(err)
+	reqBody, err = json.Marshal(models.AddDevice{VpcID: suite.testUserID, PublicKey: key.PublicKey().String()})
+	require.NoError(err)
+	_, res, err = suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var device models.Device
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+	require.Nil(device.DeviceProfileId)
+
+	updateDevice := func(profileId uuid.UUID) models.Device {
+		reqBody, err := json.Marshal(models.UpdateDevice{DeviceProfileId: &profileId})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPatch, "/:id", fmt.Sprintf("/%s", device.ID), suite.api.UpdateDevice, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+		var updated models.Device
+		require.NoError(json.Unmarshal(res.Body.Bytes(), &updated))
+		return updated
+	}
+	require.Equal(profile.ID, *updateDevice(profile.ID).DeviceProfileId)
+	require.Nil(updateDevice(uuid.Nil).DeviceProfileId)
+
+	// updating the settings replaces them
+	reqBody, err = json.Marshal(models.UpdateDeviceProfile{Settings: &models.DeviceProfileSettings{LogLevel: "info"}})
+	require.NoError(err)
+	_, res, err = suite.ServeRequest(http.MethodPatch, "/:id", fmt.Sprintf("/%s", profile.ID), suite.api.UpdateDeviceProfile, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	var updated models.DeviceProfile
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &updated))
+	require.Equal(models.DeviceProfileSettings{LogLevel: "info"}, updated.Settings)
+	require.Equal("edge boxes", updated.Description)
+
+	// deleting the profile removes it from the reg keys it was assigned to
+	_, res, err = suite.ServeRequest(http.MethodDelete, "/:id", fmt.Sprintf("/%s", profile.ID), suite.api.DeleteDeviceProfile, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	_, res, err = suite.ServeRequest(http.MethodGet, "/:id", fmt.Sprintf("/%s", regKey.ID), suite.api.GetRegKey, nil)
+	require.NoError(err)
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &regKey))
+	require.Nil(regKey.DeviceProfileId)
+}
+
+func (suite *HandlerTestSuite) TestDeviceProfileRelayRole() {
+	require := suite.Require()
+
+	relay := true
+	reqBody, err := json.Marshal(models.AddDeviceProfile{VpcID: suite.testUserID, Settings: models.DeviceProfileSettings{Relay: &relay}})
+	require.NoError(err)
+	_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDeviceProfile, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var profile models.DeviceProfile
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &profile))
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(err)
+	reqBody, err = json.Marshal(models.AddDevice{VpcID: suite.testUserID, PublicKey: key.PublicKey().String(), Os: "linux"})
+	require.NoError(err)
+	_, res, err = suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var device models.Device
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+	require.False(device.Relay)
+
+	updateDevice := func(update models.UpdateDevice, claims map[string]interface{}) *httptest.ResponseRecorder {
+		reqBody, err := json.Marshal(update)
+		require.NoError(err)
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(gin.AuthUserKey, suite.testUserID)
+			if claims != nil {
+				c.Set("_nexodus.Claims", claims)
+			}
+			c.Next()
+		})
+		r.PATCH("/:id", suite.api.UpdateDevice)
+		req, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("/%s", device.ID), bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		return res
+	}
+	stored := func() models.Device {
+		var stored models.Device
+		require.NoError(suite.api.db.First(&stored, "id = ?", device.ID).Error)
+		return stored
+	}
+
+	// the device may neither pick its profile nor make itself a relay
+	deviceClaims := map[string]interface{}{"scope": "device-token", "jti": device.ID.String()}
+	res = updateDevice(models.UpdateDevice{DeviceProfileId: &profile.ID}, deviceClaims)
+	require.Equal(http.StatusForbidden, res.Code)
+	require.Contains(res.Body.String(), "only users can change the device profile of a device")
+	res = updateDevice(models.UpdateDevice{Relay: &relay}, deviceClaims)
+	require.Equal(http.StatusForbidden, res.Code)
+	require.Contains(res.Body.String(), "only users can change the relay role of a device")
+	require.False(stored().Relay)
+
+	// the device takes on the relay role of the profile a user assigns to it
+	res = updateDevice(models.UpdateDevice{DeviceProfileId: &profile.ID}, nil)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.True(stored().Relay)
+	require.Equal([]string{device.IPv4TunnelIPs[0].Address, device.IPv6TunnelIPs[0].Address}, []string(stored().AllowedIPs))
+
+	// and loses it when the profile drops it
+	relay = false
+	reqBody, err = json.Marshal(models.UpdateDeviceProfile{Settings: &models.DeviceProfileSettings{Relay: &relay}})
+	require.NoError(err)
+	_, res, err = suite.ServeRequest(http.MethodPatch, "/:id", fmt.Sprintf("/%s", profile.ID), suite.api.UpdateDeviceProfile, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.False(stored().Relay)
+	require.Equal(device.AllowedIPs, stored().AllowedIPs)
+
+	// a device a user made a relay stays one without the relay role of its profile
+	relay = true
+	res = updateDevice(models.UpdateDevice{Relay: &relay}, nil)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	_, res, err = suite.ServeRequest(http.MethodDelete, "/:id", fmt.Sprintf("/%s", profile.ID), suite.api.DeleteDeviceProfile, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.True(stored().Relay)
+	require.Nil(stored().DeviceProfileId)
+}
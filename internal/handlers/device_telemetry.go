@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// how long the telemetry reported by a device is used, nexd reports it every minute
+	deviceTelemetryStaleAfter = 3 * time.Minute
+	// the most peers a device may report on
+	deviceTelemetryMaxPeers = 10000
+)
+
+// the order the statuses take precedence in when the devices of a pair report different ones
+var connectivityPrecedence = []string{
+	models.ConnectivityFailing,
+	models.ConnectivityRelayed,
+	models.ConnectivityDirect,
+	models.ConnectivityIdle,
+}
+
+// ReportDeviceTelemetry stores the status a device reports about its peers
+// @Summary      Report Device Telemetry
+// @Id  		 ReportDeviceTelemetry
+// @Tags         Devices
+// @Description  Used by the device to report the status of its tunnels to its peers, it replaces the previous report
+// @Param        id         path      string                        true "Device ID"
+// @Param        Telemetry  body      models.ReportDeviceTelemetry  true "Device Telemetry"
+// @Accept	     json
+// @Produce      json
+// @Success      200  {object}  models.DeviceTelemetry
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      403  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      422  {object}  models.ValidationError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/telemetry [post]
+func (api *API) ReportDeviceTelemetry(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "ReportDeviceTelemetry", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var request models.ReportDeviceTelemetry
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPayloadError(err))
+		return
+	}
+	if len(request.Peers) > deviceTelemetryMaxPeers {
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("peers", fmt.Sprintf("must be at most %d peers", deviceTelemetryMaxPeers)))
+		return
+	}
+	for _, peer := range request.Peers {
+		switch peer.Status {
+		case models.ConnectivityDirect, models.ConnectivityRelayed, models.ConnectivityFailing, models.ConnectivityIdle:
+		default:
+			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("status", "must be one of direct, relayed, failing or idle"))
+			return
+		}
+	}
+
+	var telemetry models.DeviceTelemetry
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		device, err := api.actingDevice(c, tx, deviceId)
+		if err != nil {
+			return err
+		}
+		telemetry = models.DeviceTelemetry{
+			DeviceID:   device.ID,
+			VpcID:      device.VpcID,
+			Peers:      request.Peers,
+			ReportedAt: time.Now(),
+		}
+		if telemetry.Peers == nil {
+			telemetry.Peers = []models.PeerTelemetry{}
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&telemetry).Error
+	})
+	if err != nil {
+		api.sendDeviceTelemetryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, telemetry)
+}
+
+// GetVPCConnectivity gets the connectivity matrix of a VPC
+// @Summary      Get VPC Connectivity
+// @Description  Gets the status of the tunnel between the pairs of devices in a VPC, from what the devices reported.
+// @Description  Only the pairs that are not direct are returned, unless all is set.
+// @Id  		 GetVPCConnectivity
+// @Tags         VPC
+// @Accepts		 json
+// @Produce      json
+// @Param        id         path      string  true  "VPC ID"
+// @Param        device_id  query     string  false "only the pairs this device is part of"
+// @Param        all        query     bool    false "also the pairs that reach each other directly"
+// @Success      200  {object}  models.VPCConnectivity
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/vpcs/{id}/connectivity [get]
+func (api *API) GetVPCConnectivity(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "GetVPCConnectivity",
+		trace.WithAttributes(
+			attribute.String("vpc_id", c.Param("id")),
+		))
+	defer span.End()
+
+	vpcId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+	var deviceId uuid.UUID
+	if c.Query("device_id") != "" {
+		deviceId, err = uuid.Parse(c.Query("device_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewFieldValidationError("device_id", "must be a valid uuid"))
+			return
+		}
+	}
+	// a vpc has a pair for every two devices, most of them direct, so those are left out unless asked for
+	all := false
+	if c.Query("all") != "" {
+		all, err = strconv.ParseBool(c.Query("all"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewFieldValidationError("all", "must be a boolean"))
+			return
+		}
+	}
+
+	var vpc models.VPC
+	db := api.db.WithContext(ctx)
+	result := api.VPCIsReadableByCurrentUser(c, db).
+		First(&vpc, "id = ?", vpcId.String())
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("vpc"))
+		} else {
+			api.SendInternalServerError(c, result.Error)
+		}
+		return
+	}
+
+	var deviceIds []uuid.UUID
+	if result := db.Model(&models.Device{}).
+		Where("vpc_id = ?", vpc.ID).
+		Pluck("id", &deviceIds); result.Error != nil {
+		api.SendInternalServerError(c, result.Error)
+		return
+	}
+	var reports []models.DeviceTelemetry
+	if result := db.
+		Where("vpc_id = ? AND reported_at > ?", vpc.ID, time.Now().Add(-deviceTelemetryStaleAfter)).
+		Find(&reports); result.Error != nil {
+		api.SendInternalServerError(c, result.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.VPCConnectivity{
+		VpcID: vpc.ID,
+		Pairs: connectivityMatrix(deviceIds, reports, deviceId, all),
+	})
+}
+
+// connectivityMatrix combines what the devices reported about each other into the status of every pair of devices,
+// only the pairs the filter device is part of unless the filter is nil, and only the pairs that are not direct
+// unless direct is set.
+func connectivityMatrix(deviceIds []uuid.UUID, reports []models.DeviceTelemetry, filter uuid.UUID, direct bool) []models.DevicePairConnectivity {
+	reported := map[uuid.UUID]map[uuid.UUID]*models.PeerTelemetry{}
+	for _, report := range reports {
+		peers := map[uuid.UUID]*models.PeerTelemetry{}
+		for i := range report.Peers {
+			peers[report.Peers[i].PeerID] = &report.Peers[i]
+		}
+		reported[report.DeviceID] = peers
+	}
+
+	sort.Slice(deviceIds, func(i, j int) bool {
+		return deviceIds[i].String() < deviceIds[j].String()
+	})
+	pairs := []models.DevicePairConnectivity{}
+	for i, device := range deviceIds {
+		for _, peer := range deviceIds[i+1:] {
+			if filter != uuid.Nil && filter != device && filter != peer {
+				continue
+			}
+			pair := models.DevicePairConnectivity{
+				DeviceID:     device,
+				PeerID:       peer,
+				Status:       models.ConnectivityUnknown,
+				DeviceReport: reported[device][peer],
+				PeerReport:   reported[peer][device],
+			}
+			for _, status := range connectivityPrecedence {
+				if (pair.DeviceReport != nil && pair.DeviceReport.Status == status) ||
+					(pair.PeerReport != nil && pair.PeerReport.Status == status) {
+					pair.Status = status
+					break
+				}
+			}
+			if pair.Status == models.ConnectivityDirect && !direct {
+				continue
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+func (api *API) sendDeviceTelemetryError(c *gin.Context, err error) {
+	var apiResponseError *ApiResponseError
+	if errors.Is(err, errDeviceNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device"))
+	} else if errors.As(err, &apiResponseError) {
+		c.JSON(apiResponseError.Status, apiResponseError.Body)
+	} else {
+		api.SendInternalServerError(c, err)
+	}
+}
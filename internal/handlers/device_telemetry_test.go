@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/nexodus-io/nexodus/internal/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func (suite *HandlerTestSuite) TestDeviceTelemetry() {
+	require := suite.Require()
+
+	var devices []models.Device
+	for i := 0; i < 3; i++ {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(err)
+		reqBody, err := json.Marshal(models.AddDevice{
+			VpcID:     suite.testUserID,
+			PublicKey: key.PublicKey().String(),
+		})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+		var device models.Device
+		require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+		devices = append(devices, device)
+	}
+	a, b, c := devices[0], devices[1], devices[2]
+
+	report := func(device models.Device, peers ...models.PeerTelemetry) (int, []byte) {
+		reqBody, err := json.Marshal(models.ReportDeviceTelemetry{Peers: peers})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/:id/telemetry", fmt.Sprintf("/%s/telemetry", device.ID), suite.api.ReportDeviceTelemetry, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		return res.Code, res.Body.Bytes()
+	}
+
+	code, body := report(a, models.PeerTelemetry{PeerID: b.ID, Status: "broken"})
+	require.Equal(http.StatusUnprocessableEntity, code, "HTTP error: %s", string(body))
+
+	code, body = report(a,
+		models.PeerTelemetry{PeerID: b.ID, PeeringMethod: "reflexive", Status: models.ConnectivityDirect, RxBytes: 10, TxBytes: 20},
+		models.PeerTelemetry{PeerID: c.ID, PeeringMethod: "via-relay", Status: models.ConnectivityRelayed},
+	)
+	require.Equal(http.StatusOK, code, "HTTP error: %s", string(body))
+	// the peer seeing the tunnel as failing takes precedence over the device reaching it directly
+	code, body = report(b, models.PeerTelemetry{PeerID: a.ID, PeeringMethod: "reflexive", Status: models.ConnectivityFailing})
+	require.Equal(http.StatusOK, code, "HTTP error: %s", string(body))
+
+	_, res, err := suite.ServeRequest(http.MethodGet, "/:id/connectivity", fmt.Sprintf("/%s/connectivity", a.VpcID), suite.api.GetVPCConnectivity, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	var connectivity models.VPCConnectivity
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &connectivity))
+
+	status := map[string]string{}
+	for _, pair := range connectivity.Pairs {
+		first, second := devicePeerKeyPair(pair.DeviceID, pair.PeerID)
+		require.Equal(first, pair.DeviceID)
+		require.Equal(second, pair.PeerID)
+		status[fmt.Sprintf("%s/%s", first, second)] = pair.Status
+	}
+	pairStatus := func(x, y models.Device) string {
+		first, second := devicePeerKeyPair(x.ID, y.ID)
+		return status[fmt.Sprintf("%s/%s", first, second)]
+	}
+	require.Len(status, 3)
+	require.Equal(models.ConnectivityFailing, pairStatus(a, b))
+	require.Equal(models.ConnectivityRelayed, pairStatus(a, c))
+	require.Equal(models.ConnectivityUnknown, pairStatus(b, c))
+
+	// the pairs that reach each other directly are only returned when asked for
+	code, body = report(b, models.PeerTelemetry{PeerID: a.ID, PeeringMethod: "reflexive", Status: models.ConnectivityDirect})
+	require.Equal(http.StatusOK, code, "HTTP error: %s", string(body))
+	_, res, err = suite.ServeRequest(http.MethodGet, "/:id/connectivity", fmt.Sprintf("/%s/connectivity", a.VpcID), suite.api.GetVPCConnectivity, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &connectivity))
+	require.Len(connectivity.Pairs, 2)
+	for _, pair := range connectivity.Pairs {
+		require.NotEqual(models.ConnectivityDirect, pair.Status)
+	}
+	_, res, err = suite.ServeRequest(http.MethodGet, "/:id/connectivity", fmt.Sprintf("/%s/connectivity?all=true", a.VpcID), suite.api.GetVPCConnectivity, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &connectivity))
+	require.Len(connectivity.Pairs, 3)
+	_, res, err = suite.ServeRequest(http.MethodGet, "/:id/connectivity", fmt.Sprintf("/%s/connectivity?all=maybe", a.VpcID), suite.api.GetVPCConnectivity, nil)
+	require.NoError(err)
+	require.Equal(http.StatusBadRequest, res.Code)
+
+	// only the pairs of one device
+	_, res, err = suite.ServeRequest(http.MethodGet, "/:id/connectivity", fmt.Sprintf("/%s/connectivity?device_id=%s", a.VpcID, c.ID), suite.api.GetVPCConnectivity, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &connectivity))
+	require.Len(connectivity.Pairs, 2)
+}
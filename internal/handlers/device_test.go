@@ -2,14 +2,21 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/nexodus-io/nexodus/internal/models"
+	"github.com/nexodus-io/nexodus/internal/wgcrypto"
 	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 func (suite *HandlerTestSuite) TestCreateGetDevice() {
@@ -18,6 +25,10 @@ func (suite *HandlerTestSuite) TestCreateGetDevice() {
 	newDevice := models.AddDevice{
 		VpcID:     suite.testUserID,
 		PublicKey: "atestpubkey",
+		Nat: &models.NatBehavior{
+			Mapping:   "address-and-port-dependent",
+			Filtering: "address-dependent",
+		},
 	}
 
 	resBody, err := json.Marshal(newDevice)
@@ -40,6 +51,7 @@ func (suite *HandlerTestSuite) TestCreateGetDevice() {
 	require.NoError(err)
 
 	require.Equal(newDevice.PublicKey, actual.PublicKey)
+	require.Equal(newDevice.Nat, actual.Nat)
 	require.Equal(suite.testUserID, actual.OwnerID)
 
 	_, res, err = suite.ServeRequest(
@@ -60,6 +72,293 @@ func (suite *HandlerTestSuite) TestCreateGetDevice() {
 	assert.Equal(actual, device)
 }
 
+func (suite *HandlerTestSuite) TestRotateDeviceKey() {
+	require := suite.Require()
+
+	generateKey := func() string {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(err)
+		return key.PublicKey().String()
+	}
+	createDevice := func(publicKey string) *httptest.ResponseRecorder {
+		reqBody, err := json.Marshal(models.AddDevice{
+			VpcID:     suite.testUserID,
+			PublicKey: publicKey,
+		})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		return res
+	}
+	updateDevice := func(id uuid.UUID, update models.UpdateDevice) (*httptest.ResponseRecorder, models.Device) {
+		reqBody, err := json.Marshal(update)
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPatch, "/:id", fmt.Sprintf("/%s", id), suite.api.UpdateDevice, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		var device models.Device
+		if res.Code == http.StatusOK {
+			require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+		}
+		return res, device
+	}
+
+	originalKey := generateKey()
+	res := createDevice(originalKey)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var device models.Device
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+	require.NotNil(device.PublicKeyCreatedAt)
+
+	// rotate to a new key, the original key is kept as the previous key
+	newKey := generateKey()
+	res, rotated := updateDevice(device.ID, models.UpdateDevice{PublicKey: newKey, KeyOverlapSeconds: 60})
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.Equal(newKey, rotated.PublicKey)
+	require.Equal(originalKey, rotated.PreviousPublicKey)
+	require.NotNil(rotated.PreviousPublicKeyExpiresAt)
+	require.WithinDuration(time.Now().Add(time.Minute), *rotated.PreviousPublicKeyExpiresAt, 10*time.Second)
+
+	// the previous key still identifies the device during the overlap window
+	res = createDevice(originalKey)
+	require.Equal(http.StatusConflict, res.Code, "HTTP error: %s", res.Body.String())
+	var conflict models.ConflictsError
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &conflict))
+	require.Equal(device.ID.String(), conflict.ID)
+
+	// keys can not be reused
+	res, _ = updateDevice(device.ID, models.UpdateDevice{PublicKey: originalKey})
+	require.Equal(http.StatusConflict, res.Code, "HTTP error: %s", res.Body.String())
+	res, _ = updateDevice(device.ID, models.UpdateDevice{PublicKey: "not-a-key"})
+	require.Equal(http.StatusBadRequest, res.Code, "HTTP error: %s", res.Body.String())
+	res, _ = updateDevice(device.ID, models.UpdateDevice{PublicKey: generateKey(), KeyOverlapSeconds: -1})
+	require.Equal(http.StatusBadRequest, res.Code, "HTTP error: %s", res.Body.String())
+
+	// once the key is older than the vpc allows, updates are rejected until the key is rotated
+	require.NoError(suite.api.db.Model(&models.VPC{}).Where("id = ?", suite.testUserID).Update("max_key_age_seconds", 3600).Error)
+	require.NoError(suite.api.db.Model(&models.Device{}).Where("id = ?", device.ID).Update("public_key_created_at", time.Now().Add(-2*time.Hour)).Error)
+	res, _ = updateDevice(device.ID, models.UpdateDevice{Hostname: "expired"})
+	require.Equal(http.StatusBadRequest, res.Code, "HTTP error: %s", res.Body.String())
+	var stored models.Device
+	require.NoError(suite.api.db.First(&stored, "id = ?", device.ID).Error)
+	check, err := checkDeviceToken(context.Background(), suite.api, stored.BearerToken)
+	require.NoError(err)
+	require.NotNil(check.GetDeniedResponse())
+	require.Contains(check.GetDeniedResponse().Body, "device key is older than the vpc max key age")
+
+	res, rotated = updateDevice(device.ID, models.UpdateDevice{Hostname: "rotated", PublicKey: generateKey()})
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.Equal(newKey, rotated.PreviousPublicKey)
+	require.Equal("rotated", rotated.Hostname)
+	check, err = checkDeviceToken(context.Background(), suite.api, stored.BearerToken)
+	require.NoError(err)
+	require.NotNil(check.GetOkResponse())
+}
+
+func (suite *HandlerTestSuite) TestListDevicePresharedKeys() {
+	require := suite.Require()
+
+	createDevice := func() (models.Device, wgtypes.Key) {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(err)
+		reqBody, err := json.Marshal(models.AddDevice{
+			VpcID:     suite.testUserID,
+			PublicKey: key.PublicKey().String(),
+		})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+		var device models.Device
+		require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+		return device, key
+	}
+	listKeys := func(device models.Device, privateKey wgtypes.Key) map[int64][]byte {
+		_, res, err := suite.ServeRequest(http.MethodGet, "/:id/preshared-keys", fmt.Sprintf("/%s/preshared-keys", device.ID), suite.api.ListDevicePresharedKeys, nil)
+		require.NoError(err)
+		require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+		var keys []models.PeerPresharedKey
+		require.NoError(json.Unmarshal(res.Body.Bytes(), &keys))
+		result := map[int64][]byte{}
+		for _, k := range keys {
+			require.NotEqual(device.ID, k.PeerID)
+			require.True(k.StartsAt.Before(k.ExpiresAt))
+			sealed, err := wgcrypto.ParseSealed(k.SealedKey)
+			require.NoError(err)
+			psk, err := sealed.Open(privateKey[:])
+			require.NoError(err)
+			result[k.StartsAt.Unix()] = psk
+		}
+		return result
+	}
+
+	device1, key1 := createDevice()
+	device2, key2 := createDevice()
+
+	// preshared keys are disabled by default
+	require.Empty(listKeys(device1, key1))
+
+	require.NoError(suite.api.db.Model(&models.VPC{}).Where("id = ?", suite.testUserID).Update("preshared_keys", true).Error)
+
+	// both devices get the same keys for the current and the next rotation period
+	keys1 := listKeys(device1, key1)
+	keys2 := listKeys(device2, key2)
+	require.Len(keys1, 2)
+	require.Equal(keys1, keys2)
+
+	// the keys are stable until they expire
+	require.Equal(keys1, listKeys(device1, key1))
+}
+
+func (suite *HandlerTestSuite) TestRotateDeviceToken() {
+	require := suite.Require()
+
+	reqBody, err := json.Marshal(models.AddDevice{
+		VpcID:     suite.testUserID,
+		PublicKey: "atestpubkey",
+	})
+	require.NoError(err)
+	_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var device models.Device
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+
+	var stored models.Device
+	require.NoError(suite.api.db.First(&stored, "id = ?", device.ID).Error)
+	originalToken := stored.BearerToken
+
+	check, err := checkDeviceToken(context.Background(), suite.api, originalToken)
+	require.NoError(err)
+	require.NotNil(check.GetOkResponse())
+
+	_, res, err = suite.ServeRequest(http.MethodPost, "/:id/rotate-token", fmt.Sprintf("/%s/rotate-token", device.ID), suite.api.RotateDeviceToken, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	var rotated models.Device
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &rotated))
+	// the new token is only handed to the device itself
+	require.Empty(rotated.BearerToken)
+
+	require.NoError(suite.api.db.First(&stored, "id = ?", device.ID).Error)
+	require.NotEqual(originalToken, stored.BearerToken)
+
+	// rotating only replaces the token, the device stays enabled with the new one
+	require.False(rotated.Revoked)
+	check, err = checkDeviceToken(context.Background(), suite.api, originalToken)
+	require.NoError(err)
+	require.NotNil(check.GetDeniedResponse())
+	require.Contains(check.GetDeniedResponse().Body, "device token has been revoked")
+	check, err = checkDeviceToken(context.Background(), suite.api, stored.BearerToken)
+	require.NoError(err)
+	require.NotNil(check.GetOkResponse())
+
+	// revoking the device replaces the token again and accepts neither
+	revoked := true
+	reqBody, err = json.Marshal(models.UpdateDevice{Revoked: &revoked})
+	require.NoError(err)
+	_, res, err = suite.ServeRequest(http.MethodPatch, "/:id", fmt.Sprintf("/%s", device.ID), suite.api.UpdateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	rotatedToken := stored.BearerToken
+	require.NoError(suite.api.db.First(&stored, "id = ?", device.ID).Error)
+	require.True(stored.Revoked)
+	require.NotEqual(rotatedToken, stored.BearerToken)
+	check, err = checkDeviceToken(context.Background(), suite.api, rotatedToken)
+	require.NoError(err)
+	require.NotNil(check.GetDeniedResponse())
+	check, err = checkDeviceToken(context.Background(), suite.api, stored.BearerToken)
+	require.NoError(err)
+	require.NotNil(check.GetDeniedResponse())
+
+	// the device is not handed the new token when it authenticates with its reg key
+	claims := &models.NexodusClaims{Scope: "reg-token"}
+	claims.ID = stored.RegKeyID.String()
+	require.NotNil(deviceRevokedError(stored, claims))
+	hidden := stored
+	hideDeviceBearerToken(&hidden, claims)
+	require.Empty(hidden.BearerToken)
+
+	// once a user re-enables the device, the new token is accepted
+	reqBody, err = json.Marshal(models.UpdateDevice{Revoked: new(bool)})
+	require.NoError(err)
+	_, res, err = suite.ServeRequest(http.MethodPatch, "/:id", fmt.Sprintf("/%s", device.ID), suite.api.UpdateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	require.NoError(suite.api.db.First(&stored, "id = ?", device.ID).Error)
+	require.False(stored.Revoked)
+	require.Nil(deviceRevokedError(stored, claims))
+	check, err = checkDeviceToken(context.Background(), suite.api, stored.BearerToken)
+	require.NoError(err)
+	require.NotNil(check.GetOkResponse())
+}
+
+func (suite *HandlerTestSuite) TestListDevicesInVPCHidesRevokedDevices() {
+	require := suite.Require()
+
+	reqBody, err := json.Marshal(models.AddDevice{
+		VpcID:     suite.testUserID,
+		PublicKey: "arevokedpubkey",
+	})
+	require.NoError(err)
+	_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var device models.Device
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+
+	listDevices := func() []models.Device {
+		_, res, err := suite.ServeRequest(http.MethodGet, "/:id/devices", fmt.Sprintf("/%s/devices", suite.testUserID), suite.api.ListDevicesInVPC, nil)
+		require.NoError(err)
+		require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+		var devices []models.Device
+		require.NoError(json.Unmarshal(res.Body.Bytes(), &devices))
+		return devices
+	}
+	require.Contains(deviceIDs(listDevices()), device.ID)
+
+	revoked := true
+	reqBody, err = json.Marshal(models.UpdateDevice{Revoked: &revoked})
+	require.NoError(err)
+	_, res, err = suite.ServeRequest(http.MethodPatch, "/:id", fmt.Sprintf("/%s", device.ID), suite.api.UpdateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+
+	// the revoked device is gone from the list and watchers see it deleted
+	require.NotContains(deviceIDs(listDevices()), device.ID)
+	var stored models.Device
+	require.NoError(suite.api.db.First(&stored, "id = ?", device.ID).Error)
+	_, _, deletedAt := deviceList{&stored}.Item(0)
+	require.True(deletedAt.Valid)
+}
+
+func deviceIDs(devices []models.Device) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(devices))
+	for _, d := range devices {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func (suite *HandlerTestSuite) TestReplaceDeviceBearerTokenPrunesRevokedTokens() {
+	require := suite.Require()
+	now := time.Now()
+	deviceID := uuid.New()
+	require.NoError(suite.api.db.Create(&models.RevokedDeviceToken{
+		BearerToken: "DT:old",
+		DeviceID:    deviceID,
+		RevokedAt:   now.Add(-revokedDeviceTokenRetention - time.Hour),
+	}).Error)
+
+	device := models.Device{Base: models.Base{ID: deviceID}, BearerToken: "DT:current"}
+	require.NoError(replaceDeviceBearerToken(suite.api.db, &device, now))
+	require.NotEqual("DT:current", device.BearerToken)
+
+	var tokens []models.RevokedDeviceToken
+	require.NoError(suite.api.db.Find(&tokens, "device_id = ?", deviceID).Error)
+	require.Len(tokens, 1)
+	require.Equal("DT:current", tokens[0].BearerToken)
+}
+
 func TestAdvertiseCidrEquals(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -100,3 +399,99 @@ func TestAdvertiseCidrEquals(t *testing.T) {
 		})
 	}
 }
+
+func (suite *HandlerTestSuite) TestUpdateDeviceRelayLoad() {
+	require := suite.Require()
+
+	createDevice := func(relay bool) models.Device {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(err)
+		reqBody, err := json.Marshal(models.AddDevice{
+			VpcID:     suite.testUserID,
+			PublicKey: key.PublicKey().String(),
+			Relay:     relay,
+		})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+		var device models.Device
+		require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+		return device
+	}
+	updateLoad := func(device models.Device, load int) (int, []byte) {
+		reqBody, err := json.Marshal(models.UpdateDevice{RelayLoad: &load})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPatch, "/:id", fmt.Sprintf("/%s", device.ID), suite.api.UpdateDevice, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		return res.Code, res.Body.Bytes()
+	}
+
+	relay := createDevice(true)
+	code, body := updateLoad(relay, 512)
+	require.Equal(http.StatusOK, code, "HTTP error: %s", string(body))
+	var updated models.Device
+	require.NoError(json.Unmarshal(body, &updated))
+	require.Equal(512, updated.RelayLoad)
+
+	code, body = updateLoad(relay, -1)
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.JSONEq(`{"error":"must not be negative","field":"relay_load"}`, string(body))
+
+	code, body = updateLoad(createDevice(false), 512)
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.JSONEq(`{"error":"only relay devices report a load","field":"relay_load"}`, string(body))
+}
+
+func (suite *HandlerTestSuite) TestUpdateDevicePeeringGroup() {
+	require := suite.Require()
+
+	reqBody, err := json.Marshal(models.AddDevice{
+		VpcID:     suite.testUserID,
+		PublicKey: "atestpubkey",
+	})
+	require.NoError(err)
+	_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var device models.Device
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+
+	updateGroup := func(group string, claims map[string]interface{}) *httptest.ResponseRecorder {
+		reqBody, err := json.Marshal(models.UpdateDevice{PeeringGroup: &group})
+		require.NoError(err)
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(gin.AuthUserKey, suite.testUserID)
+			if claims != nil {
+				c.Set("_nexodus.Claims", claims)
+			}
+			c.Next()
+		})
+		r.PATCH("/:id", suite.api.UpdateDevice)
+		req, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("/%s", device.ID), bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		return res
+	}
+
+	// the owner places the device in a peering group
+	res = updateGroup("branch-east", nil)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+
+	// the device itself may not move to another group
+	deviceClaims := map[string]interface{}{"scope": "device-token", "jti": device.ID.String()}
+	res = updateGroup("branch-west", deviceClaims)
+	require.Equal(http.StatusForbidden, res.Code)
+	require.Contains(res.Body.String(), "only users can change the peering group of a device")
+
+	// sending the group it is in is not a change
+	res = updateGroup("branch-east", deviceClaims)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+
+	var stored models.Device
+	require.NoError(suite.api.db.First(&stored, "id = ?", device.ID).Error)
+	require.Equal("branch-east", stored.PeeringGroup)
+}
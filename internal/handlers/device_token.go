@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// how long the revoked device tokens are remembered, so that a device still using one is told it was revoked
+const revokedDeviceTokenRetention = 7 * 24 * time.Hour
+
+// newDeviceBearerToken generates the token nexd uses to authenticate as a device
+func newDeviceBearerToken() (string, error) {
+	// lets use a wg private key as the token, since it should be hard to guess.
+	deviceToken, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return "", err
+	}
+	return "DT:" + deviceToken.String(), nil
+}
+
+// replaceDeviceBearerToken issues a new bearer token to the device and revokes its current one.
+func replaceDeviceBearerToken(tx *gorm.DB, device *models.Device, now time.Time) error {
+	if device.BearerToken != "" {
+		if result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedDeviceToken{
+			BearerToken: device.BearerToken,
+			DeviceID:    device.ID,
+			RevokedAt:   now,
+		}); result.Error != nil {
+			return result.Error
+		}
+	}
+	// a device still using a token revoked before the retention gets the error of an unknown token
+	if result := tx.Where("revoked_at < ?", now.Add(-revokedDeviceTokenRetention)).
+		Delete(&models.RevokedDeviceToken{}); result.Error != nil {
+		return result.Error
+	}
+
+	deviceToken, err := newDeviceBearerToken()
+	if err != nil {
+		return err
+	}
+	device.BearerToken = deviceToken
+	return nil
+}
+
+// isDeviceScope returns true if the caller authenticates as a device, with its device token or the reg key it was
+// registered with.
+func isDeviceScope(claims *models.NexodusClaims) bool {
+	return claims != nil && (claims.Scope == "reg-token" || claims.Scope == "device-token")
+}
+
+// deviceRevokedError returns an error when a revoked device authenticates as itself, users can still manage it.
+func deviceRevokedError(device models.Device, claims *models.NexodusClaims) *ApiResponseError {
+	if device.Revoked && isDeviceScope(claims) {
+		return NewApiResponseError(http.StatusForbidden, models.NewBaseError("the device has been revoked"))
+	}
+	return nil
+}
+
+// RotateDeviceToken replaces the bearer token of a device
+// @Summary      Rotate Device Token
+// @Id  		 RotateDeviceToken
+// @Tags         Devices
+// @Description  Issues a new bearer token for a device and revokes the current one. The device stays enabled,
+// @Description  revoke it with the revoked field of UpdateDevice.
+// @Param        id   path      string  true "Device ID"
+// @Accept	     json
+// @Produce      json
+// @Success      200  {object}  models.Device
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      403  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/rotate-token [post]
+func (api *API) RotateDeviceToken(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "RotateDeviceToken", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var device models.Device
+	var tokenClaims *models.NexodusClaims
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		device, err = api.actingDevice(c, tx, deviceId)
+		if err != nil {
+			return err
+		}
+
+		var err2 *ApiResponseError
+		tokenClaims, err2 = NxodusClaims(c, tx)
+		if err2 != nil {
+			return err2
+		}
+
+		if err := deviceRevokedError(device, tokenClaims); err != nil {
+			return err
+		}
+		if err := replaceDeviceBearerToken(tx, &device, time.Now()); err != nil {
+			return err
+		}
+		if result := tx.
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "revision"}}}).
+			Save(&device); result.Error != nil {
+			return result.Error
+		}
+		return nil
+	})
+
+	if err != nil {
+		var apiResponseError *ApiResponseError
+		if errors.Is(err, errDeviceNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("device"))
+		} else if errors.As(err, &apiResponseError) {
+			c.JSON(apiResponseError.Status, apiResponseError.Body)
+		} else {
+			api.SendInternalServerError(c, err)
+		}
+		return
+	}
+
+	hideDeviceBearerToken(&device, tokenClaims)
+
+	api.signalBus.Notify(fmt.Sprintf("/devices/vpc=%s", device.VpcID.String()))
+	c.JSON(http.StatusOK, device)
+}
@@ -17,6 +17,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"time"
 )
 
 const SESSION_ID_COOKIE_NAME = "sid"
@@ -46,6 +47,9 @@ func (api *API) Check(ctx context.Context, checkReq *auth.CheckRequest) (*auth.C
 		} else if strings.HasPrefix(authorizationHeader, "Bearer DT:") {
 			token := strings.TrimPrefix(authorizationHeader, "Bearer ")
 			return checkDeviceToken(ctx, api, token)
+		} else if strings.HasPrefix(authorizationHeader, "Bearer ") {
+			token := strings.TrimPrefix(authorizationHeader, "Bearer ")
+			return checkNexodusToken(ctx, api, token, okResponse)
 		}
 		return okResponse, nil
 	}
@@ -136,7 +140,7 @@ func checkRegistrationToken(ctx context.Context, api *API, token string) (*auth.
 		claims.ExpiresAt = jwt.NewNumericDate(*regToken.ExpiresAt)
 	}
 
-	jwttoken, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(api.PrivateKey)
+	jwttoken, err := api.signJWT(ctx, claims)
 	if err != nil {
 		return denyCheckResponse(401, models.NewBaseError("internal server error"))
 	}
@@ -160,16 +164,36 @@ func checkRegistrationToken(ctx context.Context, api *API, token string) (*auth.
 }
 
 func checkDeviceToken(ctx context.Context, api *API, token string) (*auth.CheckResponse, error) {
-	var device models.Device
 	db := api.db.WithContext(ctx)
+
+	var device models.Device
 	result := db.First(&device, "bearer_token = ?", token)
 	if result.Error != nil {
 		message := "internal server error"
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			message = "invalid device token"
+			// tokens replaced by a rotation get a distinct error so that nexd knows to re-authenticate
+			var revoked int64
+			if result := db.Model(&models.RevokedDeviceToken{}).Where("bearer_token = ?", token).Count(&revoked); result.Error != nil {
+				message = "internal server error"
+			} else if revoked > 0 {
+				message = "device token has been revoked"
+			}
 		}
 		return denyCheckResponse(401, models.NewBaseError(message))
 	}
+	if device.Revoked {
+		return denyCheckResponse(401, models.NewBaseError("device token has been revoked"))
+	}
+
+	// a device whose key is older than the vpc allows has to rotate it with the credentials it registered with
+	var vpc models.VPC
+	if result := db.Select("max_key_age_seconds").First(&vpc, "id = ?", device.VpcID); result.Error != nil {
+		return denyCheckResponse(401, models.NewBaseError("internal server error"))
+	}
+	if deviceKeyExpired(device, vpc, time.Now()) {
+		return denyCheckResponse(401, models.NewBaseError("device key is older than the vpc max key age"))
+	}
 
 	var user models.User
 	result = db.First(&user, "id = ?", device.OwnerID)
@@ -193,7 +217,7 @@ func checkDeviceToken(ctx context.Context, api *API, token string) (*auth.CheckR
 		Scope: "device-token",
 	}
 
-	jwttoken, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(api.PrivateKey)
+	jwttoken, err := api.signJWT(ctx, claims)
 	if err != nil {
 		return denyCheckResponse(401, models.NewBaseError("internal server error"))
 	}
@@ -217,6 +241,20 @@ func checkDeviceToken(ctx context.Context, api *API, token string) (*auth.CheckR
 
 }
 
+// checkNexodusToken verifies JWTs issued by this server against every published signing key, so
+// that a key rotation does not reject tokens that were signed just before it. Other tokens are
+// left for the apiserver to validate.
+func checkNexodusToken(ctx context.Context, api *API, token string, okResponse *auth.CheckResponse) (*auth.CheckResponse, error) {
+	claims := models.NexodusClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil || api.URL == "" || claims.Issuer != api.URL {
+		return okResponse, nil
+	}
+	if err := api.verifyJWT(ctx, token, &models.NexodusClaims{}); err != nil {
+		return denyCheckResponse(401, models.NewBaseError("invalid token"))
+	}
+	return okResponse, nil
+}
+
 func denyCheckResponse(statusCode int, baseError models.BaseError) (*auth.CheckResponse, error) {
 	data, err := json.Marshal(baseError)
 	if err != nil {
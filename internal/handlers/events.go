@@ -151,6 +151,7 @@ func (api *API) WatchEvents(c *gin.Context) {
 				signal:     fmt.Sprintf("/security-groups/vpc=%s", vpcId.String()),
 				fetch: func(db *gorm.DB, gtRevision uint64) (fetchmgr.ResourceList, error) {
 					var items securityGroupList
+					grantsDB := db
 					db = db.Unscoped().Limit(100).Order("revision")
 					if gtRevision != 0 {
 						db = db.Where("revision > ?", gtRevision)
@@ -160,6 +161,73 @@ func (api *API) WatchEvents(c *gin.Context) {
 					if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 						return nil, result.Error
 					}
+					if err := loadActiveGrants(grantsDB, items...); err != nil {
+						return nil, err
+					}
+					return items, nil
+				},
+			})
+
+		case "hole-punch":
+			watches = append(watches, Watch{
+				kind:       r.Kind,
+				gtRevision: r.GtRevision,
+				atTail:     r.AtTail,
+				signal:     fmt.Sprintf("/hole-punches/vpc=%s", vpcId.String()),
+				fetch: func(db *gorm.DB, gtRevision uint64) (fetchmgr.ResourceList, error) {
+					var items holePunchList
+					db = db.Unscoped().Limit(100).Order("revision")
+					if gtRevision != 0 {
+						db = db.Where("revision > ?", gtRevision)
+					}
+					db = db.Where("vpc_id = ?", vpcId.String())
+					result := db.Find(&items)
+					if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+						return nil, result.Error
+					}
+					return items, nil
+				},
+			})
+
+		case "device-action":
+			watches = append(watches, Watch{
+				kind:       r.Kind,
+				gtRevision: r.GtRevision,
+				atTail:     r.AtTail,
+				signal:     fmt.Sprintf("/device-actions/vpc=%s", vpcId.String()),
+				fetch: func(db *gorm.DB, gtRevision uint64) (fetchmgr.ResourceList, error) {
+					var items deviceActionList
+					db = db.Unscoped().Limit(100).Order("revision")
+					if gtRevision != 0 {
+						db = db.Where("revision > ?", gtRevision)
+					}
+					db = db.Where("vpc_id = ?", vpcId.String())
+					result := db.Find(&items)
+					if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+						return nil, result.Error
+					}
+					hideDeviceActionResults(items)
+					return items, nil
+				},
+			})
+
+		case "device-profile":
+			watches = append(watches, Watch{
+				kind:       r.Kind,
+				gtRevision: r.GtRevision,
+				atTail:     r.AtTail,
+				signal:     fmt.Sprintf("/device-profiles/vpc=%s", vpcId.String()),
+				fetch: func(db *gorm.DB, gtRevision uint64) (fetchmgr.ResourceList, error) {
+					var items deviceProfileList
+					db = db.Unscoped().Limit(100).Order("revision")
+					if gtRevision != 0 {
+						db = db.Where("revision > ?", gtRevision)
+					}
+					db = db.Where("vpc_id = ?", vpcId.String())
+					result := db.Find(&items)
+					if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+						return nil, result.Error
+					}
 					return items, nil
 				},
 			})
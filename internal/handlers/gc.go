@@ -68,6 +68,15 @@ func (api *API) GarbageCollect(c *gin.Context) {
 		return
 	}
 
+	err = db.Unscoped().
+		Debug().
+		Where("deleted_at < ?", time.Now().Add(-d)).
+		Delete(&models.DeviceAction{}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err)
+		return
+	}
+
 	err = db.Unscoped().
 		Debug().
 		Where("deleted_at < ?", time.Now().Add(-d)).
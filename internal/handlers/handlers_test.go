@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"github.com/redis/go-redis/v9"
@@ -77,6 +79,11 @@ func (suite *HandlerTestSuite) SetupSuite() {
 	if err != nil {
 		suite.T().Fatal(err)
 	}
+	// used to sign the JWTs the envoy authz check exchanges tokens for
+	suite.api.PrivateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
 }
 
 func (suite *HandlerTestSuite) BeforeTest(_, _ string) {
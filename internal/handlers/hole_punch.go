@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/handlers/fetchmgr"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	// how long after the peer answered both devices punch, long enough for both watch streams to deliver the answer
+	holePunchDelay = 2 * time.Second
+	// hole punches that were not answered and punched by then are deleted
+	holePunchTTL = time.Minute
+	// the most candidate endpoints a device may offer, a symmetric NAT offers the ports it is predicted to map
+	holePunchMaxCandidates = 16
+)
+
+var errHolePunchNotFound = errors.New("hole punch not found")
+
+type holePunchList []*models.HolePunch
+
+func (d holePunchList) Item(i int) (any, uint64, gorm.DeletedAt) {
+	item := d[i]
+	// the watch sends the item right away
+	setPunchIn(item, time.Now())
+	return item, item.Revision, item.DeletedAt
+}
+
+func (d holePunchList) Len() int {
+	return len(d)
+}
+
+// CreateHolePunch starts a hole punch with a peer
+// @Summary      Start Hole Punch
+// @Id  		 CreateHolePunch
+// @Tags         Devices
+// @Description  Offers the candidate endpoints of a device to a peer, to punch holes through the NATs of both
+// @Description  devices. The peer learns of the hole punch through the vpc events and answers it.
+// @Param        id         path      string               true "Device ID"
+// @Param        HolePunch  body      models.AddHolePunch  true "Add Hole Punch"
+// @Accept	     json
+// @Produce      json
+// @Success      201  {object}  models.HolePunch
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      403  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      422  {object}  models.ValidationError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/hole-punches [post]
+func (api *API) CreateHolePunch(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "CreateHolePunch", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var request models.AddHolePunch
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPayloadError(err))
+		return
+	}
+	if err := validateHolePunchCandidates(request.Candidates); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	var punch models.HolePunch
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		device, err := api.actingDevice(c, tx, deviceId)
+		if err != nil {
+			return err
+		}
+
+		var peer models.Device
+		result := tx.First(&peer, "id = ? AND vpc_id = ?", request.PeerID, device.VpcID)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) || peer.ID == device.ID {
+			return NewApiResponseError(http.StatusUnprocessableEntity, models.NewFieldValidationError("peer_id", "must be another device in the vpc"))
+		} else if result.Error != nil {
+			return result.Error
+		}
+
+		// a new hole punch replaces the previous ones of the pair, and the stale ones of the vpc are dropped
+		if result := tx.
+			Where("vpc_id = ? AND (created_at < ? OR (device_id = ? AND peer_id = ?) OR (device_id = ? AND peer_id = ?))",
+				device.VpcID, time.Now().Add(-holePunchTTL), device.ID, peer.ID, peer.ID, device.ID).
+			Delete(&models.HolePunch{}); result.Error != nil {
+			return result.Error
+		}
+
+		punch = models.HolePunch{
+			VpcID:      device.VpcID,
+			DeviceID:   device.ID,
+			PeerID:     peer.ID,
+			Candidates: request.Candidates,
+		}
+		return tx.Create(&punch).Error
+	})
+	if err != nil {
+		api.sendHolePunchError(c, err)
+		return
+	}
+
+	api.signalBus.Notify(fmt.Sprintf("/hole-punches/vpc=%s", punch.VpcID.String()))
+	c.JSON(http.StatusCreated, punch)
+}
+
+// AnswerHolePunch answers a hole punch a peer started
+// @Summary      Answer Hole Punch
+// @Id  		 AnswerHolePunch
+// @Tags         Devices
+// @Description  Answers a hole punch with the candidate endpoints of the device. The api-server then sets the
+// @Description  moment both devices send packets to the candidates of the other.
+// @Param        id             path      string                  true "Device ID"
+// @Param        hole_punch_id  path      string                  true "Hole Punch ID"
+// @Param        HolePunch      body      models.AnswerHolePunch  true "Answer Hole Punch"
+// @Accept	     json
+// @Produce      json
+// @Success      200  {object}  models.HolePunch
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      403  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      422  {object}  models.ValidationError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/hole-punches/{hole_punch_id} [patch]
+func (api *API) AnswerHolePunch(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "AnswerHolePunch", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+		attribute.String("hole_punch_id", c.Param("hole_punch_id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+	punchId, err := uuid.Parse(c.Param("hole_punch_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("hole_punch_id"))
+		return
+	}
+
+	var request models.AnswerHolePunch
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPayloadError(err))
+		return
+	}
+	if err := validateHolePunchCandidates(request.Candidates); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	var punch models.HolePunch
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		device, err := api.actingDevice(c, tx, deviceId)
+		if err != nil {
+			return err
+		}
+
+		// only the peer answers, and only in time for both devices to still be waiting
+		result := tx.First(&punch, "id = ? AND peer_id = ? AND created_at >= ?", punchId, device.ID, time.Now().Add(-holePunchTTL))
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return errHolePunchNotFound
+		} else if result.Error != nil {
+			return result.Error
+		}
+		if punch.PunchAt != nil {
+			return NewApiResponseError(http.StatusBadRequest, models.NewApiError(errors.New("the hole punch was already answered")))
+		}
+
+		punchAt := time.Now().Add(holePunchDelay).UTC()
+		punch.PeerCandidates = request.Candidates
+		punch.PunchAt = &punchAt
+		return tx.Save(&punch).Error
+	})
+	if err != nil {
+		api.sendHolePunchError(c, err)
+		return
+	}
+
+	api.signalBus.Notify(fmt.Sprintf("/hole-punches/vpc=%s", punch.VpcID.String()))
+	setPunchIn(&punch, time.Now())
+	c.JSON(http.StatusOK, punch)
+}
+
+// ListHolePunchesInVPC lists the hole punches in a VPC
+// @Summary      List Hole Punches in a VPC
+// @Description  Lists the hole punches of the devices in a VPC
+// @Id  		 ListHolePunchesInVPC
+// @Tags         VPC
+// @Accepts		 json
+// @Produce      json
+// @Param		 gt_revision       query     uint64 false "greater than revision"
+// @Param        id                path      string  true "VPC ID"
+// @Success      200  {object}  []models.HolePunch
+// @Failure		 401  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/vpcs/{id}/hole-punches [get]
+func (api *API) ListHolePunchesInVPC(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "ListHolePunchesInVPC",
+		trace.WithAttributes(
+			attribute.String("vpc_id", c.Param("id")),
+		))
+	defer span.End()
+
+	vpcId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+	var vpc models.VPC
+	db := api.db.WithContext(ctx)
+	result := api.VPCIsReadableByCurrentUser(c, db).
+		First(&vpc, "id = ?", vpcId.String())
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("vpc"))
+		} else {
+			api.SendInternalServerError(c, result.Error)
+		}
+		return
+	}
+
+	var query Query
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err))
+		return
+	}
+
+	api.sendList(c, ctx, func(db *gorm.DB) (fetchmgr.ResourceList, error) {
+		var items holePunchList
+		db = db.Where("vpc_id = ?", vpcId.String())
+		db = FilterAndPaginateWithQuery(db, &models.HolePunch{}, c, query, "id")
+		result := db.Find(&items)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, result.Error
+		}
+		now := time.Now()
+		for _, item := range items {
+			setPunchIn(item, now)
+		}
+		return items, nil
+	})
+}
+
+// setPunchIn sets how long from now the devices punch, once the peer answered.
+func setPunchIn(punch *models.HolePunch, now time.Time) {
+	if punch.PunchAt != nil {
+		punch.PunchInMs = punch.PunchAt.Sub(now).Milliseconds()
+	}
+}
+
+// actingDevice loads a device, if the caller may act as the device.
+func (api *API) actingDevice(c *gin.Context, tx *gorm.DB, deviceId uuid.UUID) (models.Device, error) {
+	var device models.Device
+	result := api.DeviceIsOwnedByCurrentUser(c, tx).First(&device, "id = ?", deviceId)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return device, errDeviceNotFound
+	} else if result.Error != nil {
+		return device, result.Error
+	}
+
+	tokenClaims, err := NxodusClaims(c, tx)
+	if err != nil {
+		return device, err
+	}
+	if tokenClaims != nil {
+		switch tokenClaims.Scope {
+		case "reg-token":
+			if tokenClaims.ID != device.RegKeyID.String() {
+				return device, NewApiResponseError(http.StatusForbidden, models.NewApiError(errors.New("reg key does not have access")))
+			}
+		case "device-token":
+			if tokenClaims.ID != device.ID.String() {
+				return device, NewApiResponseError(http.StatusForbidden, models.NewApiError(errors.New("device token does not have access")))
+			}
+		}
+	}
+	return device, nil
+}
+
+func (api *API) sendHolePunchError(c *gin.Context, err error) {
+	var apiResponseError *ApiResponseError
+	if errors.Is(err, errDeviceNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("device"))
+	} else if errors.Is(err, errHolePunchNotFound) {
+		c.JSON(http.StatusNotFound, models.NewNotFoundError("hole_punch"))
+	} else if errors.As(err, &apiResponseError) {
+		c.JSON(apiResponseError.Status, apiResponseError.Body)
+	} else {
+		api.SendInternalServerError(c, err)
+	}
+}
+
+// validateHolePunchCandidates returns a validation error unless the candidates are ip:port endpoints.
+func validateHolePunchCandidates(candidates []string) *models.ValidationError {
+	if len(candidates) == 0 || len(candidates) > holePunchMaxCandidates {
+		validationErr := models.NewFieldValidationError("candidates", fmt.Sprintf("must hold between 1 and %d endpoints", holePunchMaxCandidates))
+		return &validationErr
+	}
+	for _, candidate := range candidates {
+		if _, err := netip.ParseAddrPort(candidate); err != nil {
+			validationErr := models.NewFieldValidationError("candidates", fmt.Sprintf("%s is not an ip:port endpoint", candidate))
+			return &validationErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func (suite *HandlerTestSuite) TestHolePunch() {
+	require := suite.Require()
+
+	createDevice := func() models.Device {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(err)
+		reqBody, err := json.Marshal(models.AddDevice{
+			VpcID:     suite.testUserID,
+			PublicKey: key.PublicKey().String(),
+		})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/", "/", suite.api.CreateDevice, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+		var device models.Device
+		require.NoError(json.Unmarshal(res.Body.Bytes(), &device))
+		return device
+	}
+	device := createDevice()
+	peer := createDevice()
+
+	start := func(request models.AddHolePunch) (int, []byte) {
+		reqBody, err := json.Marshal(request)
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPost, "/:id/hole-punches", fmt.Sprintf("/%s/hole-punches", device.ID), suite.api.CreateHolePunch, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		return res.Code, res.Body.Bytes()
+	}
+	answer := func(answering models.Device, punch models.HolePunch) (int, []byte) {
+		reqBody, err := json.Marshal(models.AnswerHolePunch{Candidates: []string{"198.51.100.7:51820"}})
+		require.NoError(err)
+		_, res, err := suite.ServeRequest(http.MethodPatch, "/:id/hole-punches/:hole_punch_id", fmt.Sprintf("/%s/hole-punches/%s", answering.ID, punch.ID), suite.api.AnswerHolePunch, bytes.NewBuffer(reqBody))
+		require.NoError(err)
+		return res.Code, res.Body.Bytes()
+	}
+
+	code, body := start(models.AddHolePunch{PeerID: peer.ID, Candidates: []string{"203.0.113.10"}})
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.JSONEq(`{"error":"203.0.113.10 is not an ip:port endpoint","field":"candidates"}`, string(body))
+
+	code, body = start(models.AddHolePunch{PeerID: device.ID, Candidates: []string{"203.0.113.10:51820"}})
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.JSONEq(`{"error":"must be another device in the vpc","field":"peer_id"}`, string(body))
+
+	code, body = start(models.AddHolePunch{PeerID: peer.ID, Candidates: []string{"203.0.113.10:51820", "203.0.113.10:51822"}})
+	require.Equal(http.StatusCreated, code, "HTTP error: %s", string(body))
+	var punch models.HolePunch
+	require.NoError(json.Unmarshal(body, &punch))
+	require.Equal(device.ID, punch.DeviceID)
+	require.Equal(peer.ID, punch.PeerID)
+	require.Nil(punch.PunchAt)
+
+	// only the peer answers
+	code, _ = answer(device, punch)
+	require.Equal(http.StatusNotFound, code)
+
+	code, body = answer(peer, punch)
+	require.Equal(http.StatusOK, code, "HTTP error: %s", string(body))
+	var answered models.HolePunch
+	require.NoError(json.Unmarshal(body, &answered))
+	require.Equal([]string{"198.51.100.7:51820"}, answered.PeerCandidates)
+	require.NotNil(answered.PunchAt)
+	require.True(answered.PunchAt.After(time.Now()))
+	// the delay is relative, so that the clocks of the devices don't matter
+	require.Greater(answered.PunchInMs, int64(0))
+	require.LessOrEqual(answered.PunchInMs, holePunchDelay.Milliseconds())
+
+	// the delay is computed again whenever the hole punch is sent
+	_, res, err := suite.ServeRequest(http.MethodGet, "/:id/hole-punches", fmt.Sprintf("/%s/hole-punches", device.VpcID), suite.api.ListHolePunchesInVPC, nil)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code, "HTTP error: %s", res.Body.String())
+	var listed []models.HolePunch
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &listed))
+	require.Len(listed, 1)
+	require.Greater(listed[0].PunchInMs, int64(0))
+	require.LessOrEqual(listed[0].PunchInMs, answered.PunchInMs)
+
+	code, _ = answer(peer, punch)
+	require.Equal(http.StatusBadRequest, code)
+
+	// a new hole punch of the pair replaces the previous one
+	code, body = start(models.AddHolePunch{PeerID: peer.ID, Candidates: []string{"203.0.113.10:51820"}})
+	require.Equal(http.StatusCreated, code, "HTTP error: %s", string(body))
+	var count int64
+	require.NoError(suite.api.db.Model(&models.HolePunch{}).Where("vpc_id = ?", device.VpcID).Count(&count).Error)
+	require.Equal(int64(1), count)
+}
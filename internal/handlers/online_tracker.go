@@ -50,7 +50,8 @@ func (ot *DeviceTracker) Connected(api *API, c *gin.Context, publicKey string, f
 
 	device := &models.Device{}
 	db := api.DeviceIsOwnedByCurrentUser(c, api.db)
-	result := db.First(&device, "public_key = ?", publicKey)
+	// devices that recently rotated their key are still found by their previous key.
+	result := db.First(&device, "public_key = ? OR (previous_public_key = ? AND previous_public_key_expires_at > ?)", publicKey, publicKey, time.Now())
 	if result.Error != nil {
 		ot.logger.Warn("cannot track: invalid device public_key", zap.String("public_key", publicKey), zap.Error(result.Error))
 		fn()
@@ -67,7 +68,7 @@ func (ot *DeviceTracker) Connected(api *API, c *gin.Context, publicKey string, f
 		device.Online = true
 		now := time.Now()
 		device.OnlineAt = &now
-		err := db.Model(device).Select("online", "online_at").Where("public_key = ?", publicKey).Updates(device).Error
+		err := db.Model(device).Select("online", "online_at").Updates(device).Error
 		if err != nil {
 			ot.logger.Warn("failed to update db state for device", zap.String("public_key", publicKey), zap.Error(err))
 			fn()
@@ -90,7 +91,7 @@ func (ot *DeviceTracker) Connected(api *API, c *gin.Context, publicKey string, f
 			}
 
 			device := &models.Device{}
-			result := db.First(&device, "public_key = ?", publicKey)
+			result := db.First(&device, "public_key = ? OR (previous_public_key = ? AND previous_public_key_expires_at > ?)", publicKey, publicKey, time.Now())
 			if result.Error != nil {
 				ot.logger.Warn("cannot track: invalid device public_key", zap.String("public_key", publicKey), zap.Error(result.Error))
 				return
@@ -99,7 +100,7 @@ func (ot *DeviceTracker) Connected(api *API, c *gin.Context, publicKey string, f
 				device.Online = false
 				now := time.Now()
 				device.OnlineAt = &now
-				err := db.Model(device).Select("online", "online_at").Where("public_key = ?", publicKey).Updates(device).Error
+				err := db.Model(device).Select("online", "online_at").Updates(device).Error
 				if err != nil {
 					ot.logger.Warn("failed to update db state for device", zap.String("public_key", publicKey), zap.Error(err))
 				}
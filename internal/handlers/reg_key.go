@@ -2,14 +2,12 @@ package handlers
 
 import (
 	_ "embed"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-jose/go-jose/v3"
 	"github.com/google/uuid"
 	"github.com/nexodus-io/nexodus/internal/database"
 	"github.com/nexodus-io/nexodus/internal/models"
@@ -91,6 +89,14 @@ func (api *API) CreateRegKey(c *gin.Context) {
 			record.SecurityGroupId = request.SecurityGroupId
 		}
 
+		if request.DeviceProfileId != nil {
+			var profile models.DeviceProfile
+			if res := db.First(&profile, "id = ? AND vpc_id = ?", *request.DeviceProfileId, vpc.ID); res.Error != nil {
+				return NewApiResponseError(http.StatusNotFound, models.NewNotFoundError("device_profile_id"))
+			}
+			record.DeviceProfileId = request.DeviceProfileId
+		}
+
 		if request.SingleUse {
 			deviceID := uuid.New()
 			record.DeviceId = &deviceID
@@ -168,6 +174,17 @@ func (api *API) UpdateRegKey(c *gin.Context) {
 			}
 			regKey.SecurityGroupId = request.SecurityGroupId
 		}
+		if request.DeviceProfileId != nil {
+			if *request.DeviceProfileId == uuid.Nil {
+				regKey.DeviceProfileId = nil
+			} else {
+				var profile models.DeviceProfile
+				if res := tx.First(&profile, "id = ? AND vpc_id = ?", *request.DeviceProfileId, regKey.VpcID); res.Error != nil {
+					return NewApiResponseError(http.StatusNotFound, models.NewNotFoundError("device_profile_id"))
+				}
+				regKey.DeviceProfileId = request.DeviceProfileId
+			}
+		}
 		if request.Description != nil {
 			regKey.Description = *request.Description
 		}
@@ -382,21 +399,10 @@ func (api *API) DeleteRegKey(c *gin.Context) {
 // @Failure      500  {object}  models.InternalServerError "Internal Server Error"
 // @Router       /device/certs [get]
 func (api *API) Certs(c *gin.Context) {
-	data, err := api.JSONWebKeySet()
+	data, err := api.JSONWebKeySet(c.Request.Context())
 	if err != nil {
 		api.SendInternalServerError(c, err)
 		return
 	}
 	c.Data(200, "application/json", data)
 }
-
-func (api *API) JSONWebKeySet() ([]byte, error) {
-	return json.Marshal(jose.JSONWebKeySet{
-		Keys: []jose.JSONWebKey{{
-			Algorithm:    "RS256",
-			Use:          "sig",
-			Key:          &api.PrivateKey.PublicKey,
-			Certificates: api.Certificates,
-		}},
-	})
-}
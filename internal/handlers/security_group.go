@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/nexodus-io/nexodus/internal/database"
@@ -29,6 +30,10 @@ const (
 	protoICMPv6 = "icmpv6"
 	protoTCP    = "tcp"
 	protoUDP    = "udp"
+	protoGRE    = "gre"
+	protoESP    = "esp"
+	protoAH     = "ah"
+	protoSCTP   = "sctp"
 )
 
 var allowedProtocols = map[string]bool{
@@ -39,6 +44,23 @@ var allowedProtocols = map[string]bool{
 	protoICMPv6: true,
 	protoTCP:    true,
 	protoUDP:    true,
+	protoGRE:    true,
+	protoESP:    true,
+	protoAH:     true,
+	protoSCTP:   true,
+}
+
+// portProtocols are the protocols, by name or IP protocol number, that rules can match destination ports for.
+var portProtocols = map[string]bool{
+	"":        true,
+	protoIPv4: true,
+	protoIPv6: true,
+	protoTCP:  true,
+	protoUDP:  true,
+	protoSCTP: true,
+	"6":       true,
+	"17":      true,
+	"132":     true,
 }
 
 type securityGroupList []*models.SecurityGroup
@@ -107,12 +129,16 @@ func (api *API) ListSecurityGroups(c *gin.Context) {
 		if err != nil {
 			return nil, err
 		}
+		grantsDB := db
 		db = api.SecurityGroupIsReadableByCurrentUser(c, db)
 		db = FilterAndPaginateWithQuery(db, &models.SecurityGroup{}, c, query, "description")
 		result := db.Find(&items)
 		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, result.Error
 		}
+		if err := loadActiveGrants(grantsDB, items...); err != nil {
+			return nil, err
+		}
 		return items, nil
 	})
 }
@@ -164,6 +190,7 @@ func (api *API) ListSecurityGroupsInVPC(c *gin.Context) {
 
 	api.sendList(c, ctx, func(db *gorm.DB) (fetchmgr.ResourceList, error) {
 		var items securityGroupList
+		grantsDB := db
 
 		if api.dialect == database.DialectSqlLite {
 			db = db.Where("organization_id in (SELECT DISTINCT organization_id FROM devices where vpc_id=?)", vpcId.String())
@@ -176,6 +203,9 @@ func (api *API) ListSecurityGroupsInVPC(c *gin.Context) {
 		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, result.Error
 		}
+		if err := loadActiveGrants(grantsDB, items...); err != nil {
+			return nil, err
+		}
 		return items, nil
 	})
 }
@@ -207,14 +237,17 @@ func (api *API) GetSecurityGroup(c *gin.Context) {
 	}
 
 	db := api.db.WithContext(ctx)
-	db = api.SecurityGroupIsReadableByCurrentUser(c, db)
 	var securityGroup models.SecurityGroup
-	result := db.
+	result := api.SecurityGroupIsReadableByCurrentUser(c, db).
 		First(&securityGroup, "id = ?", k)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		c.Status(http.StatusNotFound)
 		return
 	}
+	if err := loadActiveGrants(db, &securityGroup); err != nil {
+		api.SendInternalServerError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, securityGroup)
 }
 
@@ -251,16 +284,7 @@ func (api *API) CreateSecurityGroup(c *gin.Context) {
 
 	// Validate security group rules for any invalid fields in ports/ip_ranges/protocol
 	if err := ValidateCreateSecurityGroupRules(request); err != nil {
-		switch {
-		case strings.Contains(err.Error(), "invalid protocol"):
-			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("protocol", err.Error()))
-		case strings.Contains(err.Error(), "invalid port range"):
-			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("port_range", err.Error()))
-		case strings.Contains(err.Error(), "invalid IP range"):
-			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("ip_range", err.Error()))
-		default:
-			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("rule", "invalid rule"))
-		}
+		sendRuleValidationError(c, err)
 		return
 	}
 
@@ -308,9 +332,9 @@ func (api *API) CreateSecurityGroup(c *gin.Context) {
 	c.JSON(http.StatusCreated, sg)
 }
 
-func (api *API) notifySecurityGroupChange(c *gin.Context, orgId uuid.UUID) {
+func (api *API) notifySecurityGroupChange(ctx context.Context, orgId uuid.UUID) {
 	vpcIds := []uuid.UUID{}
-	db := api.db.WithContext(c)
+	db := api.db.WithContext(ctx)
 	result := db.Model(&models.VPC{}).
 		Where("organization_id = ?", orgId).
 		Distinct().
@@ -448,16 +472,7 @@ func (api *API) UpdateSecurityGroup(c *gin.Context) {
 
 	// Validate security group rules for any invalid fields in ports/ip_ranges/protocol
 	if err := ValidateUpdateSecurityGroupRules(request); err != nil {
-		switch {
-		case strings.Contains(err.Error(), "invalid protocol"):
-			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("protocol", err.Error()))
-		case strings.Contains(err.Error(), "invalid port range"):
-			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("port_range", err.Error()))
-		case strings.Contains(err.Error(), "invalid IP range"):
-			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("ip_range", err.Error()))
-		default:
-			c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("rule", "invalid rule"))
-		}
+		sendRuleValidationError(c, err)
 		return
 	}
 
@@ -552,11 +567,32 @@ func ValidateCreateSecurityGroupRules(sg models.AddSecurityGroup) error {
 	return nil
 }
 
+// sendRuleValidationError maps a ValidateRule error to the field that failed validation.
+func sendRuleValidationError(c *gin.Context, err error) {
+	switch {
+	case strings.Contains(err.Error(), "invalid protocol"):
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("protocol", err.Error()))
+	case strings.Contains(err.Error(), "invalid port range"):
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("port_range", err.Error()))
+	case strings.Contains(err.Error(), "invalid ports"):
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("ports", err.Error()))
+	case strings.Contains(err.Error(), "invalid ICMP"):
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("icmp", err.Error()))
+	case strings.Contains(err.Error(), "invalid IP range"):
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("ip_range", err.Error()))
+	default:
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("rule", "invalid rule"))
+	}
+}
+
 // ValidateRule validates individual rule
 func ValidateRule(rule models.SecurityRule) error {
-	// Validate Protocol
+	// Validate Protocol, either a known name or an IP protocol number
 	if rule.IpProtocol != "" && !allowedProtocols[rule.IpProtocol] {
-		return fmt.Errorf("invalid protocol: %s", rule.IpProtocol)
+		number, err := strconv.ParseUint(rule.IpProtocol, 10, 8)
+		if err != nil || strconv.FormatUint(number, 10) != rule.IpProtocol {
+			return fmt.Errorf("invalid protocol: %s", rule.IpProtocol)
+		}
 	}
 
 	// Validate Ports
@@ -570,6 +606,36 @@ func ValidateRule(rule models.SecurityRule) error {
 		return fmt.Errorf("invalid port range: from %d to %d", rule.FromPort, rule.ToPort)
 	}
 
+	// Validate Ports list
+	if len(rule.Ports) > 0 && (rule.FromPort != 0 || rule.ToPort != 0) {
+		return fmt.Errorf("invalid ports: ports can not be combined with a from_port/to_port range")
+	}
+	for _, port := range rule.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid ports: %d is not in the range 1-65535", port)
+		}
+	}
+	if (len(rule.Ports) > 0 || rule.FromPort != 0) && !portProtocols[rule.IpProtocol] {
+		return fmt.Errorf("invalid ports: protocol %s does not have ports", rule.IpProtocol)
+	}
+
+	// Validate ICMP types and codes
+	if len(rule.IcmpTypes) > 0 || len(rule.IcmpCodes) > 0 {
+		if rule.IpProtocol != protoICMPv4 && rule.IpProtocol != protoICMPv6 {
+			return fmt.Errorf("invalid ICMP match: icmp_types and icmp_codes require the %s or %s protocol", protoICMPv4, protoICMPv6)
+		}
+		if len(rule.IcmpTypes) == 0 {
+			return fmt.Errorf("invalid ICMP match: icmp_codes require icmp_types")
+		}
+	}
+	for _, values := range [][]int64{rule.IcmpTypes, rule.IcmpCodes} {
+		for _, value := range values {
+			if value < 0 || value > 255 {
+				return fmt.Errorf("invalid ICMP match: %d is not in the range 0-255", value)
+			}
+		}
+	}
+
 	// Validate IP Ranges
 	for _, ipRange := range rule.IpRanges {
 		if ipRange == "" { // Wildcard case
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// ListSecurityGroupGrants lists the grants of a Security Group
+// @Summary      List Security Group Grants
+// @Description  Lists the active and expired grants of a Security Group
+// @Id           ListSecurityGroupGrants
+// @Tags         SecurityGroup
+// @Accepts      json
+// @Produce      json
+// @Param        id   path      string  true "Security Group ID"
+// @Success      200  {object}  []models.SecurityGroupGrant
+// @Failure      400  {object}  models.BaseError
+// @Failure      401  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/security-groups/{id}/grants [get]
+func (api *API) ListSecurityGroupGrants(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "ListSecurityGroupGrants", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+
+	k, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	db := api.db.WithContext(ctx)
+	var securityGroup models.SecurityGroup
+	result := api.SecurityGroupIsReadableByCurrentUser(c, db).
+		First(&securityGroup, "id = ?", k)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("security_group"))
+		} else {
+			api.SendInternalServerError(c, result.Error)
+		}
+		return
+	}
+
+	grants := []models.SecurityGroupGrant{}
+	result = db.Where("security_group_id = ?", securityGroup.ID).
+		Order("created_at DESC").
+		Find(&grants)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		api.SendInternalServerError(c, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, grants)
+}
+
+// CreateSecurityGroupGrant handles adding a new time-bound grant to a Security Group
+// @Summary      Add Security Group Grant
+// @Description  Temporarily adds a rule to a Security Group until the grant expires
+// @Id           CreateSecurityGroupGrant
+// @Tags         SecurityGroup
+// @Accepts      json
+// @Produce      json
+// @Param        id     path      string                        true "Security Group ID"
+// @Param        Grant  body      models.AddSecurityGroupGrant  true "Add Security Group Grant"
+// @Success      201  {object}  models.SecurityGroupGrant
+// @Failure      400  {object}  models.BaseError
+// @Failure      401  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      422  {object}  models.ValidationError
+// @Failure      429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/security-groups/{id}/grants [post]
+func (api *API) CreateSecurityGroupGrant(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "CreateSecurityGroupGrant", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+
+	if !api.FlagCheck(c, "security-groups") {
+		return
+	}
+
+	k, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var request models.AddSecurityGroupGrant
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPayloadError(err))
+		return
+	}
+
+	if request.Direction != models.GrantDirectionInbound && request.Direction != models.GrantDirectionOutbound {
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("direction", "must be inbound or outbound"))
+		return
+	}
+	if request.ExpiresAt.IsZero() {
+		c.JSON(http.StatusBadRequest, models.NewFieldNotPresentError("expires_at"))
+		return
+	}
+	if !request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusUnprocessableEntity, models.NewFieldValidationError("expires_at", "must be in the future"))
+		return
+	}
+	if err := ValidateRule(request.Rule); err != nil {
+		sendRuleValidationError(c, err)
+		return
+	}
+
+	var grant models.SecurityGroupGrant
+	var securityGroup models.SecurityGroup
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		result := api.SecurityGroupIsWriteableByCurrentUser(c, tx).
+			First(&securityGroup, "id = ?", k)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return errSecurityGroupNotFound
+			}
+			return result.Error
+		}
+
+		grant = models.SecurityGroupGrant{
+			SecurityGroupId: securityGroup.ID,
+			VpcId:           securityGroup.VpcId,
+			OrganizationID:  securityGroup.OrganizationID,
+			Direction:       request.Direction,
+			Rule:            request.Rule,
+			Requester:       request.Requester,
+			ApproverID:      api.GetCurrentUserID(c),
+			Reason:          request.Reason,
+			ExpiresAt:       request.ExpiresAt,
+		}
+		if res := tx.Create(&grant); res.Error != nil {
+			return res.Error
+		}
+		return touchSecurityGroup(tx, securityGroup.ID)
+	})
+
+	if err != nil {
+		if errors.Is(err, errSecurityGroupNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("security_group"))
+		} else {
+			api.SendInternalServerError(c, err)
+		}
+		return
+	}
+
+	api.logger.Infof("Security group grant [ %s ] created for security group [ %s ] until %s", grant.ID, securityGroup.ID, grant.ExpiresAt)
+	api.notifySecurityGroupChange(c, securityGroup.VpcId)
+	c.JSON(http.StatusCreated, grant)
+}
+
+// RevokeSecurityGroupGrant ends a Security Group Grant before it expires
+// @Summary      Revoke Security Group Grant
+// @Description  Ends a Security Group Grant before it expires, the grant is kept for review
+// @Id           RevokeSecurityGroupGrant
+// @Tags         SecurityGroup
+// @Accepts      json
+// @Produce      json
+// @Param        id     path      string  true "Security Group ID"
+// @Param        grant  path      string  true "Grant ID"
+// @Success      200  {object}  models.SecurityGroupGrant
+// @Failure      400  {object}  models.BaseError
+// @Failure      401  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure      429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/security-groups/{id}/grants/{grant} [delete]
+func (api *API) RevokeSecurityGroupGrant(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "RevokeSecurityGroupGrant", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+		attribute.String("grant", c.Param("grant")),
+	))
+	defer span.End()
+
+	if !api.FlagCheck(c, "security-groups") {
+		return
+	}
+
+	k, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+	grantId, err := uuid.Parse(c.Param("grant"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("grant"))
+		return
+	}
+
+	var grant models.SecurityGroupGrant
+	var securityGroup models.SecurityGroup
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		result := api.SecurityGroupIsWriteableByCurrentUser(c, tx).
+			First(&securityGroup, "id = ?", k)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return errSecurityGroupNotFound
+			}
+			return result.Error
+		}
+
+		result = tx.First(&grant, "id = ? AND security_group_id = ?", grantId, securityGroup.ID)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return NewApiResponseError(http.StatusNotFound, models.NewNotFoundError("grant"))
+			}
+			return result.Error
+		}
+		if grant.ExpiredAt != nil {
+			// already removed from the security group, nothing to do.
+			return nil
+		}
+
+		now := time.Now()
+		grant.ExpiresAt = now
+		grant.ExpiredAt = &now
+		if res := tx.Model(&grant).Select("expires_at", "expired_at").Updates(&grant); res.Error != nil {
+			return res.Error
+		}
+		return touchSecurityGroup(tx, securityGroup.ID)
+	})
+
+	if err != nil {
+		var apiResponseError *ApiResponseError
+		if errors.Is(err, errSecurityGroupNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("security_group"))
+		} else if errors.As(err, &apiResponseError) {
+			c.JSON(apiResponseError.Status, apiResponseError.Body)
+		} else {
+			api.SendInternalServerError(c, err)
+		}
+		return
+	}
+
+	api.notifySecurityGroupChange(c, securityGroup.VpcId)
+	c.JSON(http.StatusOK, grant)
+}
+
+// ExpireSecurityGroupGrants removes the grants that have reached their expiry time from their security groups.
+func (api *API) ExpireSecurityGroupGrants(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "ExpireSecurityGroupGrants")
+	defer span.End()
+
+	var expired []models.SecurityGroupGrant
+	err := api.transaction(ctx, func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Where("expired_at IS NULL AND expires_at <= ?", now).
+			Find(&expired)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+
+		touched := map[uuid.UUID]bool{}
+		for i := range expired {
+			grant := &expired[i]
+			grant.ExpiredAt = &now
+			if res := tx.Model(grant).Select("expired_at").Updates(grant); res.Error != nil {
+				return res.Error
+			}
+			if touched[grant.SecurityGroupId] {
+				continue
+			}
+			touched[grant.SecurityGroupId] = true
+			if err := touchSecurityGroup(tx, grant.SecurityGroupId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	notified := map[uuid.UUID]bool{}
+	for _, grant := range expired {
+		api.logger.Infof("Security group grant [ %s ] for security group [ %s ] expired", grant.ID, grant.SecurityGroupId)
+		if notified[grant.VpcId] {
+			continue
+		}
+		notified[grant.VpcId] = true
+		api.notifySecurityGroupChange(ctx, grant.VpcId)
+	}
+	return nil
+}
+
+// touchSecurityGroup bumps the revision of the security group so that watchers pick up grant changes.
+func touchSecurityGroup(tx *gorm.DB, id uuid.UUID) error {
+	res := tx.Model(&models.SecurityGroup{}).
+		Where("id = ?", id).
+		Update("updated_at", time.Now())
+	if res.Error != nil && !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return res.Error
+	}
+	return nil
+}
+
+// loadActiveGrants populates the Grants field of the security groups with the grants that have not expired yet.
+func loadActiveGrants(db *gorm.DB, groups ...*models.SecurityGroup) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(groups))
+	for _, sg := range groups {
+		ids = append(ids, sg.ID)
+	}
+
+	var grants []models.SecurityGroupGrant
+	result := db.Where("security_group_id IN ? AND expired_at IS NULL", ids).
+		Order("created_at").
+		Find(&grants)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to load security group grants: %w", result.Error)
+	}
+
+	bySecurityGroup := map[uuid.UUID][]models.SecurityGroupGrant{}
+	for _, grant := range grants {
+		bySecurityGroup[grant.SecurityGroupId] = append(bySecurityGroup[grant.SecurityGroupId], grant)
+	}
+	for _, sg := range groups {
+		sg.Grants = bySecurityGroup[sg.ID]
+	}
+	return nil
+}
@@ -2,15 +2,20 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
 
 	"github.com/nexodus-io/nexodus/internal/util"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nexodus-io/nexodus/internal/models"
+	"github.com/stretchr/testify/require"
 )
 
 func (suite *HandlerTestSuite) TestCreateGetSecurityGroups() {
@@ -425,3 +430,156 @@ func (suite *HandlerTestSuite) TestInvalidUpdateSecurityGroup() {
 	// Should be http.StatusStatusUnprocessableEntity.
 	require.Equal(http.StatusUnprocessableEntity, res.Code)
 }
+
+func (suite *HandlerTestSuite) TestSecurityGroupGrants() {
+	require := suite.Require()
+	assert := suite.Assert()
+
+	newGroup := models.AddSecurityGroup{
+		Description:  "db-prod",
+		VpcId:        suite.testUserID,
+		InboundRules: []models.SecurityRule{{IpProtocol: "tcp", FromPort: 22, ToPort: 22, IpRanges: []string{"10.0.0.0/8"}}},
+	}
+	_, res, err := suite.ServeRequest(
+		http.MethodPost,
+		"/security-groups", "/security-groups",
+		func(c *gin.Context) {
+			c.Set("nexodus.fflag.security-groups", true)
+			suite.api.CreateSecurityGroup(c)
+		},
+		bytes.NewBuffer(suite.jsonMarshal(newGroup)),
+	)
+	require.NoError(err)
+	require.Equal(http.StatusCreated, res.Code)
+	var group models.SecurityGroup
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &group))
+
+	createGrant := func(grant models.AddSecurityGroupGrant) *httptest.ResponseRecorder {
+		_, res, err := suite.ServeRequest(
+			http.MethodPost,
+			"/security-groups/:id/grants", fmt.Sprintf("/security-groups/%s/grants", group.ID),
+			func(c *gin.Context) {
+				c.Set("nexodus.fflag.security-groups", true)
+				suite.api.CreateSecurityGroupGrant(c)
+			},
+			bytes.NewBuffer(suite.jsonMarshal(grant)),
+		)
+		require.NoError(err)
+		return res
+	}
+
+	rule := models.SecurityRule{IpProtocol: "tcp", FromPort: 5432, ToPort: 5432, IpRanges: []string{"100.64.0.5"}}
+
+	// invalid grants are rejected
+	res = createGrant(models.AddSecurityGroupGrant{Direction: "sideways", Rule: rule, ExpiresAt: time.Now().Add(time.Hour)})
+	require.Equal(http.StatusUnprocessableEntity, res.Code)
+	res = createGrant(models.AddSecurityGroupGrant{Direction: "inbound", Rule: rule, ExpiresAt: time.Now().Add(-time.Hour)})
+	require.Equal(http.StatusUnprocessableEntity, res.Code)
+	res = createGrant(models.AddSecurityGroupGrant{Direction: "inbound", Rule: models.SecurityRule{IpProtocol: "tcp", FromPort: 10, ToPort: 1}, ExpiresAt: time.Now().Add(time.Hour)})
+	require.Equal(http.StatusUnprocessableEntity, res.Code)
+
+	res = createGrant(models.AddSecurityGroupGrant{
+		Direction: "inbound",
+		Rule:      rule,
+		Requester: "alice",
+		Reason:    "debug replication lag",
+		ExpiresAt: time.Now().Add(2 * time.Hour),
+	})
+	require.Equal(http.StatusCreated, res.Code, "HTTP error: %s", res.Body.String())
+	var grant models.SecurityGroupGrant
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &grant))
+	assert.Equal(group.ID, grant.SecurityGroupId)
+	assert.Equal(suite.testUserID, grant.ApproverID)
+	assert.Equal("alice", grant.Requester)
+	assert.Nil(grant.ExpiredAt)
+
+	getGroup := func() models.SecurityGroup {
+		_, res, err := suite.ServeRequest(
+			http.MethodGet, "/security-groups/:id", fmt.Sprintf("/security-groups/%s", group.ID),
+			suite.api.GetSecurityGroup, nil,
+		)
+		require.NoError(err)
+		require.Equal(http.StatusOK, res.Code)
+		var actual models.SecurityGroup
+		require.NoError(json.Unmarshal(res.Body.Bytes(), &actual))
+		return actual
+	}
+
+	// the active grant is delivered with the security group
+	actual := getGroup()
+	require.Len(actual.Grants, 1)
+	assert.Equal(grant.ID, actual.Grants[0].ID)
+	assert.Equal(rule, actual.Grants[0].Rule)
+
+	// once the grant expires, it is removed from the security group but kept for review
+	require.NoError(suite.api.db.Model(&models.SecurityGroupGrant{}).
+		Where("id = ?", grant.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	require.NoError(suite.api.ExpireSecurityGroupGrants(context.Background()))
+
+	actual = getGroup()
+	assert.Len(actual.Grants, 0)
+
+	_, res, err = suite.ServeRequest(
+		http.MethodGet, "/security-groups/:id/grants", fmt.Sprintf("/security-groups/%s/grants", group.ID),
+		suite.api.ListSecurityGroupGrants, nil,
+	)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code)
+	var grants []models.SecurityGroupGrant
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &grants))
+	require.Len(grants, 1)
+	assert.NotNil(grants[0].ExpiredAt)
+
+	// grants can be revoked before they expire
+	res = createGrant(models.AddSecurityGroupGrant{Direction: "outbound", Rule: rule, ExpiresAt: time.Now().Add(time.Hour)})
+	require.Equal(http.StatusCreated, res.Code)
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &grant))
+
+	_, res, err = suite.ServeRequest(
+		http.MethodDelete, "/security-groups/:id/grants/:grant", fmt.Sprintf("/security-groups/%s/grants/%s", group.ID, grant.ID),
+		func(c *gin.Context) {
+			c.Set("nexodus.fflag.security-groups", true)
+			suite.api.RevokeSecurityGroupGrant(c)
+		},
+		nil,
+	)
+	require.NoError(err)
+	require.Equal(http.StatusOK, res.Code)
+	require.NoError(json.Unmarshal(res.Body.Bytes(), &grant))
+	assert.NotNil(grant.ExpiredAt)
+	assert.Len(getGroup().Grants, 0)
+}
+
+func TestValidateRule(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rule  models.SecurityRule
+		valid bool
+	}{
+		{"protocol name", models.SecurityRule{IpProtocol: "gre"}, true},
+		{"protocol number", models.SecurityRule{IpProtocol: "47"}, true},
+		{"protocol number out of range", models.SecurityRule{IpProtocol: "256"}, false},
+		{"protocol number with leading zero", models.SecurityRule{IpProtocol: "047"}, false},
+		{"port list", models.SecurityRule{IpProtocol: "tcp", Ports: []int64{22, 443}}, true},
+		{"port list on sctp number", models.SecurityRule{IpProtocol: "132", Ports: []int64{3868}}, true},
+		{"port list out of range", models.SecurityRule{IpProtocol: "tcp", Ports: []int64{0}}, false},
+		{"port list and range", models.SecurityRule{IpProtocol: "tcp", Ports: []int64{22}, FromPort: 80, ToPort: 90}, false},
+		{"ports on a protocol without ports", models.SecurityRule{IpProtocol: "esp", Ports: []int64{22}}, false},
+		{"icmp type and code", models.SecurityRule{IpProtocol: "icmpv4", IcmpTypes: []int64{8}, IcmpCodes: []int64{0}}, true},
+		{"icmpv6 type", models.SecurityRule{IpProtocol: "icmpv6", IcmpTypes: []int64{128, 129}}, true},
+		{"icmp code without type", models.SecurityRule{IpProtocol: "icmpv4", IcmpCodes: []int64{0}}, false},
+		{"icmp type out of range", models.SecurityRule{IpProtocol: "icmpv4", IcmpTypes: []int64{256}}, false},
+		{"icmp type on tcp", models.SecurityRule{IpProtocol: "tcp", IcmpTypes: []int64{8}}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRule(tc.rule)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/nexodus-io/nexodus/internal/database"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"github.com/nexodus-io/nexodus/internal/util/cache"
+	"gorm.io/gorm"
+)
+
+const (
+	// how long the signing keys loaded from the database are cached
+	signingKeysCacheTTL = 30 * time.Second
+	// a new signing key is published this long before it is used to sign, so that every apiserver has loaded it by then
+	signingKeyActivationDelay = 2 * signingKeysCacheTTL
+	// a replaced signing key is still published for this long, so that tokens it signed which are still in flight can be verified
+	signingKeyGracePeriod = time.Hour
+	// the PostgreSQL advisory lock held while deciding whether to rotate the signing keys
+	signingKeyRotationLock = 0x6e65786b6579
+	// prefix of the private keys stored encrypted, keys stored before are plain PEM
+	encryptedSigningKeyPrefix = "enc:"
+)
+
+// signingKey is a key that is published in the JWKS of the apiserver.
+type signingKey struct {
+	kid         string
+	key         *rsa.PrivateKey
+	activatesAt time.Time
+	certs       []*x509.Certificate
+	configured  bool // the key the apiserver was configured with
+}
+
+func newSigningKeysCache() *cache.MemoizeCache[string, []signingKey] {
+	return cache.NewMemoizeCache[string, []signingKey](signingKeysCacheTTL, 5*time.Second)
+}
+
+// signingKeyID returns the kid of a key, the base64url encoded JWK thumbprint of its public key.
+func signingKeyID(key *rsa.PublicKey) (string, error) {
+	thumbprint, err := (&jose.JSONWebKey{Key: key}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// signingKeys returns the published signing keys in the order they were activated, starting
+// with the key the apiserver was configured with until it is retired.
+func (api *API) signingKeys(ctx context.Context) ([]signingKey, error) {
+	return api.signingKeysCache.MemoizeCanErr("", func() ([]signingKey, error) {
+		return api.loadSigningKeys(ctx)
+	})
+}
+
+func (api *API) loadSigningKeys(ctx context.Context) ([]signingKey, error) {
+	var records []models.SigningKey
+	if result := api.db.WithContext(ctx).
+		Order("activates_at").
+		Find(&records); result.Error != nil {
+		return nil, result.Error
+	}
+
+	now := time.Now()
+	var keys []signingKey
+	// the configured key is retired once a rotated key has replaced it for longer than the grace period
+	retired := false
+	for _, record := range records {
+		privateKey, err := api.openSigningKey(record.PrivateKey)
+		if err != nil {
+			// likely sealed with a tls-key the apiserver is no longer configured with
+			api.logger.Warnf("Skipping signing key [ %s ]: %v", record.ID, err)
+			continue
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %w", record.ID, err)
+		}
+		if !record.ActivatesAt.Add(signingKeyGracePeriod).After(now) {
+			retired = true
+		}
+		if record.ExpiresAt != nil && !record.ExpiresAt.After(now) {
+			continue
+		}
+		keys = append(keys, signingKey{
+			kid:         record.ID,
+			key:         key,
+			activatesAt: record.ActivatesAt,
+		})
+	}
+
+	if api.PrivateKey != nil && !retired {
+		kid, err := signingKeyID(&api.PrivateKey.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append([]signingKey{{
+			kid:        kid,
+			key:        api.PrivateKey,
+			certs:      api.Certificates,
+			configured: true,
+		}}, keys...)
+	}
+	return keys, nil
+}
+
+// signingKeyCipher returns the cipher that encrypts the stored signing keys, its key is derived from the
+// configured tls-key so that a database dump alone does not expose them.
+func (api *API) signingKeyCipher() (cipher.AEAD, error) {
+	if api.PrivateKey == nil {
+		return nil, errors.New("no tls-key configured")
+	}
+	secret := sha256.Sum256(append([]byte("nexodus signing keys:"), x509.MarshalPKCS1PrivateKey(api.PrivateKey)...))
+	block, err := aes.NewCipher(secret[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSigningKey encrypts a PEM encoded private key to be stored.
+func (api *API) sealSigningKey(privateKey []byte) (string, error) {
+	aead, err := api.signingKeyCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, privateKey, nil)
+	return encryptedSigningKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSigningKey decrypts a stored private key, keys stored before they were encrypted are returned as is.
+func (api *API) openSigningKey(stored string) ([]byte, error) {
+	if !strings.HasPrefix(stored, encryptedSigningKeyPrefix) {
+		return []byte(stored), nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedSigningKeyPrefix))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := api.signingKeyCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed key is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// activeSigningKey returns the most recently activated key.
+func activeSigningKey(keys []signingKey, now time.Time) (signingKey, error) {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !keys[i].activatesAt.After(now) {
+			return keys[i], nil
+		}
+	}
+	return signingKey{}, errors.New("no active signing key")
+}
+
+// signJWT signs the claims with the active signing key.
+func (api *API) signJWT(ctx context.Context, claims jwt.Claims) (string, error) {
+	keys, err := api.signingKeys(ctx)
+	if err != nil {
+		return "", err
+	}
+	key, err := activeSigningKey(keys, time.Now())
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.key)
+}
+
+// verifyJWT parses a JWT issued by the apiserver, it must be signed by one of the published keys.
+func (api *API) verifyJWT(ctx context.Context, tokenString string, claims jwt.Claims) error {
+	keys, err := api.signingKeys(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		for _, k := range keys {
+			// tokens issued before they carried a kid were signed by the configured key
+			if k.kid == kid || (kid == "" && k.configured) {
+				return &k.key.PublicKey, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	})
+	return err
+}
+
+// JSONWebKeySet returns the JWKS used to verify the JWTs issued by the apiserver.
+func (api *API) JSONWebKeySet(ctx context.Context) ([]byte, error) {
+	keys, err := api.signingKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	for _, k := range keys {
+		jwks.Keys = append(jwks.Keys, jose.JSONWebKey{
+			KeyID:        k.kid,
+			Algorithm:    "RS256",
+			Use:          "sig",
+			Key:          &k.key.PublicKey,
+			Certificates: k.certs,
+		})
+	}
+	return json.Marshal(jwks)
+}
+
+// RotateSigningKeys generates a new signing key once the active one is older than the
+// SigningKeyRotationInterval. The key it replaces stays published for a grace period.
+func (api *API) RotateSigningKeys(ctx context.Context) error {
+	if api.SigningKeyRotationInterval <= 0 {
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, "RotateSigningKeys")
+	defer span.End()
+
+	var rotated *models.SigningKey
+	err := api.transaction(ctx, func(tx *gorm.DB) error {
+		// every apiserver replica rotates on the same schedule, only one of them may generate the next key. The
+		// others wait for it and then see its key as the latest one. CockroachDB runs the transaction serializable
+		// and retries the replicas that lose the race instead.
+		if api.dialect == database.DialectPostgreSQL {
+			if result := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyRotationLock); result.Error != nil {
+				return result.Error
+			}
+		}
+
+		now := time.Now()
+		if result := tx.Where("expires_at <= ?", now).Delete(&models.SigningKey{}); result.Error != nil {
+			return result.Error
+		}
+
+		var latest []models.SigningKey
+		if result := tx.Order("activates_at desc").Limit(1).Find(&latest); result.Error != nil {
+			return result.Error
+		}
+		if len(latest) > 0 && now.Before(latest[0].ActivatesAt.Add(api.SigningKeyRotationInterval)) {
+			return nil
+		}
+
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		kid, err := signingKeyID(&key.PublicKey)
+		if err != nil {
+			return err
+		}
+		activatesAt := now.Add(signingKeyActivationDelay)
+		expiresAt := activatesAt.Add(signingKeyGracePeriod)
+		if result := tx.Model(&models.SigningKey{}).
+			Where("expires_at IS NULL").
+			Update("expires_at", expiresAt); result.Error != nil {
+			return result.Error
+		}
+
+		privateKey, err := api.sealSigningKey(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}))
+		if err != nil {
+			return err
+		}
+		rotated = &models.SigningKey{
+			ID:          kid,
+			PrivateKey:  privateKey,
+			ActivatesAt: activatesAt,
+		}
+		return tx.Create(rotated).Error
+	})
+	if err != nil {
+		return err
+	}
+	if rotated != nil {
+		api.logger.Infof("Signing key [ %s ] will be used to sign tokens from %s", rotated.ID, rotated.ActivatesAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/nexodus-io/nexodus/internal/models"
+)
+
+func (suite *HandlerTestSuite) TestRotateSigningKeys() {
+	require := suite.Require()
+	ctx := context.Background()
+	defer func() {
+		suite.api.SigningKeyRotationInterval = 0
+		suite.api.db.Exec("DELETE FROM signing_keys")
+		suite.api.signingKeysCache = newSigningKeysCache()
+	}()
+
+	sign := func() (string, string) {
+		token, err := suite.api.signJWT(ctx, models.NexodusClaims{Scope: "device-token"})
+		require.NoError(err)
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &models.NexodusClaims{})
+		require.NoError(err)
+		return token, parsed.Header["kid"].(string)
+	}
+	publishedKids := func() []string {
+		data, err := suite.api.JSONWebKeySet(ctx)
+		require.NoError(err)
+		var jwks jose.JSONWebKeySet
+		require.NoError(json.Unmarshal(data, &jwks))
+		var kids []string
+		for _, k := range jwks.Keys {
+			kids = append(kids, k.KeyID)
+		}
+		return kids
+	}
+
+	// without rotation the configured key signs the tokens
+	configuredToken, configuredKid := sign()
+	require.Equal([]string{configuredKid}, publishedKids())
+	require.NoError(suite.api.RotateSigningKeys(ctx))
+	var count int64
+	require.NoError(suite.api.db.Model(&models.SigningKey{}).Count(&count).Error)
+	require.Equal(int64(0), count)
+
+	// a new key is published before it is used to sign
+	suite.api.SigningKeyRotationInterval = time.Hour
+	require.NoError(suite.api.RotateSigningKeys(ctx))
+	require.NoError(suite.api.RotateSigningKeys(ctx))
+	var keys []models.SigningKey
+	require.NoError(suite.api.db.Find(&keys).Error)
+	require.Len(keys, 1)
+	// the stored private key is encrypted
+	require.NotContains(keys[0].PrivateKey, "PRIVATE KEY")
+	suite.api.signingKeysCache = newSigningKeysCache()
+	require.Equal([]string{configuredKid, keys[0].ID}, publishedKids())
+	_, kid := sign()
+	require.Equal(configuredKid, kid)
+
+	// once active, the new key signs and tokens of both keys are accepted
+	require.NoError(suite.api.db.Model(&models.SigningKey{}).Where("id = ?", keys[0].ID).
+		Update("activates_at", time.Now().Add(-time.Minute)).Error)
+	suite.api.signingKeysCache = newSigningKeysCache()
+	rotatedToken, kid := sign()
+	require.Equal(keys[0].ID, kid)
+	require.NoError(suite.api.verifyJWT(ctx, configuredToken, &models.NexodusClaims{}))
+	require.NoError(suite.api.verifyJWT(ctx, rotatedToken, &models.NexodusClaims{}))
+
+	// the configured key is retired once the new key has been active for the grace period
+	require.NoError(suite.api.db.Model(&models.SigningKey{}).Where("id = ?", keys[0].ID).
+		Update("activates_at", time.Now().Add(-2*time.Hour)).Error)
+	suite.api.signingKeysCache = newSigningKeysCache()
+	require.Equal([]string{keys[0].ID}, publishedKids())
+	require.Error(suite.api.verifyJWT(ctx, configuredToken, &models.NexodusClaims{}))
+	require.NoError(suite.api.verifyJWT(ctx, rotatedToken, &models.NexodusClaims{}))
+
+	// the next rotation replaces the key, it stays published for the grace period
+	require.NoError(suite.api.RotateSigningKeys(ctx))
+	keys = nil
+	require.NoError(suite.api.db.Order("activates_at").Find(&keys).Error)
+	require.Len(keys, 2)
+	require.NotNil(keys[0].ExpiresAt)
+	require.Nil(keys[1].ExpiresAt)
+	suite.api.signingKeysCache = newSigningKeysCache()
+	require.NoError(suite.api.verifyJWT(ctx, rotatedToken, &models.NexodusClaims{}))
+
+	// and is dropped once it expires
+	require.NoError(suite.api.db.Model(&models.SigningKey{}).Where("id = ?", keys[0].ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	suite.api.signingKeysCache = newSigningKeysCache()
+	require.Equal([]string{keys[1].ID}, publishedKids())
+	require.Error(suite.api.verifyJWT(ctx, rotatedToken, &models.NexodusClaims{}))
+}
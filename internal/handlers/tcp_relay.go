@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nexodus-io/nexodus/internal/models"
+	"github.com/nexodus-io/nexodus/internal/util"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	// every packet relayed over a websocket is preceded by a device id. Devices address their packets
+	// with the id of the peer, the relay replaces it with the id of the sending device.
+	tcpRelayFrameHeader = 16
+	// wireguard packets are much smaller, larger frames are dropped
+	tcpRelayMaxFrame = 64 * 1024
+	// how many frames are queued for a device, more are dropped as a congested network drops udp packets
+	tcpRelaySendQueue = 256
+	// how long a write to a device may take before its websocket is closed
+	tcpRelayWriteTimeout = 5 * time.Second
+	// the redis channel packets for a device connected to another api-server replica are published to
+	tcpRelayChannelPrefix = "tcp-relay:"
+)
+
+// tcpRelay forwards the wireguard packets of devices that can not use UDP between their websockets.
+// Devices connected to another api-server replica are reached through redis.
+type tcpRelay struct {
+	mu     sync.Mutex
+	conns  map[uuid.UUID]*tcpRelayConn
+	redis  *redis.Client
+	logger *zap.SugaredLogger
+}
+
+// tcpRelayConn is the websocket of a device, the frames for it are written by its own goroutine so that a slow device
+// does not hold up the devices relaying packets to it.
+type tcpRelayConn struct {
+	ws    *websocket.Conn
+	vpcID uuid.UUID
+	queue chan []byte
+}
+
+func newTCPRelay(logger *zap.SugaredLogger, redis *redis.Client) *tcpRelay {
+	return &tcpRelay{
+		conns:  map[uuid.UUID]*tcpRelayConn{},
+		redis:  redis,
+		logger: logger,
+	}
+}
+
+// TCPRelay relays the wireguard packets of a device over a websocket
+// @Summary      Relay WireGuard Packets
+// @Id  		 TCPRelay
+// @Tags         Devices
+// @Description  Upgrades the connection to a websocket that carries the WireGuard packets of a device to and from
+// @Description  its peers, for networks that block UDP. Each binary message holds the 16 byte id of the peer
+// @Description  followed by the packet.
+// @Param        id   path      string  true "Device ID"
+// @Success      101
+// @Failure		 401  {object}  models.BaseError
+// @Failure      400  {object}  models.BaseError
+// @Failure      403  {object}  models.BaseError
+// @Failure      404  {object}  models.BaseError
+// @Failure		 429  {object}  models.BaseError
+// @Failure      500  {object}  models.InternalServerError "Internal Server Error"
+// @Router       /api/devices/{id}/tcp-relay [get]
+func (api *API) TCPRelay(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "TCPRelay", trace.WithAttributes(
+		attribute.String("id", c.Param("id")),
+	))
+	defer span.End()
+	deviceId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewBadPathParameterError("id"))
+		return
+	}
+
+	var device models.Device
+	err = api.transaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		device, err = api.actingDevice(c, tx, deviceId)
+		return err
+	})
+
+	if err != nil {
+		var apiResponseError *ApiResponseError
+		if errors.Is(err, errDeviceNotFound) {
+			c.JSON(http.StatusNotFound, models.NewNotFoundError("device"))
+		} else if errors.As(err, &apiResponseError) {
+			c.JSON(apiResponseError.Status, apiResponseError.Body)
+		} else {
+			api.SendInternalServerError(c, err)
+		}
+		return
+	}
+
+	// the device authenticates with a bearer token, there is no origin to check
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		api.tcpRelay.serve(ctx, ws, device.ID, device.VpcID)
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serve relays the packets of a device until its websocket is closed.
+func (r *tcpRelay) serve(ctx context.Context, ws *websocket.Conn, deviceID, vpcID uuid.UUID) {
+	ws.MaxPayloadBytes = tcpRelayMaxFrame
+	// the timeouts of the http server don't apply to the websocket
+	_ = ws.SetDeadline(time.Time{})
+	conn := &tcpRelayConn{ws: ws, vpcID: vpcID, queue: make(chan []byte, tcpRelaySendQueue)}
+	done := make(chan struct{})
+	defer close(done)
+	go conn.writeQueued(done)
+
+	r.mu.Lock()
+	if previous, ok := r.conns[deviceID]; ok {
+		// the device reconnected, its previous connection is stale
+		_ = previous.ws.Close()
+	}
+	r.conns[deviceID] = conn
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		if r.conns[deviceID] == conn {
+			delete(r.conns, deviceID)
+		}
+		r.mu.Unlock()
+	}()
+
+	if r.redis != nil {
+		sub := r.redis.Subscribe(ctx, tcpRelayChannelPrefix+deviceID.String())
+		defer util.IgnoreError(sub.Close)
+		go r.receiveRemote(conn, sub)
+	}
+
+	for {
+		var frame []byte
+		if err := websocket.Message.Receive(ws, &frame); err != nil {
+			return
+		}
+		if len(frame) <= tcpRelayFrameHeader {
+			continue
+		}
+		peerID, err := uuid.FromBytes(frame[:tcpRelayFrameHeader])
+		if err != nil {
+			continue
+		}
+		copy(frame[:tcpRelayFrameHeader], deviceID[:])
+		r.forward(ctx, peerID, vpcID, frame)
+	}
+}
+
+// forward sends a frame to a peer, if the peer is in the same vpc as the sending device.
+func (r *tcpRelay) forward(ctx context.Context, peerID, vpcID uuid.UUID, frame []byte) {
+	r.mu.Lock()
+	peer, ok := r.conns[peerID]
+	r.mu.Unlock()
+	if ok {
+		if peer.vpcID == vpcID {
+			peer.send(frame)
+		}
+		return
+	}
+	if r.redis == nil {
+		return
+	}
+
+	// the peer may be connected to another replica, which checks the vpc
+	msg := append(append([]byte{}, vpcID[:]...), frame...)
+	if err := r.redis.Publish(ctx, tcpRelayChannelPrefix+peerID.String(), msg).Err(); err != nil {
+		r.logger.Debugf("failed to publish a relayed packet for device %s: %v", peerID, err)
+	}
+}
+
+// receiveRemote sends the frames published by other replicas to the device.
+func (r *tcpRelay) receiveRemote(conn *tcpRelayConn, sub *redis.PubSub) {
+	for msg := range sub.Channel() {
+		payload := []byte(msg.Payload)
+		if len(payload) <= 2*tcpRelayFrameHeader {
+			continue
+		}
+		vpcID, err := uuid.FromBytes(payload[:tcpRelayFrameHeader])
+		if err != nil || vpcID != conn.vpcID {
+			continue
+		}
+		conn.send(payload[tcpRelayFrameHeader:])
+	}
+}
+
+// send queues a frame for the device, it is dropped when the queue is full.
+func (c *tcpRelayConn) send(frame []byte) {
+	select {
+	case c.queue <- frame:
+	default:
+	}
+}
+
+// writeQueued writes the queued frames to the websocket of the device until it is no longer served.
+func (c *tcpRelayConn) writeQueued(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case frame := <-c.queue:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(tcpRelayWriteTimeout))
+			if err := websocket.Message.Send(c.ws, frame); err != nil {
+				// the device reconnects when its websocket fails
+				_ = c.ws.Close()
+				return
+			}
+		}
+	}
+}
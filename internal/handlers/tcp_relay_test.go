@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+func TestTCPRelay(t *testing.T) {
+	relay := newTCPRelay(zap.NewNop().Sugar(), nil)
+	server := httptest.NewServer(websocket.Server{Handler: func(ws *websocket.Conn) {
+		query := ws.Request().URL.Query()
+		relay.serve(context.Background(), ws, uuid.MustParse(query.Get("device")), uuid.MustParse(query.Get("vpc")))
+	}})
+	defer server.Close()
+
+	vpc := uuid.New()
+	otherVpc := uuid.New()
+	connect := func(deviceID, vpcID uuid.UUID) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?device=" + deviceID.String() + "&vpc=" + vpcID.String()
+		ws, err := websocket.Dial(url, "", server.URL)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = ws.Close() })
+		return ws
+	}
+	a, b, c, stalled := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	wsA := connect(a, vpc)
+	wsB := connect(b, vpc)
+	wsC := connect(c, otherVpc)
+	connect(stalled, vpc)
+	require.Eventually(t, func() bool {
+		relay.mu.Lock()
+		defer relay.mu.Unlock()
+		return len(relay.conns) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a device that does not read its websocket does not hold up the packets to the others
+	flooded := make(chan struct{})
+	go func() {
+		defer close(flooded)
+		packet := append(stalled[:], make([]byte, 60*1024)...)
+		for i := 0; i < 400; i++ {
+			if websocket.Message.Send(wsA, packet) != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-flooded:
+	case <-time.After(2 * time.Second):
+	}
+
+	// the peer receives the packet with the id of the sender
+	require.NoError(t, wsB.SetReadDeadline(time.Now().Add(2*time.Second)))
+	require.NoError(t, websocket.Message.Send(wsA, append(b[:], []byte("handshake")...)))
+	var frame []byte
+	require.NoError(t, websocket.Message.Receive(wsB, &frame))
+	require.Equal(t, append(a[:], []byte("handshake")...), frame)
+
+	// packets are not relayed to devices of another vpc
+	require.NoError(t, websocket.Message.Send(wsA, append(c[:], []byte("handshake")...)))
+	require.NoError(t, wsC.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	require.Error(t, websocket.Message.Receive(wsC, &frame))
+}
@@ -206,6 +206,7 @@ func (api *API) CreateUserIfNotExists(ctx context.Context, idpId string, userNam
 				PrivateCidr:    false,
 				Ipv4Cidr:       defaultIPAMv4Cidr,
 				Ipv6Cidr:       defaultIPAMv6Cidr,
+				Topology:       models.TopologyFullMesh,
 			}); res.Error != nil {
 				if database.IsDuplicateError(res.Error) {
 					res.Error = gorm.ErrDuplicatedKey
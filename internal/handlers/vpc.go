@@ -20,8 +20,44 @@ var defaultIPAMNamespace = uuid.UUID{}
 const (
 	defaultIPAMv4Cidr = "100.64.0.0/10"
 	defaultIPAMv6Cidr = "200::/64"
+	// minMaxKeyAgeSeconds is the shortest max key age a VPC can be configured with, devices need time to rotate their keys.
+	minMaxKeyAgeSeconds = 60 * 60
+	// minPeerIdleTimeoutSeconds is the shortest peer idle timeout a VPC can be configured with, shorter ones would keep tearing down peers of quiet connections.
+	minPeerIdleTimeoutSeconds = 60
+	// minMTU and maxMTU bound the MTU a VPC can be configured with, IPv6 needs at least 1280 and jumbo frames go up to 9000.
+	minMTU = 1280
+	maxMTU = 9000
 )
 
+var errInvalidMaxKeyAge = models.NewFieldValidationError("max_key_age_seconds", fmt.Sprintf("must be 0 or at least %d", minMaxKeyAgeSeconds))
+var errInvalidPeerIdleTimeout = models.NewFieldValidationError("peer_idle_timeout_seconds", fmt.Sprintf("must be 0 or at least %d", minPeerIdleTimeoutSeconds))
+var errInvalidMTU = models.NewFieldValidationError("mtu", fmt.Sprintf("must be 0 or between %d and %d", minMTU, maxMTU))
+var errInvalidTopology = models.NewFieldValidationError("topology", fmt.Sprintf("must be one of %s, %s or %s", models.TopologyFullMesh, models.TopologyHubAndSpoke, models.TopologyGroups))
+
+// validMaxKeyAge checks the max_key_age_seconds setting of a VPC
+func validMaxKeyAge(seconds int64) bool {
+	return seconds == 0 || seconds >= minMaxKeyAgeSeconds
+}
+
+// validTopology checks the topology setting of a VPC
+func validTopology(topology string) bool {
+	switch topology {
+	case models.TopologyFullMesh, models.TopologyHubAndSpoke, models.TopologyGroups:
+		return true
+	}
+	return false
+}
+
+// validPeerIdleTimeout checks the peer_idle_timeout_seconds setting of a VPC
+func validPeerIdleTimeout(seconds int64) bool {
+	return seconds == 0 || seconds >= minPeerIdleTimeoutSeconds
+}
+
+// validMTU checks the mtu setting of a VPC
+func validMTU(mtu int) bool {
+	return mtu == 0 || (mtu >= minMTU && mtu <= maxMTU)
+}
+
 // CreateVPC creates a new VPC
 // @Summary      Create an VPC
 // @Description  Creates a named vpc with the given CIDR
@@ -87,6 +123,26 @@ func (api *API) CreateVPC(c *gin.Context) {
 		return
 	}
 
+	if !validMaxKeyAge(request.MaxKeyAgeSeconds) {
+		c.JSON(http.StatusBadRequest, errInvalidMaxKeyAge)
+		return
+	}
+	if !validPeerIdleTimeout(request.PeerIdleTimeoutSeconds) {
+		c.JSON(http.StatusBadRequest, errInvalidPeerIdleTimeout)
+		return
+	}
+	if !validMTU(request.Mtu) {
+		c.JSON(http.StatusBadRequest, errInvalidMTU)
+		return
+	}
+	if request.Topology == "" {
+		request.Topology = models.TopologyFullMesh
+	}
+	if !validTopology(request.Topology) {
+		c.JSON(http.StatusBadRequest, errInvalidTopology)
+		return
+	}
+
 	var vpc models.VPC
 	err := api.transaction(ctx, func(tx *gorm.DB) error {
 
@@ -97,11 +153,17 @@ func (api *API) CreateVPC(c *gin.Context) {
 		}
 
 		vpc = models.VPC{
-			OrganizationID: request.OrganizationID,
-			Description:    request.Description,
-			PrivateCidr:    request.PrivateCidr,
-			Ipv4Cidr:       request.Ipv4Cidr,
-			Ipv6Cidr:       request.Ipv6Cidr,
+			OrganizationID:         request.OrganizationID,
+			Description:            request.Description,
+			PrivateCidr:            request.PrivateCidr,
+			Ipv4Cidr:               request.Ipv4Cidr,
+			Ipv6Cidr:               request.Ipv6Cidr,
+			MaxKeyAgeSeconds:       request.MaxKeyAgeSeconds,
+			PresharedKeys:          request.PresharedKeys,
+			OnDemandPeering:        request.OnDemandPeering,
+			PeerIdleTimeoutSeconds: request.PeerIdleTimeoutSeconds,
+			Topology:               request.Topology,
+			Mtu:                    request.Mtu,
 		}
 
 		if res := tx.Create(&vpc); res.Error != nil {
@@ -374,6 +436,23 @@ func (api *API) UpdateVPC(c *gin.Context) {
 		return
 	}
 
+	if request.MaxKeyAgeSeconds != nil && !validMaxKeyAge(*request.MaxKeyAgeSeconds) {
+		c.JSON(http.StatusBadRequest, errInvalidMaxKeyAge)
+		return
+	}
+	if request.PeerIdleTimeoutSeconds != nil && !validPeerIdleTimeout(*request.PeerIdleTimeoutSeconds) {
+		c.JSON(http.StatusBadRequest, errInvalidPeerIdleTimeout)
+		return
+	}
+	if request.Topology != nil && !validTopology(*request.Topology) {
+		c.JSON(http.StatusBadRequest, errInvalidTopology)
+		return
+	}
+	if request.Mtu != nil && !validMTU(*request.Mtu) {
+		c.JSON(http.StatusBadRequest, errInvalidMTU)
+		return
+	}
+
 	var vpc models.VPC
 	err = api.transaction(ctx, func(tx *gorm.DB) error {
 
@@ -385,6 +464,24 @@ func (api *API) UpdateVPC(c *gin.Context) {
 		if request.Description != nil {
 			vpc.Description = *request.Description
 		}
+		if request.MaxKeyAgeSeconds != nil {
+			vpc.MaxKeyAgeSeconds = *request.MaxKeyAgeSeconds
+		}
+		if request.PresharedKeys != nil {
+			vpc.PresharedKeys = *request.PresharedKeys
+		}
+		if request.OnDemandPeering != nil {
+			vpc.OnDemandPeering = *request.OnDemandPeering
+		}
+		if request.PeerIdleTimeoutSeconds != nil {
+			vpc.PeerIdleTimeoutSeconds = *request.PeerIdleTimeoutSeconds
+		}
+		if request.Topology != nil {
+			vpc.Topology = *request.Topology
+		}
+		if request.Mtu != nil {
+			vpc.Mtu = *request.Mtu
+		}
 
 		if res := tx.Save(&vpc); res.Error != nil {
 			return res.Error
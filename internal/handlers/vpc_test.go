@@ -60,6 +60,7 @@ func (suite *HandlerTestSuite) TestListVPCs() {
 		var o models.VPC
 		err = json.Unmarshal(body, &o)
 		require.NoError(err)
+		require.Equal(models.TopologyFullMesh, o.Topology)
 	}
 
 	{
@@ -178,4 +179,36 @@ func (suite *HandlerTestSuite) TestListVPCs() {
 		assert.Equal(`{"error":"must be '200::/64' or not set when private_cidr is not enabled","field":"cidr_v6"}`, res.Body.String())
 
 	}
+
+	{
+		_, res, err := suite.ServeRequest(
+			http.MethodPost,
+			"/", "/",
+			suite.api.CreateVPC,
+			bytes.NewBuffer(suite.jsonMarshal(models.AddVPC{
+				Description:    "bad-topology",
+				OrganizationID: suite.testUserID,
+				Topology:       "star",
+			})),
+		)
+		assert.NoError(err)
+		assert.Equal(http.StatusBadRequest, res.Code)
+		assert.Equal(`{"error":"must be one of full-mesh, hub-and-spoke or groups","field":"topology"}`, res.Body.String())
+	}
+
+	{
+		_, res, err := suite.ServeRequest(
+			http.MethodPost,
+			"/", "/",
+			suite.api.CreateVPC,
+			bytes.NewBuffer(suite.jsonMarshal(models.AddVPC{
+				Description:    "bad-mtu",
+				OrganizationID: suite.testUserID,
+				Mtu:            576,
+			})),
+		)
+		assert.NoError(err)
+		assert.Equal(http.StatusBadRequest, res.Code)
+		assert.Equal(`{"error":"must be 0 or between 1280 and 9000","field":"mtu"}`, res.Body.String())
+	}
 }
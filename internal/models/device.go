@@ -11,48 +11,68 @@ import (
 // Devices belong to one User and may be onboarded into an organization
 type Device struct {
 	Base
-	OwnerID         uuid.UUID      `json:"owner_id"`
-	VpcID           uuid.UUID      `json:"vpc_id" example:"694aa002-5d19-495e-980b-3d8fd508ea10"`
-	OrganizationID  uuid.UUID      `json:"-"` // Denormalized from the VPC record for performance
-	PublicKey       string         `json:"public_key"`
-	AllowedIPs      pq.StringArray `json:"allowed_ips" gorm:"type:text[]" swaggertype:"array,string"`
-	IPv4TunnelIPs   []TunnelIP     `json:"ipv4_tunnel_ips" gorm:"type:JSONB; serializer:json"`
-	IPv6TunnelIPs   []TunnelIP     `json:"ipv6_tunnel_ips" gorm:"type:JSONB; serializer:json"`
-	AdvertiseCidrs  pq.StringArray `json:"advertise_cidrs" gorm:"type:text[]" swaggertype:"array,string"`
-	Relay           bool           `json:"relay"`
-	SymmetricNat    bool           `json:"symmetric_nat"`
-	Hostname        string         `json:"hostname"`
-	Os              string         `json:"os"`
-	Endpoints       []Endpoint     `json:"endpoints" gorm:"type:JSONB; serializer:json"`
-	Revision        uint64         `json:"revision" gorm:"type:bigserial;index:"`
-	SecurityGroupId uuid.UUID      `json:"security_group_id"`
-	Online          bool           `json:"online"`
-	OnlineAt        *time.Time     `json:"online_at"`
-	RegKeyID        uuid.UUID      `json:"-"`                      // the reg key id that created the device (if it was created with a registration token)
-	BearerToken     string         `json:"bearer_token,omitempty"` // the token nexd should use to reconcile device state.
+	OwnerID                    uuid.UUID      `json:"owner_id"`
+	VpcID                      uuid.UUID      `json:"vpc_id" example:"694aa002-5d19-495e-980b-3d8fd508ea10"`
+	OrganizationID             uuid.UUID      `json:"-"` // Denormalized from the VPC record for performance
+	PublicKey                  string         `json:"public_key"`
+	AllowedIPs                 pq.StringArray `json:"allowed_ips" gorm:"type:text[]" swaggertype:"array,string"`
+	IPv4TunnelIPs              []TunnelIP     `json:"ipv4_tunnel_ips" gorm:"type:JSONB; serializer:json"`
+	IPv6TunnelIPs              []TunnelIP     `json:"ipv6_tunnel_ips" gorm:"type:JSONB; serializer:json"`
+	AdvertiseCidrs             pq.StringArray `json:"advertise_cidrs" gorm:"type:text[]" swaggertype:"array,string"`
+	Relay                      bool           `json:"relay"`
+	RelayMode                  bool           `json:"-"` // the device registered as a relay or a user made it one, its device profile can make it one besides.
+	SymmetricNat               bool           `json:"symmetric_nat"`
+	Nat                        *NatBehavior   `json:"nat,omitempty" gorm:"type:JSONB; serializer:json"` // how the NAT in front of the device behaves, when the device discovered it.
+	Hostname                   string         `json:"hostname"`
+	Os                         string         `json:"os"`
+	Endpoints                  []Endpoint     `json:"endpoints" gorm:"type:JSONB; serializer:json"`
+	RelayLatencies             map[string]int `json:"relay_latencies,omitempty" gorm:"type:JSONB; serializer:json"` // the latency in ms the device measured to each relay it reaches, by relay id.
+	Revision                   uint64         `json:"revision" gorm:"type:bigserial;index:"`
+	SecurityGroupId            uuid.UUID      `json:"security_group_id"`
+	Online                     bool           `json:"online"`
+	OnlineAt                   *time.Time     `json:"online_at"`
+	RegKeyID                   uuid.UUID      `json:"-"`                                        // the reg key id that created the device (if it was created with a registration token)
+	BearerToken                string         `json:"bearer_token,omitempty"`                   // the token nexd should use to reconcile device state.
+	PublicKeyCreatedAt         *time.Time     `json:"public_key_created_at,omitempty"`          // when the current public key was registered, used to enforce the VPC max key age.
+	PreviousPublicKey          string         `json:"previous_public_key,omitempty"`            // the public key replaced by the last key rotation.
+	PreviousPublicKeyExpiresAt *time.Time     `json:"previous_public_key_expires_at,omitempty"` // when the apiserver stops accepting the previous public key.
+	PeeringGroup               string         `json:"peering_group,omitempty"`                  // in a VPC with the groups topology, devices of the same group peer with each other.
+	RelayLoad                  int            `json:"relay_load,omitempty"`                     // for relay devices, how many KB/s of traffic they relay, so that devices spread across the relays.
+	DeviceProfileId            *uuid.UUID     `json:"device_profile_id,omitempty"`              // the device profile holding the nexd settings of the device.
+	Revoked                    bool           `json:"revoked"`                                  // an admin revoked the device, it is not issued a device token until it is re-enabled.
 }
 
 // AddDevice is the information needed to add a new Device.
 type AddDevice struct {
-	VpcID           uuid.UUID  `json:"vpc_id" example:"694aa002-5d19-495e-980b-3d8fd508ea10"`
-	PublicKey       string     `json:"public_key"`
-	AdvertiseCidrs  []string   `json:"advertise_cidrs" example:"172.16.42.0/24"`
-	IPv4TunnelIPs   []TunnelIP `json:"ipv4_tunnel_ips" gorm:"type:JSONB; serializer:json"`
-	Relay           bool       `json:"relay"`
-	SymmetricNat    bool       `json:"symmetric_nat"`
-	Hostname        string     `json:"hostname" example:"myhost"`
-	Endpoints       []Endpoint `json:"endpoints" gorm:"type:JSONB; serializer:json"`
-	Os              string     `json:"os"`
-	SecurityGroupId uuid.UUID  `json:"security_group_id"`
+	VpcID           uuid.UUID    `json:"vpc_id" example:"694aa002-5d19-495e-980b-3d8fd508ea10"`
+	PublicKey       string       `json:"public_key"`
+	AdvertiseCidrs  []string     `json:"advertise_cidrs" example:"172.16.42.0/24"`
+	IPv4TunnelIPs   []TunnelIP   `json:"ipv4_tunnel_ips" gorm:"type:JSONB; serializer:json"`
+	Relay           bool         `json:"relay"`
+	SymmetricNat    bool         `json:"symmetric_nat"`
+	Nat             *NatBehavior `json:"nat,omitempty"`
+	Hostname        string       `json:"hostname" example:"myhost"`
+	Endpoints       []Endpoint   `json:"endpoints" gorm:"type:JSONB; serializer:json"`
+	Os              string       `json:"os"`
+	SecurityGroupId uuid.UUID    `json:"security_group_id"`
 }
 
 // UpdateDevice is the information needed to update a Device.
 type UpdateDevice struct {
-	VpcID           *uuid.UUID `json:"vpc_id" example:"694aa002-5d19-495e-980b-3d8fd508ea10"`
-	AdvertiseCidrs  []string   `json:"advertise_cidrs" example:"172.16.42.0/24"`
-	SymmetricNat    *bool      `json:"symmetric_nat"`
-	Hostname        string     `json:"hostname" example:"myhost"`
-	Endpoints       []Endpoint `json:"endpoints" gorm:"type:JSONB; serializer:json"`
-	Revision        *uint64    `json:"revision"`
-	SecurityGroupId *uuid.UUID `json:"security_group_id"`
+	VpcID             *uuid.UUID     `json:"vpc_id" example:"694aa002-5d19-495e-980b-3d8fd508ea10"`
+	AdvertiseCidrs    []string       `json:"advertise_cidrs" example:"172.16.42.0/24"`
+	SymmetricNat      *bool          `json:"symmetric_nat"`
+	Nat               *NatBehavior   `json:"nat,omitempty"` // ignored without a mapping, the device did not discover the behavior of its NAT.
+	Hostname          string         `json:"hostname" example:"myhost"`
+	Endpoints         []Endpoint     `json:"endpoints" gorm:"type:JSONB; serializer:json"`
+	Revision          *uint64        `json:"revision"`
+	SecurityGroupId   *uuid.UUID     `json:"security_group_id"`
+	PublicKey         string         `json:"public_key"`                        // rotates the device to a new public key.
+	KeyOverlapSeconds int64          `json:"key_overlap_seconds" example:"300"` // how long the previous public key is still accepted after a rotation.
+	PeeringGroup      *string        `json:"peering_group" example:"branch-east"`
+	RelayLoad         *int           `json:"relay_load" example:"512"`        // reported by relay devices, how many KB/s of traffic they relay.
+	RelayLatencies    map[string]int `json:"relay_latencies"`                 // reported by devices, the latency in ms to each relay they reach, by relay id.
+	Relay             *bool          `json:"relay" extensions:"x-nullable"`   // makes the device a relay, or stops it being one unless its device profile makes it one. Only users can change it.
+	DeviceProfileId   *uuid.UUID     `json:"device_profile_id"`               // assigns a device profile to the device, the nil uuid removes it.
+	Revoked           *bool          `json:"revoked" extensions:"x-nullable"` // revokes the device or re-enables it, only users can change it.
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The actions an admin can ask a device to run.
+const (
+	DeviceActionStun        = "stun"        // re-run the STUN discovery of the reflexive address and NAT behavior
+	DeviceActionRekey       = "rekey"       // rotate the wireguard key of the device
+	DeviceActionFlushPeers  = "flush-peers" // drop the peering state and peer again from scratch
+	DeviceActionDiagnostics = "diagnostics" // collect a diagnostics bundle as the result
+	DeviceActionLogLevel    = "log-level"   // set the log level given as the argument, debug by default
+)
+
+// The statuses of a device action, from when it is created until the device posts its result.
+const (
+	DeviceActionStatusPending      = "pending"
+	DeviceActionStatusAcknowledged = "acknowledged"
+	DeviceActionStatusSucceeded    = "succeeded"
+	DeviceActionStatusFailed       = "failed"
+)
+
+// DeviceAction is an action an admin asks a device to run. The device learns of it through the vpc events,
+// acknowledges it, and posts back the result once it ran. Actions are deleted once the retention window passed.
+type DeviceAction struct {
+	Base
+	VpcID    uuid.UUID `json:"vpc_id"`
+	DeviceID uuid.UUID `json:"device_id"`
+	Action   string    `json:"action"   example:"rekey"`
+	Argument string    `json:"argument" example:"debug"`
+	Status   string    `json:"status"   example:"pending"`
+	// Result is the output of the action, or why it failed. It is left out of the vpc events.
+	Result         string     `json:"result"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	Revision       uint64     `json:"revision" gorm:"type:bigserial;index:"`
+}
+
+// AddDeviceAction is the information needed to ask a device to run an action.
+type AddDeviceAction struct {
+	Action   string `json:"action"   example:"log-level"`
+	Argument string `json:"argument" example:"debug"`
+}
+
+// UpdateDeviceAction is the progress a device reports on an action.
+type UpdateDeviceAction struct {
+	Status string `json:"status" example:"succeeded"`
+	Result string `json:"result"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DevicePeerKey is a WireGuard preshared key shared by a pair of devices for one rotation epoch.
+// The pair is stored with the lower device id first so that both devices find the same key.
+type DevicePeerKey struct {
+	DeviceID  uuid.UUID `gorm:"type:uuid;primary_key"`
+	PeerID    uuid.UUID `gorm:"type:uuid;primary_key"`
+	Epoch     int64     `gorm:"primary_key"`
+	VpcID     uuid.UUID `gorm:"type:uuid;index"`
+	Key       string
+	CreatedAt time.Time
+}
+
+// PeerPresharedKey is the preshared key a device should use with a peer while it is valid.
+type PeerPresharedKey struct {
+	PeerID    uuid.UUID `json:"peer_id"`
+	SealedKey string    `json:"sealed_key"` // the preshared key sealed to the public key of the requesting device.
+	StartsAt  time.Time `json:"starts_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// DeviceProfile holds nexd settings managed centrally for the devices it is assigned to. A profile is assigned to
+// a device directly, or to a registration key so that the devices registered with the key start with it.
+type DeviceProfile struct {
+	Base
+	VpcID          uuid.UUID             `json:"vpc_id"`
+	OrganizationID uuid.UUID             `json:"-"` // Denormalized from the VPC record for performance
+	Description    string                `json:"description"`
+	Settings       DeviceProfileSettings `json:"settings" gorm:"type:JSONB; serializer:json"`
+	Revision       uint64                `json:"revision" gorm:"type:bigserial;index:"`
+}
+
+// DeviceProfileSettings are the nexd settings of a device profile, nexd applies them without restarting. A setting
+// that is not set leaves the one nexd was started with, and a setting nexd was started with a flag for is not changed.
+type DeviceProfileSettings struct {
+	Ingress        []string `json:"ingress,omitempty" example:"tcp:443:10.10.0.5:8443"`       // Ingress are the ingress proxy rules of devices running in proxy mode.
+	Egress         []string `json:"egress,omitempty" example:"tcp:8080:10.10.0.5:80"`         // Egress are the egress proxy rules of devices running in proxy mode.
+	AdvertiseCidrs []string `json:"advertise_cidrs,omitempty" example:"172.16.42.0/24"`       // AdvertiseCidrs are the CIDRs the devices advertise to their peers.
+	Relay          *bool    `json:"relay,omitempty" extensions:"x-nullable"`                  // Relay makes the devices relay traffic for the devices of the VPC behind symmetric NATs.
+	ExitNodeClient *bool    `json:"exit_node_client,omitempty" extensions:"x-nullable"`       // ExitNodeClient sends the internet traffic of the devices through an exit node of the VPC.
+	LogLevel       string   `json:"log_level,omitempty" example:"debug"`                      // LogLevel is the level nexd logs at.
+	Keepalive      *int     `json:"keepalive,omitempty" example:"20" extensions:"x-nullable"` // Keepalive is the persistent keepalive interval of the tunnels in seconds, 0 turns it off.
+}
+
+// AddDeviceProfile is the information needed to add a new device profile.
+type AddDeviceProfile struct {
+	VpcID       uuid.UUID             `json:"vpc_id" example:"694aa002-5d19-495e-980b-3d8fd508ea10"`
+	Description string                `json:"description" example:"edge boxes"`
+	Settings    DeviceProfileSettings `json:"settings"`
+}
+
+// UpdateDeviceProfile is the information needed to update a device profile.
+type UpdateDeviceProfile struct {
+	Description *string                `json:"description,omitempty"`
+	Settings    *DeviceProfileSettings `json:"settings,omitempty" extensions:"x-nullable"` // Settings replace the settings of the profile.
+}
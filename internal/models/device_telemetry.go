@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The status of the tunnel between a pair of devices, as reported by the devices.
+const (
+	ConnectivityDirect  = "direct"  // the devices reach each other without going through a relay
+	ConnectivityRelayed = "relayed" // the traffic between the devices goes through a relay
+	ConnectivityFailing = "failing" // the tunnel between the devices is not healthy
+	ConnectivityIdle    = "idle"    // the tunnel is down on purpose, the devices only peer on demand
+	ConnectivityUnknown = "unknown" // neither device reported on the tunnel recently
+)
+
+// PeerTelemetry is what a device reports about its tunnel to a peer.
+type PeerTelemetry struct {
+	PeerID        uuid.UUID `json:"peer_id"`
+	PeeringMethod string    `json:"peering_method" example:"reflexive"`
+	// Status is one of direct, relayed, failing or idle.
+	Status          string     `json:"status" example:"direct"`
+	LatestHandshake *time.Time `json:"latest_handshake"`
+	RxBytes         int64      `json:"rx_bytes" format:"int64"`
+	TxBytes         int64      `json:"tx_bytes" format:"int64"`
+}
+
+// DeviceTelemetry is the last status a device reported about its peers.
+type DeviceTelemetry struct {
+	DeviceID   uuid.UUID       `json:"device_id" gorm:"type:uuid;primary_key"`
+	VpcID      uuid.UUID       `json:"vpc_id"    gorm:"type:uuid;index"`
+	Peers      []PeerTelemetry `json:"peers"     gorm:"type:JSONB; serializer:json"`
+	ReportedAt time.Time       `json:"reported_at"`
+}
+
+// ReportDeviceTelemetry is the status a device reports about its peers.
+type ReportDeviceTelemetry struct {
+	Peers []PeerTelemetry `json:"peers"`
+}
+
+// DevicePairConnectivity is the status of the tunnel between a pair of devices, from what both reported.
+type DevicePairConnectivity struct {
+	DeviceID uuid.UUID `json:"device_id"`
+	PeerID   uuid.UUID `json:"peer_id"`
+	// Status is one of direct, relayed, failing, idle or unknown.
+	Status string `json:"status" example:"relayed"`
+	// DeviceReport is what the device reported about the peer, nil when it did not report recently.
+	DeviceReport *PeerTelemetry `json:"device_report" extensions:"x-nullable"`
+	// PeerReport is what the peer reported about the device, nil when it did not report recently.
+	PeerReport *PeerTelemetry `json:"peer_report" extensions:"x-nullable"`
+}
+
+// VPCConnectivity is the status of the tunnels between every pair of devices in a VPC.
+type VPCConnectivity struct {
+	VpcID uuid.UUID                `json:"vpc_id"`
+	Pairs []DevicePairConnectivity `json:"pairs"`
+}
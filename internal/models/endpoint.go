@@ -1,8 +1,8 @@
 package models
 
 type Endpoint struct {
-	// How the endpoint was discovered
+	// How the endpoint was discovered: local or stun:<server> for IPv4, local-ipv6 or stun-ipv6:<server> for IPv6, port-mapping:<protocol> for the port mapped on the gateway
 	Source string `json:"source"`
-	// IP address and port of the endpoint.
+	// IP address and port of the endpoint, IPv6 addresses are in brackets.
 	Address string `json:"address" example:"10.1.1.1:51820"`
 }
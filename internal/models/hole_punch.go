@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HolePunch coordinates two devices behind NAT sending packets to each other at the same moment, so that
+// both NATs open a mapping for the other device. The device starting the hole punch offers its candidate
+// endpoints, the peer answers with its own, and the api-server then picks the moment to punch at.
+type HolePunch struct {
+	Base
+	VpcID    uuid.UUID `json:"vpc_id"`
+	DeviceID uuid.UUID `json:"device_id"` // DeviceID is the device that started the hole punch.
+	PeerID   uuid.UUID `json:"peer_id"`   // PeerID is the device asked to answer the hole punch.
+	// Candidates are the endpoints the device may be reached at, the most likely one first.
+	Candidates []string `json:"candidates"      gorm:"type:JSONB; serializer:json"`
+	// PeerCandidates are the endpoints the peer may be reached at, set once the peer answered.
+	PeerCandidates []string `json:"peer_candidates" gorm:"type:JSONB; serializer:json"`
+	// PunchAt is when both devices send packets to the candidates of the other, set once the peer answered.
+	PunchAt *time.Time `json:"punch_at"`
+	// PunchInMs is how many milliseconds after receiving the hole punch the devices punch, computed whenever it is
+	// sent so that devices don't depend on their clock agreeing with the one of the api-server.
+	PunchInMs int64  `json:"punch_in_ms"     gorm:"-"`
+	Revision  uint64 `json:"revision"        gorm:"type:bigserial;index:"`
+}
+
+// AddHolePunch is the information needed to start a hole punch with a peer.
+type AddHolePunch struct {
+	PeerID     uuid.UUID `json:"peer_id"`
+	Candidates []string  `json:"candidates" example:"203.0.113.10:51820"`
+}
+
+// AnswerHolePunch is the information the peer answers a hole punch with.
+type AnswerHolePunch struct {
+	Candidates []string `json:"candidates" example:"198.51.100.7:51820"`
+}
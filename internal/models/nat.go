@@ -0,0 +1,13 @@
+package models
+
+// NatBehavior classifies the NAT in front of a device as described in RFC 5780.
+type NatBehavior struct {
+	// Mapping is whether the NAT maps the device to the same reflexive address for every destination,
+	// one of endpoint-independent, address-dependent or address-and-port-dependent.
+	Mapping string `json:"mapping" example:"endpoint-independent"`
+	// Filtering is which traffic the NAT lets in to a reflexive address, one of endpoint-independent,
+	// address-dependent or address-and-port-dependent. Empty when the device could not discover it.
+	Filtering string `json:"filtering" example:"address-and-port-dependent"`
+	// Hairpinning is whether the NAT forwards traffic sent to one of its reflexive addresses from behind it.
+	Hairpinning bool `json:"hairpinning"`
+}
@@ -18,6 +18,7 @@ type RegKey struct {
 	DeviceId        *uuid.UUID             `json:"device_id,omitempty"`                         // DeviceId is set if the RegKey was created for single use
 	ExpiresAt       *time.Time             `json:"expires_at,omitempty"`                        // ExpiresAt is optional, if set the registration key is only valid until the ExpiresAt time.
 	SecurityGroupId *uuid.UUID             `json:"security_group_id"`                           // SecurityGroupId is the ID of the security group to assign to the device.
+	DeviceProfileId *uuid.UUID             `json:"device_profile_id"`                           // DeviceProfileId is the ID of the device profile to assign to the device.
 	Settings        map[string]interface{} `json:"settings" gorm:"type:JSONB; serializer:json"` // Settings contains general settings for the device.
 }
 type NexodusClaims struct {
@@ -33,6 +34,7 @@ type AddRegKey struct {
 	SingleUse       bool                   `json:"single_use,omitempty"`  // SingleUse only allows the registration key to be used once.
 	ExpiresAt       *time.Time             `json:"expires_at,omitempty"`  // ExpiresAt is optional, if set the registration key is only valid until the ExpiresAt time.
 	SecurityGroupId *uuid.UUID             `json:"security_group_id"`     // SecurityGroupId is the ID of the security group to assign to the device.
+	DeviceProfileId *uuid.UUID             `json:"device_profile_id"`     // DeviceProfileId is the ID of the device profile to assign to the device.
 	Settings        map[string]interface{} `json:"settings"`              // Settings contains general settings for the device.
 }
 
@@ -40,5 +42,6 @@ type UpdateRegKey struct {
 	Description     *string                `json:"description,omitempty"` // Description of the registration key.
 	ExpiresAt       *time.Time             `json:"expires_at,omitempty"`  // ExpiresAt is optional, if set the registration key is only valid until the ExpiresAt time.
 	SecurityGroupId *uuid.UUID             `json:"security_group_id"`     // SecurityGroupId is the ID of the security group to assign to the device.
+	DeviceProfileId *uuid.UUID             `json:"device_profile_id"`     // DeviceProfileId is the ID of the device profile to assign to the device.
 	Settings        map[string]interface{} `json:"settings"`              // Settings contains general settings for the device.
 }
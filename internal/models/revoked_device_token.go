@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevokedDeviceToken is a device bearer token that has been replaced and is no longer accepted.
+type RevokedDeviceToken struct {
+	BearerToken string    `gorm:"primary_key"`
+	DeviceID    uuid.UUID `gorm:"type:uuid;index"`
+	RevokedAt   time.Time
+}
@@ -13,6 +13,8 @@ type SecurityGroup struct {
 	InboundRules   []SecurityRule `json:"inbound_rules,omitempty" gorm:"type:JSONB; serializer:json"`
 	OutboundRules  []SecurityRule `json:"outbound_rules,omitempty" gorm:"type:JSONB; serializer:json"`
 	Revision       uint64         `json:"revision"  gorm:"type:bigserial;index:"`
+	// Grants holds the active time-bound grants for the group, their rules apply in addition to the inbound and outbound rules.
+	Grants []SecurityGroupGrant `json:"grants,omitempty" gorm:"-"`
 }
 
 // AddSecurityGroup is the information needed to add a new Security Group.
@@ -32,8 +34,15 @@ type UpdateSecurityGroup struct {
 
 // SecurityRule represents a Security Rule
 type SecurityRule struct {
-	IpProtocol string   `json:"ip_protocol"`
-	FromPort   int64    `json:"from_port"`
-	ToPort     int64    `json:"to_port"`
-	IpRanges   []string `json:"ip_ranges,omitempty"`
+	// IpProtocol is a protocol name or an IP protocol number between 0 and 255
+	IpProtocol string `json:"ip_protocol" example:"tcp"`
+	FromPort   int64  `json:"from_port"`
+	ToPort     int64  `json:"to_port"`
+	// Ports is a list of destination ports, it can be used instead of the from_port/to_port range
+	Ports []int64 `json:"ports,omitempty"`
+	// IcmpTypes limits an icmpv4 or icmpv6 rule to the listed ICMP types
+	IcmpTypes []int64 `json:"icmp_types,omitempty"`
+	// IcmpCodes limits an icmpv4 or icmpv6 rule to the listed ICMP codes of its icmp_types
+	IcmpCodes []int64  `json:"icmp_codes,omitempty"`
+	IpRanges  []string `json:"ip_ranges,omitempty"`
 }
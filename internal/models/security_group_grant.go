@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	GrantDirectionInbound  = "inbound"
+	GrantDirectionOutbound = "outbound"
+)
+
+// SecurityGroupGrant temporarily adds a rule to a security group until it expires.
+// Grants are kept after they expire so that they can be reviewed later.
+type SecurityGroupGrant struct {
+	Base
+	SecurityGroupId uuid.UUID    `json:"security_group_id"`
+	VpcId           uuid.UUID    `json:"vpc_id"`
+	OrganizationID  uuid.UUID    `json:"-"`                           // Denormalized from the VPC record for performance
+	Direction       string       `json:"direction" example:"inbound"` // Direction is either inbound or outbound.
+	Rule            SecurityRule `json:"rule" gorm:"type:JSONB; serializer:json"`
+	Requester       string       `json:"requester" example:"alice"`                        // Requester identifies who asked for the access.
+	ApproverID      uuid.UUID    `json:"approver_id"`                                      // ApproverID is the ID of the user that created the grant.
+	Reason          string       `json:"reason,omitempty" example:"debug replication lag"` // Reason is a free form justification for the grant.
+	ExpiresAt       time.Time    `json:"expires_at"`                                       // ExpiresAt is when the grant stops being applied.
+	ExpiredAt       *time.Time   `json:"expired_at,omitempty"`                             // ExpiredAt is set once the grant has been removed from the security group.
+}
+
+// AddSecurityGroupGrant is the information needed to add a new Security Group Grant.
+type AddSecurityGroupGrant struct {
+	Direction string       `json:"direction" example:"inbound"`
+	Rule      SecurityRule `json:"rule"`
+	Requester string       `json:"requester" example:"alice"`
+	Reason    string       `json:"reason,omitempty" example:"debug replication lag"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningKey is a key the apiserver uses to sign the JWTs it issues.
+type SigningKey struct {
+	ID          string `gorm:"primary_key"` // the kid of the key, the JWK thumbprint of its public key.
+	PrivateKey  string // the PEM encoded RSA private key, encrypted with a key derived from the configured tls-key.
+	CreatedAt   time.Time
+	ActivatesAt time.Time  // when the key starts being used to sign, it is published before so that every apiserver can verify it.
+	ExpiresAt   *time.Time // when the key stops being published, set once a newer key replaces it.
+}
@@ -4,26 +4,50 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	TopologyFullMesh    = "full-mesh"
+	TopologyHubAndSpoke = "hub-and-spoke"
+	TopologyGroups      = "groups"
+)
+
 // VPC contains Devices
 type VPC struct {
 	Base
-	OrganizationID uuid.UUID `json:"organization_id"`
-	Description    string    `json:"description"`
-	PrivateCidr    bool      `json:"private_cidr"`
-	Ipv4Cidr       string    `json:"ipv4_cidr"`
-	Ipv6Cidr       string    `json:"ipv6_cidr"`
+	OrganizationID         uuid.UUID `json:"organization_id"`
+	Description            string    `json:"description"`
+	PrivateCidr            bool      `json:"private_cidr"`
+	Ipv4Cidr               string    `json:"ipv4_cidr"`
+	Ipv6Cidr               string    `json:"ipv6_cidr"`
+	MaxKeyAgeSeconds       int64     `json:"max_key_age_seconds"`       // the maximum age of a device's WireGuard key before it must be rotated, 0 disables the limit.
+	PresharedKeys          bool      `json:"preshared_keys"`            // when enabled every pair of devices also uses a WireGuard preshared key.
+	OnDemandPeering        bool      `json:"on_demand_peering"`         // when enabled devices only peer with each other when their security groups call for it or once they exchange traffic.
+	PeerIdleTimeoutSeconds int64     `json:"peer_idle_timeout_seconds"` // how long an on-demand peer is kept without traffic, 0 uses the default of 10 minutes.
+	Topology               string    `json:"topology"`                  // which devices peer with each other: full-mesh, hub-and-spoke or groups.
+	Mtu                    int       `json:"mtu"`                       // the MTU of the tunnel interface of the devices, 0 lets nexd use its default and the path MTU it discovers.
 
 	Organization *Organization `json:"-"`
 }
 
 type AddVPC struct {
-	OrganizationID uuid.UUID `json:"organization_id"`
-	Description    string    `json:"description" example:"The Red Zone"`
-	PrivateCidr    bool      `json:"private_cidr"`
-	Ipv4Cidr       string    `json:"ipv4_cidr" example:"172.16.42.0/24"`
-	Ipv6Cidr       string    `json:"ipv6_cidr" example:"0200::/8"`
+	OrganizationID         uuid.UUID `json:"organization_id"`
+	Description            string    `json:"description" example:"The Red Zone"`
+	PrivateCidr            bool      `json:"private_cidr"`
+	Ipv4Cidr               string    `json:"ipv4_cidr" example:"172.16.42.0/24"`
+	Ipv6Cidr               string    `json:"ipv6_cidr" example:"0200::/8"`
+	MaxKeyAgeSeconds       int64     `json:"max_key_age_seconds" example:"7776000"`
+	PresharedKeys          bool      `json:"preshared_keys"`
+	OnDemandPeering        bool      `json:"on_demand_peering"`
+	PeerIdleTimeoutSeconds int64     `json:"peer_idle_timeout_seconds" example:"600"`
+	Topology               string    `json:"topology" example:"full-mesh"`
+	Mtu                    int       `json:"mtu" example:"1380"`
 }
 
 type UpdateVPC struct {
-	Description *string `json:"description" example:"The Red Zone"`
+	Description            *string `json:"description" example:"The Red Zone"`
+	MaxKeyAgeSeconds       *int64  `json:"max_key_age_seconds" example:"7776000"`
+	PresharedKeys          *bool   `json:"preshared_keys"`
+	OnDemandPeering        *bool   `json:"on_demand_peering"`
+	PeerIdleTimeoutSeconds *int64  `json:"peer_idle_timeout_seconds" example:"600"`
+	Topology               *string `json:"topology" example:"hub-and-spoke"`
+	Mtu                    *int    `json:"mtu" example:"1380"`
 }
@@ -0,0 +1,196 @@
+package nexodus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/state"
+	"golang.org/x/exp/slices"
+)
+
+// how often the state learned from the apiserver is saved, when it changed
+const cacheStoreInterval = time.Minute
+
+var errNoCache = errors.New("not connected to the apiserver and no cached state")
+
+// loadCache returns the state saved the last time nexd was connected to the apiserver, or nil if there is none for
+// this device.
+func (nx *Nexodus) loadCache() *state.Cache {
+	if nx.stateStore == nil || nx.stateStore.State() == nil {
+		return nil
+	}
+	cache := nx.stateStore.State().Cache
+	if cache == nil || !nx.cachedFromApiURLs(cache) || (nx.vpcId != "" && cache.VPC.Id != nx.vpcId) {
+		return nil
+	}
+	for _, device := range cache.Devices {
+		if device.Id == cache.DeviceID && device.PublicKey == nx.wireguardPubKey {
+			return cache
+		}
+	}
+	return nil
+}
+
+// cachedFromApiURLs determines if the state was cached from the apiservers of the service nexd is configured with, the
+// list of apiservers changes as they are added and removed.
+func (nx *Nexodus) cachedFromApiURLs(cache *state.Cache) bool {
+	for _, apiURL := range nx.apiURLs {
+		if slices.Contains(cache.ApiURLs, apiURL.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateCache records a change of the state learned from the apiserver, storeCache saves it later. The cache is
+// replaced rather than modified, the state store may be encoding the previous one.
+func (nx *Nexodus) updateCache(update func(cache *state.Cache)) {
+	cache := state.Cache{}
+	if nx.cache != nil {
+		cache = *nx.cache
+	}
+	cache.ApiURLs = nil
+	for _, apiURL := range nx.apiURLs {
+		cache.ApiURLs = append(cache.ApiURLs, apiURL.String())
+	}
+	cache.VPC = *nx.vpc
+	cache.DeviceID = nx.deviceId
+	update(&cache)
+	nx.cache = &cache
+	nx.cacheChanged = true
+}
+
+// storeCache saves the state learned from the apiserver if it changed since it was last saved.
+func (nx *Nexodus) storeCache() {
+	if !nx.cacheChanged || nx.stateStore == nil {
+		return
+	}
+	nx.stateStore.State().Cache = nx.cache
+	if err := nx.stateStore.Store(); err != nil {
+		nx.logger.Warnf("failed to save the cached state: %v", err)
+		return
+	}
+	nx.cacheChanged = false
+}
+
+// listDevices returns the devices of the vpc, from the cached state until nexd connects to the apiserver.
+func (nx *Nexodus) listDevices() (map[string]public.ModelsDevice, *http.Response, error) {
+	if nx.devicesInformer == nil {
+		if nx.cache == nil {
+			return nil, nil, errNoCache
+		}
+		return cachedDevices(nx.cache), nil, nil
+	}
+	devices, resp, err := nx.devicesInformer.Execute()
+	if err != nil {
+		return devices, resp, err
+	}
+	if revision := nx.devicesInformer.Revision(); nx.cache == nil || nx.cache.DevicesRevision != revision {
+		nx.updateCache(func(cache *state.Cache) {
+			cache.Devices = make([]public.ModelsDevice, 0, len(devices))
+			for _, device := range devices {
+				device.BearerToken = ""
+				cache.Devices = append(cache.Devices, device)
+			}
+			cache.DevicesRevision = revision
+		})
+	}
+	return devices, resp, nil
+}
+
+// listSecurityGroups returns the security groups of the vpc, from the cached state until nexd connects to the apiserver.
+func (nx *Nexodus) listSecurityGroups() (map[string]public.ModelsSecurityGroup, *http.Response, error) {
+	if nx.securityGroupsInformer == nil {
+		if nx.cache == nil {
+			return nil, nil, errNoCache
+		}
+		return cachedSecurityGroups(nx.cache), nil, nil
+	}
+	securityGroups, resp, err := nx.securityGroupsInformer.Execute()
+	if err != nil {
+		return securityGroups, resp, err
+	}
+	if revision := nx.securityGroupsInformer.Revision(); nx.cache == nil || nx.cache.SecurityGroupsRevision != revision {
+		nx.updateCache(func(cache *state.Cache) {
+			cache.SecurityGroups = make([]public.ModelsSecurityGroup, 0, len(securityGroups))
+			for _, securityGroup := range securityGroups {
+				cache.SecurityGroups = append(cache.SecurityGroups, securityGroup)
+			}
+			cache.SecurityGroupsRevision = revision
+		})
+	}
+	return securityGroups, resp, nil
+}
+
+// resumeInformers seeds new informers with the cached state, so that their watches only receive the changes made
+// since it was saved.
+func (nx *Nexodus) resumeInformers() {
+	if nx.cache == nil || nx.cache.VPC.Id != nx.vpc.Id || nx.cache.DeviceID != nx.deviceId {
+		return
+	}
+	nx.devicesInformer.Resume(cachedDevices(nx.cache), nx.cache.DevicesRevision)
+	nx.securityGroupsInformer.Resume(cachedSecurityGroups(nx.cache), nx.cache.SecurityGroupsRevision)
+}
+
+// startFromCache brings up the peers of the cached state while the apiserver is unreachable.
+func (nx *Nexodus) startFromCache(ctx context.Context, cache *state.Cache) {
+	vpc := cache.VPC
+	nx.vpc = &vpc
+	nx.deviceId = cache.DeviceID
+	nx.cache = cache
+	nx.SetStatus(NexdStatusRunning, "The apiserver is unreachable, the peers are configured from the cached state\n")
+	nx.logger.Infof("Starting with the %d devices of vpc [ %s (%s) ] cached at revision %d",
+		len(cache.Devices), vpc.Id, vpc.Description, cache.DevicesRevision)
+	if err := nx.reconcileDeviceCache(); err != nil {
+		nx.logger.Warnf("Failed to configure the peers from the cached state: %v", err)
+	}
+	nx.reconcileSecurityGroups(ctx)
+}
+
+// rejoin keeps the peers of the cached state up while it tries to join the vpc again, it returns false if nexd stops
+// before the apiserver is reachable.
+func (nx *Nexodus) rejoin(ctx context.Context) (public.ModelsDevice, bool) {
+	pollTicker := time.NewTicker(pollInterval)
+	defer pollTicker.Stop()
+	joinTicker := time.NewTicker(retryInterval)
+	defer joinTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return public.ModelsDevice{}, false
+		case <-pollTicker.C:
+			// peers that do not come up move on to the next peering method, like they do when connected
+			if err := nx.reconcileDeviceCache(); err != nil {
+				nx.logger.Debugf("Failed to reconcile the peers of the cached state: %v", err)
+			}
+		case <-joinTicker.C:
+			device, err := nx.join(ctx, 0)
+			if err != nil {
+				nx.logger.Debugf("Failed to join the vpc, retrying in %v: %v", retryInterval, err)
+				continue
+			}
+			nx.SetStatus(NexdStatusRunning, "")
+			nx.logger.Info("Connected to the apiserver, resuming from the cached state")
+			return device, true
+		}
+	}
+}
+
+func cachedDevices(cache *state.Cache) map[string]public.ModelsDevice {
+	devices := make(map[string]public.ModelsDevice, len(cache.Devices))
+	for _, device := range cache.Devices {
+		devices[device.Id] = device
+	}
+	return devices
+}
+
+func cachedSecurityGroups(cache *state.Cache) map[string]public.ModelsSecurityGroup {
+	securityGroups := make(map[string]public.ModelsSecurityGroup, len(cache.SecurityGroups))
+	for _, securityGroup := range cache.SecurityGroups {
+		securityGroups[securityGroup.Id] = securityGroup
+	}
+	return securityGroups
+}
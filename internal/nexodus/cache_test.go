@@ -0,0 +1,88 @@
+package nexodus
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/state"
+	"github.com/nexodus-io/nexodus/internal/state/fstore"
+)
+
+func TestCache(t *testing.T) {
+	require := require.New(t)
+	zLogger, _ := zap.NewDevelopment()
+	file := filepath.Join(t.TempDir(), "state.json")
+	newNexodus := func() *Nexodus {
+		store := fstore.New(file)
+		require.NoError(store.Load())
+		return &Nexodus{
+			apiURL: &url.URL{Scheme: "https", Host: "api-east.example.com"},
+			apiURLs: []*url.URL{
+				{Scheme: "https", Host: "api-east.example.com"},
+				{Scheme: "https", Host: "api.example.com"},
+			},
+			logger:          zLogger.Sugar(),
+			stateStore:      store,
+			wireguardPubKey: "bacon",
+		}
+	}
+
+	// nothing is cached before nexd first connects
+	nx := newNexodus()
+	require.Nil(nx.loadCache())
+	_, _, err := nx.listDevices()
+	require.ErrorIs(err, errNoCache)
+
+	// what was learned from the apiserver is saved
+	nx.vpc = &public.ModelsVPC{Id: "vpc1", Ipv4Cidr: "100.64.0.0/10"}
+	nx.deviceId = "device1"
+	nx.updateCache(func(cache *state.Cache) {
+		cache.Devices = []public.ModelsDevice{
+			{Id: "device1", PublicKey: "bacon", Revision: 3},
+			{Id: "device2", PublicKey: "eggs", Revision: 5},
+		}
+		cache.DevicesRevision = 7
+		cache.SecurityGroups = []public.ModelsSecurityGroup{{Id: "sg1", Revision: 2}}
+		cache.SecurityGroupsRevision = 2
+	})
+	nx.storeCache()
+	require.False(nx.cacheChanged)
+
+	// and used after a restart
+	nx = newNexodus()
+	cache := nx.loadCache()
+	require.NotNil(cache)
+	require.Equal("vpc1", cache.VPC.Id)
+	require.Equal(int32(7), cache.DevicesRevision)
+	nx.cache = cache
+	devices, _, err := nx.listDevices()
+	require.NoError(err)
+	require.Len(devices, 2)
+	require.Equal("eggs", devices["device2"].PublicKey)
+	securityGroups, _, err := nx.listSecurityGroups()
+	require.NoError(err)
+	require.Contains(securityGroups, "sg1")
+
+	// also when only some of the apiservers are known, like when their SRV record can't be resolved
+	nx = newNexodus()
+	nx.apiURL = &url.URL{Scheme: "https", Host: "api.example.com"}
+	nx.apiURLs = []*url.URL{nx.apiURL}
+	require.NotNil(nx.loadCache())
+
+	// unless it is the state of another vpc, service or device key
+	nx = newNexodus()
+	nx.vpcId = "vpc2"
+	require.Nil(nx.loadCache())
+	nx = newNexodus()
+	nx.apiURL = &url.URL{Scheme: "https", Host: "api.other.com"}
+	nx.apiURLs = []*url.URL{nx.apiURL}
+	require.Nil(nx.loadCache())
+	nx = newNexodus()
+	nx.wireguardPubKey = "toast"
+	require.Nil(nx.loadCache())
+}
@@ -0,0 +1,380 @@
+package nexodus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slices"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+// how often the configuration file is checked for changes
+const configReloadInterval = 5 * time.Second
+
+// Config holds the settings of the nexd configuration file. The settings are named like the flags they stand in for,
+// a flag set on the command line or through its environment variable takes precedence over the file.
+type Config struct {
+	// the mode nexd runs in: agent, router, relay or proxy
+	Mode                  string   `json:"mode,omitempty"`
+	LogLevel              string   `json:"log-level,omitempty"`
+	ServiceURL            string   `json:"service-url,omitempty"`
+	ApiURLs               []string `json:"api-url,omitempty"`
+	RegKey                string   `json:"reg-key,omitempty"`
+	Username              string   `json:"username,omitempty"`
+	Password              string   `json:"password,omitempty"`
+	InsecureSkipTlsVerify *bool    `json:"insecure-skip-tls-verify,omitempty"`
+	StateDir              string   `json:"state-dir,omitempty"`
+	StunServers           []string `json:"stun-server,omitempty"`
+	VpcId                 string   `json:"vpc-id,omitempty"`
+	SecurityGroupId       string   `json:"security-group-id,omitempty"`
+	ListenPort            *int     `json:"listen-port,omitempty"`
+	RequestIP             string   `json:"request-ip,omitempty"`
+	LocalEndpointIP       string   `json:"local-endpoint-ip,omitempty"`
+	RelayOnly             *bool    `json:"relay-only,omitempty"`
+	TCPRelay              *bool    `json:"tcp-relay,omitempty"`
+	HolePunch             *bool    `json:"hole-punch,omitempty"`
+	PortMapping           *bool    `json:"port-mapping,omitempty"`
+	ExitNodeClient        *bool    `json:"exit-node-client,omitempty"`
+	// the persistent keepalive interval of the tunnels in seconds, 0 turns it off
+	Keepalive *int `json:"keepalive,omitempty"`
+	// router mode
+	AdvertiseCidrs []string `json:"advertise-cidr,omitempty"`
+	NetworkRouter  *bool    `json:"network-router,omitempty"`
+	DisableNAT     *bool    `json:"disable-nat,omitempty"`
+	ExitNode       *bool    `json:"exit-node,omitempty"`
+	// proxy mode
+	Ingress []string `json:"ingress,omitempty"`
+	Egress  []string `json:"egress,omitempty"`
+}
+
+// the settings that are applied to a running nexd, changes to the others take a restart
+var liveConfigSettings = []string{"log-level", "advertise-cidr", "exit-node-client", "keepalive", "ingress", "egress"}
+
+// LoadConfig reads the configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	config := &Config{}
+	if !bytes.Equal(bytes.TrimSpace(jsonData), []byte("null")) {
+		decoder := json.NewDecoder(bytes.NewReader(jsonData))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(config); err != nil {
+			return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks the values of the settings.
+func (c *Config) Validate() error {
+	switch c.Mode {
+	case "", "agent", "router", "relay", "proxy":
+	default:
+		return fmt.Errorf("unknown mode %q, it must be agent, router, relay or proxy", c.Mode)
+	}
+	if c.LogLevel != "" {
+		if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+			return fmt.Errorf("invalid log-level: %w", err)
+		}
+	}
+	for _, cidr := range c.AdvertiseCidrs {
+		if err := ValidateCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid advertise-cidr %s: %w", cidr, err)
+		}
+	}
+	if c.Keepalive != nil && (*c.Keepalive < 0 || *c.Keepalive > 65535) {
+		return fmt.Errorf("invalid keepalive %d, it must be between 0 and 65535 seconds", *c.Keepalive)
+	}
+	for _, ip := range []string{c.RequestIP, c.LocalEndpointIP} {
+		if ip != "" {
+			if err := ValidateIp(ip); err != nil {
+				return fmt.Errorf("invalid IP address %s: %w", ip, err)
+			}
+		}
+	}
+	if _, err := parseConfigProxyRules(c.Ingress, ProxyTypeIngress); err != nil {
+		return err
+	}
+	if _, err := parseConfigProxyRules(c.Egress, ProxyTypeEgress); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Setting returns the value of the setting with the given name, and false if the file does not set it.
+func (c *Config) Setting(name string) (any, bool) {
+	value, ok := c.settings()[name]
+	return value, ok
+}
+
+// settings returns the values of the settings set in the file by their names.
+func (c *Config) settings() map[string]any {
+	result := map[string]any{}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0) {
+			continue
+		}
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if field.Kind() == reflect.Pointer {
+			field = field.Elem()
+		}
+		result[name] = field.Interface()
+	}
+	return result
+}
+
+// merge returns the settings of c with the ones set in other taking precedence.
+func (c *Config) merge(other *Config) *Config {
+	result := *c
+	v, o := reflect.ValueOf(&result).Elem(), reflect.ValueOf(other).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := o.Field(i)
+		if field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0) {
+			continue
+		}
+		v.Field(i).Set(field)
+	}
+	return &result
+}
+
+// changedSettings returns the names of the settings that differ between two versions of the file.
+func changedSettings(from, to *Config) []string {
+	fromSettings, toSettings := from.settings(), to.settings()
+	var changed []string
+	for name, value := range toSettings {
+		if !reflect.DeepEqual(fromSettings[name], value) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range fromSettings {
+		if _, ok := toSettings[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func parseConfigProxyRules(rules []string, proxyType ProxyType) ([]ProxyRule, error) {
+	var result []ProxyRule
+	for _, rule := range rules {
+		proxyRule, err := ParseProxyRule(rule, proxyType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s proxy rule %s: %w", proxyType, rule, err)
+		}
+		result = append(result, proxyRule)
+	}
+	return result, nil
+}
+
+// configState tracks the configuration file nexd was started with, and the changes made to it since.
+type configState struct {
+	file string
+	// the settings set by flags, the file and the device profile do not override them
+	flags []string
+	// the file as nexd was started with, and as last read
+	started *Config
+	config  *Config
+	// the settings of the device profile assigned to the device, they take precedence over the file
+	profile *Config
+	// the live settings as last applied, from the file and the device profile
+	applied *Config
+	// the last error reading the file, so that it is only logged once
+	err string
+
+	mu sync.Mutex
+	// the settings changed in the file that are applied when nexd restarts
+	restart []string
+}
+
+// restartMessage returns what the status reports about the changes to the configuration file that take a restart.
+func (c *configState) restartMessage() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.restart) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Restart nexd to apply the changes to %s of: %s\n", c.file, strings.Join(c.restart, ", "))
+}
+
+// reloadConfig applies the changes made to the configuration file since it was last read. The settings that can be
+// changed while nexd runs are applied without touching the tunnel, the others are reported as taking a restart.
+func (nx *Nexodus) reloadConfig(ctx context.Context, wg *sync.WaitGroup) {
+	if nx.configState.file == "" {
+		return
+	}
+	config, err := LoadConfig(nx.configState.file)
+	if err != nil {
+		if err.Error() != nx.configState.err {
+			nx.logger.Errorf("Failed to reload the configuration, keeping the current one: %v", err)
+			nx.configState.err = err.Error()
+		}
+		return
+	}
+	nx.configState.err = ""
+
+	changed := changedSettings(nx.configState.config, config)
+	if len(changed) == 0 {
+		return
+	}
+	for _, name := range changed {
+		if slices.Contains(nx.configState.flags, name) {
+			nx.logger.Infof("Ignoring the change to %s in the configuration file, it is set by a flag", name)
+		}
+	}
+	nx.configState.config = config
+	nx.applyLiveSettings(ctx, wg, "the configuration file")
+
+	// the settings that differ from the ones nexd was started with, a change that is reverted needs no restart
+	var restart []string
+	for _, name := range changedSettings(nx.configState.started, config) {
+		if !slices.Contains(liveConfigSettings, name) && !slices.Contains(nx.configState.flags, name) {
+			restart = append(restart, name)
+		}
+	}
+	if len(restart) > 0 {
+		nx.logger.Warnf("Restart nexd to apply the changes to %s in the configuration file", strings.Join(restart, ", "))
+	}
+	nx.configState.mu.Lock()
+	nx.configState.restart = restart
+	nx.configState.mu.Unlock()
+}
+
+// applyLiveSettings applies the live settings that changed since they were last applied, from the configuration file
+// and the device profile. The device profile takes precedence over the file, and a flag over both.
+func (nx *Nexodus) applyLiveSettings(ctx context.Context, wg *sync.WaitGroup, source string) {
+	previous := nx.configState.applied
+	if previous == nil {
+		previous = nx.configState.started
+	}
+	live := nx.configState.config
+	if nx.configState.profile != nil {
+		live = live.merge(nx.configState.profile)
+	}
+	for _, name := range changedSettings(previous, live) {
+		if !slices.Contains(liveConfigSettings, name) || slices.Contains(nx.configState.flags, name) {
+			continue
+		}
+		if err := nx.applyConfigSetting(ctx, wg, name, previous, live); err != nil {
+			nx.logger.Errorf("Failed to apply the change to %s in %s: %v", name, source, err)
+			continue
+		}
+		nx.logger.Infof("Applied the change to %s in %s", name, source)
+	}
+	nx.configState.applied = live
+}
+
+func (nx *Nexodus) applyConfigSetting(ctx context.Context, wg *sync.WaitGroup, name string, previous, config *Config) error {
+	switch name {
+	case "log-level":
+		level := zapcore.InfoLevel
+		if config.LogLevel != "" {
+			level, _ = zapcore.ParseLevel(config.LogLevel)
+		}
+		nx.logLevel.SetLevel(level)
+	case "ingress", "egress":
+		if !nx.userspaceMode {
+			return fmt.Errorf("proxy rules only apply in proxy mode")
+		}
+		return nx.applyConfigProxyRules(ctx, wg, previous, config)
+	case "advertise-cidr":
+		return nx.applyConfigAdvertiseCidrs(ctx, config.AdvertiseCidrs)
+	case "exit-node-client":
+		if runtime.GOOS != Linux.String() {
+			return fmt.Errorf("exit-node support is currently only supported for Linux operating systems")
+		}
+		if config.ExitNodeClient != nil && *config.ExitNodeClient {
+			return nx.ExitNodeClientSetup()
+		}
+		nx.exitNode.exitNodeClientEnabled = false
+		return nx.exitNodeClientTeardown()
+	case "keepalive":
+		nx.keepalive = defaultKeepalive
+		if config.Keepalive != nil {
+			nx.keepalive = *config.Keepalive
+		}
+		if nx.devicesInformer == nil && nx.cache == nil {
+			// the peers are configured with it once they are known
+			return nil
+		}
+		return nx.reconcileDeviceCache()
+	}
+	return nil
+}
+
+// applyConfigProxyRules removes the proxy rules that were removed from the file, and starts the ones added to it.
+func (nx *Nexodus) applyConfigProxyRules(ctx context.Context, wg *sync.WaitGroup, previous, config *Config) error {
+	rules := func(c *Config) []ProxyRule {
+		ingress, _ := parseConfigProxyRules(c.Ingress, ProxyTypeIngress)
+		egress, _ := parseConfigProxyRules(c.Egress, ProxyTypeEgress)
+		return append(ingress, egress...)
+	}
+	previousRules, newRules := rules(previous), rules(config)
+	for _, rule := range previousRules {
+		if slices.Contains(newRules, rule) {
+			continue
+		}
+		if _, err := nx.UserspaceProxyRemove(rule); err != nil {
+			return err
+		}
+	}
+	for _, rule := range newRules {
+		if slices.Contains(previousRules, rule) {
+			continue
+		}
+		proxy, err := nx.UserspaceProxyAdd(rule)
+		if err != nil {
+			return err
+		}
+		proxy.Start(ctx, wg, nx.userspaceNet)
+	}
+	return nil
+}
+
+// applyConfigAdvertiseCidrs advertises a new list of CIDRs, routing them if this device is a network router.
+func (nx *Nexodus) applyConfigAdvertiseCidrs(ctx context.Context, cidrs []string) error {
+	cidrs = append([]string{}, cidrs...)
+	if nx.exitNode.exitNodeOriginEnabled && !slices.Contains(cidrs, "0.0.0.0/0") {
+		cidrs = append(cidrs, "0.0.0.0/0")
+	}
+	if len(cidrs) == 0 {
+		return fmt.Errorf("the service keeps the advertised CIDRs when none are left, restart nexd without them instead")
+	}
+	nx.advertiseCidrs = cidrs
+	if nx.networkRouter {
+		if err := nx.setupNetworkRouterNode(); err != nil {
+			return err
+		}
+	}
+	if nx.devicesInformer == nil {
+		// joining the vpc again advertises them
+		return nil
+	}
+	_, _, err := nx.client.DevicesApi.UpdateDevice(ctx, nx.deviceId).Update(public.ModelsUpdateDevice{
+		AdvertiseCidrs: nx.advertiseCidrs,
+	}).Execute()
+	return err
+}
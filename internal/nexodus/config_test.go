@@ -0,0 +1,101 @@
+package nexodus
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestConfig(t *testing.T) {
+	require := require.New(t)
+	file := filepath.Join(t.TempDir(), "nexd.yaml")
+	write := func(data string) {
+		require.NoError(os.WriteFile(file, []byte(data), 0600))
+	}
+
+	write(`
+mode: router
+listen-port: 51820
+tcp-relay: false
+advertise-cidr:
+  - 10.10.0.0/24
+`)
+	config, err := LoadConfig(file)
+	require.NoError(err)
+	require.Equal("router", config.Mode)
+	value, ok := config.Setting("tcp-relay")
+	require.True(ok)
+	require.Equal(false, value)
+	value, ok = config.Setting("listen-port")
+	require.True(ok)
+	require.Equal(51820, value)
+	_, ok = config.Setting("hole-punch")
+	require.False(ok)
+
+	// typos and invalid values are caught before they are applied
+	write("listen-prot: 51820\n")
+	_, err = LoadConfig(file)
+	require.ErrorContains(err, "listen-prot")
+	write("advertise-cidr: [10.10.0.0]\n")
+	_, err = LoadConfig(file)
+	require.Error(err)
+	write("log-level: loud\n")
+	_, err = LoadConfig(file)
+	require.Error(err)
+
+	// an empty file sets nothing
+	write("")
+	config, err = LoadConfig(file)
+	require.NoError(err)
+	require.Empty(config.settings())
+}
+
+func TestReloadConfig(t *testing.T) {
+	require := require.New(t)
+	file := filepath.Join(t.TempDir(), "nexd.yaml")
+	write := func(data string) {
+		require.NoError(os.WriteFile(file, []byte(data), 0600))
+	}
+	write("log-level: info\nlisten-port: 51820\n")
+	config, err := LoadConfig(file)
+	require.NoError(err)
+
+	logLevel := zap.NewAtomicLevelAt(zap.InfoLevel)
+	nx := &Nexodus{
+		logger:   zap.NewNop().Sugar(),
+		logLevel: &logLevel,
+		configState: configState{
+			file:    file,
+			flags:   []string{"relay-only"},
+			started: config,
+			config:  config,
+		},
+	}
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+
+	// the log level is applied live, the listen port takes a restart
+	write("log-level: debug\nlisten-port: 51821\nrelay-only: true\n")
+	nx.reloadConfig(ctx, wg)
+	require.Equal(zap.DebugLevel, logLevel.Level())
+	require.Equal([]string{"listen-port"}, nx.configState.restart)
+	require.Contains(nx.configState.restartMessage(), "listen-port")
+
+	// an invalid file keeps the current configuration
+	write("log-level: loud\n")
+	nx.reloadConfig(ctx, wg)
+	require.Equal(zap.DebugLevel, logLevel.Level())
+	require.NotEmpty(nx.configState.err)
+
+	// reverting a change no longer takes a restart, and removing a setting restores its default
+	write("listen-port: 51820\n")
+	nx.reloadConfig(ctx, wg)
+	require.Equal(zap.InfoLevel, logLevel.Level())
+	require.Empty(nx.configState.restart)
+	require.Empty(nx.configState.restartMessage())
+}
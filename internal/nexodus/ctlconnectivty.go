@@ -71,12 +71,17 @@ func (nx *Nexodus) connectivityProbe(family string) api.PingPeersResponse {
 			}
 
 			hostname := value.device.Hostname
-			peersByKey[pubKey] = api.KeepaliveStatus{
+			status := api.KeepaliveStatus{
 				WgIP:        nodeAddr,
 				IsReachable: false,
 				Hostname:    hostname,
 				Method:      value.peeringMethod,
+				PathReason:  value.pathReason,
 			}
+			if value.peeringMethod == peeringMethodViaRelay || value.peeringMethod == peeringMethodViaTCPRelay {
+				status.RelayReason = nx.relayReason(value.device)
+			}
+			peersByKey[pubKey] = status
 		})
 	}
 	res.Peers = nx.probeConnectivity(peersByKey, nx.logger)
@@ -126,6 +131,8 @@ func (nx *Nexodus) probeConnectivity(peersByKey map[string]api.KeepaliveStatus,
 				Hostname:    result.Hostname,
 				Latency:     result.Latency,
 				Method:      result.Method,
+				RelayReason: result.RelayReason,
+				PathReason:  result.PathReason,
 			}
 		}
 	}
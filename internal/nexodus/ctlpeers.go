@@ -20,10 +20,26 @@ func (ac *NexdCtl) ListPeers(_ string, result *string) error {
 		Peers:         peers,
 		RelayRequired: ac.nx.symmetricNat,
 	}
+	relays := map[string]deviceCacheEntry{}
+	ac.nx.deviceCacheIterRead(func(d deviceCacheEntry) {
+		if d.device.Relay {
+			relays[d.device.Id] = d
+		}
+	})
 	ac.nx.deviceCacheIterRead(func(d deviceCacheEntry) {
 		if d.device.PublicKey == ac.nx.wireguardPubKey {
 			return
 		}
+		if relay, ok := relays[d.relayID]; ok {
+			// relayed peers have no wireguard peer of their own, they are as healthy as their relay
+			response.Peers[d.device.PublicKey] = WgSessions{
+				PublicKey:  d.device.PublicKey,
+				AllowedIPs: append(append([]string{}, d.device.AllowedIps...), d.device.AdvertiseCidrs...),
+				Healthy:    relay.peerHealthy,
+				Relay:      relayName(relay.device),
+			}
+			return
+		}
 		p, ok := response.Peers[d.device.PublicKey]
 		if !ok {
 			return
@@ -2,6 +2,7 @@ package nexodus
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bytedance/gopkg/util/logger"
 
@@ -28,6 +29,7 @@ func (ac *NexdCtl) Status(_ string, result *string) error {
 	if len(ac.nx.statusMsg) > 0 {
 		res += ac.nx.statusMsg
 	}
+	res += ac.nx.configState.restartMessage()
 	*result = res
 	return nil
 }
@@ -51,10 +53,12 @@ func (ac *NexdCtl) ProxyList(_ string, result *string) error {
 	*result = ""
 	ac.nx.proxyLock.RLock()
 	defer ac.nx.proxyLock.RUnlock()
+	now := time.Now()
 	for _, proxy := range ac.nx.proxies {
 		proxy.mu.RLock()
 		for _, rule := range proxy.rules {
-			*result += fmt.Sprintf("%s\n", rule.AsFlag())
+			// the health of the destination follows as a comment, so the line can still be used as a flag
+			*result += fmt.Sprintf("%s  # %s\n", rule.AsFlag(), proxy.backends[rule].status(now))
 		}
 		proxy.mu.RUnlock()
 	}
@@ -138,3 +142,18 @@ func (ac *NexdCtl) GetDebug(_ string, result *string) error {
 	}
 	return nil
 }
+
+// Rekey rotates the wireguard key of the device, the rotation itself runs on the main nexd loop.
+func (ac *NexdCtl) Rekey(_ string, result *string) error {
+	rekeyResult := make(chan error, 1)
+	select {
+	case ac.nx.rekeyRequests <- rekeyResult:
+	case <-ac.nx.nexCtx.Done():
+		return ac.nx.nexCtx.Err()
+	}
+	if err := <-rekeyResult; err != nil {
+		return err
+	}
+	*result = fmt.Sprintf("Rotated the wireguard key, the new public key is [ %s ]", ac.nx.wireguardPubKey)
+	return nil
+}
@@ -0,0 +1,185 @@
+package nexodus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+// deviceActionsChanged returns a channel that is notified when the device actions of the vpc change, nil until
+// nexd connects to the apiserver.
+func (nx *Nexodus) deviceActionsChanged() <-chan struct{} {
+	if nx.deviceActionsInformer == nil {
+		return nil
+	}
+	return nx.deviceActionsInformer.Changed()
+}
+
+// reconcileDeviceActions runs the actions an admin asked this device to run. Each action is acknowledged before it
+// runs and its result is posted back once it completes, an action is only run once even if posting the result fails.
+func (nx *Nexodus) reconcileDeviceActions(ctx context.Context) {
+	actions, _, err := nx.deviceActionsInformer.Execute()
+	if err != nil {
+		nx.logger.Debugf("failed to list the device actions: %v", err)
+		return
+	}
+
+	listed := map[string]bool{}
+	for _, action := range actions {
+		listed[action.Id] = true
+	}
+	for id := range nx.deviceActionsHandled {
+		if !listed[id] {
+			delete(nx.deviceActionsHandled, id)
+		}
+	}
+
+	for _, action := range actions {
+		if action.DeviceId != nx.deviceId || action.Status != "pending" || nx.deviceActionsHandled[action.Id] {
+			continue
+		}
+		if nx.deviceActionsHandled == nil {
+			nx.deviceActionsHandled = map[string]bool{}
+		}
+		nx.deviceActionsHandled[action.Id] = true
+
+		_, _, err := nx.client.DevicesApi.UpdateDeviceAction(ctx, nx.deviceId, action.Id).DeviceAction(public.ModelsUpdateDeviceAction{
+			Status: "acknowledged",
+		}).Execute()
+		if err != nil {
+			nx.logger.Warnf("failed to acknowledge the %s action %s: %v", action.Action, action.Id, err)
+		}
+
+		nx.logger.Infof("Running the %s action %s", action.Action, action.Id)
+		update := public.ModelsUpdateDeviceAction{Status: "succeeded"}
+		update.Result, err = nx.runDeviceAction(ctx, action)
+		if err != nil {
+			nx.logger.Warnf("the %s action %s failed: %v", action.Action, action.Id, err)
+			update = public.ModelsUpdateDeviceAction{Status: "failed", Result: err.Error()}
+		}
+		_, _, err = nx.client.DevicesApi.UpdateDeviceAction(ctx, nx.deviceId, action.Id).DeviceAction(update).Execute()
+		if err != nil {
+			nx.logger.Warnf("failed to post the result of the %s action %s: %v", action.Action, action.Id, err)
+		}
+	}
+}
+
+// runDeviceAction runs a device action and returns its result.
+func (nx *Nexodus) runDeviceAction(ctx context.Context, action public.ModelsDeviceAction) (string, error) {
+	switch action.Action {
+	case "stun":
+		nx.natBehaviorDisco()
+		if err := nx.reconcileStun(nx.deviceId); err != nil {
+			return "", err
+		}
+		nat := nx.natBehaviorModel()
+		return fmt.Sprintf("reflexive address %s, NAT mapping %s, filtering %s", nx.nodeReflexiveAddressIPv4, nat.Mapping, nat.Filtering), nil
+
+	case "rekey":
+		if err := nx.rotateKeys(ctx, nx.deviceId); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("the new public key is %s", nx.wireguardPubKey), nil
+
+	case "flush-peers":
+		nx.deviceCacheLock.Lock()
+		for key, d := range nx.deviceCache {
+			nx.peeringReset(&d)
+			nx.deviceCache[key] = d
+		}
+		peers := len(nx.deviceCache)
+		nx.deviceCacheLock.Unlock()
+		if err := nx.reconcileDeviceCache(); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("peering started over with %d peers", peers), nil
+
+	case "diagnostics":
+		return nx.diagnostics()
+
+	case "log-level":
+		argument := action.Argument
+		if argument == "" {
+			argument = "debug"
+		}
+		level, err := zapcore.ParseLevel(argument)
+		if err != nil {
+			return "", err
+		}
+		nx.logLevel.SetLevel(level)
+		return fmt.Sprintf("log level set to %s", level), nil
+	}
+	return "", fmt.Errorf("unknown action: %s", action.Action)
+}
+
+// diagnostics collects what an admin needs to troubleshoot this device into a json document.
+func (nx *Nexodus) diagnostics() (string, error) {
+	peers, err := nx.DumpPeersDefault()
+	if err != nil {
+		return "", fmt.Errorf("failed to list the wireguard peers: %w", err)
+	}
+	status := ""
+	if err := (&NexdCtl{nx: nx}).Status("", &status); err != nil {
+		return "", err
+	}
+	result, err := json.MarshalIndent(struct {
+		Version          string                   `json:"version"`
+		Status           string                   `json:"status"`
+		OS               string                   `json:"os"`
+		Arch             string                   `json:"arch"`
+		TunnelIP         string                   `json:"tunnel_ip"`
+		TunnelIPv6       string                   `json:"tunnel_ipv6"`
+		ReflexiveAddress string                   `json:"reflexive_address"`
+		SymmetricNat     bool                     `json:"symmetric_nat"`
+		Nat              public.ModelsNatBehavior `json:"nat"`
+		Relay            bool                     `json:"relay"`
+		MTU              int                      `json:"mtu"`
+		LogLevel         string                   `json:"log_level"`
+		Config           *Config                  `json:"config"`
+		Peers            map[string]WgSessions    `json:"peers"`
+	}{
+		Version:          nx.version,
+		Status:           status,
+		OS:               nx.os,
+		Arch:             runtime.GOARCH,
+		TunnelIP:         nx.TunnelIP,
+		TunnelIPv6:       nx.TunnelIpV6,
+		ReflexiveAddress: nx.nodeReflexiveAddressIPv4.String(),
+		SymmetricNat:     nx.symmetricNat,
+		Nat:              nx.natBehaviorModel(),
+		Relay:            nx.relay,
+		MTU:              nx.mtu,
+		LogLevel:         nx.logLevel.Level().String(),
+		Config:           nx.diagnosticsConfig(),
+		Peers:            peers,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// diagnosticsConfig returns the live settings of the configuration file and the device profile as last applied. Only
+// the live settings are listed by name, the credentials and the other settings of the file are left out.
+func (nx *Nexodus) diagnosticsConfig() *Config {
+	applied := nx.configState.applied
+	if applied == nil {
+		applied = nx.configState.started
+	}
+	if applied == nil {
+		return nil
+	}
+	return &Config{
+		LogLevel:       applied.LogLevel,
+		AdvertiseCidrs: applied.AdvertiseCidrs,
+		ExitNodeClient: applied.ExitNodeClient,
+		Keepalive:      applied.Keepalive,
+		Ingress:        applied.Ingress,
+		Egress:         applied.Egress,
+	}
+}
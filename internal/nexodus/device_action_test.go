@@ -0,0 +1,68 @@
+package nexodus
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestRunDeviceAction(t *testing.T) {
+	require := require.New(t)
+	logLevel := zap.NewAtomicLevelAt(zap.InfoLevel)
+	nx := &Nexodus{
+		logger:   zap.NewNop().Sugar(),
+		logLevel: &logLevel,
+	}
+	ctx := context.Background()
+
+	// the log level defaults to debug
+	result, err := nx.runDeviceAction(ctx, public.ModelsDeviceAction{Action: "log-level"})
+	require.NoError(err)
+	require.Equal("log level set to debug", result)
+	require.Equal(zap.DebugLevel, logLevel.Level())
+
+	result, err = nx.runDeviceAction(ctx, public.ModelsDeviceAction{Action: "log-level", Argument: "warn"})
+	require.NoError(err)
+	require.Equal("log level set to warn", result)
+	require.Equal(zap.WarnLevel, logLevel.Level())
+
+	_, err = nx.runDeviceAction(ctx, public.ModelsDeviceAction{Action: "log-level", Argument: "loud"})
+	require.Error(err)
+	require.Equal(zap.WarnLevel, logLevel.Level())
+
+	_, err = nx.runDeviceAction(ctx, public.ModelsDeviceAction{Action: "reboot"})
+	require.EqualError(err, "unknown action: reboot")
+}
+
+func TestDiagnosticsConfig(t *testing.T) {
+	require := require.New(t)
+	nx := &Nexodus{}
+	require.Nil(nx.diagnosticsConfig())
+
+	keepalive := 10
+	nx.configState.applied = &Config{
+		ServiceURL: "https://try.nexodus.127.0.0.1.nip.io",
+		RegKey:     "the-reg-key",
+		Username:   "admin",
+		Password:   "the-password",
+		LogLevel:   "debug",
+		Keepalive:  &keepalive,
+		Ingress:    []string{"tcp:443:127.0.0.1:8443"},
+	}
+	config := nx.diagnosticsConfig()
+	require.Equal(&Config{
+		LogLevel:  "debug",
+		Keepalive: &keepalive,
+		Ingress:   []string{"tcp:443:127.0.0.1:8443"},
+	}, config)
+
+	data, err := json.Marshal(config)
+	require.NoError(err)
+	require.NotContains(string(data), "the-reg-key")
+	require.NotContains(string(data), "the-password")
+}
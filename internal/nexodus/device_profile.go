@@ -0,0 +1,134 @@
+package nexodus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/state"
+)
+
+// deviceProfilesChanged returns a channel that is notified when the device profiles of the vpc change, nil until
+// nexd connects to the apiserver.
+func (nx *Nexodus) deviceProfilesChanged() <-chan struct{} {
+	if nx.deviceProfilesInformer == nil {
+		return nil
+	}
+	return nx.deviceProfilesInformer.Changed()
+}
+
+// currentDeviceProfile returns the device profile assigned to this device, or nil without one. It returns false when
+// the profile is not known yet, the informer reports it once it is.
+func (nx *Nexodus) currentDeviceProfile() (*public.ModelsDeviceProfile, bool) {
+	devices, _, err := nx.listDevices()
+	if err != nil {
+		return nil, false
+	}
+	device, ok := devices[nx.deviceId]
+	if !ok {
+		return nil, false
+	}
+	if device.DeviceProfileId == "" {
+		return nil, true
+	}
+	if nx.deviceProfilesInformer == nil {
+		if nx.cache != nil && nx.cache.DeviceProfile != nil && nx.cache.DeviceProfile.Id == device.DeviceProfileId {
+			return nx.cache.DeviceProfile, true
+		}
+		return nil, false
+	}
+	profiles, _, err := nx.deviceProfilesInformer.Execute()
+	if err != nil {
+		nx.logger.Debugf("failed to list the device profiles: %v", err)
+		return nil, false
+	}
+	profile, ok := profiles[device.DeviceProfileId]
+	if !ok {
+		return nil, false
+	}
+	return &profile, true
+}
+
+// reconcileDeviceProfile applies the settings of the device profile assigned to this device when it changes, or
+// reverts them when it is removed.
+func (nx *Nexodus) reconcileDeviceProfile(ctx context.Context, wg *sync.WaitGroup) {
+	profile, ok := nx.currentDeviceProfile()
+	if !ok {
+		return
+	}
+	if !reflect.DeepEqual(profile, nx.deviceProfile) {
+		if profile == nil {
+			nx.logger.Info("The device profile was removed from this device, reverting its settings")
+		} else {
+			nx.logger.Infof("Applying device profile %s at revision %d", profile.Id, profile.Revision)
+		}
+		nx.updateCache(func(cache *state.Cache) {
+			cache.DeviceProfile = profile
+		})
+		nx.configState.profile = nil
+		if profile != nil {
+			nx.configState.profile = deviceProfileConfig(profile.Settings)
+		}
+		nx.deviceProfile = profile
+		nx.applyLiveSettings(ctx, wg, "the device profile")
+	}
+	// retried on the next change until the relay forwarding is set up
+	if err := nx.reconcileRelayRole(); err != nil {
+		nx.logger.Errorf("Failed to apply the relay role of the device profile: %v", err)
+	}
+}
+
+// deviceProfileConfig returns the settings of a device profile as the settings of the configuration file they
+// take precedence over.
+func deviceProfileConfig(settings public.ModelsDeviceProfileSettings) *Config {
+	config := &Config{
+		LogLevel:       settings.LogLevel,
+		AdvertiseCidrs: settings.AdvertiseCidrs,
+		ExitNodeClient: settings.ExitNodeClient,
+		Ingress:        settings.Ingress,
+		Egress:         settings.Egress,
+	}
+	if settings.Keepalive != nil {
+		keepalive := int(*settings.Keepalive)
+		config.Keepalive = &keepalive
+	}
+	return config
+}
+
+// reconcileRelayRole makes this device a relay, or stops it being one, as the apiserver says. The apiserver gives the
+// device the relay role of its device profile, a device started in relay mode stays a relay.
+func (nx *Nexodus) reconcileRelayRole() error {
+	if nx.relayMode || nx.devicesInformer == nil {
+		return nil
+	}
+	devices, _, err := nx.listDevices()
+	if err != nil {
+		return err
+	}
+	device, ok := devices[nx.deviceId]
+	if !ok || device.Relay == nx.relay {
+		return nil
+	}
+	if device.Relay && !nx.relayForwarding {
+		if runtime.GOOS != Linux.String() || nx.userspaceMode {
+			return fmt.Errorf("relay nodes are only supported on Linux without proxy mode")
+		}
+		if err := nx.relayForwardingSetup(); err != nil {
+			return err
+		}
+	}
+	nx.relay = device.Relay
+	if nx.relay {
+		nx.logger.Info("This device is now a relay for the vpc")
+	} else {
+		nx.logger.Info("This device is no longer a relay for the vpc")
+		// the peers stop relaying through this device as the apiserver no longer lists it as a relay
+		if err := nx.relayForwardingTeardown(); err != nil {
+			nx.logger.Warnf("Failed to remove the forwarding of the relay: %v", err)
+		}
+	}
+	return nx.reconcileDeviceCache()
+}
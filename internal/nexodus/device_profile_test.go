@@ -0,0 +1,80 @@
+package nexodus
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/state"
+)
+
+func TestDeviceProfileConfig(t *testing.T) {
+	require := require.New(t)
+	keepalive := int32(0)
+	disabled := false
+	profile := deviceProfileConfig(public.ModelsDeviceProfileSettings{
+		LogLevel:       "debug",
+		Keepalive:      &keepalive,
+		ExitNodeClient: &disabled,
+	})
+
+	listenPort := 51820
+	enabled := true
+	file := &Config{LogLevel: "info", ListenPort: &listenPort, ExitNodeClient: &enabled, AdvertiseCidrs: []string{"10.10.0.0/24"}}
+
+	// the settings of the profile take precedence, including the ones that turn something off
+	live := file.merge(profile)
+	require.Equal("debug", live.LogLevel)
+	require.Equal(0, *live.Keepalive)
+	require.False(*live.ExitNodeClient)
+	require.Equal(51820, *live.ListenPort)
+	require.Equal([]string{"10.10.0.0/24"}, live.AdvertiseCidrs)
+	require.Equal("info", file.LogLevel)
+}
+
+func TestReconcileDeviceProfile(t *testing.T) {
+	require := require.New(t)
+	logLevel := zap.NewAtomicLevelAt(zap.InfoLevel)
+	config := &Config{LogLevel: "info"}
+	vpc := public.ModelsVPC{Id: "vpc"}
+	device := public.ModelsDevice{Id: "device", VpcId: vpc.Id, DeviceProfileId: "profile"}
+	profile := public.ModelsDeviceProfile{Id: "profile", VpcId: vpc.Id, Revision: 1, Settings: public.ModelsDeviceProfileSettings{
+		LogLevel: "debug",
+	}}
+	nx := &Nexodus{
+		logger:      zap.NewNop().Sugar(),
+		logLevel:    &logLevel,
+		vpc:         &vpc,
+		deviceId:    device.Id,
+		configState: configState{started: config, config: config, applied: config},
+		cache:       &state.Cache{VPC: vpc, DeviceID: device.Id, Devices: []public.ModelsDevice{device}, DeviceProfile: &profile},
+	}
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+
+	// the cached profile is applied until nexd connects to the apiserver
+	nx.reconcileDeviceProfile(ctx, wg)
+	require.Equal(zap.DebugLevel, logLevel.Level())
+	require.Equal(&profile, nx.deviceProfile)
+
+	// removing the profile from the device reverts to the configuration file
+	device.DeviceProfileId = ""
+	nx.cache.Devices = []public.ModelsDevice{device}
+	nx.reconcileDeviceProfile(ctx, wg)
+	require.Equal(zap.InfoLevel, logLevel.Level())
+	require.Nil(nx.deviceProfile)
+	require.Nil(nx.cache.DeviceProfile)
+
+	// a setting set by a flag is not changed by the profile
+	device.DeviceProfileId = profile.Id
+	nx.cache.Devices = []public.ModelsDevice{device}
+	nx.cache.DeviceProfile = &profile
+	nx.configState.flags = []string{"log-level"}
+	nx.reconcileDeviceProfile(ctx, wg)
+	require.Equal(zap.InfoLevel, logLevel.Level())
+	require.Equal(&profile, nx.deviceProfile)
+}
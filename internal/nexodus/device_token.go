@@ -0,0 +1,144 @@
+package nexodus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/client"
+	"github.com/nexodus-io/nexodus/internal/wgcrypto"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// how often nexd replaces its device token
+const deviceTokenRotationInterval = 24 * time.Hour
+
+// apiClientOptions returns the options used to create the api client, including the device token if there is one.
+func (nx *Nexodus) apiClientOptions() []client.Option {
+	options := append([]client.Option{}, nx.clientOptions...)
+	if nx.deviceToken != "" {
+		options = append(options, client.WithBearerToken(nx.deviceToken))
+	}
+	return options
+}
+
+// useDeviceToken opens a device token sealed to the wireguard key of this device and
+// switches the api client over to it.
+func (nx *Nexodus) useDeviceToken(ctx context.Context, sealedToken string) error {
+	key, err := wgtypes.ParseKey(nx.wireguardPvtKey)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := wgcrypto.ParseSealed(sealedToken)
+	if err != nil {
+		return err
+	}
+
+	data, err := sealed.Open(key[:])
+	if err != nil {
+		return err
+	}
+
+	options := append([]client.Option{}, nx.clientOptions...)
+	options = append(options, client.WithBearerToken(string(data)))
+	c, err := client.NewAPIClient(ctx, nx.apiURL.String(), func(msg string) {}, options...)
+	if err != nil {
+		return err
+	}
+	nx.client = c
+	nx.deviceToken = string(data)
+	if nx.tcpRelay != nil {
+		nx.tcpRelay.setToken(nx.deviceToken)
+	}
+	return nil
+}
+
+// startInformers (re)starts watching the devices, security groups, device profiles, device actions and hole punches of
+// the vpc with the current api client.
+func (nx *Nexodus) startInformers(ctx context.Context) {
+	if nx.informerStop != nil {
+		nx.informerStop()
+	}
+	informerCtx, informerCancel := context.WithCancel(ctx)
+	nx.informerStop = informerCancel
+
+	// event stream sharing occurs due to the informers sharing the context created in following line:
+	informerCtx = nx.client.VPCApi.WatchEvents(informerCtx, nx.vpc.Id).PublicKey(nx.wireguardPubKey).NewSharedInformerContext()
+	nx.securityGroupsInformer = nx.client.VPCApi.ListSecurityGroupsInVPC(informerCtx, nx.vpc.Id).Informer()
+	nx.devicesInformer = nx.client.VPCApi.ListDevicesInVPC(informerCtx, nx.vpc.Id).Informer()
+	nx.deviceProfilesInformer = nx.client.VPCApi.ListDeviceProfilesInVPC(informerCtx, nx.vpc.Id).Informer()
+	nx.deviceActionsInformer = nx.client.VPCApi.ListDeviceActionsInVPC(informerCtx, nx.vpc.Id).Informer()
+	if nx.holePunch != nil {
+		nx.holePunch.informer = nx.client.VPCApi.ListHolePunchesInVPC(informerCtx, nx.vpc.Id).Informer()
+	}
+	nx.resumeInformers()
+}
+
+// reconcileDeviceToken replaces the device token with a new one, the apiserver revokes the current token.
+func (nx *Nexodus) reconcileDeviceToken(ctx context.Context) {
+	if nx.deviceToken == "" {
+		// not using a device token, nothing to rotate
+		return
+	}
+	err := nx.rotateDeviceToken(ctx)
+	if errors.Is(err, errUnauthorized) {
+		err = nx.reauthenticate(ctx)
+	}
+	if err != nil {
+		nx.logger.Errorf("Failed to rotate the device token, retrying in %v: %v", deviceTokenRotationInterval, err)
+	}
+}
+
+func (nx *Nexodus) rotateDeviceToken(ctx context.Context) error {
+	device, resp, err := nx.client.DevicesApi.RotateDeviceToken(ctx, nx.deviceId).Execute()
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("%w: %v", errUnauthorized, err)
+		}
+		return err
+	}
+	if device.BearerToken == "" {
+		return fmt.Errorf("the apiserver did not return the new device token")
+	}
+	if err := nx.useDeviceToken(ctx, device.BearerToken); err != nil {
+		return err
+	}
+	nx.startInformers(ctx)
+	nx.logger.Info("Rotated the device token")
+	return nil
+}
+
+// reauthenticate gets a new device token using the credentials nexd was started with, this is
+// needed once the device token has been revoked.
+func (nx *Nexodus) reauthenticate(ctx context.Context) error {
+	nx.logger.Info("The api-server no longer accepts our credentials, re-authenticating")
+	nx.deviceToken = ""
+	if err := nx.resetApiClient(ctx); err != nil {
+		return err
+	}
+	defer nx.startInformers(ctx)
+
+	device, resp, err := nx.client.DevicesApi.GetDevice(ctx, nx.deviceId).Execute()
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusForbidden {
+			nx.SetStatus(NexdStatusAuth, "The device has been revoked, it reconnects once an admin re-enables it")
+		}
+		return err
+	}
+	// the device token is not accepted while the key is older than the vpc allows, rotate it first
+	if nx.keyRotationDue(*device, time.Now()) {
+		if err := nx.rotateKeys(ctx, nx.deviceId); err != nil {
+			return err
+		}
+	}
+	if device.BearerToken != "" {
+		if err := nx.useDeviceToken(ctx, device.BearerToken); err != nil {
+			return err
+		}
+	}
+	nx.SetStatus(NexdStatusRunning, "")
+	return nil
+}
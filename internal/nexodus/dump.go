@@ -21,6 +21,8 @@ type WgSessions struct {
 	Rx                int64
 	// Only set when populating from the device cache, wgSessionsCached()
 	Healthy bool
+	// The relay the traffic to the peer goes through, only set for relayed peers
+	Relay string
 }
 
 func (nx *Nexodus) DumpPeersDefault() (map[string]WgSessions, error) {
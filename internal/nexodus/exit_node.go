@@ -44,7 +44,7 @@ func (nx *Nexodus) ExitNodeClientSetup() error {
 					PublicKey:           deviceEntry.device.PublicKey,
 					Endpoint:            localEndpoint,
 					AllowedIPs:          deviceEntry.device.AllowedIps,
-					PersistentKeepAlive: persistentKeepalive,
+					PersistentKeepAlive: nx.persistentKeepalive(),
 				}
 				exitNodeFound = true
 				break
@@ -127,15 +127,22 @@ func (nx *Nexodus) ExitNodeClientSetup() error {
 		return err
 	}
 
-	ips, err := ResolveURLToIP(nx.apiURL.String())
-	if err != nil {
-		nx.logger.Debug(err)
-		return err
-	}
+	// all the apiservers stay reachable outside the tunnel, nexd fails over between them
+	for _, apiURL := range nx.apiURLs {
+		ips, err := ResolveURLToIP(apiURL.String())
+		if err != nil {
+			if apiURL == nx.apiURL {
+				nx.logger.Debug(err)
+				return err
+			}
+			nx.logger.Warnf("failed to resolve the apiserver %s: %v", apiURL.Host, err)
+			continue
+		}
 
-	for _, ip := range ips {
-		if err := nfAddExitSrcApiServerOOBMangleRule(nx.logger, "tcp", ip.String(), oobHttps); err != nil {
-			fmt.Printf("Error adding rule for IP %s: %v\n", ip, err)
+		for _, ip := range ips {
+			if err := nfAddExitSrcApiServerOOBMangleRule(nx.logger, "tcp", ip.String(), oobHttps); err != nil {
+				fmt.Printf("Error adding rule for IP %s: %v\n", ip, err)
+			}
 		}
 	}
 
@@ -211,6 +218,10 @@ func (nx *Nexodus) exitNodeOriginSetup() error {
 		return err
 	}
 
+	if err := addExitOriginMSSClampRule(nx.logger); err != nil {
+		return err
+	}
+
 	if err := addExitOriginForwardRule(nx.logger); err != nil {
 		return err
 	}
@@ -12,6 +12,7 @@ import (
 // nft add chain inet nexodus-exit-node postrouting '{ type nat hook postrouting priority srcnat; }'
 // nft add chain inet nexodus-exit-node forward '{ type filter hook forward priority filter; }'
 // nft add rule inet nexodus-exit-node postrouting oifname "<PHYSICAL_IFACE>" counter masquerade
+// nft add rule inet nexodus-exit-node forward tcp flags \& \(syn \| rst\) == syn tcp option maxseg size set rt mtu
 // nft add rule inet nexodus-exit-node forward iifname "wg0" counter accept
 
 func addExitDestinationTable(logger *zap.SugaredLogger) error {
@@ -54,6 +55,16 @@ func addExitOriginPostroutingRule(logger *zap.SugaredLogger, phyIface string) er
 	return nil
 }
 
+// addExitOriginMSSClampRule clamps the TCP MSS of the connections forwarded through the exit node to the MTU of the
+// route they take, so that the segments of the hosts on the internet fit the MTU of the tunnel.
+func addExitOriginMSSClampRule(logger *zap.SugaredLogger) error {
+	if _, err := policyCmd(logger, append([]string{"add", "rule", "inet", nfExitNodeTable, "forward"}, mssClampRule...)); err != nil {
+		return fmt.Errorf("failed to add nftables rule nexodus-exit-node: %w", err)
+	}
+
+	return nil
+}
+
 func addExitOriginForwardRule(logger *zap.SugaredLogger) error {
 	if _, err := policyCmd(logger, []string{"add", "rule", "inet", nfExitNodeTable, "forward", "iifname", wgIface, "accept"}); err != nil {
 		return fmt.Errorf("failed to add nftables rule nexodus-exit-node: %w", err)
@@ -0,0 +1,272 @@
+package nexodus
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/stun"
+)
+
+const (
+	// how long to wait before punching another hole to a peer that is still relayed
+	holePunchRetryInterval = 10 * time.Minute
+	// a hole punch is skipped once its moment passed longer ago than this, the peer stopped punching by then
+	holePunchLateness = 5 * time.Second
+	// how many of the ports a symmetric NAT maps next are offered as candidates
+	holePunchPredictedPorts = 8
+	// the candidates of the peer are punched a few times, in case the first packets cross before the NAT of the peer opened
+	holePunchBursts        = 3
+	holePunchBurstInterval = 200 * time.Millisecond
+)
+
+// holePuncher punches holes through the NATs of this device and of peers that would otherwise be relayed. The
+// device with the lower id offers its candidate endpoints through the api-server, the peer answers with its own,
+// and after the delay picked by the api-server both send packets to the candidates of the other from the wireguard
+// port. Wireguard then peers with the most likely candidate, and roams to the one the handshake of the peer came from.
+type holePuncher struct {
+	informer *public.Informer[public.ModelsHolePunch]
+
+	mu        sync.Mutex
+	started   map[string]time.Time // when a hole punch to a peer was last started, by peer id
+	handled   map[string]bool      // the hole punches that were answered or scheduled, by id
+	endpoints map[string]string    // the endpoint punched for a peer, by peer id
+	punched   chan string          // the ids of the peers punched, for the main loop to peer with
+}
+
+func newHolePuncher() *holePuncher {
+	return &holePuncher{
+		started:   map[string]time.Time{},
+		handled:   map[string]bool{},
+		endpoints: map[string]string{},
+		punched:   make(chan string, 16),
+	}
+}
+
+// holePunchesChanged returns a channel that receives when the hole punches of the vpc change, nil when hole punching is disabled.
+func (nx *Nexodus) holePunchesChanged() <-chan struct{} {
+	if nx.holePunch == nil || nx.holePunch.informer == nil {
+		return nil
+	}
+	return nx.holePunch.informer.Changed()
+}
+
+// holePunched returns a channel that receives the ids of the peers a hole was punched to, nil when hole punching is disabled.
+func (nx *Nexodus) holePunched() <-chan string {
+	if nx.holePunch == nil {
+		return nil
+	}
+	return nx.holePunch.punched
+}
+
+// holePunchEndpoint returns the endpoint a hole was punched to for a peer, or "" if there is none.
+func (nx *Nexodus) holePunchEndpoint(peerID string) string {
+	if nx.holePunch == nil {
+		return ""
+	}
+	nx.holePunch.mu.Lock()
+	defer nx.holePunch.mu.Unlock()
+	return nx.holePunch.endpoints[peerID]
+}
+
+// forgetHolePunch drops the endpoint punched for a peer once peering through it failed.
+func (nx *Nexodus) forgetHolePunch(peerID string) {
+	if nx.holePunch == nil {
+		return
+	}
+	nx.holePunch.mu.Lock()
+	defer nx.holePunch.mu.Unlock()
+	delete(nx.holePunch.endpoints, peerID)
+}
+
+// startHolePunch offers fresh candidates to a relayed peer, unless the peer starts the hole punches of the pair or
+// a hole punch to it was started recently.
+func (nx *Nexodus) startHolePunch(peer public.ModelsDevice) {
+	// hole punches are coordinated through the apiserver, which is not connected while starting from the cached state
+	if nx.holePunch == nil || nx.devicesInformer == nil || peer.Relay || nx.deviceId >= peer.Id {
+		return
+	}
+	nx.holePunch.mu.Lock()
+	defer nx.holePunch.mu.Unlock()
+	if time.Since(nx.holePunch.started[peer.Id]) < holePunchRetryInterval {
+		return
+	}
+	nx.holePunch.started[peer.Id] = time.Now()
+
+	go func() {
+		candidates, err := nx.holePunchCandidates()
+		if err != nil {
+			nx.logger.Debugf("not punching a hole to peer %s, the candidates of this device are not known: %v", peer.PublicKey, err)
+			return
+		}
+		_, _, err = nx.client.DevicesApi.CreateHolePunch(context.Background(), nx.deviceId).HolePunch(public.ModelsAddHolePunch{
+			PeerId:     peer.Id,
+			Candidates: candidates,
+		}).Execute()
+		if err != nil {
+			nx.logger.Debugf("failed to start a hole punch to peer %s: %v", peer.PublicKey, err)
+			return
+		}
+		nx.logger.Debugf("started a hole punch to peer %s with candidates %v", peer.PublicKey, candidates)
+	}()
+}
+
+// reconcileHolePunches answers the hole punches peers started with this device, and punches the peers that answered ours.
+func (nx *Nexodus) reconcileHolePunches(ctx context.Context) {
+	if nx.holePunch == nil || nx.holePunch.informer == nil {
+		return
+	}
+	punches, _, err := nx.holePunch.informer.Execute()
+	if err != nil {
+		nx.logger.Debugf("failed to list the hole punches: %v", err)
+		return
+	}
+
+	nx.holePunch.mu.Lock()
+	defer nx.holePunch.mu.Unlock()
+	for id := range nx.holePunch.handled {
+		if _, ok := punches[id]; !ok {
+			delete(nx.holePunch.handled, id)
+		}
+	}
+	for id, p := range punches {
+		if nx.holePunch.handled[id] {
+			continue
+		}
+		if p.PeerId == nx.deviceId && p.PunchAt == "" {
+			nx.holePunch.handled[id] = true
+			go nx.answerHolePunch(ctx, p)
+		} else if p.DeviceId == nx.deviceId && p.PunchAt != "" {
+			nx.holePunch.handled[id] = true
+			go nx.punch(ctx, p.PeerId, p.PeerCandidates, punchIn(p))
+		}
+	}
+}
+
+// answerHolePunch answers a hole punch a peer started with the candidates of this device, and punches the peer.
+func (nx *Nexodus) answerHolePunch(ctx context.Context, p public.ModelsHolePunch) {
+	candidates, err := nx.holePunchCandidates()
+	if err != nil {
+		nx.logger.Debugf("not answering the hole punch of peer %s, the candidates of this device are not known: %v", p.DeviceId, err)
+		return
+	}
+	answered, _, err := nx.client.DevicesApi.AnswerHolePunch(ctx, nx.deviceId, p.Id).HolePunch(public.ModelsAnswerHolePunch{
+		Candidates: candidates,
+	}).Execute()
+	if err != nil {
+		nx.logger.Debugf("failed to answer the hole punch of peer %s: %v", p.DeviceId, err)
+		return
+	}
+	nx.punch(ctx, p.DeviceId, p.Candidates, punchIn(*answered))
+}
+
+// punchIn returns how long after it was received the devices punch the hole of a hole punch. The delay is relative
+// so that the clock of this device doesn't need to agree with the one of the api-server.
+func punchIn(p public.ModelsHolePunch) time.Duration {
+	return time.Duration(p.PunchInMs) * time.Millisecond
+}
+
+// punch sends packets from the wireguard port to the candidates of a peer once the hole punch is due, then
+// hands the peer to the main loop to peer with through the hole.
+func (nx *Nexodus) punch(ctx context.Context, peerID string, candidates []string, wait time.Duration) {
+	if wait < -holePunchLateness {
+		nx.logger.Debugf("skipping the hole punch to peer %s, its moment passed %v ago", peerID, -wait)
+		return
+	}
+	var dsts []netip.AddrPort
+	for _, candidate := range candidates {
+		if dst, err := netip.ParseAddrPort(candidate); err == nil {
+			dsts = append(dsts, dst)
+		}
+	}
+	if len(dsts) == 0 {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(wait):
+	}
+	for i := 0; i < holePunchBursts; i++ {
+		if i > 0 {
+			time.Sleep(holePunchBurstInterval)
+		}
+		if err := stun.Punch(nx.logger, dsts, nx.listenPort); err != nil {
+			nx.logger.Debugf("failed to punch a hole to peer %s: %v", peerID, err)
+			return
+		}
+	}
+
+	nx.holePunch.mu.Lock()
+	nx.holePunch.endpoints[peerID] = dsts[0].String()
+	nx.holePunch.mu.Unlock()
+	select {
+	case <-ctx.Done():
+	case nx.holePunch.punched <- peerID:
+	}
+}
+
+// peerViaHolePunch peers with a relayed peer through the hole punched to it.
+func (nx *Nexodus) peerViaHolePunch(peerID string) {
+	methodIndex := 0
+	for i, method := range wgPeerMethods {
+		if method.name == peeringMethodHolePunch {
+			methodIndex = i
+		}
+	}
+
+	nx.deviceCacheLock.Lock()
+	for key, d := range nx.deviceCache {
+		if d.device.Id != peerID {
+			continue
+		}
+		if d.peeringMethod != peeringMethodViaRelay && d.peeringMethod != peeringMethodViaTCPRelay && d.peeringMethod != peeringMethodNone {
+			// the peer was reached some other way in the meantime
+			break
+		}
+		nx.logger.Debugf("Punched a hole to peer [ %s ], peering through it", d.device.PublicKey)
+		nx.peeringReset(&d)
+		// skip ahead to peering through the hole on the next reconcile
+		d.peeringMethodIndex = methodIndex
+		nx.deviceCache[key] = d
+	}
+	nx.deviceCacheLock.Unlock()
+
+	if err := nx.reconcileDeviceCache(); err != nil {
+		nx.logger.Debugf("reconcile after punching a hole to peer %s failed: %v", peerID, err)
+	}
+}
+
+// holePunchCandidates returns the endpoints this device may be reached at by a new peer, the most likely one first.
+func (nx *Nexodus) holePunchCandidates() ([]string, error) {
+	reflexive, err := stun.Request(nx.logger, stun.NextServer(), nx.listenPort)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for _, candidate := range predictPorts(reflexive, nx.natPortDelta, holePunchPredictedPorts) {
+		candidates = append(candidates, candidate.String())
+	}
+	return candidates, nil
+}
+
+// predictPorts returns the endpoints a NAT that just mapped the reflexive address is likely to map for the next
+// destination, the most likely one first. A symmetric NAT that allocates its ports sequentially maps each new
+// destination delta ports further along, other NATs keep mapping the reflexive address.
+func predictPorts(reflexive netip.AddrPort, delta, count int) []netip.AddrPort {
+	if delta == 0 {
+		return []netip.AddrPort{reflexive}
+	}
+	var result []netip.AddrPort
+	for i := 1; i <= count; i++ {
+		port := int(reflexive.Port()) + delta*i
+		if port < 1 || port > 65535 {
+			break
+		}
+		result = append(result, netip.AddrPortFrom(reflexive.Addr(), uint16(port)))
+	}
+	return append(result, reflexive)
+}
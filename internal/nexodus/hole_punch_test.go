@@ -0,0 +1,80 @@
+package nexodus
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestPredictPorts(t *testing.T) {
+	reflexive := netip.MustParseAddrPort("203.0.113.10:40000")
+
+	// a NAT that keeps its mapping is reached at the reflexive address
+	require.Equal(t, []netip.AddrPort{reflexive}, predictPorts(reflexive, 0, 3))
+
+	// a symmetric NAT maps the next destinations further along, the reflexive address comes last
+	require.Equal(t, []netip.AddrPort{
+		netip.MustParseAddrPort("203.0.113.10:40002"),
+		netip.MustParseAddrPort("203.0.113.10:40004"),
+		netip.MustParseAddrPort("203.0.113.10:40006"),
+		reflexive,
+	}, predictPorts(reflexive, 2, 3))
+
+	// ports past the end of the range are not predicted
+	high := netip.MustParseAddrPort("203.0.113.10:65534")
+	require.Equal(t, []netip.AddrPort{netip.MustParseAddrPort("203.0.113.10:65535"), high}, predictPorts(high, 1, 3))
+	low := netip.MustParseAddrPort("203.0.113.10:2")
+	require.Equal(t, []netip.AddrPort{netip.MustParseAddrPort("203.0.113.10:1"), low}, predictPorts(low, -1, 3))
+}
+
+func TestHolePunchPeering(t *testing.T) {
+	zLogger, _ := zap.NewDevelopment()
+	nx := &Nexodus{
+		vpc: &public.ModelsVPC{
+			Ipv4Cidr: "100.64.0.0/10",
+			Ipv6Cidr: "200::/64",
+		},
+		symmetricNat:             true,
+		nodeReflexiveAddressIPv4: netip.MustParseAddrPort("1.1.1.1:1234"),
+		logger:                   zLogger.Sugar(),
+		holePunch:                newHolePuncher(),
+	}
+	d := deviceCacheEntry{
+		device: public.ModelsDevice{
+			Id:         "peer",
+			PublicKey:  "bacon",
+			AllowedIps: []string{"100.64.0.2/32"},
+			Endpoints:  []public.ModelsEndpoint{{Address: "192.168.10.50:5678", Source: "local"}, {Address: "2.2.2.2:4321", Source: "stun"}},
+		},
+	}
+	nx.peeringReset(&d)
+
+	// without a hole punched to it, a peer behind symmetric NAT is relayed
+	_, chosenMethod, _ := nx.rebuildPeerConfig(&d, true)
+	require.Equal(t, peeringMethodViaRelay, chosenMethod)
+
+	// once punched, peering skips ahead to the hole
+	nx.holePunch.endpoints["peer"] = "2.2.2.2:4323"
+	for i, method := range wgPeerMethods {
+		if method.name == peeringMethodHolePunch {
+			d.peeringMethodIndex = i
+		}
+	}
+	peer, chosenMethod, chosenIndex := nx.rebuildPeerConfig(&d, true)
+	require.Equal(t, peeringMethodHolePunch, chosenMethod)
+	require.Equal(t, "2.2.2.2:4323", peer.Endpoint)
+	require.Equal(t, []string{"100.64.0.2/32"}, peer.AllowedIPs)
+
+	// the hole never opened, so the peer goes back to the relay and a new hole is punched later
+	d.peeringMethod = chosenMethod
+	d.peeringMethodIndex = chosenIndex
+	d.peeringTime = time.Now().Add(-2 * peeringTimeout)
+	_, chosenMethod, _ = nx.rebuildPeerConfig(&d, true)
+	require.Equal(t, peeringMethodViaRelay, chosenMethod)
+	require.Empty(t, nx.holePunchEndpoint("peer"))
+}
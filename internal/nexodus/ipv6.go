@@ -0,0 +1,180 @@
+package nexodus
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/stun"
+)
+
+const (
+	// the sources of the endpoints a device can be reached at over IPv6, see ipv6Endpoints
+	endpointSourceLocalIPv6 = "local-ipv6"
+	endpointSourceStunIPv6  = "stun-ipv6:"
+)
+
+// ipv6Endpoints are the endpoints this device can be reached at over IPv6, zero when it has no IPv6 address.
+type ipv6Endpoints struct {
+	local     netip.AddrPort
+	reflexive netip.AddrPort // the local endpoint as the stun server saw it, zero when not known
+	stunSrc   string
+}
+
+// sameAs determines if the endpoints are the same, whichever stun server saw them.
+func (e ipv6Endpoints) sameAs(other ipv6Endpoints) bool {
+	return e.local == other.local && e.reflexive == other.reflexive
+}
+
+func (e ipv6Endpoints) String() string {
+	switch {
+	case e.reflexive.IsValid():
+		return e.reflexive.String()
+	case e.local.IsValid():
+		return e.local.String()
+	default:
+		return "none"
+	}
+}
+
+// ipv6EndpointDisco discovers the endpoints this device can be reached at over IPv6. The local address is the one
+// the host sends from to a stun server, so that no IPv6 address is found without an IPv6 route to the internet.
+func (nx *Nexodus) ipv6EndpointDisco() ipv6Endpoints {
+	var endpoints ipv6Endpoints
+	if !nx.ipv6Supported {
+		return endpoints
+	}
+
+	stunServer := stun.NextServer()
+	conn, err := net.Dial("udp6", stunServer)
+	if err != nil {
+		nx.logger.Debugf("no IPv6 route to stun server %s: %v", stunServer, err)
+		return endpoints
+	}
+	_ = conn.Close()
+	localAddr, ok := netip.AddrFromSlice(conn.LocalAddr().(*net.UDPAddr).IP)
+	if !ok || !localAddr.IsGlobalUnicast() {
+		return endpoints
+	}
+	endpoints.local = netip.AddrPortFrom(localAddr, uint16(nx.listenPort))
+
+	reflexive, err := stun.RequestIPv6(nx.logger, stunServer, nx.listenPort)
+	if err != nil {
+		// kernel wireguard does not share its port, a request from another port still tells whether the address is translated
+		reflexive, err = stun.RequestIPv6(nx.logger, stunServer, 0)
+		if err == nil && reflexive.Addr() != localAddr {
+			nx.logger.Debugf("the IPv6 address of this device is translated to %s, the port it maps is not known", reflexive.Addr())
+			return endpoints
+		}
+		reflexive = endpoints.local
+	}
+	if err != nil {
+		nx.logger.Debugf("IPv6 stun request to %s failed: %v", stunServer, err)
+		return endpoints
+	}
+	endpoints.reflexive = reflexive
+	endpoints.stunSrc = stunServer
+	return endpoints
+}
+
+// endpoints returns the endpoints this device advertises, with the IPv4 reflexive address given. The IPv6 endpoints
+// and the one mapped on the gateway go first, since nexd versions without them take the last endpoint that is not
+// local as the reflexive one.
+func (nx *Nexodus) endpoints(reflexiveIP4 netip.AddrPort, stunSrc string) []public.ModelsEndpoint {
+	var endpoints []public.ModelsEndpoint
+	if nx.ipv6Endpoints.local.IsValid() {
+		endpoints = append(endpoints, public.ModelsEndpoint{
+			Source:  endpointSourceLocalIPv6,
+			Address: nx.ipv6Endpoints.local.String(),
+		})
+	}
+	if nx.ipv6Endpoints.reflexive.IsValid() {
+		endpoints = append(endpoints, public.ModelsEndpoint{
+			Source:  endpointSourceStunIPv6 + nx.ipv6Endpoints.stunSrc,
+			Address: nx.ipv6Endpoints.reflexive.String(),
+		})
+	}
+	if mapped, protocol := nx.portMapper.endpoint(); mapped.IsValid() {
+		endpoints = append(endpoints, public.ModelsEndpoint{
+			Source:  endpointSourcePortMapping + protocol,
+			Address: mapped.String(),
+		})
+	}
+	return append(endpoints,
+		public.ModelsEndpoint{
+			Source:  "local",
+			Address: net.JoinHostPort(nx.endpointLocalAddress, fmt.Sprintf("%d", nx.listenPort)),
+		},
+		public.ModelsEndpoint{
+			Source:  "stun:" + stunSrc,
+			Address: reflexiveIP4.String(),
+		},
+	)
+}
+
+// extractIPv6Endpoint returns the endpoint to peer with a device at over IPv6, or "" if it advertises none that
+// could be reached from another network.
+func extractIPv6Endpoint(device public.ModelsDevice) string {
+	local := ""
+	for _, endpoint := range device.Endpoints {
+		if strings.HasPrefix(endpoint.Source, endpointSourceStunIPv6) {
+			return endpoint.Address
+		}
+		if endpoint.Source == endpointSourceLocalIPv6 {
+			addr, err := netip.ParseAddrPort(endpoint.Address)
+			if err == nil && addr.Addr().IsGlobalUnicast() && !addr.Addr().IsPrivate() {
+				local = endpoint.Address
+			}
+		}
+	}
+	return local
+}
+
+// ipv6HeadStartOver returns a channel that receives once the head start of a peer tried over IPv6 is over.
+func (nx *Nexodus) ipv6HeadStartOver() <-chan struct{} {
+	return nx.ipv6HeadStart
+}
+
+// startIPv6HeadStart has the devices reconciled once the head start of IPv6 is over, rather than on the next poll,
+// so that the IPv4 methods join the race in time.
+func (nx *Nexodus) startIPv6HeadStart() {
+	if nx.ipv6HeadStart == nil {
+		return
+	}
+	time.AfterFunc(peeringHeadStartIPv6, func() {
+		select {
+		case nx.ipv6HeadStart <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// adoptIPv6Roam records that IPv6 won the race when wireguard roamed to the IPv6 endpoint of a peer configured with
+// an IPv4 method, so that the IPv4 endpoint is not configured again on the next change to the peer.
+// assumes deviceCacheLock is held with a write-lock
+func (nx *Nexodus) adoptIPv6Roam(d *deviceCacheEntry) {
+	if !d.peerHealthy || d.peeringMethod == peeringMethodDirectIPv6 {
+		return
+	}
+	peer, ok := nx.wgConfig.Peers[d.device.PublicKey]
+	if !ok {
+		return
+	}
+	endpoint, err := netip.ParseAddrPort(d.endpoint)
+	if err != nil || !endpoint.Addr().Is6() {
+		return
+	}
+	ipv6Endpoint, err := netip.ParseAddrPort(extractIPv6Endpoint(d.device))
+	if err != nil || ipv6Endpoint != endpoint {
+		return
+	}
+	nx.logger.Debugf("Peer [ %s ] was reached over IPv6 first, it uses method [ %s ]", d.device.PublicKey, peeringMethodDirectIPv6)
+	peer.Endpoint = ipv6Endpoint.String()
+	nx.wgConfig.Peers[d.device.PublicKey] = peer
+	d.peeringMethod = peeringMethodDirectIPv6
+	d.peeringMethodIndex = pathMethodIndex(peeringMethodDirectIPv6)
+	d.pathReason = "IPv6 got through first"
+}
@@ -0,0 +1,160 @@
+package nexodus
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestExtractIPv6Endpoint(t *testing.T) {
+	testCases := []struct {
+		name      string
+		endpoints []public.ModelsEndpoint
+		expected  string
+	}{
+		{
+			name: "ipv4 only",
+			endpoints: []public.ModelsEndpoint{
+				{Source: "local", Address: "192.168.10.50:5678"},
+				{Source: "stun:stun.example.com:3478", Address: "1.1.1.1:4321"},
+			},
+			expected: "",
+		},
+		{
+			name: "reflexive preferred",
+			endpoints: []public.ModelsEndpoint{
+				{Source: endpointSourceLocalIPv6, Address: "[2001:db8::1]:5678"},
+				{Source: endpointSourceStunIPv6 + "stun.example.com:3478", Address: "[2001:db8::2]:5678"},
+				{Source: "local", Address: "192.168.10.50:5678"},
+				{Source: "stun:stun.example.com:3478", Address: "1.1.1.1:4321"},
+			},
+			expected: "[2001:db8::2]:5678",
+		},
+		{
+			name: "global local address",
+			endpoints: []public.ModelsEndpoint{
+				{Source: endpointSourceLocalIPv6, Address: "[2001:db8::1]:5678"},
+			},
+			expected: "[2001:db8::1]:5678",
+		},
+		{
+			name: "unique local address",
+			endpoints: []public.ModelsEndpoint{
+				{Source: endpointSourceLocalIPv6, Address: "[fd00::1]:5678"},
+			},
+			expected: "",
+		},
+	}
+	for _, tcIter := range testCases {
+		tc := tcIter
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, extractIPv6Endpoint(public.ModelsDevice{Endpoints: tc.endpoints}))
+		})
+	}
+}
+
+func TestRebuildPeerConfigIPv6(t *testing.T) {
+	require := require.New(t)
+	zLogger, _ := zap.NewDevelopment()
+	nx := &Nexodus{
+		vpc: &public.ModelsVPC{
+			Ipv4Cidr: "100.64.0.0/10",
+			Ipv6Cidr: "200::/64",
+		},
+		nodeReflexiveAddressIPv4: netip.MustParseAddrPort("1.1.1.1:1234"),
+		ipv6Endpoints: ipv6Endpoints{
+			local: netip.MustParseAddrPort("[2001:db8::1]:1234"),
+		},
+		logger: zLogger.Sugar(),
+	}
+	d := deviceCacheEntry{
+		device: public.ModelsDevice{
+			Endpoints: nx.endpoints(netip.MustParseAddrPort("2.2.2.2:4321"), "stun.example.com:3478"),
+			PublicKey: "bacon",
+		},
+	}
+	d.device.Endpoints[0].Address = "[2001:db8::2]:5678"
+	d.device.Endpoints[1].Address = "192.168.10.50:5678"
+	nx.peeringReset(&d)
+
+	// the endpoints the device advertises without IPv6 support still come last
+	localIP, reflexiveIP4 := nx.extractLocalAndReflexiveIP(d.device)
+	require.Equal("192.168.10.50:5678", localIP)
+	require.Equal("2.2.2.2:4321", reflexiveIP4)
+
+	peer, chosenMethod, chosenIndex := nx.rebuildPeerConfig(&d, false)
+	require.Equal(peeringMethodDirectIPv6, chosenMethod)
+	require.Equal("[2001:db8::2]:5678", peer.Endpoint)
+
+	// IPv6 only gets a head start on the IPv4 methods
+	d.peeringMethod = chosenMethod
+	d.peeringMethodIndex = chosenIndex
+	d.peeringTime = time.Now()
+	_, chosenMethod, _ = nx.rebuildPeerConfig(&d, false)
+	require.Equal(peeringMethodDirectIPv6, chosenMethod)
+
+	d.peeringTime = time.Now().Add(-peeringHeadStartIPv6 - time.Millisecond)
+	peer, chosenMethod, chosenIndex = nx.rebuildPeerConfig(&d, false)
+	require.Equal(peeringMethodReflexive, chosenMethod)
+	require.Equal("2.2.2.2:4321", peer.Endpoint)
+
+	// the IPv6 handshake completed after the head start, wireguard roamed to the IPv6 endpoint
+	nx.wgConfig.Peers = map[string]wgPeerConfig{d.device.PublicKey: peer}
+	d.peeringMethod = chosenMethod
+	d.peeringMethodIndex = chosenIndex
+	d.peeringTime = time.Now()
+	d.peerHealthy = true
+	d.endpoint = "[2001:db8::2]:5678"
+	nx.adoptIPv6Roam(&d)
+	require.Equal(peeringMethodDirectIPv6, d.peeringMethod)
+	require.Equal("[2001:db8::2]:5678", nx.wgConfig.Peers[d.device.PublicKey].Endpoint)
+	peer, chosenMethod, _ = nx.rebuildPeerConfig(&d, false)
+	require.Equal(peeringMethodDirectIPv6, chosenMethod)
+	require.False(nx.peerConfigUpdated(d.device, peer))
+
+	// without the roam, the peer stays on the IPv4 method that took over after the head start
+	d.peeringMethod = peeringMethodDirectIPv6
+	d.peeringMethodIndex = pathMethodIndex(peeringMethodDirectIPv6)
+	d.peeringTime = time.Now().Add(-peeringHeadStartIPv6 - time.Millisecond)
+	d.peerHealthy = false
+	d.endpoint = ""
+	d.pathReason = ""
+	peer, chosenMethod, chosenIndex = nx.rebuildPeerConfig(&d, false)
+	require.Equal(peeringMethodReflexive, chosenMethod)
+	nx.wgConfig.Peers[d.device.PublicKey] = peer
+	d.peeringMethod = chosenMethod
+	d.peeringMethodIndex = chosenIndex
+	d.peeringTime = time.Now()
+	d.peerHealthy = true
+	d.peerHealthyTime = time.Now()
+	d.pathLatency = map[string]time.Duration{peeringMethodReflexive: 30 * time.Millisecond}
+	_, reflexiveIP4 = nx.extractLocalAndReflexiveIP(d.device)
+	require.Equal(-1, nx.pathProbeDue(d, reflexiveIP4, false))
+
+	// IPv6 is tried again on the path probe schedule
+	d.pathProbeTime = time.Now().Add(-pathRetryInterval)
+	peer, chosenMethod, chosenIndex = nx.rebuildPeerConfig(&d, false)
+	require.Equal(peeringMethodDirectIPv6, chosenMethod)
+	require.Equal("[2001:db8::2]:5678", peer.Endpoint)
+	require.Equal(peeringMethodReflexive, d.pathFallback)
+
+	// this time it gets as long as any method to come up, a handshake completing after the head start keeps it
+	nx.wgConfig.Peers[d.device.PublicKey] = peer
+	d.peeringMethod = chosenMethod
+	d.peeringMethodIndex = chosenIndex
+	d.peeringTime = time.Now().Add(-400 * time.Millisecond)
+	_, chosenMethod, _ = nx.rebuildPeerConfig(&d, false)
+	require.Equal(peeringMethodDirectIPv6, chosenMethod)
+
+	d.peerHealthy = true
+	d.peerHealthyTime = time.Now()
+	d.pathLatency[peeringMethodDirectIPv6] = 25 * time.Millisecond
+	_, chosenMethod, _ = nx.rebuildPeerConfig(&d, false)
+	require.Equal(peeringMethodDirectIPv6, chosenMethod)
+	require.Empty(d.pathFallback)
+}
@@ -8,8 +8,55 @@ import (
 	"net/http"
 
 	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/util"
 )
 
+// join connects to the apiserver and joins the device to the vpc, each step is retried up to retries times.
+func (nx *Nexodus) join(ctx context.Context, retries int) (public.ModelsDevice, error) {
+	err := util.RetryOperation(ctx, retryInterval, retries, func() error {
+		return nx.resetApiClient(ctx)
+	})
+	if err != nil {
+		return public.ModelsDevice{}, fmt.Errorf("client api error: %w", err)
+	}
+
+	userId, vpc, err := nx.fetchUserIdAndVpc(ctx, retries)
+	if err != nil {
+		return public.ModelsDevice{}, err
+	}
+	nx.vpc = vpc
+
+	endpoints := nx.endpoints(nx.nodeReflexiveAddressIPv4, nx.reflexiveAddrStunSrc)
+	var modelsDevice public.ModelsDevice
+	var deviceOperationLogMsg string
+	err = util.RetryOperation(ctx, retryInterval, retries, func() error {
+		modelsDevice, deviceOperationLogMsg, err = nx.createOrUpdateDeviceOperation(userId, endpoints)
+		if err != nil {
+			nx.logger.Warnf("device join error - retrying: %v", err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return public.ModelsDevice{}, fmt.Errorf("join error %w", err)
+	}
+	nx.deviceId = modelsDevice.Id
+	nx.portMapper.markAdvertised(endpoints)
+	nx.logger.Debug(fmt.Sprintf("Device: %+v", modelsDevice))
+	nx.logger.Infof("%s with UUID: [ %+v ] into vpc: [ %s (%s) ]",
+		deviceOperationLogMsg, modelsDevice.Id, nx.vpc.Id, nx.vpc.Description)
+
+	// Use the device token to auth with the apiserver...
+	if modelsDevice.BearerToken != "" {
+		if err := nx.useDeviceToken(ctx, modelsDevice.BearerToken); err != nil {
+			return public.ModelsDevice{}, err
+		}
+	}
+
+	nx.startInformers(ctx)
+	return modelsDevice, nil
+}
+
 func (nx *Nexodus) createOrUpdateDeviceOperation(userID string, endpoints []public.ModelsEndpoint) (public.ModelsDevice, string, error) {
 	newDev := public.ModelsAddDevice{
 		VpcId:           nx.vpc.Id,
@@ -17,6 +64,7 @@ func (nx *Nexodus) createOrUpdateDeviceOperation(userID string, endpoints []publ
 		PublicKey:       nx.wireguardPubKey,
 		AdvertiseCidrs:  nx.advertiseCidrs,
 		SymmetricNat:    nx.symmetricNat,
+		Nat:             nx.natBehaviorModel(),
 		Hostname:        nx.hostname,
 		Relay:           nx.relay,
 		Os:              nx.os,
@@ -38,11 +86,16 @@ func (nx *Nexodus) createOrUpdateDeviceOperation(userID string, endpoints []publ
 		if errors.As(err, &apiError) {
 			switch model := apiError.Model().(type) {
 			case public.ModelsConflictsError:
+				// rotate the key before reconnecting if the apiserver would otherwise reject it
+				if err := nx.rotateKeysIfDue(context.Background(), model.Id); err != nil {
+					return public.ModelsDevice{}, "", fmt.Errorf("error rotating device key: %w", err)
+				}
 				var resp *http.Response
 				d, resp, err = nx.client.DevicesApi.UpdateDevice(context.Background(), model.Id).Update(public.ModelsUpdateDevice{
 					VpcId:          nx.vpc.Id,
 					AdvertiseCidrs: nx.advertiseCidrs,
 					SymmetricNat:   nx.symmetricNat,
+					Nat:            nx.natBehaviorModel(),
 					Hostname:       nx.hostname,
 					Endpoints:      endpoints,
 				}).Execute()
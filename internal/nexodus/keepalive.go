@@ -36,10 +36,12 @@ func (nx *Nexodus) runProbe(peerStatus api.KeepaliveStatus, c chan struct {
 			IsReachable bool
 		}{
 			KeepaliveStatus: api.KeepaliveStatus{
-				WgIP:     peerStatus.WgIP,
-				Hostname: peerStatus.Hostname,
-				Latency:  "-",
-				Method:   peerStatus.Method,
+				WgIP:        peerStatus.WgIP,
+				Hostname:    peerStatus.Hostname,
+				Latency:     "-",
+				Method:      peerStatus.Method,
+				RelayReason: peerStatus.RelayReason,
+				PathReason:  peerStatus.PathReason,
 			},
 			IsReachable: false,
 		}
@@ -49,10 +51,12 @@ func (nx *Nexodus) runProbe(peerStatus api.KeepaliveStatus, c chan struct {
 			IsReachable bool
 		}{
 			KeepaliveStatus: api.KeepaliveStatus{
-				WgIP:     peerStatus.WgIP,
-				Hostname: peerStatus.Hostname,
-				Latency:  latency,
-				Method:   peerStatus.Method,
+				WgIP:        peerStatus.WgIP,
+				Hostname:    peerStatus.Hostname,
+				Latency:     latency,
+				Method:      peerStatus.Method,
+				RelayReason: peerStatus.RelayReason,
+				PathReason:  peerStatus.PathReason,
 			},
 			IsReachable: true,
 		}
@@ -78,10 +82,15 @@ func cksum(bs []byte) uint16 {
 }
 
 func (nx *Nexodus) doPing(host string, i uint64, waitFor time.Duration) (string, error) {
+	return nx.doPingSize(host, i, waitFor, PACKETSIZE-8)
+}
+
+// doPingSize pings the host with size bytes of data in the echo request, see pmtuSearch.
+func (nx *Nexodus) doPingSize(host string, i uint64, waitFor time.Duration, size int) (string, error) {
 	if nx.userspaceMode {
-		return nx.pingUS(host, i, waitFor)
+		return nx.pingUS(host, i, waitFor, size)
 	} else {
-		return nx.pingOS(host, i, waitFor)
+		return nx.pingOS(host, i, waitFor, size)
 	}
 }
 
@@ -90,7 +99,7 @@ const (
 	protocolIPv6ICMP = 58
 )
 
-func (nx *Nexodus) pingUS(host string, i uint64, waitFor time.Duration) (string, error) {
+func (nx *Nexodus) pingUS(host string, i uint64, waitFor time.Duration, size int) (string, error) {
 	var networkType string
 	var icmpType icmp.Type
 	var icmpProto int
@@ -108,9 +117,13 @@ func (nx *Nexodus) pingUS(host string, i uint64, waitFor time.Duration) (string,
 	if err != nil {
 		return "", err
 	}
+	data := []byte("pingity ping")
+	if size > len(data) {
+		data = append(data, make([]byte, size-len(data))...)
+	}
 	requestPing := icmp.Echo{
 		Seq:  int(i),
-		Data: []byte("pingity ping"),
+		Data: data,
 	}
 	icmpBytes, _ := (&icmp.Message{Type: icmpType, Code: 0, Body: &requestPing}).Marshal(nil)
 	err = socket.SetReadDeadline(time.Now().Add(waitFor))
@@ -145,7 +158,7 @@ func (nx *Nexodus) pingUS(host string, i uint64, waitFor time.Duration) (string,
 	return fmt.Sprintf("%.2fms", roundedLatency), nil
 }
 
-func (nx *Nexodus) pingOS(host string, i uint64, waitFor time.Duration) (string, error) {
+func (nx *Nexodus) pingOS(host string, i uint64, waitFor time.Duration, size int) (string, error) {
 	var v6Host bool
 	var netname string
 
@@ -166,7 +179,7 @@ func (nx *Nexodus) pingOS(host string, i uint64, waitFor time.Duration) (string,
 		nx.logger.Debugf("probe error: %v", err)
 	}
 
-	msg := make([]byte, PACKETSIZE)
+	msg := make([]byte, 8+size)
 	if v6Host {
 		msg[0] = ICMP6_TYPE_ECHO_REQUEST
 	} else {
@@ -183,7 +196,7 @@ func (nx *Nexodus) pingOS(host string, i uint64, waitFor time.Duration) (string,
 	if err = c.SetDeadline(time.Now().Add(waitFor)); err != nil {
 		nx.logger.Debugf("probe error: %v", err)
 	}
-	rmsg := make([]byte, PACKETSIZE+256)
+	rmsg := make([]byte, len(msg)+256)
 	start := time.Now()
 	amt, err := c.Read(rmsg[:])
 	if err != nil {
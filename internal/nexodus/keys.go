@@ -1,10 +1,32 @@
 package nexodus
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
+const (
+	// how often the key age is checked against the vpc max key age
+	keyRotationCheckInterval = 10 * time.Minute
+	// how long peers may keep using the previous key after a rotation
+	keyRotationOverlap = 5 * time.Minute
+)
+
+// keySwitch is a key rotation whose overlap has not passed yet. The wireguard interface keeps the previous private key
+// until then, which is also when the peers stop using the previous public key, so the tunnels stay up through the
+// rotation.
+type keySwitch struct {
+	previousPrivateKey string
+	at                 time.Time
+}
+
 // handleKeys will look for an existing key pair, if a pair is not found this method
 // will generate a new pair and store them in the nexd persistent state
 func (nx *Nexodus) handleKeys() error {
@@ -35,5 +57,186 @@ func (nx *Nexodus) handleKeys() error {
 
 	nx.wireguardPubKey = state.PublicKey
 	nx.wireguardPvtKey = state.PrivateKey
+	if state.PreviousPrivateKey != "" && state.KeySwitchAt != nil && time.Now().Before(*state.KeySwitchAt) {
+		nx.keySwitch = &keySwitch{previousPrivateKey: state.PreviousPrivateKey, at: *state.KeySwitchAt}
+	}
+	return nil
+}
+
+// interfacePrivateKey returns the private key of the wireguard interface, the previous one until a key switch is due.
+func (nx *Nexodus) interfacePrivateKey() string {
+	if nx.keySwitch != nil {
+		return nx.keySwitch.previousPrivateKey
+	}
+	return nx.wireguardPvtKey
+}
+
+// keyRotationDue returns true if the device key should be rotated. Keys are rotated once
+// they reach three quarters of the vpc max key age so that there is time to retry before
+// the apiserver starts rejecting them.
+func (nx *Nexodus) keyRotationDue(device public.ModelsDevice, now time.Time) bool {
+	if device.PublicKey != nx.wireguardPubKey {
+		// the apiserver knows this device by a newer key than the one we have stored, the only
+		// way to recover is to rotate again.
+		return true
+	}
+	if nx.vpc == nil || nx.vpc.MaxKeyAgeSeconds <= 0 || device.PublicKeyCreatedAt == "" {
+		return false
+	}
+	createdAt, err := time.Parse(time.RFC3339, device.PublicKeyCreatedAt)
+	if err != nil {
+		nx.logger.Debugf("failed to parse the key creation time %q: %v", device.PublicKeyCreatedAt, err)
+		return false
+	}
+	maxAge := time.Duration(nx.vpc.MaxKeyAgeSeconds) * time.Second
+	return now.Sub(createdAt) >= maxAge-maxAge/4
+}
+
+// rotateKeysIfDue fetches the device and rotates its key if the key is too old.
+func (nx *Nexodus) rotateKeysIfDue(ctx context.Context, deviceID string) error {
+	device, _, err := nx.client.DevicesApi.GetDevice(ctx, deviceID).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+	if !nx.keyRotationDue(*device, time.Now()) {
+		return nil
+	}
+	return nx.rotateKeys(ctx, deviceID)
+}
+
+// rotateKeys generates a new key pair and registers the new public key with the apiserver. The
+// wireguard interface switches over to the new private key once the overlap the apiserver keeps
+// accepting the previous key for has passed, when the peers swap the key in place, see
+// reconcileKeySwitch.
+func (nx *Nexodus) rotateKeys(ctx context.Context, deviceID string) error {
+	if nx.keySwitch != nil {
+		return fmt.Errorf("the previous key rotation is in progress until %s", nx.keySwitch.at.Format(time.RFC3339))
+	}
+	wgKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate private key: %w", err)
+	}
+	publicKey := wgKey.PublicKey().String()
+	privateKey := wgKey.String()
+
+	device, _, err := nx.client.DevicesApi.UpdateDevice(ctx, deviceID).Update(public.ModelsUpdateDevice{
+		PublicKey:         publicKey,
+		KeyOverlapSeconds: int32(keyRotationOverlap / time.Second),
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to register the new public key: %w", err)
+	}
+
+	switchAt := time.Now().Add(keyRotationOverlap)
+	if device.PreviousPublicKeyExpiresAt != "" {
+		if expiresAt, err := time.Parse(time.RFC3339, device.PreviousPublicKeyExpiresAt); err == nil {
+			switchAt = expiresAt
+		}
+	}
+
+	nx.deviceCacheLock.Lock()
+	nx.keySwitch = &keySwitch{previousPrivateKey: nx.wireguardPvtKey, at: switchAt}
+	nx.wireguardPubKey = publicKey
+	nx.wireguardPvtKey = privateKey
+	nx.deviceCacheRekey(*device)
+	nx.deviceCacheLock.Unlock()
+
+	// the apiserver now only knows the new key, so keep going even if it can't be persisted.
+	state := nx.stateStore.State()
+	state.PublicKey = publicKey
+	state.PrivateKey = privateKey
+	state.PreviousPrivateKey = nx.keySwitch.previousPrivateKey
+	state.KeySwitchAt = &switchAt
+	if err := nx.stateStore.Store(); err != nil {
+		nx.logger.Errorf("failed to store the rotated keys: %v", err)
+	}
+
+	nx.logger.Infof("Rotated the wireguard key of this device, the new public key is [ %s ], the interface switches to it at %s", publicKey, switchAt.Format(time.RFC3339))
 	return nil
 }
+
+// reconcileKeySwitch switches the wireguard interface over to the rotated key once the overlap has
+// passed. The peers keep using the previous public key until the same time, see peerKeyInOverlap.
+func (nx *Nexodus) reconcileKeySwitch(now time.Time) {
+	if nx.keySwitch == nil || now.Before(nx.keySwitch.at) {
+		return
+	}
+	nx.deviceCacheLock.Lock()
+	nx.keySwitch = nil
+	nx.wgConfig.Interface.PrivateKey = nx.wireguardPvtKey
+	nx.deviceCacheLock.Unlock()
+
+	state := nx.stateStore.State()
+	state.PreviousPrivateKey = ""
+	state.KeySwitchAt = nil
+	if err := nx.stateStore.Store(); err != nil {
+		nx.logger.Errorf("failed to store the rotated keys: %v", err)
+	}
+	if err := nx.setPrivateKey(); err != nil {
+		nx.logger.Errorf("Failed to switch the wireguard interface to the rotated key: %v", err)
+		return
+	}
+	nx.logger.Infof("Switched the wireguard interface to the rotated key [ %s ]", nx.wireguardPubKey)
+}
+
+// peerKeyInOverlap returns a peer that rotated its key as it is peered with until the overlap has
+// passed: by its previous public key, which its wireguard interface keeps using until then.
+func (nx *Nexodus) peerKeyInOverlap(p public.ModelsDevice, now time.Time) public.ModelsDevice {
+	if p.PreviousPublicKey == "" || p.PreviousPublicKeyExpiresAt == "" || p.PublicKey == nx.wireguardPubKey {
+		return p
+	}
+	expiresAt, err := time.Parse(time.RFC3339, p.PreviousPublicKeyExpiresAt)
+	if err != nil || !now.Before(expiresAt) {
+		return p
+	}
+	p.PublicKey = p.PreviousPublicKey
+	return p
+}
+
+// setPrivateKey configures the current private key on the wireguard interface if it has already been set up.
+func (nx *Nexodus) setPrivateKey() error {
+	if nx.userspaceMode {
+		return nx.setPrivateKeyUS()
+	}
+	return nx.setPrivateKeyOS()
+}
+
+func (nx *Nexodus) setPrivateKeyUS() error {
+	if nx.userspaceDev == nil {
+		return nil
+	}
+	pvtDecoded, err := base64.StdEncoding.DecodeString(nx.interfacePrivateKey())
+	if err != nil {
+		return err
+	}
+	return nx.userspaceDev.IpcSet(fmt.Sprintf("private_key=%s", hex.EncodeToString(pvtDecoded)))
+}
+
+func (nx *Nexodus) setPrivateKeyOS() error {
+	if !ifaceExists(nx.logger, nx.tunnelIface) {
+		return nil
+	}
+	privateKey, err := wgtypes.ParseKey(nx.interfacePrivateKey())
+	if err != nil {
+		return err
+	}
+	c, err := wgctrl.New()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.ConfigureDevice(nx.tunnelIface, wgtypes.Config{
+		PrivateKey: &privateKey,
+	})
+}
+
+// reconcileKeyRotation rotates the device key when it is due under the vpc max key age, which refreshVPC keeps current.
+func (nx *Nexodus) reconcileKeyRotation(ctx context.Context) {
+	local, ok := nx.deviceCacheLookup(nx.wireguardPubKey)
+	if !ok || nx.keySwitch != nil || !nx.keyRotationDue(local.device, time.Now()) {
+		return
+	}
+	if err := nx.rotateKeys(ctx, nx.deviceId); err != nil {
+		nx.logger.Errorf("Failed to rotate the wireguard key, retrying in %v: %v", keyRotationCheckInterval, err)
+	}
+}
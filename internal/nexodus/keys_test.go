@@ -0,0 +1,114 @@
+package nexodus
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/state/fstore"
+)
+
+func TestKeyRotationDue(t *testing.T) {
+	zLogger, _ := zap.NewDevelopment()
+	now := time.Date(2023, 12, 13, 12, 0, 0, 0, time.UTC)
+	nx := &Nexodus{
+		logger:          zLogger.Sugar(),
+		wireguardPubKey: "key1",
+		vpc:             &public.ModelsVPC{MaxKeyAgeSeconds: 4 * 24 * 60 * 60},
+	}
+
+	testCases := []struct {
+		name      string
+		publicKey string
+		createdAt string
+		expected  bool
+	}{
+		{"new key", "key1", now.Add(-time.Hour).Format(time.RFC3339), false},
+		{"key before three quarters of max age", "key1", now.Add(-71 * time.Hour).Format(time.RFC3339), false},
+		{"key past three quarters of max age", "key1", now.Add(-72 * time.Hour).Format(time.RFC3339Nano), true},
+		{"unknown key age", "key1", "", false},
+		{"apiserver has a different key", "key2", now.Format(time.RFC3339), true},
+	}
+	for _, tc := range testCases {
+		device := public.ModelsDevice{PublicKey: tc.publicKey, PublicKeyCreatedAt: tc.createdAt}
+		require.Equal(t, tc.expected, nx.keyRotationDue(device, now), tc.name)
+	}
+
+	// without a max key age keys are only rotated on demand
+	nx.vpc.MaxKeyAgeSeconds = 0
+	device := public.ModelsDevice{PublicKey: "key1", PublicKeyCreatedAt: now.Add(-1000 * time.Hour).Format(time.RFC3339)}
+	require.False(t, nx.keyRotationDue(device, now))
+}
+
+func TestDeviceCacheRekey(t *testing.T) {
+	zLogger, _ := zap.NewDevelopment()
+	nx := &Nexodus{
+		logger:      zLogger.Sugar(),
+		deviceCache: map[string]deviceCacheEntry{},
+	}
+	nx.addToDeviceCache(public.ModelsDevice{Id: "peer1", PublicKey: "key1", AllowedIps: []string{"100.64.0.2/32"}})
+	entry := nx.deviceCache["key1"]
+	entry.peeringMethod = peeringMethodReflexive
+	entry.peeringMethodIndex = 5
+	entry.peerHealthy = true
+	nx.deviceCache["key1"] = entry
+
+	// an unrelated device is not moved
+	require.False(t, nx.deviceCacheRekey(public.ModelsDevice{Id: "peer2", PublicKey: "key3", PreviousPublicKey: "key1"}))
+	// a device that did not rotate its key is not moved
+	require.False(t, nx.deviceCacheRekey(public.ModelsDevice{Id: "peer1", PublicKey: "key1"}))
+
+	rotated := public.ModelsDevice{Id: "peer1", PublicKey: "key2", PreviousPublicKey: "key1", PublicKeyCreatedAt: "2023-12-13T12:00:00Z", AllowedIps: []string{"100.64.0.2/32"}}
+	require.True(t, nx.deviceCacheRekey(rotated))
+	require.NotContains(t, nx.deviceCache, "key1")
+	require.Contains(t, nx.deviceCache, "key2")
+
+	// peering state is kept, only the key changes
+	moved := nx.deviceCache["key2"]
+	require.Equal(t, "key2", moved.device.PublicKey)
+	require.Equal(t, "2023-12-13T12:00:00Z", moved.device.PublicKeyCreatedAt)
+	require.Equal(t, []string{"100.64.0.2/32"}, moved.device.AllowedIps)
+	require.Equal(t, peeringMethodReflexive, moved.peeringMethod)
+	require.Equal(t, 5, moved.peeringMethodIndex)
+	require.True(t, moved.peerHealthy)
+	require.False(t, deviceUpdated(moved.device, rotated))
+
+	// the same rotation seen again is a no-op
+	require.False(t, nx.deviceCacheRekey(rotated))
+}
+
+func TestKeySwitch(t *testing.T) {
+	require := require.New(t)
+	zLogger, _ := zap.NewDevelopment()
+	now := time.Date(2023, 12, 13, 12, 0, 0, 0, time.UTC)
+	store := fstore.New(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(store.Load())
+	nx := &Nexodus{
+		logger:          zLogger.Sugar(),
+		stateStore:      store,
+		userspaceWG:     userspaceWG{userspaceMode: true},
+		wireguardPubKey: "key2",
+		wireguardPvtKey: "private2",
+		keySwitch:       &keySwitch{previousPrivateKey: "private1", at: now.Add(time.Minute)},
+	}
+
+	// the interface keeps the previous key until the overlap has passed
+	require.Equal("private1", nx.interfacePrivateKey())
+	nx.reconcileKeySwitch(now)
+	require.Equal("private1", nx.interfacePrivateKey())
+	nx.reconcileKeySwitch(now.Add(time.Minute))
+	require.Nil(nx.keySwitch)
+	require.Equal("private2", nx.interfacePrivateKey())
+
+	// peers are peered with by their previous key until the overlap has passed
+	rotated := public.ModelsDevice{Id: "peer1", PublicKey: "key4", PreviousPublicKey: "key3", PreviousPublicKeyExpiresAt: now.Add(time.Minute).Format(time.RFC3339)}
+	require.Equal("key3", nx.peerKeyInOverlap(rotated, now).PublicKey)
+	require.Equal("key4", nx.peerKeyInOverlap(rotated, now.Add(time.Minute)).PublicKey)
+	// this device is known by its new key right away
+	self := public.ModelsDevice{Id: "device1", PublicKey: "key2", PreviousPublicKey: "key1", PreviousPublicKeyExpiresAt: now.Add(time.Minute).Format(time.RFC3339)}
+	require.Equal("key2", nx.peerKeyInOverlap(self, now).PublicKey)
+}
@@ -0,0 +1,160 @@
+package nexodus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/util"
+)
+
+const (
+	// the MTU of the tunnel interface when the VPC does not set one, 1500 minus the IPv6, UDP and wireguard headers
+	defaultMTU = 1420
+	// the MTU of the tunnel interface is not lowered below this, IPv6 needs at least 1280
+	minMTU = 1280
+	// how often the MTU applied to the tunnel interface is reconciled with the path MTU discovered to the peers
+	mtuReconcileInterval = time.Minute
+	// how often the peers are probed for whether packets of the size of the MTU get through to them
+	pmtuProbeInterval = 10 * time.Minute
+	// how long a path MTU below the one configured is kept before packets of the full size are tried again
+	pmtuRetryInterval = time.Hour
+	// the IPv4 and ICMP headers of a probe
+	pmtuProbeOverhead = 28
+	// the largest gap between the path MTU found and the actual one, the search stops below it
+	pmtuProbeGranularity = 8
+)
+
+// configuredMTU returns the MTU the VPC sets for the tunnel interface, or the default.
+func (nx *Nexodus) configuredMTU() int {
+	if nx.vpc != nil && nx.vpc.Mtu != 0 {
+		return int(nx.vpc.Mtu)
+	}
+	return defaultMTU
+}
+
+// interfaceMTU returns the MTU a new tunnel interface is set up with, the one applied before when the interface is
+// set up again, so that the path MTU discovered is not lost until reconcileMTU runs.
+func (nx *Nexodus) interfaceMTU() int {
+	if nx.mtu != 0 {
+		return nx.mtu
+	}
+	return nx.configuredMTU()
+}
+
+// applyMTU sets the MTU of the tunnel interface. Netstack can not change its MTU once created, in userspace mode the
+// packet filter holds the packets through the tunnel to the MTU instead.
+func (nx *Nexodus) applyMTU(mtu int) error {
+	if nx.userspaceMode {
+		if nx.userspaceFilter != nil {
+			nx.userspaceFilter.setMTU(mtu)
+		}
+	} else if err := nx.setMTUOS(mtu); err != nil {
+		return err
+	}
+	nx.mtu = mtu
+	return nil
+}
+
+// reconcileMTU applies the lowest path MTU discovered to the peers to the tunnel interface, and probes whether packets
+// of the size of the MTU get through to the peers whose path MTU is not known to be lower. The path MTU of a peer is
+// found by searching for the largest ping through the tunnel that gets an answer, and is forgotten after
+// pmtuRetryInterval so that the full MTU is used again once the path allows.
+func (nx *Nexodus) reconcileMTU(ctx context.Context, wg *sync.WaitGroup) {
+	if nx.mtu == 0 {
+		// the tunnel interface is not set up yet
+		return
+	}
+
+	configured := nx.configuredMTU()
+	target := configured
+	type pmtuTarget struct {
+		address string
+		method  string
+	}
+	targets := map[string]pmtuTarget{}
+	now := time.Now()
+	nx.deviceCacheLock.Lock()
+	for publicKey, d := range nx.deviceCache {
+		if d.pathMTU != 0 && now.Sub(d.pathMTUTime) >= pmtuRetryInterval {
+			d.pathMTU = 0
+			nx.deviceCache[publicKey] = d
+		}
+		if d.pathMTU != 0 && d.pathMTU < target {
+			target = d.pathMTU
+		}
+		if d.pathMTU == 0 && d.peerHealthy && d.device.PublicKey != nx.wireguardPubKey && len(d.device.Ipv4TunnelIps) > 0 {
+			targets[publicKey] = pmtuTarget{address: d.device.Ipv4TunnelIps[0].Address, method: d.peeringMethod}
+		}
+	}
+	nx.deviceCacheLock.Unlock()
+
+	if target != nx.mtu {
+		if err := nx.applyMTU(target); err != nil {
+			nx.logger.Warnf("failed to set the MTU of the tunnel interface to %d: %v", target, err)
+		} else {
+			nx.logger.Infof("set the MTU of the tunnel interface to %d", target)
+		}
+	}
+
+	if len(targets) == 0 || now.Sub(nx.mtuProbeTime) < pmtuProbeInterval || !nx.mtuProbe.begin() {
+		return
+	}
+	nx.mtuProbeTime = now
+	// the peers are probed at the MTU that applies to all of them, probes above it would not leave this device whole
+	mtu := nx.mtu
+	util.GoWithWaitGroup(wg, func() {
+		defer nx.mtuProbe.end()
+		for publicKey, target := range targets {
+			if ctx.Err() != nil {
+				return
+			}
+			pathMTU := nx.pmtuSearch(target.address, mtu)
+			if pathMTU == 0 || pathMTU >= mtu {
+				continue
+			}
+			nx.logger.Infof("packets larger than %d bytes do not get through to peer %s", pathMTU, publicKey)
+			nx.deviceCacheLock.Lock()
+			d, ok := nx.deviceCache[publicKey]
+			if ok && d.peeringMethod == target.method {
+				d.pathMTU = pathMTU
+				d.pathMTUTime = time.Now()
+				nx.deviceCache[publicKey] = d
+			}
+			nx.deviceCacheLock.Unlock()
+		}
+	})
+}
+
+// pmtuSearch returns the largest packet up to mtu that gets through to the address, or 0 if not even the smallest
+// packets get through, the peer is then down rather than the path MTU low.
+func (nx *Nexodus) pmtuSearch(address string, mtu int) int {
+	if nx.pmtuProbe(address, mtu) {
+		return mtu
+	}
+	if !nx.pmtuProbe(address, minMTU) {
+		return 0
+	}
+	low, high := minMTU, mtu
+	for high-low > pmtuProbeGranularity {
+		size := (low + high) / 2
+		if nx.pmtuProbe(address, size) {
+			low = size
+		} else {
+			high = size
+		}
+	}
+	return low
+}
+
+// pmtuProbe determines if a packet of the given size gets through to the address, it is tried twice so that a single
+// lost packet does not lower the MTU.
+func (nx *Nexodus) pmtuProbe(address string, size int) bool {
+	waitFor := time.Duration(timeWait) * time.Millisecond
+	for i := uint64(1); i <= 2; i++ {
+		if _, err := nx.doPingSize(address, i, waitFor, size-pmtuProbeOverhead); err == nil {
+			return true
+		}
+	}
+	return false
+}
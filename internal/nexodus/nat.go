@@ -0,0 +1,82 @@
+package nexodus
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/stun"
+)
+
+// how many stun servers are asked for a NAT behavior discovery before settling for what symmetricNatDisco found
+const natBehaviorDiscoAttempts = 3
+
+// natBehaviorDisco classifies the NAT in front of this device as described in RFC 5780. That takes a stun server
+// with an alternate address among the configured ones, without one only the mapping behavior is known, from
+// comparing the reflexive addresses two stun servers saw.
+func (nx *Nexodus) natBehaviorDisco() {
+	for i := 0; i < natBehaviorDiscoAttempts; i++ {
+		stunServer := stun.NextServer()
+		behavior, err := stun.DiscoverBehavior(nx.logger, stunServer)
+		if errors.Is(err, stun.ErrBehaviorDiscoveryUnsupported) {
+			nx.logger.Debugf("stun server %s does not support NAT behavior discovery", stunServer)
+			continue
+		}
+		if err != nil {
+			nx.logger.Debugf("NAT behavior discovery with stun server %s failed: %v", stunServer, err)
+			continue
+		}
+		nx.nat = &behavior
+		if behavior.Mapping != stun.EndpointIndependent && !nx.symmetricNat {
+			nx.symmetricNat = true
+			nx.logger.Infof("NAT with %s mapping detected. A relay node is required to reach other devices outside of this local network. See https://docs.nexodus.io/user-guide/relay-nodes/", behavior.Mapping)
+		}
+		nx.logger.Infof("NAT behavior: mapping %s, filtering %s, hairpinning %v", behavior.Mapping, behavior.Filtering, behavior.Hairpinning)
+		return
+	}
+
+	mapping := stun.EndpointIndependent
+	if nx.symmetricNat {
+		mapping = stun.AddressAndPortDependent
+	}
+	nx.nat = &stun.NatBehavior{Mapping: mapping}
+}
+
+// natBehaviorModel returns the NAT behavior of this device as reported on its device record, empty when not discovered.
+func (nx *Nexodus) natBehaviorModel() public.ModelsNatBehavior {
+	if nx.nat == nil {
+		return public.ModelsNatBehavior{}
+	}
+	return public.ModelsNatBehavior{
+		Mapping:     string(nx.nat.Mapping),
+		Filtering:   string(nx.nat.Filtering),
+		Hairpinning: nx.nat.Hairpinning,
+	}
+}
+
+// relayReason explains why traffic to a peer goes through a relay, from what is known about the NATs of both sides.
+func (nx *Nexodus) relayReason(device public.ModelsDevice) string {
+	switch {
+	case nx.relayOnly:
+		return "this device only peers through the relay"
+	case nx.symmetricNat:
+		return "this device is behind " + natDescription(nx.natBehaviorModel())
+	case device.SymmetricNat:
+		return "the peer is behind " + natDescription(device.Nat)
+	case nx.nat != nil && nx.nat.Filtering == stun.AddressAndPortDependent && device.Nat.Filtering == string(stun.AddressAndPortDependent):
+		return "the NATs of both devices filter by address and port, and direct peering did not get through them"
+	default:
+		return "direct peering did not get through, a firewall may block UDP between the devices"
+	}
+}
+
+// natDescription describes the NAT of a device that is flagged as behind symmetric NAT, by how it was classified.
+func natDescription(nat public.ModelsNatBehavior) string {
+	if nat.Mapping == "" {
+		return "a NAT whose behavior is unknown"
+	}
+	if nat.Filtering == "" {
+		return fmt.Sprintf("a NAT with %s mapping", nat.Mapping)
+	}
+	return fmt.Sprintf("a NAT with %s mapping and %s filtering", nat.Mapping, nat.Filtering)
+}
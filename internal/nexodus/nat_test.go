@@ -0,0 +1,68 @@
+package nexodus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/stun"
+)
+
+func TestRelayReason(t *testing.T) {
+	portRestricted := public.ModelsNatBehavior{
+		Mapping:   string(stun.EndpointIndependent),
+		Filtering: string(stun.AddressAndPortDependent),
+	}
+	testCases := []struct {
+		name     string
+		nx       *Nexodus
+		peer     public.ModelsDevice
+		expected string
+	}{
+		{
+			name:     "relay only",
+			nx:       &Nexodus{relayOnly: true, symmetricNat: true},
+			expected: "this device only peers through the relay",
+		},
+		{
+			name: "this device behind symmetric NAT",
+			nx: &Nexodus{symmetricNat: true, nat: &stun.NatBehavior{
+				Mapping:   stun.AddressAndPortDependent,
+				Filtering: stun.AddressAndPortDependent,
+			}},
+			expected: "this device is behind a NAT with address-and-port-dependent mapping and address-and-port-dependent filtering",
+		},
+		{
+			name:     "peer behind symmetric NAT that was not classified",
+			nx:       &Nexodus{},
+			peer:     public.ModelsDevice{SymmetricNat: true},
+			expected: "the peer is behind a NAT whose behavior is unknown",
+		},
+		{
+			name:     "peer flagged as symmetric NAT with an endpoint-independent mapping",
+			nx:       &Nexodus{},
+			peer:     public.ModelsDevice{SymmetricNat: true, Nat: portRestricted},
+			expected: "the peer is behind a NAT with endpoint-independent mapping and address-and-port-dependent filtering",
+		},
+		{
+			name: "both port restricted",
+			nx: &Nexodus{nat: &stun.NatBehavior{
+				Mapping:   stun.EndpointIndependent,
+				Filtering: stun.AddressAndPortDependent,
+			}},
+			peer:     public.ModelsDevice{Nat: portRestricted},
+			expected: "the NATs of both devices filter by address and port, and direct peering did not get through them",
+		},
+		{
+			name:     "no NAT in the way",
+			nx:       &Nexodus{},
+			expected: "direct peering did not get through, a firewall may block UDP between the devices",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.nx.relayReason(tc.peer))
+		})
+	}
+}
@@ -20,8 +20,6 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/nexodus-io/nexodus/internal/wgcrypto"
-	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
 	"github.com/nexodus-io/nexodus/internal/state"
 	"golang.org/x/oauth2"
@@ -32,6 +30,7 @@ import (
 	"github.com/nexodus-io/nexodus/internal/stun"
 	"github.com/nexodus-io/nexodus/internal/util"
 	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
 	"golang.org/x/term"
 	"golang.zx2c4.com/wireguard/device"
 	"golang.zx2c4.com/wireguard/tun"
@@ -63,19 +62,24 @@ const (
 	retryInterval = 15 * time.Second
 	// max retries for api server retries
 	maxRetries = 3
+	// how often the vpc settings applied by a running nexd are refreshed
+	vpcRefreshInterval = 10 * time.Minute
 )
 
 var (
 	invalidTokenGrant = errors.New("invalid_grant")
 	invalidToken      = errors.New("invalid_token")
+	errUnauthorized   = errors.New("unauthorized")
 )
 
 // embedded in Nexodus struct
 type userspaceWG struct {
 	userspaceMode bool
 	userspaceTun  tun.Device
-	userspaceNet  *netstack.Net
-	userspaceDev  *device.Device
+	// userspaceFilter enforces the security group in userspace mode
+	userspaceFilter *usPacketFilter
+	userspaceNet    *netstack.Net
+	userspaceDev    *device.Device
 	// the last address configured on the userspace wireguard interface
 	userspaceLastAddress string
 	proxyLock            sync.RWMutex
@@ -117,6 +121,22 @@ type deviceCacheEntry struct {
 	peeringMethodIndex int
 	// The last time a new peering configuration was generated for this device
 	peeringTime time.Time
+	// for relay devices, the latency measured to them, 0 until measured
+	relayLatency time.Duration
+	// for relayed peers, the id of the relay the traffic to them goes through
+	relayID string
+	// the round-trip time measured to the peer through each peering method, by method name
+	pathLatency map[string]time.Duration
+	// the peering method the peer goes back to when the method being probed does not come up or is slower, see pathProbeDue
+	pathFallback string
+	// when the peering methods preferred over the relay were last tried
+	pathProbeTime time.Time
+	// why the current peering method was chosen
+	pathReason string
+	// the largest packet that gets through the tunnel to the peer when below the MTU of the interface, 0 when not known
+	pathMTU int
+	// when pathMTU was discovered
+	pathMTUTime time.Time
 }
 
 type exitNode struct {
@@ -128,23 +148,30 @@ type exitNode struct {
 
 type Options struct {
 	AdvertiseCidrs          []string
-	ApiURL                  *url.URL
+	ApiURLs                 []*url.URL
+	Config                  *Config
+	ConfigFile              string
+	ConfigFlags             []string
 	Context                 context.Context
 	ExitNodeClientEnabled   bool
 	ExitNodeOriginEnabled   bool
+	HolePunch               bool
 	InsecureSkipTlsVerify   bool
+	Keepalive               int
 	ListenPort              int
 	LogLevel                *zap.AtomicLevel
 	Logger                  *zap.SugaredLogger
 	NetworkRouter           bool
 	NetworkRouterDisableNAT bool
 	Password                string
+	PortMapping             bool
 	RegKey                  string
 	Relay                   bool
 	RelayOnly               bool
 	RequestedIP             string
 	StateDir                string
 	StateStore              state.Store
+	TCPRelay                bool
 	UserProvidedLocalIP     string
 	Username                string
 	UserspaceMode           bool
@@ -155,6 +182,7 @@ type Options struct {
 type Nexodus struct {
 	advertiseCidrs          []string
 	apiURL                  *url.URL
+	apiURLs                 []*url.URL
 	insecureSkipTlsVerify   bool
 	listenPort              int
 	logLevel                *zap.AtomicLevel
@@ -176,36 +204,75 @@ type Nexodus struct {
 	userspaceWG
 	TunnelIP                 string
 	TunnelIpV6               string
+	activePeerAddrs          map[netip.Addr]bool // addresses traffic was exchanged with within the peer idle timeout, nil if not known
+	cache                    *state.Cache        // what was last learned from the apiserver, see storeCache
+	cacheChanged             bool
 	client                   *client.APIClient
 	clientOptions            []client.Option
+	configState              configState // the configuration file, reloaded when it changes, and the device profile
 	deviceCache              map[string]deviceCacheEntry
 	deviceCacheLock          sync.RWMutex
+	deviceActionsHandled     map[string]bool // the device actions already run, so each runs once
+	deviceActionsInformer    *public.Informer[public.ModelsDeviceAction]
+	deviceId                 string
+	deviceProfile            *public.ModelsDeviceProfile // the device profile last applied, nil without one
+	deviceProfilesInformer   *public.Informer[public.ModelsDeviceProfile]
+	deviceToken              string
 	deviceReconciled         bool
 	devicesInformer          *public.Informer[public.ModelsDevice]
 	endpointLocalAddress     string
 	exitNode                 exitNode
+	holePunch                *holePuncher // punches holes through NATs to peers that would be relayed, nil when disabled
 	hostname                 string
 	informerStop             context.CancelFunc
+	ipv6Endpoints            ipv6Endpoints // where this device can be reached over IPv6, zero without an IPv6 address
+	ipv6HeadStart            chan struct{} // receives once the head start of a peer tried over IPv6 is over
 	ipv6Supported            bool
+	keepalive                int // the persistent keepalive interval of the tunnels in seconds, 0 when turned off
+	mtu                      int // the MTU applied to the tunnel interface, 0 until it is set up
+	mtuProbe                 probeRound
+	mtuProbeTime             time.Time
 	needSecGroupReconcile    bool
 	netRouterInterfaceMap    map[string]*net.Interface
 	nexCtx                   context.Context
+	nat                      *stun.NatBehavior // how the NAT in front of this device behaves, nil until discovered
+	natPortDelta             int               // how many ports further a symmetric NAT maps each new destination, 0 when not known
 	nexWg                    *sync.WaitGroup
 	nodeReflexiveAddressIPv4 netip.AddrPort
+	onDemandSecurityGroups   map[string]onDemandSecurityGroup // only kept while on-demand peering is enabled
 	os                       string
+	pathProbe                probeRound
+	peerActivityTimeout      time.Duration // the idle timeout peer activity is tracked with, 0 when it is not tracked
+	portMapper               *portMapper   // keeps the wireguard port mapped on the gateway, nil when disabled
+	presharedKeys            map[string][]presharedKey
+	presharedKeysFetched     time.Time
 	reflexiveAddrStunSrc     string
+	rekeyRequests            chan chan error
+	primaryRelayID           string // the relay that routes the whole vpc, see primaryRelay
+	relayLoadBytes           int64  // for relays, the bytes received when the load was last measured
+	relayLoadReported        int32  // for relays, the load last reported to the api-server
+	relayLoadTime            time.Time
+	relayLatenciesReported   map[string]int32 // the latency to each relay last reported to the api-server, by relay id
+	relayMode                bool             // started as a relay, the relay role of the device profile does not change it
+	relayForwarding          bool             // the forwarding rules of a relay are set up
+	relayForwardingSysctls   []string         // the ip forwarding settings turned on for the relay role of the device profile
+	relayOnly                bool
+	relayProbe               probeRound
 	relayWgIP                string
 	securityGroup            *public.ModelsSecurityGroup
 	securityGroupsInformer   *public.Informer[public.ModelsSecurityGroup]
 	status                   int // See the NexdStatus* constants
 	statusMsg                string
 	symmetricNat             bool
+	tcpRelay                 *tcpRelayClient // tunnels wireguard packets over the api-server when UDP is blocked, nil when disabled
 	tunnelIface              string
+	udpWorkingAt             time.Time // when a stun request from the wireguard port last succeeded
 	vpc                      *public.ModelsVPC
 	wgConfig                 wgConfig
 	wireguardPubKey          string
 	wireguardPubKeyInConfig  bool
 	wireguardPvtKey          string
+	keySwitch                *keySwitch // a key rotation the wireguard interface has not switched to yet, nil without one
 }
 
 type wgConfig struct {
@@ -215,6 +282,7 @@ type wgConfig struct {
 
 type wgPeerConfig struct {
 	PublicKey           string
+	PresharedKey        string
 	Endpoint            string
 	AllowedIPs          []string
 	PersistentKeepAlive string
@@ -242,10 +310,14 @@ func New(o Options) (*Nexodus, error) {
 		userProvidedLocalIP:     o.UserProvidedLocalIP,
 		advertiseCidrs:          o.AdvertiseCidrs,
 		relay:                   o.Relay,
+		relayMode:               o.Relay,
+		keepalive:               o.Keepalive,
 		networkRouter:           o.NetworkRouter,
 		networkRouterDisableNAT: o.NetworkRouterDisableNAT,
-		apiURL:                  o.ApiURL,
+		apiURL:                  o.ApiURLs[0],
+		apiURLs:                 o.ApiURLs,
 		symmetricNat:            o.RelayOnly,
+		relayOnly:               o.RelayOnly,
 		logger:                  o.Logger,
 		logLevel:                o.LogLevel,
 		version:                 o.Version,
@@ -258,9 +330,11 @@ func New(o Options) (*Nexodus, error) {
 		vpcId:                   o.VpcId,
 		securityGroupId:         o.SecurityGroupId,
 
-		hostname:    hostname,
-		deviceCache: make(map[string]deviceCacheEntry),
-		status:      NexdStatusStarting,
+		hostname:      hostname,
+		deviceCache:   make(map[string]deviceCacheEntry),
+		rekeyRequests: make(chan chan error),
+		ipv6HeadStart: make(chan struct{}, 1),
+		status:        NexdStatusStarting,
 		userspaceWG: userspaceWG{
 			proxies: map[ProxyKey]*UsProxy{},
 		},
@@ -270,11 +344,30 @@ func New(o Options) (*Nexodus, error) {
 		},
 	}
 
+	config := o.Config
+	if config == nil {
+		config = &Config{}
+	}
+	// the device profile is applied over the settings of the file even when nexd was started without one
+	nx.configState = configState{file: o.ConfigFile, flags: o.ConfigFlags, started: config, config: config, applied: config}
+
 	err = nx.setListenPort(o.ListenPort)
 	if err != nil {
 		return nil, err
 	}
 
+	// relay nodes need UDP to carry the traffic of other devices, they don't fall back to the tcp relay
+	if o.TCPRelay && !o.Relay {
+		nx.tcpRelay = newTCPRelayClient(o.Logger, o.ApiURLs, o.InsecureSkipTlsVerify, nx.listenPort)
+	}
+	if o.HolePunch && !o.Relay && !o.RelayOnly {
+		nx.holePunch = newHolePuncher()
+	}
+	// relay nodes need a public address to begin with
+	if o.PortMapping && !o.Relay && !o.RelayOnly {
+		nx.portMapper = &portMapper{}
+	}
+
 	nx.userspaceMode = o.UserspaceMode
 
 	if !nx.userspaceMode {
@@ -295,6 +388,8 @@ func New(o Options) (*Nexodus, error) {
 
 	if err := nx.symmetricNatDisco(o.Context); err != nil {
 		nx.logger.Warn(err)
+	} else if !nx.relayOnly {
+		nx.natBehaviorDisco()
 	}
 
 	err = nx.migrateLegacyState(o.StateDir)
@@ -440,10 +535,9 @@ func (nx *Nexodus) Start(ctx context.Context, wg *sync.WaitGroup) error {
 		return fmt.Errorf("CtlServerStart(): %w", err)
 	}
 
-	if runtime.GOOS != Linux.String() && runtime.GOOS != Darwin.String() {
-		nx.logger.Info("Security Groups are currently only supported on Linux and macOS")
-	} else if nx.userspaceMode {
-		nx.logger.Info("Security Groups are not supported in userspace proxy mode")
+	if runtime.GOOS != Linux.String() && runtime.GOOS != Darwin.String() && !nx.userspaceMode {
+		// nexd enforces the security groups itself in userspace proxy mode
+		nx.logger.Info("Security Groups are currently only supported on Linux and macOS, or in userspace proxy mode")
 	}
 
 	options := []client.Option{
@@ -477,29 +571,23 @@ func (nx *Nexodus) Start(ctx context.Context, wg *sync.WaitGroup) error {
 			InsecureSkipVerify: true,
 		}))
 	}
-	nx.clientOptions = options
-
-	var err error
-	err = util.RetryOperation(ctx, retryInterval, maxRetries, func() error {
-		return nx.resetApiClient(ctx)
-	})
-	if err != nil {
-		return fmt.Errorf("client api error: %w", err)
+	if len(nx.apiURLs) > 1 {
+		var failoverURLs []string
+		for _, apiURL := range nx.apiURLs[1:] {
+			failoverURLs = append(failoverURLs, apiURL.String())
+		}
+		options = append(options, client.WithFailoverURLs(failoverURLs...))
 	}
-
-	nx.SetStatus(NexdStatusRunning, "")
+	nx.clientOptions = options
 
 	if err := nx.handleKeys(); err != nil {
 		return fmt.Errorf("handleKeys: %w", err)
 	}
-	userId, vpc, err := nx.fetchUserIdAndVpc(ctx)
-	if err != nil {
-		return err
-	}
-
-	nx.vpc = vpc
+	// the state saved the last time nexd was connected, it brings up the peers when the apiserver is unreachable
+	nx.cache = nx.loadCache()
 
 	// User requested ip --request-ip takes precedent
+	var err error
 	if nx.userProvidedLocalIP != "" {
 		nx.endpointLocalAddress = nx.userProvidedLocalIP
 	} else {
@@ -525,89 +613,25 @@ func (nx *Nexodus) Start(ctx context.Context, wg *sync.WaitGroup) error {
 		}
 	}
 
-	endpointSocket := net.JoinHostPort(nx.endpointLocalAddress, fmt.Sprintf("%d", nx.listenPort))
-	endpoints := []public.ModelsEndpoint{
-		{
-			Source:  "local",
-			Address: endpointSocket,
-		},
-		{
-			Source:  "stun:" + nx.reflexiveAddrStunSrc,
-			Address: nx.nodeReflexiveAddressIPv4.String(),
-		},
-	}
+	nx.ipv6Endpoints = nx.ipv6EndpointDisco()
+	nx.reconcilePortMapping(ctx)
 
-	var modelsDevice public.ModelsDevice
-	var deviceOperationLogMsg string
-	err = util.RetryOperation(ctx, retryInterval, maxRetries, func() error {
-		modelsDevice, deviceOperationLogMsg, err = nx.createOrUpdateDeviceOperation(userId, endpoints)
-		if err != nil {
-			nx.logger.Warnf("device join error - retrying: %v", err)
-			return err
-		}
-		return nil
-	})
-	if err != nil {
-		return fmt.Errorf("join error %w", err)
+	// with a cached state to start from, the apiserver is not waited for, see rejoin
+	retries := maxRetries
+	if nx.cache != nil {
+		retries = 0
 	}
-	nx.logger.Debug(fmt.Sprintf("Device: %+v", modelsDevice))
-	nx.logger.Infof("%s with UUID: [ %+v ] into vpc: [ %s (%s) ]",
-		deviceOperationLogMsg, modelsDevice.Id, nx.vpc.Id, nx.vpc.Description)
-
-	// Use the device token to auth with the apiserver...
-	if modelsDevice.BearerToken != "" {
-
-		key, err := wgtypes.ParseKey(nx.wireguardPvtKey)
-		if err != nil {
-			return err
-		}
-
-		sealed, err := wgcrypto.ParseSealed(modelsDevice.BearerToken)
-		if err != nil {
-			return err
-		}
-
-		data, err := sealed.Open(key[:])
-		if err != nil {
-			return err
-		}
-
-		//nx.stateStore.State().DeviceToken = string(data)
-		//err = nx.stateStore.Store()
-		//if err != nil {
-		//	return err
-		//}
-
-		options = append(options, client.WithBearerToken(string(data)))
-		nx.client, err = client.NewAPIClient(ctx, nx.apiURL.String(), func(msg string) {}, options...)
-		if err != nil {
-			return err
-		}
-	}
-
-	informerCtx, informerCancel := context.WithCancel(ctx)
-	nx.informerStop = informerCancel
-
-	// event stream sharing occurs due to the informers sharing the context created in following line:
-	informerCtx = nx.client.VPCApi.WatchEvents(informerCtx, nx.vpc.Id).PublicKey(nx.wireguardPubKey).NewSharedInformerContext()
-	nx.securityGroupsInformer = nx.client.VPCApi.ListSecurityGroupsInVPC(informerCtx, nx.vpc.Id).Informer()
-	nx.devicesInformer = nx.client.VPCApi.ListDevicesInVPC(informerCtx, nx.vpc.Id).Informer()
-
-	if nx.relay {
-		peerMap, _, err := nx.devicesInformer.Execute()
-		if err != nil {
-			return err
-		}
-
-		existingRelay, err := nx.orgRelayCheck(peerMap)
-		if err != nil {
+	modelsDevice, err := nx.join(ctx, retries)
+	offline := false
+	if err != nil {
+		if nx.cache == nil || ctx.Err() != nil {
 			return err
 		}
-		if existingRelay != "" {
-			return fmt.Errorf("the organization already contains a relay node, device %s needs to be deleted before adding a new relay", existingRelay)
-		}
+		nx.logger.Warnf("Failed to join the vpc, starting from the cached state: %v", err)
+		offline = true
+	} else {
+		nx.SetStatus(NexdStatusRunning, "")
 	}
-
 	// a relay node requires ip forwarding and nftable rules, OS type has already been checked
 	if nx.relay {
 		if err := nx.enableForwardingIP(); err != nil {
@@ -616,12 +640,18 @@ func (nx *Nexodus) Start(ctx context.Context, wg *sync.WaitGroup) error {
 		if err := nfRelayTablesSetup(wgIface); err != nil {
 			return err
 		}
+		nx.relayForwarding = true
 	}
 
 	util.GoWithWaitGroup(wg, func() {
-		// kick it off with an immediate reconcile
-		nx.reconcileDevices(ctx, options)
-		nx.reconcileSecurityGroups(ctx)
+		// kick it off with an immediate reconcile, from the cached state while the apiserver is unreachable
+		if offline {
+			nx.startFromCache(ctx, nx.cache)
+		} else {
+			nx.reconcileDevices(ctx)
+			nx.reconcileSecurityGroups(ctx)
+			nx.reconcileHolePunches(ctx)
+		}
 		for _, proxy := range nx.proxies {
 			proxy.Start(ctx, wg, nx.userspaceNet)
 		}
@@ -630,32 +660,99 @@ func (nx *Nexodus) Start(ctx context.Context, wg *sync.WaitGroup) error {
 				nx.logger.Errorf("failed to enable this device as an exit-node client: %v", err)
 			}
 		}
+		// after the settings nexd was started with, the ones it overrides are applied as changes to them
+		nx.reconcileDeviceProfile(ctx, wg)
+		if offline {
+			// the informers report the changes since the cached state once they catch up
+			var ok bool
+			if modelsDevice, ok = nx.rejoin(ctx); !ok {
+				return
+			}
+		}
+		if nx.tcpRelay != nil {
+			deviceID := nx.deviceId
+			util.GoWithWaitGroup(wg, func() {
+				nx.tcpRelay.run(ctx, deviceID)
+			})
+		}
 		stunTicker := time.NewTicker(time.Second * 20)
 		secGroupTicker := time.NewTicker(time.Second * 20)
+		vpcTicker := time.NewTicker(vpcRefreshInterval)
+		defer vpcTicker.Stop()
+		keyRotationTicker := time.NewTicker(keyRotationCheckInterval)
+		defer keyRotationTicker.Stop()
+		deviceTokenRotationTicker := time.NewTicker(deviceTokenRotationInterval)
+		defer deviceTokenRotationTicker.Stop()
 		defer stunTicker.Stop()
 		pollTicker := time.NewTicker(pollInterval)
 		defer pollTicker.Stop()
+		relayTicker := time.NewTicker(relayProbeInterval)
+		defer relayTicker.Stop()
+		pathTicker := time.NewTicker(pathProbeInterval)
+		defer pathTicker.Stop()
+		cacheTicker := time.NewTicker(cacheStoreInterval)
+		defer cacheTicker.Stop()
+		mtuTicker := time.NewTicker(mtuReconcileInterval)
+		defer mtuTicker.Stop()
+		configTicker := time.NewTicker(configReloadInterval)
+		defer configTicker.Stop()
+		telemetryTicker := time.NewTicker(telemetryInterval)
+		defer telemetryTicker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-stunTicker.C:
+				nx.reconcilePortMapping(ctx)
 				if err := nx.reconcileStun(modelsDevice.Id); err != nil {
 					if nx.os != Windows.String() { // windows does not currently support reuse port or bpf
 						nx.logger.Debug(err)
 					}
 				}
 			case <-nx.devicesInformer.Changed():
-				nx.reconcileDevices(ctx, options)
+				nx.reconcileDevices(ctx)
+				// the device profile assigned to this device may have changed
+				nx.reconcileDeviceProfile(ctx, wg)
+			case <-nx.deviceProfilesChanged():
+				nx.reconcileDeviceProfile(ctx, wg)
+			case <-nx.deviceActionsChanged():
+				nx.reconcileDeviceActions(ctx)
 			case <-nx.securityGroupsInformer.Changed():
 				nx.reconcileSecurityGroups(ctx)
+			case <-nx.holePunchesChanged():
+				nx.reconcileHolePunches(ctx)
+			case peerID := <-nx.holePunched():
+				nx.peerViaHolePunch(peerID)
+			case <-nx.ipv6HeadStartOver():
+				nx.reconcileDevices(ctx)
 			case <-pollTicker.C:
 				// This does not actually poll the API for changes. Peer configuration changes will only
 				// be processed when they come in on the informer. This periodic check is needed to
 				// re-establish our connection to the API if it is lost.
-				nx.reconcileDevices(ctx, options)
+				nx.reconcileKeySwitch(time.Now())
+				nx.reconcileDevices(ctx)
 			case <-secGroupTicker.C:
 				nx.reconcileSecurityGroups(ctx)
+			case <-relayTicker.C:
+				nx.reconcileRelays(ctx, wg)
+			case <-pathTicker.C:
+				nx.reconcilePaths(ctx, wg)
+			case <-mtuTicker.C:
+				nx.reconcileMTU(ctx, wg)
+			case <-cacheTicker.C:
+				nx.storeCache()
+			case <-configTicker.C:
+				nx.reloadConfig(ctx, wg)
+			case <-telemetryTicker.C:
+				nx.reportTelemetry(ctx)
+			case <-vpcTicker.C:
+				nx.refreshVPC(ctx)
+			case <-keyRotationTicker.C:
+				nx.reconcileKeyRotation(ctx)
+			case <-deviceTokenRotationTicker.C:
+				nx.reconcileDeviceToken(ctx)
+			case result := <-nx.rekeyRequests:
+				result <- nx.rotateKeys(ctx, nx.deviceId)
 			}
 			if nx.needSecGroupReconcile {
 				// device reconcile noticed that the security group Id changed
@@ -675,13 +772,13 @@ type NexodusClaims struct {
 	DeviceID       uuid.UUID `json:"device,omitempty"`
 }
 
-func (nx *Nexodus) fetchUserIdAndVpc(ctx context.Context) (string, *public.ModelsVPC, error) {
+func (nx *Nexodus) fetchUserIdAndVpc(ctx context.Context, retries int) (string, *public.ModelsVPC, error) {
 	if nx.regKey != "" {
 		// the userid and orgid are part of the registration token.
 		return nx.fetchRegistrationTokenUserIdAndVPC(ctx)
 	} else {
 		// Use the API to figure out the user's id and org
-		return nx.fetchUserIdAndVpcFromAPI(ctx)
+		return nx.fetchUserIdAndVpcFromAPI(ctx, retries)
 	}
 }
 
@@ -703,12 +800,18 @@ func (nx *Nexodus) fetchRegistrationTokenUserIdAndVPC(ctx context.Context) (stri
 	return regKeyModel.OwnerId, vpc, nil
 }
 
-func (nx *Nexodus) fetchUserIdAndVpcFromAPI(ctx context.Context) (string, *public.ModelsVPC, error) {
+func (nx *Nexodus) fetchUserIdAndVpcFromAPI(ctx context.Context, retries int) (string, *public.ModelsVPC, error) {
 
 	var err error
 	var user *public.ModelsUser
 	var resp *http.Response
-	err = util.RetryOperationExpBackoff(ctx, retryInterval, func() error {
+	retry := func(operation func() error) error {
+		if retries == 0 {
+			return operation()
+		}
+		return util.RetryOperationExpBackoff(ctx, retryInterval, operation)
+	}
+	err = retry(func() error {
 		user, resp, err = nx.client.UsersApi.GetUser(ctx, "me").Execute()
 		if err != nil {
 			if strings.Contains(err.Error(), invalidTokenGrant.Error()) || strings.Contains(err.Error(), invalidToken.Error()) ||
@@ -736,7 +839,7 @@ func (nx *Nexodus) fetchUserIdAndVpcFromAPI(ctx context.Context) (string, *publi
 	}
 
 	var vpc *public.ModelsVPC
-	err = util.RetryOperation(ctx, retryInterval, maxRetries, func() error {
+	err = util.RetryOperation(ctx, retryInterval, retries, func() error {
 		if nx.vpcId == "" {
 			nx.vpcId = user.Id
 		}
@@ -762,12 +865,37 @@ func (nx *Nexodus) fetchUserIdAndVpcFromAPI(ctx context.Context) (string, *publi
 	return user.Id, vpc, nil
 }
 
+// refreshVPC fetches the vpc settings a running nexd applies: the key and peering policies, and the MTU. They take
+// effect the next time they are reconciled, reconcileMTU applies a new MTU to the tunnel interface.
+func (nx *Nexodus) refreshVPC(ctx context.Context) {
+	vpc, _, err := nx.client.VPCApi.GetVPC(ctx, nx.vpc.Id).Execute()
+	if err != nil {
+		nx.logger.Debugf("failed to refresh the vpc settings: %v", err)
+		return
+	}
+	if vpc.Mtu != nx.vpc.Mtu {
+		nx.logger.Infof("The VPC MTU changed from %d to %d", nx.vpc.Mtu, vpc.Mtu)
+	}
+	nx.vpc.MaxKeyAgeSeconds = vpc.MaxKeyAgeSeconds
+	nx.vpc.PresharedKeys = vpc.PresharedKeys
+	nx.vpc.OnDemandPeering = vpc.OnDemandPeering
+	nx.vpc.PeerIdleTimeoutSeconds = vpc.PeerIdleTimeoutSeconds
+	nx.vpc.Topology = vpc.Topology
+	nx.vpc.Mtu = vpc.Mtu
+}
+
 func (nx *Nexodus) Stop() {
 	nx.logger.Info("Stopping nexd")
 	for _, proxy := range nx.proxies {
 		proxy.Stop()
 	}
 
+	if err := nx.stopPeerActivityTracking(); err != nil {
+		nx.logger.Errorf("failed to remove the peer activity tracking %v", err)
+	}
+
+	nx.stopPortMapping()
+
 	if nx.exitNode.exitNodeClientEnabled {
 		nx.logger.Debugf("Stopping Exit Node Client")
 		if err := nx.exitNodeClientTeardown(); err != nil {
@@ -785,7 +913,7 @@ func (nx *Nexodus) Stop() {
 
 // reconcileSecurityGroups will check the security group and update it if necessary.
 func (nx *Nexodus) reconcileSecurityGroups(ctx context.Context) {
-	if runtime.GOOS != Linux.String() && runtime.GOOS != Darwin.String() || nx.userspaceMode {
+	if runtime.GOOS != Linux.String() && runtime.GOOS != Darwin.String() && !nx.userspaceMode {
 		return
 	}
 
@@ -803,19 +931,19 @@ func (nx *Nexodus) reconcileSecurityGroups(ctx context.Context) {
 		}
 		// drop local security group configuration
 		nx.securityGroup = nil
-		if err := nx.processSecurityGroupRules(); err != nil {
+		if err := nx.applySecurityGroupRules(); err != nil {
 			nx.logger.Error(err)
 		}
 		return
 	}
 
 	// if the security group ID is not nil, lookup the ID and check for any changes
-	securityGroups, httpResp, err := nx.securityGroupsInformer.Execute()
+	securityGroups, httpResp, err := nx.listSecurityGroups()
 	if err != nil {
 		// if the group ID returns a 404, clear the current rules
 		if httpResp != nil && httpResp.StatusCode == http.StatusNotFound {
 			nx.securityGroup = nil
-			if err := nx.processSecurityGroupRules(); err != nil {
+			if err := nx.applySecurityGroupRules(); err != nil {
 				nx.logger.Error(err)
 			}
 			return
@@ -827,13 +955,15 @@ func (nx *Nexodus) reconcileSecurityGroups(ctx context.Context) {
 	responseSecGroup, found := securityGroups[existing.device.SecurityGroupId]
 	if !found {
 		nx.securityGroup = nil
-		if err := nx.processSecurityGroupRules(); err != nil {
+		if err := nx.applySecurityGroupRules(); err != nil {
 			nx.logger.Error(err)
 		}
 		nx.logger.Errorf("Error retrieving the security group")
 		return
 	}
 
+	responseSecGroup = applySecurityGroupGrants(responseSecGroup)
+
 	if nx.securityGroup != nil && reflect.DeepEqual(responseSecGroup, *nx.securityGroup) {
 		// no changes to previously applied security group
 		return
@@ -851,12 +981,46 @@ func (nx *Nexodus) reconcileSecurityGroups(ctx context.Context) {
 	}
 
 	// apply the new security group rules
-	if err := nx.processSecurityGroupRules(); err != nil {
+	if err := nx.applySecurityGroupRules(); err != nil {
 		nx.logger.Error(err)
 	}
 }
 
-func (nx *Nexodus) reconcileDevices(ctx context.Context, options []client.Option) {
+// applySecurityGroupRules applies the security group to the userspace packet filter in userspace mode,
+// otherwise to the firewall of the OS.
+func (nx *Nexodus) applySecurityGroupRules() error {
+	if nx.userspaceMode {
+		return nx.processSecurityGroupRulesUS()
+	}
+	return nx.processSecurityGroupRules()
+}
+
+// applySecurityGroupGrants adds the rules of the active grants to the inbound and outbound rules of the group.
+// A direction without any rules permits all traffic, so grants are only added to directions that already have rules.
+func applySecurityGroupGrants(sg public.ModelsSecurityGroup) public.ModelsSecurityGroup {
+	if len(sg.Grants) == 0 {
+		return sg
+	}
+	inboundRules := slices.Clone(sg.InboundRules)
+	outboundRules := slices.Clone(sg.OutboundRules)
+	for _, grant := range sg.Grants {
+		switch grant.Direction {
+		case "inbound":
+			if len(sg.InboundRules) != 0 {
+				inboundRules = append(inboundRules, grant.Rule)
+			}
+		case "outbound":
+			if len(sg.OutboundRules) != 0 {
+				outboundRules = append(outboundRules, grant.Rule)
+			}
+		}
+	}
+	sg.InboundRules = inboundRules
+	sg.OutboundRules = outboundRules
+	return sg
+}
+
+func (nx *Nexodus) reconcileDevices(ctx context.Context) {
 	var err error
 	if err = nx.reconcileDeviceCache(); err == nil {
 		if !nx.deviceReconciled {
@@ -876,6 +1040,14 @@ func (nx *Nexodus) reconcileDevices(ctx context.Context, options []client.Option
 	nx.logger.Errorf("Failed to reconcile state with the nexodus API server: %v", err)
 	nx.deviceReconciled = false
 
+	// the device token is no longer accepted, likely revoked, get a new one with the credentials nexd was started with
+	if errors.Is(err, errUnauthorized) {
+		if err := nx.reauthenticate(ctx); err != nil {
+			nx.logger.Errorf("Failed to re-authenticate with the api-server, retrying in %v: %v", pollInterval, err)
+		}
+		return
+	}
+
 	// if the token grant becomes invalid expires refresh or exit depending on the onboard method
 	if !strings.Contains(err.Error(), invalidTokenGrant.Error()) {
 		return
@@ -897,56 +1069,61 @@ func (nx *Nexodus) reconcileDevices(ctx context.Context, options []client.Option
 	// refresh the token grant by reconnecting to the API server
 	c, err := client.NewAPIClient(ctx, nx.apiURL.String(), func(msg string) {
 		nx.SetStatus(NexdStatusAuth, msg)
-	}, options...)
+	}, nx.apiClientOptions()...)
 	if err != nil {
 		nx.logger.Errorf("Failed to reconnect to the api-server, retrying in %v seconds: %v", pollInterval, err)
 		return
 	}
 
 	nx.client = c
-	informerCtx, informerCancel := context.WithCancel(ctx)
-	nx.informerStop = informerCancel
-
-	informerCtx = nx.client.VPCApi.WatchEvents(informerCtx, nx.vpc.Id).NewSharedInformerContext()
-	nx.securityGroupsInformer = nx.client.VPCApi.ListSecurityGroupsInVPC(informerCtx, nx.vpc.Id).Informer()
-	nx.devicesInformer = nx.client.VPCApi.ListDevicesInVPC(informerCtx, nx.vpc.Id).Informer()
+	nx.startInformers(ctx)
 
 	nx.SetStatus(NexdStatusRunning, "")
 	nx.logger.Infoln("Nexodus agent has re-established a connection to the api-server")
 }
 
 func (nx *Nexodus) reconcileStun(deviceID string) error {
-	if nx.symmetricNat {
-		return nil
-	}
-
-	nx.logger.Debug("sending stun request")
-	stunServer1 := stun.NextServer()
-	reflexiveIP, err := stun.Request(nx.logger, stunServer1, nx.listenPort)
-	if err != nil {
-		return fmt.Errorf("stun request error: %w", err)
+	// the IPv6 endpoints are discovered even behind symmetric NAT, they may reach peers the IPv4 ones do not
+	ipv6Endpoints := nx.ipv6EndpointDisco()
+	ipv6Changed := !ipv6Endpoints.sameAs(nx.ipv6Endpoints)
+	portMappingChanged := nx.portMapper.changed()
+
+	reflexiveIP, stunServer1 := nx.nodeReflexiveAddressIPv4, nx.reflexiveAddrStunSrc
+	if !nx.symmetricNat {
+		nx.logger.Debug("sending stun request")
+		stunServer1 = stun.NextServer()
+		var err error
+		reflexiveIP, err = stun.Request(nx.logger, stunServer1, nx.listenPort)
+		if err != nil {
+			return fmt.Errorf("stun request error: %w", err)
+		}
+		nx.udpWorkingAt = time.Now()
 	}
 
-	if nx.nodeReflexiveAddressIPv4 != reflexiveIP {
-		nx.logger.Infof("detected a NAT binding changed for this device %s from %s to %s, updating peers", deviceID, nx.nodeReflexiveAddressIPv4, reflexiveIP)
+	if nx.nodeReflexiveAddressIPv4 != reflexiveIP || ipv6Changed || portMappingChanged {
+		if nx.nodeReflexiveAddressIPv4 != reflexiveIP {
+			nx.logger.Infof("detected a NAT binding changed for this device %s from %s to %s, updating peers", deviceID, nx.nodeReflexiveAddressIPv4, reflexiveIP)
+		}
+		if ipv6Changed {
+			nx.logger.Infof("the IPv6 endpoint of this device %s changed from %s to %s, updating peers", deviceID, nx.ipv6Endpoints, ipv6Endpoints)
+		}
+		if portMappingChanged {
+			nx.logger.Infof("the port mapped on the gateway for this device %s changed, updating peers", deviceID)
+		}
 
+		previousIPv6Endpoints := nx.ipv6Endpoints
+		nx.ipv6Endpoints = ipv6Endpoints
+		endpoints := nx.endpoints(reflexiveIP, stunServer1)
 		res, _, err := nx.client.DevicesApi.UpdateDevice(context.Background(), deviceID).Update(public.ModelsUpdateDevice{
-			Endpoints: []public.ModelsEndpoint{
-				{
-					Source:  "local",
-					Address: net.JoinHostPort(nx.endpointLocalAddress, fmt.Sprintf("%d", nx.listenPort)),
-				},
-				{
-					Source:  "stun:" + stunServer1,
-					Address: reflexiveIP.String(),
-				},
-			},
+			Endpoints: endpoints,
 		}).Execute()
 		if err != nil {
+			nx.ipv6Endpoints = previousIPv6Endpoints
 			return fmt.Errorf("failed to update this device's new NAT binding, likely still reconnecting to the api-server, retrying in 20s: %w", err)
 		} else {
 			nx.logger.Debugf("update device response %+v", res)
 			nx.nodeReflexiveAddressIPv4 = reflexiveIP
+			nx.portMapper.markAdvertised(endpoints)
 			// reinitialize peers if the NAT binding has changed for the node
 			if err = nx.reconcileDeviceCache(); err != nil {
 				nx.logger.Debugf("reconcile failed %v", res)
@@ -1034,9 +1211,44 @@ func (nx *Nexodus) addToDeviceCache(p public.ModelsDevice) {
 	nx.deviceCache[p.PublicKey] = d
 }
 
+// deviceCacheRekey moves the cache entry of a device that rotated its key over to the new key. The
+// peering state is kept so the peer is reconfigured with the same method, only the wireguard peer
+// for the previous key is removed, its routes stay in place. Returns true if an entry was moved.
+// assumes a write lock is held on deviceCacheLock
+func (nx *Nexodus) deviceCacheRekey(p public.ModelsDevice) bool {
+	if p.PreviousPublicKey == "" || p.PreviousPublicKey == p.PublicKey {
+		return false
+	}
+	existing, ok := nx.deviceCache[p.PreviousPublicKey]
+	if !ok || existing.device.Id != p.Id {
+		return false
+	}
+	if _, ok := nx.deviceCache[p.PublicKey]; ok {
+		return false
+	}
+
+	nx.logger.Debugf("Device %s rotated its key from [ %s ] to [ %s ]", p.Id, p.PreviousPublicKey, p.PublicKey)
+	if _, ok := nx.wgConfig.Peers[p.PreviousPublicKey]; ok {
+		delete(nx.wgConfig.Peers, p.PreviousPublicKey)
+		if err := nx.deletePeer(p.PreviousPublicKey, nx.tunnelIface); err != nil {
+			nx.logger.Warnf("failed to remove the peer for the previous key of device %s: %v", p.Id, err)
+		}
+	}
+	delete(nx.deviceCache, p.PreviousPublicKey)
+	existing.device.PublicKey = p.PublicKey
+	existing.device.PublicKeyCreatedAt = p.PublicKeyCreatedAt
+	existing.device.PreviousPublicKey = p.PreviousPublicKey
+	existing.device.PreviousPublicKeyExpiresAt = p.PreviousPublicKeyExpiresAt
+	nx.deviceCache[p.PublicKey] = existing
+	return true
+}
+
 func (nx *Nexodus) reconcileDeviceCache() error {
-	peerMap, resp, err := nx.devicesInformer.Execute()
+	peerMap, resp, err := nx.listDevices()
 	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("%w: %v", errUnauthorized, err)
+		}
 		if resp != nil {
 			return fmt.Errorf("error: %w header: %v", err, resp.Header)
 		}
@@ -1053,6 +1265,14 @@ func (nx *Nexodus) reconcileDeviceCache() error {
 		peerStats = make(map[string]WgSessions)
 	}
 
+	// Fetch the preshared keys before taking the lock, new peers need theirs before they are configured
+	if err := nx.refreshPresharedKeys(context.Background(), peerMap); err != nil {
+		nx.logger.Warnf("failed to refresh the peer preshared keys: %v", err)
+	}
+	if err := nx.refreshOnDemandPeering(); err != nil {
+		nx.logger.Warnf("failed to refresh the on-demand peering state: %v", err)
+	}
+
 	now := time.Now()
 
 	nx.deviceCacheLock.Lock()
@@ -1061,6 +1281,10 @@ func (nx *Nexodus) reconcileDeviceCache() error {
 	// Get our device cache up to date
 	newLocalConfig := false
 	for _, p := range peerMap {
+		// Swap the key of devices that have rotated it once the overlap has passed, without starting peering over
+		p = nx.peerKeyInOverlap(p, now)
+		nx.deviceCacheRekey(p)
+
 		// Update the cache if the device is new or has changed
 		existing, ok := nx.deviceCache[p.PublicKey]
 		if !ok || deviceUpdated(existing.device, p) {
@@ -1073,6 +1297,12 @@ func (nx *Nexodus) reconcileDeviceCache() error {
 			nx.addToDeviceCache(p)
 			existing = nx.deviceCache[p.PublicKey]
 			delete(peerStats, p.PublicKey)
+		} else if existing.device.RelayLoad != p.RelayLoad || !reflect.DeepEqual(existing.device.RelayLatencies, p.RelayLatencies) {
+			// the load of a relay, and the relay latencies of a device, change which peers are relayed through
+			// which relay, not how the device is peered with
+			existing.device.RelayLoad = p.RelayLoad
+			existing.device.RelayLatencies = p.RelayLatencies
+			nx.deviceCache[p.PublicKey] = existing
 		}
 
 		// Store the relay IP for easy reference later
@@ -1083,7 +1313,8 @@ func (nx *Nexodus) reconcileDeviceCache() error {
 		// Keep track of peer connection stats for connection health tracking
 		curStats, ok := peerStats[p.PublicKey]
 		if !ok {
-			if nx.wireguardPubKey != p.PublicKey && existing.peeringMethod != peeringMethodViaRelay {
+			if nx.wireguardPubKey != p.PublicKey && existing.peeringMethod != peeringMethodViaRelay &&
+				existing.peeringMethod != peeringMethodOnDemandIdle && existing.peeringMethod != peeringMethodViaHub {
 				nx.logger.Debugf("peer (hostname:%s pubkey:%s) has no stats", p.Hostname, p.PublicKey)
 			}
 			// This won't be available early because the peer hasn't been configured yet
@@ -1105,6 +1336,7 @@ func (nx *Nexodus) reconcileDeviceCache() error {
 		if existing.peerHealthy {
 			existing.peerHealthyTime = now
 		}
+		nx.adoptIPv6Roam(&existing)
 		nx.deviceCache[p.PublicKey] = existing
 	}
 
@@ -1150,7 +1382,8 @@ func deviceUpdated(d1, d2 public.ModelsDevice) bool {
 		!reflect.DeepEqual(d1.Endpoints, d2.Endpoints) ||
 		d1.Relay != d2.Relay ||
 		d1.SymmetricNat != d2.SymmetricNat ||
-		d1.SecurityGroupId != d2.SecurityGroupId
+		d1.SecurityGroupId != d2.SecurityGroupId ||
+		d1.PeeringGroup != d2.PeeringGroup
 }
 
 // checkUnsupportedConfigs general matrix checks of required information or constraints to run the agent and join the mesh
@@ -1199,6 +1432,10 @@ func (nx *Nexodus) symmetricNatDisco(ctx context.Context) error {
 
 		if isSymmetric {
 			nx.symmetricNat = true
+			if stunAddr1.Addr() == stunAddr2.Addr() {
+				// a NAT allocating its ports sequentially maps the next destination as many ports further along
+				nx.natPortDelta = int(stunAddr2.Port()) - int(stunAddr1.Port())
+			}
 			nx.logger.Infof("Symmetric NAT detected. A relay node is required to reach other devices outside of this local network. See See https://docs.nexodus.io/user-guide/relay-nodes/")
 		}
 
@@ -1211,16 +1448,6 @@ func (nx *Nexodus) symmetricNatDisco(ctx context.Context) error {
 	return nil
 }
 
-// orgRelayCheck checks if there is an existing Relay node in the organization that does not match this device's pub key
-func (nx *Nexodus) orgRelayCheck(peerMap map[string]public.ModelsDevice) (string, error) {
-	for _, p := range peerMap {
-		if p.Relay && nx.wireguardPubKey != p.PublicKey {
-			return p.Id, nil
-		}
-	}
-	return "", nil
-}
-
 func (nx *Nexodus) defaultTunnelDev() string {
 	if nx.userspaceMode {
 		return nx.defaultTunnelDevUS()
@@ -9,6 +9,7 @@ import (
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"os/exec"
+	"strconv"
 )
 
 func (nx *Nexodus) setupInterfaceOS() error {
@@ -54,7 +55,7 @@ func (nx *Nexodus) setupInterfaceOS() error {
 		return fmt.Errorf("%w", interfaceErr)
 	}
 
-	privateKey, err := wgtypes.ParseKey(nx.wireguardPvtKey)
+	privateKey, err := wgtypes.ParseKey(nx.interfacePrivateKey())
 	if err != nil {
 		logger.Errorf("invalid wiregaurd private key: %v\n", err)
 		return fmt.Errorf("%w", interfaceErr)
@@ -102,6 +103,14 @@ func deleteDarwinIface(logger *zap.SugaredLogger, dev string) {
 	}
 }
 
+// setMTUOS sets the MTU of the tunnel interface.
+func (nx *Nexodus) setMTUOS(mtu int) error {
+	if _, err := RunCommand("ifconfig", nx.tunnelIface, "mtu", strconv.Itoa(mtu)); err != nil {
+		return fmt.Errorf("failed to set the MTU of the %s interface: %w", nx.tunnelIface, err)
+	}
+	return nil
+}
+
 func (nx *Nexodus) findLocalIP() (string, error) {
 	return discoverGenericIPv4(nx.logger, nx.apiURL.Host, "443")
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/nexodus-io/nexodus/internal/util"
@@ -82,7 +83,7 @@ func (nx *Nexodus) setupInterfaceOS() error {
 	if nx.relay {
 		listenPort = WgDefaultPort
 	}
-	privateKey, err := wgtypes.ParseKey(nx.wireguardPvtKey)
+	privateKey, err := wgtypes.ParseKey(nx.interfacePrivateKey())
 	if err != nil {
 		logger.Errorf("invalid wiregaurd private key: %v\n", err)
 		return fmt.Errorf("%w", interfaceErr)
@@ -150,6 +151,14 @@ func (nx *Nexodus) removeExistingInterface() {
 	}
 }
 
+// setMTUOS sets the MTU of the tunnel interface.
+func (nx *Nexodus) setMTUOS(mtu int) error {
+	if _, err := RunCommand("ip", "link", "set", "dev", nx.tunnelIface, "mtu", strconv.Itoa(mtu)); err != nil {
+		return fmt.Errorf("failed to set the MTU of the %s interface: %w", nx.tunnelIface, err)
+	}
+	return nil
+}
+
 func (nx *Nexodus) findLocalIP() (string, error) {
 	// Linux network discovery
 	linuxIP, err := discoverLinuxAddress(nx.logger, 4)
@@ -0,0 +1,45 @@
+package nexodus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestRefreshVPC(t *testing.T) {
+	require := require.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("/api/vpcs/vpc", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(public.ModelsVPC{
+			Id:               "vpc",
+			Mtu:              1380,
+			MaxKeyAgeSeconds: 3600,
+			Topology:         "hub-and-spoke",
+		})
+	}))
+	defer server.Close()
+
+	config := public.NewConfiguration()
+	config.Servers = public.ServerConfigurations{{URL: server.URL}}
+	nx := &Nexodus{
+		logger: zap.NewNop().Sugar(),
+		client: public.NewAPIClient(config),
+		vpc:    &public.ModelsVPC{Id: "vpc", Ipv4Cidr: "100.64.0.0/10"},
+	}
+	require.Equal(defaultMTU, nx.configuredMTU())
+
+	nx.refreshVPC(context.Background())
+	require.Equal(1380, nx.configuredMTU())
+	require.Equal(int32(3600), nx.vpc.MaxKeyAgeSeconds)
+	require.Equal("hub-and-spoke", nx.vpc.Topology)
+	// the settings nexd does not apply while it runs are left as they were
+	require.Equal("100.64.0.0/10", nx.vpc.Ipv4Cidr)
+}
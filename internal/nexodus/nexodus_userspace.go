@@ -25,13 +25,10 @@ func (nx *Nexodus) setupInterfaceUS() error {
 		// So far I don't think DNS will ever be used. If Nexodus has its own
 		// built-in DNS, that would make sense here.
 		[]netip.Addr{netip.MustParseAddr("8.8.8.8")},
-		// Assume a standard 1500 minus our tunneling overhead
-		// TODO - make this configurable or dynamic. If there are
-		// multiple layers of tunneling involved, it may need to be
-		// even smaller. Consider running this inside a Kubernetes Pod,
-		// where the cluster SDN provider has already reduced the MTU
-		// to account for its own tunneling (Geneve, for example).
-		1420)
+		// The MTU can not be changed once netstack is created, a lower
+		// path MTU discovered later is applied by clamping the TCP MSS,
+		// see usPacketFilter.setMTU.
+		nx.configuredMTU())
 	if err != nil {
 		nx.logger.Errorf("Failed to create userspace tunnel device: %w", err)
 		return err
@@ -45,8 +42,9 @@ func (nx *Nexodus) setupInterfaceUS() error {
 	if nx.logger.Level() == zap.DebugLevel {
 		logger.Verbosef = nx.logger.Debugf
 	}
-	dev := device.NewDevice(nx.userspaceTun, conn.NewDefaultBind(), logger)
-	pvtDecoded, err := base64.StdEncoding.DecodeString(nx.wireguardPvtKey)
+	nx.userspaceFilter = newUsPacketFilter(tun)
+	dev := device.NewDevice(nx.userspaceFilter, conn.NewDefaultBind(), logger)
+	pvtDecoded, err := base64.StdEncoding.DecodeString(nx.interfacePrivateKey())
 	if err != nil {
 		nx.logger.Errorf("Failed to decode wireguard private key: %w", err)
 		return err
@@ -82,3 +80,17 @@ func (nx *Nexodus) setupInterfaceUS() error {
 func (nx *Nexodus) defaultTunnelDevUS() string {
 	return defaultDeviceName
 }
+
+// processSecurityGroupRulesUS applies the security group rules to the packet filter of the userspace device
+func (nx *Nexodus) processSecurityGroupRulesUS() error {
+	if nx.userspaceFilter == nil {
+		return nil
+	}
+	if nx.securityGroup == nil {
+		return nx.userspaceFilter.setRules(nil, nil)
+	}
+	if err := nx.userspaceFilter.setRules(nx.securityGroup.InboundRules, nx.securityGroup.OutboundRules); err != nil {
+		return fmt.Errorf("userspace security group setup error: %w", err)
+	}
+	return nil
+}
@@ -25,7 +25,7 @@ func (nx *Nexodus) setupInterfaceOS() error {
 	dev := nx.tunnelIface
 	listenPortStr := strconv.Itoa(nx.listenPort)
 
-	if err := buildWindowsWireguardIfaceConf(nx.wireguardPvtKey, nx.TunnelIP, listenPortStr); err != nil {
+	if err := buildWindowsWireguardIfaceConf(nx.interfacePrivateKey(), nx.TunnelIP, listenPortStr); err != nil {
 		return fmt.Errorf("failed to create the windows wireguard wg0 interface file: %w", err)
 	}
 
@@ -67,6 +67,17 @@ func (nx *Nexodus) removeExistingInterface() {
 	nx.logger.Debugf("stopped windows tunnel svc:%v\n", wgOut)
 }
 
+// setMTUOS sets the MTU of the tunnel interface, for IPv4 and IPv6 alike.
+func (nx *Nexodus) setMTUOS(mtu int) error {
+	for _, family := range []string{"ipv4", "ipv6"} {
+		_, err := RunCommand("netsh", "interface", family, "set", "subinterface", nx.tunnelIface, fmt.Sprintf("mtu=%d", mtu), "store=active")
+		if err != nil {
+			return fmt.Errorf("failed to set the %s MTU of the %s interface: %w", family, nx.tunnelIface, err)
+		}
+	}
+	return nil
+}
+
 func (nx *Nexodus) findLocalIP() (string, error) {
 	return discoverGenericIPv4(nx.logger, nx.apiURL.Host, "443")
 }
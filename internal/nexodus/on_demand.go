@@ -0,0 +1,230 @@
+package nexodus
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+// how long an on-demand peer is kept without traffic when the vpc does not configure a timeout
+const defaultPeerIdleTimeout = 10 * time.Minute
+
+var errPeerActivityUnsupported = errors.New("tracking peer activity is not supported on this platform")
+
+// onDemandPeering returns true if this device only configures the peers it needs. Relay nodes always
+// peer with every device, they carry the traffic of the devices that are not peered with each other.
+func (nx *Nexodus) onDemandPeering() bool {
+	return nx.vpc != nil && nx.vpc.OnDemandPeering && !nx.relay
+}
+
+func (nx *Nexodus) peerIdleTimeout() time.Duration {
+	if nx.vpc == nil || nx.vpc.PeerIdleTimeoutSeconds <= 0 {
+		return defaultPeerIdleTimeout
+	}
+	return time.Duration(nx.vpc.PeerIdleTimeoutSeconds) * time.Second
+}
+
+// refreshOnDemandPeering fetches what the on-demand peering decisions are based on: the security groups
+// of the vpc and the addresses this device recently exchanged traffic with.
+func (nx *Nexodus) refreshOnDemandPeering() error {
+	if !nx.onDemandPeering() {
+		nx.onDemandSecurityGroups = nil
+		nx.activePeerAddrs = nil
+		return nx.stopPeerActivityTracking()
+	}
+
+	groups, _, err := nx.listSecurityGroups()
+	if err != nil {
+		return err
+	}
+	nx.onDemandSecurityGroups = compileOnDemandSecurityGroups(groups)
+
+	activeAddrs, err := nx.peerActivity()
+	if errors.Is(err, errPeerActivityUnsupported) {
+		// without knowing which peers are in use, every peer the security groups permit is configured
+		nx.activePeerAddrs = nil
+		return nil
+	}
+	if err != nil {
+		nx.activePeerAddrs = nil
+		return err
+	}
+	nx.activePeerAddrs = activeAddrs
+	return nil
+}
+
+// peerActivity returns the addresses this device exchanged traffic with over the tunnel within the peer idle timeout.
+func (nx *Nexodus) peerActivity() (map[netip.Addr]bool, error) {
+	idleTimeout := nx.peerIdleTimeout()
+	if nx.userspaceMode {
+		if nx.userspaceFilter == nil {
+			return nil, errPeerActivityUnsupported
+		}
+		if nx.peerActivityTimeout != idleTimeout {
+			nx.userspaceFilter.trackActivity(true)
+			nx.peerActivityTimeout = idleTimeout
+		}
+		return addrSet(nx.userspaceFilter.activeAddrs(idleTimeout)), nil
+	}
+
+	if nx.peerActivityTimeout != idleTimeout {
+		if err := nx.trackPeerActivityOS(idleTimeout); err != nil {
+			return nil, err
+		}
+		nx.peerActivityTimeout = idleTimeout
+	}
+	addrs, err := nx.peerActivityOS()
+	if err != nil {
+		return nil, err
+	}
+	return addrSet(addrs), nil
+}
+
+func (nx *Nexodus) stopPeerActivityTracking() error {
+	if nx.peerActivityTimeout == 0 {
+		return nil
+	}
+	nx.peerActivityTimeout = 0
+	if nx.userspaceMode {
+		if nx.userspaceFilter != nil {
+			nx.userspaceFilter.trackActivity(false)
+		}
+		return nil
+	}
+	return nx.stopPeerActivityOS()
+}
+
+func addrSet(addrs []netip.Addr) map[netip.Addr]bool {
+	result := make(map[netip.Addr]bool, len(addrs))
+	for _, addr := range addrs {
+		result[addr.Unmap()] = true
+	}
+	return result
+}
+
+// onDemandPeerWanted determines if a peer is configured while on-demand peering is enabled. Relays are always
+// configured. Other peers are configured when a security rule names their addresses, or, when the security groups
+// permit traffic between the pair, once traffic was exchanged with the peer within the idle timeout. That first
+// traffic flows through the relay, so without a healthy relay every permitted peer is configured.
+// assumes deviceCacheLock is held
+func (nx *Nexodus) onDemandPeerWanted(local, peer public.ModelsDevice, healthyRelay bool) bool {
+	if peer.Relay {
+		return true
+	}
+	permitted, named := securityGroupsPermitPair(local, peer, nx.onDemandSecurityGroups)
+	if !permitted {
+		return false
+	}
+	if named || !healthyRelay || nx.activePeerAddrs == nil {
+		return true
+	}
+	prefixes := devicePrefixes(peer)
+	for addr := range nx.activePeerAddrs {
+		for _, prefix := range prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// onDemandSecurityGroup holds the rules of a security group, with its grants, compiled once per refresh
+// rather than for every pair of devices.
+type onDemandSecurityGroup struct {
+	inbound, outbound onDemandRules
+}
+
+type onDemandRules struct {
+	// a direction without any rules permits all traffic
+	any   bool
+	rules []usFilterRule
+}
+
+func compileOnDemandRules(rules []public.ModelsSecurityRule) onDemandRules {
+	if len(rules) == 0 {
+		return onDemandRules{any: true}
+	}
+	// like the packet filters, the rules that fail to compile are left out
+	compiled, _ := newUsFilterRules(rules)
+	return onDemandRules{rules: compiled}
+}
+
+func compileOnDemandSecurityGroups(groups map[string]public.ModelsSecurityGroup) map[string]onDemandSecurityGroup {
+	result := make(map[string]onDemandSecurityGroup, len(groups))
+	for id, group := range groups {
+		group = applySecurityGroupGrants(group)
+		result[id] = onDemandSecurityGroup{
+			inbound:  compileOnDemandRules(group.InboundRules),
+			outbound: compileOnDemandRules(group.OutboundRules),
+		}
+	}
+	return result
+}
+
+// securityGroupsPermitPair checks if the security groups of two devices permit traffic between them in
+// either direction. named is set when the traffic is permitted by a rule that lists the addresses of one
+// of the devices, rather than by a rule that permits any address.
+func securityGroupsPermitPair(a, b public.ModelsDevice, groups map[string]onDemandSecurityGroup) (permitted, named bool) {
+	groupA := securityGroupOrAny(groups, a.SecurityGroupId)
+	groupB := securityGroupOrAny(groups, b.SecurityGroupId)
+	prefixesA := devicePrefixes(a)
+	prefixesB := devicePrefixes(b)
+
+	aToB, aToBNamed := directionPermitted(groupA.outbound, prefixesB, groupB.inbound, prefixesA)
+	bToA, bToANamed := directionPermitted(groupB.outbound, prefixesA, groupA.inbound, prefixesB)
+	return aToB || bToA, (aToB && aToBNamed) || (bToA && bToANamed)
+}
+
+// securityGroupOrAny returns the compiled group, a device without a group, or with a group we have not
+// seen, has no rules and permits all traffic.
+func securityGroupOrAny(groups map[string]onDemandSecurityGroup, id string) onDemandSecurityGroup {
+	if group, ok := groups[id]; ok {
+		return group
+	}
+	return onDemandSecurityGroup{inbound: onDemandRules{any: true}, outbound: onDemandRules{any: true}}
+}
+
+// directionPermitted checks the outbound rules of the sender and the inbound rules of the receiver.
+func directionPermitted(outbound onDemandRules, receiver []netip.Prefix, inbound onDemandRules, sender []netip.Prefix) (permitted, named bool) {
+	outboundPermitted, outboundNamed := rulesPermitPrefixes(outbound, receiver)
+	inboundPermitted, inboundNamed := rulesPermitPrefixes(inbound, sender)
+	return outboundPermitted && inboundPermitted, outboundNamed || inboundNamed
+}
+
+// rulesPermitPrefixes checks if any of the rules permits some traffic with one of the prefixes. Like the
+// packet filters, a direction without any rules permits all traffic.
+func rulesPermitPrefixes(rules onDemandRules, prefixes []netip.Prefix) (permitted, named bool) {
+	if rules.any {
+		return true, false
+	}
+	for _, rule := range rules.rules {
+		if len(rule.addrs) == 0 {
+			permitted = true
+			continue
+		}
+		for _, addrs := range rule.addrs {
+			for _, prefix := range prefixes {
+				if addrs.from.Compare(prefixLastAddr(prefix)) <= 0 && prefix.Addr().Compare(addrs.to) <= 0 {
+					return true, true
+				}
+			}
+		}
+	}
+	return permitted, false
+}
+
+// devicePrefixes returns the tunnel addresses and advertised cidrs of a device.
+func devicePrefixes(device public.ModelsDevice) []netip.Prefix {
+	var result []netip.Prefix
+	for _, cidr := range append(append([]string{}, device.AllowedIps...), device.AdvertiseCidrs...) {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		result = append(result, prefix.Masked())
+	}
+	return result
+}
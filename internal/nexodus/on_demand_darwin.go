@@ -0,0 +1,23 @@
+//go:build darwin
+
+package nexodus
+
+import (
+	"net/netip"
+	"time"
+)
+
+// trackPeerActivityOS for Darwin build purposes, on-demand peering relies on the security groups alone
+func (nx *Nexodus) trackPeerActivityOS(idleTimeout time.Duration) error {
+	return errPeerActivityUnsupported
+}
+
+// peerActivityOS for Darwin build purposes
+func (nx *Nexodus) peerActivityOS() ([]netip.Addr, error) {
+	return nil, errPeerActivityUnsupported
+}
+
+// stopPeerActivityOS for Darwin build purposes
+func (nx *Nexodus) stopPeerActivityOS() error {
+	return nil
+}
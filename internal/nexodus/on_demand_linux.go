@@ -0,0 +1,127 @@
+//go:build linux
+
+package nexodus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+const (
+	// Nftables table recording the addresses traffic is exchanged with over the tunnel, for on-demand peering
+	peerActivityTableName = "nexodus-peer-activity"
+	peerActivitySetV4     = "active-v4"
+	peerActivitySetV6     = "active-v6"
+)
+
+// trackPeerActivityOS sets up nftables sets that hold the addresses traffic was exchanged with over the
+// tunnel interface. Every packet refreshes the timeout of its address, so the kernel drops idle addresses.
+func (nx *Nexodus) trackPeerActivityOS(idleTimeout time.Duration) error {
+	if err := nx.policyTableDrop(peerActivityTableName); err != nil {
+		return fmt.Errorf("nftables setup error, failed to drop the %s table: %w", peerActivityTableName, err)
+	}
+	if _, err := policyCmd(nx.logger, []string{"add", "table", tableFamily, peerActivityTableName}); err != nil {
+		return fmt.Errorf("nftables setup error, failed to create the %s table: %w", peerActivityTableName, err)
+	}
+
+	timeout := fmt.Sprintf("%ds", int(idleTimeout.Seconds()))
+	sets := map[string]string{
+		peerActivitySetV4: "ipv4_addr",
+		peerActivitySetV6: "ipv6_addr",
+	}
+	for name, addrType := range sets {
+		if _, err := policyCmd(nx.logger, []string{"add", "set", tableFamily, peerActivityTableName, name,
+			"{", "type", addrType, ";", "flags", "dynamic,timeout", ";", "timeout", timeout, ";", "}"}); err != nil {
+			return fmt.Errorf("nftables setup error, failed to create the set %s: %w", name, err)
+		}
+	}
+
+	// runs after the security group chains, only the permitted traffic counts as activity
+	for _, hook := range []string{"input", "output", "forward"} {
+		if _, err := policyCmd(nx.logger, []string{"add", "chain", tableFamily, peerActivityTableName, hook,
+			"{", "type", "filter", "hook", hook, "priority", "10", ";", "policy", "accept", ";", "}"}); err != nil {
+			return fmt.Errorf("nftables setup error, failed to create the chain %s: %w", hook, err)
+		}
+	}
+	rules := [][]string{
+		{"input", "iifname", nx.tunnelIface, "update", "@" + peerActivitySetV4, "{", "ip", "saddr", "}"},
+		{"input", "iifname", nx.tunnelIface, "update", "@" + peerActivitySetV6, "{", "ip6", "saddr", "}"},
+		{"output", "oifname", nx.tunnelIface, "update", "@" + peerActivitySetV4, "{", "ip", "daddr", "}"},
+		{"output", "oifname", nx.tunnelIface, "update", "@" + peerActivitySetV6, "{", "ip6", "daddr", "}"},
+		{"forward", "iifname", nx.tunnelIface, "update", "@" + peerActivitySetV4, "{", "ip", "saddr", "}"},
+		{"forward", "iifname", nx.tunnelIface, "update", "@" + peerActivitySetV6, "{", "ip6", "saddr", "}"},
+		{"forward", "oifname", nx.tunnelIface, "update", "@" + peerActivitySetV4, "{", "ip", "daddr", "}"},
+		{"forward", "oifname", nx.tunnelIface, "update", "@" + peerActivitySetV6, "{", "ip6", "daddr", "}"},
+	}
+	for _, rule := range rules {
+		if _, err := policyCmd(nx.logger, append([]string{"add", "rule", tableFamily, peerActivityTableName}, rule...)); err != nil {
+			return fmt.Errorf("nftables setup error, failed to add the peer activity rule: %w", err)
+		}
+	}
+	return nil
+}
+
+// peerActivityOS returns the addresses held by the peer activity sets
+func (nx *Nexodus) peerActivityOS() ([]netip.Addr, error) {
+	var result []netip.Addr
+	for _, name := range []string{peerActivitySetV4, peerActivitySetV6} {
+		output, err := policyCmd(nx.logger, []string{"-j", "list", "set", tableFamily, peerActivityTableName, name})
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := parseNftSetAddrs([]byte(output))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the %s set: %w", name, err)
+		}
+		result = append(result, addrs...)
+	}
+	return result, nil
+}
+
+func (nx *Nexodus) stopPeerActivityOS() error {
+	return nx.policyTableDrop(peerActivityTableName)
+}
+
+// parseNftSetAddrs parses the addresses of a set listed by `nft -j list set`. Elements of sets with
+// a timeout are listed as objects holding the address and its timeout, others as plain addresses.
+func parseNftSetAddrs(data []byte) ([]netip.Addr, error) {
+	var listing struct {
+		Nftables []struct {
+			Set *struct {
+				Elem []json.RawMessage `json:"elem"`
+			} `json:"set"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(data, &listing); err != nil {
+		return nil, err
+	}
+
+	var result []netip.Addr
+	for _, item := range listing.Nftables {
+		if item.Set == nil {
+			continue
+		}
+		for _, elem := range item.Set.Elem {
+			var value string
+			if err := json.Unmarshal(elem, &value); err != nil {
+				var timed struct {
+					Elem struct {
+						Val string `json:"val"`
+					} `json:"elem"`
+				}
+				if err := json.Unmarshal(elem, &timed); err != nil {
+					return nil, err
+				}
+				value = timed.Elem.Val
+			}
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, addr)
+		}
+	}
+	return result, nil
+}
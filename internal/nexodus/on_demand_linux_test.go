@@ -0,0 +1,26 @@
+//go:build linux
+
+package nexodus
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNftSetAddrs(t *testing.T) {
+	listing := `{"nftables": [{"metainfo": {"version": "1.0.2", "release_name": "Lester Gooch", "json_schema_version": 1}},
+{"set": {"family": "inet", "name": "active-v4", "table": "nexodus-peer-activity", "type": "ipv4_addr", "handle": 1,
+"flags": ["timeout", "dynamic"], "timeout": 600,
+"elem": [{"elem": {"val": "100.64.0.2", "timeout": 600, "expires": 597}}, "100.64.0.3"]}}]}`
+
+	addrs, err := parseNftSetAddrs([]byte(listing))
+	require.NoError(t, err)
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("100.64.0.2"), netip.MustParseAddr("100.64.0.3")}, addrs)
+
+	// an empty set has no elem field
+	addrs, err = parseNftSetAddrs([]byte(`{"nftables": [{"set": {"family": "inet", "name": "active-v6", "type": "ipv6_addr"}}]}`))
+	require.NoError(t, err)
+	require.Empty(t, addrs)
+}
@@ -0,0 +1,112 @@
+package nexodus
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestSecurityGroupsPermitPair(t *testing.T) {
+	web := public.ModelsDevice{AllowedIps: []string{"100.64.0.1/32", "200::1/128"}, SecurityGroupId: "web"}
+	db := public.ModelsDevice{AllowedIps: []string{"100.64.0.2/32", "200::2/128"}, SecurityGroupId: "db"}
+	laptop := public.ModelsDevice{AllowedIps: []string{"100.64.0.3/32", "200::3/128"}}
+	router := public.ModelsDevice{AllowedIps: []string{"100.64.0.4/32"}, AdvertiseCidrs: []string{"10.0.0.0/24"}, SecurityGroupId: "router"}
+	groups := map[string]public.ModelsSecurityGroup{
+		// the web server talks to the database, and is reachable on port 443 from anywhere
+		"web": {
+			InboundRules:  []public.ModelsSecurityRule{{IpProtocol: "tcp", Ports: []int32{443}}},
+			OutboundRules: []public.ModelsSecurityRule{{IpProtocol: "tcp", Ports: []int32{5432}, IpRanges: []string{"100.64.0.2"}}},
+		},
+		// the database only accepts connections from the web server and makes none
+		"db": {
+			InboundRules:  []public.ModelsSecurityRule{{IpProtocol: "tcp", Ports: []int32{5432}, IpRanges: []string{"100.64.0.1-100.64.0.1"}}},
+			OutboundRules: []public.ModelsSecurityRule{{IpProtocol: "icmp", IpRanges: []string{"100.64.9.9"}}},
+		},
+		// the network router accepts traffic for its lan from the laptop
+		"router": {
+			InboundRules: []public.ModelsSecurityRule{{IpProtocol: "ipv4", IpRanges: []string{"100.64.0.3/32"}}},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		a, b      public.ModelsDevice
+		permitted bool
+		named     bool
+	}{
+		{"rules name both sides", web, db, true, true},
+		{"named in the other direction", db, web, true, true},
+		{"permitted by wildcard rules", laptop, web, true, false},
+		{"denied in both directions", laptop, db, false, false},
+		{"no rules on either side", laptop, laptop, true, false},
+		{"named by the receiver", laptop, router, true, true},
+		{"receiver names someone else", web, router, true, false},
+	}
+	for _, tc := range testCases {
+		permitted, named := securityGroupsPermitPair(tc.a, tc.b, compileOnDemandSecurityGroups(groups))
+		require.Equal(t, tc.permitted, permitted, tc.name)
+		require.Equal(t, tc.named, named, tc.name)
+	}
+
+	// the security groups are not known yet
+	permitted, named := securityGroupsPermitPair(laptop, db, nil)
+	require.True(t, permitted)
+	require.False(t, named)
+}
+
+func TestOnDemandPeerWanted(t *testing.T) {
+	local := public.ModelsDevice{AllowedIps: []string{"100.64.0.1/32"}}
+	relay := public.ModelsDevice{AllowedIps: []string{"100.64.0.254/32"}, Relay: true}
+	peer := public.ModelsDevice{AllowedIps: []string{"100.64.0.2/32"}, AdvertiseCidrs: []string{"10.0.0.0/24"}}
+	denied := public.ModelsDevice{AllowedIps: []string{"100.64.0.3/32"}, SecurityGroupId: "closed"}
+	nx := &Nexodus{
+		onDemandSecurityGroups: compileOnDemandSecurityGroups(map[string]public.ModelsSecurityGroup{
+			"closed": {
+				InboundRules:  []public.ModelsSecurityRule{{IpProtocol: "icmp", IpRanges: []string{"100.64.9.9"}}},
+				OutboundRules: []public.ModelsSecurityRule{{IpProtocol: "icmp", IpRanges: []string{"100.64.9.9"}}},
+			},
+		}),
+		activePeerAddrs: map[netip.Addr]bool{},
+	}
+
+	require.True(t, nx.onDemandPeerWanted(local, relay, true))
+	require.False(t, nx.onDemandPeerWanted(local, peer, true))
+	// without a relay to carry the first packets every permitted peer is configured
+	require.True(t, nx.onDemandPeerWanted(local, peer, false))
+
+	// traffic to the lan behind the peer calls for the peer
+	nx.activePeerAddrs[netip.MustParseAddr("10.0.0.7")] = true
+	require.True(t, nx.onDemandPeerWanted(local, peer, true))
+
+	// traffic the security groups deny never does
+	nx.activePeerAddrs[netip.MustParseAddr("100.64.0.3")] = true
+	require.False(t, nx.onDemandPeerWanted(local, denied, true))
+	require.False(t, nx.onDemandPeerWanted(local, denied, false))
+
+	// peer activity is not known on this platform
+	nx.activePeerAddrs = nil
+	require.True(t, nx.onDemandPeerWanted(local, peer, true))
+}
+
+func TestUserspacePacketFilterActivity(t *testing.T) {
+	filter := newUsPacketFilter(nil)
+	require.NoError(t, filter.setRules(nil, []public.ModelsSecurityRule{{IpProtocol: "tcp", IpRanges: []string{"100.64.0.2"}}}))
+	require.Empty(t, filter.activeAddrs(time.Minute))
+
+	filter.trackActivity(true)
+	require.True(t, filter.allow(testPacket(6, "100.64.0.1", "100.64.0.2", 40000, 22), false))
+	require.False(t, filter.allow(testPacket(6, "100.64.0.1", "100.64.0.3", 40000, 22), false))
+	require.True(t, filter.allow(testPacket(17, "200::5", "200::1", 40000, 53), true))
+	require.ElementsMatch(t, []netip.Addr{netip.MustParseAddr("100.64.0.2"), netip.MustParseAddr("200::5")}, filter.activeAddrs(time.Minute))
+
+	// idle addresses are forgotten
+	filter.activity[netip.MustParseAddr("200::5")] = time.Now().Add(-2 * time.Minute)
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("100.64.0.2")}, filter.activeAddrs(time.Minute))
+
+	filter.trackActivity(false)
+	require.Empty(t, filter.activeAddrs(time.Minute))
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package nexodus
+
+import (
+	"net/netip"
+	"time"
+)
+
+// trackPeerActivityOS for windows build purposes, on-demand peering relies on the security groups alone
+func (nx *Nexodus) trackPeerActivityOS(idleTimeout time.Duration) error {
+	return errPeerActivityUnsupported
+}
+
+// peerActivityOS for windows build purposes
+func (nx *Nexodus) peerActivityOS() ([]netip.Addr, error) {
+	return nil, errPeerActivityUnsupported
+}
+
+// stopPeerActivityOS for windows build purposes
+func (nx *Nexodus) stopPeerActivityOS() error {
+	return nil
+}
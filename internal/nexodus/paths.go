@@ -0,0 +1,160 @@
+package nexodus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/util"
+)
+
+const (
+	// how often the round-trip time to the peers is measured through the peering method they use
+	pathProbeInterval = 60 * time.Second
+	// how long a peer stays on the relay before the peering methods preferred over it are tried again
+	pathRetryInterval = 10 * time.Minute
+	// a path is only slower than another once its round-trip time is higher by both this ratio and pathLatencyMargin
+	pathLatencyRatio  = 1.2
+	pathLatencyMargin = 5 * time.Millisecond
+)
+
+// reconcilePaths measures the round-trip time to the peers through the peering method each uses, so that a method
+// that comes up can be compared with the one used before. Relayed peers are measured through their relay.
+func (nx *Nexodus) reconcilePaths(ctx context.Context, wg *sync.WaitGroup) {
+	if nx.relay {
+		// relay nodes peer with every device directly, there is no other path to compare with
+		return
+	}
+
+	type pathTarget struct {
+		address string
+		method  string
+	}
+	targets := map[string]pathTarget{}
+	nx.deviceCacheIterRead(func(d deviceCacheEntry) {
+		if d.device.PublicKey == nx.wireguardPubKey || len(d.device.Ipv4TunnelIps) == 0 {
+			return
+		}
+		if d.peerHealthy || d.relayID != "" {
+			targets[d.device.PublicKey] = pathTarget{address: d.device.Ipv4TunnelIps[0].Address, method: d.peeringMethod}
+		}
+	})
+	if len(targets) == 0 || !nx.pathProbe.begin() {
+		return
+	}
+
+	util.GoWithWaitGroup(wg, func() {
+		defer nx.pathProbe.end()
+		publicKeys := make([]string, 0, len(targets))
+		for publicKey := range targets {
+			publicKeys = append(publicKeys, publicKey)
+		}
+		// measure in batches, like the connectivity probes, to limit the traffic with a large number of peers
+		for i := 0; i < len(publicKeys); i += batchSize {
+			end := i + batchSize
+			if end > len(publicKeys) {
+				end = len(publicKeys)
+			}
+			latencies := map[string]time.Duration{}
+			var latenciesMu sync.Mutex
+			var probes sync.WaitGroup
+			for _, publicKey := range publicKeys[i:end] {
+				publicKey, target := publicKey, targets[publicKey]
+				util.GoWithWaitGroup(&probes, func() {
+					result, err := nx.ping(target.address)
+					if err != nil {
+						nx.logger.Debugf("failed to measure the round-trip time to peer %s: %v", publicKey, err)
+						return
+					}
+					latency, err := time.ParseDuration(result)
+					if err != nil {
+						return
+					}
+					latenciesMu.Lock()
+					latencies[publicKey] = latency
+					latenciesMu.Unlock()
+				})
+			}
+			probes.Wait()
+			if ctx.Err() != nil {
+				return
+			}
+
+			nx.deviceCacheLock.Lock()
+			for publicKey, latency := range latencies {
+				d, ok := nx.deviceCache[publicKey]
+				if !ok || d.peeringMethod != targets[publicKey].method {
+					// the peer moved to another method while it was measured
+					continue
+				}
+				if d.pathLatency == nil {
+					d.pathLatency = map[string]time.Duration{}
+				}
+				d.pathLatency[d.peeringMethod] = latency
+				nx.deviceCache[publicKey] = d
+			}
+			nx.deviceCacheLock.Unlock()
+		}
+	})
+}
+
+// pathProbeDue returns the index of the peering method to try again for a peer that is on the relay, or -1 when it is
+// not time to yet. Peers fall back to the relay once the methods preferred over it failed, they may come up later on,
+// once a NAT mapping expired or a firewall rule changed. The most preferred method available is tried first, and the
+// state machine walks back to the relay when none of them comes up. A peer on an IPv4 method after IPv6 lost the race
+// to it tries IPv6 again the same way, this time for as long as any other method gets to come up. The round-trip time
+// through the current method needs to be known, to tell whether the method that comes up is faster.
+func (nx *Nexodus) pathProbeDue(d deviceCacheEntry, reflexiveIP4 string, healthyRelay bool) int {
+	if d.pathFallback != "" || d.pathLatency[d.peeringMethod] == 0 {
+		return -1
+	}
+	if time.Since(d.pathProbeTime) < pathRetryInterval {
+		return -1
+	}
+	if d.peeringMethod == peeringMethodViaRelay {
+		for i := 0; i < d.peeringMethodIndex; i++ {
+			if wgPeerMethods[i].checkPrereqs(nx, d.device, reflexiveIP4, healthyRelay) {
+				return i
+			}
+		}
+		return -1
+	}
+	if i := pathMethodIndex(peeringMethodDirectIPv6); i < d.peeringMethodIndex && wgPeerMethods[i].checkPrereqs(nx, d.device, reflexiveIP4, healthyRelay) {
+		return i
+	}
+	return -1
+}
+
+// pathSlower determines if a path with the round-trip time probed is slower than one with the round-trip time fallback.
+func pathSlower(probed, fallback time.Duration) bool {
+	return float64(probed) > float64(fallback)*pathLatencyRatio && probed-fallback > pathLatencyMargin
+}
+
+// pathProbeResult compares the round-trip time through the peering method probed for a peer with the one through the
+// method it came from. Once the method probed is up and measured, the probe is done, and slower reports whether the
+// peer should go back to the method it came from. The reason for the choice is recorded either way.
+func (nx *Nexodus) pathProbeResult(d *deviceCacheEntry) (done, slower bool) {
+	probed, fallback := d.pathLatency[d.peeringMethod], d.pathLatency[d.pathFallback]
+	if !d.peerHealthy || probed == 0 {
+		return false, false
+	}
+	slower = pathSlower(probed, fallback)
+	if slower {
+		d.pathReason = fmt.Sprintf("%s is faster than %s, %s against %s", d.pathFallback, d.peeringMethod, fallback, probed)
+	} else {
+		d.pathReason = fmt.Sprintf("%s is not slower than %s, %s against %s", d.peeringMethod, d.pathFallback, probed, fallback)
+	}
+	nx.logger.Debugf("Probed method [ %s ] for peer [ %s ], %s", d.peeringMethod, d.device.PublicKey, d.pathReason)
+	return true, slower
+}
+
+// pathMethodIndex returns the index of a peering method in wgPeerMethods, or -1 if there is none by that name.
+func pathMethodIndex(name string) int {
+	for i, method := range wgPeerMethods {
+		if method.name == name {
+			return i
+		}
+	}
+	return -1
+}
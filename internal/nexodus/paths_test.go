@@ -0,0 +1,144 @@
+package nexodus
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestPathSlower(t *testing.T) {
+	require := require.New(t)
+	require.False(pathSlower(20*time.Millisecond, 20*time.Millisecond))
+	// more than 20% slower, but within the margin
+	require.False(pathSlower(4*time.Millisecond, 2*time.Millisecond))
+	// over the margin, but within 20%
+	require.False(pathSlower(110*time.Millisecond, 100*time.Millisecond))
+	require.True(pathSlower(30*time.Millisecond, 20*time.Millisecond))
+	require.False(pathSlower(20*time.Millisecond, 30*time.Millisecond))
+}
+
+func TestPathProbe(t *testing.T) {
+	zLogger, _ := zap.NewDevelopment()
+	nx := &Nexodus{
+		vpc: &public.ModelsVPC{
+			Ipv4Cidr: "100.64.0.0/10",
+			Ipv6Cidr: "200::/64",
+		},
+		nodeReflexiveAddressIPv4: netip.MustParseAddrPort("1.1.1.1:1234"),
+		logger:                   zLogger.Sugar(),
+	}
+
+	testCases := []struct {
+		name string
+		// the round-trip time measured through the reflexive address once it came up
+		reflexiveLatency time.Duration
+		// the peering method the peer ends up with
+		expectedMethod string
+	}{
+		{
+			name:             "faster than the relay",
+			reflexiveLatency: 10 * time.Millisecond,
+			expectedMethod:   peeringMethodReflexive,
+		},
+		{
+			name:             "slower than the relay",
+			reflexiveLatency: 80 * time.Millisecond,
+			expectedMethod:   peeringMethodViaRelay,
+		},
+	}
+
+	for _, tcIter := range testCases {
+		tc := tcIter
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+			d := deviceCacheEntry{
+				device: public.ModelsDevice{
+					Endpoints: []public.ModelsEndpoint{
+						{
+							Address: "192.168.10.50:5678",
+							Source:  "local",
+						},
+						{
+							Address: "2.2.2.2:4321",
+							Source:  "stun",
+						},
+					},
+					PublicKey: "bacon",
+				},
+			}
+			nx.peeringReset(&d)
+
+			// the peer fell back to the relay, the reflexive address did not come up
+			d.peeringMethod = peeringMethodViaRelay
+			d.peeringMethodIndex = pathMethodIndex(peeringMethodViaRelay)
+			d.peeringTime = time.Now()
+			d.pathProbeTime = time.Now()
+			d.pathLatency = map[string]time.Duration{peeringMethodViaRelay: 40 * time.Millisecond}
+			_, chosenMethod, _ := nx.rebuildPeerConfig(&d, true)
+			require.Equal(peeringMethodViaRelay, chosenMethod)
+
+			// after a while on the relay, the reflexive address is tried again
+			d.pathProbeTime = time.Now().Add(-pathRetryInterval)
+			_, chosenMethod, chosenIndex := nx.rebuildPeerConfig(&d, true)
+			require.Equal(peeringMethodReflexive, chosenMethod)
+			require.Equal(peeringMethodViaRelay, d.pathFallback)
+			require.Contains(d.pathReason, "probing")
+
+			// the reflexive address came up, the choice waits for its round-trip time
+			d.peeringMethod = chosenMethod
+			d.peeringMethodIndex = chosenIndex
+			d.peeringTime = time.Now()
+			d.peerHealthy = true
+			d.peerHealthyTime = time.Now()
+			_, chosenMethod, _ = nx.rebuildPeerConfig(&d, true)
+			require.Equal(peeringMethodReflexive, chosenMethod)
+			require.Equal(peeringMethodViaRelay, d.pathFallback)
+
+			d.pathLatency[peeringMethodReflexive] = tc.reflexiveLatency
+			_, chosenMethod, _ = nx.rebuildPeerConfig(&d, true)
+			require.Equal(tc.expectedMethod, chosenMethod)
+			require.Empty(d.pathFallback)
+			require.Contains(d.pathReason, "against")
+		})
+	}
+
+	t.Run("did not come up", func(t *testing.T) {
+		require := require.New(t)
+		d := deviceCacheEntry{
+			device: public.ModelsDevice{
+				Endpoints: []public.ModelsEndpoint{
+					{Address: "192.168.10.50:5678", Source: "local"},
+					{Address: "2.2.2.2:4321", Source: "stun"},
+				},
+				PublicKey: "bacon",
+			},
+		}
+		nx.peeringReset(&d)
+		d.peeringMethod = peeringMethodViaRelay
+		d.peeringMethodIndex = pathMethodIndex(peeringMethodViaRelay)
+		d.pathProbeTime = time.Now().Add(-pathRetryInterval)
+		d.pathLatency = map[string]time.Duration{peeringMethodViaRelay: 40 * time.Millisecond}
+		_, chosenMethod, chosenIndex := nx.rebuildPeerConfig(&d, true)
+		require.Equal(peeringMethodReflexive, chosenMethod)
+
+		// the reflexive address never came up, peering walks back to the relay and the probe ends
+		d.peeringMethod = chosenMethod
+		d.peeringMethodIndex = chosenIndex
+		d.peeringTime = time.Now().Add(-peeringTimeout - time.Second)
+		_, chosenMethod, chosenIndex = nx.rebuildPeerConfig(&d, true)
+		require.Equal(peeringMethodViaRelay, chosenMethod)
+		require.Equal(nx.relayReason(d.device), d.pathReason)
+
+		d.peeringMethod = chosenMethod
+		d.peeringMethodIndex = chosenIndex
+		_, chosenMethod, _ = nx.rebuildPeerConfig(&d, true)
+		require.Equal(peeringMethodViaRelay, chosenMethod)
+		require.Empty(d.pathFallback)
+		require.WithinDuration(time.Now(), d.pathProbeTime, time.Minute)
+	})
+}
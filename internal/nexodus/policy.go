@@ -0,0 +1,52 @@
+package nexodus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+// ipProtocolNumbers maps the protocol names accepted in security rules to their IP protocol numbers
+var ipProtocolNumbers = map[string]uint8{
+	"icmp":   1,
+	"icmpv4": 1,
+	"tcp":    6,
+	"udp":    17,
+	"gre":    47,
+	"esp":    50,
+	"ah":     51,
+	"icmpv6": 58,
+	"sctp":   132,
+}
+
+// mssClampRule is the nftables rule that lowers the MSS option of forwarded TCP SYN packets to what fits the MTU of
+// the route they take, for the connections routed into the tunnel
+var mssClampRule = []string{"tcp", "flags", "&", "(syn|rst)", "==", "syn", "tcp", "option", "maxseg", "size", "set", "rt", "mtu"}
+
+// ipProtocolNumber returns the IP protocol number for a security rule protocol given either by name or by number.
+func ipProtocolNumber(protocol string) (uint8, bool) {
+	if number, ok := ipProtocolNumbers[protocol]; ok {
+		return number, true
+	}
+	number, err := strconv.ParseUint(protocol, 10, 8)
+	if err != nil {
+		return 0, false
+	}
+	return uint8(number), true
+}
+
+// ruleHasPorts returns true if the rule matches specific destination ports, either as a range or as a list.
+func ruleHasPorts(rule public.ModelsSecurityRule) bool {
+	return (rule.FromPort != 0 && rule.ToPort != 0) || len(rule.Ports) > 0
+}
+
+// joinRuleValues formats a list of rule values as a comma separated string, e.g. "22, 80, 443"
+func joinRuleValues(values []int32) string {
+	items := make([]string, len(values))
+	for i, value := range values {
+		items[i] = fmt.Sprintf("%d", value)
+	}
+	return strings.Join(items, ", ")
+}
@@ -168,11 +168,7 @@ func (prb *pfRuleBuilder) pfPermitProtoPortAddr(rule public.ModelsSecurityRule,
 		directionToken = "pass out"
 	}
 
-	if rule.FromPort == 0 && rule.ToPort == 0 {
-		portOption = ""
-	} else {
-		portOption = fmt.Sprintf("port %d:%d", rule.FromPort, rule.ToPort)
-	}
+	portOption = pfPortOption(rule)
 
 	ipRangesStr := strings.Join(rule.IpRanges, ", ")
 	// Ensure there are spaces around any dashes
@@ -202,14 +198,18 @@ func (prb *pfRuleBuilder) pfPermitProtoPortAddr(rule public.ModelsSecurityRule,
 	case "tcp", "udp":
 		prb.sb.WriteString(fmt.Sprintf("%s quick on %s %s proto %s %s %s\n", directionToken, prb.iface, inetType, protocol, ipDirection, portOption))
 	case "icmp4", "icmpv4":
-		prb.sb.WriteString(fmt.Sprintf("%s quick on %s inet proto icmp %s\n", directionToken, prb.iface, ipDirection))
+		prb.sb.WriteString(fmt.Sprintf("%s quick on %s inet proto icmp %s%s\n", directionToken, prb.iface, ipDirection, pfIcmpTypeOption(rule, "icmp-type")))
 	case "icmp6", "icmpv6":
-		prb.sb.WriteString(fmt.Sprintf("%s quick on %s inet6 proto icmp6 %s\n", directionToken, prb.iface, ipDirection))
+		prb.sb.WriteString(fmt.Sprintf("%s quick on %s inet6 proto icmp6 %s%s\n", directionToken, prb.iface, ipDirection, pfIcmpTypeOption(rule, "icmp6-type")))
 	case "icmp":
 		prb.sb.WriteString(fmt.Sprintf("%s quick on %s inet proto icmp to any\n", directionToken, prb.iface))
 		prb.sb.WriteString(fmt.Sprintf("%s quick on %s inet6 proto icmp6 to any\n", directionToken, prb.iface))
 	default:
-		return fmt.Errorf("no match for permit proto port/port/address rule: %v", rule)
+		// any other protocol given by name or number, e.g. gre, esp or 132, for both address families
+		if _, ok := ipProtocolNumber(protocol); !ok {
+			return fmt.Errorf("no match for permit proto port/port/address rule: %v", rule)
+		}
+		prb.sb.WriteString(fmt.Sprintf("%s quick on %s proto %s %s %s\n", directionToken, prb.iface, protocol, ipDirection, portOption))
 	}
 
 	return nil
@@ -225,11 +225,7 @@ func (prb *pfRuleBuilder) pfPermitProtoPortAnyAddr(rule public.ModelsSecurityRul
 		directionToken = "pass out"
 	}
 
-	if rule.FromPort == 0 && rule.ToPort == 0 {
-		portOption = ""
-	} else {
-		portOption = fmt.Sprintf("port %d:%d", rule.FromPort, rule.ToPort)
-	}
+	portOption = pfPortOption(rule)
 
 	ipDirection := "to any"
 	if direction == "inbound" {
@@ -255,19 +251,53 @@ func (prb *pfRuleBuilder) pfPermitProtoPortAnyAddr(rule public.ModelsSecurityRul
 			prb.sb.WriteString(fmt.Sprintf("%s quick on %s %s %s %s\n", directionToken, "utun8", inetType, ipDirection, portOption))
 		}
 	case "icmp4", "icmpv4":
-		prb.sb.WriteString(fmt.Sprintf("%s quick on %s %s proto icmp %s\n", directionToken, prb.iface, inetType, ipDirection))
+		prb.sb.WriteString(fmt.Sprintf("%s quick on %s %s proto icmp %s%s\n", directionToken, prb.iface, inetType, ipDirection, pfIcmpTypeOption(rule, "icmp-type")))
 	case "icmp6", "icmpv6":
-		prb.sb.WriteString(fmt.Sprintf("%s quick on %s %s proto icmp6 %s\n", directionToken, prb.iface, inetType, ipDirection))
+		prb.sb.WriteString(fmt.Sprintf("%s quick on %s %s proto icmp6 %s%s\n", directionToken, prb.iface, inetType, ipDirection, pfIcmpTypeOption(rule, "icmp6-type")))
 	case "icmp":
 		prb.sb.WriteString(fmt.Sprintf("%s quick on %s inet proto icmp %s\n", directionToken, prb.iface, ipDirection))
 		prb.sb.WriteString(fmt.Sprintf("%s quick on %s inet6 proto icmp6 %s\n", directionToken, prb.iface, ipDirection))
 	default:
-		return fmt.Errorf("no policy PF match for permit proto port any address rule: %v", rule)
+		// any other protocol given by name or number, e.g. gre, esp or 132, for both address families
+		if _, ok := ipProtocolNumber(protocol); !ok {
+			return fmt.Errorf("no policy PF match for permit proto port any address rule: %v", rule)
+		}
+		prb.sb.WriteString(fmt.Sprintf("%s quick on %s proto %s %s %s\n", directionToken, prb.iface, protocol, ipDirection, portOption))
 	}
 
 	return nil
 }
 
+// pfPortOption returns the pf destination port option of the rule, e.g. port 22:80 or port { 22, 443 }
+func pfPortOption(rule public.ModelsSecurityRule) string {
+	if len(rule.Ports) > 0 {
+		return fmt.Sprintf("port { %s }", joinRuleValues(rule.Ports))
+	}
+	if rule.FromPort == 0 && rule.ToPort == 0 {
+		return ""
+	}
+	return fmt.Sprintf("port %d:%d", rule.FromPort, rule.ToPort)
+}
+
+// pfIcmpTypeOption returns the pf ICMP type option of the rule, including a leading space,
+// e.g. " icmp-type { 8 code 0 }". The keyword is icmp-type for ICMPv4 and icmp6-type for ICMPv6.
+func pfIcmpTypeOption(rule public.ModelsSecurityRule, keyword string) string {
+	if len(rule.IcmpTypes) == 0 {
+		return ""
+	}
+	var items []string
+	for _, icmpType := range rule.IcmpTypes {
+		if len(rule.IcmpCodes) == 0 {
+			items = append(items, fmt.Sprintf("%d", icmpType))
+			continue
+		}
+		for _, icmpCode := range rule.IcmpCodes {
+			items = append(items, fmt.Sprintf("%d code %d", icmpType, icmpCode))
+		}
+	}
+	return fmt.Sprintf(" %s { %s }", keyword, strings.Join(items, ", "))
+}
+
 // copyFile Copy file from src to dst
 func copyFile(src, dst string) error {
 	input, err := os.ReadFile(src)
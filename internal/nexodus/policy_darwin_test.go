@@ -162,4 +162,33 @@ func TestDarwinRuleBuilder(t *testing.T) {
 	t.Run("Test with mockSecurityGroup1", func(t *testing.T) {
 		runTestPacketFilterRuleBuilder(t, mockSecurityGroup1, mockSecurityGroup1ExpectedRules)
 	})
+
+	mockSecurityGroup2 := `
+{
+	"group_name": "Test",
+	"inbound_rules": [
+		{"ip_protocol": "tcp", "ports": [22, 443], "ip_ranges": ["10.0.0.1"]},
+		{"ip_protocol": "icmpv4", "icmp_types": [8], "icmp_codes": [0]},
+		{"ip_protocol": "icmpv6", "icmp_types": [128, 129], "ip_ranges": ["200::/64"]},
+		{"ip_protocol": "gre"},
+		{"ip_protocol": "132", "ports": [3868]}
+	],
+	"outbound_rules": [
+		{"ip_protocol": "esp", "ip_ranges": ["192.168.0.1"]}
+	]
+}
+`
+
+	mockSecurityGroup2ExpectedRules := []string{
+		"pass in quick on utun8 inet proto tcp from { 10.0.0.1 } to any port { 22, 443 }",
+		"pass in quick on utun8 inet proto icmp from any to any icmp-type { 8 code 0 }",
+		"pass in quick on utun8 inet6 proto icmp6 from { 200::/64 } to any icmp6-type { 128, 129 }",
+		"pass in quick on utun8 proto gre from any to any",
+		"pass in quick on utun8 proto 132 from any to any port { 3868 }",
+		"pass out quick on utun8 proto esp to { 192.168.0.1 }",
+	}
+
+	t.Run("Test with mockSecurityGroup2", func(t *testing.T) {
+		runTestPacketFilterRuleBuilder(t, mockSecurityGroup2, mockSecurityGroup2ExpectedRules)
+	})
 }
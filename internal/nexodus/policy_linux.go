@@ -106,7 +106,7 @@ func (nx *Nexodus) processSecurityGroupRules() error {
 			if err := nx.nfPermitProtoPortAddrV6(ingressChain, rule); err != nil {
 				return fmt.Errorf("nftables setup error, failed to process inbound v6 rule: %w", err)
 			}
-		} else if rule.FromPort != 0 && rule.ToPort != 0 {
+		} else if ruleHasPorts(rule) {
 			// if the rule is L4 port(s) range with no l3 addresses
 			if err := nx.nfPermitProtoPort(ingressChain, rule); err != nil {
 				return fmt.Errorf("nftables setup error, failed to process inbound destination port rule: %w", err)
@@ -134,7 +134,7 @@ func (nx *Nexodus) processSecurityGroupRules() error {
 			if err := nx.nfPermitProtoPortAddrV6(egressChain, rule); err != nil {
 				return fmt.Errorf("nftables setup error, failed to process outbound v6 rule: %w", err)
 			}
-		} else if rule.FromPort != 0 && rule.ToPort != 0 {
+		} else if ruleHasPorts(rule) {
 			// if the rule is L4 port(s) range with no l3 addresses
 			if err := nx.nfPermitProtoPort(egressChain, rule); err != nil {
 				return fmt.Errorf("nftables setup error, failed to process inbound destination port rule: %w", err)
@@ -191,7 +191,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV4(chain string, rule public.ModelsSecur
 	switch rule.IpProtocol {
 	case protoIPv4:
 		// if the specified proto is ipv4 that specifies an L3 address and does not specify ports.
-		if rule.FromPort == 0 && rule.ToPort == 0 {
+		if !ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstOption := fmt.Sprintf("ip %s %s", srcOrDst, ipRange)
 				// v4 permits for L3 src or dst
@@ -200,14 +200,13 @@ func (nx *Nexodus) nfPermitProtoPortAddrV4(chain string, rule public.ModelsSecur
 					return err
 				}
 			}
-		} else if rule.FromPort != 0 && rule.ToPort != 0 {
+		} else if ruleHasPorts(rule) {
 			// if the specified proto is ipv4 that specifies an L3 address and does specify ports.
-			ports := fmt.Sprintf("%d-%d", rule.FromPort, rule.ToPort)
 			if len(rule.IpRanges) > 0 {
 				for _, ipRange := range rule.IpRanges {
 					srcOrDstOption := fmt.Sprintf("ip %s %s", srcOrDst, ipRange)
 					// v4 permits for L3 src or dst with specific ports
-					nft := []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, srcOrDstOption, "th", "dport", ports, ruleInterface, counter, actionAccept}
+					nft := []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, srcOrDstOption, "th", dportOption, ruleInterface, counter, actionAccept}
 					if _, err := policyCmd(nx.logger, nft); err != nil {
 						return err
 					}
@@ -216,7 +215,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV4(chain string, rule public.ModelsSecur
 		}
 	case protoTCP:
 		// permit ipv4 tcp to src/dst L3 to any destination port
-		if rule.FromPort == 0 && rule.ToPort == 0 {
+		if !ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstOption := fmt.Sprintf("ip %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, srcOrDstOption, protoTCP, destPort, "0-65535", ruleInterface, "counter", actionAccept}
@@ -226,7 +225,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV4(chain string, rule public.ModelsSecur
 			}
 		}
 		// permit ipv4 tcp to L3 src/dst to specified destination port or port range
-		if rule.FromPort != 0 && rule.ToPort != 0 {
+		if ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstOption := fmt.Sprintf("ip %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, srcOrDstOption, protoTCP, dportOption, ruleInterface, "counter", actionAccept}
@@ -237,7 +236,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV4(chain string, rule public.ModelsSecur
 		}
 	case protoUDP:
 		// permit ipv4 udp to src/dst L3 to any destination port
-		if rule.FromPort == 0 && rule.ToPort == 0 {
+		if !ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstOption := fmt.Sprintf("ip %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, srcOrDstOption, protoUDP, destPort, "0-65535", ruleInterface, "counter", actionAccept}
@@ -247,7 +246,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV4(chain string, rule public.ModelsSecur
 			}
 		}
 		// permit ipv4 udp to L3 src/dst to specified destination port or port range
-		if rule.FromPort != 0 && rule.ToPort != 0 {
+		if ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstOption := fmt.Sprintf("ip %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, srcOrDstOption, rule.IpProtocol, dportOption, ruleInterface, "counter", actionAccept}
@@ -260,14 +259,26 @@ func (nx *Nexodus) nfPermitProtoPortAddrV4(chain string, rule public.ModelsSecur
 		// icmpv4 permits to L3 src or dst
 		for _, ipRange := range rule.IpRanges {
 			srcOrDstOption := fmt.Sprintf("ip %s %s", srcOrDst, ipRange)
-			nft = []string{"insert", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, "ip", "protocol", protoICMP, srcOrDstOption, ruleInterface, counter, actionAccept}
+			nft = []string{"insert", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, nftIcmpOption(rule, protoIPv4), srcOrDstOption, ruleInterface, counter, actionAccept}
 			if _, err := policyCmd(nx.logger, nft); err != nil {
 				return err
 			}
 		}
 	default:
-		nx.logger.Debugf("no match for permit proto dport rule: %v", rule)
-		return nil
+		// permit ipv4 traffic of any other protocol, given by name or number, to L3 src/dst with optional destination ports
+		if _, ok := ipProtocolNumber(rule.IpProtocol); !ok {
+			nx.logger.Debugf("no match for permit proto dport rule: %v", rule)
+			return nil
+		}
+		for _, ipRange := range rule.IpRanges {
+			srcOrDstOption := fmt.Sprintf("ip %s %s", srcOrDst, ipRange)
+			nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, srcOrDstOption}
+			nft = append(nft, nx.nftL4ProtoOptions(rule)...)
+			nft = append(nft, ruleInterface, counter, actionAccept)
+			if _, err := policyCmd(nx.logger, nft); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -294,7 +305,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV6(chain string, rule public.ModelsSecur
 	case protoIPv6:
 		// nft add rule inet nexodus nexodus-outbound meta nfproto ipv6 ip6 daddr 2001:4860:4860::8888-2001:4860:4860::8889  iifname "wg0" accept
 		// ipv6 that specifies an L3 src/dst and does not specify ports.
-		if rule.FromPort == 0 && rule.ToPort == 0 {
+		if !ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstIpAddrOption := fmt.Sprintf("ip6 %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, srcOrDstIpAddrOption, ruleInterface, counter, actionAccept}
@@ -302,14 +313,13 @@ func (nx *Nexodus) nfPermitProtoPortAddrV6(chain string, rule public.ModelsSecur
 					return err
 				}
 			}
-		} else if rule.FromPort > 0 && rule.ToPort > 0 {
+		} else if ruleHasPorts(rule) {
 			// ipv6 that specifies an L3 src/dst and specifies ports.
-			ports := fmt.Sprintf("%d-%d", rule.FromPort, rule.ToPort)
 			if len(rule.IpRanges) > 0 {
 				for _, ipRange := range rule.IpRanges {
 					srcOrDstIpAddrOption := fmt.Sprintf("ip6 %s %s", srcOrDst, ipRange)
 					// IPv6 permits for L3 with specified ports
-					nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, srcOrDstIpAddrOption, "th", "dport", ports, ruleInterface, counter, actionAccept}
+					nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, srcOrDstIpAddrOption, "th", dportOption, ruleInterface, counter, actionAccept}
 					if _, err := policyCmd(nx.logger, nft); err != nil {
 						return err
 					}
@@ -318,7 +328,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV6(chain string, rule public.ModelsSecur
 		}
 	case protoTCP:
 		// permit ipv4 tcp to src/dst L3 to any destination port
-		if rule.FromPort == 0 && rule.ToPort == 0 {
+		if !ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstOption := fmt.Sprintf("ip6 %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, srcOrDstOption, protoTCP, destPort, "0-65535", ruleInterface, "counter", actionAccept}
@@ -328,7 +338,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV6(chain string, rule public.ModelsSecur
 			}
 		}
 		// permit ipv6 udp to L3 src/dst to specified destination port or port range
-		if rule.FromPort != 0 && rule.ToPort != 0 {
+		if ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstIpAddrOption := fmt.Sprintf("ip6 %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, srcOrDstIpAddrOption, rule.IpProtocol, dportOption, ruleInterface, "counter", actionAccept}
@@ -339,7 +349,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV6(chain string, rule public.ModelsSecur
 		}
 	case protoUDP:
 		// permit ipv4 udp to src/dst L3 to any destination port
-		if rule.FromPort == 0 && rule.ToPort == 0 {
+		if !ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstOption := fmt.Sprintf("ip6 %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, srcOrDstOption, protoUDP, destPort, "0-65535", ruleInterface, "counter", actionAccept}
@@ -349,7 +359,7 @@ func (nx *Nexodus) nfPermitProtoPortAddrV6(chain string, rule public.ModelsSecur
 			}
 		}
 		// permit ipv4 udp to L3 src/dst to specified destination port or port range
-		if rule.FromPort != 0 && rule.ToPort != 0 {
+		if ruleHasPorts(rule) {
 			for _, ipRange := range rule.IpRanges {
 				srcOrDstIpAddrOption := fmt.Sprintf("ip6 %s %s", srcOrDst, ipRange)
 				nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, srcOrDstIpAddrOption, protoUDP, dportOption, ruleInterface, "counter", actionAccept}
@@ -362,14 +372,26 @@ func (nx *Nexodus) nfPermitProtoPortAddrV6(chain string, rule public.ModelsSecur
 		// icmpv4 permits to L3 src or dst
 		for _, ipRange := range rule.IpRanges {
 			srcOrDstIpAddrOption := fmt.Sprintf("ip6 %s %s", srcOrDst, ipRange)
-			nft = []string{"insert", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, "ip6", "nexthdr", "ipv6-icmp", srcOrDstIpAddrOption, ruleInterface, counter, actionAccept}
+			nft = []string{"insert", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, nftIcmpOption(rule, protoIPv6), srcOrDstIpAddrOption, ruleInterface, counter, actionAccept}
 			if _, err := policyCmd(nx.logger, nft); err != nil {
 				return err
 			}
 		}
 	default:
-		nx.logger.Debugf("no match for permit proto dport rule: %v", rule)
-		return nil
+		// permit ipv6 traffic of any other protocol, given by name or number, to L3 src/dst with optional destination ports
+		if _, ok := ipProtocolNumber(rule.IpProtocol); !ok {
+			nx.logger.Debugf("no match for permit proto dport rule: %v", rule)
+			return nil
+		}
+		for _, ipRange := range rule.IpRanges {
+			srcOrDstIpAddrOption := fmt.Sprintf("ip6 %s %s", srcOrDst, ipRange)
+			nft = []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, srcOrDstIpAddrOption}
+			nft = append(nft, nx.nftL4ProtoOptions(rule)...)
+			nft = append(nft, ruleInterface, counter, actionAccept)
+			if _, err := policyCmd(nx.logger, nft); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -426,8 +448,14 @@ func (nx *Nexodus) nfPermitProtoPort(chain string, rule public.ModelsSecurityRul
 			return err
 		}
 	default:
-		nx.logger.Debugf("no match for permit proto dport rule: %v", rule)
-		return nil
+		// if the specified proto is any other protocol with ports, e.g. sctp, add rules for both ipv4 and ipv6
+		if _, ok := ipProtocolNumber(rule.IpProtocol); !ok {
+			nx.logger.Debugf("no match for permit proto dport rule: %v", rule)
+			return nil
+		}
+		if err := nx.nfPermitL4ProtoAnyAddr(chain, rule); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -460,7 +488,7 @@ func (nx *Nexodus) nfPermitProtoAny(chain string, rule public.ModelsSecurityRule
 	case "icmp", protoICMPv4, protoICMPv6:
 		// permit icmpv4 any
 		if rule.IpProtocol == protoICMPv4 || rule.IpProtocol == "icmp" {
-			nft = []string{"insert", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, "ip", "protocol", protoICMP, ruleInterface, counter, actionAccept}
+			nft = []string{"insert", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv4, nftIcmpOption(rule, protoIPv4), ruleInterface, counter, actionAccept}
 			if _, err := policyCmd(nx.logger, nft); err != nil {
 				return err
 			}
@@ -468,7 +496,7 @@ func (nx *Nexodus) nfPermitProtoAny(chain string, rule public.ModelsSecurityRule
 		// permit icmpv6 any
 		if rule.IpProtocol == protoICMPv6 {
 			// ip6 nexthdr is used instead of ip6 protocol for IPv6, because the protocol field is not directly in the IPv6 header.
-			nft = []string{"insert", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, "ip6", "nexthdr", "ipv6-icmp", ruleInterface, counter, actionAccept}
+			nft = []string{"insert", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", protoIPv6, nftIcmpOption(rule, protoIPv6), ruleInterface, counter, actionAccept}
 			if _, err := policyCmd(nx.logger, nft); err != nil {
 				return err
 			}
@@ -485,19 +513,76 @@ func (nx *Nexodus) nfPermitProtoAny(chain string, rule public.ModelsSecurityRule
 			return err
 		}
 	default:
-		nx.logger.Debugf("no match for permit proto any dport rule: %v", rule)
-		return nil
+		// permit ip/ip6 traffic of any other protocol given by name or number, e.g. gre, esp or 47
+		if _, ok := ipProtocolNumber(rule.IpProtocol); !ok {
+			nx.logger.Debugf("no match for permit proto any dport rule: %v", rule)
+			return nil
+		}
+		if err := nx.nfPermitL4ProtoAnyAddr(chain, rule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nfPermitL4ProtoAnyAddr creates nftables rules for both address families that permit a protocol given by name or
+// number, with optional destination ports. Example Rules handled by this method:
+// nft add rule inet nexodus nexodus-inbound meta nfproto ipv4 meta l4proto gre iifname "wg0" counter accept
+// nft add rule inet nexodus nexodus-inbound meta nfproto ipv6 meta l4proto 132 th dport { 80, 443 } iifname "wg0" counter accept
+func (nx *Nexodus) nfPermitL4ProtoAnyAddr(chain string, rule public.ModelsSecurityRule) error {
+	for _, family := range []string{protoIPv4, protoIPv6} {
+		nft := []string{"add", "rule", tableFamily, sgTableName, chain, "meta", "nfproto", family}
+		nft = append(nft, nx.nftL4ProtoOptions(rule)...)
+		nft = append(nft, ruleInterface, counter, actionAccept)
+		if _, err := policyCmd(nx.logger, nft); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// nftL4ProtoOptions returns the nftables options matching the protocol of the rule by name or number, along with
+// the destination ports of the rule if it has any, e.g. meta l4proto sctp th dport 80
+func (nx *Nexodus) nftL4ProtoOptions(rule public.ModelsSecurityRule) []string {
+	options := []string{"meta", "l4proto", rule.IpProtocol}
+	if ruleHasPorts(rule) {
+		options = append(options, "th", nx.nftPortOption(rule))
+	}
+	return options
+}
+
+// nftIcmpOption returns the nftables ICMP match of the rule for the ipv4 or ipv6 family. If the rule lists ICMP
+// types and codes only those are matched. Example options returned by this method:
+// ip protocol icmp
+// icmp type { 8 } icmp code { 0 }
+// icmpv6 type { 128, 129 }
+func nftIcmpOption(rule public.ModelsSecurityRule, family string) string {
+	icmpKeyword := "icmp"
+	option := "ip protocol icmp"
+	if family == protoIPv6 {
+		icmpKeyword = "icmpv6"
+		option = "ip6 nexthdr ipv6-icmp"
+	}
+	if len(rule.IcmpTypes) == 0 {
+		return option
+	}
+	option = fmt.Sprintf("%s type { %s }", icmpKeyword, joinRuleValues(rule.IcmpTypes))
+	if len(rule.IcmpCodes) > 0 {
+		option += fmt.Sprintf(" %s code { %s }", icmpKeyword, joinRuleValues(rule.IcmpCodes))
+	}
+	return option
+}
+
 // nftPortOption returns the nftables port option for the specified rule.
 func (nx *Nexodus) nftPortOption(rule public.ModelsSecurityRule) string {
 	var portOption string
 	var portRange string
 
-	if rule.FromPort == 0 && rule.ToPort == 0 {
+	if len(rule.Ports) > 0 {
+		portRange = fmt.Sprintf("{ %s }", joinRuleValues(rule.Ports))
+	} else if !ruleHasPorts(rule) {
 		portRange = fmt.Sprintf("%d-%d", 0, 65535)
 	} else if rule.FromPort == rule.ToPort {
 		portRange = fmt.Sprintf("%d", rule.FromPort)
@@ -646,6 +731,13 @@ func (nx *Nexodus) networkRouterSetup() error {
 		return fmt.Errorf("nftables setup error, failed to create network router nftables chain %s: %w", chainTypeFilter, err)
 	}
 
+	// Clamp the TCP MSS of the routed connections to the MTU of the route they take, the tunnel has a lower MTU than
+	// the networks behind the router and its path MTU may be lower still
+	nft := append([]string{"add", "rule", tableFamily, rtrTableName, chainForward}, mssClampRule...)
+	if _, err := policyCmd(nx.logger, nft); err != nil {
+		return err
+	}
+
 	// Create the forwarding rule with a prefix and oifname interface for each destination prefix
 	for prefix, iface := range nx.netRouterInterfaceMap {
 		nx.logger.Debugf("Adding nftables forwarding rule for prefix: %s on interface: %s", prefix, iface.Name)
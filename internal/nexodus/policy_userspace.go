@@ -0,0 +1,622 @@
+package nexodus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"golang.org/x/exp/slices"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// usFlowTimeout is how long a flow that has not seen any packets is remembered by the userspace packet filter
+const usFlowTimeout = 5 * time.Minute
+
+// usPacketFilter enforces the security group rules in userspace mode, where neither nftables nor pf are
+// available. It wraps the netstack tun device, packets read from the device are leaving the node and are
+// checked against the outbound rules, packets written to the device are arriving from peers and are checked
+// against the inbound rules. Like the kernel firewalls the filter is stateful, packets of a flow that was
+// permitted in either direction are permitted in both directions.
+//
+// For on-demand peering the filter can also record when it last permitted a packet to or from each remote address.
+type usPacketFilter struct {
+	tun.Device
+	mu        sync.Mutex
+	inbound   []usFilterRule
+	outbound  []usFilterRule
+	flows     map[usFlowKey]time.Time
+	lastPrune time.Time
+	// activity is nil unless the remote addresses are being recorded
+	activity map[netip.Addr]time.Time
+	// the path MTU the packets through the tunnel are held to, 0 when not limited
+	mtu atomic.Int32
+}
+
+// usFilterRule is a security rule compiled for matching packets
+type usFilterRule struct {
+	// family limits the rule to ipv4 (4) or ipv6 (6) packets, 0 matches both
+	family    int
+	protocols []uint8
+	addrs     []usAddrRange
+	ports     []usPortRange
+	icmpTypes []uint8
+	icmpCodes []uint8
+}
+
+type usAddrRange struct {
+	from, to netip.Addr
+}
+
+type usPortRange struct {
+	from, to uint16
+}
+
+type usFlowKey struct {
+	protocol      uint8
+	local, remote netip.AddrPort
+}
+
+// usPacket holds the fields of an IP packet used for filtering
+type usPacket struct {
+	family   int
+	protocol uint8
+	src, dst netip.Addr
+	// hasPorts is set for tcp, udp and sctp packets that carry their transport header
+	hasPorts         bool
+	srcPort, dstPort uint16
+	// isICMP is set for icmp and icmpv6 packets that carry their ICMP header
+	isICMP             bool
+	icmpType, icmpCode uint8
+}
+
+func newUsPacketFilter(device tun.Device) *usPacketFilter {
+	return &usPacketFilter{
+		Device: device,
+		flows:  map[usFlowKey]time.Time{},
+	}
+}
+
+// setRules replaces the rules of the filter. A direction without any rules permits all traffic.
+// Rules that can not be compiled are skipped and reported in the returned error.
+func (f *usPacketFilter) setRules(inboundRules, outboundRules []public.ModelsSecurityRule) error {
+	inbound, inboundErr := newUsFilterRules(inboundRules)
+	outbound, outboundErr := newUsFilterRules(outboundRules)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inbound = inbound
+	f.outbound = outbound
+	f.flows = map[usFlowKey]time.Time{}
+
+	return errors.Join(inboundErr, outboundErr)
+}
+
+// trackActivity enables or disables recording the remote addresses of the permitted packets.
+func (f *usPacketFilter) trackActivity(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !enabled {
+		f.activity = nil
+	} else if f.activity == nil {
+		f.activity = map[netip.Addr]time.Time{}
+	}
+}
+
+// activeAddrs returns the remote addresses packets were exchanged with within the idle timeout, older ones are forgotten.
+func (f *usPacketFilter) activeAddrs(idleTimeout time.Duration) []netip.Addr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result []netip.Addr
+	now := time.Now()
+	for addr, lastSeen := range f.activity {
+		if now.Sub(lastSeen) >= idleTimeout {
+			delete(f.activity, addr)
+			continue
+		}
+		result = append(result, addr)
+	}
+	return result
+}
+
+// setMTU holds the packets through the tunnel to a path MTU lower than the one netstack was created with, which it can
+// not change. The TCP MSS of the connections is clamped to fit it, and netstack is told about it with an ICMP error
+// for every larger packet it sends, the same as a router on the path would.
+func (f *usPacketFilter) setMTU(mtu int) {
+	f.mtu.Store(int32(mtu))
+}
+
+// Read reads packets leaving the node from the tunnel device and drops the ones the outbound rules do not permit.
+func (f *usPacketFilter) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	mtu := int(f.mtu.Load())
+	for {
+		n, err := f.Device.Read(bufs, sizes, offset)
+		kept := 0
+		for i := 0; i < n; i++ {
+			if !f.allow(bufs[i][offset:offset+sizes[i]], false) {
+				continue
+			}
+			if mtu != 0 {
+				clampTCPMSS(bufs[i][offset:offset+sizes[i]], mtu)
+				if sizes[i] > mtu {
+					if reply := packetTooBig(bufs[i][offset:offset+sizes[i]], mtu); reply != nil {
+						if _, err := f.Device.Write([][]byte{reply}, 0); err != nil {
+							return kept, err
+						}
+						continue
+					}
+				}
+			}
+			if kept != i {
+				copy(bufs[kept][offset:], bufs[i][offset:offset+sizes[i]])
+				sizes[kept] = sizes[i]
+			}
+			kept++
+		}
+		// keep reading if every packet was dropped, the caller expects at least one packet on success
+		if kept > 0 || n == 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// Write writes the packets arriving from peers that the inbound rules permit to the tunnel device.
+func (f *usPacketFilter) Write(bufs [][]byte, offset int) (int, error) {
+	mtu := int(f.mtu.Load())
+	allowed := make([][]byte, 0, len(bufs))
+	for _, buf := range bufs {
+		if f.allow(buf[offset:], true) {
+			if mtu != 0 {
+				clampTCPMSS(buf[offset:], mtu)
+			}
+			allowed = append(allowed, buf)
+		}
+	}
+	if len(allowed) > 0 {
+		if _, err := f.Device.Write(allowed, offset); err != nil {
+			return 0, err
+		}
+	}
+	// dropped packets are reported as written, the same as a firewall silently dropping them
+	return len(bufs), nil
+}
+
+// allow checks a packet against the rules of its direction and tracks the flows of permitted packets.
+func (f *usPacketFilter) allow(packet []byte, inbound bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.inbound) == 0 && len(f.outbound) == 0 && f.activity == nil {
+		return true
+	}
+
+	rules := f.outbound
+	if inbound {
+		rules = f.inbound
+	}
+
+	p, ok := parseUsPacket(packet)
+	if !ok {
+		return len(rules) == 0
+	}
+
+	key := usFlowKey{
+		protocol: p.protocol,
+		local:    netip.AddrPortFrom(p.src, p.srcPort),
+		remote:   netip.AddrPortFrom(p.dst, p.dstPort),
+	}
+	remoteAddr := p.dst
+	if inbound {
+		key.local, key.remote = key.remote, key.local
+		remoteAddr = p.src
+	}
+
+	now := time.Now()
+	permitted := len(rules) == 0
+	if !permitted {
+		if lastSeen, found := f.flows[key]; found && now.Sub(lastSeen) < usFlowTimeout {
+			permitted = true
+		}
+	}
+	if !permitted {
+		for i := range rules {
+			if rules[i].matches(p, remoteAddr) {
+				permitted = true
+				break
+			}
+		}
+	}
+	if !permitted {
+		return false
+	}
+	if f.activity != nil {
+		f.activity[remoteAddr] = now
+	}
+
+	f.flows[key] = now
+	if now.Sub(f.lastPrune) > usFlowTimeout {
+		for k, lastSeen := range f.flows {
+			if now.Sub(lastSeen) >= usFlowTimeout {
+				delete(f.flows, k)
+			}
+		}
+		f.lastPrune = now
+	}
+	return true
+}
+
+// clampTCPMSS lowers the MSS option of a TCP SYN packet to what fits the MTU, the same as the MSS clamping rules of
+// the kernel firewalls, so that both ends of the connection send segments that get through the tunnel whole.
+func clampTCPMSS(packet []byte, mtu int) {
+	var tcp []byte
+	var maxMSS int
+	switch {
+	case len(packet) >= 20 && packet[0]>>4 == 4:
+		headerLen := int(packet[0]&0x0f) * 4
+		// only the first fragment carries the TCP header
+		if packet[9] != ipProtocolNumbers["tcp"] || headerLen < 20 || headerLen > len(packet) ||
+			binary.BigEndian.Uint16(packet[6:8])&0x1fff != 0 {
+			return
+		}
+		tcp = packet[headerLen:]
+		maxMSS = mtu - 40
+	case len(packet) >= 40 && packet[0]>>4 == 6:
+		// SYN packets with extension headers are rare enough to be left alone
+		if packet[6] != ipProtocolNumbers["tcp"] {
+			return
+		}
+		tcp = packet[40:]
+		maxMSS = mtu - 60
+	default:
+		return
+	}
+	if len(tcp) < 20 || tcp[13]&0x02 == 0 {
+		return
+	}
+	dataOffset := int(tcp[12]>>4) * 4
+	if dataOffset < 20 || dataOffset > len(tcp) {
+		return
+	}
+	options := tcp[20:dataOffset]
+	for i := 0; i < len(options); {
+		switch options[i] {
+		case 0: // end of options
+			return
+		case 1: // no-op
+			i++
+			continue
+		}
+		if i+1 >= len(options) || options[i+1] < 2 || i+int(options[i+1]) > len(options) {
+			return
+		}
+		if options[i] == 2 && options[i+1] == 4 { // maximum segment size
+			mss := binary.BigEndian.Uint16(options[i+2:])
+			if int(mss) > maxMSS {
+				binary.BigEndian.PutUint16(options[i+2:], uint16(maxMSS))
+				checksum := binary.BigEndian.Uint16(tcp[16:18])
+				binary.BigEndian.PutUint16(tcp[16:18], checksumAdjust(checksum, mss, uint16(maxMSS)))
+			}
+			return
+		}
+		i += int(options[i+1])
+	}
+}
+
+// packetTooBig returns the ICMP error a router answers a packet larger than the MTU of its next hop with: an ICMPv6
+// packet too big, or an ICMP fragmentation needed for IPv4 packets that may not be fragmented. It returns nil for the
+// packets that routers fragment instead. The error comes from the destination of the packet and quotes as much of it
+// as ICMP allows, see RFC 792, RFC 1191 and RFC 4443.
+func packetTooBig(packet []byte, mtu int) []byte {
+	switch {
+	case len(packet) >= 20 && packet[0]>>4 == 4:
+		headerLen := int(packet[0]&0x0f) * 4
+		// only the packets with the don't fragment flag are dropped, ICMP errors are never answered with another
+		if headerLen < 20 || headerLen > len(packet) || packet[6]&0x40 == 0 ||
+			(packet[9] == ipProtocolNumbers["icmp"] && len(packet) > headerLen && icmpv4IsError(packet[headerLen])) {
+			return nil
+		}
+		quoted := packet
+		if len(quoted) > headerLen+8 {
+			quoted = quoted[:headerLen+8]
+		}
+		reply := make([]byte, 20+8+len(quoted))
+		reply[0] = 0x45
+		binary.BigEndian.PutUint16(reply[2:4], uint16(len(reply)))
+		reply[8] = 64
+		reply[9] = ipProtocolNumbers["icmp"]
+		copy(reply[12:16], packet[16:20])
+		copy(reply[16:20], packet[12:16])
+		binary.BigEndian.PutUint16(reply[10:12], cksum(reply[:20]))
+		icmp := reply[20:]
+		icmp[0] = 3 // destination unreachable
+		icmp[1] = 4 // fragmentation needed
+		binary.BigEndian.PutUint16(icmp[6:8], uint16(mtu))
+		copy(icmp[8:], quoted)
+		binary.BigEndian.PutUint16(icmp[2:4], cksum(icmp))
+		return reply
+	case len(packet) >= 40 && packet[0]>>4 == 6:
+		if packet[6] == ipProtocolNumbers["icmpv6"] && len(packet) > 40 && packet[40] < 128 {
+			return nil
+		}
+		// the error may not be larger than the minimum IPv6 MTU
+		quoted := packet
+		if len(quoted) > minMTU-40-8 {
+			quoted = quoted[:minMTU-40-8]
+		}
+		reply := make([]byte, 40+8+len(quoted))
+		reply[0] = 0x60
+		binary.BigEndian.PutUint16(reply[4:6], uint16(8+len(quoted)))
+		reply[6] = ipProtocolNumbers["icmpv6"]
+		reply[7] = 64
+		copy(reply[8:24], packet[24:40])
+		copy(reply[24:40], packet[8:24])
+		icmp := reply[40:]
+		icmp[0] = 2 // packet too big
+		binary.BigEndian.PutUint32(icmp[4:8], uint32(mtu))
+		copy(icmp[8:], quoted)
+		// the checksum covers the pseudo header of the addresses, the length and the next header
+		pseudo := make([]byte, 40, 40+len(icmp))
+		copy(pseudo[:32], reply[8:40])
+		binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(icmp)))
+		pseudo[39] = ipProtocolNumbers["icmpv6"]
+		binary.BigEndian.PutUint16(icmp[2:4], cksum(append(pseudo, icmp...)))
+		return reply
+	}
+	return nil
+}
+
+// icmpv4IsError returns true for the ICMP types that report an error about another packet.
+func icmpv4IsError(icmpType uint8) bool {
+	switch icmpType {
+	case 3, 4, 5, 11, 12: // destination unreachable, source quench, redirect, time exceeded, parameter problem
+		return true
+	}
+	return false
+}
+
+// checksumAdjust updates an internet checksum for a 16-bit word of the checksummed data changing, see RFC 1624.
+func checksumAdjust(checksum, old, new uint16) uint16 {
+	sum := uint32(^checksum) + uint32(^old) + uint32(new)
+	sum = (sum >> 16) + (sum & 0xffff)
+	sum = (sum >> 16) + (sum & 0xffff)
+	return ^uint16(sum)
+}
+
+// matches returns true if the packet is permitted by the rule, addr is the address of the remote side.
+func (r *usFilterRule) matches(p usPacket, addr netip.Addr) bool {
+	if r.family != 0 && r.family != p.family {
+		return false
+	}
+	if len(r.protocols) > 0 && !slices.Contains(r.protocols, p.protocol) {
+		return false
+	}
+	if len(r.ports) > 0 {
+		if !p.hasPorts {
+			return false
+		}
+		portMatch := false
+		for _, ports := range r.ports {
+			if p.dstPort >= ports.from && p.dstPort <= ports.to {
+				portMatch = true
+				break
+			}
+		}
+		if !portMatch {
+			return false
+		}
+	}
+	if len(r.icmpTypes) > 0 {
+		if !p.isICMP || !slices.Contains(r.icmpTypes, p.icmpType) {
+			return false
+		}
+		if len(r.icmpCodes) > 0 && !slices.Contains(r.icmpCodes, p.icmpCode) {
+			return false
+		}
+	}
+	if len(r.addrs) > 0 {
+		for _, addrs := range r.addrs {
+			if addr.Compare(addrs.from) >= 0 && addr.Compare(addrs.to) <= 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// newUsFilterRules compiles security rules for the userspace packet filter, following the same protocol
+// semantics as the nftables rules: ipv4 and ipv6 rules with ports apply to both tcp and udp.
+func newUsFilterRules(rules []public.ModelsSecurityRule) ([]usFilterRule, error) {
+	var result []usFilterRule
+	var errs []error
+	for _, rule := range rules {
+		r := usFilterRule{}
+		switch rule.IpProtocol {
+		case "", "ipv4", "ipv6":
+			if rule.IpProtocol == "ipv4" {
+				r.family = 4
+			} else if rule.IpProtocol == "ipv6" {
+				r.family = 6
+			}
+			if ruleHasPorts(rule) {
+				r.protocols = []uint8{ipProtocolNumbers["tcp"], ipProtocolNumbers["udp"]}
+			}
+		case "icmp":
+			r.protocols = []uint8{ipProtocolNumbers["icmpv4"], ipProtocolNumbers["icmpv6"]}
+		default:
+			number, ok := ipProtocolNumber(rule.IpProtocol)
+			if !ok {
+				errs = append(errs, fmt.Errorf("unsupported protocol in security rule: %v", rule))
+				continue
+			}
+			r.protocols = []uint8{number}
+		}
+
+		if len(rule.Ports) > 0 {
+			for _, port := range rule.Ports {
+				r.ports = append(r.ports, usPortRange{from: uint16(port), to: uint16(port)})
+			}
+		} else if rule.FromPort != 0 && rule.ToPort != 0 {
+			r.ports = append(r.ports, usPortRange{from: uint16(rule.FromPort), to: uint16(rule.ToPort)})
+		}
+		for _, icmpType := range rule.IcmpTypes {
+			r.icmpTypes = append(r.icmpTypes, uint8(icmpType))
+		}
+		for _, icmpCode := range rule.IcmpCodes {
+			r.icmpCodes = append(r.icmpCodes, uint8(icmpCode))
+		}
+
+		addrs, err := parseUsAddrRanges(rule.IpRanges)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid ip range in security rule %v: %w", rule, err))
+			continue
+		}
+		r.addrs = addrs
+
+		result = append(result, r)
+	}
+	return result, errors.Join(errs...)
+}
+
+// parseUsAddrRanges parses the ip ranges of a security rule, returning nil if the rule applies to any address.
+func parseUsAddrRanges(ipRanges []string) ([]usAddrRange, error) {
+	var result []usAddrRange
+	for _, ipRange := range ipRanges {
+		ipRange = strings.TrimSpace(ipRange)
+		switch {
+		case ipRange == "":
+			// an empty range is a wildcard
+			return nil, nil
+		case strings.Contains(ipRange, "-"):
+			from, to, _ := strings.Cut(ipRange, "-")
+			fromAddr, err := netip.ParseAddr(strings.TrimSpace(from))
+			if err != nil {
+				return nil, err
+			}
+			toAddr, err := netip.ParseAddr(strings.TrimSpace(to))
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, usAddrRange{from: fromAddr.Unmap(), to: toAddr.Unmap()})
+		case strings.Contains(ipRange, "/"):
+			prefix, err := netip.ParsePrefix(ipRange)
+			if err != nil {
+				return nil, err
+			}
+			prefix = prefix.Masked()
+			result = append(result, usAddrRange{from: prefix.Addr(), to: prefixLastAddr(prefix)})
+		default:
+			addr, err := netip.ParseAddr(ipRange)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, usAddrRange{from: addr.Unmap(), to: addr.Unmap()})
+		}
+	}
+	return result, nil
+}
+
+// prefixLastAddr returns the last address contained in the prefix
+func prefixLastAddr(prefix netip.Prefix) netip.Addr {
+	if prefix.Addr().Is4() {
+		a := prefix.Addr().As4()
+		v := binary.BigEndian.Uint32(a[:]) | (uint32(1)<<(32-prefix.Bits()) - 1)
+		binary.BigEndian.PutUint32(a[:], v)
+		return netip.AddrFrom4(a)
+	}
+	a := prefix.Addr().As16()
+	for i := prefix.Bits(); i < 128; i++ {
+		a[i/8] |= 1 << (7 - i%8)
+	}
+	return netip.AddrFrom16(a)
+}
+
+// parseUsPacket parses the IP and transport header fields of a packet used for filtering
+func parseUsPacket(packet []byte) (usPacket, bool) {
+	var p usPacket
+	var payload []byte
+	if len(packet) < 1 {
+		return p, false
+	}
+	switch packet[0] >> 4 {
+	case 4:
+		if len(packet) < 20 {
+			return p, false
+		}
+		headerLen := int(packet[0]&0x0f) * 4
+		if headerLen < 20 || len(packet) < headerLen {
+			return p, false
+		}
+		p.family = 4
+		p.protocol = packet[9]
+		p.src = netip.AddrFrom4([4]byte(packet[12:16]))
+		p.dst = netip.AddrFrom4([4]byte(packet[16:20]))
+		// only the first fragment carries the transport header
+		if binary.BigEndian.Uint16(packet[6:8])&0x1fff != 0 {
+			return p, true
+		}
+		payload = packet[headerLen:]
+	case 6:
+		if len(packet) < 40 {
+			return p, false
+		}
+		p.family = 6
+		p.src = netip.AddrFrom16([16]byte(packet[8:24]))
+		p.dst = netip.AddrFrom16([16]byte(packet[24:40]))
+		nextHeader := packet[6]
+		offset := 40
+		// skip the extension headers to find the transport protocol
+	extensionHeaders:
+		for {
+			switch nextHeader {
+			case 0, 43, 60: // hop-by-hop options, routing, destination options
+				if len(packet) < offset+8 {
+					return p, false
+				}
+				nextHeader = packet[offset]
+				offset += (int(packet[offset+1]) + 1) * 8
+			case 44: // fragment
+				if len(packet) < offset+8 {
+					return p, false
+				}
+				nextHeader = packet[offset]
+				fragmentOffset := binary.BigEndian.Uint16(packet[offset+2:offset+4]) >> 3
+				offset += 8
+				if fragmentOffset != 0 {
+					p.protocol = nextHeader
+					return p, true
+				}
+			default:
+				break extensionHeaders
+			}
+		}
+		if len(packet) < offset {
+			return p, false
+		}
+		p.protocol = nextHeader
+		payload = packet[offset:]
+	default:
+		return p, false
+	}
+
+	switch p.protocol {
+	case ipProtocolNumbers["tcp"], ipProtocolNumbers["udp"], ipProtocolNumbers["sctp"]:
+		if len(payload) >= 4 {
+			p.hasPorts = true
+			p.srcPort = binary.BigEndian.Uint16(payload[0:2])
+			p.dstPort = binary.BigEndian.Uint16(payload[2:4])
+		}
+	case ipProtocolNumbers["icmpv4"], ipProtocolNumbers["icmpv6"]:
+		if len(payload) >= 2 {
+			p.isICMP = true
+			p.icmpType = payload[0]
+			p.icmpCode = payload[1]
+		}
+	}
+	return p, true
+}
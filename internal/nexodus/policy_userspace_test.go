@@ -0,0 +1,241 @@
+package nexodus
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/tun"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+// testPacket builds an IP packet with a minimal transport header, for tcp, udp and sctp the header carries the
+// ports, for icmp and icmpv6 the srcPort and dstPort are used as the ICMP type and code.
+func testPacket(protocol uint8, src, dst string, srcPort, dstPort uint16) []byte {
+	srcAddr := netip.MustParseAddr(src)
+	dstAddr := netip.MustParseAddr(dst)
+	transport := make([]byte, 8)
+	if protocol == 1 || protocol == 58 {
+		transport[0] = byte(srcPort)
+		transport[1] = byte(dstPort)
+	} else {
+		binary.BigEndian.PutUint16(transport[0:2], srcPort)
+		binary.BigEndian.PutUint16(transport[2:4], dstPort)
+	}
+	if srcAddr.Is4() {
+		packet := make([]byte, 20)
+		packet[0] = 0x45
+		packet[9] = protocol
+		copy(packet[12:16], srcAddr.AsSlice())
+		copy(packet[16:20], dstAddr.AsSlice())
+		return append(packet, transport...)
+	}
+	packet := make([]byte, 40)
+	packet[0] = 0x60
+	packet[6] = protocol
+	copy(packet[8:24], srcAddr.AsSlice())
+	copy(packet[24:40], dstAddr.AsSlice())
+	return append(packet, transport...)
+}
+
+func TestUserspacePacketFilter(t *testing.T) {
+	const local, local6 = "100.64.0.1", "200::1"
+
+	inboundRules := []public.ModelsSecurityRule{
+		{IpProtocol: "tcp", Ports: []int32{22, 443}, IpRanges: []string{"100.64.0.0/24"}},
+		{IpProtocol: "udp", FromPort: 5000, ToPort: 5010},
+		{IpProtocol: "icmpv4", IcmpTypes: []int32{8}, IcmpCodes: []int32{0}},
+		{IpProtocol: "icmpv6", IcmpTypes: []int32{128}},
+		{IpProtocol: "gre", IpRanges: []string{"100.64.1.1-100.64.1.10"}},
+		{IpProtocol: "132", Ports: []int32{3868}},
+	}
+	outboundRules := []public.ModelsSecurityRule{
+		{IpProtocol: "tcp", IpRanges: []string{"100.64.0.2"}},
+	}
+
+	testCases := []struct {
+		name     string
+		packet   []byte
+		inbound  bool
+		expected bool
+	}{
+		{"tcp port in list", testPacket(6, "100.64.0.5", local, 40000, 443), true, true},
+		{"tcp port not in list", testPacket(6, "100.64.0.5", local, 40000, 80), true, false},
+		{"tcp source outside range", testPacket(6, "100.64.5.5", local, 40000, 22), true, false},
+		{"udp port in range", testPacket(17, "100.64.9.9", local, 40000, 5005), true, true},
+		{"udp port out of range", testPacket(17, "100.64.9.9", local, 40000, 5011), true, false},
+		{"icmp echo request", testPacket(1, "100.64.0.5", local, 8, 0), true, true},
+		{"icmp echo request wrong code", testPacket(1, "100.64.0.6", local, 8, 1), true, false},
+		{"icmp timestamp", testPacket(1, "100.64.0.7", local, 13, 0), true, false},
+		{"icmpv6 echo request", testPacket(58, "200::5", local6, 128, 0), true, true},
+		{"icmpv6 router advertisement", testPacket(58, "200::6", local6, 134, 0), true, false},
+		{"gre in address range", testPacket(47, "100.64.1.5", local, 0, 0), true, true},
+		{"gre outside address range", testPacket(47, "100.64.1.11", local, 0, 0), true, false},
+		{"esp not permitted", testPacket(50, "100.64.1.5", local, 0, 0), true, false},
+		{"sctp by protocol number", testPacket(132, "200::5", local6, 3868, 3868), true, true},
+		{"outbound tcp permitted", testPacket(6, local, "100.64.0.2", 40001, 8080), false, true},
+		{"outbound udp denied", testPacket(17, local, "100.64.0.2", 40001, 53), false, false},
+		{"reply to outbound flow", testPacket(6, "100.64.0.2", local, 8080, 40001), true, true},
+		{"reply to inbound flow", testPacket(6, local, "100.64.0.5", 443, 40000), false, true},
+		{"truncated packet", []byte{0x45, 0x00}, true, false},
+	}
+
+	filter := newUsPacketFilter(nil)
+	require.NoError(t, filter.setRules(inboundRules, outboundRules))
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, filter.allow(tc.packet, tc.inbound), tc.name)
+	}
+
+	// a direction without rules permits all traffic
+	require.NoError(t, filter.setRules(inboundRules, nil))
+	require.True(t, filter.allow(testPacket(17, local, "8.8.8.8", 40001, 53), false))
+	require.NoError(t, filter.setRules(nil, nil))
+	require.True(t, filter.allow(testPacket(50, "100.64.1.5", local, 0, 0), true))
+}
+
+func TestClampTCPMSS(t *testing.T) {
+	// tcpSyn builds a TCP SYN packet carrying the MSS option with a valid checksum
+	tcpSyn := func(src, dst string, mss uint16) []byte {
+		packet := testPacket(6, src, dst, 40000, 443)
+		ipHeaderLen := len(packet) - 8
+		tcp := make([]byte, 24)
+		copy(tcp, packet[ipHeaderLen:])
+		tcp[12] = 6 << 4
+		tcp[13] = 0x02
+		tcp[20], tcp[21] = 2, 4
+		binary.BigEndian.PutUint16(tcp[22:], mss)
+		binary.BigEndian.PutUint16(tcp[16:], tcpChecksum(src, dst, tcp))
+		return append(packet[:ipHeaderLen], tcp...)
+	}
+
+	testCases := []struct {
+		name     string
+		src, dst string
+		mss      uint16
+		expected uint16
+	}{
+		{"ipv4 above", "100.64.0.1", "100.64.0.2", 1460, 1340},
+		{"ipv4 below", "100.64.0.1", "100.64.0.2", 1200, 1200},
+		{"ipv6 above", "200::1", "200::2", 1440, 1320},
+	}
+	for _, tc := range testCases {
+		packet := tcpSyn(tc.src, tc.dst, tc.mss)
+		clampTCPMSS(packet, 1380)
+		tcp := packet[len(packet)-24:]
+		require.Equal(t, tc.expected, binary.BigEndian.Uint16(tcp[22:]), tc.name)
+		require.Equal(t, tcpSyn(tc.src, tc.dst, tc.expected), packet, tc.name)
+	}
+
+	// packets other than SYNs are left alone
+	packet := tcpSyn("100.64.0.1", "100.64.0.2", 1460)
+	packet[len(packet)-24+13] = 0x10
+	clampTCPMSS(packet, 1380)
+	require.Equal(t, uint16(1460), binary.BigEndian.Uint16(packet[len(packet)-2:]))
+}
+
+// tcpChecksum computes the checksum of a TCP segment, the checksum field of which is ignored
+func tcpChecksum(src, dst string, tcp []byte) uint16 {
+	srcAddr := netip.MustParseAddr(src)
+	dstAddr := netip.MustParseAddr(dst)
+	pseudo := append(srcAddr.AsSlice(), dstAddr.AsSlice()...)
+	if srcAddr.Is4() {
+		pseudo = append(pseudo, 0, 6, 0, byte(len(tcp)))
+	} else {
+		pseudo = append(pseudo, 0, 0, 0, byte(len(tcp)), 0, 0, 0, 6)
+	}
+	segment := append([]byte{}, tcp...)
+	segment[16], segment[17] = 0, 0
+	return cksum(append(pseudo, segment...))
+}
+
+// testTunDevice returns the packets it was given to read and records the packets written to it
+type testTunDevice struct {
+	tun.Device
+	packets [][]byte
+	written [][]byte
+}
+
+func (d *testTunDevice) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	n := 0
+	for ; n < len(bufs) && len(d.packets) > 0; n++ {
+		sizes[n] = copy(bufs[n][offset:], d.packets[0])
+		d.packets = d.packets[1:]
+	}
+	return n, nil
+}
+
+func (d *testTunDevice) Write(bufs [][]byte, offset int) (int, error) {
+	for _, buf := range bufs {
+		d.written = append(d.written, append([]byte{}, buf[offset:]...))
+	}
+	return len(bufs), nil
+}
+
+func TestUserspacePacketFilterPathMTU(t *testing.T) {
+	// sized builds a udp packet of the given size, ipv4 packets get the don't fragment flag when df is set
+	sized := func(src, dst string, size int, df bool) []byte {
+		packet := testPacket(17, src, dst, 40000, 5000)
+		packet = append(packet, make([]byte, size-len(packet))...)
+		if packet[0]>>4 == 4 {
+			binary.BigEndian.PutUint16(packet[2:4], uint16(size))
+			if df {
+				packet[6] = 0x40
+			}
+			binary.BigEndian.PutUint16(packet[10:12], cksum(packet[:20]))
+		} else {
+			binary.BigEndian.PutUint16(packet[4:6], uint16(size-40))
+		}
+		return packet
+	}
+
+	small := sized("100.64.0.1", "100.64.0.2", 1380, true)
+	fragmentable := sized("100.64.0.1", "100.64.0.2", 1420, false)
+	big := sized("100.64.0.1", "100.64.0.2", 1420, true)
+	big6 := sized("200::1", "200::2", 1420, false)
+	device := &testTunDevice{packets: [][]byte{small, fragmentable, big, big6}}
+	f := newUsPacketFilter(device)
+	f.setMTU(1380)
+
+	bufs := make([][]byte, 4)
+	for i := range bufs {
+		bufs[i] = make([]byte, 1500)
+	}
+	sizes := make([]int, len(bufs))
+	n, err := f.Read(bufs, sizes, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, small, bufs[0][:sizes[0]])
+	require.Equal(t, fragmentable, bufs[1][:sizes[1]])
+
+	// netstack is told about the path MTU of the packets that were dropped
+	require.Len(t, device.written, 2)
+	reply := device.written[0]
+	require.Len(t, reply, 20+8+28)
+	require.True(t, checksumValid(reply[:20]))
+	require.Equal(t, big[16:20], reply[12:16])
+	require.Equal(t, big[12:16], reply[16:20])
+	icmp := reply[20:]
+	require.Equal(t, []byte{3, 4}, icmp[:2])
+	require.Equal(t, uint16(1380), binary.BigEndian.Uint16(icmp[6:8]))
+	require.Equal(t, big[:28], icmp[8:])
+	require.True(t, checksumValid(icmp))
+
+	reply = device.written[1]
+	require.Len(t, reply, minMTU)
+	require.Equal(t, big6[24:40], reply[8:24])
+	require.Equal(t, big6[8:24], reply[24:40])
+	icmp = reply[40:]
+	require.Equal(t, []byte{2, 0}, icmp[:2])
+	require.Equal(t, uint32(1380), binary.BigEndian.Uint32(icmp[4:8]))
+	require.Equal(t, big6[:minMTU-48], icmp[8:])
+	pseudo := append(append([]byte{}, reply[8:40]...), 0, 0, byte(len(icmp)>>8), byte(len(icmp)), 0, 0, 0, 58)
+	require.True(t, checksumValid(append(pseudo, icmp...)))
+}
+
+// checksumValid returns true when the internet checksum of data, checksum field included, adds up
+func checksumValid(data []byte) bool {
+	// cksum returns 0xffff rather than 0 for data that adds up
+	return cksum(data) == 0xffff
+}
@@ -0,0 +1,164 @@
+package nexodus
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/portmap"
+)
+
+const (
+	// the source of the endpoint the gateway maps to the wireguard port, followed by the protocol it was mapped with
+	endpointSourcePortMapping = "port-mapping:"
+	// the lifetime asked for the mapping, it is renewed at half of the lifetime granted
+	portMappingLifetime = 2 * time.Hour
+	// gateways may grant less than asked for, the mapping is renewed no more often than this
+	portMappingMinRenewInterval = 30 * time.Second
+	// how long to wait before asking the gateway again once it did not map the port
+	portMappingRetryInterval = 10 * time.Minute
+	// how long the gateway is given to answer, all protocols included
+	portMappingTimeout = 10 * time.Second
+)
+
+// portMapper keeps the wireguard port mapped on the gateway of the local network, so that peers reach this device
+// through its external address even when the NAT of the gateway would not let them in, symmetric NATs included.
+type portMapper struct {
+	mu         sync.Mutex
+	client     *portmap.Client
+	mapping    portmap.Mapping // zero while the port is not mapped
+	advertised netip.AddrPort  // the external endpoint the device last advertised
+	renewAt    time.Time       // when the mapping is renewed, or asked for again after a failure
+	stopped    bool
+}
+
+// endpoint returns the external endpoint of the mapping and the protocol it was made with, the endpoint is invalid
+// while the port is not mapped.
+func (pm *portMapper) endpoint() (netip.AddrPort, string) {
+	if pm == nil {
+		return netip.AddrPort{}, ""
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.mapping.External, pm.mapping.Protocol
+}
+
+// changed determines if the mapping moved since the device last advertised it.
+func (pm *portMapper) changed() bool {
+	if pm == nil {
+		return false
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.mapping.External != pm.advertised
+}
+
+// markAdvertised records the external endpoint among the endpoints the device advertised.
+func (pm *portMapper) markAdvertised(endpoints []public.ModelsEndpoint) {
+	if pm == nil {
+		return
+	}
+	// an invalid endpoint is recorded when there is none, like the one of a mapping that is not there
+	advertised, _ := netip.ParseAddrPort(extractPortMappedEndpoint(public.ModelsDevice{Endpoints: endpoints}))
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.advertised = advertised
+}
+
+// reconcilePortMapping maps the wireguard port on the gateway, renews the mapping once half of its lifetime passed,
+// and asks again every portMappingRetryInterval while the gateway does not map it. See portMapper.changed for whether
+// the endpoints of the device need to be updated afterwards.
+func (nx *Nexodus) reconcilePortMapping(ctx context.Context) {
+	pm := nx.portMapper
+	if pm == nil {
+		return
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.stopped || time.Now().Before(pm.renewAt) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, portMappingTimeout)
+	defer cancel()
+	previous := pm.mapping
+	var mapping portmap.Mapping
+	var err error
+	if previous.Protocol != "" {
+		mapping, err = pm.client.Renew(ctx, previous, portMappingLifetime)
+		if err != nil {
+			nx.logger.Debugf("failed to renew the mapping of the wireguard port to %s, mapping it again: %v", previous.External, err)
+		}
+	}
+	if previous.Protocol == "" || err != nil {
+		// the gateway is looked up on every new mapping, it changes when the device moves to another network
+		var gateway netip.Addr
+		if gatewayIP, err := getDefaultGatewayIPv4(); err == nil {
+			gateway, _ = netip.ParseAddr(gatewayIP)
+		}
+		pm.client = portmap.NewClient(nx.logger, gateway)
+		mapping, err = pm.client.Map(ctx, nx.listenPort, portMappingLifetime)
+	}
+	if err == nil && !mapping.Reachable() {
+		nx.logger.Debugf("the gateway mapped the wireguard port to %s, which is behind another NAT", mapping.External)
+		if err := pm.client.Unmap(ctx, mapping); err != nil {
+			nx.logger.Debugf("failed to remove the port mapping: %v", err)
+		}
+		err = errors.New("the external address of the gateway is not reachable from the internet")
+	}
+	if err != nil {
+		if previous.Protocol != "" || !errors.Is(err, portmap.ErrNoGateway) {
+			nx.logger.Infof("the wireguard port is not mapped on the gateway: %v", err)
+		}
+		pm.mapping = portmap.Mapping{}
+		pm.renewAt = time.Now().Add(portMappingRetryInterval)
+		return
+	}
+
+	if mapping.External != previous.External {
+		nx.logger.Infof("mapped the wireguard port to %s on the gateway with %s", mapping.External, mapping.Protocol)
+	}
+	pm.mapping = mapping
+	renewIn := mapping.Lifetime / 2
+	if renewIn < portMappingMinRenewInterval {
+		renewIn = portMappingMinRenewInterval
+	}
+	pm.renewAt = time.Now().Add(renewIn)
+}
+
+// stopPortMapping removes the mapping of the wireguard port from the gateway, peers that still have the external
+// endpoint would otherwise reach whichever host the gateway maps the port to next.
+func (nx *Nexodus) stopPortMapping() {
+	pm := nx.portMapper
+	if pm == nil {
+		return
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.stopped = true
+	if pm.mapping.Protocol == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), portMappingTimeout)
+	defer cancel()
+	if err := pm.client.Unmap(ctx, pm.mapping); err != nil {
+		nx.logger.Warnf("failed to remove the mapping of the wireguard port from the gateway: %v", err)
+		return
+	}
+	nx.logger.Debugf("removed the mapping of the wireguard port to %s from the gateway", pm.mapping.External)
+	pm.mapping = portmap.Mapping{}
+}
+
+// extractPortMappedEndpoint returns the endpoint the gateway of a device maps to its wireguard port, or "" if it has none.
+func extractPortMappedEndpoint(device public.ModelsDevice) string {
+	for _, endpoint := range device.Endpoints {
+		if strings.HasPrefix(endpoint.Source, endpointSourcePortMapping) {
+			return endpoint.Address
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package nexodus
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/portmap"
+)
+
+func TestRebuildPeerConfigPortMapped(t *testing.T) {
+	zLogger, _ := zap.NewDevelopment()
+	newNexodus := func() *Nexodus {
+		return &Nexodus{
+			vpc: &public.ModelsVPC{
+				Ipv4Cidr: "100.64.0.0/10",
+				Ipv6Cidr: "200::/64",
+			},
+			nodeReflexiveAddressIPv4: netip.MustParseAddrPort("1.1.1.1:1234"),
+			logger:                   zLogger.Sugar(),
+		}
+	}
+
+	t.Run("peer mapped", func(t *testing.T) {
+		require := require.New(t)
+		nx := newNexodus()
+		d := deviceCacheEntry{
+			device: public.ModelsDevice{
+				Endpoints: []public.ModelsEndpoint{
+					{Source: endpointSourcePortMapping + portmap.ProtocolPCP, Address: "2.2.2.2:61820"},
+					{Source: "local", Address: "192.168.10.50:51820"},
+					{Source: "stun:stun.example.com:3478", Address: "2.2.2.2:4321"},
+				},
+				PublicKey:    "bacon",
+				SymmetricNat: true,
+			},
+		}
+		nx.peeringReset(&d)
+
+		// the mapped endpoint is not taken for the reflexive one
+		_, reflexiveIP4 := nx.extractLocalAndReflexiveIP(d.device)
+		require.Equal("2.2.2.2:4321", reflexiveIP4)
+
+		// the mapped port gets through the symmetric NAT of the peer
+		peer, chosenMethod, _ := nx.rebuildPeerConfig(&d, false)
+		require.Equal(peeringMethodPortMapped, chosenMethod)
+		require.Equal("2.2.2.2:61820", peer.Endpoint)
+	})
+
+	t.Run("this device mapped", func(t *testing.T) {
+		require := require.New(t)
+		nx := newNexodus()
+		nx.symmetricNat = true
+		nx.portMapper = &portMapper{mapping: portmap.Mapping{
+			Protocol: portmap.ProtocolNATPMP,
+			External: netip.MustParseAddrPort("1.1.1.1:61820"),
+		}}
+		d := deviceCacheEntry{
+			device: public.ModelsDevice{
+				Endpoints: []public.ModelsEndpoint{
+					{Source: "local", Address: "192.168.10.50:51820"},
+					{Source: "stun:stun.example.com:3478", Address: "2.2.2.2:4321"},
+				},
+				PublicKey: "bacon",
+			},
+		}
+		nx.peeringReset(&d)
+
+		// the endpoints this device advertises lead with the mapped one
+		endpoints := nx.endpoints(nx.nodeReflexiveAddressIPv4, "stun.example.com:3478")
+		require.Equal(public.ModelsEndpoint{Source: "port-mapping:nat-pmp", Address: "1.1.1.1:61820"}, endpoints[0])
+		require.Equal("1.1.1.1:61820", extractPortMappedEndpoint(public.ModelsDevice{Endpoints: endpoints}))
+
+		// the peer reaches the mapped port, this device peers with its reflexive address meanwhile
+		peer, chosenMethod, _ := nx.rebuildPeerConfig(&d, false)
+		require.Equal(peeringMethodPortMapped, chosenMethod)
+		require.Equal("2.2.2.2:4321", peer.Endpoint)
+	})
+}
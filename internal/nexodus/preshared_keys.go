@@ -0,0 +1,134 @@
+package nexodus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/state"
+	"github.com/nexodus-io/nexodus/internal/wgcrypto"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// how often the preshared keys are fetched even when every peer has a current key, so
+	// that the key of the next rotation period is known before it starts
+	presharedKeyRefreshInterval = time.Hour
+	// the minimum time between two fetches, bounds retries when the apiserver is unavailable
+	presharedKeyRetryInterval = 10 * time.Second
+)
+
+// presharedKey is a WireGuard preshared key used with a peer while it is valid.
+type presharedKey struct {
+	key       string
+	startsAt  time.Time
+	expiresAt time.Time
+}
+
+// refreshPresharedKeys fetches the preshared keys of this device from the apiserver when
+// the vpc requires them and a peer is missing a current key or the keys are getting old.
+func (nx *Nexodus) refreshPresharedKeys(ctx context.Context, peerMap map[string]public.ModelsDevice) error {
+	if nx.vpc == nil || !nx.vpc.PresharedKeys {
+		nx.deviceCacheLock.Lock()
+		nx.presharedKeys = nil
+		nx.deviceCacheLock.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	if !nx.presharedKeysStale(peerMap, now) {
+		return nil
+	}
+
+	nx.deviceCacheLock.RLock()
+	privateKey := nx.wireguardPvtKey
+	nx.deviceCacheLock.RUnlock()
+	key, err := wgtypes.ParseKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	nx.presharedKeysFetched = now
+	var sealedKeys []public.ModelsPeerPresharedKey
+	if nx.devicesInformer == nil {
+		// not connected to the apiserver yet, the keys are sealed so they are cached with the rest of the state
+		if nx.cache == nil {
+			return errNoCache
+		}
+		sealedKeys = nx.cache.PresharedKeys
+	} else {
+		sealedKeys, _, err = nx.client.DevicesApi.ListDevicePresharedKeys(ctx, nx.deviceId).Execute()
+		if err != nil {
+			return err
+		}
+		nx.updateCache(func(cache *state.Cache) {
+			cache.PresharedKeys = sealedKeys
+		})
+	}
+
+	keys := map[string][]presharedKey{}
+	for _, sealedKey := range sealedKeys {
+		sealed, err := wgcrypto.ParseSealed(sealedKey.SealedKey)
+		if err != nil {
+			return err
+		}
+		data, err := sealed.Open(key[:])
+		if err != nil {
+			return fmt.Errorf("failed to open the preshared key of peer %s: %w", sealedKey.PeerId, err)
+		}
+		psk, err := wgtypes.NewKey(data)
+		if err != nil {
+			return err
+		}
+		startsAt, err := time.Parse(time.RFC3339, sealedKey.StartsAt)
+		if err != nil {
+			return err
+		}
+		expiresAt, err := time.Parse(time.RFC3339, sealedKey.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		keys[sealedKey.PeerId] = append(keys[sealedKey.PeerId], presharedKey{
+			key:       psk.String(),
+			startsAt:  startsAt,
+			expiresAt: expiresAt,
+		})
+	}
+
+	nx.deviceCacheLock.Lock()
+	nx.presharedKeys = keys
+	nx.deviceCacheLock.Unlock()
+	return nil
+}
+
+// presharedKeysStale returns true if the preshared keys should be fetched again.
+func (nx *Nexodus) presharedKeysStale(peerMap map[string]public.ModelsDevice, now time.Time) bool {
+	since := now.Sub(nx.presharedKeysFetched)
+	if since < presharedKeyRetryInterval {
+		return false
+	}
+	if since >= presharedKeyRefreshInterval {
+		return true
+	}
+	for id := range peerMap {
+		if id == nx.deviceId {
+			continue
+		}
+		if nx.presharedKeyFor(id, now) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// presharedKeyFor returns the preshared key to use with a peer, or an empty string if
+// there is none. assumes deviceCacheLock is held or that the caller is the only writer.
+func (nx *Nexodus) presharedKeyFor(peerId string, now time.Time) string {
+	for _, k := range nx.presharedKeys[peerId] {
+		if !now.Before(k.startsAt) && now.Before(k.expiresAt) {
+			return k.key
+		}
+	}
+	return ""
+}
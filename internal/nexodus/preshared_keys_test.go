@@ -0,0 +1,40 @@
+package nexodus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestPresharedKeyFor(t *testing.T) {
+	now := time.Date(2023, 12, 14, 12, 0, 0, 0, time.UTC)
+	day := time.Date(2023, 12, 14, 0, 0, 0, 0, time.UTC)
+	nx := &Nexodus{
+		deviceId: "self",
+		presharedKeys: map[string][]presharedKey{
+			"peer1": {
+				{key: "today", startsAt: day, expiresAt: day.Add(24 * time.Hour)},
+				{key: "tomorrow", startsAt: day.Add(24 * time.Hour), expiresAt: day.Add(48 * time.Hour)},
+			},
+		},
+		presharedKeysFetched: now,
+	}
+
+	require.Equal(t, "today", nx.presharedKeyFor("peer1", now))
+	require.Equal(t, "tomorrow", nx.presharedKeyFor("peer1", day.Add(24*time.Hour)))
+	require.Equal(t, "", nx.presharedKeyFor("peer1", day.Add(48*time.Hour)))
+	require.Equal(t, "", nx.presharedKeyFor("peer2", now))
+
+	peerMap := map[string]public.ModelsDevice{"self": {}, "peer1": {}}
+	require.False(t, nx.presharedKeysStale(peerMap, now.Add(time.Minute)))
+	// the keys are refreshed before the next rotation period starts
+	require.True(t, nx.presharedKeysStale(peerMap, now.Add(presharedKeyRefreshInterval)))
+
+	// a new peer needs its keys, but fetches are not retried too often
+	peerMap["peer2"] = public.ModelsDevice{}
+	require.False(t, nx.presharedKeysStale(peerMap, now.Add(time.Second)))
+	require.True(t, nx.presharedKeysStale(peerMap, now.Add(presharedKeyRetryInterval)))
+}
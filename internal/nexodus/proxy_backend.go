@@ -0,0 +1,314 @@
+package nexodus
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/util"
+)
+
+// how long a health check may take before the destination is considered down
+const proxyCheckTimeout = 5 * time.Second
+
+// proxyBackend tracks the health and load of the destination of a proxy rule.
+type proxyBackend struct {
+	rule ProxyRule
+
+	mu sync.Mutex
+	// the result of the last health check, true until the first one fails and for destinations without a check
+	healthy    bool
+	checkError string
+	lastCheck  time.Time
+	checking   bool
+	// the connections in progress to the destination
+	active int
+	// the connections to the destination that failed in a row
+	fails        int
+	ejectedUntil time.Time
+}
+
+func newProxyBackend(rule ProxyRule) *proxyBackend {
+	return &proxyBackend{rule: rule, healthy: true}
+}
+
+// available determines if new connections may go to the destination.
+func (b *proxyBackend) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.healthy && !now.Before(b.ejectedUntil)
+}
+
+func (b *proxyBackend) connections() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.active
+}
+
+func (b *proxyBackend) acquire() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active++
+}
+
+// release is called once a connection to the destination handed out by NextDest is done.
+func (b *proxyBackend) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active--
+}
+
+// dialed records the outcome of a connection to the destination, the destination is ejected for a while once
+// max-fails connections failed in a row.
+func (b *proxyBackend) dialed(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.fails = 0
+		return
+	}
+	b.fails++
+	if b.rule.options.maxFails > 0 && b.fails >= b.rule.options.maxFails {
+		b.fails = 0
+		b.ejectedUntil = time.Now().Add(b.rule.options.getFailTimeout())
+	}
+}
+
+// status describes the health of the destination for nexctl.
+func (b *proxyBackend) status(now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	health := "healthy"
+	switch {
+	case now.Before(b.ejectedUntil):
+		health = fmt.Sprintf("ejected for %v", b.ejectedUntil.Sub(now).Round(time.Second))
+	case !b.healthy:
+		health = fmt.Sprintf("unhealthy: %s", b.checkError)
+	case b.rule.options.check == "":
+		health = "not checked"
+	}
+	return fmt.Sprintf("%s, %d connections", health, b.active)
+}
+
+// checkDue determines if the destination should be checked now, and marks it as being checked if so.
+func (b *proxyBackend) checkDue(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rule.options.check == "" || b.checking || now.Sub(b.lastCheck) < b.rule.options.getCheckInterval() {
+		return false
+	}
+	b.checking = true
+	return true
+}
+
+func (b *proxyBackend) checked(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checking = false
+	b.lastCheck = time.Now()
+	b.healthy = err == nil
+	b.checkError = ""
+	if err != nil {
+		b.checkError = err.Error()
+	}
+}
+
+// strategy returns how the proxy picks the destination of a new connection, the one set on any of its rules.
+// assumes proxy.mu is held
+func (proxy *UsProxy) strategy() string {
+	for _, rule := range proxy.rules {
+		if rule.options.strategy != "" {
+			return rule.options.strategy
+		}
+	}
+	return proxyStrategyRoundRobin
+}
+
+// acceptProxy determines if connections to the proxy start with a PROXY protocol header, as set on any of its rules.
+// assumes proxy.mu is held
+func (proxy *UsProxy) acceptProxy() bool {
+	for _, rule := range proxy.rules {
+		if rule.options.acceptProxy {
+			return true
+		}
+	}
+	return false
+}
+
+// NextDest picks the destination of a new connection from source among the available ones, or among all of them
+// when none is available. The caller must release the destination once the connection is done.
+func (proxy *UsProxy) NextDest(source net.Addr) *proxyBackend {
+	return proxy.nextDest(source, nil)
+}
+
+// nextDest is NextDest among the destinations of the rules route selects, all of them if route is nil. It returns nil
+// when route selects none.
+func (proxy *UsProxy) nextDest(source net.Addr, route func([]ProxyRule) []ProxyRule) *proxyBackend {
+	proxy.mu.RLock()
+	defer proxy.mu.RUnlock()
+
+	rules := proxy.rules
+	if route != nil {
+		rules = route(rules)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var candidates []*proxyBackend
+	for _, rule := range rules {
+		if b := proxy.backends[rule]; b.available(now) {
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		// a destination that may be down is still better than refusing the connection
+		for _, rule := range rules {
+			candidates = append(candidates, proxy.backends[rule])
+		}
+	}
+
+	counter := atomic.AddUint64(&proxy.connectionCounter, 1)
+	var b *proxyBackend
+	switch proxy.strategy() {
+	case proxyStrategyLeastConn:
+		b = leastConnBackend(candidates, counter)
+	case proxyStrategySourceHash:
+		b = weightedBackend(candidates, sourceHash(source))
+	default:
+		b = weightedBackend(candidates, counter)
+	}
+	b.acquire()
+	return b
+}
+
+// weightedBackend picks the n-th destination when each is repeated as many times as its weight.
+func weightedBackend(candidates []*proxyBackend, n uint64) *proxyBackend {
+	total := 0
+	for _, b := range candidates {
+		total += b.rule.options.getWeight()
+	}
+	i := int(n % uint64(total))
+	for _, b := range candidates {
+		i -= b.rule.options.getWeight()
+		if i < 0 {
+			return b
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// leastConnBackend picks the destination with the fewest connections in progress for its weight, ties are broken in
+// turn starting from the n-th destination.
+func leastConnBackend(candidates []*proxyBackend, n uint64) *proxyBackend {
+	var best *proxyBackend
+	bestActive := 0
+	for i := range candidates {
+		b := candidates[(int(n%uint64(len(candidates)))+i)%len(candidates)]
+		active := b.connections()
+		if best == nil || active*best.rule.options.getWeight() < bestActive*b.rule.options.getWeight() {
+			best, bestActive = b, active
+		}
+	}
+	return best
+}
+
+// sourceHash hashes the address a connection comes from, without its port.
+func sourceHash(source net.Addr) uint64 {
+	if source == nil {
+		return 0
+	}
+	host, _, err := net.SplitHostPort(source.String())
+	if err != nil {
+		host = source.String()
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(host))
+	return h.Sum64()
+}
+
+// dial connects to a destination of the proxy, through the wireguard tunnel for egress rules.
+func (proxy *UsProxy) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if proxy.key.ruleType == ProxyTypeEgress {
+		return proxy.userspaceNet.DialContext(ctx, network, address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+// runHealthChecks checks the health of the destinations that have a check, until the proxy is stopped.
+func (proxy *UsProxy) runHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	checksWg := &sync.WaitGroup{}
+	defer checksWg.Wait()
+	for {
+		now := time.Now()
+		proxy.mu.RLock()
+		for _, b := range proxy.backends {
+			if !b.checkDue(now) {
+				continue
+			}
+			b := b
+			util.GoWithWaitGroup(checksWg, func() {
+				err := proxy.checkBackend(ctx, b.rule)
+				if err != nil && ctx.Err() == nil {
+					proxy.logger.Debugf("Health check of %s failed: %v", b.rule.dest, err)
+				}
+				b.checked(err)
+			})
+		}
+		proxy.mu.RUnlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkBackend runs the health check of the destination of a rule.
+func (proxy *UsProxy) checkBackend(ctx context.Context, rule ProxyRule) error {
+	ctx, cancel := context.WithTimeout(ctx, proxyCheckTimeout)
+	defer cancel()
+	switch rule.options.check {
+	case proxyCheckTCP:
+		conn, err := proxy.dial(ctx, "tcp", rule.dest.String())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case proxyCheckHTTP:
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext:       proxy.dial,
+				DisableKeepAlives: true,
+			},
+			// a redirect is a healthy answer, it is not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", rule.dest, rule.options.getCheckPath()), nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("status %s", res.Status)
+		}
+		return nil
+	}
+	return nil
+}
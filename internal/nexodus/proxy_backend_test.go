@@ -0,0 +1,154 @@
+package nexodus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseProxyRuleOptions(t *testing.T) {
+	require := require.New(t)
+
+	rule, err := ParseProxyRule("tcp:443:[fd00::1]:8443,weight=2,check=http,check-path=/healthz,max-fails=3", ProxyTypeIngress)
+	require.NoError(err)
+	require.Equal(HostPort{host: "fd00::1", port: 8443}, rule.dest)
+	require.Equal(ProxyOptions{weight: 2, check: proxyCheckHTTP, checkPath: "/healthz", maxFails: 3}, rule.options)
+	require.Equal(30*time.Second, rule.options.getFailTimeout())
+	// the options are stored along with the rule
+	require.Equal("tcp:443:[fd00::1]:8443,weight=2,check=http,check-path=/healthz,max-fails=3", rule.String())
+
+	rule, err = ParseProxyRule("udp:53:10.0.0.1:53", ProxyTypeEgress)
+	require.NoError(err)
+	require.Equal("udp:53:10.0.0.1:53", rule.String())
+	require.Equal(1, rule.options.getWeight())
+
+	for _, invalid := range []string{
+		"tcp:443:10.0.0.1:8443,weight=0",
+		"tcp:443:10.0.0.1:8443,weight=101",
+		"tcp:443:10.0.0.1:8443,strategy=random",
+		"tcp:443:10.0.0.1:8443,retries=3",
+		"tcp:443:10.0.0.1:8443,check",
+		"tcp:443:10.0.0.1:8443,check-path=/healthz",
+		"tcp:443:10.0.0.1:8443,check=tcp,check-interval=10ms",
+		"tcp:443:10.0.0.1:8443,fail-timeout=1m",
+		"udp:53:10.0.0.1:53,check=tcp",
+		"tcp:443:10.0.0.1:8443,send-proxy=v3",
+		"udp:53:10.0.0.1:53,send-proxy=v1",
+		"tcp:443:10.0.0.1:8443,accept-proxy=true",
+	} {
+		_, err := ParseProxyRule(invalid, ProxyTypeIngress)
+		require.Error(err, invalid)
+	}
+}
+
+func testProxy(t *testing.T, rules ...string) *UsProxy {
+	nx := &Nexodus{logger: zap.NewNop().Sugar(), userspaceWG: userspaceWG{proxies: map[ProxyKey]*UsProxy{}}}
+	var proxy *UsProxy
+	for _, r := range rules {
+		rule, err := ParseProxyRule(r, ProxyTypeIngress)
+		require.NoError(t, err)
+		proxy, err = nx.UserspaceProxyAdd(rule)
+		require.NoError(t, err)
+	}
+	return proxy
+}
+
+func TestProxyNextDest(t *testing.T) {
+	require := require.New(t)
+	source := &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 40000}
+
+	// the connections are spread in proportion to the weights
+	proxy := testProxy(t, "tcp:80:10.0.0.1:80,weight=3", "tcp:80:10.0.0.2:80")
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		b := proxy.NextDest(source)
+		counts[b.rule.dest.host]++
+		b.release()
+	}
+	require.Equal(map[string]int{"10.0.0.1": 6, "10.0.0.2": 2}, counts)
+
+	// least-conn picks the destination with the fewest connections in progress
+	proxy = testProxy(t, "tcp:81:10.0.0.1:80,strategy=least-conn", "tcp:81:10.0.0.2:80")
+	first := proxy.NextDest(source)
+	second := proxy.NextDest(source)
+	require.NotEqual(first.rule.dest, second.rule.dest)
+	second.release()
+	require.Equal(second.rule.dest, proxy.NextDest(source).rule.dest)
+
+	// source-hash sends the connections from a source to the same destination, whatever its port
+	proxy = testProxy(t, "tcp:82:10.0.0.1:80,strategy=source-hash", "tcp:82:10.0.0.2:80", "tcp:82:10.0.0.3:80")
+	dest := proxy.NextDest(source).rule.dest
+	for port := 40001; port < 40010; port++ {
+		require.Equal(dest, proxy.NextDest(&net.TCPAddr{IP: source.IP, Port: port}).rule.dest)
+	}
+
+	// the rules of a port can not set different strategies
+	nx := &Nexodus{logger: zap.NewNop().Sugar(), userspaceWG: userspaceWG{proxies: map[ProxyKey]*UsProxy{proxy.key: proxy}}}
+	rule, err := ParseProxyRule("tcp:82:10.0.0.4:80,strategy=least-conn", ProxyTypeIngress)
+	require.NoError(err)
+	_, err = nx.UserspaceProxyAdd(rule)
+	require.Error(err)
+}
+
+func TestProxyOutlierEjection(t *testing.T) {
+	require := require.New(t)
+	proxy := testProxy(t, "tcp:80:10.0.0.1:80,max-fails=2", "tcp:80:10.0.0.2:80")
+	down := proxy.backends[proxy.rules[0]]
+
+	down.dialed(errors.New("connection refused"))
+	require.True(down.available(time.Now()))
+	down.dialed(errors.New("connection refused"))
+	require.False(down.available(time.Now()))
+	require.True(down.available(time.Now().Add(defaultProxyFailTimeout)))
+
+	for i := 0; i < 4; i++ {
+		b := proxy.NextDest(nil)
+		require.Equal("10.0.0.2", b.rule.dest.host)
+		b.release()
+	}
+
+	// with every destination down, they are all tried rather than refusing the connection
+	up := proxy.backends[proxy.rules[1]]
+	up.checked(errors.New("status 503 Service Unavailable"))
+	counts := map[string]int{}
+	for i := 0; i < 4; i++ {
+		b := proxy.NextDest(nil)
+		counts[b.rule.dest.host]++
+		b.release()
+	}
+	require.Equal(map[string]int{"10.0.0.1": 2, "10.0.0.2": 2}, counts)
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	require := require.New(t)
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	proxy := testProxy(t, "tcp:80:"+addr+",check=http,check-path=/healthz", "tcp:80:"+addr+",check=tcp,weight=2")
+	ctx := context.Background()
+	require.NoError(proxy.checkBackend(ctx, proxy.rules[0]))
+	require.NoError(proxy.checkBackend(ctx, proxy.rules[1]))
+
+	healthy.Store(false)
+	require.EqualError(proxy.checkBackend(ctx, proxy.rules[0]), "status 503 Service Unavailable")
+	// the tcp check only needs the port to accept connections
+	require.NoError(proxy.checkBackend(ctx, proxy.rules[1]))
+
+	server.Close()
+	require.Error(proxy.checkBackend(ctx, proxy.rules[1]))
+}
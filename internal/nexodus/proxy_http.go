@@ -0,0 +1,277 @@
+package nexodus
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/util"
+	"go.uber.org/zap"
+)
+
+// The headers that tell the destination of an http proxy rule which peer made the request.
+const (
+	proxyDeviceIdHeader = "X-Nexodus-Device-Id"
+	proxyHostnameHeader = "X-Nexodus-Hostname"
+	proxyOwnerIdHeader  = "X-Nexodus-Owner-Id"
+)
+
+const (
+	// how long a peer may take to send the headers of a request
+	httpProxyReadHeaderTimeout = 10 * time.Second
+	// how long the requests in progress may take to complete once the proxy is stopped
+	httpProxyShutdownTimeout = 5 * time.Second
+)
+
+// runHTTP serves the http proxy rules of the port as a reverse proxy until ctx is canceled.
+func (proxy *UsProxy) runHTTP(ctx context.Context, proxyWg *sync.WaitGroup) error {
+	l, err := proxy.listenTCP()
+	if err != nil {
+		proxy.logger.Error("Error creating listener: ", err)
+		return err
+	}
+
+	transport := &http.Transport{
+		DialContext:     proxy.dial,
+		IdleConnTimeout: 90 * time.Second,
+	}
+	defer transport.CloseIdleConnections()
+	errorLog, err := zap.NewStdLogAt(proxy.logger.Desugar(), zap.DebugLevel)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           &httpProxy{proxy: proxy, transport: transport, errorLog: errorLog},
+		ReadHeaderTimeout: httpProxyReadHeaderTimeout,
+		ErrorLog:          errorLog,
+	}
+
+	errChan := make(chan error, 1)
+	util.GoWithWaitGroup(proxyWg, func() {
+		errChan <- server.Serve(l)
+	})
+	select {
+	case err = <-errChan:
+		proxy.logger.Error("Error serving http: ", err)
+		return err
+	case <-ctx.Done():
+		proxy.logger.Info("Stopping proxy due to context cancel")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpProxyShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			_ = server.Close()
+		}
+		<-errChan
+		return nil
+	}
+}
+
+// httpProxy routes the requests made to an http proxy rule to the destination of the most specific rule of the port.
+type httpProxy struct {
+	proxy     *UsProxy
+	transport http.RoundTripper
+	errorLog  *log.Logger
+}
+
+func (h *httpProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var source net.Addr
+	var peer public.ModelsDevice
+	peerFound := false
+	if addr, err := netip.ParseAddrPort(req.RemoteAddr); err == nil {
+		source = net.TCPAddrFromAddrPort(addr)
+		if h.proxy.lookupPeer != nil {
+			peer, peerFound = h.proxy.lookupPeer(addr.Addr().Unmap())
+		}
+	}
+	host := requestHost(req)
+	res := &accessLogWriter{ResponseWriter: w}
+	dest := "-"
+	defer func() {
+		peerName := "unknown"
+		if peerFound {
+			peerName = peer.Hostname
+		}
+		h.proxy.logger.Infof("%s (%s) \"%s %s %s\" %d %d %v -> %s", req.RemoteAddr, peerName, req.Method, host, req.URL.RequestURI(),
+			res.status, res.written, time.Since(start).Round(time.Millisecond), dest)
+	}()
+
+	backend := h.proxy.nextDest(source, func(rules []ProxyRule) []ProxyRule {
+		return httpRoute(rules, host, req.URL.Path)
+	})
+	if backend == nil {
+		http.Error(res, "no proxy rule matches the request", http.StatusNotFound)
+		return
+	}
+	defer backend.release()
+	dest = backend.rule.dest.String()
+
+	reverseProxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(&url.URL{Scheme: "http", Host: dest})
+			// the destination sees the host the peer asked for
+			r.Out.Host = r.In.Host
+			r.SetXForwarded()
+			setPeerHeaders(r.Out.Header, peer, peerFound)
+			if name, value, found := strings.Cut(backend.rule.options.setHeader, ":"); found {
+				r.Out.Header.Set(name, strings.TrimSpace(value))
+			}
+		},
+		Transport: h.transport,
+		ModifyResponse: func(*http.Response) error {
+			backend.dialed(nil)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// a request the peer gave up on says nothing about the health of the destination
+			if r.Context().Err() == nil {
+				backend.dialed(err)
+			}
+			h.proxy.logger.Debugf("Error proxying the request to %s: %v", dest, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+		ErrorLog: h.errorLog,
+	}
+	reverseProxy.ServeHTTP(res, req)
+}
+
+// setPeerHeaders tells the destination which peer made the request. The headers the peer sent itself are removed, so
+// the destination can trust them.
+func setPeerHeaders(header http.Header, peer public.ModelsDevice, found bool) {
+	header.Del(proxyDeviceIdHeader)
+	header.Del(proxyHostnameHeader)
+	header.Del(proxyOwnerIdHeader)
+	if !found {
+		return
+	}
+	header.Set(proxyDeviceIdHeader, peer.Id)
+	header.Set(proxyHostnameHeader, peer.Hostname)
+	header.Set(proxyOwnerIdHeader, peer.OwnerId)
+}
+
+// requestHost returns the host a request was made to, without its port.
+func requestHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host = req.Host
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// httpRouteRank orders the routes that match a request from the least to the most specific.
+type httpRouteRank struct {
+	host     int // 0 without a host, 1 for a wildcard host, 2 for an exact host
+	hostLen  int
+	pathLen  int
+	matching bool
+}
+
+func (r httpRouteRank) less(o httpRouteRank) bool {
+	if r.matching != o.matching {
+		return !r.matching
+	}
+	if r.host != o.host {
+		return r.host < o.host
+	}
+	if r.hostLen != o.hostLen {
+		return r.hostLen < o.hostLen
+	}
+	return r.pathLen < o.pathLen
+}
+
+// httpRoute selects the rules of the most specific route that matches a request: an exact host takes precedence over
+// a wildcard one and either over no host, then the longest path prefix. The requests of a route are balanced across
+// the destinations of its rules.
+func httpRoute(rules []ProxyRule, host, path string) []ProxyRule {
+	var route []ProxyRule
+	best := httpRouteRank{}
+	for _, rule := range rules {
+		rank := httpRouteMatch(rule.options, host, path)
+		switch {
+		case !rank.matching:
+		case best.less(rank):
+			route, best = []ProxyRule{rule}, rank
+		case !rank.less(best):
+			route = append(route, rule)
+		}
+	}
+	return route
+}
+
+// httpRouteMatch ranks the route of a rule for a request, the rank is not matching if the route does not match.
+func httpRouteMatch(o ProxyOptions, host, path string) httpRouteRank {
+	rank := httpRouteRank{hostLen: len(o.host), pathLen: len(o.path)}
+	switch {
+	case o.host == "":
+	case strings.HasPrefix(o.host, "*."):
+		if !strings.HasSuffix(host, o.host[1:]) {
+			return httpRouteRank{}
+		}
+		rank.host = 1
+	default:
+		if host != o.host {
+			return httpRouteRank{}
+		}
+		rank.host = 2
+	}
+	// a path prefix matches whole path segments
+	prefix := strings.TrimSuffix(o.path, "/")
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return httpRouteRank{}
+	}
+	rank.matching = true
+	return rank
+}
+
+// accessLogWriter records the status and the size of a response for the access log.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	// the informational responses that come before the final one are not logged
+	if w.status < http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Unwrap lets the reverse proxy flush and hijack the underlying response.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// peerByTunnelIP finds the peer a tunnel IP address belongs to in the device cache.
+func (nx *Nexodus) peerByTunnelIP(ip netip.Addr) (public.ModelsDevice, bool) {
+	nx.deviceCacheLock.RLock()
+	defer nx.deviceCacheLock.RUnlock()
+	for _, d := range nx.deviceCache {
+		for _, tunnelIPs := range [][]public.ModelsTunnelIP{d.device.Ipv4TunnelIps, d.device.Ipv6TunnelIps} {
+			for _, tunnelIP := range tunnelIPs {
+				if addr, err := netip.ParseAddr(tunnelIP.Address); err == nil && addr.Unmap() == ip {
+					return d.device, true
+				}
+			}
+		}
+	}
+	return public.ModelsDevice{}, false
+}
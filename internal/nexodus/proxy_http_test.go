@@ -0,0 +1,137 @@
+package nexodus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseHTTPProxyRule(t *testing.T) {
+	require := require.New(t)
+
+	rule, err := ParseProxyRule("http:80:127.0.0.1:8080,host=Wiki.Example.com,path=/api,set-header=X-Env:prod", ProxyTypeIngress)
+	require.NoError(err)
+	require.Equal(proxyProtocolHTTP, rule.protocol)
+	require.Equal(ProxyOptions{host: "wiki.example.com", path: "/api", setHeader: "X-Env:prod"}, rule.options)
+	require.Equal("http:80:127.0.0.1:8080,host=wiki.example.com,path=/api,set-header=X-Env:prod", rule.String())
+
+	_, err = ParseProxyRule("http:80:127.0.0.1:8080", ProxyTypeEgress)
+	require.Error(err)
+	for _, invalid := range []string{
+		"tcp:80:127.0.0.1:8080,host=wiki.example.com",
+		"http:80:127.0.0.1:8080,host=wiki.example.com/api",
+		"http:80:127.0.0.1:8080,host=*.*.example.com",
+		"http:80:127.0.0.1:8080,path=api",
+		"http:80:127.0.0.1:8080,set-header=X-Env",
+		"http:80:127.0.0.1:8080,set-header=X Env:prod",
+		"http:80:127.0.0.1:8080,send-proxy=v1",
+	} {
+		_, err := ParseProxyRule(invalid, ProxyTypeIngress)
+		require.Error(err, invalid)
+	}
+}
+
+func TestHTTPRoute(t *testing.T) {
+	require := require.New(t)
+
+	var rules []ProxyRule
+	for _, r := range []string{
+		"http:80:10.0.0.1:80",
+		"http:80:10.0.0.2:80,path=/api",
+		"http:80:10.0.0.3:80,host=*.example.com",
+		"http:80:10.0.0.4:80,host=wiki.example.com",
+		"http:80:10.0.0.5:80,host=wiki.example.com,path=/api/",
+		"http:80:10.0.0.6:80,host=wiki.example.com,path=/api/",
+	} {
+		rule, err := ParseProxyRule(r, ProxyTypeIngress)
+		require.NoError(err)
+		rules = append(rules, rule)
+	}
+	route := func(host, path string) []string {
+		var dests []string
+		for _, rule := range httpRoute(rules, host, path) {
+			dests = append(dests, rule.dest.host)
+		}
+		return dests
+	}
+
+	require.Equal([]string{"10.0.0.1"}, route("other.org", "/"))
+	require.Equal([]string{"10.0.0.2"}, route("other.org", "/api"))
+	require.Equal([]string{"10.0.0.1"}, route("other.org", "/apis"))
+	require.Equal([]string{"10.0.0.3"}, route("docs.example.com", "/api"))
+	require.Equal([]string{"10.0.0.1"}, route("example.com", "/"))
+	require.Equal([]string{"10.0.0.4"}, route("wiki.example.com", "/"))
+	// the rules of a route balance its requests
+	require.Equal([]string{"10.0.0.5", "10.0.0.6"}, route("wiki.example.com", "/api/pages"))
+	require.Nil(httpRoute(rules[3:], "other.org", "/"))
+
+	// http and tcp rules can not share a port
+	nx := &Nexodus{logger: zap.NewNop().Sugar(), userspaceWG: userspaceWG{proxies: map[ProxyKey]*UsProxy{}}}
+	_, err := nx.UserspaceProxyAdd(rules[0])
+	require.NoError(err)
+	tcpRule, err := ParseProxyRule("tcp:80:10.0.0.1:80", ProxyTypeIngress)
+	require.NoError(err)
+	_, err = nx.UserspaceProxyAdd(tcpRule)
+	require.Error(err)
+}
+
+func TestHTTPProxy(t *testing.T) {
+	require := require.New(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s %s %s %s %s", r.Host, r.URL.Path, r.Header.Get(proxyHostnameHeader),
+			r.Header.Get(proxyDeviceIdHeader), r.Header.Get("X-Env"), r.Header.Get("X-Forwarded-For"))
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(err)
+
+	proxy := testProxy(t, "http:80:"+backendURL.Host+",host=wiki.example.com,set-header=X-Env:prod")
+	proxy.lookupPeer = func(ip netip.Addr) (public.ModelsDevice, bool) {
+		if ip == netip.MustParseAddr("100.64.0.2") {
+			return public.ModelsDevice{Id: "device-2", Hostname: "laptop", OwnerId: "owner"}, true
+		}
+		return public.ModelsDevice{}, false
+	}
+	handler := &httpProxy{proxy: proxy, transport: &http.Transport{DialContext: proxy.dial}}
+
+	serve := func(host, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/pages", nil)
+		req.RemoteAddr = remoteAddr
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	// the request goes to the destination with the identity of the peer
+	res := serve("wiki.example.com", "100.64.0.2:40000", nil)
+	require.Equal(http.StatusOK, res.Code)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(err)
+	require.Equal("wiki.example.com /pages laptop device-2 prod 100.64.0.2", string(body))
+
+	// the identity headers of an unknown peer can not be spoofed
+	res = serve("wiki.example.com", "100.64.0.3:40000", http.Header{proxyHostnameHeader: {"laptop"}})
+	require.Equal(http.StatusOK, res.Code)
+	require.Equal("wiki.example.com /pages   prod 100.64.0.3", res.Body.String())
+
+	// a request no rule matches
+	res = serve("other.org", "100.64.0.2:40000", nil)
+	require.Equal(http.StatusNotFound, res.Code)
+
+	// a destination that is down
+	backend.Close()
+	res = serve("wiki.example.com", "100.64.0.2:40000", nil)
+	require.Equal(http.StatusBadGateway, res.Code)
+}
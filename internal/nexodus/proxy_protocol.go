@@ -0,0 +1,208 @@
+package nexodus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how long a connection may take to send its PROXY protocol header
+const proxyHeaderTimeout = 5 * time.Second
+
+const (
+	// the longest a v1 header may be, including the CRLF
+	proxyHeaderV1MaxLen = 107
+	// the header of a v2 header, before the addresses
+	proxyHeaderV2Len = 16
+)
+
+// the signature that starts a v2 header
+var proxyHeaderV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// writeProxyHeader writes a PROXY protocol header of the given version, telling the destination that the connection
+// comes from source and was made to dest. The header does not carry the addresses unless both are tcp addresses of
+// the same family.
+func writeProxyHeader(w io.Writer, version string, source, dest net.Addr) error {
+	src, srcOk := addrPort(source)
+	dst, dstOk := addrPort(dest)
+	known := srcOk && dstOk && src.Addr().Is4() == dst.Addr().Is4()
+
+	var header []byte
+	switch version {
+	case proxyProtocolV1:
+		if !known {
+			header = []byte("PROXY UNKNOWN\r\n")
+			break
+		}
+		family := "TCP6"
+		if src.Addr().Is4() {
+			family = "TCP4"
+		}
+		header = []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, src.Addr(), dst.Addr(), src.Port(), dst.Port()))
+	case proxyProtocolV2:
+		header = append(header, proxyHeaderV2Signature...)
+		// version 2, PROXY command
+		header = append(header, 0x21)
+		if !known {
+			// unspecified family, no addresses
+			header = append(header, 0x00, 0x00, 0x00)
+			break
+		}
+		family := byte(0x21) // AF_INET6, STREAM
+		if src.Addr().Is4() {
+			family = 0x11 // AF_INET, STREAM
+		}
+		srcIP, dstIP := src.Addr().AsSlice(), dst.Addr().AsSlice()
+		header = append(header, family)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(srcIP)+len(dstIP)+4))
+		header = append(header, srcIP...)
+		header = append(header, dstIP...)
+		header = binary.BigEndian.AppendUint16(header, src.Port())
+		header = binary.BigEndian.AppendUint16(header, dst.Port())
+	default:
+		return fmt.Errorf("unknown PROXY protocol version: %s", version)
+	}
+	_, err := w.Write(header)
+	return err
+}
+
+// addrPort converts a tcp address to a netip.AddrPort, with IPv4-mapped IPv6 addresses unmapped.
+func addrPort(addr net.Addr) (netip.AddrPort, bool) {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || tcpAddr == nil {
+		return netip.AddrPort{}, false
+	}
+	ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(ip.Unmap(), uint16(tcpAddr.Port)), true
+}
+
+// readProxyHeader reads the v1 or v2 PROXY protocol header a connection starts with. It returns the addresses the
+// header carries, or nil addresses when the header does not carry any, in which case the connection's own are used.
+func readProxyHeader(r *bufio.Reader) (source, dest net.Addr, err error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch first[0] {
+	case 'P':
+		return readProxyHeaderV1(r)
+	case proxyHeaderV2Signature[0]:
+		return readProxyHeaderV2(r)
+	}
+	return nil, nil, fmt.Errorf("no PROXY protocol header")
+}
+
+func readProxyHeaderV1(r *bufio.Reader) (source, dest net.Addr, err error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyHeaderV1MaxLen {
+			return nil, nil, fmt.Errorf("PROXY protocol v1 header too long")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v1 header")
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v1 family: %s", fields[1])
+	}
+	if len(fields) != 6 {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v1 header")
+	}
+	parse := func(ip, port string) (net.Addr, error) {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || addr.Is4() != (fields[1] == "TCP4") {
+			return nil, fmt.Errorf("invalid PROXY protocol v1 address: %s", ip)
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PROXY protocol v1 port: %s", port)
+		}
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(p))), nil
+	}
+	if source, err = parse(fields[2], fields[4]); err != nil {
+		return nil, nil, err
+	}
+	if dest, err = parse(fields[3], fields[5]); err != nil {
+		return nil, nil, err
+	}
+	return source, dest, nil
+}
+
+func readProxyHeaderV2(r *bufio.Reader) (source, dest net.Addr, err error) {
+	header := make([]byte, proxyHeaderV2Len)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[:len(proxyHeaderV2Signature)], proxyHeaderV2Signature) {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v2 signature")
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v2 version: %d", header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch header[12] & 0x0f {
+	case 0x00:
+		// LOCAL command, the connection was made by the proxy itself
+		return nil, nil, nil
+	case 0x01:
+	default:
+		return nil, nil, fmt.Errorf("invalid PROXY protocol v2 command: %d", header[12]&0x0f)
+	}
+
+	size := 0
+	switch header[13] >> 4 {
+	case 0x1:
+		size = net.IPv4len
+	case 0x2:
+		size = net.IPv6len
+	default:
+		// the addresses of other families are not used
+		return nil, nil, nil
+	}
+	if len(payload) < 2*size+4 {
+		return nil, nil, fmt.Errorf("PROXY protocol v2 header too short")
+	}
+	srcIP, _ := netip.AddrFromSlice(payload[:size])
+	dstIP, _ := netip.AddrFromSlice(payload[size : 2*size])
+	srcPort := binary.BigEndian.Uint16(payload[2*size:])
+	dstPort := binary.BigEndian.Uint16(payload[2*size+2:])
+	// the TLVs that may follow the addresses are ignored
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, srcPort)),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstIP, dstPort)), nil
+}
+
+// bufferedConn is a connection whose reads go through a buffered reader, so the bytes buffered while reading a
+// PROXY protocol header are not lost.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
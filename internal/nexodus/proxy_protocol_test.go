@@ -0,0 +1,67 @@
+package nexodus
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyProtocolHeader(t *testing.T) {
+	require := require.New(t)
+
+	rule, err := ParseProxyRule("tcp:443:10.0.0.1:8443,send-proxy=v2,accept-proxy=true", ProxyTypeEgress)
+	require.NoError(err)
+	require.Equal(ProxyOptions{sendProxy: proxyProtocolV2, acceptProxy: true}, rule.options)
+	require.Equal("tcp:443:10.0.0.1:8443,send-proxy=v2,accept-proxy=true", rule.String())
+
+	for _, tc := range []struct {
+		source, dest *net.TCPAddr
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("100.64.0.2"), Port: 40000}, &net.TCPAddr{IP: net.ParseIP("100.64.0.1"), Port: 443}},
+		{&net.TCPAddr{IP: net.ParseIP("200::2"), Port: 40000}, &net.TCPAddr{IP: net.ParseIP("200::1"), Port: 443}},
+	} {
+		for _, version := range []string{proxyProtocolV1, proxyProtocolV2} {
+			// the header is read back with the addresses it was written with, and the data after it is left alone
+			buf := &bytes.Buffer{}
+			require.NoError(writeProxyHeader(buf, version, tc.source, tc.dest))
+			buf.WriteString("GET / HTTP/1.1\r\n")
+			r := bufio.NewReader(buf)
+			source, dest, err := readProxyHeader(r)
+			require.NoError(err, version)
+			require.Equal(tc.source.String(), source.String(), version)
+			require.Equal(tc.dest.String(), dest.String(), version)
+			rest, err := r.ReadString('\n')
+			require.NoError(err)
+			require.Equal("GET / HTTP/1.1\r\n", rest)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	source := &net.TCPAddr{IP: net.ParseIP("100.64.0.2"), Port: 40000}
+	require.NoError(writeProxyHeader(buf, proxyProtocolV1, source, &net.TCPAddr{IP: net.ParseIP("200::1"), Port: 443}))
+	require.Equal("PROXY UNKNOWN\r\n", buf.String())
+	source2, dest, err := readProxyHeader(bufio.NewReader(buf))
+	require.NoError(err)
+	require.Nil(source2)
+	require.Nil(dest)
+
+	buf.Reset()
+	require.NoError(writeProxyHeader(buf, proxyProtocolV1, source, &net.TCPAddr{IP: net.ParseIP("100.64.0.1"), Port: 443}))
+	require.Equal("PROXY TCP4 100.64.0.2 100.64.0.1 40000 443\r\n", buf.String())
+
+	for _, invalid := range []string{
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 100.64.0.2 100.64.0.1 40000\r\n",
+		"PROXY TCP4 200::2 100.64.0.1 40000 443\r\n",
+		"PROXY TCP4 100.64.0.2 100.64.0.1 40000 70000\r\n",
+		"PROXY " + strings.Repeat("A", proxyHeaderV1MaxLen) + "\r\n",
+		"\r\n\r\n\x00\r\nQUIT\n\x11\x11\x00\x0c",
+	} {
+		_, _, err := readProxyHeader(bufio.NewReader(strings.NewReader(invalid)))
+		require.Error(err, invalid)
+	}
+}
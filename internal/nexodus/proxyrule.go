@@ -5,6 +5,9 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
 )
 
 type ProxyType int
@@ -30,6 +33,8 @@ type ProxyProtocol string
 const (
 	proxyProtocolTCP ProxyProtocol = "tcp"
 	proxyProtocolUDP ProxyProtocol = "udp"
+	// an http reverse proxy, it routes the requests by host and path
+	proxyProtocolHTTP ProxyProtocol = "http"
 )
 
 func parseProxyProtocol(protocol string) (ProxyProtocol, error) {
@@ -38,6 +43,8 @@ func parseProxyProtocol(protocol string) (ProxyProtocol, error) {
 		return proxyProtocolTCP, nil
 	case "udp":
 		return proxyProtocolUDP, nil
+	case "http":
+		return proxyProtocolHTTP, nil
 	default:
 		return "", fmt.Errorf("invalid protocol (%s)", protocol)
 	}
@@ -55,8 +62,236 @@ func (rule ProxyKey) String() string {
 
 type ProxyRule struct {
 	ProxyKey
-	dest   HostPort
-	stored bool
+	dest    HostPort
+	options ProxyOptions
+	stored  bool
+}
+
+// The strategies a proxy picks the destination of a new connection with.
+const (
+	proxyStrategyRoundRobin = "round-robin" // in turn, in proportion to their weights
+	proxyStrategyLeastConn  = "least-conn"  // the one with the fewest connections in progress for its weight
+	proxyStrategySourceHash = "source-hash" // the same one for every connection from a source address
+)
+
+// The active health checks of a proxy destination.
+const (
+	proxyCheckTCP  = "tcp"  // a connection to the destination can be established
+	proxyCheckHTTP = "http" // a GET request to the destination answers with a 2xx or 3xx status
+)
+
+// The versions of the PROXY protocol header sent to a destination.
+const (
+	proxyProtocolV1 = "v1"
+	proxyProtocolV2 = "v2"
+)
+
+const (
+	defaultProxyCheckPath     = "/"
+	defaultProxyCheckInterval = 10 * time.Second
+	defaultProxyFailTimeout   = 30 * time.Second
+	maxProxyWeight            = 100
+)
+
+// ProxyOptions tune how the destination of a proxy rule is picked and checked, they follow the destination of the
+// rule as comma-separated key=value pairs. The zero value of an option is its default.
+type ProxyOptions struct {
+	weight        int           // the share of the connections the destination gets relative to the others, 1 unless set
+	strategy      string        // how the destination of a new connection is picked, it applies to every rule of the listen port
+	check         string        // the active health check of the destination, none unless set
+	checkPath     string        // the path requested by the http health check
+	checkInterval time.Duration // how often the health of the destination is checked
+	maxFails      int           // the failed connections in a row after which the destination is ejected, 0 never ejects it
+	failTimeout   time.Duration // how long an ejected destination is left out
+	sendProxy     string        // the version of the PROXY protocol header sent to the destination, none unless set
+	acceptProxy   bool          // connections start with a PROXY protocol header, it applies to every rule of the listen port
+	host          string        // the host of the http requests routed to the destination, a leading *. matches any subdomain
+	path          string        // the path prefix of the http requests routed to the destination
+	setHeader     string        // a Name:Value header set on the http requests to the destination
+}
+
+func (o ProxyOptions) String() string {
+	var options []string
+	if o.weight != 0 {
+		options = append(options, fmt.Sprintf("weight=%d", o.weight))
+	}
+	if o.strategy != "" {
+		options = append(options, "strategy="+o.strategy)
+	}
+	if o.check != "" {
+		options = append(options, "check="+o.check)
+	}
+	if o.checkPath != "" {
+		options = append(options, "check-path="+o.checkPath)
+	}
+	if o.checkInterval != 0 {
+		options = append(options, "check-interval="+o.checkInterval.String())
+	}
+	if o.maxFails != 0 {
+		options = append(options, fmt.Sprintf("max-fails=%d", o.maxFails))
+	}
+	if o.failTimeout != 0 {
+		options = append(options, "fail-timeout="+o.failTimeout.String())
+	}
+	if o.sendProxy != "" {
+		options = append(options, "send-proxy="+o.sendProxy)
+	}
+	if o.acceptProxy {
+		options = append(options, "accept-proxy=true")
+	}
+	if o.host != "" {
+		options = append(options, "host="+o.host)
+	}
+	if o.path != "" {
+		options = append(options, "path="+o.path)
+	}
+	if o.setHeader != "" {
+		options = append(options, "set-header="+o.setHeader)
+	}
+	return strings.Join(options, ",")
+}
+
+func (o ProxyOptions) getWeight() int {
+	if o.weight == 0 {
+		return 1
+	}
+	return o.weight
+}
+
+func (o ProxyOptions) getCheckPath() string {
+	if o.checkPath == "" {
+		return defaultProxyCheckPath
+	}
+	return o.checkPath
+}
+
+func (o ProxyOptions) getCheckInterval() time.Duration {
+	if o.checkInterval == 0 {
+		return defaultProxyCheckInterval
+	}
+	return o.checkInterval
+}
+
+func (o ProxyOptions) getFailTimeout() time.Duration {
+	if o.failTimeout == 0 {
+		return defaultProxyFailTimeout
+	}
+	return o.failTimeout
+}
+
+func parseProxyOptions(options []string, key ProxyKey) (o ProxyOptions, err error) {
+	positive := func(key, value string) (int, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid %s (%s): must be a positive number", key, value)
+		}
+		return n, nil
+	}
+	duration := func(key, value string) (time.Duration, error) {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Second {
+			return 0, fmt.Errorf("invalid %s (%s): must be a duration of at least 1s", key, value)
+		}
+		return d, nil
+	}
+	for _, option := range options {
+		name, value, found := strings.Cut(option, "=")
+		if !found || value == "" {
+			return o, fmt.Errorf("invalid proxy rule option (%s): must be key=value", option)
+		}
+		switch name {
+		case "weight":
+			if o.weight, err = positive(name, value); err != nil {
+				return o, err
+			}
+			if o.weight > maxProxyWeight {
+				return o, fmt.Errorf("invalid weight (%s): must be at most %d", value, maxProxyWeight)
+			}
+		case "strategy":
+			switch value {
+			case proxyStrategyRoundRobin, proxyStrategyLeastConn, proxyStrategySourceHash:
+				o.strategy = value
+			default:
+				return o, fmt.Errorf("invalid strategy (%s): must be one of %s, %s or %s", value, proxyStrategyRoundRobin, proxyStrategyLeastConn, proxyStrategySourceHash)
+			}
+		case "check":
+			switch value {
+			case proxyCheckTCP, proxyCheckHTTP:
+				o.check = value
+			default:
+				return o, fmt.Errorf("invalid check (%s): must be %s or %s", value, proxyCheckTCP, proxyCheckHTTP)
+			}
+		case "check-path":
+			if !strings.HasPrefix(value, "/") {
+				return o, fmt.Errorf("invalid check-path (%s): must start with /", value)
+			}
+			o.checkPath = value
+		case "check-interval":
+			if o.checkInterval, err = duration(name, value); err != nil {
+				return o, err
+			}
+		case "max-fails":
+			if o.maxFails, err = positive(name, value); err != nil {
+				return o, err
+			}
+		case "fail-timeout":
+			if o.failTimeout, err = duration(name, value); err != nil {
+				return o, err
+			}
+		case "send-proxy":
+			switch value {
+			case proxyProtocolV1, proxyProtocolV2:
+				o.sendProxy = value
+			default:
+				return o, fmt.Errorf("invalid send-proxy (%s): must be %s or %s", value, proxyProtocolV1, proxyProtocolV2)
+			}
+		case "accept-proxy":
+			if o.acceptProxy, err = strconv.ParseBool(value); err != nil {
+				return o, fmt.Errorf("invalid accept-proxy (%s): must be true or false", value)
+			}
+		case "host":
+			host := strings.ToLower(value)
+			if strings.ContainsAny(strings.TrimPrefix(host, "*."), "*:/ ") {
+				return o, fmt.Errorf("invalid host (%s): must be a host name, optionally starting with *.", value)
+			}
+			o.host = host
+		case "path":
+			if !strings.HasPrefix(value, "/") {
+				return o, fmt.Errorf("invalid path (%s): must start with /", value)
+			}
+			o.path = value
+		case "set-header":
+			header, _, found := strings.Cut(value, ":")
+			if !found || !httpguts.ValidHeaderFieldName(header) {
+				return o, fmt.Errorf("invalid set-header (%s): must be Name:Value", value)
+			}
+			o.setHeader = value
+		default:
+			return o, fmt.Errorf("unknown proxy rule option (%s)", name)
+		}
+	}
+	if o.check != "" && key.protocol == proxyProtocolUDP {
+		return o, fmt.Errorf("health checks are only supported by tcp and http proxy rules")
+	}
+	if (o.host != "" || o.path != "" || o.setHeader != "") && key.protocol != proxyProtocolHTTP {
+		return o, fmt.Errorf("host, path and set-header are only supported by http proxy rules")
+	}
+	if (o.sendProxy != "" || o.acceptProxy) && key.protocol != proxyProtocolTCP {
+		return o, fmt.Errorf("the PROXY protocol is only supported by tcp proxy rules")
+	}
+	if o.acceptProxy && key.ruleType != ProxyTypeEgress {
+		return o, fmt.Errorf("accept-proxy is only supported by egress proxy rules")
+	}
+	if o.checkPath != "" && o.check != proxyCheckHTTP {
+		return o, fmt.Errorf("check-path requires check=%s", proxyCheckHTTP)
+	}
+	if o.checkInterval != 0 && o.check == "" {
+		return o, fmt.Errorf("check-interval requires a check")
+	}
+	if o.failTimeout != 0 && o.maxFails == 0 {
+		return o, fmt.Errorf("fail-timeout requires max-fails")
+	}
+	return o, nil
 }
 
 type HostPort struct {
@@ -70,7 +305,10 @@ func (hp HostPort) String() string {
 }
 
 func (rule ProxyRule) String() string {
-	// protocol:port:destination_ip:destination_port
+	// protocol:port:destination_ip:destination_port[,key=value...]
+	if options := rule.options.String(); options != "" {
+		return fmt.Sprintf("%s:%d:%s,%s", rule.protocol, rule.listenPort, rule.dest, options)
+	}
 	return fmt.Sprintf("%s:%d:%s", rule.protocol, rule.listenPort, rule.dest)
 }
 
@@ -90,8 +328,9 @@ func parsePort(portStr string) (int, error) {
 }
 
 func ParseProxyRule(rule string, ruleType ProxyType) (emptyRule ProxyRule, err error) {
-	// protocol:port:destination_ip:destination_port
-	parts := strings.Split(rule, ":")
+	// protocol:port:destination_ip:destination_port[,key=value...]
+	options := strings.Split(rule, ",")
+	parts := strings.Split(options[0], ":")
 	if len(parts) < 4 {
 		return emptyRule, fmt.Errorf("invalid proxy rule format, must specify 4 colon-separated values (%s)", rule)
 	}
@@ -100,6 +339,9 @@ func ParseProxyRule(rule string, ruleType ProxyType) (emptyRule ProxyRule, err e
 	if err != nil {
 		return emptyRule, err
 	}
+	if protocol == proxyProtocolHTTP && ruleType != ProxyTypeIngress {
+		return emptyRule, fmt.Errorf("http proxy rules are only supported as ingress rules")
+	}
 
 	port, err := parsePort(parts[1])
 	if err != nil {
@@ -122,15 +364,22 @@ func ParseProxyRule(rule string, ruleType ProxyType) (emptyRule ProxyRule, err e
 		return emptyRule, err
 	}
 
+	key := ProxyKey{
+		ruleType:   ruleType,
+		protocol:   protocol,
+		listenPort: port,
+	}
+	proxyOptions, err := parseProxyOptions(options[1:], key)
+	if err != nil {
+		return emptyRule, err
+	}
+
 	return ProxyRule{
-		ProxyKey: ProxyKey{
-			ruleType:   ruleType,
-			protocol:   protocol,
-			listenPort: port,
-		},
+		ProxyKey: key,
 		dest: HostPort{
 			host: destHost,
 			port: destPort,
 		},
+		options: proxyOptions,
 	}, nil
 }
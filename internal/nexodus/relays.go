@@ -0,0 +1,355 @@
+package nexodus
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+	"github.com/nexodus-io/nexodus/internal/util"
+)
+
+const (
+	// how often the latency to each relay is measured, and relays report their load
+	relayProbeInterval = 30 * time.Second
+	// relays whose latency is within this of the lowest one are as good, the relayed peers are spread across them
+	relayLatencyTolerance = 10 * time.Millisecond
+	// the load in KB/s at which a relay is picked half as often as an idle one
+	relayLoadUnit = 1024
+	// a relay reports its load again once it changed by more than this ratio
+	relayLoadReportChange = 0.2
+)
+
+// relayCandidate is a relay the traffic to a relayed peer can go through.
+type relayCandidate struct {
+	device  public.ModelsDevice
+	latency time.Duration // 0 while not measured yet
+}
+
+// healthyRelays returns the relays this device can relay traffic through, ordered by id.
+// assumes deviceCacheLock is held
+func (nx *Nexodus) healthyRelays() []relayCandidate {
+	var relays []relayCandidate
+	for _, d := range nx.deviceCache {
+		if d.device.Relay && d.peerHealthy && d.device.PublicKey != nx.wireguardPubKey {
+			relays = append(relays, relayCandidate{device: d.device, latency: d.relayLatency})
+		}
+	}
+	sort.Slice(relays, func(i, j int) bool {
+		return relays[i].device.Id < relays[j].device.Id
+	})
+	return relays
+}
+
+// pairRelays returns the relays the traffic between this device and a relayed peer can go through, ordered by id.
+// Both sides of a pair must pick the same relay, or each would receive the packets of the other from a relay that
+// does not route it, so the relays are ranked from what the apiserver reports to both: the relays both devices
+// reported a latency to, ranked by the sum of the two. While there are none, the relays that are online, or all of
+// them while none is.
+// assumes deviceCacheLock is held
+func (nx *Nexodus) pairRelays(local, peer public.ModelsDevice) []relayCandidate {
+	var ranked, online, all []relayCandidate
+	for _, d := range nx.deviceCache {
+		if !d.device.Relay || d.device.PublicKey == nx.wireguardPubKey {
+			continue
+		}
+		all = append(all, relayCandidate{device: d.device})
+		if d.device.Online {
+			online = append(online, relayCandidate{device: d.device})
+		}
+		localLatency, localOk := local.RelayLatencies[d.device.Id]
+		peerLatency, peerOk := peer.RelayLatencies[d.device.Id]
+		if localOk && peerOk {
+			ranked = append(ranked, relayCandidate{
+				device:  d.device,
+				latency: time.Duration(localLatency+peerLatency) * time.Millisecond,
+			})
+		}
+	}
+	relays := ranked
+	if len(relays) == 0 {
+		relays = online
+	}
+	if len(relays) == 0 {
+		relays = all
+	}
+	sort.Slice(relays, func(i, j int) bool {
+		return relays[i].device.Id < relays[j].device.Id
+	})
+	return relays
+}
+
+// pairRelay picks the relay for the traffic with a relayed peer from the pairRelays. A relay that this device has
+// not configured, or that fails its health checks here, is passed over for the next pick.
+// assumes deviceCacheLock is held
+func (nx *Nexodus) pairRelay(relays []relayCandidate, key string) string {
+	for len(relays) > 0 {
+		selected := selectRelay(relays, key)
+		if selected.Id == "" {
+			return ""
+		}
+		_, configured := nx.wgConfig.Peers[selected.PublicKey]
+		if configured && nx.deviceCache[selected.PublicKey].peerHealthy {
+			return selected.Id
+		}
+		remaining := make([]relayCandidate, 0, len(relays)-1)
+		for _, r := range relays {
+			if r.device.Id != selected.Id {
+				remaining = append(remaining, r)
+			}
+		}
+		relays = remaining
+	}
+	return ""
+}
+
+// primaryRelay returns the id of the relay that routes the whole vpc, which carries the traffic to the devices
+// that are not peered with directly and not assigned a relay of their own. When no relay is healthy yet, that
+// is the relay with the lowest id, so that only one relay routes the vpc.
+// assumes deviceCacheLock is held
+func (nx *Nexodus) primaryRelay(healthy []relayCandidate) string {
+	if len(healthy) > 0 {
+		return selectRelay(healthy, nx.deviceId).Id
+	}
+	primary := ""
+	for _, d := range nx.deviceCache {
+		if d.device.Relay && d.device.PublicKey != nx.wireguardPubKey && (primary == "" || d.device.Id < primary) {
+			primary = d.device.Id
+		}
+	}
+	return primary
+}
+
+// selectRelay picks the relay for the traffic hashed by key. The relays whose latency is close to the lowest one
+// are all good candidates, and the traffic is spread across them by rendezvous hashing weighted by the load each
+// relay reports. The choice only changes for the keys of a relay that fails or whose load changes.
+func selectRelay(relays []relayCandidate, key string) public.ModelsDevice {
+	best := time.Duration(0)
+	for _, r := range relays {
+		if r.latency > 0 && (best == 0 || r.latency < best) {
+			best = r.latency
+		}
+	}
+	tolerance := relayLatencyTolerance
+	if best/5 > tolerance {
+		tolerance = best / 5
+	}
+
+	var selected public.ModelsDevice
+	selectedScore := -1.0
+	for _, r := range relays {
+		if best > 0 && (r.latency == 0 || r.latency > best+tolerance) {
+			continue
+		}
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key + "/" + r.device.Id))
+		// a uniform value in (0, 1) from the hash
+		u := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+		weight := 1 / (1 + float64(r.device.RelayLoad)/relayLoadUnit)
+		score := -weight / math.Log(u)
+		if score > selectedScore {
+			selected = r.device
+			selectedScore = score
+		}
+	}
+	return selected
+}
+
+// relayPairKey hashes the traffic between two devices the same on both sides, so that both pick the same relay
+// from the pairRelays.
+func relayPairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "/" + b
+}
+
+// relayHostPrefixes returns the allowed ips of a relay as host prefixes, relays register theirs without a prefix length.
+func relayHostPrefixes(device public.ModelsDevice) []string {
+	var prefixes []string
+	for _, ip := range device.AllowedIps {
+		if !strings.Contains(ip, "/") {
+			if util.IsIPv6Address(ip) {
+				ip += "/128"
+			} else {
+				ip += "/32"
+			}
+		}
+		prefixes = append(prefixes, ip)
+	}
+	return prefixes
+}
+
+// probeRound runs one round of measurements at a time, a round still running when the next is due is not doubled.
+type probeRound struct {
+	mu      sync.Mutex
+	running bool
+}
+
+// begin starts a round, it returns false while the previous round is still running.
+func (r *probeRound) begin() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return false
+	}
+	r.running = true
+	return true
+}
+
+// end ends the round started by begin.
+func (r *probeRound) end() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running = false
+}
+
+// reconcileRelays measures and reports the latency to the relays when this device relays through them, or reports
+// the load of this device when it is a relay.
+func (nx *Nexodus) reconcileRelays(ctx context.Context, wg *sync.WaitGroup) {
+	if nx.relay {
+		nx.reportRelayLoad(ctx)
+		return
+	}
+
+	nx.reportRelayLatencies(ctx)
+
+	relays := map[string]string{}
+	nx.deviceCacheIterRead(func(d deviceCacheEntry) {
+		if d.device.Relay && d.peerHealthy && len(d.device.Ipv4TunnelIps) > 0 {
+			relays[d.device.PublicKey] = d.device.Ipv4TunnelIps[0].Address
+		}
+	})
+	if len(relays) == 0 {
+		return
+	}
+	if !nx.relayProbe.begin() {
+		return
+	}
+
+	util.GoWithWaitGroup(wg, func() {
+		defer nx.relayProbe.end()
+		latencies := map[string]time.Duration{}
+		var latenciesMu sync.Mutex
+		var probes sync.WaitGroup
+		for publicKey, address := range relays {
+			publicKey, address := publicKey, address
+			util.GoWithWaitGroup(&probes, func() {
+				result, err := nx.ping(address)
+				if err != nil {
+					nx.logger.Debugf("failed to measure the latency to relay %s: %v", publicKey, err)
+					return
+				}
+				latency, err := time.ParseDuration(result)
+				if err != nil {
+					return
+				}
+				latenciesMu.Lock()
+				latencies[publicKey] = latency
+				latenciesMu.Unlock()
+			})
+		}
+		probes.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+
+		nx.deviceCacheLock.Lock()
+		for publicKey := range relays {
+			if d, ok := nx.deviceCache[publicKey]; ok {
+				// a relay that did not answer is left to the health checks, it is not preferred meanwhile
+				d.relayLatency = latencies[publicKey]
+				nx.deviceCache[publicKey] = d
+			}
+		}
+		nx.deviceCacheLock.Unlock()
+	})
+}
+
+// reportRelayLoad reports how much traffic this relay carries, once it changed enough to spread the devices differently.
+func (nx *Nexodus) reportRelayLoad(ctx context.Context) {
+	peers, err := nx.DumpPeersDefault()
+	if err != nil {
+		nx.logger.Debugf("failed to get the peer stats for the relay load: %v", err)
+		return
+	}
+	var rxBytes int64
+	for _, p := range peers {
+		rxBytes += p.Rx
+	}
+	now := time.Now()
+	lastBytes, lastTime := nx.relayLoadBytes, nx.relayLoadTime
+	nx.relayLoadBytes, nx.relayLoadTime = rxBytes, now
+	if lastTime.IsZero() || rxBytes < lastBytes {
+		return
+	}
+
+	load := int32(float64(rxBytes-lastBytes) / 1024 / now.Sub(lastTime).Seconds())
+	if load < 1 {
+		// the generated client leaves out zero values, an idle relay reports the lowest load it can
+		load = 1
+	}
+	if nx.relayLoadReported != 0 && math.Abs(float64(load-nx.relayLoadReported)) <= relayLoadReportChange*float64(nx.relayLoadReported) {
+		return
+	}
+	if _, _, err := nx.client.DevicesApi.UpdateDevice(ctx, nx.deviceId).Update(public.ModelsUpdateDevice{
+		RelayLoad: load,
+	}).Execute(); err != nil {
+		nx.logger.Debugf("failed to report the relay load: %v", err)
+		return
+	}
+	nx.relayLoadReported = load
+}
+
+// reportRelayLatencies reports the latency to the relays measured by the last round, once it changed enough to rank
+// the relays differently. Both sides of a relayed pair rank the relays by what the two devices reported.
+func (nx *Nexodus) reportRelayLatencies(ctx context.Context) {
+	latencies := map[string]int32{}
+	nx.deviceCacheIterRead(func(d deviceCacheEntry) {
+		if d.device.Relay && d.peerHealthy && d.relayLatency > 0 {
+			// a relay measured below a millisecond is reported as one, 0 reads as not measured
+			latencies[d.device.Id] = int32(math.Max(1, math.Round(float64(d.relayLatency)/float64(time.Millisecond))))
+		}
+	})
+	if len(latencies) == 0 || !relayLatenciesChanged(nx.relayLatenciesReported, latencies) {
+		return
+	}
+	if _, _, err := nx.client.DevicesApi.UpdateDevice(ctx, nx.deviceId).Update(public.ModelsUpdateDevice{
+		RelayLatencies: latencies,
+	}).Execute(); err != nil {
+		nx.logger.Debugf("failed to report the relay latencies: %v", err)
+		return
+	}
+	nx.relayLatenciesReported = latencies
+}
+
+// relayLatenciesChanged returns true when a relay was added or dropped, or its latency changed by more than the
+// tolerance the relays are ranked with.
+func relayLatenciesChanged(reported, measured map[string]int32) bool {
+	if len(reported) != len(measured) {
+		return true
+	}
+	for id, latency := range measured {
+		last, ok := reported[id]
+		if !ok {
+			return true
+		}
+		tolerance := math.Max(float64(relayLatencyTolerance/time.Millisecond), relayLoadReportChange*float64(last))
+		if math.Abs(float64(latency-last)) > tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// relayName names a relay for the peers relayed through it.
+func relayName(relay public.ModelsDevice) string {
+	if relay.Hostname != "" {
+		return relay.Hostname
+	}
+	return relay.Id
+}
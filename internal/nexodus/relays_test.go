@@ -0,0 +1,219 @@
+package nexodus
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestSelectRelay(t *testing.T) {
+	require := require.New(t)
+	relay := func(id string, latency time.Duration, load int32) relayCandidate {
+		return relayCandidate{device: public.ModelsDevice{Id: id, RelayLoad: load}, latency: latency}
+	}
+	spread := func(relays []relayCandidate) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			counts[selectRelay(relays, fmt.Sprintf("pair-%d", i)).Id]++
+		}
+		return counts
+	}
+
+	// the same key always picks the same relay
+	relays := []relayCandidate{relay("a", 20*time.Millisecond, 0), relay("b", 22*time.Millisecond, 0)}
+	require.Equal(selectRelay(relays, "pair"), selectRelay(relays, "pair"))
+
+	// relays with about the same latency share the traffic
+	counts := spread(relays)
+	require.InDelta(500, counts["a"], 100)
+	require.InDelta(500, counts["b"], 100)
+
+	// a loaded relay gets less of it
+	counts = spread([]relayCandidate{relay("a", 20*time.Millisecond, 0), relay("b", 22*time.Millisecond, 3*relayLoadUnit)})
+	require.Greater(counts["a"], 2*counts["b"])
+
+	// a far away relay gets none of it
+	counts = spread([]relayCandidate{relay("a", 20*time.Millisecond, 0), relay("b", 80*time.Millisecond, 0)})
+	require.Equal(1000, counts["a"])
+
+	// until the latencies are measured, all relays are candidates
+	counts = spread([]relayCandidate{relay("a", 0, 0), relay("b", 0, 0)})
+	require.Len(counts, 2)
+}
+
+func TestBuildPeersConfigMultipleRelays(t *testing.T) {
+	require := require.New(t)
+	zLogger, _ := zap.NewDevelopment()
+
+	device := func(id string, relay bool, ip string) public.ModelsDevice {
+		return public.ModelsDevice{
+			Id:         id,
+			PublicKey:  id,
+			Relay:      relay,
+			AllowedIps: []string{ip},
+			Endpoints:  []public.ModelsEndpoint{{Address: "2.2.2.2:4321", Source: "stun"}},
+		}
+	}
+	nx := &Nexodus{
+		vpc: &public.ModelsVPC{
+			Ipv4Cidr: "100.64.0.0/10",
+			Ipv6Cidr: "200::/64",
+		},
+		deviceId:                 "local",
+		wireguardPubKey:          "local",
+		symmetricNat:             true,
+		nodeReflexiveAddressIPv4: netip.MustParseAddrPort("1.1.1.1:1234"),
+		logger:                   zLogger.Sugar(),
+		deviceCache:              map[string]deviceCacheEntry{},
+	}
+	for _, d := range []public.ModelsDevice{
+		device("relay-a", true, "100.64.0.2"),
+		device("relay-b", true, "100.64.0.3"),
+	} {
+		d.Online = true
+		entry := deviceCacheEntry{device: d}
+		nx.peeringReset(&entry)
+		entry.peerHealthy = true
+		nx.deviceCache[d.PublicKey] = entry
+	}
+	var relayed []string
+	for i := 0; i < 20; i++ {
+		d := device(fmt.Sprintf("peer-%02d", i), false, fmt.Sprintf("100.64.1.%d/32", i))
+		entry := deviceCacheEntry{device: d}
+		nx.peeringReset(&entry)
+		nx.deviceCache[d.PublicKey] = entry
+		relayed = append(relayed, d.Id)
+	}
+
+	nx.buildPeersConfig()
+
+	// one relay routes the whole vpc, the other only itself and the peers relayed through it
+	primary, secondary := "relay-a", "relay-b"
+	if nx.primaryRelayID == "relay-b" {
+		primary, secondary = secondary, primary
+	}
+	require.Equal([]string{"100.64.0.0/10", "200::/64"}, nx.wgConfig.Peers[primary].AllowedIPs)
+	secondaryIPs := nx.wgConfig.Peers[secondary].AllowedIPs
+	require.Contains(secondaryIPs, map[string]string{"relay-a": "100.64.0.2/32", "relay-b": "100.64.0.3/32"}[secondary])
+
+	// the relayed peers are spread across both relays
+	viaSecondary := 0
+	for _, id := range relayed {
+		entry := nx.deviceCache[id]
+		require.Equal(peeringMethodViaRelay, entry.peeringMethod)
+		if entry.relayID == secondary {
+			viaSecondary++
+			require.Contains(secondaryIPs, entry.device.AllowedIps[0])
+		} else {
+			require.Equal(primary, entry.relayID)
+			require.NotContains(secondaryIPs, entry.device.AllowedIps[0])
+		}
+	}
+	require.Greater(viaSecondary, 0)
+	require.Less(viaSecondary, len(relayed))
+
+	// once the apiserver reports the secondary relay offline, all the relayed peers go through the primary one
+	entry := nx.deviceCache[secondary]
+	entry.device.Online = false
+	nx.deviceCache[secondary] = entry
+	nx.buildPeersConfig()
+	for _, id := range relayed {
+		require.Equal(primary, nx.deviceCache[id].relayID)
+	}
+	require.Equal([]string{map[string]string{"relay-a": "100.64.0.2/32", "relay-b": "100.64.0.3/32"}[secondary]}, nx.wgConfig.Peers[secondary].AllowedIPs)
+}
+
+func TestBuildPeersConfigRelayPairs(t *testing.T) {
+	require := require.New(t)
+	zLogger, _ := zap.NewDevelopment()
+
+	device := func(id string, relay bool, ip string) public.ModelsDevice {
+		return public.ModelsDevice{
+			Id:         id,
+			PublicKey:  id,
+			Relay:      relay,
+			Online:     true,
+			AllowedIps: []string{ip},
+			Endpoints:  []public.ModelsEndpoint{{Address: "2.2.2.2:4321", Source: "stun"}},
+			// the local device is in the cache with the relay latencies it reported
+			Ipv4TunnelIps: []public.ModelsTunnelIP{{Address: strings.Split(ip, "/")[0]}},
+			Ipv6TunnelIps: []public.ModelsTunnelIP{{Address: "200::1"}},
+		}
+	}
+	devices := []public.ModelsDevice{
+		device("relay-a", true, "100.64.0.2"),
+		device("relay-b", true, "100.64.0.3"),
+	}
+	for i := 0; i < 20; i++ {
+		devices = append(devices, device(fmt.Sprintf("peer-%02d", i), false, fmt.Sprintf("100.64.1.%d/32", i)))
+	}
+	// each side sees a different relay as the closest one, the relay closest to both is the one to pick
+	devices[2].RelayLatencies = map[string]int32{"relay-a": 5, "relay-b": 40}
+	devices[3].RelayLatencies = map[string]int32{"relay-a": 60, "relay-b": 10}
+	side := func(id string, unhealthy string) *Nexodus {
+		nx := &Nexodus{
+			vpc: &public.ModelsVPC{
+				Ipv4Cidr: "100.64.0.0/10",
+				Ipv6Cidr: "200::/64",
+			},
+			deviceId:                 id,
+			wireguardPubKey:          id,
+			symmetricNat:             true,
+			nodeReflexiveAddressIPv4: netip.MustParseAddrPort("1.1.1.1:1234"),
+			logger:                   zLogger.Sugar(),
+			deviceCache:              map[string]deviceCacheEntry{},
+		}
+		for _, d := range devices {
+			if d.Id == id {
+				nx.TunnelIP, nx.TunnelIpV6 = d.Ipv4TunnelIps[0].Address, d.Ipv6TunnelIps[0].Address
+			}
+			entry := deviceCacheEntry{device: d}
+			nx.peeringReset(&entry)
+			if d.Relay {
+				entry.peerHealthy = d.Id != unhealthy
+			}
+			nx.deviceCache[d.PublicKey] = entry
+		}
+		nx.buildPeersConfig()
+		return nx
+	}
+	a := side("peer-00", "")
+	b := side("peer-01", "")
+
+	// both sides route the pair through the same relay, and that relay accepts the packets of the other side
+	relayID := a.deviceCache["peer-01"].relayID
+	require.Equal("relay-b", relayID)
+	require.Equal(relayID, b.deviceCache["peer-00"].relayID)
+	for _, side := range []struct {
+		nx   *Nexodus
+		peer string
+	}{{a, "100.64.1.1/32"}, {b, "100.64.1.0/32"}} {
+		if relayID == side.nx.primaryRelayID {
+			require.Contains(side.nx.wgConfig.Peers[relayID].AllowedIPs, "100.64.0.0/10")
+		} else {
+			require.Contains(side.nx.wgConfig.Peers[relayID].AllowedIPs, side.peer)
+		}
+	}
+
+	// a relay that fails the health checks of this device is passed over
+	a = side("peer-00", "relay-b")
+	require.Equal("relay-a", a.deviceCache["peer-01"].relayID)
+}
+
+func TestRelayLatenciesChanged(t *testing.T) {
+	require := require.New(t)
+	reported := map[string]int32{"relay-a": 20, "relay-b": 100}
+	require.False(relayLatenciesChanged(reported, map[string]int32{"relay-a": 25, "relay-b": 115}))
+	require.True(relayLatenciesChanged(reported, map[string]int32{"relay-a": 35, "relay-b": 100}))
+	require.True(relayLatenciesChanged(reported, map[string]int32{"relay-a": 20, "relay-b": 130}))
+	require.True(relayLatenciesChanged(reported, map[string]int32{"relay-a": 20}))
+	require.True(relayLatenciesChanged(reported, map[string]int32{"relay-a": 20, "relay-c": 100}))
+	require.True(relayLatenciesChanged(nil, reported))
+}
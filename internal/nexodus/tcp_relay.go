@@ -0,0 +1,257 @@
+package nexodus
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// how long to wait before reconnecting to the tcp relay
+	tcpRelayRetryInterval = 10 * time.Second
+	// how often an empty frame is sent to keep the websocket from idling out
+	tcpRelayKeepalive = 30 * time.Second
+	// how long a peer stays on the tcp relay before peering over UDP is tried again, once UDP works
+	tcpRelayUpgradeInterval = 5 * time.Minute
+	// every packet relayed over the websocket is preceded by the id of the peer
+	tcpRelayFrameHeader = 16
+	// wireguard packets are much smaller, larger frames are dropped by the api-server
+	tcpRelayMaxFrame = 64 * 1024
+)
+
+// tcpRelayClient tunnels wireguard packets over a websocket to the api-server, for networks that block UDP.
+// Every peer reached through it gets a UDP socket on the loopback interface, which is configured as the
+// wireguard endpoint of the peer. The packets wireguard sends to the socket are relayed to the peer, and
+// the packets relayed from the peer are sent to wireguard from the socket.
+type tcpRelayClient struct {
+	logger    *zap.SugaredLogger
+	apiURLs   []*url.URL
+	tlsConfig *tls.Config
+	// the index of the api-server the websocket is connected to, the next one is tried when it is unreachable
+	apiServer int
+	// the wireguard listen port on the loopback interface
+	wgAddr *net.UDPAddr
+
+	mu    sync.Mutex
+	token string
+	conn  *websocket.Conn
+	peers map[uuid.UUID]*net.UDPConn
+}
+
+func newTCPRelayClient(logger *zap.SugaredLogger, apiURLs []*url.URL, insecureSkipTlsVerify bool, listenPort int) *tcpRelayClient {
+	return &tcpRelayClient{
+		logger:  logger,
+		apiURLs: apiURLs,
+		tlsConfig: &tls.Config{
+			InsecureSkipVerify: insecureSkipTlsVerify, // #nosec G402
+		},
+		wgAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: listenPort},
+		peers:  map[uuid.UUID]*net.UDPConn{},
+	}
+}
+
+// setToken sets the device token used to connect to the api-server.
+func (r *tcpRelayClient) setToken(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.token = token
+}
+
+// connected returns true while the websocket to the api-server is up.
+func (r *tcpRelayClient) connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn != nil
+}
+
+// run keeps a websocket to the api-server connected and delivers the packets relayed from peers to wireguard.
+func (r *tcpRelayClient) run(ctx context.Context, deviceID string) {
+	defer r.close()
+	for {
+		if err := r.connectAndReceive(ctx, deviceID); err != nil {
+			r.logger.Debugf("tcp relay connection failed, retrying in %v: %v", tcpRelayRetryInterval, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(tcpRelayRetryInterval):
+		}
+	}
+}
+
+// tcpRelayURL returns the url of the websocket that relays the packets of a device through an apiserver.
+func tcpRelayURL(apiURL *url.URL, deviceID string) string {
+	wsURL := *apiURL
+	wsURL.Scheme = "wss"
+	if apiURL.Scheme == "http" {
+		wsURL.Scheme = "ws"
+	}
+	return fmt.Sprintf("%s/api/devices/%s/tcp-relay", wsURL.String(), deviceID)
+}
+
+func (r *tcpRelayClient) connectAndReceive(ctx context.Context, deviceID string) error {
+	r.mu.Lock()
+	token := r.token
+	r.mu.Unlock()
+	if token == "" {
+		return fmt.Errorf("no device token to authenticate with")
+	}
+
+	apiURL := r.apiURLs[r.apiServer]
+	config, err := websocket.NewConfig(tcpRelayURL(apiURL, deviceID), apiURL.String())
+	if err != nil {
+		return err
+	}
+	config.TlsConfig = r.tlsConfig
+	config.Dialer = &net.Dialer{Timeout: 10 * time.Second}
+	config.Header.Set("Authorization", "Bearer "+token)
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		r.apiServer = (r.apiServer + 1) % len(r.apiURLs)
+		return err
+	}
+	conn.MaxPayloadBytes = tcpRelayMaxFrame
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		keepalive := time.NewTicker(tcpRelayKeepalive)
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = conn.Close()
+				return
+			case <-done:
+				return
+			case <-keepalive.C:
+				if err := websocket.Message.Send(conn, []byte{}); err != nil {
+					_ = conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	r.mu.Lock()
+	r.conn = conn
+	r.mu.Unlock()
+	r.logger.Debug("connected to the tcp relay")
+	defer func() {
+		r.mu.Lock()
+		r.conn = nil
+		r.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	for {
+		var frame []byte
+		if err := websocket.Message.Receive(conn, &frame); err != nil {
+			return err
+		}
+		if len(frame) <= tcpRelayFrameHeader {
+			continue
+		}
+		peerID, err := uuid.FromBytes(frame[:tcpRelayFrameHeader])
+		if err != nil {
+			continue
+		}
+		r.mu.Lock()
+		sock, ok := r.peers[peerID]
+		r.mu.Unlock()
+		if !ok {
+			// we don't use the tcp relay for this peer
+			continue
+		}
+		if _, err := sock.WriteToUDP(frame[tcpRelayFrameHeader:], r.wgAddr); err != nil {
+			r.logger.Debugf("failed to deliver a relayed packet from peer %s: %v", peerID, err)
+		}
+	}
+}
+
+// endpoint returns the loopback address wireguard should use as the endpoint of a peer reached through the tcp relay.
+func (r *tcpRelayClient) endpoint(peerID string) (string, error) {
+	id, err := uuid.Parse(peerID)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sock, ok := r.peers[id]; ok {
+		return sock.LocalAddr().String(), nil
+	}
+	sock, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return "", err
+	}
+	r.peers[id] = sock
+	go r.send(id, sock)
+	return sock.LocalAddr().String(), nil
+}
+
+// send relays the packets wireguard sends to the socket of a peer, until the socket is closed.
+func (r *tcpRelayClient) send(peerID uuid.UUID, sock *net.UDPConn) {
+	buf := make([]byte, tcpRelayMaxFrame)
+	copy(buf, peerID[:])
+	for {
+		n, addr, err := sock.ReadFromUDP(buf[tcpRelayFrameHeader:])
+		if err != nil {
+			return
+		}
+		if addr.Port != r.wgAddr.Port {
+			// only wireguard sends to the socket
+			continue
+		}
+		r.mu.Lock()
+		conn := r.conn
+		r.mu.Unlock()
+		if conn == nil {
+			continue
+		}
+		if err := websocket.Message.Send(conn, buf[:tcpRelayFrameHeader+n]); err != nil {
+			r.logger.Debugf("failed to relay a packet to peer %s: %v", peerID, err)
+		}
+	}
+}
+
+// release closes the socket of a peer that is no longer reached through the tcp relay.
+func (r *tcpRelayClient) release(peerID string) {
+	id, err := uuid.Parse(peerID)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sock, ok := r.peers[id]; ok {
+		_ = sock.Close()
+		delete(r.peers, id)
+	}
+}
+
+func (r *tcpRelayClient) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, sock := range r.peers {
+		_ = sock.Close()
+		delete(r.peers, id)
+	}
+}
+
+// tcpRelayUpgradeDue determines if peering with a peer reached through the tcp relay should be retried over UDP.
+// That is the case once UDP works again: a stun request from the wireguard port succeeded, or the relay node is
+// healthy. When only the path to the peer blocks UDP, the retries are spaced by tcpRelayUpgradeInterval.
+func (nx *Nexodus) tcpRelayUpgradeDue(d deviceCacheEntry, healthyRelay bool) bool {
+	if d.peeringMethod != peeringMethodViaTCPRelay || time.Since(d.peeringTime) < tcpRelayUpgradeInterval {
+		return false
+	}
+	return healthyRelay || nx.udpWorkingAt.After(d.peeringTime)
+}
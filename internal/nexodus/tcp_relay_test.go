@@ -0,0 +1,122 @@
+package nexodus
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+func TestTCPRelayClient(t *testing.T) {
+	// a minimal relay service that swaps the peer id of each frame for the id of the sender
+	var mu sync.Mutex
+	conns := map[uuid.UUID]*websocket.Conn{}
+	server := httptest.NewTLSServer(websocket.Server{Handler: func(ws *websocket.Conn) {
+		require.Equal(t, "Bearer token", ws.Request().Header.Get("Authorization"))
+		parts := strings.Split(ws.Request().URL.Path, "/")
+		deviceID := uuid.MustParse(parts[3])
+		mu.Lock()
+		conns[deviceID] = ws
+		mu.Unlock()
+		for {
+			var frame []byte
+			if err := websocket.Message.Receive(ws, &frame); err != nil {
+				return
+			}
+			peerID := uuid.Must(uuid.FromBytes(frame[:tcpRelayFrameHeader]))
+			copy(frame, deviceID[:])
+			mu.Lock()
+			peer := conns[peerID]
+			mu.Unlock()
+			_ = websocket.Message.Send(peer, frame)
+		}
+	}})
+	defer server.Close()
+	apiURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// each device has a socket standing in for its wireguard listen port
+	newDevice := func(deviceID uuid.UUID) (*tcpRelayClient, *net.UDPConn) {
+		wg, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = wg.Close() })
+		relay := newTCPRelayClient(zap.NewNop().Sugar(), []*url.URL{apiURL}, true, wg.LocalAddr().(*net.UDPAddr).Port)
+		relay.setToken("token")
+		go relay.run(ctx, deviceID.String())
+		require.Eventually(t, relay.connected, 5*time.Second, 10*time.Millisecond)
+		return relay, wg
+	}
+	a, b := uuid.New(), uuid.New()
+	relayA, wgA := newDevice(a)
+	relayB, wgB := newDevice(b)
+
+	endpointOfB, err := relayA.endpoint(b.String())
+	require.NoError(t, err)
+	again, err := relayA.endpoint(b.String())
+	require.NoError(t, err)
+	require.Equal(t, endpointOfB, again)
+	endpointOfA, err := relayB.endpoint(a.String())
+	require.NoError(t, err)
+
+	// a packet wireguard sends to the endpoint of the peer arrives at the peer from the endpoint it uses for us
+	dst, err := net.ResolveUDPAddr("udp4", endpointOfB)
+	require.NoError(t, err)
+	_, err = wgA.WriteToUDP([]byte("handshake"), dst)
+	require.NoError(t, err)
+	buf := make([]byte, 1500)
+	require.NoError(t, wgB.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, from, err := wgB.ReadFromUDP(buf)
+	require.NoError(t, err)
+	require.Equal(t, "handshake", string(buf[:n]))
+	require.Equal(t, endpointOfA, from.String())
+
+	// packets from peers that are not reached through the tcp relay are dropped
+	relayB.release(a.String())
+	_, err = wgA.WriteToUDP([]byte("handshake"), dst)
+	require.NoError(t, err)
+	require.NoError(t, wgB.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, _, err = wgB.ReadFromUDP(buf)
+	require.Error(t, err)
+}
+
+func TestTCPRelayUpgradeDue(t *testing.T) {
+	nx := &Nexodus{}
+	d := deviceCacheEntry{
+		peeringMethod: peeringMethodViaTCPRelay,
+		peeringTime:   time.Now().Add(-2 * tcpRelayUpgradeInterval),
+	}
+
+	// UDP is still blocked
+	require.False(t, nx.tcpRelayUpgradeDue(d, false))
+	// the relay node is reachable over UDP
+	require.True(t, nx.tcpRelayUpgradeDue(d, true))
+
+	// a stun request succeeded after peering through the tcp relay
+	nx.udpWorkingAt = time.Now()
+	require.True(t, nx.tcpRelayUpgradeDue(d, false))
+
+	// but not right after falling back to the tcp relay
+	d.peeringTime = time.Now().Add(-time.Minute)
+	require.False(t, nx.tcpRelayUpgradeDue(d, true))
+
+	d.peeringMethod = peeringMethodReflexive
+	d.peeringTime = time.Now().Add(-2 * tcpRelayUpgradeInterval)
+	require.False(t, nx.tcpRelayUpgradeDue(d, true))
+}
+
+func TestTCPRelayURL(t *testing.T) {
+	require := require.New(t)
+	require.Equal("wss://api.example.com/api/devices/device/tcp-relay", tcpRelayURL(&url.URL{Scheme: "https", Host: "api.example.com"}, "device"))
+	require.Equal("ws://127.0.0.1:8080/api/devices/device/tcp-relay", tcpRelayURL(&url.URL{Scheme: "http", Host: "127.0.0.1:8080"}, "device"))
+}
@@ -0,0 +1,63 @@
+package nexodus
+
+import (
+	"context"
+	"time"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+// how often the status of the tunnels to the peers is reported to the apiserver
+const telemetryInterval = time.Minute
+
+// reportTelemetry reports the status of the tunnels to the peers to the apiserver, which combines the reports of all
+// the devices of the vpc into its connectivity matrix.
+func (nx *Nexodus) reportTelemetry(ctx context.Context) {
+	_, _, err := nx.client.DevicesApi.ReportDeviceTelemetry(ctx, nx.deviceId).Telemetry(public.ModelsReportDeviceTelemetry{
+		Peers: nx.peerTelemetry(),
+	}).Execute()
+	if err != nil {
+		nx.logger.Debugf("failed to report the peer telemetry: %v", err)
+	}
+}
+
+// peerTelemetry summarizes the status of the tunnel to each peer.
+func (nx *Nexodus) peerTelemetry() []public.ModelsPeerTelemetry {
+	nx.deviceCacheLock.RLock()
+	defer nx.deviceCacheLock.RUnlock()
+
+	peers := []public.ModelsPeerTelemetry{}
+	for _, d := range nx.deviceCache {
+		if d.device.PublicKey == nx.wireguardPubKey {
+			continue
+		}
+		peer := public.ModelsPeerTelemetry{
+			PeerId:        d.device.Id,
+			PeeringMethod: d.peeringMethod,
+			Status:        peerConnectivity(d),
+			RxBytes:       d.lastRxBytes,
+			TxBytes:       d.lastTxBytes,
+		}
+		if !d.lastHandshakeTime.IsZero() {
+			peer.LatestHandshake = d.lastHandshakeTime.UTC().Format(time.RFC3339)
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// peerConnectivity classifies the tunnel to a peer as direct, relayed, failing or idle.
+func peerConnectivity(d deviceCacheEntry) string {
+	switch d.peeringMethod {
+	case peeringMethodOnDemandIdle:
+		return "idle"
+	case peeringMethodViaRelay, peeringMethodViaTCPRelay, peeringMethodViaHub:
+		return "relayed"
+	case peeringMethodNone:
+		return "failing"
+	}
+	if !d.peerHealthy {
+		return "failing"
+	}
+	return "direct"
+}
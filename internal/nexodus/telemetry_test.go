@@ -0,0 +1,38 @@
+package nexodus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestPeerTelemetry(t *testing.T) {
+	require := require.New(t)
+	nx := &Nexodus{
+		wireguardPubKey: "self",
+		deviceCache: map[string]deviceCacheEntry{
+			"self":    {device: public.ModelsDevice{Id: "self", PublicKey: "self"}},
+			"direct":  {device: public.ModelsDevice{Id: "direct", PublicKey: "direct"}, peeringMethod: peeringMethodReflexive, peerHealth: peerHealth{peerHealthy: true, lastRxBytes: 10, lastTxBytes: 20}},
+			"down":    {device: public.ModelsDevice{Id: "down", PublicKey: "down"}, peeringMethod: peeringMethodDirectLocal},
+			"relayed": {device: public.ModelsDevice{Id: "relayed", PublicKey: "relayed"}, peeringMethod: peeringMethodViaRelay},
+			"idle":    {device: public.ModelsDevice{Id: "idle", PublicKey: "idle"}, peeringMethod: peeringMethodOnDemandIdle},
+		},
+	}
+
+	status := map[string]string{}
+	for _, peer := range nx.peerTelemetry() {
+		status[peer.PeerId] = peer.Status
+		if peer.PeerId == "direct" {
+			require.Equal(int64(10), peer.RxBytes)
+			require.Equal(int64(20), peer.TxBytes)
+		}
+	}
+	require.Equal(map[string]string{
+		"direct":  "direct",
+		"down":    "failing",
+		"relayed": "relayed",
+		"idle":    "idle",
+	}, status)
+}
@@ -0,0 +1,28 @@
+package nexodus
+
+import (
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+const (
+	// the vpc topologies, see models.VPC
+	topologyHubAndSpoke = "hub-and-spoke"
+	topologyGroups      = "groups"
+)
+
+// topologyPeerWanted determines if the vpc topology calls for this device to peer directly with another device.
+// The relays are the hubs of the vpc, they peer with every device. Devices that do not peer with each other
+// reach each other through the relay, like the peers that can only be reached using peeringMethodViaRelay.
+// Until the vpc has a relay there is no hub to go through, so every device peers with every other one.
+func (nx *Nexodus) topologyPeerWanted(local, peer public.ModelsDevice, hasRelay bool) bool {
+	if nx.vpc == nil || nx.relay || peer.Relay || !hasRelay {
+		return true
+	}
+	switch nx.vpc.Topology {
+	case topologyHubAndSpoke:
+		return false
+	case topologyGroups:
+		return local.PeeringGroup != "" && local.PeeringGroup == peer.PeeringGroup
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package nexodus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nexodus-io/nexodus/internal/api/public"
+)
+
+func TestTopologyPeerWanted(t *testing.T) {
+	hub := public.ModelsDevice{PublicKey: "hub", Relay: true}
+	east1 := public.ModelsDevice{PublicKey: "east1", PeeringGroup: "east"}
+	east2 := public.ModelsDevice{PublicKey: "east2", PeeringGroup: "east"}
+	west := public.ModelsDevice{PublicKey: "west", PeeringGroup: "west"}
+	ungrouped := public.ModelsDevice{PublicKey: "ungrouped"}
+
+	nx := &Nexodus{vpc: &public.ModelsVPC{Topology: "full-mesh"}}
+	require.True(t, nx.topologyPeerWanted(east1, west, true))
+
+	// vpcs created before topologies existed are full mesh
+	nx.vpc.Topology = ""
+	require.True(t, nx.topologyPeerWanted(east1, west, true))
+
+	nx.vpc.Topology = topologyHubAndSpoke
+	require.True(t, nx.topologyPeerWanted(east1, hub, true))
+	require.False(t, nx.topologyPeerWanted(east1, east2, true))
+
+	nx.vpc.Topology = topologyGroups
+	require.True(t, nx.topologyPeerWanted(east1, hub, true))
+	require.True(t, nx.topologyPeerWanted(east1, east2, true))
+	require.False(t, nx.topologyPeerWanted(east1, west, true))
+	require.False(t, nx.topologyPeerWanted(ungrouped, ungrouped, true))
+
+	// without a relay there is no hub, the devices stay a full mesh until one joins
+	require.True(t, nx.topologyPeerWanted(east1, west, false))
+	nx.vpc.Topology = topologyHubAndSpoke
+	require.True(t, nx.topologyPeerWanted(east1, east2, false))
+
+	// the hub peers with every device
+	nx.relay = true
+	require.True(t, nx.topologyPeerWanted(hub, east1, true))
+	require.True(t, nx.topologyPeerWanted(hub, west, true))
+}
@@ -1,20 +1,22 @@
 package nexodus
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/nexodus-io/nexodus/internal/state"
 	"io"
 	"net"
+	"net/netip"
 	"os"
 	"strconv"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/gopkg/util/logger"
 
+	"github.com/nexodus-io/nexodus/internal/api/public"
 	"github.com/nexodus-io/nexodus/internal/util"
 	"go.uber.org/zap"
 	"golang.zx2c4.com/wireguard/tun/netstack"
@@ -27,7 +29,9 @@ type UsProxy struct {
 	debugTraffic      bool
 	mu                sync.RWMutex
 	rules             []ProxyRule
+	backends          map[ProxyRule]*proxyBackend // the health and load of the destination of each rule
 	connectionCounter uint64
+	lookupPeer        func(ip netip.Addr) (public.ModelsDevice, bool) // finds the peer of a tunnel IP, for the identity headers of http rules
 	userspaceNet      *netstack.Net
 	proxyCtx          context.Context
 	proxyCancel       context.CancelFunc
@@ -50,9 +54,17 @@ func (nx *Nexodus) UserspaceProxyAdd(newRule ProxyRule) (*UsProxy, error) {
 
 	proxy, found := nx.proxies[newRule.ProxyKey]
 	if !found {
+		// tcp and http rules listen on the same tcp port
+		for key := range nx.proxies {
+			if key.ruleType == newRule.ruleType && key.listenPort == newRule.listenPort && key.protocol != proxyProtocolUDP && newRule.protocol != proxyProtocolUDP {
+				return nil, fmt.Errorf("port %d is used by %s %s proxy rules", newRule.listenPort, key.protocol, key.ruleType)
+			}
+		}
 		proxy = &UsProxy{
-			key:    newRule.ProxyKey,
-			logger: nx.logger.With("proxy", newRule.ruleType, "key", newRule.ProxyKey),
+			key:        newRule.ProxyKey,
+			logger:     nx.logger.With("proxy", newRule.ruleType, "key", newRule.ProxyKey),
+			backends:   map[ProxyRule]*proxyBackend{},
+			lookupPeer: nx.peerByTunnelIP,
 		}
 		proxy.debugTraffic, _ = strconv.ParseBool(os.Getenv("NEXD_PROXY_DEBUG_TRAFFIC"))
 		nx.proxies[newRule.ProxyKey] = proxy
@@ -67,7 +79,11 @@ func (nx *Nexodus) UserspaceProxyAdd(newRule ProxyRule) (*UsProxy, error) {
 	proxy.mu.Lock()
 	defer proxy.mu.Unlock()
 
+	if newRule.options.strategy != "" && len(proxy.rules) > 0 && proxy.strategy() != newRule.options.strategy {
+		return proxy, fmt.Errorf("the %s proxy rules of port %d use the %s strategy", newRule.ruleType, newRule.listenPort, proxy.strategy())
+	}
 	proxy.rules = append(proxy.rules, newRule)
+	proxy.backends[newRule] = newProxyBackend(newRule)
 	return proxy, nil
 }
 
@@ -89,6 +105,7 @@ func (nx *Nexodus) UserspaceProxyRemove(cmpProxy ProxyRule) (*UsProxy, error) {
 	for i, rule := range proxy.rules {
 		if rule == cmpProxy {
 			proxy.rules = append(proxy.rules[:i], proxy.rules[i+1:]...)
+			delete(proxy.backends, rule)
 			if len(proxy.rules) == 0 {
 				proxy.Stop()
 				delete(nx.proxies, cmpProxy.ProxyKey)
@@ -165,7 +182,11 @@ func (proxy *UsProxy) Start(ctx context.Context, wg *sync.WaitGroup, net *netsta
 	}
 	proxy.proxyCtx, proxy.proxyCancel = context.WithCancel(ctx)
 	proxy.userspaceNet = net
-	proxy.wg.Add(1)
+	proxy.wg.Add(2)
+	util.GoWithWaitGroup(wg, func() {
+		defer proxy.wg.Done()
+		proxy.runHealthChecks(proxy.proxyCtx)
+	})
 	util.GoWithWaitGroup(wg, func() {
 		defer proxy.wg.Done()
 		for {
@@ -197,6 +218,8 @@ func (proxy *UsProxy) run(ctx context.Context, proxyWg *sync.WaitGroup) error {
 		return proxy.runTCP(ctx, proxyWg)
 	case proxyProtocolUDP:
 		return proxy.runUDP(ctx, proxyWg)
+	case proxyProtocolHTTP:
+		return proxy.runHTTP(ctx, proxyWg)
 	default:
 		return fmt.Errorf("unexpected proxy protocol: %v", proxy.key.protocol)
 	}
@@ -413,24 +436,17 @@ func (proxyConn *udpProxyConn) writeBackToOriginator(buffer []byte, n int) error
 	return err
 }
 
-func (proxy *UsProxy) NextDest() HostPort {
-	proxy.mu.RLock()
-	defer proxy.mu.RUnlock()
-
-	counter := atomic.AddUint64(&proxy.connectionCounter, 1)
-
-	index := counter % uint64(len(proxy.rules))
-	return proxy.rules[index].dest
-}
-
 func (proxy *UsProxy) createUDPProxyConn(ctx context.Context, proxyWg *sync.WaitGroup, proxyConn *udpProxyConn) error {
 	var err error
-	dest := proxy.NextDest()
+	backend := proxy.NextDest(proxyConn.clientAddr)
+	dest := backend.rule.dest
 	logger := proxy.logger.With("dest", dest)
 
 	if proxy.key.ruleType == ProxyTypeEgress {
 		newConn, err := proxy.userspaceNet.DialUDP(nil, &net.UDPAddr{Port: dest.port, IP: net.ParseIP(dest.host)})
+		backend.dialed(err)
 		if err != nil {
+			backend.release()
 			return fmt.Errorf("Error dialing UDP proxy destination: %w", err)
 		}
 		proxyConn.goProxyConn = newConn
@@ -438,16 +454,20 @@ func (proxy *UsProxy) createUDPProxyConn(ctx context.Context, proxyWg *sync.Wait
 		udpDest := net.JoinHostPort(dest.host, fmt.Sprintf("%d", dest.port))
 		addr, err := net.ResolveUDPAddr("udp", udpDest)
 		if err != nil {
+			backend.release()
 			return fmt.Errorf("Failed to resolve UDP address: %w", err)
 		}
 		proxyConn.proxyConn, err = net.DialUDP("udp", nil, addr)
+		backend.dialed(err)
 		if err != nil {
+			backend.release()
 			return fmt.Errorf("Failed to Dial UDP destination %s: %w", udpDest, err)
 		}
 	}
 
 	// Start a goroutine to handle proxying data from the destination back to the client.
 	util.GoWithWaitGroup(proxyWg, func() {
+		defer backend.release()
 		buf := make([]byte, udpMaxPayloadSize)
 		var n int
 		// Handle proxying data from the destination back to the client.
@@ -509,14 +529,17 @@ func (proxy *UsProxy) createUDPProxyConn(ctx context.Context, proxyWg *sync.Wait
 	return nil
 }
 
-func (proxy *UsProxy) runTCP(ctx context.Context, proxyWg *sync.WaitGroup) error {
-	var l net.Listener
-	var err error
+// listenTCP listens on the port of the proxy, on the local network for egress rules and in the wireguard tunnel for
+// ingress rules.
+func (proxy *UsProxy) listenTCP() (net.Listener, error) {
 	if proxy.key.ruleType == ProxyTypeEgress {
-		l, err = net.Listen(fmt.Sprintf("%v", proxy.key.protocol), fmt.Sprintf(":%d", proxy.key.listenPort))
-	} else {
-		l, err = proxy.userspaceNet.ListenTCP(&net.TCPAddr{Port: proxy.key.listenPort})
+		return net.Listen("tcp", fmt.Sprintf(":%d", proxy.key.listenPort))
 	}
+	return proxy.userspaceNet.ListenTCP(&net.TCPAddr{Port: proxy.key.listenPort})
+}
+
+func (proxy *UsProxy) runTCP(ctx context.Context, proxyWg *sync.WaitGroup) error {
+	l, err := proxy.listenTCP()
 	if err != nil {
 		proxy.logger.Error("Error creating listener: ", err)
 		return err
@@ -573,25 +596,47 @@ func (proxy *UsProxy) runTCP(ctx context.Context, proxyWg *sync.WaitGroup) error
 func (proxy *UsProxy) handleTCPConnection(ctx context.Context, proxyWg *sync.WaitGroup, inConn net.Conn) error {
 	defer util.IgnoreError(inConn.Close)
 
-	dest := proxy.NextDest()
+	// the addresses the connection is reported with to a destination that receives a PROXY protocol header
+	source, local := inConn.RemoteAddr(), inConn.LocalAddr()
+	proxy.mu.RLock()
+	acceptProxy := proxy.acceptProxy()
+	proxy.mu.RUnlock()
+	if acceptProxy {
+		conn := &bufferedConn{Conn: inConn, reader: bufio.NewReader(inConn)}
+		_ = inConn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		headerSource, headerDest, err := readProxyHeader(conn.reader)
+		if err != nil {
+			return fmt.Errorf("failed to read the PROXY protocol header from %s: %w", inConn.RemoteAddr(), err)
+		}
+		_ = inConn.SetReadDeadline(time.Time{})
+		if headerSource != nil {
+			source, local = headerSource, headerDest
+		}
+		inConn = conn
+	}
+
+	backend := proxy.NextDest(source)
+	defer backend.release()
+	dest := backend.rule.dest
 	logger := proxy.logger.With("dest", dest)
 
 	proxyDest := net.JoinHostPort(dest.host, fmt.Sprintf("%d", dest.port))
-	logger.Debugf("Handling connection from %s, proxying to %s", inConn.RemoteAddr().String(), proxyDest)
+	logger.Debugf("Handling connection from %s, proxying to %s", source.String(), proxyDest)
 
-	var outConn net.Conn
-	var err error
 	protocolStr := fmt.Sprintf("%v", proxy.key.protocol)
-	if proxy.key.ruleType == ProxyTypeEgress {
-		outConn, err = proxy.userspaceNet.DialContext(ctx, protocolStr, proxyDest)
-	} else {
-		outConn, err = net.Dial(protocolStr, proxyDest)
-	}
+	outConn, err := proxy.dial(ctx, protocolStr, proxyDest)
+	backend.dialed(err)
 	if err != nil {
 		return err
 	}
 	defer util.IgnoreError(outConn.Close)
 
+	if version := backend.rule.options.sendProxy; version != "" {
+		if err := writeProxyHeader(outConn, version, source, local); err != nil {
+			return fmt.Errorf("failed to send the PROXY protocol header to %s: %w", proxyDest, err)
+		}
+	}
+
 	util.GoWithWaitGroup(proxyWg, func() {
 		_, err := io.Copy(inConn, outConn)
 		if err != nil {
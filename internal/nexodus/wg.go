@@ -13,8 +13,6 @@ import (
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
-const keepaliveInterval = time.Second * 20
-
 // handlePeerTunnel build wg tunnels
 func (nx *Nexodus) handlePeerTunnel(wgPeerConfig wgPeerConfig) error {
 	// validate the endpoint host:port pair parses.
@@ -59,7 +57,17 @@ func (nx *Nexodus) addPeerUS(wgPeerConfig wgPeerConfig) error {
 		config += fmt.Sprintf("allowed_ip=%s\n", aip)
 	}
 	config += fmt.Sprintf("endpoint=%s\n", wgPeerConfig.Endpoint)
-	config += fmt.Sprintf("persistent_keepalive_interval=%d\n", keepaliveInterval/time.Second)
+	config += fmt.Sprintf("persistent_keepalive_interval=%d\n", nx.keepalive)
+
+	// an all zero key removes the preshared key of the peer
+	presharedKey := wgtypes.Key{}
+	if wgPeerConfig.PresharedKey != "" {
+		presharedKey, err = wgtypes.ParseKey(wgPeerConfig.PresharedKey)
+		if err != nil {
+			return err
+		}
+	}
+	config += fmt.Sprintf("preshared_key=%s\n", hex.EncodeToString(presharedKey[:]))
 
 	nx.logger.Debugf("Adding wireguard peer using: %s", config)
 	err = nx.userspaceDev.IpcSet(config)
@@ -114,7 +122,16 @@ func (nx *Nexodus) addPeerOS(wgPeerConfig wgPeerConfig) error {
 		Port: port,
 	}
 
-	keepalive := keepaliveInterval
+	keepalive := time.Duration(nx.keepalive) * time.Second
+
+	// an all zero key removes the preshared key of the peer
+	presharedKey := wgtypes.Key{}
+	if wgPeerConfig.PresharedKey != "" {
+		presharedKey, err = wgtypes.ParseKey(wgPeerConfig.PresharedKey)
+		if err != nil {
+			return err
+		}
+	}
 
 	// relay nodes do not set explicit endpoints
 	cfg := wgtypes.Config{}
@@ -125,6 +142,7 @@ func (nx *Nexodus) addPeerOS(wgPeerConfig wgPeerConfig) error {
 				{
 					PublicKey:                   pubKey,
 					Remove:                      false,
+					PresharedKey:                &presharedKey,
 					AllowedIPs:                  allowedIP,
 					PersistentKeepaliveInterval: &keepalive,
 				},
@@ -139,6 +157,7 @@ func (nx *Nexodus) addPeerOS(wgPeerConfig wgPeerConfig) error {
 				{
 					PublicKey:                   pubKey,
 					Remove:                      false,
+					PresharedKey:                &presharedKey,
 					Endpoint:                    udpAddr,
 					AllowedIPs:                  allowedIP,
 					PersistentKeepaliveInterval: &keepalive,
@@ -175,6 +194,9 @@ func (nx *Nexodus) peerCleanup(peer public.ModelsDevice) error {
 	}
 	// delete the peer route(s)
 	nx.handlePeerRouteDelete(nx.tunnelIface, peer)
+	if nx.tcpRelay != nil {
+		nx.tcpRelay.release(peer.Id)
+	}
 
 	return nil
 }
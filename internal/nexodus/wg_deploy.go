@@ -4,18 +4,23 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/nexodus-io/nexodus/internal/api/public"
 )
 
-const (
-	persistentKeepalive = "20"
-)
+// the persistent keepalive interval of the tunnels in seconds, unless it is configured
+const defaultKeepalive = 20
 
 var (
 	securityGroupErr = errors.New("nftables setup error")
 )
 
+// persistentKeepalive returns the persistent keepalive interval of the peer configs.
+func (nx *Nexodus) persistentKeepalive() string {
+	return strconv.Itoa(nx.keepalive)
+}
+
 func (nx *Nexodus) DeployWireguardConfig(updatedPeers map[string]public.ModelsDevice) error {
 	cfg := &wgConfig{
 		Interface: nx.wgConfig.Interface,
@@ -56,7 +61,10 @@ func (nx *Nexodus) DeployWireguardConfig(updatedPeers map[string]public.ModelsDe
 
 func (nx *Nexodus) setupInterface() error {
 	if nx.userspaceMode {
-		return nx.setupInterfaceUS()
+		if err := nx.setupInterfaceUS(); err != nil {
+			return err
+		}
+		return nx.applyMTU(nx.interfaceMTU())
 	}
 
 	// Determine if nx.TunnelIP or nx.TunnelIpV6 overlaps with any of the system interfaces
@@ -68,7 +76,10 @@ func (nx *Nexodus) setupInterface() error {
 		return err
 	}
 
-	return nx.setupInterfaceOS()
+	if err := nx.setupInterfaceOS(); err != nil {
+		return err
+	}
+	return nx.applyMTU(nx.interfaceMTU())
 }
 
 func checkIPConflict(ip string) error {
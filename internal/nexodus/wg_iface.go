@@ -16,6 +16,12 @@ const (
 	nftablesBinary = "nft"
 )
 
+// the ip forwarding settings of each family, by the proc file they are read from
+var forwardingSysctls = map[string]string{
+	fwdFilePathV4: "net.ipv4.ip_forward",
+	fwdFilePathV6: "net.ipv6.conf.all.forwarding",
+}
+
 // ifaceExists returns true if the input matches a net interface
 func ifaceExists(logger *zap.SugaredLogger, iface string) bool {
 	_, err := net.InterfaceByName(iface)
@@ -157,6 +163,93 @@ func nfRelayTablesSetup(dev string) error {
 	return nil
 }
 
+// relayForwardingSetup makes this device forward the traffic of the peers relayed through it, it remembers the
+// ip forwarding settings it turned on so that relayForwardingTeardown turns only those off again.
+func (nx *Nexodus) relayForwardingSetup() error {
+	var turnedOn []string
+	for path, sysctl := range forwardingSysctls {
+		enabled, err := isIPForwardingEnabled(path)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			turnedOn = append(turnedOn, sysctl)
+		}
+	}
+	if err := nx.enableForwardingIP(); err != nil {
+		return err
+	}
+	if err := nfRelayTablesSetup(nx.tunnelIface); err != nil {
+		return err
+	}
+	nx.relayForwarding = true
+	nx.relayForwardingSysctls = turnedOn
+	return nil
+}
+
+// relayForwardingTeardown removes the forwarding of a device that is no longer a relay. IP forwarding stays on
+// when it was on before, or when the network router or exit node of this device need it.
+func (nx *Nexodus) relayForwardingTeardown() error {
+	if !nx.relayForwarding {
+		return nil
+	}
+	if err := nfRelayTablesTeardown(nx.tunnelIface); err != nil {
+		return err
+	}
+	if !nx.networkRouter && !nx.exitNode.exitNodeOriginEnabled {
+		for _, sysctl := range nx.relayForwardingSysctls {
+			if _, err := RunCommand("sysctl", "-w", sysctl+"=0"); err != nil {
+				return fmt.Errorf("failed to disable %s on this former relay node: %w", sysctl, err)
+			}
+		}
+	}
+	nx.relayForwarding = false
+	nx.relayForwardingSysctls = nil
+	return nil
+}
+
+// nfRelayTablesTeardown removes the v4/v6 nftables rules added by nfRelayTablesSetup. The filter tables may be shared
+// with other software, the FORWARD chain and the table are only deleted once they are empty.
+func nfRelayTablesTeardown(dev string) error {
+	for _, family := range []string{"ip", "ip6"} {
+		listing, err := exec.Command("nft", "-a", fmt.Sprintf("list chain %s filter FORWARD", family)).CombinedOutput()
+		if err != nil {
+			// the chain is gone already
+			continue
+		}
+		for _, handle := range nftRuleHandles(string(listing), fmt.Sprintf(`iifname "%s" counter`, dev)) {
+			if err := runNftCommand(fmt.Sprintf("delete rule %s filter FORWARD handle %s", family, handle)); err != nil {
+				return err
+			}
+		}
+		if runNftCommand(fmt.Sprintf("delete chain %s filter FORWARD", family)) != nil {
+			// other rules are left in the chain
+			continue
+		}
+		table, err := exec.Command("nft", fmt.Sprintf("list table %s filter", family)).CombinedOutput()
+		if err == nil && !strings.Contains(string(table), "chain ") {
+			if err := runNftCommand(fmt.Sprintf("delete table %s filter", family)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nftRuleHandles returns the handles of the accept rules containing match, in a chain listed with nft -a.
+func nftRuleHandles(listing, match string) []string {
+	var handles []string
+	for _, line := range strings.Split(listing, "\n") {
+		if !strings.Contains(line, match) || !strings.Contains(line, "accept") {
+			continue
+		}
+		if _, handle, ok := strings.Cut(line, "# handle "); ok {
+			handles = append(handles, strings.TrimSpace(handle))
+		}
+	}
+	return handles
+}
+
 func runNftCommand(cmd string) error {
 	nft := exec.Command("nft", cmd)
 	output, err := nft.CombinedOutput()
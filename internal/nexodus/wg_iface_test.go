@@ -0,0 +1,27 @@
+package nexodus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNftRuleHandles(t *testing.T) {
+	listing := `table ip filter {
+	chain FORWARD { # handle 1
+		type filter hook forward priority filter; policy accept;
+		iifname "docker0" counter packets 0 bytes 0 accept # handle 2
+		iifname "wg0" counter packets 12 bytes 1532 accept # handle 3
+		iifname "wg0" counter packets 0 bytes 0 accept # handle 5
+		iifname "wg0" counter packets 0 bytes 0 drop # handle 6
+	}
+}
+`
+	// only the accept rules of the relay interface are removed, the ones of other software stay
+	require.Equal(t, []string{"3", "5"}, nftRuleHandles(listing, `iifname "wg0" counter`))
+	require.Empty(t, nftRuleHandles(listing, `iifname "wg1" counter`))
+
+	// a device that did not set up the relay forwarding has nothing to tear down
+	nx := &Nexodus{}
+	require.NoError(t, nx.relayForwardingTeardown())
+}
@@ -1,9 +1,11 @@
 package nexodus
 
 import (
+	"fmt"
 	"net"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,6 +15,9 @@ import (
 const (
 	// How long to wait for successful peering after choosing a new peering method
 	peeringTimeout = time.Second * 30
+	// The head start IPv6 peering gets in its race with the IPv4 methods, the connection attempt delay of happy
+	// eyeballs (RFC 8305)
+	peeringHeadStartIPv6 = 250 * time.Millisecond
 	// How long to wait for peering to successfully restore itself after seeing
 	// successful peering using a given method, but it goes down.
 	peeringRestoreTimeout             = time.Second * 180
@@ -21,9 +26,15 @@ const (
 	peeringMethodRelayPeerDirectLocal = "relay-node-peer-direct-local"
 	peeringMethodRelayPeer            = "relay-node-peer"
 	peeringMethodDirectLocal          = "direct-local"
+	peeringMethodDirectIPv6           = "direct-ipv6"
+	peeringMethodPortMapped           = "port-mapped"
 	peeringMethodReflexive            = "reflexive"
 	peeringMethodViaRelay             = "via-relay"
 	peeringMethodNone                 = "none"
+	peeringMethodOnDemandIdle         = "on-demand-idle"
+	peeringMethodViaHub               = "via-hub"
+	peeringMethodViaTCPRelay          = "via-tcp-relay"
+	peeringMethodHolePunch            = "hole-punch"
 )
 
 type wgPeerMethod struct {
@@ -77,6 +88,30 @@ var wgPeerMethods = []wgPeerMethod{
 		},
 		buildPeerConfig: buildDirectLocalPeer,
 	},
+	{
+		// Both devices have an IPv6 endpoint, which needs no NAT traversal. It races the IPv4 methods with a head
+		// start of peeringHeadStartIPv6. The IPv6 handshakes sent meanwhile still complete once the IPv4 method is
+		// configured, and wireguard roams to whichever family the peer gets through on, see adoptIPv6Roam.
+		name: peeringMethodDirectIPv6,
+		checkPrereqs: func(nx *Nexodus, device public.ModelsDevice, _ string, healthyRelay bool) bool {
+			return !nx.relay && !device.Relay && nx.ipv6Endpoints.local.IsValid() && extractIPv6Endpoint(device) != ""
+		},
+		buildPeerConfig: buildDirectIPv6Peer,
+	},
+	{
+		// The gateway of either side maps its wireguard port, which gets through the NAT of that side whatever
+		// its behavior. When only this side is mapped, the peer reaches the mapped port, and wireguard roams to the
+		// endpoint its handshake comes from.
+		name: peeringMethodPortMapped,
+		checkPrereqs: func(nx *Nexodus, device public.ModelsDevice, _ string, healthyRelay bool) bool {
+			if nx.relay || device.Relay {
+				return false
+			}
+			mapped, _ := nx.portMapper.endpoint()
+			return mapped.IsValid() || extractPortMappedEndpoint(device) != ""
+		},
+		buildPeerConfig: buildPortMappedPeer,
+	},
 	{
 		// If neither side is behind symmetric NAT, we can try peering with its reflexive address.
 		// This is the address+port opened up by the peer using STUN.
@@ -86,6 +121,15 @@ var wgPeerMethods = []wgPeerMethod{
 		},
 		buildPeerConfig: buildReflexivePeer,
 	},
+	{
+		// A hole was punched through the NATs of both sides at the same moment, see holePuncher.
+		// This reaches peers behind NATs the reflexive address alone does not get through, symmetric ones included.
+		name: peeringMethodHolePunch,
+		checkPrereqs: func(nx *Nexodus, device public.ModelsDevice, _ string, healthyRelay bool) bool {
+			return !nx.relay && !device.Relay && nx.holePunchEndpoint(device.Id) != ""
+		},
+		buildPeerConfig: buildHolePunchPeer,
+	},
 	{
 		// Last chance, try connecting to the peer via a relay
 		name: peeringMethodViaRelay,
@@ -98,6 +142,14 @@ var wgPeerMethods = []wgPeerMethod{
 			}
 		},
 	},
+	{
+		// UDP is blocked, tunnel the wireguard packets over a TLS connection to the api-server
+		name: peeringMethodViaTCPRelay,
+		checkPrereqs: func(nx *Nexodus, device public.ModelsDevice, _ string, healthyRelay bool) bool {
+			return !nx.relay && !device.Relay && nx.tcpRelay != nil && nx.tcpRelay.connected()
+		},
+		buildPeerConfig: buildTCPRelayPeer,
+	},
 }
 
 func (nx *Nexodus) peeringReset(d *deviceCacheEntry) {
@@ -108,6 +160,7 @@ func (nx *Nexodus) peeringReset(d *deviceCacheEntry) {
 	// By setting the peering method index to -1, we will consider all other
 	// methods that may be available.
 	d.peeringMethodIndex = -1
+	d.pathFallback = ""
 
 	// All the stats are now invalid
 	d.peeringTime = time.Time{}
@@ -152,10 +205,49 @@ func (nx *Nexodus) rebuildPeerConfig(d *deviceCacheEntry, healthyRelay bool) (wg
 		nx.vpc.Ipv4Cidr,
 		nx.vpc.Ipv6Cidr,
 	}
+	if d.device.Relay && nx.primaryRelayID != "" && d.device.Id != nx.primaryRelayID {
+		// only the primary relay routes the whole vpc, the others route the peers relayed through them
+		relayAllowedIP = relayHostPrefixes(d.device)
+	}
+
+	if nx.tcpRelayUpgradeDue(*d, healthyRelay) {
+		nx.logger.Debugf("UDP works again, retrying peering with peer [ %s ] without the tcp relay", d.device.PublicKey)
+		nx.peeringReset(d)
+	}
+
+	// the reason the method chosen below is chosen for, when it is not the usual one
+	reason := ""
+	if d.pathFallback != "" {
+		fallbackIndex := pathMethodIndex(d.pathFallback)
+		if d.peeringMethodIndex == -1 || d.peeringMethodIndex >= fallbackIndex {
+			// the methods probed did not come up, peering walked back to the relay, or started over
+			d.pathFallback = ""
+		} else if done, slower := nx.pathProbeResult(d); slower {
+			reason = d.pathReason
+			nx.peeringReset(d)
+			d.peeringMethodIndex = fallbackIndex
+		} else if done {
+			reason = d.pathReason
+			d.pathFallback = ""
+		}
+	} else if i := nx.pathProbeDue(*d, reflexiveIP4, healthyRelay); i >= 0 {
+		nx.logger.Debugf("Trying method [ %s ] again for peer [ %s ], it uses method [ %s ] since %s", wgPeerMethods[i].name, d.device.PublicKey, d.peeringMethod, d.pathProbeTime.Format(time.RFC3339))
+		fallback := d.peeringMethod
+		nx.peeringReset(d)
+		d.peeringMethodIndex = i
+		d.pathFallback = fallback
+		d.pathProbeTime = time.Now()
+		delete(d.pathLatency, wgPeerMethods[i].name)
+		reason = fmt.Sprintf("probing whether %s is faster than %s", wgPeerMethods[i].name, fallback)
+	}
 
 	tryNextMethod := nx.peeringFailed(*d, healthyRelay)
 	if tryNextMethod {
 		nx.logger.Debugf("Peering with peer [ %s ] using method [ %s ] has failed, trying next method", d.device.PublicKey, d.peeringMethod)
+		if d.peeringMethod == peeringMethodHolePunch {
+			// the hole closed or never opened, punch a new one when the peer is relayed again
+			nx.forgetHolePunch(d.device.Id)
+		}
 		if nx.shouldResetPeering(d, reflexiveIP4, healthyRelay) {
 			// We failed to connect via a relay, which is the last resort, so start over at the beginning
 			nx.peeringReset(d)
@@ -186,6 +278,23 @@ func (nx *Nexodus) rebuildPeerConfig(d *deviceCacheEntry, healthyRelay bool) (wg
 		peer = method.buildPeerConfig(nx, d.device, relayAllowedIP, localIP, peerPort, reflexiveIP4)
 		chosenMethod = method.name
 		chosenMethodIndex = i
+		switch {
+		case reason != "":
+		case method.name == d.peeringMethod && d.pathReason != "":
+			// still the same method, for the same reason
+			reason = d.pathReason
+		case method.name == peeringMethodViaRelay || method.name == peeringMethodViaTCPRelay:
+			reason = nx.relayReason(d.device)
+		case tryNextMethod:
+			reason = fmt.Sprintf("%s did not come up", d.peeringMethod)
+		default:
+			reason = "the most preferred method available"
+		}
+		d.pathReason = reason
+		if method.name == peeringMethodViaRelay || (tryNextMethod && d.peeringMethod == peeringMethodDirectIPv6) {
+			// the methods preferred over this one were just tried
+			d.pathProbeTime = time.Now()
+		}
 		break
 	}
 
@@ -208,29 +317,85 @@ func (nx *Nexodus) buildPeersConfig() map[string]public.ModelsDevice {
 
 	nx.buildLocalConfig()
 
-	// do we have a healthy relay available?
-	healthyRelay := false
-	relayDevice := public.ModelsDevice{}
+	// do we have a healthy relay available? the relayed peers are spread across all of them
+	relays := nx.healthyRelays()
+	healthyRelay := len(relays) > 0
+	if nx.relay {
+		// relay nodes peer with every device directly, the other relays included
+		relays = nil
+		nx.primaryRelayID = ""
+	} else {
+		nx.primaryRelayID = nx.primaryRelay(relays)
+	}
+	// relay nodes peer with every device directly, the topology only applies once the vpc has a relay to go through
+	hasRelay := false
 	for _, d := range nx.deviceCache {
-		if d.device.Relay && d.peerHealthy {
-			healthyRelay = true
-			relayDevice = d.device
+		if !nx.relay && d.device.Relay && d.device.PublicKey != nx.wireguardPubKey {
+			hasRelay = true
 			break
 		}
 	}
+	relayedIPs := map[string][]string{} // the peers relayed through the relays other than the primary one, by relay id
+
+	onDemand := nx.onDemandPeering()
+	local := nx.deviceCache[nx.wireguardPubKey]
+
+	// the relays are configured first, a relayed peer is only assigned a relay that is configured
+	entries := make([]deviceCacheEntry, 0, len(nx.deviceCache))
+	for _, d := range nx.deviceCache {
+		entries = append(entries, d)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].device.Relay && !entries[j].device.Relay
+	})
 
 	now := time.Now()
-	for _, dIter := range nx.deviceCache {
+	for _, dIter := range entries {
 		d := dIter
 		// skip ourselves
 		if d.device.PublicKey == nx.wireguardPubKey {
 			continue
 		}
 
+		// traffic to peers the topology does not call for goes through the relay, as does
+		// traffic to on-demand peers until on-demand peering calls for the peer
+		unpeeredMethod := ""
+		if !nx.topologyPeerWanted(local.device, d.device, hasRelay) {
+			unpeeredMethod = peeringMethodViaHub
+		} else if onDemand && !nx.onDemandPeerWanted(local.device, d.device, healthyRelay) {
+			unpeeredMethod = peeringMethodOnDemandIdle
+		}
+		if unpeeredMethod != "" {
+			if d.peeringMethod != unpeeredMethod {
+				nx.removePeer(&d, unpeeredMethod)
+			}
+			allowedIPsForRelay = append(allowedIPsForRelay, d.device.AdvertiseCidrs...)
+			continue
+		}
+
 		peerConfig, chosenMethod, chosenMethodIndex := nx.rebuildPeerConfig(&d, healthyRelay)
-		if len(peerConfig.AllowedIPsForRelay) > 0 {
+		if chosenMethod == peeringMethodViaRelay || chosenMethod == peeringMethodViaTCPRelay || chosenMethod == peeringMethodNone {
+			// try to get the peer off the relay, or to reach it at all
+			nx.startHolePunch(d.device)
+		}
+		peerConfig.PresharedKey = nx.presharedKeyFor(d.device.Id, now)
+		relayID := ""
+		if chosenMethod == peeringMethodViaRelay && healthyRelay {
+			// the relay of each relayed peer is picked the same way on both sides of the pair
+			relayID = nx.pairRelay(nx.pairRelays(local.device, d.device), relayPairKey(nx.deviceId, d.device.Id))
+		}
+		if relayID != "" && relayID != nx.primaryRelayID {
+			relayedIPs[relayID] = append(relayedIPs[relayID], d.device.AllowedIps...)
+			relayedIPs[relayID] = append(relayedIPs[relayID], peerConfig.AllowedIPsForRelay...)
+		} else if len(peerConfig.AllowedIPsForRelay) > 0 {
 			allowedIPsForRelay = append(allowedIPsForRelay, peerConfig.AllowedIPsForRelay...)
 		}
+		// the relay and path probing state change without the peer configuration changing
+		d.relayID = relayID
+		entry := nx.deviceCache[d.device.PublicKey]
+		entry.relayID = relayID
+		entry.pathFallback, entry.pathProbeTime, entry.pathReason = d.pathFallback, d.pathProbeTime, d.pathReason
+		nx.deviceCache[d.device.PublicKey] = entry
 
 		if !nx.peerConfigUpdated(d.device, peerConfig) {
 			// The resulting peer configuration hasn't changed.
@@ -247,29 +412,73 @@ func (nx *Nexodus) buildPeersConfig() map[string]public.ModelsDevice {
 		} else {
 			nx.wgConfig.Peers[d.device.PublicKey] = peerConfig
 		}
+		if chosenMethod != peeringMethodViaTCPRelay && nx.tcpRelay != nil {
+			nx.tcpRelay.release(d.device.Id)
+		}
 		d.peeringMethodIndex = chosenMethodIndex
 		d.peeringMethod = chosenMethod
 		d.peeringTime = now
 		nx.deviceCache[d.device.PublicKey] = d
+		if chosenMethod == peeringMethodDirectIPv6 {
+			nx.startIPv6HeadStart()
+		}
 		nx.logPeerInfo(d.device, peerConfig.Endpoint, chosenMethod)
+		nx.logger.Debugf("Peer [ %s ] uses method [ %s ], %s", d.device.PublicKey, chosenMethod, d.pathReason)
 	}
 
-	if healthyRelay && len(allowedIPsForRelay) > 0 {
-		// Add child prefix CIDRs to the relay for peers that we can only reach via the relay
-		relayConfig := nx.wgConfig.Peers[relayDevice.PublicKey]
-		relayConfig.AllowedIPs = append([]string{nx.vpc.Ipv4Cidr, nx.vpc.Ipv4Cidr}, allowedIPsForRelay...)
-		nx.wgConfig.Peers[relayDevice.PublicKey] = relayConfig
+	for _, relay := range nx.deviceCache {
+		if !relay.device.Relay || nx.relay {
+			continue
+		}
+		relayConfig, ok := nx.wgConfig.Peers[relay.device.PublicKey]
+		if !ok {
+			continue
+		}
+		// Add the peers that we can only reach via a relay to the relay they go through, the
+		// primary relay already routes the whole vpc and only needs the child prefix CIDRs
+		var allowedIPs []string
+		if relay.device.Id == nx.primaryRelayID {
+			if len(allowedIPsForRelay) == 0 {
+				continue
+			}
+			allowedIPs = append([]string{nx.vpc.Ipv4Cidr, nx.vpc.Ipv6Cidr}, allowedIPsForRelay...)
+		} else {
+			allowedIPs = append(relayHostPrefixes(relay.device), relayedIPs[relay.device.Id]...)
+		}
+		if !reflect.DeepEqual(relayConfig.AllowedIPs, allowedIPs) {
+			relayConfig.AllowedIPs = allowedIPs
+			nx.wgConfig.Peers[relay.device.PublicKey] = relayConfig
+			// the routes to the relayed peers are deployed with the relay peer
+			updatedPeers[relay.device.PublicKey] = relay.device
+		}
 	}
 
 	return updatedPeers
 }
 
+// removePeer removes the wireguard peer of a device that is reached through the relay instead,
+// method records why: peeringMethodViaHub or peeringMethodOnDemandIdle.
+// assumes deviceCacheLock is held with a write-lock
+func (nx *Nexodus) removePeer(d *deviceCacheEntry, method string) {
+	if _, ok := nx.wgConfig.Peers[d.device.PublicKey]; ok {
+		nx.logger.Debugf("Removing peer [ %s ] Peer AllowedIps [ %s ] Method [ %s ]", d.device.PublicKey, strings.Join(d.device.AllowedIps, ", "), method)
+		delete(nx.wgConfig.Peers, d.device.PublicKey)
+		if err := nx.peerCleanup(d.device); err != nil {
+			nx.logger.Warnf("failed to remove the peer %s: %v", d.device.PublicKey, err)
+		}
+	}
+	// start over with the peering methods when the peer is needed again
+	nx.peeringReset(d)
+	d.peeringMethod = method
+	nx.deviceCache[d.device.PublicKey] = *d
+}
+
 func (nx *Nexodus) peeringFailed(d deviceCacheEntry, healthyRelay bool) bool {
 	if d.peerHealthy {
 		return false
 	}
 
-	if d.peeringMethodIndex == len(wgPeerMethods)-1 {
+	if d.peeringMethod == peeringMethodViaRelay {
 		return !healthyRelay
 	}
 
@@ -278,7 +487,12 @@ func (nx *Nexodus) peeringFailed(d deviceCacheEntry, healthyRelay bool) bool {
 		return false
 	}
 
-	if d.peerHealthyTime.IsZero() && time.Since(d.peeringTime) < peeringTimeout {
+	timeout := peeringTimeout
+	if d.peeringMethod == peeringMethodDirectIPv6 && d.pathFallback == "" {
+		// the IPv4 methods join the race once the head start is over, IPv6 is tried again on the path probe schedule
+		timeout = peeringHeadStartIPv6
+	}
+	if d.peerHealthyTime.IsZero() && time.Since(d.peeringTime) < timeout {
 		// Peering has never been successful since choosing this method,
 		// so time out quicker than if it had worked and we're waiting for it to come back up.
 		return false
@@ -305,14 +519,26 @@ func (nx *Nexodus) peerConfigUpdated(device public.ModelsDevice, peer wgPeerConf
 		return true
 	}
 
+	if nx.wgConfig.Peers[device.PublicKey].PresharedKey != peer.PresharedKey {
+		return true
+	}
+
+	if nx.wgConfig.Peers[device.PublicKey].PersistentKeepAlive != peer.PersistentKeepAlive {
+		return true
+	}
+
 	return false
 }
 
-// extractLocalAndReflexiveIP retrieve the local and reflexive endpoint addresses
+// extractLocalAndReflexiveIP retrieve the local and reflexive IPv4 endpoint addresses, see extractIPv6Endpoint for IPv6
 func (nx *Nexodus) extractLocalAndReflexiveIP(device public.ModelsDevice) (string, string) {
 	localIP := ""
 	reflexiveIP4 := ""
 	for _, endpoint := range device.Endpoints {
+		if endpoint.Source == endpointSourceLocalIPv6 || strings.HasPrefix(endpoint.Source, endpointSourceStunIPv6) ||
+			strings.HasPrefix(endpoint.Source, endpointSourcePortMapping) {
+			continue
+		}
 		if endpoint.Source == "local" {
 			localIP = endpoint.Address
 		} else {
@@ -337,7 +563,7 @@ func buildDirectLocalPeerForRelayNode(nx *Nexodus, device public.ModelsDevice, _
 		PublicKey:           device.PublicKey,
 		Endpoint:            localIP,
 		AllowedIPs:          device.AllowedIps,
-		PersistentKeepAlive: persistentKeepalive,
+		PersistentKeepAlive: nx.persistentKeepalive(),
 	}
 }
 
@@ -349,7 +575,7 @@ func buildPeerForRelayNode(nx *Nexodus, device public.ModelsDevice, _ []string,
 		PublicKey:           device.PublicKey,
 		Endpoint:            reflexiveIP4,
 		AllowedIPs:          device.AllowedIps,
-		PersistentKeepAlive: persistentKeepalive,
+		PersistentKeepAlive: nx.persistentKeepalive(),
 	}
 }
 
@@ -359,7 +585,7 @@ func buildDirectLocalRelayPeer(nx *Nexodus, device public.ModelsDevice, relayAll
 		PublicKey:           device.PublicKey,
 		Endpoint:            localIP,
 		AllowedIPs:          relayAllowedIP,
-		PersistentKeepAlive: persistentKeepalive,
+		PersistentKeepAlive: nx.persistentKeepalive(),
 	}
 }
 
@@ -371,7 +597,7 @@ func buildRelayPeer(nx *Nexodus, device public.ModelsDevice, relayAllowedIP []st
 		PublicKey:           device.PublicKey,
 		Endpoint:            reflexiveIP4,
 		AllowedIPs:          relayAllowedIP,
-		PersistentKeepAlive: persistentKeepalive,
+		PersistentKeepAlive: nx.persistentKeepalive(),
 	}
 }
 
@@ -383,7 +609,34 @@ func buildDirectLocalPeer(nx *Nexodus, device public.ModelsDevice, _ []string, l
 		PublicKey:           device.PublicKey,
 		Endpoint:            localIP,
 		AllowedIPs:          device.AllowedIps,
-		PersistentKeepAlive: persistentKeepalive,
+		PersistentKeepAlive: nx.persistentKeepalive(),
+	}
+}
+
+// buildDirectIPv6Peer peers with the IPv6 endpoint of the peer
+func buildDirectIPv6Peer(nx *Nexodus, device public.ModelsDevice, _ []string, _, _, _ string) wgPeerConfig {
+	device.AllowedIps = append(device.AllowedIps, device.AdvertiseCidrs...)
+	return wgPeerConfig{
+		PublicKey:           device.PublicKey,
+		Endpoint:            extractIPv6Endpoint(device),
+		AllowedIPs:          device.AllowedIps,
+		PersistentKeepAlive: nx.persistentKeepalive(),
+	}
+}
+
+// buildPortMappedPeer peers with the endpoint the gateway of the peer maps to its wireguard port, or with its reflexive
+// address when only this device is mapped.
+func buildPortMappedPeer(nx *Nexodus, device public.ModelsDevice, _ []string, _, _, reflexiveIP4 string) wgPeerConfig {
+	endpoint := extractPortMappedEndpoint(device)
+	if endpoint == "" {
+		endpoint = reflexiveIP4
+	}
+	device.AllowedIps = append(device.AllowedIps, device.AdvertiseCidrs...)
+	return wgPeerConfig{
+		PublicKey:           device.PublicKey,
+		Endpoint:            endpoint,
+		AllowedIPs:          device.AllowedIps,
+		PersistentKeepAlive: nx.persistentKeepalive(),
 	}
 }
 
@@ -395,7 +648,34 @@ func buildReflexivePeer(nx *Nexodus, device public.ModelsDevice, _ []string, _,
 		PublicKey:           device.PublicKey,
 		Endpoint:            reflexiveIP4,
 		AllowedIPs:          device.AllowedIps,
-		PersistentKeepAlive: persistentKeepalive,
+		PersistentKeepAlive: nx.persistentKeepalive(),
+	}
+}
+
+// buildHolePunchPeer peers with the candidate of the peer a hole was punched to, wireguard roams to another
+// candidate if the handshake of the peer comes from there.
+func buildHolePunchPeer(nx *Nexodus, device public.ModelsDevice, _ []string, _, _, _ string) wgPeerConfig {
+	device.AllowedIps = append(device.AllowedIps, device.AdvertiseCidrs...)
+	return wgPeerConfig{
+		PublicKey:           device.PublicKey,
+		Endpoint:            nx.holePunchEndpoint(device.Id),
+		AllowedIPs:          device.AllowedIps,
+		PersistentKeepAlive: nx.persistentKeepalive(),
+	}
+}
+
+// buildTCPRelayPeer peers through the tcp relay, using the loopback socket that relays the packets of the peer as its endpoint
+func buildTCPRelayPeer(nx *Nexodus, device public.ModelsDevice, _ []string, _, _, _ string) wgPeerConfig {
+	endpoint, err := nx.tcpRelay.endpoint(device.Id)
+	if err != nil {
+		nx.logger.Warnf("failed to set up the tcp relay for peer %s: %v", device.PublicKey, err)
+	}
+	device.AllowedIps = append(device.AllowedIps, device.AdvertiseCidrs...)
+	return wgPeerConfig{
+		PublicKey:           device.PublicKey,
+		Endpoint:            endpoint,
+		AllowedIPs:          device.AllowedIps,
+		PersistentKeepAlive: nx.persistentKeepalive(),
 	}
 }
 
@@ -429,7 +709,7 @@ func (nx *Nexodus) buildLocalConfig() {
 	nx.TunnelIP = d.device.Ipv4TunnelIps[0].Address
 	nx.TunnelIpV6 = d.device.Ipv6TunnelIps[0].Address
 	localInterface = wgLocalConfig{
-		nx.wireguardPvtKey,
+		nx.interfacePrivateKey(),
 		nx.listenPort,
 	}
 	// set the node unique local interface configuration
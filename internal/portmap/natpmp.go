@@ -0,0 +1,113 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// errUnsupportedVersion is returned when the gateway does not speak the version of the protocol asked in, NAT-PMP
+// gateways answer PCP requests with it.
+var errUnsupportedVersion = errors.New("the gateway does not support the protocol version")
+
+// resultCodeUnsupportedVersion is the result code of both NAT-PMP and PCP for requests in a version they do not speak.
+const resultCodeUnsupportedVersion = 1
+
+// gatewayTransact sends a PCP or NAT-PMP request to the gateway and returns its response, retrying with a doubled
+// timeout when the gateway does not answer. Responses that do not answer the opcode of the request are dropped.
+func (c *Client) gatewayTransact(ctx context.Context, request []byte) ([]byte, error) {
+	conn, err := net.DialUDP("udp4", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(c.gateway, uint16(c.gatewayPort))))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	response := make([]byte, 1100)
+	timeout := c.timeout
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		for {
+			n, err := conn.Read(response)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				// the gateway refused the port, it does not speak the protocol
+				return nil, err
+			}
+			if n >= 4 && response[1] == request[1]|0x80 {
+				return response[:n], nil
+			}
+		}
+		timeout *= 2
+	}
+	return nil, fmt.Errorf("no answer from gateway %s", c.gateway)
+}
+
+// mapNATPMP makes or renews a mapping with NAT-PMP, a lifetime of zero removes it.
+func (c *Client) mapNATPMP(ctx context.Context, m Mapping, lifetime time.Duration) (Mapping, error) {
+	// the external address is not part of the answer to a mapping request
+	response, err := c.gatewayTransact(ctx, []byte{0, 0})
+	if err != nil {
+		return Mapping{}, err
+	}
+	if err := natpmpResult(response, 12); err != nil {
+		return Mapping{}, err
+	}
+	externalIP := netip.AddrFrom4([4]byte(response[8:12]))
+
+	request := make([]byte, 12)
+	request[1] = 1 // map UDP
+	binary.BigEndian.PutUint16(request[4:6], uint16(m.InternalPort))
+	if lifetime != 0 {
+		binary.BigEndian.PutUint16(request[6:8], m.External.Port())
+	}
+	binary.BigEndian.PutUint32(request[8:12], uint32(lifetime/time.Second))
+	response, err = c.gatewayTransact(ctx, request)
+	if err != nil {
+		return Mapping{}, err
+	}
+	if err := natpmpResult(response, 16); err != nil {
+		return Mapping{}, err
+	}
+	return Mapping{
+		Protocol:     ProtocolNATPMP,
+		InternalPort: int(binary.BigEndian.Uint16(response[8:10])),
+		External:     netip.AddrPortFrom(externalIP, binary.BigEndian.Uint16(response[10:12])),
+		Lifetime:     time.Duration(binary.BigEndian.Uint32(response[12:16])) * time.Second,
+	}, nil
+}
+
+// natpmpResult checks the version and result code of a NAT-PMP response, and that it is size bytes long.
+func natpmpResult(response []byte, size int) error {
+	if response[0] != 0 {
+		return fmt.Errorf("unexpected NAT-PMP version %d", response[0])
+	}
+	if code := binary.BigEndian.Uint16(response[2:4]); code != 0 {
+		if code == resultCodeUnsupportedVersion {
+			return errUnsupportedVersion
+		}
+		return fmt.Errorf("the gateway failed the request with NAT-PMP result code %d", code)
+	}
+	if len(response) < size {
+		return fmt.Errorf("short NAT-PMP response of %d bytes", len(response))
+	}
+	return nil
+}
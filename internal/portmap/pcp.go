@@ -0,0 +1,96 @@
+package portmap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	pcpVersion    = 2
+	pcpOpcodeMap  = 1
+	pcpProtoUDP   = 17
+	pcpHeaderSize = 24
+	pcpMapSize    = 36
+)
+
+// mapPCP makes or renews a mapping with a PCP MAP request, a lifetime of zero removes it. Renewals reuse the nonce of
+// the mapping, the gateway refuses to change a mapping made with another one.
+func (c *Client) mapPCP(ctx context.Context, m Mapping, lifetime time.Duration) (Mapping, error) {
+	nonce := m.nonce
+	if m.Protocol == "" {
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return Mapping{}, err
+		}
+	}
+
+	// the gateway checks that the client address in the request is the one it was sent from
+	clientIP, err := c.localAddr()
+	if err != nil {
+		return Mapping{}, err
+	}
+	request := make([]byte, pcpHeaderSize+pcpMapSize)
+	request[0] = pcpVersion
+	request[1] = pcpOpcodeMap
+	binary.BigEndian.PutUint32(request[4:8], uint32(lifetime/time.Second))
+	clientIP16 := clientIP.As16()
+	copy(request[8:24], clientIP16[:])
+	copy(request[24:36], nonce[:])
+	request[36] = pcpProtoUDP
+	binary.BigEndian.PutUint16(request[40:42], uint16(m.InternalPort))
+	suggested := netip.IPv4Unspecified()
+	if m.External.IsValid() && lifetime != 0 {
+		binary.BigEndian.PutUint16(request[42:44], m.External.Port())
+		suggested = m.External.Addr()
+	}
+	suggested16 := suggested.As16()
+	copy(request[44:60], suggested16[:])
+
+	response, err := c.gatewayTransact(ctx, request)
+	if err != nil {
+		return Mapping{}, err
+	}
+	if response[0] != pcpVersion {
+		if response[0] == 0 && len(response) >= 4 && binary.BigEndian.Uint16(response[2:4]) == resultCodeUnsupportedVersion {
+			return Mapping{}, errUnsupportedVersion
+		}
+		return Mapping{}, fmt.Errorf("unexpected PCP version %d", response[0])
+	}
+	if len(response) < 4 {
+		return Mapping{}, fmt.Errorf("short PCP response of %d bytes", len(response))
+	}
+	if code := response[3]; code != 0 {
+		if code == resultCodeUnsupportedVersion {
+			return Mapping{}, errUnsupportedVersion
+		}
+		return Mapping{}, fmt.Errorf("the gateway failed the request with PCP result code %d", code)
+	}
+	if len(response) < pcpHeaderSize+pcpMapSize {
+		return Mapping{}, fmt.Errorf("short PCP response of %d bytes", len(response))
+	}
+	if [12]byte(response[24:36]) != nonce {
+		return Mapping{}, fmt.Errorf("the PCP response is for another mapping")
+	}
+	externalIP := netip.AddrFrom16([16]byte(response[44:60])).Unmap()
+	return Mapping{
+		Protocol:     ProtocolPCP,
+		InternalPort: int(binary.BigEndian.Uint16(response[40:42])),
+		External:     netip.AddrPortFrom(externalIP, binary.BigEndian.Uint16(response[42:44])),
+		Lifetime:     time.Duration(binary.BigEndian.Uint32(response[4:8])) * time.Second,
+		nonce:        nonce,
+	}, nil
+}
+
+// localAddr returns the address this host sends from to the gateway.
+func (c *Client) localAddr() (netip.Addr, error) {
+	conn, err := net.DialUDP("udp4", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(c.gateway, uint16(c.gatewayPort))))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap(), nil
+}
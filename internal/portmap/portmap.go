@@ -0,0 +1,129 @@
+// Package portmap asks the gateway of the local network to map a UDP port, so that the port can be reached from the
+// internet. The gateway is asked with PCP (RFC 6887), NAT-PMP (RFC 6886) or UPnP IGD, whichever it supports.
+package portmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ProtocolPCP    = "pcp"
+	ProtocolNATPMP = "nat-pmp"
+	ProtocolUPnP   = "upnp"
+)
+
+// ErrNoGateway is returned by Map when no gateway answered in any of the protocols.
+var ErrNoGateway = errors.New("no gateway that maps ports was found")
+
+// Mapping is a UDP port the gateway maps from its external address to this host.
+type Mapping struct {
+	// Protocol the mapping was made with, one of the Protocol* constants
+	Protocol     string
+	InternalPort int
+	External     netip.AddrPort
+	// Lifetime the gateway granted, the mapping needs to be renewed before it ends
+	Lifetime time.Duration
+
+	nonce [12]byte     // the nonce of a PCP mapping
+	upnp  *upnpService // the service of the gateway that made a UPnP mapping
+}
+
+// Client makes port mappings on a gateway.
+type Client struct {
+	logger *zap.SugaredLogger
+	// the address PCP and NAT-PMP requests are sent to, invalid to only use UPnP
+	gateway     netip.Addr
+	gatewayPort int
+	// the address UPnP gateways are discovered at
+	ssdpAddress string
+	// how long to wait for the first answer of the gateway, doubled on each retry
+	timeout  time.Duration
+	attempts int
+}
+
+// NewClient returns a client that asks the gateway given with PCP and NAT-PMP, and discovers UPnP gateways on the local
+// network. Without a valid gateway address, only UPnP is used.
+func NewClient(logger *zap.SugaredLogger, gateway netip.Addr) *Client {
+	return &Client{
+		logger:      logger,
+		gateway:     gateway,
+		gatewayPort: 5351,
+		ssdpAddress: "239.255.255.250:1900",
+		timeout:     250 * time.Millisecond,
+		attempts:    3,
+	}
+}
+
+// Map asks the gateway to map internalPort for lifetime. PCP is tried first, then NAT-PMP when the gateway only speaks
+// that, then UPnP. The gateway picks the external port, the internal one is asked for.
+func (c *Client) Map(ctx context.Context, internalPort int, lifetime time.Duration) (Mapping, error) {
+	var errs []error
+	if c.gateway.IsValid() {
+		m, err := c.mapPCP(ctx, Mapping{InternalPort: internalPort}, lifetime)
+		if err == nil {
+			return m, nil
+		}
+		errs = append(errs, fmt.Errorf("pcp: %w", err))
+		if errors.Is(err, errUnsupportedVersion) {
+			m, err := c.mapNATPMP(ctx, Mapping{InternalPort: internalPort}, lifetime)
+			if err == nil {
+				return m, nil
+			}
+			errs = append(errs, fmt.Errorf("nat-pmp: %w", err))
+		}
+	}
+	m, err := c.mapUPnP(ctx, Mapping{InternalPort: internalPort}, lifetime)
+	if err == nil {
+		return m, nil
+	}
+	errs = append(errs, fmt.Errorf("upnp: %w", err))
+	c.logger.Debugf("port mapping failed: %v", errors.Join(errs...))
+	return Mapping{}, fmt.Errorf("%w: %v", ErrNoGateway, errors.Join(errs...))
+}
+
+// Renew extends a mapping for lifetime, with the protocol that made it. The gateway may move it to another external
+// address or port, when it restarted for example.
+func (c *Client) Renew(ctx context.Context, m Mapping, lifetime time.Duration) (Mapping, error) {
+	switch m.Protocol {
+	case ProtocolPCP:
+		return c.mapPCP(ctx, m, lifetime)
+	case ProtocolNATPMP:
+		return c.mapNATPMP(ctx, m, lifetime)
+	case ProtocolUPnP:
+		return c.mapUPnP(ctx, m, lifetime)
+	default:
+		return Mapping{}, fmt.Errorf("unknown port mapping protocol %q", m.Protocol)
+	}
+}
+
+// Unmap removes a mapping from the gateway.
+func (c *Client) Unmap(ctx context.Context, m Mapping) error {
+	switch m.Protocol {
+	case ProtocolPCP:
+		_, err := c.mapPCP(ctx, m, 0)
+		return err
+	case ProtocolNATPMP:
+		_, err := c.mapNATPMP(ctx, m, 0)
+		return err
+	case ProtocolUPnP:
+		return m.upnp.deletePortMapping(ctx, m.External.Port())
+	default:
+		return fmt.Errorf("unknown port mapping protocol %q", m.Protocol)
+	}
+}
+
+// Reachable determines if the external address of a mapping can be reached from the internet. It can not when the
+// gateway is itself behind a NAT, such as a carrier-grade one.
+func (m Mapping) Reachable() bool {
+	addr := m.External.Addr()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// the address space of carrier-grade NATs, RFC 6598
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
@@ -0,0 +1,373 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var fakeExternalIP = netip.MustParseAddr("203.0.113.1")
+
+// fakeGateway answers PCP and NAT-PMP requests like a gateway would, mapping internal ports to the internal port
+// plus 10000.
+type fakeGateway struct {
+	conn *net.UDPConn
+	// whether the gateway speaks PCP, NAT-PMP is always spoken
+	pcp bool
+
+	mu       sync.Mutex
+	mappings map[uint16]time.Duration
+	nonces   map[uint16][12]byte
+}
+
+func newFakeGateway(t *testing.T, pcp bool) *fakeGateway {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	g := &fakeGateway{
+		conn:     conn,
+		pcp:      pcp,
+		mappings: map[uint16]time.Duration{},
+		nonces:   map[uint16][12]byte{},
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go g.serve()
+	return g
+}
+
+func (g *fakeGateway) port() int {
+	return g.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (g *fakeGateway) mapping(internalPort uint16) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	lifetime, ok := g.mappings[internalPort]
+	return lifetime, ok
+}
+
+func (g *fakeGateway) record(internalPort uint16, lifetime time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if lifetime == 0 {
+		delete(g.mappings, internalPort)
+	} else {
+		g.mappings[internalPort] = lifetime
+	}
+}
+
+func (g *fakeGateway) serve() {
+	buf := make([]byte, 1100)
+	for {
+		n, addr, err := g.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if response := g.handle(buf[:n]); response != nil {
+			_, _ = g.conn.WriteToUDP(response, addr)
+		}
+	}
+}
+
+func (g *fakeGateway) handle(request []byte) []byte {
+	switch {
+	case request[0] == pcpVersion && g.pcp:
+		internalPort := binary.BigEndian.Uint16(request[40:42])
+		lifetime := binary.BigEndian.Uint32(request[4:8])
+		var nonce [12]byte
+		copy(nonce[:], request[24:36])
+		g.mu.Lock()
+		previous, ok := g.nonces[internalPort]
+		g.nonces[internalPort] = nonce
+		g.mu.Unlock()
+		response := make([]byte, pcpHeaderSize+pcpMapSize)
+		response[0] = pcpVersion
+		response[1] = request[1] | 0x80
+		if ok && previous != nonce {
+			response[3] = 18 // NOT_AUTHORIZED
+			return response
+		}
+		binary.BigEndian.PutUint32(response[4:8], lifetime)
+		copy(response[24:60], request[24:60])
+		if lifetime != 0 {
+			binary.BigEndian.PutUint16(response[42:44], internalPort+10000)
+			externalIP := netip.AddrFrom4(fakeExternalIP.As4()).As16()
+			copy(response[44:60], externalIP[:])
+		}
+		g.record(internalPort, time.Duration(lifetime)*time.Second)
+		return response
+	case request[0] != 0:
+		// NAT-PMP gateways answer requests in other versions with the NAT-PMP version
+		response := make([]byte, 8)
+		response[1] = request[1] | 0x80
+		binary.BigEndian.PutUint16(response[2:4], resultCodeUnsupportedVersion)
+		return response
+	case request[1] == 0:
+		response := make([]byte, 12)
+		response[1] = 0x80
+		externalIP := fakeExternalIP.As4()
+		copy(response[8:12], externalIP[:])
+		return response
+	case request[1] == 1:
+		internalPort := binary.BigEndian.Uint16(request[4:6])
+		lifetime := binary.BigEndian.Uint32(request[8:12])
+		response := make([]byte, 16)
+		response[1] = 0x81
+		binary.BigEndian.PutUint16(response[8:10], internalPort)
+		if lifetime != 0 {
+			binary.BigEndian.PutUint16(response[10:12], internalPort+10000)
+		}
+		binary.BigEndian.PutUint32(response[12:16], lifetime)
+		g.record(internalPort, time.Duration(lifetime)*time.Second)
+		return response
+	}
+	return nil
+}
+
+// fakeUPnPGateway answers SSDP searches and the UPnP actions port mappings are made with. Like a number of consumer
+// gateways, it only grants permanent leases.
+type fakeUPnPGateway struct {
+	ssdp   *net.UDPConn
+	server *httptest.Server
+
+	mu       sync.Mutex
+	mappings map[string]string
+}
+
+func newFakeUPnPGateway(t *testing.T) *fakeUPnPGateway {
+	ssdp, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	g := &fakeUPnPGateway{ssdp: ssdp, mappings: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`)
+	})
+	mux.HandleFunc("/ctl/IPConn", g.control)
+	g.server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		_ = ssdp.Close()
+		g.server.Close()
+	})
+	go g.serveSSDP()
+	return g
+}
+
+func (g *fakeUPnPGateway) serveSSDP() {
+	buf := make([]byte, 1100)
+	for {
+		n, addr, err := g.ssdp.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if !strings.Contains(string(buf[:n]), upnpInternetGatewayDevice) {
+			continue
+		}
+		response := "HTTP/1.1 200 OK\r\n" +
+			"CACHE-CONTROL: max-age=120\r\n" +
+			"ST: " + upnpInternetGatewayDevice + "\r\n" +
+			"LOCATION: " + g.server.URL + "/rootDesc.xml\r\n\r\n"
+		_, _ = g.ssdp.WriteToUDP([]byte(response), addr)
+	}
+}
+
+func (g *fakeUPnPGateway) control(w http.ResponseWriter, r *http.Request) {
+	var envelope struct {
+		Body struct {
+			Action struct {
+				XMLName        xml.Name
+				ExternalPort   string `xml:"NewExternalPort"`
+				InternalClient string `xml:"NewInternalClient"`
+				LeaseDuration  string `xml:"NewLeaseDuration"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	action := envelope.Body.Action
+	if r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#`+action.XMLName.Local+`"` {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch action.XMLName.Local {
+	case "GetExternalIPAddress":
+		g.respond(w, action.XMLName.Local, "<NewExternalIPAddress>"+fakeExternalIP.String()+"</NewExternalIPAddress>")
+	case "AddPortMapping":
+		if action.LeaseDuration != "0" {
+			g.fault(w, upnpErrOnlyPermanentLeases, "OnlyPermanentLeasesSupported")
+			return
+		}
+		g.mappings[action.ExternalPort] = action.InternalClient
+		g.respond(w, action.XMLName.Local, "")
+	case "DeletePortMapping":
+		if _, ok := g.mappings[action.ExternalPort]; !ok {
+			g.fault(w, 714, "NoSuchEntryInArray")
+			return
+		}
+		delete(g.mappings, action.ExternalPort)
+		g.respond(w, action.XMLName.Local, "")
+	default:
+		g.fault(w, 401, "Invalid Action")
+	}
+}
+
+func (g *fakeUPnPGateway) respond(w http.ResponseWriter, action, args string) {
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="%s"><s:Body><u:%sResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">%s</u:%sResponse></s:Body></s:Envelope>`,
+		upnpSOAPEnvelopeNamespace, action, args, action)
+}
+
+func (g *fakeUPnPGateway) fault(w http.ResponseWriter, code int, description string) {
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="%s"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`,
+		upnpSOAPEnvelopeNamespace, code, description)
+}
+
+func (g *fakeUPnPGateway) mapping(externalPort uint16) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	internalClient, ok := g.mappings[fmt.Sprint(externalPort)]
+	return internalClient, ok
+}
+
+func newTestClient(gateway netip.Addr, gatewayPort int, ssdpAddress string) *Client {
+	zLogger, _ := zap.NewDevelopment()
+	c := NewClient(zLogger.Sugar(), gateway)
+	c.gatewayPort = gatewayPort
+	c.ssdpAddress = ssdpAddress
+	c.timeout = 50 * time.Millisecond
+	return c
+}
+
+// closedPort returns a local UDP port that nothing listens on.
+func closedPort(t *testing.T) int {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, conn.Close())
+	return port
+}
+
+func TestMapPCP(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	gateway := newFakeGateway(t, true)
+	c := newTestClient(netip.MustParseAddr("127.0.0.1"), gateway.port(), fmt.Sprintf("127.0.0.1:%d", closedPort(t)))
+
+	m, err := c.Map(ctx, 51820, time.Hour)
+	require.NoError(err)
+	require.Equal(ProtocolPCP, m.Protocol)
+	require.Equal(51820, m.InternalPort)
+	require.Equal(netip.AddrPortFrom(fakeExternalIP, 61820), m.External)
+	require.Equal(time.Hour, m.Lifetime)
+	require.True(m.Reachable())
+
+	// the gateway only lets the client that made a mapping change it
+	m, err = c.Renew(ctx, m, 2*time.Hour)
+	require.NoError(err)
+	require.Equal(2*time.Hour, m.Lifetime)
+	lifetime, ok := gateway.mapping(51820)
+	require.True(ok)
+	require.Equal(2*time.Hour, lifetime)
+
+	require.NoError(c.Unmap(ctx, m))
+	_, ok = gateway.mapping(51820)
+	require.False(ok)
+}
+
+func TestMapNATPMP(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	gateway := newFakeGateway(t, false)
+	c := newTestClient(netip.MustParseAddr("127.0.0.1"), gateway.port(), fmt.Sprintf("127.0.0.1:%d", closedPort(t)))
+
+	m, err := c.Map(ctx, 51820, time.Hour)
+	require.NoError(err)
+	require.Equal(ProtocolNATPMP, m.Protocol)
+	require.Equal(netip.AddrPortFrom(fakeExternalIP, 61820), m.External)
+	require.Equal(time.Hour, m.Lifetime)
+
+	m, err = c.Renew(ctx, m, 2*time.Hour)
+	require.NoError(err)
+	require.Equal(ProtocolNATPMP, m.Protocol)
+	lifetime, ok := gateway.mapping(51820)
+	require.True(ok)
+	require.Equal(2*time.Hour, lifetime)
+
+	require.NoError(c.Unmap(ctx, m))
+	_, ok = gateway.mapping(51820)
+	require.False(ok)
+}
+
+func TestMapUPnP(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	gateway := newFakeUPnPGateway(t)
+	c := newTestClient(netip.Addr{}, 0, gateway.ssdp.LocalAddr().String())
+
+	m, err := c.Map(ctx, 51820, time.Hour)
+	require.NoError(err)
+	require.Equal(ProtocolUPnP, m.Protocol)
+	require.Equal(netip.AddrPortFrom(fakeExternalIP, 51820), m.External)
+	require.Equal(time.Hour, m.Lifetime)
+	internalClient, ok := gateway.mapping(51820)
+	require.True(ok)
+	require.Equal("127.0.0.1", internalClient)
+
+	m, err = c.Renew(ctx, m, time.Hour)
+	require.NoError(err)
+	require.Equal(netip.AddrPortFrom(fakeExternalIP, 51820), m.External)
+
+	require.NoError(c.Unmap(ctx, m))
+	_, ok = gateway.mapping(51820)
+	require.False(ok)
+}
+
+func TestMapNoGateway(t *testing.T) {
+	c := newTestClient(netip.MustParseAddr("127.0.0.1"), closedPort(t), fmt.Sprintf("127.0.0.1:%d", closedPort(t)))
+	_, err := c.Map(context.Background(), 51820, time.Hour)
+	require.ErrorIs(t, err, ErrNoGateway)
+}
+
+func TestReachable(t *testing.T) {
+	require := require.New(t)
+	require.True(Mapping{External: netip.MustParseAddrPort("203.0.113.1:51820")}.Reachable())
+	require.False(Mapping{External: netip.MustParseAddrPort("192.168.1.1:51820")}.Reachable())
+	require.False(Mapping{External: netip.MustParseAddrPort("100.64.0.1:51820")}.Reachable())
+	require.False(Mapping{External: netip.MustParseAddrPort("0.0.0.0:51820")}.Reachable())
+}
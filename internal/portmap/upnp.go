@@ -0,0 +1,345 @@
+package portmap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// how long UPnP gateways are given to answer the discovery request
+	ssdpWait = 1500 * time.Millisecond
+
+	// the UPnP error codes AddPortMapping is retried on
+	upnpErrConflict            = 718
+	upnpErrOnlyPermanentLeases = 725
+
+	upnpPortMappingDescription = "nexodus"
+	upnpInternetGatewayDevice  = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+	upnpWANIPConnectionPrefix  = "urn:schemas-upnp-org:service:WANIPConnection:"
+	upnpWANPPPConnectionPrefix = "urn:schemas-upnp-org:service:WANPPPConnection:"
+	upnpSOAPEnvelopeNamespace  = "http://schemas.xmlsoap.org/soap/envelope/"
+	upnpSOAPEncodingStyle      = "http://schemas.xmlsoap.org/soap/encoding/"
+
+	upnpMaxDescriptionSize       = 1 << 20
+	upnpMaxControlResponseSize   = 64 << 10
+	upnpMaxDiscoveryResponseSize = 2048
+)
+
+// upnpService is the WAN connection service of a UPnP gateway, that port mappings are made on.
+type upnpService struct {
+	client      *http.Client
+	controlURL  string
+	serviceType string
+	// the address of this host on the network of the gateway
+	internalClient netip.Addr
+}
+
+// upnpError is the error a UPnP action failed with.
+type upnpError struct {
+	code        int
+	description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.code, e.description)
+}
+
+// mapUPnP makes or renews a mapping with a UPnP gateway, which is discovered for new mappings.
+func (c *Client) mapUPnP(ctx context.Context, m Mapping, lifetime time.Duration) (Mapping, error) {
+	service := m.upnp
+	if service == nil {
+		var err error
+		service, err = c.upnpDiscover(ctx)
+		if err != nil {
+			return Mapping{}, err
+		}
+	}
+
+	externalIP, err := service.externalIPAddress(ctx)
+	if err != nil {
+		return Mapping{}, err
+	}
+	externalPort := m.External.Port()
+	if externalPort == 0 {
+		externalPort = uint16(m.InternalPort)
+	}
+	lease := lifetime
+	for attempt := 0; ; attempt++ {
+		err = service.addPortMapping(ctx, externalPort, m.InternalPort, lease)
+		var upnpErr *upnpError
+		if err == nil || !errors.As(err, &upnpErr) || attempt == 2 {
+			break
+		}
+		switch upnpErr.code {
+		case upnpErrOnlyPermanentLeases:
+			// the mapping is still renewed as if it had the lifetime asked for, and removed once it is not used
+			lease = 0
+		case upnpErrConflict:
+			// another host on the network has the port mapped
+			externalPort = uint16(1024 + rand.Intn(65535-1024))
+		default:
+			return Mapping{}, err
+		}
+	}
+	if err != nil {
+		return Mapping{}, err
+	}
+	return Mapping{
+		Protocol:     ProtocolUPnP,
+		InternalPort: m.InternalPort,
+		External:     netip.AddrPortFrom(externalIP, externalPort),
+		Lifetime:     lifetime,
+		upnp:         service,
+	}, nil
+}
+
+// upnpDiscover finds the WAN connection service of a UPnP gateway on the local network with an SSDP search.
+func (c *Client) upnpDiscover(ctx context.Context) (*upnpService, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ssdpAddr, err := net.ResolveUDPAddr("udp4", c.ssdpAddress)
+	if err != nil {
+		return nil, err
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + upnpInternetGatewayDevice + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), ssdpAddr); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(ssdpWait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var errs []error
+	seen := map[string]bool{}
+	buf := make([]byte, upnpMaxDiscoveryResponseSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil || response.StatusCode != http.StatusOK {
+			continue
+		}
+		location := response.Header.Get("Location")
+		if location == "" || seen[location] {
+			continue
+		}
+		seen[location] = true
+		service, err := upnpServiceAt(ctx, location)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gateway at %s: %w", location, err))
+			continue
+		}
+		return service, nil
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, fmt.Errorf("no UPnP gateway answered")
+}
+
+// upnpDevice is the part of a UPnP device description the WAN connection service is looked up in.
+type upnpDevice struct {
+	DeviceType string `xml:"deviceType"`
+	Services   []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// wanConnection returns the type and control URL of the first WAN connection service of the device or the devices
+// it embeds.
+func (d upnpDevice) wanConnection() (string, string, bool) {
+	for _, service := range d.Services {
+		if strings.HasPrefix(service.ServiceType, upnpWANIPConnectionPrefix) || strings.HasPrefix(service.ServiceType, upnpWANPPPConnectionPrefix) {
+			return service.ServiceType, service.ControlURL, true
+		}
+	}
+	for _, device := range d.Devices {
+		if serviceType, controlURL, ok := device.wanConnection(); ok {
+			return serviceType, controlURL, true
+		}
+	}
+	return "", "", false
+}
+
+// upnpServiceAt reads the device description of a UPnP gateway for its WAN connection service.
+func upnpServiceAt(ctx context.Context, location string) (*upnpService, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device description request failed with status %s", res.Status)
+	}
+	var description struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(res.Body, upnpMaxDescriptionSize)).Decode(&description); err != nil {
+		return nil, fmt.Errorf("invalid device description: %w", err)
+	}
+	serviceType, controlURL, ok := description.Device.wanConnection()
+	if !ok {
+		return nil, fmt.Errorf("the gateway has no WAN connection service")
+	}
+
+	base := location
+	if description.URLBase != "" {
+		base = description.URLBase
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	control, err := baseURL.Parse(controlURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// the gateway maps ports to the address this host reaches it from
+	port := control.Port()
+	if port == "" {
+		port = "80"
+	}
+	conn, err := net.Dial("udp4", net.JoinHostPort(control.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.Close()
+	return &upnpService{
+		client:         client,
+		controlURL:     control.String(),
+		serviceType:    serviceType,
+		internalClient: conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap(),
+	}, nil
+}
+
+func (s *upnpService) externalIPAddress(ctx context.Context) (netip.Addr, error) {
+	var response struct {
+		IP string `xml:"NewExternalIPAddress"`
+	}
+	if err := s.call(ctx, "GetExternalIPAddress", nil, &response); err != nil {
+		return netip.Addr{}, err
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(response.IP))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid external address %q: %w", response.IP, err)
+	}
+	return ip, nil
+}
+
+func (s *upnpService) addPortMapping(ctx context.Context, externalPort uint16, internalPort int, lease time.Duration) error {
+	return s.call(ctx, "AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(externalPort))},
+		{"NewProtocol", "UDP"},
+		{"NewInternalPort", strconv.Itoa(internalPort)},
+		{"NewInternalClient", s.internalClient.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", upnpPortMappingDescription},
+		{"NewLeaseDuration", strconv.Itoa(int(lease / time.Second))},
+	}, nil)
+}
+
+func (s *upnpService) deletePortMapping(ctx context.Context, externalPort uint16) error {
+	return s.call(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(externalPort))},
+		{"NewProtocol", "UDP"},
+	}, nil)
+}
+
+// call invokes a SOAP action on the service, with the arguments in the order given, and decodes the response
+// arguments into result when it is not nil.
+func (s *upnpService) call(ctx context.Context, action string, args [][2]string, result interface{}) error {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>`)
+	body.WriteString(`<s:Envelope xmlns:s="` + upnpSOAPEnvelopeNamespace + `" s:encodingStyle="` + upnpSOAPEncodingStyle + `">`)
+	body.WriteString(`<s:Body><u:` + action + ` xmlns:u="` + s.serviceType + `">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		if err := xml.EscapeText(&body, []byte(arg[1])); err != nil {
+			return err
+		}
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.controlURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+s.serviceType+"#"+action+`"`)
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, upnpMaxControlResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var fault struct {
+			Code        int    `xml:"Body>Fault>detail>UPnPError>errorCode"`
+			Description string `xml:"Body>Fault>detail>UPnPError>errorDescription"`
+		}
+		if err := xml.Unmarshal(data, &fault); err != nil || fault.Code == 0 {
+			return fmt.Errorf("%s failed with status %s", action, res.Status)
+		}
+		return &upnpError{code: fault.Code, description: fault.Description}
+	}
+	if result == nil {
+		return nil
+	}
+	var envelope struct {
+		Body struct {
+			Response struct {
+				Inner []byte `xml:",innerxml"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("invalid %s response: %w", action, err)
+	}
+	inner := append(append([]byte("<r>"), envelope.Body.Response.Inner...), "</r>"...)
+	if err := xml.Unmarshal(inner, result); err != nil {
+		return fmt.Errorf("invalid %s response: %w", action, err)
+	}
+	return nil
+}
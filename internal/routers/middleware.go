@@ -31,7 +31,7 @@ var policy string
 var jwksCache = cache.NewMemoizeCache[string, string](time.Second*30, time.Second*5)
 
 // Naive JWS Key validation
-func ValidateJWT(ctx context.Context, o APIRouterOptions, jwksURI string, nexodusJWKS string) (func(*gin.Context), error) {
+func ValidateJWT(ctx context.Context, o APIRouterOptions, jwksURI string) (func(*gin.Context), error) {
 	query, err := rego.New(
 		rego.Query(`result = {
 			"authorized": data.token.valid_token,
@@ -67,6 +67,14 @@ func ValidateJWT(ctx context.Context, o APIRouterOptions, jwksURI string, nexodu
 			return
 		}
 
+		// the signing keys rotate, so the nexodus key set is fetched for every request from the api's cache
+		nexodusJWKS, err := o.Api.JSONWebKeySet(c.Request.Context())
+		if err != nil {
+			handlers.SendInternalServerError(c, o.Logger, err)
+			c.Abort()
+			return
+		}
+
 		authHeader := c.Request.Header.Get("Authorization")
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 {
@@ -82,7 +90,7 @@ func ValidateJWT(ctx context.Context, o APIRouterOptions, jwksURI string, nexodu
 		path := strings.Split(strings.TrimLeft(c.Request.URL.Path, "/"), "/")
 		input := map[string]interface{}{
 			"jwks":         keySet,
-			"nexodus_jwks": nexodusJWKS,
+			"nexodus_jwks": string(nexodusJWKS),
 			"access_token": parts[1],
 			"method":       c.Request.Method,
 			"path":         path,
@@ -96,12 +96,7 @@ func NewAPIRouter(ctx context.Context, o APIRouterOptions) (*gin.Engine, error)
 	apiGroup := r.Group("/api", loggerMiddleware)
 	{
 		api := o.Api
-		nexodusJWKS, err := api.JSONWebKeySet()
-		if err != nil {
-			return nil, err
-		}
-
-		validateJWT, err := newValidateJWT(ctx, o, string(nexodusJWKS))
+		validateJWT, err := newValidateJWT(ctx, o)
 		if err != nil {
 			return nil, err
 		}
@@ -136,6 +131,7 @@ func NewAPIRouter(ctx context.Context, o APIRouterOptions) (*gin.Engine, error)
 		apiGroup.PATCH("/vpcs/:id", api.UpdateVPC)
 		apiGroup.POST("/vpcs", api.CreateVPC)
 		apiGroup.DELETE("/vpcs/:id", api.DeleteVPC)
+		apiGroup.GET("/vpcs/:id/connectivity", api.GetVPCConnectivity)
 
 		// Registration Tokens
 		apiGroup.GET("/reg-keys", api.ListRegKeys)
@@ -150,8 +146,18 @@ func NewAPIRouter(ctx context.Context, o APIRouterOptions) (*gin.Engine, error)
 		apiGroup.PATCH("/devices/:id", api.UpdateDevice)
 		apiGroup.POST("/devices", api.CreateDevice)
 		apiGroup.DELETE("/devices/:id", api.DeleteDevice)
+		apiGroup.POST("/devices/:id/rotate-token", api.RotateDeviceToken)
+		apiGroup.GET("/devices/:id/tcp-relay", api.TCPRelay)
+		apiGroup.POST("/devices/:id/hole-punches", api.CreateHolePunch)
+		apiGroup.PATCH("/devices/:id/hole-punches/:hole_punch_id", api.AnswerHolePunch)
+		apiGroup.GET("/devices/:id/actions", api.ListDeviceActions)
+		apiGroup.POST("/devices/:id/actions", api.CreateDeviceAction)
+		apiGroup.GET("/devices/:id/actions/:action_id", api.GetDeviceAction)
+		apiGroup.PATCH("/devices/:id/actions/:action_id", api.UpdateDeviceAction)
+		apiGroup.POST("/devices/:id/telemetry", api.ReportDeviceTelemetry)
 
 		// Device Metadata
+		apiGroup.GET("/devices/:id/preshared-keys", api.ListDevicePresharedKeys)
 		apiGroup.GET("/devices/:id/metadata", api.ListDeviceMetadata)
 		apiGroup.GET("/devices/:id/metadata/:key", api.GetDeviceMetadataKey)
 		apiGroup.PUT("/devices/:id/metadata/:key", api.UpdateDeviceMetadataKey)
@@ -164,12 +170,25 @@ func NewAPIRouter(ctx context.Context, o APIRouterOptions) (*gin.Engine, error)
 		apiGroup.POST("/security-groups", api.CreateSecurityGroup)
 		apiGroup.PATCH("/security-groups/:id", api.UpdateSecurityGroup)
 		apiGroup.DELETE("/security-groups/:id", api.DeleteSecurityGroup)
+		apiGroup.GET("/security-groups/:id/grants", api.ListSecurityGroupGrants)
+		apiGroup.POST("/security-groups/:id/grants", api.CreateSecurityGroupGrant)
+		apiGroup.DELETE("/security-groups/:id/grants/:grant", api.RevokeSecurityGroupGrant)
+
+		// Device Profiles
+		apiGroup.GET("/device-profiles", api.ListDeviceProfiles)
+		apiGroup.GET("/device-profiles/:id", api.GetDeviceProfile)
+		apiGroup.POST("/device-profiles", api.CreateDeviceProfile)
+		apiGroup.PATCH("/device-profiles/:id", api.UpdateDeviceProfile)
+		apiGroup.DELETE("/device-profiles/:id", api.DeleteDeviceProfile)
 
 		// List / Watch Event API used by nexd
 		apiGroup.POST("/vpcs/:id/events", api.WatchEvents)
 		apiGroup.GET("/vpcs/:id/devices", api.ListDevicesInVPC)
 		apiGroup.GET("/vpcs/:id/metadata", api.ListMetadataInVPC)
 		apiGroup.GET("/vpcs/:id/security-groups", api.ListSecurityGroupsInVPC)
+		apiGroup.GET("/vpcs/:id/hole-punches", api.ListHolePunchesInVPC)
+		apiGroup.GET("/vpcs/:id/device-profiles", api.ListDeviceProfilesInVPC)
+		apiGroup.GET("/vpcs/:id/device-actions", api.ListDeviceActionsInVPC)
 
 	}
 
@@ -183,7 +202,7 @@ func NewAPIRouter(ctx context.Context, o APIRouterOptions) (*gin.Engine, error)
 	return r, nil
 }
 
-func newValidateJWT(ctx context.Context, o APIRouterOptions, nexodusJWKS string) (func(*gin.Context), error) {
+func newValidateJWT(ctx context.Context, o APIRouterOptions) (func(*gin.Context), error) {
 	if o.InsecureTLS {
 		transport := &http.Transport{
 			// #nosec -- G402: TLS InsecureSkipVerify set true.
@@ -211,7 +230,7 @@ func newValidateJWT(ctx context.Context, o APIRouterOptions, nexodusJWKS string)
 		return nil, err
 	}
 
-	return ValidateJWT(ctx, o, claims.JWKSUri, nexodusJWKS)
+	return ValidateJWT(ctx, o, claims.JWKSUri)
 }
 
 func newPrometheus() *ginprometheus.Prometheus {
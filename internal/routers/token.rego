@@ -182,6 +182,16 @@ allow if {
 	"devices" = input.path[1]
 }
 
+# device tokens can rotate themselves
+allow if {
+	valid_nexodus_token
+	contains(token_payload.scope, "device-token")
+	input.method == "POST"
+	count(input.path) == 4
+	"devices" = input.path[1]
+	"rotate-token" = input.path[3]
+}
+
 allow if {
 	input.path[1] in ["organizations", "vpcs"]
 	action_is_read
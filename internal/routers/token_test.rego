@@ -39,6 +39,10 @@ mock_decode("user-read-jwt") := [{}, valid_user("openid profile email read:users
 
 mock_decode_verify("bad-jwt", _) := [false, {}, {}]
 
+mock_decode_verify("device-token-jwt", _) := [true, {}, {}]
+
+mock_decode("device-token-jwt") := [{}, {"sub": "00a7b7f4-f11f-4ea3-89de-7b1cde4316a9", "scope": "device-token"}, {}]
+
 test_org_get_allowed if {
 	token.allow with input.path as ["api", "organizations"]
 		with input.method as "GET"
@@ -200,3 +204,21 @@ test_get_fflags_bad_jwt_denied if {
 		with io.jwt.decode_verify as mock_decode_verify
 		with io.jwt.decode as mock_decode
 }
+
+test_device_token_rotate_allowed if {
+	token.allow with input.path as ["api", "devices", "foo", "rotate-token"]
+		with input.method as "POST"
+		with input.nexodus_jwks as "my-cert"
+		with input.access_token as "device-token-jwt"
+		with io.jwt.decode_verify as mock_decode_verify
+		with io.jwt.decode as mock_decode
+}
+
+test_device_token_create_device_denied if {
+	not token.allow with input.path as ["api", "devices"]
+		with input.method as "POST"
+		with input.nexodus_jwks as "my-cert"
+		with input.access_token as "device-token-jwt"
+		with io.jwt.decode_verify as mock_decode_verify
+		with io.jwt.decode as mock_decode
+}
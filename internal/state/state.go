@@ -3,7 +3,9 @@ package state
 import (
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/nexodus-io/nexodus/internal/api/public"
 	"golang.org/x/oauth2"
 )
 
@@ -13,8 +15,32 @@ type State struct {
 	PrivateKey       string           `json:"private-key"`
 	ProxyRulesConfig ProxyRulesConfig `json:"proxy-rules-config"`
 	Port             int              `json:"port"`
+	Cache            *Cache           `json:"cache,omitempty"`
+	// the private key the wireguard interface keeps using until KeySwitchAt, after a key rotation
+	PreviousPrivateKey string     `json:"previous-private-key,omitempty"`
+	KeySwitchAt        *time.Time `json:"key-switch-at,omitempty"`
 }
 
+// Cache holds what the device last learned from the apiserver, so that it can bring up its peers
+// when the apiserver is unreachable at start up.
+type Cache struct {
+	ApiURLs  []string         `json:"api-urls"`
+	VPC      public.ModelsVPC `json:"vpc"`
+	DeviceID string           `json:"device-id"`
+	// the devices of the vpc, without their bearer tokens
+	Devices         []public.ModelsDevice `json:"devices"`
+	DevicesRevision int32                 `json:"devices-revision"`
+	// the security groups of the organization of the vpc
+	SecurityGroups         []public.ModelsSecurityGroup `json:"security-groups"`
+	SecurityGroupsRevision int32                        `json:"security-groups-revision"`
+	// the preshared keys of the device, sealed with its public key
+	PresharedKeys []public.ModelsPeerPresharedKey `json:"preshared-keys,omitempty"`
+	// the device profile assigned to the device, nil without one
+	DeviceProfile *public.ModelsDeviceProfile `json:"device-profile,omitempty"`
+}
+
+// ProxyRulesConfig holds the proxy rules added with nexctl, each in the protocol:port:destination_ip:destination_port
+// form followed by its load balancing options, if any.
 type ProxyRulesConfig struct {
 	Egress  []string `json:"egress"`
 	Ingress []string `json:"ingress"`
@@ -0,0 +1,180 @@
+package stun
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/stun"
+	"go.uber.org/zap"
+)
+
+// Behavior is how a NAT maps or filters the UDP traffic of a device, see RFC 4787.
+type Behavior string
+
+const (
+	// EndpointIndependent NATs use the same mapping for, or let in traffic from, any destination.
+	EndpointIndependent Behavior = "endpoint-independent"
+	// AddressDependent NATs use a mapping per destination ip, or only let in traffic from ips the device sent to.
+	AddressDependent Behavior = "address-dependent"
+	// AddressAndPortDependent NATs use a mapping per destination ip and port, or only let in traffic from the
+	// ips and ports the device sent to. A NAT with this mapping behavior is what is usually called symmetric.
+	AddressAndPortDependent Behavior = "address-and-port-dependent"
+)
+
+// NatBehavior classifies the NAT in front of a device as described in RFC 5780.
+type NatBehavior struct {
+	Mapping   Behavior
+	Filtering Behavior
+	// Hairpinning is whether the NAT forwards traffic the device sends to its own reflexive address back to it.
+	Hairpinning bool
+}
+
+// ErrBehaviorDiscoveryUnsupported is returned by DiscoverBehavior for stun servers without an alternate address.
+var ErrBehaviorDiscoveryUnsupported = errors.New("the stun server does not support NAT behavior discovery")
+
+var (
+	// how long to wait for the answer to a behavior discovery request before sending it again
+	behaviorRequestTimeout = 500 * time.Millisecond
+	// how many times a behavior discovery request is sent before it is considered unanswered
+	behaviorRequestAttempts = 3
+	errBehaviorNoAnswer     = errors.New("no answer")
+)
+
+// DiscoverBehavior classifies the NAT in front of this device with the tests of RFC 5780, which need a stun server
+// that supports CHANGE-REQUEST and OTHER-ADDRESS. The tests are run from an ephemeral port, NATs treat every port the
+// same way.
+func DiscoverBehavior(logger *zap.SugaredLogger, stunServer string) (NatBehavior, error) {
+	result := NatBehavior{}
+	server, err := net.ResolveUDPAddr("udp4", stunServer)
+	if err != nil {
+		return result, fmt.Errorf("failed to resolve the stun server %s: %w", stunServer, err)
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to listen for the stun server %s: %w", stunServer, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// Test I: the mapped address, and the alternate address of the server.
+	mapped1, other, err := behaviorBinding(conn, server, 0)
+	if err != nil {
+		return result, err
+	}
+	if other == nil {
+		return result, ErrBehaviorDiscoveryUnsupported
+	}
+
+	// The filtering tests go first, before this device sends anything to the alternate address of the server.
+	_, _, err = behaviorBinding(conn, server, changeRequestIP|changeRequestPort)
+	switch {
+	case err == nil:
+		result.Filtering = EndpointIndependent
+	case errors.Is(err, errBehaviorNoAnswer):
+		_, _, err = behaviorBinding(conn, server, changeRequestPort)
+		switch {
+		case err == nil:
+			result.Filtering = AddressDependent
+		case errors.Is(err, errBehaviorNoAnswer):
+			result.Filtering = AddressAndPortDependent
+		default:
+			return result, err
+		}
+	default:
+		return result, err
+	}
+
+	// Test II and III of the mapping: the mapped address for the alternate ip, then for the alternate ip and port.
+	mapped2, _, err := behaviorBinding(conn, &net.UDPAddr{IP: other.IP, Port: server.Port}, 0)
+	if err != nil {
+		return result, err
+	}
+	if mapped2.String() == mapped1.String() {
+		result.Mapping = EndpointIndependent
+	} else {
+		mapped3, _, err := behaviorBinding(conn, other, 0)
+		if err != nil {
+			return result, err
+		}
+		if mapped3.String() == mapped2.String() {
+			result.Mapping = AddressDependent
+		} else {
+			result.Mapping = AddressAndPortDependent
+		}
+	}
+
+	// Hairpinning: a request sent to the mapped address comes back to this device.
+	request := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	_, err = behaviorTransact(conn, mapped1, request, stun.BindingRequest)
+	switch {
+	case err == nil:
+		result.Hairpinning = true
+	case !errors.Is(err, errBehaviorNoAnswer):
+		return result, err
+	}
+
+	logger.Debugf("NAT behavior: mapping %s, filtering %s, hairpinning %v", result.Mapping, result.Filtering, result.Hairpinning)
+	return result, nil
+}
+
+// behaviorBinding sends a binding request with the CHANGE-REQUEST flags given to dst, and returns the mapped address
+// and the alternate address of the server from the answer.
+func behaviorBinding(conn *net.UDPConn, dst *net.UDPAddr, change byte) (*net.UDPAddr, *net.UDPAddr, error) {
+	setters := []stun.Setter{stun.TransactionID, stun.BindingRequest}
+	if change != 0 {
+		setters = append(setters, stun.RawAttribute{Type: stun.AttrChangeRequest, Value: []byte{0, 0, 0, change}})
+	}
+	response, err := behaviorTransact(conn, dst, stun.MustBuild(setters...), stun.BindingSuccess)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var mapped stun.XORMappedAddress
+	if err := mapped.GetFrom(response); err != nil {
+		return nil, nil, fmt.Errorf("the stun response has no mapped address: %w", err)
+	}
+	var other *net.UDPAddr
+	var otherAddress stun.OtherAddress
+	if otherAddress.GetFrom(response) == nil {
+		other = &net.UDPAddr{IP: otherAddress.IP, Port: otherAddress.Port}
+	}
+	return &net.UDPAddr{IP: mapped.IP, Port: mapped.Port}, other, nil
+}
+
+// behaviorTransact sends the request to dst until a message of the expected type with its transaction id is received.
+func behaviorTransact(conn *net.UDPConn, dst *net.UDPAddr, request *stun.Message, expected stun.MessageType) (*stun.Message, error) {
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < behaviorRequestAttempts; attempt++ {
+		if _, err := conn.WriteTo(request.Raw, dst); err != nil {
+			return nil, fmt.Errorf("failed to send a stun request to %s: %w", dst, err)
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(behaviorRequestTimeout)); err != nil {
+			return nil, err
+		}
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			m := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+			if m.Decode() != nil || m.TransactionID != request.TransactionID {
+				// not a stun message, or the late answer to an earlier request
+				continue
+			}
+			if m.Type == stun.BindingError {
+				return nil, ErrBehaviorDiscoveryUnsupported
+			}
+			if m.Type == expected {
+				return m, nil
+			}
+		}
+	}
+	return nil, errBehaviorNoAnswer
+}
@@ -10,11 +10,22 @@ import (
 )
 
 func RequestWithReusePort(logger *zap.SugaredLogger, stunServer string, srcPort int) (netip.AddrPort, error) {
+	return requestWithReusePort(logger, "udp4", stunServer, srcPort)
+}
+
+// RequestIPv6 returns the reflexive address of srcPort over IPv6, as seen by the stun server. A srcPort of 0 sends
+// the request from an ephemeral port.
+func RequestIPv6(logger *zap.SugaredLogger, stunServer string, srcPort int) (netip.AddrPort, error) {
+	return requestWithReusePort(logger, "udp6", stunServer, srcPort)
+}
+
+func requestWithReusePort(logger *zap.SugaredLogger, network, stunServer string, srcPort int) (netip.AddrPort, error) {
 	logger.Debugf("dialing stun Server %s", stunServer)
-	conn, err := reuseport.Dial("udp4", fmt.Sprintf(":%d", srcPort), stunServer)
+	conn, err := reuseport.Dial(network, fmt.Sprintf(":%d", srcPort), stunServer)
 	if err != nil {
-		// Windows is currently not capable of binding to the source wg port to source STUN requests
-		if runtime.GOOS != "windows" {
+		// Windows is currently not capable of binding to the source wg port to source STUN requests, and
+		// over IPv6 the port is expected to be taken by kernel wireguard
+		if runtime.GOOS != "windows" && network == "udp4" {
 			logger.Errorf("stun dialing timed out %v", err)
 		}
 		return netip.AddrPort{}, fmt.Errorf("failed to dial stun Server %s: %w", stunServer, err)
@@ -61,3 +72,22 @@ func RequestWithReusePort(logger *zap.SugaredLogger, stunServer string, srcPort
 
 	return xorBinding, nil
 }
+
+// PunchWithReusePort sends a STUN binding request from srcPort to each destination without waiting for a response,
+// so that the NAT maps srcPort for the destinations.
+func PunchWithReusePort(logger *zap.SugaredLogger, dsts []netip.AddrPort, srcPort int) error {
+	message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	for _, dst := range dsts {
+		conn, err := reuseport.Dial("udp4", fmt.Sprintf(":%d", srcPort), dst.String())
+		if err != nil {
+			return fmt.Errorf("failed to dial %s: %w", dst, err)
+		}
+		_, err = conn.Write(message.Raw)
+		_ = conn.Close()
+		if err != nil {
+			return fmt.Errorf("failed to punch %s: %w", dst, err)
+		}
+	}
+	logger.Debugf("punched %d endpoints from port %d", len(dsts), srcPort)
+	return nil
+}
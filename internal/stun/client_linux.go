@@ -74,6 +74,38 @@ func Request(logger *zap.SugaredLogger, stunSvr string, srcPort int) (netip.Addr
 	return xorBinding, nil
 }
 
+// Punch sends a STUN binding request from srcPort to each destination without waiting for a response, so that the
+// NAT maps srcPort for the destinations. Like Request, it uses a raw socket to share the port with kernel wireguard.
+func Punch(logger *zap.SugaredLogger, dsts []netip.AddrPort, srcPort int) error {
+	conn, err := net.ListenPacket("ip4:udp", "0.0.0.0")
+	if err != nil {
+		if strings.Contains(err.Error(), "operation not permitted") {
+			// try again with an unprivileged version...
+			return PunchWithReusePort(logger, dsts, srcPort)
+		}
+		return fmt.Errorf("failed to listen on ipv4: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	for _, dst := range dsts {
+		if !dst.Addr().Is4() {
+			continue
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint16(buf[0:], uint16(srcPort))
+		binary.BigEndian.PutUint16(buf[2:], dst.Port())
+		binary.BigEndian.PutUint16(buf[4:], uint16(8+len(message.Raw)))
+		if _, err := conn.WriteTo(append(buf, message.Raw...), &net.IPAddr{IP: dst.Addr().AsSlice()}); err != nil {
+			return fmt.Errorf("failed to punch %s: %w", dst, err)
+		}
+	}
+	logger.Debugf("punched %d endpoints from port %d", len(dsts), srcPort)
+	return nil
+}
+
 func (c *stunSession) stunTransact(logger *zap.SugaredLogger, msg *stun.Message, addr net.Addr) (*stun.Message, error) {
 	_ = msg.NewTransactionID()
 	logger.Debugf("send to %v: (%v bytes)", addr, msg.Length)
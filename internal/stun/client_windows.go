@@ -11,3 +11,7 @@ import (
 func Request(logger *zap.SugaredLogger, stunServer string, srcPort int) (netip.AddrPort, error) {
 	return RequestWithReusePort(logger, stunServer, srcPort)
 }
+
+func Punch(logger *zap.SugaredLogger, dsts []netip.AddrPort, srcPort int) error {
+	return PunchWithReusePort(logger, dsts, srcPort)
+}
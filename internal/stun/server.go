@@ -2,6 +2,7 @@ package stun
 
 import (
 	"errors"
+	"fmt"
 	"github.com/nexodus-io/nexodus/internal/util"
 	"github.com/pion/stun"
 	"go.uber.org/zap"
@@ -49,15 +50,103 @@ func ListenAndStart(address string, log *zap.Logger) (*ClosableServer, error) {
 	return s, nil
 }
 
+// ListenAndStartWithAlternate starts a server that also answers from an alternate ip and port, so that clients can
+// discover the behavior of their NAT as described in RFC 5780. The server listens on the four combinations of the
+// ips and ports of address and alternateAddress, both of which need a specific ip, and answers a CHANGE-REQUEST
+// from the combination asked for.
+func ListenAndStartWithAlternate(address, alternateAddress string, log *zap.Logger) (*ClosableServer, error) {
+	primary, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	alternate, err := net.ResolveUDPAddr("udp", alternateAddress)
+	if err != nil {
+		return nil, err
+	}
+	if primary.IP == nil || primary.IP.IsUnspecified() || alternate.IP == nil || alternate.IP.IsUnspecified() {
+		return nil, fmt.Errorf("the primary and alternate addresses need a specific ip")
+	}
+	if primary.IP.Equal(alternate.IP) {
+		return nil, fmt.Errorf("the alternate address needs a different ip than the primary address")
+	}
+
+	if log == nil {
+		log = zap.NewNop()
+	}
+	s := &ClosableServer{
+		Server: Server{
+			Log:   log,
+			conns: &[2][2]net.PacketConn{},
+		},
+	}
+	listen := func(ip, port int, addr *net.UDPAddr) (int, error) {
+		conn, err := net.ListenPacket("udp", addr.String())
+		if err != nil {
+			_ = s.Close()
+			return 0, err
+		}
+		s.conns[ip][port] = conn
+		return conn.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+	primaryPort, err := listen(0, 0, primary)
+	if err != nil {
+		return nil, err
+	}
+	alternatePort, err := listen(1, 1, alternate)
+	if err != nil {
+		return nil, err
+	}
+	if primaryPort == alternatePort {
+		_ = s.Close()
+		return nil, fmt.Errorf("the alternate address needs a different port than the primary address")
+	}
+	if _, err := listen(0, 1, &net.UDPAddr{IP: primary.IP, Port: alternatePort}); err != nil {
+		return nil, err
+	}
+	if _, err := listen(1, 0, &net.UDPAddr{IP: alternate.IP, Port: primaryPort}); err != nil {
+		return nil, err
+	}
+	s.conn = s.conns[0][0]
+	s.Port = primaryPort
+	s.AlternatePort = alternatePort
+
+	s.Log.Info("Stun server listening", zap.Int("port", primaryPort), zap.String("alternate", s.conns[1][1].LocalAddr().String()))
+
+	for ip := range s.conns {
+		for port := range s.conns[ip] {
+			ip, port := ip, port
+			util.GoWithWaitGroup(&s.wg, func() {
+				if err := s.serve(s.conns[ip][port], ip, port); err != nil {
+					s.Log.Info("Failed Serve", zap.Error(err))
+				}
+			})
+		}
+	}
+
+	return s, nil
+}
+
 type ClosableServer struct {
 	conn net.PacketConn
 	wg   sync.WaitGroup
 	Server
-	Port int
+	Port          int
+	AlternatePort int // the port of the alternate address, 0 unless started by ListenAndStartWithAlternate
 }
 
 func (s *ClosableServer) Close() error {
-	return s.conn.Close()
+	if s.conns == nil {
+		return s.conn.Close()
+	}
+	var errs []error
+	for ip := range s.conns {
+		for port := range s.conns[ip] {
+			if s.conns[ip][port] != nil {
+				errs = append(errs, s.conns[ip][port].Close())
+			}
+		}
+	}
+	return errors.Join(errs...)
 }
 func (s *ClosableServer) Shutdown() error {
 	err := s.Close()
@@ -88,9 +177,22 @@ func ListenAndServe(address string, log *zap.Logger) error {
 
 type Server struct {
 	Log *zap.Logger
+	// conns are the sockets of a server that also answers from an alternate address, by ip and then by port with
+	// the primary one first. nil when the server only has the one address.
+	conns *[2][2]net.PacketConn
 }
 
+const (
+	changeRequestIP   = 0x04
+	changeRequestPort = 0x02
+)
+
 func (s *Server) Serve(conn net.PacketConn) error {
+	return s.serve(conn, 0, 0)
+}
+
+// serve answers the requests received on conn, which is the socket of the ip and port with the given indexes in conns.
+func (s *Server) serve(conn net.PacketConn, ip, port int) error {
 	buf := make([]byte, 1024)
 	response := stun.Message{}
 	request := stun.Message{}
@@ -126,20 +228,59 @@ func (s *Server) Serve(conn net.PacketConn) error {
 			continue
 		}
 
+		var change byte
+		if value, err := request.Get(stun.AttrChangeRequest); err == nil {
+			if len(value) != 4 {
+				s.Log.Debug("Invalid CHANGE-REQUEST")
+				continue
+			}
+			change = value[3]
+		}
+
 		response.Reset()
-		err = response.Build(&request,
-			stun.BindingSuccess,
-			software,
-			&fromAddress,
-			stun.Fingerprint,
-		)
+		responseConn := conn
+		switch {
+		case change != 0 && s.conns == nil:
+			// without an alternate address, CHANGE-REQUEST is an attribute this server does not understand
+			err = response.Build(&request,
+				stun.BindingError,
+				software,
+				stun.CodeUnknownAttribute,
+				stun.UnknownAttributes{stun.AttrChangeRequest},
+				stun.Fingerprint,
+			)
+		case s.conns != nil:
+			responseIP, responsePort := ip, port
+			if change&changeRequestIP != 0 {
+				responseIP = 1 - ip
+			}
+			if change&changeRequestPort != 0 {
+				responsePort = 1 - port
+			}
+			responseConn = s.conns[responseIP][responsePort]
+			other := s.conns[1-ip][1-port].LocalAddr().(*net.UDPAddr)
+			err = response.Build(&request,
+				stun.BindingSuccess,
+				software,
+				&fromAddress,
+				&stun.OtherAddress{IP: other.IP, Port: other.Port},
+				stun.Fingerprint,
+			)
+		default:
+			err = response.Build(&request,
+				stun.BindingSuccess,
+				software,
+				&fromAddress,
+				stun.Fingerprint,
+			)
+		}
 
 		if err != nil {
 			s.Log.Info("Failed response.Build", zap.Error(err))
 			continue
 		}
 
-		_, err = conn.WriteTo(response.Raw, addr)
+		_, err = responseConn.WriteTo(response.Raw, addr)
 		if err != nil {
 			s.Log.Info("Failed conn.WriteTo", zap.Error(err))
 		}
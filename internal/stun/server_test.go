@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"github.com/nexodus-io/nexodus/internal/stun"
 	"github.com/nexodus-io/nexodus/internal/util"
+	pionstun "github.com/pion/stun"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestListenAndStart(t *testing.T) {
@@ -20,3 +23,69 @@ func TestListenAndStart(t *testing.T) {
 	_, err = stun.Request(log.Sugar(), fmt.Sprintf("127.0.0.1:%d", server.Port), 0)
 	require.NoError(err)
 }
+
+func TestListenAndStartWithAlternate(t *testing.T) {
+	require := require.New(t)
+	log, err := zap.NewDevelopment()
+	require.NoError(err)
+	server, err := stun.ListenAndStartWithAlternate("127.0.0.1:0", "127.0.0.2:0", log)
+	if err != nil {
+		t.Skipf("cannot listen on a second loopback address: %v", err)
+	}
+	defer util.IgnoreError(server.Shutdown)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(err)
+	defer util.IgnoreError(conn.Close)
+
+	// the answer to a CHANGE-REQUEST comes from the alternate ip and port asked for
+	transact := func(change byte) (*pionstun.Message, *net.UDPAddr) {
+		setters := []pionstun.Setter{pionstun.TransactionID, pionstun.BindingRequest}
+		if change != 0 {
+			setters = append(setters, pionstun.RawAttribute{Type: pionstun.AttrChangeRequest, Value: []byte{0, 0, 0, change}})
+		}
+		_, err := conn.WriteTo(pionstun.MustBuild(setters...).Raw, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: server.Port})
+		require.NoError(err)
+		require.NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+		buf := make([]byte, 1500)
+		n, from, err := conn.ReadFrom(buf)
+		require.NoError(err)
+		m := &pionstun.Message{Raw: buf[:n]}
+		require.NoError(m.Decode())
+		return m, from.(*net.UDPAddr)
+	}
+	m, from := transact(0)
+	require.Equal("127.0.0.1", from.IP.String())
+	require.Equal(server.Port, from.Port)
+	var other pionstun.OtherAddress
+	require.NoError(other.GetFrom(m))
+	require.Equal(fmt.Sprintf("127.0.0.2:%d", server.AlternatePort), other.String())
+
+	_, from = transact(0x02)
+	require.Equal("127.0.0.1", from.IP.String())
+	require.Equal(server.AlternatePort, from.Port)
+	_, from = transact(0x06)
+	require.Equal("127.0.0.2", from.IP.String())
+	require.Equal(server.AlternatePort, from.Port)
+
+	// without a NAT in between, everything gets through
+	behavior, err := stun.DiscoverBehavior(log.Sugar(), fmt.Sprintf("127.0.0.1:%d", server.Port))
+	require.NoError(err)
+	require.Equal(stun.NatBehavior{
+		Mapping:     stun.EndpointIndependent,
+		Filtering:   stun.EndpointIndependent,
+		Hairpinning: true,
+	}, behavior)
+}
+
+func TestDiscoverBehaviorUnsupported(t *testing.T) {
+	require := require.New(t)
+	log, err := zap.NewDevelopment()
+	require.NoError(err)
+	server, err := stun.ListenAndStart("127.0.0.1:0", log)
+	require.NoError(err)
+	defer util.IgnoreError(server.Shutdown)
+
+	_, err = stun.DiscoverBehavior(log.Sugar(), fmt.Sprintf("127.0.0.1:%d", server.Port))
+	require.ErrorIs(err, stun.ErrBehaviorDiscoveryUnsupported)
+}